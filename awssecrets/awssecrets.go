@@ -0,0 +1,62 @@
+// Package awssecrets writes certificates and private keys to AWS Secrets
+// Manager and to SecureString parameters in AWS Systems Manager Parameter
+// Store, where Lambda functions and ECS tasks can read them at startup.
+//
+// The credentials and the region are loaded from the environment and the
+// shared AWS configuration, like the rest of the AWS tools. The AWS SDK is
+// only included with the awssecrets build tag, without it NewClient returns an
+// error.
+package awssecrets
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type options struct {
+	region   string
+	profile  string
+	kmsKeyID string
+}
+
+// Option is the type of the options passed to NewClient.
+type Option func(o *options)
+
+// WithRegion sets the AWS region, by default the region is loaded from the
+// environment or the shared configuration.
+func WithRegion(region string) Option {
+	return func(o *options) {
+		o.region = region
+	}
+}
+
+// WithProfile sets the profile in the shared configuration to use.
+func WithProfile(profile string) Option {
+	return func(o *options) {
+		o.profile = profile
+	}
+}
+
+// WithKMSKey sets the id, ARN or alias of the AWS KMS key used to encrypt
+// the secrets and parameters. By default the AWS managed keys aws/secretsmanager
+// and aws/ssm are used.
+func WithKMSKey(keyID string) Option {
+	return func(o *options) {
+		o.kmsKeyID = keyID
+	}
+}
+
+// ParseParameterPath validates and cleans the given parameter path, e.g.
+// "/step/internal". The parameters are created under this path.
+func ParseParameterPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", errors.Errorf("invalid parameter path '%s': it must start with '/'", p)
+	}
+	clean := path.Clean(p)
+	if clean == "/" {
+		return "", errors.Errorf("invalid parameter path '%s'", p)
+	}
+	return clean, nil
+}
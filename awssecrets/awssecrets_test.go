@@ -0,0 +1,28 @@
+package awssecrets
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestParseParameterPath(t *testing.T) {
+	tests := map[string]string{
+		"/step/internal":    "/step/internal",
+		"/step//internal/":  "/step/internal",
+		"/step/./internal/": "/step/internal",
+		"/step":             "/step",
+		"step/internal":     "",
+		"/":                 "",
+		"":                  "",
+	}
+	for p, want := range tests {
+		got, err := ParseParameterPath(p)
+		if want == "" {
+			assert.Error(t, err)
+		} else {
+			assert.FatalError(t, err)
+			assert.Equals(t, want, got)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// +build awssecrets
+
+package awssecrets
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/pkg/errors"
+)
+
+// secretsManagerAPI is the subset of the Secrets Manager client used.
+type secretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error)
+	UpdateSecret(ctx context.Context, params *secretsmanager.UpdateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretOutput, error)
+}
+
+// ssmAPI is the subset of the Systems Manager client used.
+type ssmAPI interface {
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
+// Client writes secrets to AWS Secrets Manager and Parameter Store.
+type Client struct {
+	secrets  secretsManagerAPI
+	ssm      ssmAPI
+	kmsKeyID string
+}
+
+// NewClient returns a new client using the default AWS configuration.
+func NewClient(ctx context.Context, opts ...Option) (*Client, error) {
+	o := new(options)
+	for _, fn := range opts {
+		fn(o)
+	}
+
+	var loadOpts []func(*config.LoadOptions) error
+	if o.region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(o.region))
+	}
+	if o.profile != "" {
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(o.profile))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading AWS configuration")
+	}
+
+	return &Client{
+		secrets:  secretsmanager.NewFromConfig(cfg),
+		ssm:      ssm.NewFromConfig(cfg),
+		kmsKeyID: o.kmsKeyID,
+	}, nil
+}
+
+// PutSecret writes the given data as a JSON object in the secret with the
+// given name or ARN, and creates the secret if it does not exist. The data is
+// merged with the current value of the secret, so a renewed certificate can
+// be written without removing the private key.
+func (c *Client) PutSecret(ctx context.Context, name string, data map[string]string) error {
+	value := make(map[string]interface{})
+	resp, err := c.secrets.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	switch {
+	case isNotFound(err):
+		for k, v := range data {
+			value[k] = v
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling secret")
+		}
+		if _, err := c.secrets.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+			Name:         aws.String(name),
+			SecretString: aws.String(string(b)),
+			KmsKeyId:     c.kmsKey(),
+		}); err != nil {
+			return errors.Wrapf(err, "error creating secret %s", name)
+		}
+		return nil
+	case err != nil:
+		return errors.Wrapf(err, "error getting secret %s", name)
+	}
+
+	if s := aws.ToString(resp.SecretString); s != "" {
+		if err := json.Unmarshal([]byte(s), &value); err != nil {
+			return errors.Errorf("error updating secret %s: the current value is not a JSON object", name)
+		}
+	}
+	for k, v := range data {
+		value[k] = v
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling secret")
+	}
+	if _, err := c.secrets.UpdateSecret(ctx, &secretsmanager.UpdateSecretInput{
+		SecretId:     aws.String(name),
+		SecretString: aws.String(string(b)),
+		KmsKeyId:     c.kmsKey(),
+	}); err != nil {
+		return errors.Wrapf(err, "error updating secret %s", name)
+	}
+	return nil
+}
+
+// PutParameters writes each entry in data as a SecureString parameter under
+// the given path, e.g. "/step/internal/certificate". Existing parameters are
+// overwritten, and the rest of the parameters under the path are kept. The
+// intelligent tiering is used, so parameters larger than 4 KB are stored in
+// the advanced tier.
+func (c *Client) PutParameters(ctx context.Context, p string, data map[string]string) error {
+	p, err := ParseParameterPath(p)
+	if err != nil {
+		return err
+	}
+	for k, v := range data {
+		name := p + "/" + k
+		if _, err := c.ssm.PutParameter(ctx, &ssm.PutParameterInput{
+			Name:      aws.String(name),
+			Value:     aws.String(v),
+			Type:      ssmtypes.ParameterTypeSecureString,
+			KeyId:     c.kmsKey(),
+			Overwrite: aws.Bool(true),
+			Tier:      ssmtypes.ParameterTierIntelligentTiering,
+		}); err != nil {
+			return errors.Wrapf(err, "error writing parameter %s", name)
+		}
+	}
+	return nil
+}
+
+func (c *Client) kmsKey() *string {
+	if c.kmsKeyID == "" {
+		return nil
+	}
+	return aws.String(c.kmsKeyID)
+}
+
+// isNotFound returns true if the error, or any of the errors wrapped by it, is
+// a ResourceNotFoundException. The SDK wraps the errors of the services.
+func isNotFound(err error) bool {
+	for err != nil {
+		if _, ok := err.(*smtypes.ResourceNotFoundException); ok {
+			return true
+		}
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			return false
+		}
+	}
+	return false
+}
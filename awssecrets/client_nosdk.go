@@ -0,0 +1,28 @@
+// +build !awssecrets
+
+package awssecrets
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Client writes secrets to AWS Secrets Manager and Parameter Store. The AWS
+// SDK is only included with the awssecrets build tag.
+type Client struct{}
+
+// NewClient returns an error, step was compiled without the AWS SDK.
+func NewClient(ctx context.Context, opts ...Option) (*Client, error) {
+	return nil, errors.New("AWS Secrets Manager is not supported: step was compiled without the awssecrets build tag")
+}
+
+// PutSecret returns an error, step was compiled without the AWS SDK.
+func (c *Client) PutSecret(ctx context.Context, name string, data map[string]string) error {
+	return errors.New("AWS Secrets Manager is not supported: step was compiled without the awssecrets build tag")
+}
+
+// PutParameters returns an error, step was compiled without the AWS SDK.
+func (c *Client) PutParameters(ctx context.Context, p string, data map[string]string) error {
+	return errors.New("AWS Systems Manager is not supported: step was compiled without the awssecrets build tag")
+}
@@ -0,0 +1,149 @@
+// +build awssecrets
+
+package awssecrets
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+// operationError wraps an error like the errors returned by the SDK.
+type operationError struct {
+	err error
+}
+
+func (e *operationError) Error() string { return "operation error: " + e.err.Error() }
+
+func (e *operationError) Unwrap() error { return e.err }
+
+type fakeSecretsManager struct {
+	secrets map[string]string
+	keys    map[string]string
+	err     error
+}
+
+func (f *fakeSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	s, ok := f.secrets[aws.ToString(params.SecretId)]
+	if !ok {
+		// The SDK wraps the service errors.
+		return nil, &operationError{err: &smtypes.ResourceNotFoundException{Message: aws.String("not found")}}
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(s)}, nil
+}
+
+func (f *fakeSecretsManager) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	f.secrets[aws.ToString(params.Name)] = aws.ToString(params.SecretString)
+	f.keys[aws.ToString(params.Name)] = aws.ToString(params.KmsKeyId)
+	return &secretsmanager.CreateSecretOutput{}, nil
+}
+
+func (f *fakeSecretsManager) UpdateSecret(ctx context.Context, params *secretsmanager.UpdateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretOutput, error) {
+	f.secrets[aws.ToString(params.SecretId)] = aws.ToString(params.SecretString)
+	f.keys[aws.ToString(params.SecretId)] = aws.ToString(params.KmsKeyId)
+	return &secretsmanager.UpdateSecretOutput{}, nil
+}
+
+type fakeSSM struct {
+	params map[string]*ssm.PutParameterInput
+}
+
+func (f *fakeSSM) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	f.params[aws.ToString(params.Name)] = params
+	return &ssm.PutParameterOutput{}, nil
+}
+
+
+func TestClient_PutSecret(t *testing.T) {
+	data := map[string]string{"certificate": "crt", "private_key": "key"}
+	tests := map[string]struct {
+		current  map[string]string
+		kmsKeyID string
+		err      error
+		want     map[string]interface{}
+		wantKey  string
+		wantErr  bool
+	}{
+		"ok create": {
+			current: map[string]string{},
+			want:    map[string]interface{}{"certificate": "crt", "private_key": "key"},
+		},
+		"ok create with key": {
+			current:  map[string]string{},
+			kmsKeyID: "alias/step",
+			want:     map[string]interface{}{"certificate": "crt", "private_key": "key"},
+			wantKey:  "alias/step",
+		},
+		"ok merge": {
+			current: map[string]string{"step/internal": `{"private_key":"old","port":8443}`},
+			want:    map[string]interface{}{"certificate": "crt", "private_key": "key", "port": float64(8443)},
+		},
+		"fail not json": {
+			current: map[string]string{"step/internal": `secret`},
+			wantErr: true,
+		},
+		"fail get": {
+			current: map[string]string{},
+			err:     errors.New("access denied"),
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeSecretsManager{secrets: tc.current, keys: map[string]string{}, err: tc.err}
+			c := &Client{secrets: f, kmsKeyID: tc.kmsKeyID}
+			err := c.PutSecret(context.Background(), "step/internal", data)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			var got map[string]interface{}
+			assert.FatalError(t, json.Unmarshal([]byte(f.secrets["step/internal"]), &got))
+			assert.Equals(t, tc.want, got)
+			assert.Equals(t, tc.wantKey, f.keys["step/internal"])
+		})
+	}
+}
+
+func TestClient_PutParameters(t *testing.T) {
+	f := &fakeSSM{params: map[string]*ssm.PutParameterInput{}}
+	c := &Client{ssm: f, kmsKeyID: "alias/step"}
+	assert.FatalError(t, c.PutParameters(context.Background(), "/step/internal/", map[string]string{
+		"certificate": "crt",
+		"private_key": "key",
+	}))
+	assert.Equals(t, 2, len(f.params))
+	for name, value := range map[string]string{"/step/internal/certificate": "crt", "/step/internal/private_key": "key"} {
+		p, ok := f.params[name]
+		if assert.True(t, ok, name) {
+			assert.Equals(t, value, aws.ToString(p.Value))
+			assert.Equals(t, ssmtypes.ParameterTypeSecureString, p.Type)
+			assert.Equals(t, "alias/step", aws.ToString(p.KeyId))
+			assert.True(t, aws.ToBool(p.Overwrite))
+		}
+	}
+
+	assert.Error(t, c.PutParameters(context.Background(), "step/internal", map[string]string{"certificate": "crt"}))
+}
+
+func TestIsNotFound(t *testing.T) {
+	notFound := &smtypes.ResourceNotFoundException{Message: aws.String("not found")}
+	assert.True(t, isNotFound(notFound))
+	assert.True(t, isNotFound(&operationError{err: notFound}))
+	assert.True(t, isNotFound(errors.Wrap(&operationError{err: notFound}, "error getting secret")))
+	assert.False(t, isNotFound(&operationError{err: errors.New("access denied")}))
+	assert.False(t, isNotFound(errors.New("access denied")))
+	assert.False(t, isNotFound(nil))
+}
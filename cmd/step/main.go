@@ -8,6 +8,7 @@ import (
 	"os"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,14 +17,28 @@ import (
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/command/version"
 	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/debug"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/token"
+	"github.com/smallstep/cli/ui"
 	"github.com/smallstep/cli/usage"
 
 	// Enabled commands
+	_ "github.com/smallstep/cli/command/apply"
 	_ "github.com/smallstep/cli/command/ca"
 	_ "github.com/smallstep/cli/command/certificate"
+	_ "github.com/smallstep/cli/command/completion"
+	_ "github.com/smallstep/cli/command/context"
 	_ "github.com/smallstep/cli/command/crypto"
+	_ "github.com/smallstep/cli/command/est"
+	_ "github.com/smallstep/cli/command/keyring"
 	_ "github.com/smallstep/cli/command/oauth"
 	_ "github.com/smallstep/cli/command/path"
+	_ "github.com/smallstep/cli/command/scep"
+	_ "github.com/smallstep/cli/command/ssh"
+	_ "github.com/smallstep/cli/command/update"
 
 	// Profiling and debugging
 	_ "net/http/pprof"
@@ -72,6 +87,139 @@ func main() {
 		Usage: "path to the config file to use for CLI flags",
 	})
 
+	// Flags of the output format
+	app.Flags = append(app.Flags, cli.StringFlag{
+		Name:   "format",
+		Usage:  "output <format> of the commands that support it: text, json or yaml",
+		EnvVar: "STEP_FORMAT",
+	}, cli.BoolFlag{
+		Name:  "json",
+		Usage: "write the output of the commands as JSON, same as --format json",
+	})
+
+	// Flag to fail instead of prompting
+	app.Flags = append(app.Flags, cli.BoolFlag{
+		Name: "no-prompt",
+		Usage: `fail instead of prompting for the values not given in flags, prompts
+are also disabled if there is no terminal available`,
+		EnvVar: "STEP_NO_PROMPT",
+	})
+
+	// Flags of the logs
+	app.Flags = append(app.Flags, cli.BoolFlag{
+		Name: "verbose",
+		Usage: `log the requests to the CA, the claims of the tokens, and the files read and
+written to stderr`,
+		EnvVar: "STEP_VERBOSE",
+	}, cli.BoolFlag{
+		Name:   "debug",
+		Usage:  "log also the headers and bodies of the requests to the CA, implies --verbose",
+		EnvVar: "STEP_DEBUG",
+	})
+
+	// Flag of the addresses used to connect to the CA
+	app.Flags = append(app.Flags, cli.StringSliceFlag{
+		Name: "resolve",
+		Usage: `connect to the CA using a fixed address instead of resolving its name, the
+<value> has the format host:port:address, e.g. ca.example.com:443:10.0.0.10; use
+the flag multiple times to add multiple entries`,
+		EnvVar: "STEP_RESOLVE",
+	})
+
+	// Flag of the timeout of the requests to the CA
+	app.Flags = append(app.Flags, cli.DurationFlag{
+		Name: "timeout",
+		Usage: `the maximum <duration> of each request to the CA, including reading the
+response, e.g. 30s; by default there is no timeout`,
+		EnvVar: "STEP_TIMEOUT",
+	})
+
+	// Flag of the clock skew of the tokens
+	app.Flags = append(app.Flags, cli.DurationFlag{
+		Name: "skew",
+		Usage: `the <duration> subtracted from the current time in the not before (nbf) and
+issued at (iat) claims of the new tokens, for CAs with a clock behind the local
+one, e.g. 2m; the maximum is 30m`,
+		EnvVar: "STEP_SKEW",
+	})
+
+	// Flag of the minimum entropy of the new passwords
+	app.Flags = append(app.Flags, cli.IntFlag{
+		Name: "min-password-entropy",
+		Usage: `the minimum estimated entropy in <bits> of the passwords used to encrypt new
+keys, e.g. 64; by default any password is accepted`,
+		EnvVar: "STEP_MIN_PASSWORD_ENTROPY",
+	})
+
+	// Flags of the client certificate presented to the CA
+	app.Flags = append(app.Flags, cli.StringFlag{
+		Name: "client-crt",
+		Usage: `the certificate <file> presented to the CA in all the requests, for CAs behind
+a proxy that requires mutual TLS; requires --client-key`,
+		EnvVar: "STEP_CLIENT_CRT",
+	}, cli.StringFlag{
+		Name:   "client-key",
+		Usage:  "the private key <file> of the certificate in --client-crt",
+		EnvVar: "STEP_CLIENT_KEY",
+	}, cli.StringFlag{
+		Name: "client-key-password-file",
+		Usage: `the <file> with the password to decrypt --client-key; the password is
+prompted if the key is encrypted and this flag is not set`,
+		EnvVar: "STEP_CLIENT_KEY_PASSWORD_FILE",
+	})
+
+	app.Before = func(ctx *cli.Context) error {
+		ui.SetNoPrompt(ctx.GlobalBool("no-prompt"))
+		minEntropy := ctx.GlobalInt("min-password-entropy")
+		if minEntropy < 0 {
+			return errs.InvalidFlagValue(ctx, "min-password-entropy", strconv.Itoa(minEntropy), "")
+		}
+		ui.SetMinPasswordEntropy(minEntropy)
+		if err := pki.SetResolve(ctx.GlobalStringSlice("resolve")); err != nil {
+			return err
+		}
+		timeout := ctx.GlobalDuration("timeout")
+		if timeout < 0 {
+			return errs.InvalidFlagValue(ctx, "timeout", timeout.String(), "")
+		}
+		pki.SetTimeout(timeout)
+		skew := ctx.GlobalDuration("skew")
+		if skew < 0 || skew > token.MaxSkew {
+			return errs.InvalidFlagValue(ctx, "skew", skew.String(), "")
+		}
+		token.SetSkew(skew)
+		crtFile, keyFile := ctx.GlobalString("client-crt"), ctx.GlobalString("client-key")
+		switch {
+		case crtFile != "" && keyFile == "":
+			return errs.RequiredWithFlag(ctx, "client-crt", "client-key")
+		case keyFile != "" && crtFile == "":
+			return errs.RequiredWithFlag(ctx, "client-key", "client-crt")
+		}
+		var opts []pemutil.Options
+		if passFile := ctx.GlobalString("client-key-password-file"); passFile != "" {
+			opts = append(opts, pemutil.WithPasswordFile(passFile))
+		}
+		if err := pki.SetClientCertificate(crtFile, keyFile, opts...); err != nil {
+			return err
+		}
+
+		switch {
+		case ctx.GlobalBool("debug"):
+			debug.SetLevel(debug.LevelDebug)
+		case ctx.GlobalBool("verbose"):
+			debug.SetLevel(debug.LevelVerbose)
+		}
+
+		format := ctx.GlobalString("format")
+		if ctx.GlobalBool("json") {
+			if format != "" && format != ui.FormatJSON {
+				return errs.IncompatibleFlagWithFlag(ctx, "json", "format")
+			}
+			format = ui.FormatJSON
+		}
+		return ui.SetFormat(format)
+	}
+
 	// All non-successful output should be written to stderr
 	app.Writer = os.Stdout
 	app.ErrWriter = os.Stderr
@@ -85,13 +233,17 @@ func main() {
 		}()
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	err := app.Run(os.Args)
+	if err == nil {
+		err = ui.Flush()
+	}
+	if err != nil {
 		if os.Getenv("STEPDEBUG") == "1" {
 			fmt.Fprintf(os.Stderr, "%+v\n", err)
 		} else {
 			fmt.Fprintln(os.Stderr, err)
 		}
-		os.Exit(1)
+		os.Exit(errs.ExitCode(err))
 	}
 }
 
@@ -0,0 +1,792 @@
+package apply
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func init() {
+	cmd := cli.Command{
+		Name:   "apply",
+		Action: cli.ActionFunc(applyAction),
+		Usage:  "make the certificates on disk match a declarative specification",
+		UsageText: `**step apply** **--file**=<file>
+[**--dry-run**] [**--renew-before**=<duration>]`,
+		Description: `**step apply** reads a declarative specification of the desired X.509 and SSH
+certificates, compares it with the certificates found on disk, and performs
+only the actions required to reach the desired state. Running the command
+again with the same specification is a no-op until a certificate needs to be
+renewed.
+
+For each certificate in the specification one of the following actions is
+planned:
+
+**create**
+:  The certificate or key file does not exist, the certificate has expired,
+or the subject or SANs of the certificate do not match the specification. A
+new token is generated with **step ca token** and the certificate is requested
+with **step ca certificate**. SSH certificates are requested with **step ssh
+certificate** if the key id, principals or type do not match.
+
+**renew**
+:  The certificate expires in less than the renew-before duration. The
+certificate is renewed with **step ca renew** or **step ssh renew**.
+
+**delete**
+:  The certificate has the state 'absent' and the files exist. The
+certificate is revoked with **step ca revoke** or **step ssh revoke**, unless
+it has expired, and the certificate and key files are removed.
+
+Before performing any action the plan is printed to STDERR. Use **--dry-run**
+to only print the plan.
+
+The specification is a YAML (or JSON) file with the following format:
+'''
+ca-url: https://ca.example.com
+root: /home/user/.step/certs/root_ca.crt
+provisioner: admin@example.com
+password-file: /run/secrets/provisioner-password
+renew-before: 8h
+certificates:
+  - subject: web.example.com
+    san: [web.example.com, www.example.com]
+    crt: /etc/nginx/web.crt
+    key: /etc/nginx/web.key
+    not-after: 24h
+  - subject: old.example.com
+    crt: /etc/nginx/old.crt
+    key: /etc/nginx/old.key
+    state: absent
+ssh:
+  - key-id: web.example.com
+    principals: [web.example.com, 10.0.0.1]
+    host: true
+    key: /etc/ssh/ssh_host_ecdsa_key
+  - key-id: deploy@example.com
+    key: /home/deploy/.ssh/id_ecdsa
+    not-after: 16h
+'''
+
+The SSH certificate is written to <key>-cert.pub and the public key to
+<key>.pub. The private keys of SSH certificates are not encrypted, so they can
+be renewed without a password. If no principals are given, the local part of
+the key id is used in user certificates, and the key id in host certificates.
+
+The top level <ca-url>, <root>, <provisioner>, <password-file> and
+<renew-before> are used for all the certificates, and they can be overwritten
+in each certificate. If <ca-url> or <root> are not set the defaults of the
+**step ca** and **step ssh** commands are used.
+
+## EXAMPLES
+
+Show the actions required to apply a specification:
+'''
+$ step apply --dry-run -f certs.yaml
++ web.example.com (/etc/nginx/web.crt): create, certificate does not exist
+~ api.example.com (/etc/nginx/api.crt): renew, expires in 2h13m
+- old.example.com (/etc/nginx/old.crt): delete
+  db.example.com (/etc/nginx/db.crt): up to date
+~ deploy@example.com (/home/deploy/.ssh/id_ecdsa-cert.pub): renew, expires in 4h2m
+Plan: 1 to create, 2 to renew, 1 to delete.
+'''
+
+Apply a specification:
+'''
+$ step apply -f certs.yaml
+'''
+
+Apply a specification from a cron job, renewing certificates that expire in
+less than 12h:
+'''
+$ step apply --renew-before 12h -f /etc/step/certs.yaml
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "file,f",
+				Usage: "The <file> with the specification of the desired certificates.",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the plan without performing any action.",
+			},
+			cli.StringFlag{
+				Name: "renew-before",
+				Usage: `The <duration> before the expiration of a certificate in which it will be
+renewed. This flag overwrites the value in the specification. Defaults to 1/3
+of the lifetime of the certificate.`,
+			},
+		},
+	}
+
+	command.Register(cmd)
+}
+
+// options are the values used to connect to the CA. They can be set at the
+// top level of the specification and overwritten in each certificate.
+type options struct {
+	CaURL        string `yaml:"ca-url"`
+	Root         string `yaml:"root"`
+	Provisioner  string `yaml:"provisioner"`
+	PasswordFile string `yaml:"password-file"`
+	RenewBefore  string `yaml:"renew-before"`
+}
+
+// inherit sets the empty values with the ones in parent.
+func (o *options) inherit(parent options) {
+	if o.CaURL == "" {
+		o.CaURL = parent.CaURL
+	}
+	if o.Root == "" {
+		o.Root = parent.Root
+	}
+	if o.Provisioner == "" {
+		o.Provisioner = parent.Provisioner
+	}
+	if o.PasswordFile == "" {
+		o.PasswordFile = parent.PasswordFile
+	}
+	if o.RenewBefore == "" {
+		o.RenewBefore = parent.RenewBefore
+	}
+}
+
+// caArgs returns the flags used to connect to the CA.
+func (o options) caArgs() []string {
+	var args []string
+	if o.CaURL != "" {
+		args = append(args, "--ca-url", o.CaURL)
+	}
+	if o.Root != "" {
+		args = append(args, "--root", o.Root)
+	}
+	return args
+}
+
+// renewBefore returns the renew-before duration, or 1/3 of the given lifetime
+// if it is not set.
+func (o options) renewBefore(lifetime time.Duration) (time.Duration, error) {
+	if o.RenewBefore == "" {
+		return lifetime / 3, nil
+	}
+	d, err := time.ParseDuration(o.RenewBefore)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error parsing renew-before '%s'", o.RenewBefore)
+	}
+	return d, nil
+}
+
+// spec is the declarative specification of the desired certificates.
+type spec struct {
+	options      `yaml:",inline"`
+	Certificates []certificate    `yaml:"certificates"`
+	SSH          []sshCertificate `yaml:"ssh"`
+}
+
+// certificate is the desired state of an X.509 certificate.
+type certificate struct {
+	options  `yaml:",inline"`
+	Subject  string   `yaml:"subject"`
+	SANs     []string `yaml:"san"`
+	Crt      string   `yaml:"crt"`
+	Key      string   `yaml:"key"`
+	NotAfter string   `yaml:"not-after"`
+	State    string   `yaml:"state"`
+}
+
+// sshCertificate is the desired state of an SSH certificate. The certificate
+// is stored in the file <key>-cert.pub.
+type sshCertificate struct {
+	options    `yaml:",inline"`
+	KeyID      string   `yaml:"key-id"`
+	Principals []string `yaml:"principals"`
+	Host       bool     `yaml:"host"`
+	Key        string   `yaml:"key"`
+	NotAfter   string   `yaml:"not-after"`
+	State      string   `yaml:"state"`
+}
+
+// target is a certificate in the specification.
+type target interface {
+	name() string
+	file() string
+	plan(now time.Time) (action, error)
+	create() error
+	renew() error
+	remove() error
+}
+
+type actionType int
+
+const (
+	actionNone actionType = iota
+	actionCreate
+	actionRenew
+	actionDelete
+)
+
+// action is an step of the plan.
+type action struct {
+	Type   actionType
+	Target target
+	Reason string
+}
+
+func (a action) String() string {
+	var prefix, name string
+	switch a.Type {
+	case actionCreate:
+		prefix, name = "+", "create"
+	case actionRenew:
+		prefix, name = "~", "renew"
+	case actionDelete:
+		prefix, name = "-", "delete"
+	default:
+		prefix, name = " ", "up to date"
+	}
+	s := fmt.Sprintf("%s %s (%s): %s", prefix, a.Target.name(), a.Target.file(), name)
+	if a.Reason != "" {
+		s += ", " + a.Reason
+	}
+	return s
+}
+
+func applyAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+
+	filename := ctx.String("file")
+	if filename == "" {
+		return errs.RequiredFlag(ctx, "file")
+	}
+
+	s, err := readSpec(filename)
+	if err != nil {
+		return err
+	}
+	if v := ctx.String("renew-before"); v != "" {
+		if _, err := time.ParseDuration(v); err != nil {
+			return errs.InvalidFlagValue(ctx, "renew-before", v, "")
+		}
+		s.RenewBefore = v
+		for i := range s.Certificates {
+			s.Certificates[i].RenewBefore = v
+		}
+		for i := range s.SSH {
+			s.SSH[i].RenewBefore = v
+		}
+	}
+
+	plan, err := makePlan(s, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var creates, renews, deletes int
+	for _, a := range plan {
+		fmt.Fprintln(os.Stderr, a)
+		switch a.Type {
+		case actionCreate:
+			creates++
+		case actionRenew:
+			renews++
+		case actionDelete:
+			deletes++
+		}
+	}
+	if creates+renews+deletes == 0 {
+		fmt.Fprintln(os.Stderr, "No changes. The certificates are up to date.")
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Plan: %d to create, %d to renew, %d to delete.\n", creates, renews, deletes)
+
+	if ctx.Bool("dry-run") {
+		return nil
+	}
+
+	for _, a := range plan {
+		var err error
+		switch a.Type {
+		case actionCreate:
+			err = a.Target.create()
+		case actionRenew:
+			err = a.Target.renew()
+		case actionDelete:
+			err = a.Target.remove()
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error applying %s", a.Target.name())
+		}
+	}
+	return nil
+}
+
+// readSpec reads and validates the specification in the given file.
+func readSpec(filename string) (*spec, error) {
+	b, err := utils.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	s := new(spec)
+	if err := yaml.UnmarshalStrict(b, s); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+
+	seen := make(map[string]bool)
+	for i := range s.Certificates {
+		c := &s.Certificates[i]
+		switch {
+		case c.Subject == "":
+			return nil, errors.Errorf("error parsing %s: certificate %d: subject cannot be empty", filename, i+1)
+		case c.Crt == "" || c.Key == "":
+			return nil, errors.Errorf("error parsing %s: certificate %s: crt and key cannot be empty", filename, c.Subject)
+		case c.Crt == c.Key:
+			return nil, errors.Errorf("error parsing %s: certificate %s: crt and key cannot be the same file", filename, c.Subject)
+		case seen[c.Crt]:
+			return nil, errors.Errorf("error parsing %s: certificate %s: %s is used more than once", filename, c.Subject, c.Crt)
+		}
+		seen[c.Crt] = true
+
+		if err := validateOptions(&c.State, &c.options, s.options); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s: certificate %s", filename, c.Subject)
+		}
+	}
+
+	for i := range s.SSH {
+		c := &s.SSH[i]
+		switch {
+		case c.KeyID == "":
+			return nil, errors.Errorf("error parsing %s: ssh certificate %d: key-id cannot be empty", filename, i+1)
+		case c.Key == "":
+			return nil, errors.Errorf("error parsing %s: ssh certificate %s: key cannot be empty", filename, c.KeyID)
+		case seen[c.file()]:
+			return nil, errors.Errorf("error parsing %s: ssh certificate %s: %s is used more than once", filename, c.KeyID, c.file())
+		}
+		seen[c.file()] = true
+
+		if len(c.Principals) == 0 {
+			c.Principals = []string{defaultPrincipal(c.Host, c.KeyID)}
+		}
+		if err := validateOptions(&c.State, &c.options, s.options); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s: ssh certificate %s", filename, c.KeyID)
+		}
+	}
+
+	return s, nil
+}
+
+// validateOptions validates the state and renew-before of a certificate, and
+// sets the values inherited from the top level of the specification.
+func validateOptions(state *string, o *options, parent options) error {
+	switch *state {
+	case "":
+		*state = "present"
+	case "present", "absent":
+	default:
+		return errors.Errorf("unsupported state '%s', state must be present or absent", *state)
+	}
+
+	o.inherit(parent)
+	if o.RenewBefore != "" {
+		if _, err := time.ParseDuration(o.RenewBefore); err != nil {
+			return errors.Errorf("invalid renew-before '%s'", o.RenewBefore)
+		}
+	}
+	return nil
+}
+
+// defaultPrincipal returns the principal used by step ssh certificate if none
+// is given. In user certificates it is the local part of the key id if it is
+// an email, in any other case the key id.
+func defaultPrincipal(host bool, keyID string) string {
+	if !host {
+		if i := strings.LastIndex(keyID, "@"); i > 0 {
+			return keyID[:i]
+		}
+	}
+	return keyID
+}
+
+// makePlan compares the specification with the files on disk and returns
+// the actions required to reach the desired state.
+func makePlan(s *spec, now time.Time) ([]action, error) {
+	targets := make([]target, 0, len(s.Certificates)+len(s.SSH))
+	for _, c := range s.Certificates {
+		targets = append(targets, c)
+	}
+	for _, c := range s.SSH {
+		targets = append(targets, c)
+	}
+
+	plan := make([]action, 0, len(targets))
+	for _, t := range targets {
+		a, err := t.plan(now)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, a)
+	}
+	return plan, nil
+}
+
+// planAbsent returns the action for a certificate with the state absent.
+func planAbsent(t target, files ...string) action {
+	for _, f := range files {
+		if utils.FileExists(f) {
+			return action{Type: actionDelete, Target: t}
+		}
+	}
+	return action{Type: actionNone, Target: t, Reason: "does not exist"}
+}
+
+func (c certificate) name() string { return c.Subject }
+
+func (c certificate) file() string { return c.Crt }
+
+func (c certificate) plan(now time.Time) (action, error) {
+	if c.State == "absent" {
+		return planAbsent(c, c.Crt, c.Key), nil
+	}
+
+	switch {
+	case !utils.FileExists(c.Crt):
+		return action{Type: actionCreate, Target: c, Reason: "certificate does not exist"}, nil
+	case !utils.FileExists(c.Key):
+		return action{Type: actionCreate, Target: c, Reason: "key does not exist"}, nil
+	}
+
+	crt, err := pemutil.ReadCertificate(c.Crt)
+	if err != nil {
+		return action{Type: actionCreate, Target: c, Reason: "certificate cannot be read"}, nil
+	}
+	if crt.Subject.CommonName != c.Subject {
+		return action{Type: actionCreate, Target: c, Reason: "subject does not match"}, nil
+	}
+	if !equalSANs(crt, c.Subject, c.SANs) {
+		return action{Type: actionCreate, Target: c, Reason: "SANs do not match"}, nil
+	}
+	if !now.Before(crt.NotAfter) {
+		return action{Type: actionCreate, Target: c, Reason: "certificate has expired"}, nil
+	}
+
+	renewBefore, err := c.renewBefore(crt.NotAfter.Sub(crt.NotBefore))
+	if err != nil {
+		return action{}, err
+	}
+	if left := crt.NotAfter.Sub(now); left < renewBefore {
+		return action{Type: actionRenew, Target: c, Reason: "expires in " + left.Round(time.Minute).String()}, nil
+	}
+
+	return action{Type: actionNone, Target: c}, nil
+}
+
+// equalSANs returns true if the SANs of the certificate are the desired ones.
+// If no SANs are specified the subject is expected to be the only SAN. The
+// desired SANs are normalized as on issuance, so IP addresses are compared by
+// value, internationalized names in punycode, and duplicates are ignored. DNS
+// names and email addresses are compared ignoring the case.
+func equalSANs(crt *x509.Certificate, subject string, sans []string) bool {
+	if len(sans) == 0 {
+		sans = []string{subject}
+	}
+	unique, err := x509util.UniqueSANs(sans)
+	if err != nil {
+		return false
+	}
+
+	want := make(map[string]bool)
+	for _, s := range unique {
+		switch {
+		case net.ParseIP(s) != nil:
+			want["ip:"+s] = true
+		case strings.Contains(s, "://"):
+			want["uri:"+s] = true
+		case strings.Contains(s, "@"):
+			want["email:"+strings.ToLower(s)] = true
+		default:
+			want["dns:"+strings.ToLower(s)] = true
+		}
+	}
+
+	got := make(map[string]bool)
+	for _, s := range x509util.NormalizeSANs(crt.DNSNames) {
+		got["dns:"+strings.ToLower(s)] = true
+	}
+	for _, s := range crt.EmailAddresses {
+		got["email:"+strings.ToLower(s)] = true
+	}
+	for _, ip := range crt.IPAddresses {
+		got["ip:"+ip.String()] = true
+	}
+	for _, u := range crt.URIs {
+		got["uri:"+u.String()] = true
+	}
+
+	if len(want) != len(got) {
+		return false
+	}
+	for k := range want {
+		if !got[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalStrings returns true if a and b contain the same values in any order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c certificate) create() error {
+	args := []string{"ca", "token", c.Subject}
+	for _, san := range c.SANs {
+		args = append(args, "--san", san)
+	}
+	if c.Provisioner != "" {
+		args = append(args, "--issuer", c.Provisioner)
+	}
+	if c.PasswordFile != "" {
+		args = append(args, "--password-file", c.PasswordFile)
+	}
+	if c.NotAfter != "" {
+		args = append(args, "--not-after", c.NotAfter)
+	}
+	args = append(args, c.caArgs()...)
+
+	// The token is passed in a file only readable by the user, on the
+	// command line it would be visible in the list of processes.
+	dir, err := ioutil.TempDir("", "step-apply")
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	args = append(args, "--output-file", tokenFile)
+	if _, err := runStep(args...); err != nil {
+		return err
+	}
+
+	if err := makeDirs(c.Crt, c.Key); err != nil {
+		return err
+	}
+
+	args = []string{"ca", "certificate", c.Subject, c.Crt, c.Key, "--force",
+		"--token-file", tokenFile}
+	if c.NotAfter != "" {
+		args = append(args, "--not-after", c.NotAfter)
+	}
+	args = append(args, c.caArgs()...)
+	_, err = runStep(args...)
+	return err
+}
+
+func (c certificate) renew() error {
+	args := []string{"ca", "renew", c.Crt, c.Key, "--force"}
+	args = append(args, c.caArgs()...)
+	_, err := runStep(args...)
+	return err
+}
+
+// remove revokes the certificate, unless it has expired or it cannot be
+// read, and removes the certificate and key files.
+func (c certificate) remove() error {
+	if crt, err := pemutil.ReadCertificate(c.Crt); err == nil && time.Now().Before(crt.NotAfter) && utils.FileExists(c.Key) {
+		args := []string{"ca", "revoke", c.Crt, c.Key, "--force"}
+		args = append(args, c.caArgs()...)
+		if _, err := runStep(args...); err != nil {
+			return err
+		}
+	}
+	return removeFiles(c.Crt, c.Key)
+}
+
+func (c sshCertificate) name() string { return c.KeyID }
+
+func (c sshCertificate) file() string { return c.Key + "-cert.pub" }
+
+func (c sshCertificate) plan(now time.Time) (action, error) {
+	if c.State == "absent" {
+		return planAbsent(c, c.file(), c.Key, c.Key+".pub"), nil
+	}
+
+	switch {
+	case !utils.FileExists(c.file()):
+		return action{Type: actionCreate, Target: c, Reason: "certificate does not exist"}, nil
+	case !utils.FileExists(c.Key):
+		return action{Type: actionCreate, Target: c, Reason: "key does not exist"}, nil
+	}
+
+	crt, err := readSSHCertificate(c.file())
+	if err != nil {
+		return action{Type: actionCreate, Target: c, Reason: "certificate cannot be read"}, nil
+	}
+	certType := uint32(ssh.UserCert)
+	if c.Host {
+		certType = ssh.HostCert
+	}
+	if crt.CertType != certType {
+		return action{Type: actionCreate, Target: c, Reason: "certificate type does not match"}, nil
+	}
+	if crt.KeyId != c.KeyID {
+		return action{Type: actionCreate, Target: c, Reason: "key id does not match"}, nil
+	}
+	if !equalStrings(crt.ValidPrincipals, c.Principals) {
+		return action{Type: actionCreate, Target: c, Reason: "principals do not match"}, nil
+	}
+	if crt.ValidBefore == ssh.CertTimeInfinity {
+		return action{Type: actionNone, Target: c}, nil
+	}
+
+	validAfter := time.Unix(int64(crt.ValidAfter), 0)
+	validBefore := time.Unix(int64(crt.ValidBefore), 0)
+	if !now.Before(validBefore) {
+		return action{Type: actionCreate, Target: c, Reason: "certificate has expired"}, nil
+	}
+
+	renewBefore, err := c.renewBefore(validBefore.Sub(validAfter))
+	if err != nil {
+		return action{}, err
+	}
+	if left := validBefore.Sub(now); left < renewBefore {
+		return action{Type: actionRenew, Target: c, Reason: "expires in " + left.Round(time.Minute).String()}, nil
+	}
+
+	return action{Type: actionNone, Target: c}, nil
+}
+
+// readSSHCertificate reads the SSH certificate in the given file.
+func readSSHCertificate(filename string) (*ssh.Certificate, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+	crt, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.Errorf("error parsing %s: file is not a SSH certificate", filename)
+	}
+	return crt, nil
+}
+
+func (c sshCertificate) create() error {
+	if err := makeDirs(c.Key); err != nil {
+		return err
+	}
+
+	args := []string{"ssh", "certificate", c.KeyID, c.Key, "--force",
+		"--no-password", "--insecure"}
+	for _, p := range c.Principals {
+		args = append(args, "--principal", p)
+	}
+	if c.Host {
+		args = append(args, "--host")
+	}
+	if c.Provisioner != "" {
+		args = append(args, "--issuer", c.Provisioner)
+	}
+	if c.PasswordFile != "" {
+		args = append(args, "--password-file", c.PasswordFile)
+	}
+	if c.NotAfter != "" {
+		args = append(args, "--not-after", c.NotAfter)
+	}
+	args = append(args, c.caArgs()...)
+	_, err := runStep(args...)
+	return err
+}
+
+func (c sshCertificate) renew() error {
+	args := []string{"ssh", "renew", c.file(), c.Key, "--force"}
+	args = append(args, c.caArgs()...)
+	_, err := runStep(args...)
+	return err
+}
+
+// remove revokes the certificate, unless it has expired or it cannot be
+// read, and removes the certificate and key files.
+func (c sshCertificate) remove() error {
+	if crt, err := readSSHCertificate(c.file()); err == nil && utils.FileExists(c.Key) &&
+		(crt.ValidBefore == ssh.CertTimeInfinity || time.Now().Before(time.Unix(int64(crt.ValidBefore), 0))) {
+		args := []string{"ssh", "revoke", "--cert", c.file(), "--key", c.Key, "--force"}
+		args = append(args, c.caArgs()...)
+		if _, err := runStep(args...); err != nil {
+			return err
+		}
+	}
+	return removeFiles(c.file(), c.Key, c.Key+".pub")
+}
+
+// makeDirs creates the directories of the given files.
+func makeDirs(files ...string) error {
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+			return errs.FileError(err, filepath.Dir(f))
+		}
+	}
+	return nil
+}
+
+// removeFiles removes the given files if they exist.
+func removeFiles(files ...string) error {
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return errs.FileError(err, f)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "The files %s have been removed.\n", strings.Join(files, ", "))
+	return nil
+}
+
+// runStep executes the current binary with the given arguments and returns
+// its standard output. The standard input and error are inherited so
+// prompts work as usual.
+func runStep(args ...string) ([]byte, error) {
+	name, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the step executable")
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "error running 'step %s %s'", args[0], args[1])
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,353 @@
+package apply
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func writeFile(t *testing.T, filename, content string) {
+	t.Helper()
+	assert.FatalError(t, ioutil.WriteFile(filename, []byte(content), 0600))
+}
+
+func TestReadSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-apply")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		want    *spec
+		wantErr string
+	}{
+		{"ok", `ca-url: https://ca.example.com
+root: /root_ca.crt
+provisioner: admin@example.com
+renew-before: 8h
+certificates:
+  - subject: web.example.com
+    san: [web.example.com, 10.0.0.1]
+    crt: /web.crt
+    key: /web.key
+  - subject: old.example.com
+    crt: /old.crt
+    key: /old.key
+    state: absent
+    ca-url: https://other.example.com
+    renew-before: 1h
+ssh:
+  - key-id: mariano@example.com
+    key: /id_ecdsa
+  - key-id: host.example.com
+    host: true
+    principals: [host.example.com, 10.0.0.1]
+    key: /ssh_host_ecdsa_key
+`, &spec{
+			options: options{CaURL: "https://ca.example.com", Root: "/root_ca.crt", Provisioner: "admin@example.com", RenewBefore: "8h"},
+			Certificates: []certificate{
+				{
+					options: options{CaURL: "https://ca.example.com", Root: "/root_ca.crt", Provisioner: "admin@example.com", RenewBefore: "8h"},
+					Subject: "web.example.com", SANs: []string{"web.example.com", "10.0.0.1"}, Crt: "/web.crt", Key: "/web.key", State: "present",
+				},
+				{
+					options: options{CaURL: "https://other.example.com", Root: "/root_ca.crt", Provisioner: "admin@example.com", RenewBefore: "1h"},
+					Subject: "old.example.com", Crt: "/old.crt", Key: "/old.key", State: "absent",
+				},
+			},
+			SSH: []sshCertificate{
+				{
+					options: options{CaURL: "https://ca.example.com", Root: "/root_ca.crt", Provisioner: "admin@example.com", RenewBefore: "8h"},
+					KeyID:   "mariano@example.com", Principals: []string{"mariano"}, Key: "/id_ecdsa", State: "present",
+				},
+				{
+					options: options{CaURL: "https://ca.example.com", Root: "/root_ca.crt", Provisioner: "admin@example.com", RenewBefore: "8h"},
+					KeyID:   "host.example.com", Principals: []string{"host.example.com", "10.0.0.1"}, Host: true, Key: "/ssh_host_ecdsa_key", State: "present",
+				},
+			},
+		}, ""},
+		{"fail unknown field", "certificates:\n  - subject: foo\n    sans: [foo]\n    crt: foo.crt\n    key: foo.key\n", nil, "field sans not found"},
+		{"fail empty subject", "certificates:\n  - crt: foo.crt\n    key: foo.key\n", nil, "certificate 1: subject cannot be empty"},
+		{"fail empty key", "certificates:\n  - subject: foo\n    crt: foo.crt\n", nil, "certificate foo: crt and key cannot be empty"},
+		{"fail same files", "certificates:\n  - subject: foo\n    crt: foo.pem\n    key: foo.pem\n", nil, "certificate foo: crt and key cannot be the same file"},
+		{"fail duplicated crt", "certificates:\n  - subject: foo\n    crt: foo.crt\n    key: foo.key\n  - subject: bar\n    crt: foo.crt\n    key: bar.key\n", nil, "certificate bar: foo.crt is used more than once"},
+		{"fail state", "certificates:\n  - subject: foo\n    crt: foo.crt\n    key: foo.key\n    state: revoked\n", nil, "certificate foo: unsupported state 'revoked'"},
+		{"fail renew-before", "renew-before: 1d\ncertificates:\n  - subject: foo\n    crt: foo.crt\n    key: foo.key\n", nil, "certificate foo: invalid renew-before '1d'"},
+		{"fail ssh empty key-id", "ssh:\n  - key: id_ecdsa\n", nil, "ssh certificate 1: key-id cannot be empty"},
+		{"fail ssh empty key", "ssh:\n  - key-id: foo\n", nil, "ssh certificate foo: key cannot be empty"},
+		{"fail ssh duplicated key", "ssh:\n  - key-id: foo\n    key: id_ecdsa\n  - key-id: bar\n    key: id_ecdsa\n", nil, "ssh certificate bar: id_ecdsa-cert.pub is used more than once"},
+		{"fail ssh state", "ssh:\n  - key-id: foo\n    key: id_ecdsa\n    state: revoked\n", nil, "ssh certificate foo: unsupported state 'revoked'"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(dir, "spec.yaml")
+			writeFile(t, filename, tc.content)
+			got, err := readSpec(filename)
+			if tc.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.HasPrefix(t, err.Error(), "error parsing "+filename)
+					assert.True(t, strings.Contains(err.Error(), tc.wantErr), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
+func writeX509(t *testing.T, crtFile, keyFile string, tmpl *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	tmpl.SerialNumber = big.NewInt(1)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	assert.FatalError(t, err)
+	writeFile(t, crtFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	b, err := x509.MarshalECPrivateKey(key)
+	assert.FatalError(t, err)
+	writeFile(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})))
+}
+
+func TestCertificate_plan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-apply")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	crtFile, keyFile := filepath.Join(dir, "web.crt"), filepath.Join(dir, "web.key")
+	newTemplate := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "web.example.com"},
+			DNSNames:    []string{"web.example.com"},
+			IPAddresses: []net.IP{net.ParseIP("2001:db8::1")},
+			NotBefore:   now.Add(-time.Hour),
+			NotAfter:    now.Add(23 * time.Hour),
+		}
+	}
+	base := certificate{
+		Subject: "web.example.com",
+		SANs:    []string{"web.example.com", "2001:db8:0:0::1"},
+		Crt:     crtFile,
+		Key:     keyFile,
+		State:   "present",
+	}
+
+	tests := []struct {
+		name       string
+		setup      func()
+		modify     func(c *certificate)
+		wantType   actionType
+		wantReason string
+	}{
+		{"create no certificate", func() {}, nil, actionCreate, "certificate does not exist"},
+		{"create no key", func() {
+			writeX509(t, crtFile, keyFile, newTemplate())
+			os.Remove(keyFile)
+		}, nil, actionCreate, "key does not exist"},
+		{"create invalid certificate", func() {
+			writeX509(t, crtFile, keyFile, newTemplate())
+			writeFile(t, crtFile, "not a certificate")
+		}, nil, actionCreate, "certificate cannot be read"},
+		{"create subject", func() {
+			writeX509(t, crtFile, keyFile, newTemplate())
+		}, func(c *certificate) { c.Subject = "api.example.com" }, actionCreate, "subject does not match"},
+		{"create sans", func() {
+			writeX509(t, crtFile, keyFile, newTemplate())
+		}, func(c *certificate) { c.SANs = []string{"web.example.com", "www.example.com"} }, actionCreate, "SANs do not match"},
+		{"create expired", func() {
+			tmpl := newTemplate()
+			tmpl.NotBefore, tmpl.NotAfter = now.Add(-2*time.Hour), now.Add(-time.Hour)
+			writeX509(t, crtFile, keyFile, tmpl)
+		}, nil, actionCreate, "certificate has expired"},
+		{"renew default", func() {
+			tmpl := newTemplate()
+			tmpl.NotBefore, tmpl.NotAfter = now.Add(-20*time.Hour), now.Add(4*time.Hour)
+			writeX509(t, crtFile, keyFile, tmpl)
+		}, nil, actionRenew, "expires in 4h0m0s"},
+		{"renew renew-before", func() {
+			writeX509(t, crtFile, keyFile, newTemplate())
+		}, func(c *certificate) { c.RenewBefore = "24h" }, actionRenew, "expires in 23h0m0s"},
+		{"ok", func() {
+			writeX509(t, crtFile, keyFile, newTemplate())
+		}, nil, actionNone, ""},
+		{"delete", func() {
+			writeX509(t, crtFile, keyFile, newTemplate())
+		}, func(c *certificate) { c.State = "absent" }, actionDelete, ""},
+		{"delete only key", func() {
+			writeX509(t, crtFile, keyFile, newTemplate())
+			os.Remove(crtFile)
+		}, func(c *certificate) { c.State = "absent" }, actionDelete, ""},
+		{"absent", func() {}, func(c *certificate) { c.State = "absent" }, actionNone, "does not exist"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(crtFile)
+			os.Remove(keyFile)
+			tc.setup()
+			c := base
+			if tc.modify != nil {
+				tc.modify(&c)
+			}
+			got, err := c.plan(now)
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.wantType, got.Type)
+			assert.Equals(t, tc.wantReason, got.Reason)
+			assert.Equals(t, c, got.Target)
+		})
+	}
+}
+
+func writeSSH(t *testing.T, keyFile string, certType uint32, keyID string, principals []string, validAfter, validBefore uint64) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(caKey)
+	assert.FatalError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          1,
+		CertType:        certType,
+		KeyId:           keyID,
+		ValidPrincipals: principals,
+		ValidAfter:      validAfter,
+		ValidBefore:     validBefore,
+	}
+	assert.FatalError(t, cert.SignCert(rand.Reader, signer))
+	writeFile(t, keyFile+"-cert.pub", string(ssh.MarshalAuthorizedKey(cert)))
+	writeFile(t, keyFile+".pub", string(ssh.MarshalAuthorizedKey(pub)))
+	writeFile(t, keyFile, "private key")
+}
+
+func TestSSHCertificate_plan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-apply")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	keyFile := filepath.Join(dir, "id_ecdsa")
+	principals := []string{"mariano", "max"}
+	write := func(certType uint32, keyID string, principals []string, validAfter, validBefore time.Time) func() {
+		return func() {
+			writeSSH(t, keyFile, certType, keyID, principals, uint64(validAfter.Unix()), uint64(validBefore.Unix()))
+		}
+	}
+	valid := write(ssh.UserCert, "mariano@example.com", principals, now.Add(-time.Hour), now.Add(15*time.Hour))
+	base := sshCertificate{
+		KeyID:      "mariano@example.com",
+		Principals: []string{"max", "mariano"},
+		Key:        keyFile,
+		State:      "present",
+	}
+
+	tests := []struct {
+		name       string
+		setup      func()
+		modify     func(c *sshCertificate)
+		wantType   actionType
+		wantReason string
+	}{
+		{"create no certificate", func() {}, nil, actionCreate, "certificate does not exist"},
+		{"create no key", func() {
+			valid()
+			os.Remove(keyFile)
+		}, nil, actionCreate, "key does not exist"},
+		{"create invalid certificate", func() {
+			valid()
+			writeFile(t, keyFile+"-cert.pub", "not a certificate")
+		}, nil, actionCreate, "certificate cannot be read"},
+		{"create type", valid, func(c *sshCertificate) { c.Host = true }, actionCreate, "certificate type does not match"},
+		{"create key id", valid, func(c *sshCertificate) { c.KeyID = "max@example.com" }, actionCreate, "key id does not match"},
+		{"create principals", valid, func(c *sshCertificate) { c.Principals = []string{"mariano"} }, actionCreate, "principals do not match"},
+		{"create expired", write(ssh.UserCert, "mariano@example.com", principals, now.Add(-2*time.Hour), now.Add(-time.Hour)), nil, actionCreate, "certificate has expired"},
+		{"renew default", write(ssh.UserCert, "mariano@example.com", principals, now.Add(-12*time.Hour), now.Add(4*time.Hour)), nil, actionRenew, "expires in 4h0m0s"},
+		{"renew renew-before", valid, func(c *sshCertificate) { c.RenewBefore = "16h" }, actionRenew, "expires in 15h0m0s"},
+		{"ok", valid, nil, actionNone, ""},
+		{"ok host", write(ssh.HostCert, "host.example.com", []string{"host.example.com"}, now.Add(-time.Hour), now.Add(15*time.Hour)), func(c *sshCertificate) {
+			c.KeyID, c.Principals, c.Host = "host.example.com", []string{"host.example.com"}, true
+		}, actionNone, ""},
+		{"ok forever", func() {
+			writeSSH(t, keyFile, ssh.UserCert, "mariano@example.com", principals, 0, ssh.CertTimeInfinity)
+		}, nil, actionNone, ""},
+		{"delete", valid, func(c *sshCertificate) { c.State = "absent" }, actionDelete, ""},
+		{"delete only public key", func() {
+			valid()
+			os.Remove(keyFile)
+			os.Remove(keyFile + "-cert.pub")
+		}, func(c *sshCertificate) { c.State = "absent" }, actionDelete, ""},
+		{"absent", func() {}, func(c *sshCertificate) { c.State = "absent" }, actionNone, "does not exist"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(keyFile)
+			os.Remove(keyFile + ".pub")
+			os.Remove(keyFile + "-cert.pub")
+			tc.setup()
+			c := base
+			if tc.modify != nil {
+				tc.modify(&c)
+			}
+			got, err := c.plan(now)
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.wantType, got.Type)
+			assert.Equals(t, tc.wantReason, got.Reason)
+		})
+	}
+}
+
+func TestEqualSANs(t *testing.T) {
+	crt := &x509.Certificate{
+		DNSNames:       []string{"web.example.com", "WWW.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")},
+		EmailAddresses: []string{"admin@example.com"},
+	}
+	tests := []struct {
+		name    string
+		crt     *x509.Certificate
+		subject string
+		sans    []string
+		want    bool
+	}{
+		{"ok", crt, "web.example.com", []string{"web.example.com", "www.example.com", "10.0.0.1", "2001:db8::1", "admin@example.com"}, true},
+		{"ok order", crt, "web.example.com", []string{"2001:db8::1", "admin@example.com", "www.example.com", "10.0.0.1", "web.example.com"}, true},
+		{"ok case", crt, "web.example.com", []string{"WEB.example.com", "www.example.com", "10.0.0.1", "2001:DB8::1", "Admin@example.com"}, true},
+		{"ok non canonical ipv6", crt, "web.example.com", []string{"web.example.com", "www.example.com", "10.0.0.1", "2001:0db8:0:0::0001", "admin@example.com"}, true},
+		{"ok ipv4 in ipv6", &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.0.0.1").To4()}}, "", []string{"::ffff:10.0.0.1"}, true},
+		{"ok subject", &x509.Certificate{DNSNames: []string{"web.example.com"}}, "web.example.com", nil, true},
+		{"ok subject ip", &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}}, "10.0.0.1", nil, true},
+		{"ok uri", &x509.Certificate{URIs: []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/web"}}}, "", []string{"spiffe://example.com/web"}, true},
+		{"ok idn", &x509.Certificate{DNSNames: []string{"xn--bcher-kva.example.com"}}, "", []string{"bücher.example.com"}, true},
+		{"ok duplicates", &x509.Certificate{DNSNames: []string{"web.example.com"}}, "", []string{"web.example.com", "web.example.com"}, true},
+		{"fail uri", &x509.Certificate{URIs: []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/web"}}}, "", []string{"spiffe://example.com/api"}, false},
+		{"fail missing", crt, "web.example.com", []string{"web.example.com", "www.example.com", "10.0.0.1", "admin@example.com"}, false},
+		{"fail extra", crt, "web.example.com", []string{"web.example.com", "www.example.com", "10.0.0.1", "10.0.0.2", "2001:db8::1", "admin@example.com"}, false},
+		{"fail ip", crt, "web.example.com", []string{"web.example.com", "www.example.com", "10.0.0.1", "2001:db8::2", "admin@example.com"}, false},
+		{"fail ip as dns", &x509.Certificate{DNSNames: []string{"10.0.0.1"}}, "", []string{"10.0.0.1"}, false},
+		{"fail subject", &x509.Certificate{DNSNames: []string{"web.example.com"}}, "api.example.com", nil, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equals(t, tc.want, equalSANs(tc.crt, tc.subject, tc.sans))
+		})
+	}
+}
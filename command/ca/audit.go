@@ -0,0 +1,73 @@
+package ca
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+// auditSyslog is the value of the --audit-log flag used to send the audit
+// records to the system logger.
+const auditSyslog = "syslog"
+
+// auditRecord is the structured record written to the audit log every time a
+// token is generated.
+type auditRecord struct {
+	Time        time.Time  `json:"time"`
+	User        string     `json:"user"`
+	Host        string     `json:"host"`
+	Subject     string     `json:"subject"`
+	SANs        []string   `json:"sans"`
+	Provisioner string     `json:"provisioner"`
+	KeyID       string     `json:"kid,omitempty"`
+	Audience    string     `json:"audience,omitempty"`
+	TokenID     string     `json:"jti,omitempty"`
+	Expiry      *time.Time `json:"expiry,omitempty"`
+	Offline     bool       `json:"offline"`
+}
+
+// auditToken appends the given record to the audit log configured with the
+// --audit-log flag. It does nothing if the flag is not set. Errors writing the
+// record are returned so tokens are never generated without being audited.
+func auditToken(ctx *cli.Context, rec *auditRecord) error {
+	dest := ctx.String("audit-log")
+	if dest == "" {
+		return nil
+	}
+
+	rec.Time = time.Now().UTC()
+	rec.Offline = ctx.Bool("offline")
+	if u, err := user.Current(); err == nil {
+		rec.User = u.Username
+	}
+	if h, err := os.Hostname(); err == nil {
+		rec.Host = h
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling audit record")
+	}
+
+	if dest == auditSyslog {
+		return writeSyslog(b)
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errs.FileError(err, dest)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return errs.FileError(err, dest)
+	}
+	if err := f.Close(); err != nil {
+		return errs.FileError(err, dest)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+// +build windows plan9 nacl
+
+package ca
+
+import "github.com/pkg/errors"
+
+// writeSyslog returns an error, syslog is not supported in this platform.
+func writeSyslog(b []byte) error {
+	return errors.New("error writing audit record: syslog is not supported on this platform")
+}
@@ -0,0 +1,85 @@
+package ca
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/awssecrets"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+var (
+	awsSecretFlag = cli.StringFlag{
+		Name: "aws-secret",
+		Usage: `Write the certificate and private key to the AWS Secrets Manager secret with
+the given <name> or ARN, instead of files. The secret is a JSON object with the
+fields 'certificate', 'issuing_ca' and 'private_key', and other fields in the
+secret are kept. The secret is created if it does not exist. Requires step to
+be compiled with the awssecrets build tag.`,
+	}
+
+	awsParameterFlag = cli.StringFlag{
+		Name: "aws-parameter",
+		Usage: `Write the certificate and private key to SecureString parameters under the
+given <path> in AWS Systems Manager Parameter Store, e.g. '/step/internal',
+instead of files. The parameters are '<path>/certificate', '<path>/issuing_ca'
+and '<path>/private_key'. Requires step to be compiled with the awssecrets
+build tag.`,
+	}
+
+	awsKMSKeyFlag = cli.StringFlag{
+		Name: "aws-kms-key",
+		Usage: `The id, ARN or alias of the AWS KMS <key> used to encrypt the secret and the
+parameters. If unset, the AWS managed keys are used.`,
+	}
+
+	awsRegionFlag = cli.StringFlag{
+		Name: "aws-region",
+		Usage: `The AWS <region> of the secret and the parameters. If unset, the region is
+loaded from the environment or the shared AWS configuration.`,
+	}
+
+	awsProfileFlag = cli.StringFlag{
+		Name:  "aws-profile",
+		Usage: `The <profile> in the shared AWS configuration used to write the secrets.`,
+	}
+)
+
+// newAWSSecretsClient validates the --aws flags and returns a client for AWS
+// Secrets Manager and Parameter Store, the name of the secret and the path of
+// the parameters. It returns a nil client if neither --aws-secret nor
+// --aws-parameter are set.
+func newAWSSecretsClient(ctx *cli.Context) (*awssecrets.Client, string, string, error) {
+	secret, parameter := ctx.String("aws-secret"), ctx.String("aws-parameter")
+	if secret == "" && parameter == "" {
+		for _, f := range []string{"aws-kms-key", "aws-region", "aws-profile"} {
+			if ctx.IsSet(f) {
+				return nil, "", "", errors.Errorf("flag '--%s' requires the '--aws-secret' or '--aws-parameter' flag", f)
+			}
+		}
+		return nil, "", "", nil
+	}
+	if parameter != "" {
+		var err error
+		if parameter, err = awssecrets.ParseParameterPath(parameter); err != nil {
+			return nil, "", "", errs.InvalidFlagValue(ctx, "aws-parameter", ctx.String("aws-parameter"), "")
+		}
+	}
+
+	var opts []awssecrets.Option
+	if v := ctx.String("aws-kms-key"); v != "" {
+		opts = append(opts, awssecrets.WithKMSKey(v))
+	}
+	if v := ctx.String("aws-region"); v != "" {
+		opts = append(opts, awssecrets.WithRegion(v))
+	}
+	if v := ctx.String("aws-profile"); v != "" {
+		opts = append(opts, awssecrets.WithProfile(v))
+	}
+	client, err := awssecrets.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return client, secret, parameter, nil
+}
@@ -1,7 +1,10 @@
 package ca
 
 import (
+	"bytes"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"os"
 	"path/filepath"
 
@@ -11,6 +14,7 @@ import (
 	"github.com/smallstep/cli/config"
 	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/crypto/trust"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/ui"
@@ -32,6 +36,12 @@ Bootstrap will store the root certificate in <$STEPPATH/certs/root_ca.crt> and
 create a configuration file in <$STEPPATH/configs/defaults.json> with the CA
 url, the root certificate location and its fingerprint.
 
+If the CA serves multiple roots, e.g. during a root rotation, the other roots
+are downloaded trusting the root with the fingerprint, and stored after it in
+<$STEPPATH/certs/root_ca.crt>. The CA is verified using any of them, and new
+roots served by the CA are added to the bundle after each certificate is
+signed or renewed.
+
 After the bootstrap, ca commands do not need to specify the flags 
 --ca-url, --root or --fingerprint if we want to use the same environment.`,
 		Flags: []cli.Flag{
@@ -54,8 +64,6 @@ type bootstrapConfig struct {
 func bootstrapAction(ctx *cli.Context) error {
 	caURL := ctx.String("ca-url")
 	fingerprint := ctx.String("fingerprint")
-	rootFile := pki.GetRootCAPath()
-	configFile := filepath.Join(config.StepPath(), "config", "defaults.json")
 
 	switch {
 	case len(caURL) == 0:
@@ -64,37 +72,72 @@ func bootstrapAction(ctx *cli.Context) error {
 		return errs.RequiredFlag(ctx, "fingerprint")
 	}
 
-	tr := getInsecureTransport()
-	client, err := ca.NewClient(caURL, ca.WithTransport(tr))
+	rootFile, err := bootstrap(caURL, fingerprint)
 	if err != nil {
 		return err
 	}
 
+	if ctx.Bool("install") {
+		return installRoot(rootFile)
+	}
+
+	return nil
+}
+
+// bootstrap downloads the root certificate of the CA with the given
+// fingerprint, and writes it with the defaults.json that configures the CA
+// commands to use it. It returns the path of the root certificate.
+func bootstrap(caURL, fingerprint string) (string, error) {
+	rootFile := pki.GetRootCAPath()
+	configFile := filepath.Join(config.StepPath(), "config", "defaults.json")
+
+	tr := getInsecureTransport()
+	client, err := ca.NewClient(caURL, ca.WithTransport(pki.WrapTransport(tr)))
+	if err != nil {
+		return "", err
+	}
+
 	// Root already validates the certificate
 	resp, err := client.Root(fingerprint)
 	if err != nil {
-		return errors.Wrap(err, "error downloading root certificate")
+		return "", errors.Wrap(err, "error downloading root certificate")
 	}
 
 	if err := os.MkdirAll(filepath.Dir(rootFile), 0700); err != nil {
-		return errs.FileError(err, rootFile)
+		return "", errs.FileError(err, rootFile)
 	}
 
 	if err := os.MkdirAll(filepath.Dir(configFile), 0700); err != nil {
-		return errs.FileError(err, configFile)
+		return "", errs.FileError(err, configFile)
 	}
 
-	// Serialize root
-	_, err = pemutil.Serialize(resp.RootPEM.Certificate, pemutil.ToFile(rootFile, 0600))
+	// During a root rotation the CA serves multiple roots. They are downloaded
+	// trusting the root with the fingerprint, and saved after it, so the
+	// commands can verify the CA with any of them.
+	roots, err := bootstrapRoots(caURL, fingerprint, resp.RootPEM.Certificate)
 	if err != nil {
-		return err
+		return "", err
+	}
+	var data []byte
+	for _, root := range roots {
+		data = append(data, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: root.Raw,
+		})...)
+	}
+	if err := utils.WriteFile(rootFile, data, 0600); err != nil {
+		return "", err
+	}
+	if len(roots) == 1 {
+		ui.Printf("The root certificate has been saved in %s.\n", rootFile)
+	} else {
+		ui.Printf("The root certificate bundle with %d roots has been saved in %s.\n", len(roots), rootFile)
 	}
-	ui.Printf("The root certificate has been saved in %s.\n", rootFile)
 
 	// make sure to store the url with https
 	caURL, err = completeURL(caURL)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// Serialize defaults.json
@@ -104,23 +147,55 @@ func bootstrapAction(ctx *cli.Context) error {
 		Root:        pki.GetRootCAPath(),
 	}, "", "  ")
 	if err != nil {
-		return errors.Wrap(err, "error marshaling defaults.json")
+		return "", errors.Wrap(err, "error marshaling defaults.json")
 	}
 
 	if err := utils.WriteFile(configFile, b, 0644); err != nil {
-		return err
+		return "", err
 	}
 
 	ui.Printf("Your configuration has been saved in %s.\n", configFile)
+	return rootFile, nil
+}
 
-	if ctx.Bool("install") {
-		ui.Printf("Installing the root certificate in the system truststore... ")
-		if err := truststore.InstallFile(rootFile); err != nil {
-			ui.Println()
-			return err
+// bootstrapRoots returns the root with the given fingerprint followed by the
+// other roots of the CA.
+func bootstrapRoots(caURL, fingerprint string, root *x509.Certificate) ([]*x509.Certificate, error) {
+	client, err := pki.NewBootstrapClient(caURL, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Roots()
+	if err != nil {
+		return nil, errors.Wrap(err, "error downloading root certificates")
+	}
+	roots := []*x509.Certificate{root}
+	for _, crt := range resp.Certificates {
+		if !bytes.Equal(crt.Raw, root.Raw) {
+			roots = append(roots, crt.Certificate)
 		}
-		ui.Println("done.")
 	}
+	return roots, nil
+}
+
+// installRoot installs the given root certificate in the system truststore.
+func installRoot(rootFile string) error {
+	ui.Printf("Installing the root certificate in the system truststore... ")
+	if err := truststore.InstallFile(rootFile); err != nil {
+		ui.Println()
+		return err
+	}
+	ui.Println("done.")
 
-	return nil
+	// Record it with the certificates installed by step certificate install.
+	roots, err := pemutil.ReadCertificateBundle(rootFile)
+	if err != nil {
+		return err
+	}
+	inv, err := trust.ReadInventory(trust.InventoryPath())
+	if err != nil {
+		return err
+	}
+	inv.Add(roots[0], rootFile, "", []string{trust.System})
+	return inv.Write(trust.InventoryPath())
 }
@@ -0,0 +1,276 @@
+package ca
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+)
+
+var (
+	bulkFlag = cli.StringFlag{
+		Name: "bulk",
+		Usage: `Request the certificates in the CSV <file> instead of the one in the
+positional arguments. Each row has the subject, the certificate file, the key
+file and, optionally, the SANs of one certificate, in the format
+'<subject>,<crt-file>,<key-file>[,<san>...]'. Lines starting with '#' are
+ignored. The tokens are generated with one JWK provisioner, and the
+certificates are requested concurrently using the same connection to the CA.`,
+	}
+
+	concurrencyFlag = cli.IntFlag{
+		Name:  "concurrency",
+		Usage: `The maximum <number> of certificates requested at the same time with **--bulk**.`,
+		Value: 8,
+	}
+)
+
+// bulkRow is a certificate request in the file of the --bulk flag.
+type bulkRow struct {
+	line    int
+	subject string
+	crtFile string
+	keyFile string
+	sans    []string
+}
+
+// readBulkFile reads and validates the rows in the given CSV file.
+func readBulkFile(filename string) ([]bulkRow, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+	defer f.Close()
+	return parseBulkRows(f, filename)
+}
+
+// parseBulkRows parses the rows of the --bulk flag. Each line is parsed as
+// one CSV record, so the errors report the number of the line.
+func parseBulkRows(r io.Reader, filename string) ([]bulkRow, error) {
+	var rows []bulkRow
+	files := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		cr := csv.NewReader(strings.NewReader(text))
+		cr.TrimLeadingSpace = true
+		record, err := cr.Read()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s: line %d", filename, line)
+		}
+		if len(record) < 3 {
+			return nil, errors.Errorf("error parsing %s: line %d: expected '<subject>,<crt-file>,<key-file>[,<san>...]'", filename, line)
+		}
+		row := bulkRow{
+			line:    line,
+			subject: strings.TrimSpace(record[0]),
+			crtFile: strings.TrimSpace(record[1]),
+			keyFile: strings.TrimSpace(record[2]),
+		}
+		for _, san := range record[3:] {
+			if san = strings.TrimSpace(san); san != "" {
+				row.sans = append(row.sans, san)
+			}
+		}
+		switch {
+		case row.subject == "":
+			return nil, errors.Errorf("error parsing %s: line %d: subject cannot be empty", filename, line)
+		case row.crtFile == "":
+			return nil, errors.Errorf("error parsing %s: line %d: certificate file cannot be empty", filename, line)
+		case row.keyFile == "":
+			return nil, errors.Errorf("error parsing %s: line %d: key file cannot be empty", filename, line)
+		}
+		for _, name := range []string{row.crtFile, row.keyFile} {
+			if n, ok := files[name]; ok {
+				return nil, errors.Errorf("error parsing %s: line %d: file %s is already used in line %d", filename, line, name, n)
+			}
+			files[name] = line
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+	if len(rows) == 0 {
+		return nil, errors.Errorf("error parsing %s: no certificates found", filename)
+	}
+	return rows, nil
+}
+
+// bulkCertificateAction requests the certificates in the file of the --bulk
+// flag using a pool of workers.
+func bulkCertificateAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+	for _, f := range []string{"token", "token-file", "subject-from-token", "san", "san-file", "key", "ak", "ak-cert",
+		"spiffe", "spiffe-dir", "docker-registry", "vault", "aws-secret", "aws-parameter"} {
+		if ctx.IsSet(f) {
+			return errs.IncompatibleFlagWithFlag(ctx, "bulk", f)
+		}
+	}
+	concurrency := ctx.Int("concurrency")
+	if concurrency < 1 {
+		return errs.InvalidFlagValue(ctx, "concurrency", ctx.String("concurrency"), "")
+	}
+	if err := validateUsageFlags(ctx); err != nil {
+		return err
+	}
+
+	rows, err := readBulkFile(ctx.String("bulk"))
+	if err != nil {
+		return err
+	}
+	// Workers cannot ask to overwrite the files.
+	if !command.IsForce() {
+		for _, row := range rows {
+			for _, name := range []string{row.crtFile, row.keyFile} {
+				if _, err := os.Stat(name); err == nil {
+					return errors.Errorf("file %s already exists; use the '--force' flag to overwrite the existing files", name)
+				}
+			}
+		}
+	}
+	for _, row := range rows {
+		if err := validateSANs(ctx, row.subject, row.sans); err != nil {
+			return errors.Wrapf(err, "error validating line %d", row.line)
+		}
+	}
+
+	flow, err := newCertificateFlow(ctx)
+	if err != nil {
+		return err
+	}
+	signer, err := flow.tokenSigner(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := flow.client(ctx)
+	if err != nil {
+		return err
+	}
+	notBefore, notAfter, err := parseValidity(ctx)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failures := make([]error, len(rows))
+	jobs := make(chan int)
+	if concurrency > len(rows) {
+		concurrency = len(rows)
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				row := rows[j]
+				if err := flow.bulkSign(ctx, client, signer, row, notBefore, notAfter); err != nil {
+					failures[j] = errors.Wrapf(err, "line %d: error requesting %s", row.line, row.subject)
+					continue
+				}
+				mu.Lock()
+				ui.PrintSelected("Certificate", row.crtFile)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range rows {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	flow.refreshRoots(ctx, client)
+
+	var failed int
+	for _, err := range failures {
+		if err != nil {
+			failed++
+			ui.Println(err)
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d certificates could not be requested", failed, len(rows))
+	}
+	ui.Printf("%d certificates have been requested.\n", len(rows))
+	return nil
+}
+
+// tokenSigner returns the signer used to generate the tokens of the --bulk
+// flag. Only JWK provisioners can be used.
+func (f *certificateFlow) tokenSigner(ctx *cli.Context) (*tokenSigner, error) {
+	if f.offline {
+		return f.offlineCA.tokenSigner(ctx)
+	}
+
+	caURL := ctx.String("ca-url")
+	if len(caURL) == 0 {
+		return nil, errs.RequiredFlag(ctx, "ca-url")
+	}
+	root, fingerprint, err := caRoot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if root == "" && fingerprint == "" {
+		return nil, errs.RequiredOrFlag(ctx, "root", "fingerprint")
+	}
+	notBefore, notAfter, err := parseValidity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := selectProvisioner(ctx, caURL, root, ctx.String("kid"), ctx.String("issuer"))
+	if err != nil {
+		return nil, err
+	}
+	jwk, ok := p.(*provisioner.JWK)
+	if !ok {
+		return nil, errors.Errorf("provisioner '%s' cannot be used with the '--bulk' flag: only JWK provisioners are supported", p.GetName())
+	}
+	return newTokenSigner(ctx, jwk, caURL, root, ctx.String("password-file"), "", notBefore, notAfter)
+}
+
+// bulkSign requests the certificate in the given row and writes it with its
+// private key.
+func (f *certificateFlow) bulkSign(ctx *cli.Context, client caClient, signer *tokenSigner, row bulkRow, notBefore, notAfter time.Time) error {
+	token, err := signer.Token(ctx, row.subject, row.sans)
+	if err != nil {
+		return err
+	}
+	req, pk, err := f.CreateSignRequest(ctx, token, row.sans)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Sign(&api.SignRequest{
+		CsrPEM:    req.CsrPEM,
+		OTT:       token,
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeCertificateFile(row.crtFile, resp); err != nil {
+		return err
+	}
+	_, err = pemutil.Serialize(pk, pemutil.ToFile(row.keyFile, 0600))
+	return err
+}
@@ -0,0 +1,147 @@
+package ca
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/urfave/cli"
+)
+
+func TestParseBulkRows(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    []bulkRow
+		wantErr string
+	}{
+		"ok": {
+			input: "foo.example.com,foo.crt,foo.key\nbar.example.com,bar.crt,bar.key,bar.example.com,10.0.0.1\n",
+			want: []bulkRow{
+				{line: 1, subject: "foo.example.com", crtFile: "foo.crt", keyFile: "foo.key"},
+				{line: 2, subject: "bar.example.com", crtFile: "bar.crt", keyFile: "bar.key", sans: []string{"bar.example.com", "10.0.0.1"}},
+			},
+		},
+		"ok-comments": {
+			input: "# subject,crt,key,sans\n\n  # indented comment\nfoo.example.com,foo.crt,foo.key\n\n",
+			want: []bulkRow{
+				{line: 4, subject: "foo.example.com", crtFile: "foo.crt", keyFile: "foo.key"},
+			},
+		},
+		"ok-spaces": {
+			input: "  foo.example.com , foo.crt,  foo.key , , foo.example.com ,\n",
+			want: []bulkRow{
+				{line: 1, subject: "foo.example.com", crtFile: "foo.crt", keyFile: "foo.key", sans: []string{"foo.example.com"}},
+			},
+		},
+		"ok-quoted": {
+			input: `"Jane Doe, Engineering",jane.crt,jane.key,jane@example.com`,
+			want: []bulkRow{
+				{line: 1, subject: "Jane Doe, Engineering", crtFile: "jane.crt", keyFile: "jane.key", sans: []string{"jane@example.com"}},
+			},
+		},
+		"fail-short": {
+			input:   "foo.example.com,foo.crt,foo.key\nbar.example.com,bar.crt\n",
+			wantErr: "error parsing hosts.csv: line 2: expected '<subject>,<crt-file>,<key-file>[,<san>...]'",
+		},
+		"fail-subject": {
+			input:   " ,foo.crt,foo.key",
+			wantErr: "error parsing hosts.csv: line 1: subject cannot be empty",
+		},
+		"fail-crt": {
+			input:   "foo.example.com,,foo.key",
+			wantErr: "error parsing hosts.csv: line 1: certificate file cannot be empty",
+		},
+		"fail-key": {
+			input:   "foo.example.com,foo.crt, ",
+			wantErr: "error parsing hosts.csv: line 1: key file cannot be empty",
+		},
+		"fail-duplicate-crt": {
+			input:   "foo.example.com,foo.crt,foo.key\n# comment\nbar.example.com,foo.crt,bar.key\n",
+			wantErr: "error parsing hosts.csv: line 3: file foo.crt is already used in line 1",
+		},
+		"fail-duplicate-key": {
+			input:   "foo.example.com,foo.crt,foo.key\nbar.example.com,bar.crt,foo.key\n",
+			wantErr: "error parsing hosts.csv: line 2: file foo.key is already used in line 1",
+		},
+		"fail-same-file": {
+			input:   "foo.example.com,foo.pem,foo.pem\n",
+			wantErr: "error parsing hosts.csv: line 1: file foo.pem is already used in line 1",
+		},
+		"fail-csv": {
+			input:   "foo.example.com,foo.crt,foo.key\n\"bar.example.com,bar.crt,bar.key\n",
+			wantErr: "error parsing hosts.csv: line 2",
+		},
+		"fail-empty": {
+			input:   "",
+			wantErr: "error parsing hosts.csv: no certificates found",
+		},
+		"fail-only-comments": {
+			input:   "# foo.example.com,foo.crt,foo.key\n\n",
+			wantErr: "error parsing hosts.csv: no certificates found",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rows, err := parseBulkRows(strings.NewReader(tc.input), "hosts.csv")
+			if tc.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.True(t, strings.HasPrefix(err.Error(), tc.wantErr), err.Error())
+				}
+				assert.Nil(t, rows)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, tc.want, rows)
+		})
+	}
+}
+
+func TestBulkCertificateAction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-bulk")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		assert.FatalError(t, ioutil.WriteFile(filename, []byte(content), 0600))
+		return filename
+	}
+	existing := write("existing.crt", "")
+	csvFile := write("hosts.csv", "foo.example.com,"+filepath.Join(dir, "foo.crt")+","+filepath.Join(dir, "foo.key")+"\n")
+	existingFile := write("existing.csv", "foo.example.com,"+existing+","+filepath.Join(dir, "existing.key")+"\n")
+	wildcardFile := write("wildcard.csv", "*.example.com,"+filepath.Join(dir, "wildcard.crt")+","+filepath.Join(dir, "wildcard.key")+"\n")
+	invalidFile := write("invalid.csv", "foo.example.com,foo.crt\n")
+
+	tests := map[string]struct {
+		args    []string
+		wantErr string
+	}{
+		"fail-args":          {[]string{"--bulk", csvFile, "foo.example.com"}, "too many positional arguments"},
+		"fail-token":         {[]string{"--bulk", csvFile, "--token", "token"}, "flag '--token' is incompatible with '--bulk'"},
+		"fail-san":           {[]string{"--bulk", csvFile, "--san", "foo.example.com"}, "flag '--san' is incompatible with '--bulk'"},
+		"fail-key":           {[]string{"--bulk", csvFile, "--key", "foo.key"}, "flag '--key' is incompatible with '--bulk'"},
+		"fail-spiffe":        {[]string{"--bulk", csvFile, "--spiffe"}, "flag '--spiffe' is incompatible with '--bulk'"},
+		"fail-concurrency":   {[]string{"--bulk", csvFile, "--concurrency", "0"}, "invalid value '0' for flag '--concurrency'"},
+		"fail-profile":       {[]string{"--bulk", csvFile, "--profile", "foo"}, "invalid value 'foo' for flag '--profile'"},
+		"fail-missing-file":  {[]string{"--bulk", filepath.Join(dir, "missing.csv")}, "missing.csv"},
+		"fail-invalid-file":  {[]string{"--bulk", invalidFile}, "line 1: expected '<subject>,<crt-file>,<key-file>[,<san>...]'"},
+		"fail-existing-file": {[]string{"--bulk", existingFile}, "file " + existing + " already exists; use the '--force' flag"},
+		"fail-wildcard":      {[]string{"--bulk", wildcardFile, "--force"}, "error validating line 1: '*.example.com' is a wildcard name"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			app := cli.NewApp()
+			app.Name = "step"
+			app.Writer = ioutil.Discard
+			app.ErrWriter = ioutil.Discard
+			app.Commands = []cli.Command{certificateCommand()}
+			err := app.Run(append([]string{"step", "certificate"}, tc.args...))
+			if assert.Error(t, err) {
+				assert.True(t, strings.Contains(err.Error(), tc.wantErr), err.Error())
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package ca
 
 import (
 	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -10,6 +11,9 @@ import (
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/command/ca/provisioner"
 	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/urfave/cli"
@@ -25,6 +29,13 @@ func init() {
 authority, retrieve the root of trust, sign and renew certificates, and create
 and manage provisioners.
 
+The default values of the flags of all the **step ca** subcommands can be
+defined in <$STEPPATH/config/defaults.json>, a JSON object where the properties
+are the flag names, e.g. "ca-url", "root", "fingerprint", "provisioner" or
+"kty". Flags passed in the command line or using environment variables always
+take precedence over the values in this file. A different file can be used with
+the global **--config** flag.
+
 ## EXAMPLES
 
 Create the configuration for a new certificate authority:
@@ -45,6 +56,19 @@ $ cat $STEPPATH/config/defaults.json
 }
 '''
 
+Always use the same provisioner and RSA keys, the ca-url and root are also read
+from the defaults file:
+'''
+$ cat $STEPPATH/config/defaults.json
+{
+  "ca-url": "https://ca.smallstep.com",
+  "root": "/home/user/.step/certs/root_ca.crt",
+  "provisioner": "admin@smallstep.com",
+  "kty": "RSA"
+}
+$ step ca certificate internal.example.com internal.crt internal.key
+'''
+
 Download the root_ca.crt:
 '''
 $ step ca root root_ca.crt \
@@ -73,14 +97,17 @@ $ step ca renew internal.crt internal.key \
 			healthCommand(),
 			initCommand(),
 			bootstrapCommand(),
-			tokenCommand(),
+			enrollCommand(),
+			command.StructuredOutput(tokenCommand()),
 			certificateCommand(),
 			renewCertificateCommand(),
+			revokeCertificateCommand(),
 			provisioner.Command(),
-			signCertificateCommand(),
+			command.StructuredOutput(signCertificateCommand()),
 			rootComand(),
 			rootsCommand(),
 			federationCommand(),
+			kubernetesCSRCommand(),
 		},
 	}
 
@@ -104,6 +131,14 @@ var (
 		Usage: "The <fingerprint> of the targeted root certificate.",
 	}
 
+	rootFingerprintFlag = cli.StringFlag{
+		Name: "fingerprint",
+		Usage: `The SHA256 <fingerprint> of the root certificate used to verify the CA,
+instead of the **--root** file. The root is downloaded from the CA and verified
+using the fingerprint, like **step ca bootstrap** does. If **--root** is also set,
+the fingerprint must be the one of a root in the file.`,
+	}
+
 	tokenFlag = cli.StringFlag{
 		Name: "token",
 		Usage: `The one-time <token> used to authenticate with the CA in order to create the
@@ -132,7 +167,9 @@ unit suffix, such as "300ms", "-1.5h" or "2h45m". Valid time units are "ns",
 		Name: "offline",
 		Usage: `Creates a certificate without contacting the certificate authority. Offline mode
 uses the configuration, certificates, and keys created with **step ca init**,
-but can accept a different configuration file using '--ca-config>' flag.`,
+but can accept a different configuration file using '--ca-config>' flag. The
+requested validity and renewals are checked against the claims of the
+provisioner before signing.`,
 	}
 
 	caConfigFlag = cli.StringFlag{
@@ -148,10 +185,60 @@ $STEPPATH/config/ca.json`,
 	}
 
 	provisionerIssuerFlag = cli.StringFlag{
-		Name:  "issuer",
+		Name:  "issuer,provisioner",
 		Usage: "The provisioner <name> to use.",
 	}
 
+	auditLogFlag = cli.StringFlag{
+		Name: "audit-log",
+		Usage: `Append a JSON record to <file> for every generated token, with the user,
+host, subject, SANs, provisioner and expiration of the token. Use 'syslog' to
+send the records to the system logger. The token is not generated if the record
+cannot be written.`,
+	}
+
+	ktyFlag = cli.StringFlag{
+		Name: "kty",
+		Usage: `The <kty> of the private key to generate. If unset, default is EC.
+
+: <kty> is a case-sensitive string and must be one of:
+
+    **EC**
+    :  Create an **elliptic curve** keypair
+
+    **OKP**
+    :  Create an octet key pair (for **"Ed25519"** curve)
+
+    **RSA**
+    :  Create an **RSA** keypair`,
+	}
+
+	curveFlag = cli.StringFlag{
+		Name: "crv,curve",
+		Usage: `The elliptic <curve> to use for EC and OKP key types. If unset, default is
+P-256 for EC keys and Ed25519 for OKP keys.
+
+: <curve> is a case-sensitive string and must be one of:
+
+    **P-256**
+    :  NIST P-256 Curve
+
+    **P-384**
+    :  NIST P-384 Curve
+
+    **P-521**
+    :  NIST P-521 Curve
+
+    **Ed25519**
+    :  Ed25519 Curve`,
+	}
+
+	sizeFlag = cli.IntFlag{
+		Name: "size",
+		Usage: `The <size> (in bits) of the key for RSA key types. RSA keys require a minimum
+key size of 2048 bits. If unset, default is 2048 bits.`,
+	}
+
 	passwordFileFlag = cli.StringFlag{
 		Name: "password-file",
 		Usage: `The path to the <file> containing the password to decrypt the one-time token
@@ -211,3 +298,43 @@ func parseValidity(ctx *cli.Context) (notBefore time.Time, notAfter time.Time, e
 	}
 	return
 }
+
+// caRoot returns the root certificate file used to verify the CA, or the
+// fingerprint of the root if only the --fingerprint flag is set. Without the
+// flags it returns the root written by step ca bootstrap, or empty strings if
+// it does not exist.
+func caRoot(ctx *cli.Context) (root, fingerprint string, err error) {
+	root, fingerprint = ctx.String("root"), ctx.String("fingerprint")
+	switch {
+	case root == "" && fingerprint != "":
+		return "", fingerprint, nil
+	case root == "":
+		root = pki.GetRootCAPath()
+		if _, err := os.Stat(root); err != nil {
+			return "", "", nil
+		}
+		return root, "", nil
+	case fingerprint != "":
+		roots, err := pemutil.ReadCertificateBundle(root)
+		if err != nil {
+			return "", "", err
+		}
+		for _, crt := range roots {
+			if strings.EqualFold(x509util.Fingerprint(crt), fingerprint) {
+				return root, "", nil
+			}
+		}
+		return "", "", errors.Errorf("flag '--fingerprint' does not match any root certificate in %s", root)
+	default:
+		return root, "", nil
+	}
+}
+
+// validateSANs validates the wildcards in the SANs requested for the given
+// subject. The subject is the only SAN if none are given.
+func validateSANs(ctx *cli.Context, subject string, sans []string) error {
+	if len(sans) == 0 {
+		sans = []string{subject}
+	}
+	return x509util.ValidateSANs(sans, ctx.Bool("wildcard"))
+}
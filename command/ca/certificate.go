@@ -3,21 +3,29 @@ package ca
 import (
 	"crypto"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"io/ioutil"
 	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/api"
-	"github.com/smallstep/certificates/ca"
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/kms"
 	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/crypto/spiffe"
+	"github.com/smallstep/cli/crypto/tpm"
 	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/debug"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/jose"
@@ -31,10 +39,28 @@ func certificateCommand() cli.Command {
 		Name:   "certificate",
 		Action: command.ActionFunc(certificateAction),
 		Usage:  "generate a new private key and certificate signed by the root certificate",
-		UsageText: `**step ca certificate** <subject> <crt-file> <key-file>
-		[**--token**=<token>] [**--ca-url**=<uri>] [**--root**=<file>]
+		UsageText: `**step ca certificate** <subject> <crt-file> [<key-file>]
+		[**--token**=<token>] [**--token-file**=<file>] [**--subject-from-token**]
+		[**--issuer**=<name>] [**--password-file**=<file>]
+		[**--ca-url**=<uri>] [**--root**=<file>] [**--fingerprint**=<fingerprint>]
 		[**--not-before**=<time|duration>] [**--not-after**=<time|duration>]
-		[**--san**=<SAN>]`,
+		[**--san**=<SAN>] [**--san-file**=<file>] [**--wildcard**]
+		[**--kty**=<type>] [**--curve**=<curve>] [**--size**=<size>]
+		[**--profile**=<preset>] [**--key-usage**=<usage>] [**--eku**=<usage>]
+		[**--key**=<file|uri>] [**--ak**=<file>] [**--ak-cert**=<file>]
+		[**--tpm-device**=<device>] [**--vault**=<mount/path>]
+		[**--vault-role**=<role>] [**--vault-auth-mount**=<path>]
+		[**--aws-secret**=<name>] [**--aws-parameter**=<path>]
+		[**--aws-kms-key**=<key>] [**--aws-region**=<region>] [**--aws-profile**=<profile>]
+		[**--spiffe**] [**--spiffe-dir**=<dir>]
+		[**--docker-registry**=<host[:port]>] [**--docker-certs-dir**=<directory>]
+
+**step ca certificate** **--bulk**=<file> [**--concurrency**=<number>]
+		[**--issuer**=<name>] [**--password-file**=<file>]
+		[**--ca-url**=<uri>] [**--root**=<file>] [**--fingerprint**=<fingerprint>]
+		[**--not-before**=<time|duration>] [**--not-after**=<time|duration>]
+		[**--kty**=<type>] [**--curve**=<curve>] [**--size**=<size>]
+		[**--profile**=<preset>] [**--key-usage**=<usage>] [**--eku**=<usage>]`,
 		Description: `**step ca certificate** command generates a new certificate pair
 
 ## POSITIONAL ARGUMENTS
@@ -42,13 +68,28 @@ func certificateCommand() cli.Command {
 <subject>
 :  The Common Name, DNS Name, or IP address that will be set as the
 Subject Common Name for the certificate. If no Subject Alternative Names (SANs)
-are configured (via the --san flag) then the <subject> will be set as the only SAN.
+are configured (via the --san or --san-file flags) then the <subject> will be set as the only SAN.
+Internationalized domain names are requested in their punycode form. With the **--spiffe** flag it must be a SPIFFE ID like 'spiffe://example.org/web'.
+With an OIDC token it must be one of the email addresses in the token. It is
+not used with the **--subject-from-token** flag.
 
 <crt-file>
-:  File to write the certificate (PEM format)
+:  File to write the certificate (PEM format). It is not used if the
+certificate is written to HashiCorp Vault or AWS using the **--vault**,
+**--aws-secret** or **--aws-parameter** flags, the SVID is written using the
+**--spiffe-dir** flag, or the certificate is written for a registry using the
+**--docker-registry** flag.
 
 <key-file>
-:  File to write the private key (PEM format)
+:  File to write the private key (PEM format). It is not used if the key is
+passed using the **--key** flag, or if it's written to HashiCorp Vault or AWS.
+On macOS it can also be a Keychain URI like 'keychain:label=<label>', the key
+is created in the Keychain and the certificate is imported into it. Add
+';se=true' to the URI to create the key in the Secure Enclave. On Windows it
+can be a certificate store URI like
+'capi:friendly-name=<name>;store-location=machine', the key is created using
+CNG and the certificate is imported into the store, where IIS and other
+Windows services can use it.
 
 ## EXAMPLES
 
@@ -69,6 +110,35 @@ IP Address extensions (1.1.1.1, 10.2.3.4) and 1 DNS Name extension (hello.exampl
 $ step ca certificate --san 1.1.1.1 --san hello.example.com --san 10.2.3.4 foobar internal.crt internal.key
 '''
 
+Request a new certificate with the Subject Alternative Names in a file, one per
+line, with comments starting with '#':
+'''
+$ cat sans.txt
+# Service aliases
+api.example.com
+api.internal.example.com  # internal load balancer
+10.2.3.4
+$ step ca certificate --san-file sans.txt api.example.com api.crt api.key
+'''
+
+Request a new certificate for a wildcard name, the **--wildcard** flag confirms
+that the wildcard is intended:
+'''
+$ step ca certificate --wildcard '*.example.com' wildcard.crt wildcard.key
+'''
+
+Request a new client-only certificate, if the CA uses the extensions in the
+certificate request:
+'''
+$ step ca certificate --profile tls-client jane@example.com jane.crt jane.key
+'''
+
+Request a new certificate with explicit key usages:
+'''
+$ step ca certificate --key-usage digital-signature --eku client-auth \
+  jane@example.com jane.crt jane.key
+'''
+
 Request a new certificate with a 1h validity:
 '''
 $ TOKEN=$(step ca token internal.example.com)
@@ -81,14 +151,135 @@ files, certificates, and keys created with **step ca init**:
 $ step ca certificate --offline internal.example.com internal.crt internal.key
 '''
 
+Request a new certificate with an RSA key:
+'''
+$ step ca certificate --kty RSA --size 4096 internal.example.com internal.crt internal.key
+'''
+
+Request a new certificate using an existing private key:
+'''
+$ step ca certificate --key internal.key internal.example.com internal.crt
+'''
+
+Request a new certificate using a key stored in an HSM:
+'''
+$ step ca certificate internal.example.com internal.crt \
+  --key 'pkcs11:token=step;object=internal-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/run/pin.txt'
+'''
+
+Request a new certificate using a key in AWS KMS:
+'''
+$ step ca certificate internal.example.com internal.crt \
+  --key 'awskms:key-id=arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab'
+'''
+
+Request a new certificate with a key created in the macOS Keychain, the
+certificate is also imported into the Keychain:
+'''
+$ step ca certificate internal.example.com internal.crt keychain:label=internal.example.com
+'''
+
+Request a new certificate with a key created in the Secure Enclave:
+'''
+$ step ca certificate internal.example.com internal.crt 'keychain:label=internal.example.com;se=true'
+'''
+
+Request a new certificate with a key created using CNG, and import it into the
+local machine personal store in Windows:
+'''
+$ step ca certificate internal.example.com internal.crt 'capi:friendly-name=internal.example.com;store-location=machine'
+'''
+
+Request a new certificate using a key created in the TPM with **step crypto tpm**,
+and include the attestation of the key in the certificate request:
+'''
+$ step ca certificate --key key.tpm --ak ak.tpm --ak-cert ak.crt device.example.com device.crt
+'''
+
+Request a new certificate and write it with the private key to HashiCorp Vault,
+using the token in VAULT_TOKEN:
+'''
+$ export VAULT_ADDR=https://vault.example.com:8200
+$ step ca certificate --vault secret/step/internal internal.example.com
+'''
+
+Request a new certificate from a Kubernetes pod, and write it to HashiCorp Vault
+logging in with the Kubernetes auth method:
+'''
+$ step ca certificate --vault secret/step/internal --vault-role step internal.example.com
+'''
+
+Request a new certificate and write it with the private key to an AWS Secrets
+Manager secret, encrypted with a customer managed key:
+'''
+$ step ca certificate --aws-secret step/internal --aws-kms-key alias/step internal.example.com
+'''
+
+Request a new certificate and write it with the private key to SecureString
+parameters in AWS Systems Manager Parameter Store:
+'''
+$ step ca certificate --aws-parameter /step/internal internal.example.com
+'''
+
+Request a client certificate for a private registry that requires mutual TLS,
+and write it with the key and the root certificate to
+/etc/docker/certs.d/registry.example.com:5000:
+'''
+$ step ca certificate --docker-registry registry.example.com:5000 client.example.com
+'''
+
+Request an X509-SVID for a SPIFFE ID:
+'''
+$ step ca certificate --spiffe spiffe://example.org/ns/prod/sa/web svid.crt svid.key
+'''
+
+Request an X509-SVID and write it with the key and the trust bundle using the
+SPIFFE Workload API disk layout:
+'''
+$ step ca certificate --spiffe --spiffe-dir /run/spiffe spiffe://example.org/ns/prod/sa/web
+'''
+
 Request a new certificate using an OIDC provisioner:
 '''
 $ step ca certificate --token $(step oauth --oidc --bare) joe@example.com joe.crt joe.key
+'''
+
+Request a new certificate using an OIDC provisioner, with the email address
+in the token as the subject:
+'''
+$ step ca certificate --token $(step oauth --oidc --bare) --subject-from-token joe.crt joe.key
+'''
+
+Request the certificates of the services in a CSV file, 16 at a time, using
+the JWK provisioner 'admin':
+'''
+$ cat hosts.csv
+# subject,crt-file,key-file,sans...
+web,web.crt,web.key,web.internal,10.0.1.10
+db,db.crt,db.key,db.internal,10.0.1.20
+$ step ca certificate --bulk hosts.csv --concurrency 16 \
+  --issuer admin --password-file provisioner.pass
 '''`,
 		Flags: []cli.Flag{
 			tokenFlag,
+			cli.StringFlag{
+				Name: "token-file",
+				Usage: `The <file> with the one-time token used to authenticate with the CA. Unlike
+**--token**, the token is not visible in the list of processes.`,
+			},
+			cli.BoolFlag{
+				Name: "subject-from-token",
+				Usage: `Use the subject of the token in **--token** instead of the <subject>
+positional argument. The subject is the first email address of OIDC tokens, and
+the subject claim of the other tokens.`,
+			},
+			provisionerKidFlag,
+			provisionerIssuerFlag,
+			passwordFileFlag,
+			auditLogFlag,
 			caURLFlag,
 			rootFlag,
+			rootFingerprintFlag,
 			notBeforeFlag,
 			notAfterFlag,
 			cli.StringSliceFlag{
@@ -99,6 +290,105 @@ the complete set of subjective alternative names in the token 1:1. Use the '--sa
 flag multiple times to configure multiple SANs. The '--san' flag and the '--token'
 flag are mutually exlusive.`,
 			},
+			cli.StringFlag{
+				Name: "san-file",
+				Usage: `The <file> with the Subject Alternative Names (SANs) to add, one per line, like
+the '--san' flag. Empty lines and comments, starting with '#' at the beginning
+of a line or after a space, are ignored. It can be combined with the '--san'
+flag, and it's mutually exclusive with the '--token' flag.`,
+			},
+			flags.Wildcard,
+			ktyFlag,
+			curveFlag,
+			sizeFlag,
+			cli.StringFlag{
+				Name: "profile",
+				Usage: `Request the key usages of a common use of the certificate, instead of setting
+them one by one with **--key-usage** and **--eku**. Those flags replace the
+usages of the preset. Like them, the preset is only used if the CA honors the
+extensions in the certificate request.
+
+: <preset> is a case-sensitive string and must be one of:
+
+    **tls-server**
+    :  A certificate for a TLS server, with the **server-auth** extended key usage.
+
+    **tls-client**
+    :  A certificate for a TLS client, with the **client-auth** extended key usage.
+
+    **mtls-peer**
+    :  A certificate for a peer in mutual TLS, with the **server-auth** and
+    **client-auth** extended key usages.
+
+    **code-signing**
+    :  A certificate for code signing, with the **code-signing** extended key usage.
+
+: All the presets use the **digital-signature** key usage, and TLS servers with
+RSA keys also use **key-encipherment**.`,
+			},
+			cli.StringSliceFlag{
+				Name: "key-usage",
+				Usage: `Request the key <usage> in the certificate. The key usages are added to the
+certificate request, and used in the certificate if the CA honors the
+extensions in the request. Use the '--key-usage' flag multiple times to request
+multiple usages. The key usages must be valid for the type of the key, e.g.
+**key-encipherment** is only valid for RSA keys.
+
+: <usage> is a case-insensitive string and must be one of:
+
+    **digital-signature**, **content-commitment** (or **non-repudiation**),
+    **key-encipherment**, **data-encipherment**, **key-agreement**,
+    **cert-sign**, **crl-sign**, **encipher-only** or **decipher-only**.`,
+			},
+			cli.StringSliceFlag{
+				Name: "eku,ext-key-usage",
+				Usage: `Request the extended key <usage> in the certificate, e.g. **client-auth** for
+a client-only certificate. Like **--key-usage**, the extended key usages are
+added to the certificate request. Use the '--eku' flag multiple times to
+request multiple usages.
+
+: <usage> is a case-insensitive string and must be one of:
+
+    **server-auth**, **client-auth**, **code-signing**, **email-protection**,
+    **time-stamping**, **ocsp-signing**, **ipsec-end-system**, **ipsec-tunnel**,
+    **ipsec-user**, **any**, or an object identifier in dotted notation.`,
+			},
+			cli.StringFlag{
+				Name: "key",
+				Usage: `The private key <file> used to sign the certificate request instead of
+generating a new one. It can also be a PKCS #11 URI of a key stored in an HSM,
+an awskms, cloudkms or azurekms URI of a key stored in a cloud KMS, a Keychain URI of a key stored in the macOS Keychain, a capi URI of a key
+stored in Windows, or a TPM key created with **step crypto tpm create**.`,
+			},
+			cli.StringFlag{
+				Name: "ak",
+				Usage: `The TPM attestation key <file> used to attest the TPM key in **--key**. The
+attestation is added to the certificate request, it uses the SHA-256 hash of
+the token as nonce.`,
+			},
+			cli.StringFlag{
+				Name: "ak-cert",
+				Usage: `The <file> with the certificate of the attestation key, and optionally its
+intermediates, to include in the attestation.`,
+			},
+			cli.StringFlag{
+				Name:  "tpm-device",
+				Usage: `The TPM <device>, e.g. /dev/tpmrm0. If unset, the default device is used.`,
+			},
+			vaultFlag,
+			vaultRoleFlag,
+			vaultAuthMountFlag,
+			awsSecretFlag,
+			awsParameterFlag,
+			awsKMSKeyFlag,
+			awsRegionFlag,
+			awsProfileFlag,
+			spiffeFlag,
+			spiffeDirFlag,
+			dockerRegistryFlag,
+			dockerCertsDirFlag,
+			bulkFlag,
+			concurrencyFlag,
 			offlineFlag,
 			caConfigFlag,
 			flags.Force,
@@ -107,22 +397,141 @@ flag are mutually exlusive.`,
 }
 
 func certificateAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 3); err != nil {
+	if ctx.String("bulk") != "" {
+		return bulkCertificateAction(ctx)
+	}
+	if err := readTokenFile(ctx); err != nil {
 		return err
 	}
 
-	args := ctx.Args()
-	subject := args.Get(0)
-	crtFile, keyFile := args.Get(1), args.Get(2)
+	// The private key is not written to disk if it's passed with --key, and
+	// the certificate and key are not written to disk if they are written to
+	// a secret store.
+	existingKey := ctx.String("key")
+	spiffeDir := ctx.String("spiffe-dir")
+	dockerRegistry := ctx.String("docker-registry")
+	nargs := 3
+	switch {
+	case spiffeDir != "" || dockerRegistry != "" || hasSecretTargets(ctx):
+		nargs = 1
+	case existingKey != "":
+		nargs = 2
+	}
+	subjectFromToken := ctx.Bool("subject-from-token")
+	if subjectFromToken {
+		if ctx.String("token") == "" {
+			return errs.RequiredWithFlag(ctx, "subject-from-token", "token")
+		}
+		nargs--
+	}
+	if err := errs.NumberOfArguments(ctx, nargs); err != nil {
+		return err
+	}
+	if existingKey != "" {
+		for _, f := range []string{"kty", "curve", "size"} {
+			if ctx.IsSet(f) {
+				return errs.IncompatibleFlagWithFlag(ctx, f, "key")
+			}
+		}
+	}
+	if _, _, keyFile := certificateArgs(ctx); isStoreURI(keyFile) {
+		if err := parseStoreURI(keyFile); err != nil {
+			return err
+		}
+	}
+	if ctx.String("ak") != "" && !tpm.IsKeyFile(existingKey) {
+		return errors.New("flag '--ak' requires a TPM key in the '--key' flag")
+	}
+	if ctx.String("ak-cert") != "" && ctx.String("ak") == "" {
+		return errs.RequiredWithFlag(ctx, "ak-cert", "ak")
+	}
+	if err := validateUsageFlags(ctx); err != nil {
+		return err
+	}
+	if hasSecretTargets(ctx) && isStoreURI(existingKey) {
+		return errs.IncompatibleFlag(ctx, "key", existingKey)
+	}
+	if spiffeDir != "" {
+		if !ctx.Bool("spiffe") {
+			return errs.RequiredWithFlag(ctx, "spiffe-dir", "spiffe")
+		}
+		for _, f := range []string{"key", "vault", "aws-secret", "aws-parameter"} {
+			if ctx.String(f) != "" {
+				return errs.IncompatibleFlagWithFlag(ctx, "spiffe-dir", f)
+			}
+		}
+	}
+	if dockerRegistry != "" {
+		for _, f := range []string{"key", "spiffe-dir", "vault", "aws-secret", "aws-parameter"} {
+			if ctx.String(f) != "" {
+				return errs.IncompatibleFlagWithFlag(ctx, "docker-registry", f)
+			}
+		}
+	}
+	// The SVIDs and the registry certificates are written with the root.
+	if ctx.String("root") == "" && ctx.String("fingerprint") != "" {
+		switch {
+		case ctx.Bool("spiffe"):
+			return errs.RequiredWithFlag(ctx, "spiffe", "root")
+		case dockerRegistry != "":
+			return errs.RequiredWithFlag(ctx, "docker-registry", "root")
+		}
+	}
+	targets, err := newSecretTargets(ctx)
+	if err != nil {
+		return err
+	}
+	dockerDir, err := dockerRegistryDir(ctx)
+	if err != nil {
+		return err
+	}
+
+	subject, crtFile, keyFile := certificateArgs(ctx)
+	if dockerDir != "" {
+		if err := os.MkdirAll(dockerDir, 0755); err != nil {
+			return errs.FileError(err, dockerDir)
+		}
+		crtFile = filepath.Join(dockerDir, dockerClientCert)
+		keyFile = filepath.Join(dockerDir, dockerClientKey)
+	}
 	token := ctx.String("token")
 	offline := ctx.Bool("offline")
 	sans := ctx.StringSlice("san")
+	if filename := ctx.String("san-file"); filename != "" {
+		fileSANs, err := x509util.ReadSANsFile(filename)
+		if err != nil {
+			return err
+		}
+		sans = append(sans, fileSANs...)
+	}
 
 	// offline and token are incompatible because the token is generated before
 	// the start of the offline CA.
 	if offline && len(token) != 0 {
 		return errs.IncompatibleFlagWithFlag(ctx, "offline", "token")
 	}
+	if subjectFromToken {
+		if subject, err = tokenSubject(token); err != nil {
+			return err
+		}
+		ui.PrintSelected("Subject", subject)
+	}
+
+	// In SPIFFE mode the SPIFFE ID must be the only URI SAN.
+	var spiffeID *url.URL
+	if ctx.Bool("spiffe") {
+		if spiffeID, err = spiffe.ParseID(subject); err != nil {
+			return err
+		}
+		for _, san := range sans {
+			if strings.Contains(san, "://") && san != subject {
+				return errors.Errorf("flag '--san' cannot have other URIs than the SPIFFE ID '%s'", subject)
+			}
+		}
+		if len(sans) > 0 && !contains(sans, subject) {
+			sans = append([]string{subject}, sans...)
+		}
+	}
 
 	// certificate flow unifies online and offline flows on a single api
 	flow, err := newCertificateFlow(ctx)
@@ -130,8 +539,22 @@ func certificateAction(ctx *cli.Context) error {
 		return err
 	}
 
+	// The trust domain is validated before the certificate is requested.
+	var roots []*x509.Certificate
+	if spiffeID != nil {
+		if roots, err = pemutil.ReadCertificateBundle(flow.rootFile(ctx)); err != nil {
+			return err
+		}
+		if err := spiffe.VerifyTrustDomain(spiffeID.Host, roots...); err != nil {
+			return err
+		}
+	}
+
 	var isStepToken bool
 	if len(token) == 0 {
+		if err := validateSANs(ctx, subject, sans); err != nil {
+			return err
+		}
 		if token, err = flow.GenerateToken(ctx, subject, sans); err != nil {
 			return err
 		}
@@ -139,49 +562,175 @@ func certificateAction(ctx *cli.Context) error {
 	} else {
 		isStepToken = isStepCertificatesToken(token)
 		if isStepToken && len(sans) > 0 {
+			if !ctx.IsSet("san") {
+				return errs.MutuallyExclusiveFlags(ctx, "token", "san-file")
+			}
 			return errs.MutuallyExclusiveFlags(ctx, "token", "san")
 		}
 	}
 
-	req, pk, err := flow.CreateSignRequest(token, sans)
+	req, pk, err := flow.CreateSignRequest(ctx, token, sans)
 	if err != nil {
 		return err
 	}
 
 	if isStepToken {
 		// Validate that subject matches the CSR common name.
-		if strings.ToLower(subject) != strings.ToLower(req.CsrPEM.Subject.CommonName) {
-			return errors.Errorf("token subject '%s' and common name '%s' do not match", req.CsrPEM.Subject.CommonName, subject)
+		if cn := req.CsrPEM.Subject.CommonName; !x509util.EqualNames(subject, cn) {
+			return errors.Errorf("token subject '%s' and argument '%s' do not match; "+
+				"use '%s' as the subject or the '--subject-from-token' flag", cn, subject, cn)
 		}
 	} else {
 		// Validate that the subject matches an email SAN
-		if len(req.CsrPEM.EmailAddresses) == 0 {
-			return errors.New("unexpected token: payload does not contain an email claim")
-		}
-		if email := req.CsrPEM.EmailAddresses[0]; email != subject {
-			return errors.Errorf("token email '%s' and argument '%s' do not match", email, subject)
+		emails := req.CsrPEM.EmailAddresses
+		switch {
+		case len(emails) == 0:
+			return errors.New("unexpected token: payload does not contain an email claim; " +
+				"request the token with the 'email' scope")
+		case contains(emails, subject):
+		case len(emails) == 1:
+			return errors.Errorf("token email '%s' and argument '%s' do not match; "+
+				"use '%s' as the subject or the '--subject-from-token' flag", emails[0], subject, emails[0])
+		default:
+			return errors.Errorf("argument '%s' is not one of the token emails; "+
+				"use one of '%s' as the subject or the '--subject-from-token' flag", subject, strings.Join(emails, "', '"))
 		}
 	}
 
-	if err := flow.Sign(ctx, token, req.CsrPEM, crtFile); err != nil {
-		return err
+	// SVIDs are verified before they are written.
+	signFile := crtFile
+	if spiffeID != nil {
+		signFile = ""
 	}
-
-	_, err = pemutil.Serialize(pk, pemutil.ToFile(keyFile, 0600))
+	resp, err := flow.Sign(ctx, token, req.CsrPEM, signFile)
 	if err != nil {
 		return err
 	}
 
+	if spiffeID != nil {
+		if err := verifySVID(spiffeID, resp); err != nil {
+			return err
+		}
+		switch {
+		case spiffeDir != "":
+			return writeSVID(spiffeDir, resp, pk, roots)
+		case crtFile != "":
+			if err := writeCertificateFile(crtFile, resp); err != nil {
+				return err
+			}
+		}
+	}
+
+	if targets != nil {
+		// Keys passed with --key are not written, they might not be exportable.
+		var key crypto.PrivateKey
+		if existingKey == "" {
+			key = pk
+		}
+		if err := targets.Write(resp, key); err != nil {
+			return err
+		}
+		for _, d := range targets.Destinations() {
+			ui.PrintSelected("Certificate", d)
+		}
+		return nil
+	}
+
 	ui.PrintSelected("Certificate", crtFile)
-	ui.PrintSelected("Private Key", keyFile)
+	switch {
+	case isStoreURI(existingKey):
+		if err := storeImportCertificateFile(existingKey, crtFile); err != nil {
+			return err
+		}
+	case isStoreURI(keyFile):
+		if err := storeImportCertificateFile(keyFile, crtFile); err != nil {
+			return err
+		}
+		ui.PrintSelected("Private Key", keyFile)
+	case existingKey == "":
+		if _, err := pemutil.Serialize(pk, pemutil.ToFile(keyFile, 0600)); err != nil {
+			return err
+		}
+		ui.PrintSelected("Private Key", keyFile)
+	}
+	if dockerDir != "" {
+		rootFile, err := writeDockerRoot(dockerDir, flow.rootFile(ctx))
+		if err != nil {
+			return err
+		}
+		ui.PrintSelected("Root Certificate", rootFile)
+	}
+	return nil
+}
+
+// validateUsageFlags validates the --profile, --key-usage and --eku flags.
+func validateUsageFlags(ctx *cli.Context) error {
+	if prof := ctx.String("profile"); prof != "" {
+		if _, ok := x509util.GetPreset(prof); !ok {
+			return errs.InvalidFlagValue(ctx, "profile", prof, x509util.PresetNames())
+		}
+	}
+	if _, err := x509util.ParseKeyUsage(ctx.StringSlice("key-usage")); err != nil {
+		return errors.Wrap(err, "error parsing flag '--key-usage'")
+	}
+	if _, _, err := x509util.ParseExtKeyUsage(ctx.StringSlice("eku")); err != nil {
+		return errors.Wrap(err, "error parsing flag '--eku'")
+	}
 	return nil
 }
 
 type tokenClaims struct {
 	jose.Claims
-	SHA   string   `json:"sha"`
-	SANs  []string `json:"sans"`
-	Email string   `json:"email"`
+	SHA    string   `json:"sha"`
+	SANs   []string `json:"sans"`
+	Email  string   `json:"email"`
+	Emails []string `json:"emails"`
+}
+
+// emails returns the email addresses in the token, the email claim first
+// and then the other identities in the emails claim, without duplicates.
+func (c *tokenClaims) emails() []string {
+	var emails []string
+	for _, e := range append([]string{c.Email}, c.Emails...) {
+		if e != "" && !contains(emails, e) {
+			emails = append(emails, e)
+		}
+	}
+	return emails
+}
+
+// tokenSubject returns the subject to request with the given token, the first
+// email address of OIDC tokens, or the subject of other tokens.
+func tokenSubject(token string) (string, error) {
+	t, err := jose.ParseSigned(token)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing flag '--token'")
+	}
+	var claims tokenClaims
+	if err := t.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error parsing flag '--token'")
+	}
+	if len(claims.SHA) > 0 || len(claims.SANs) > 0 {
+		if claims.Subject == "" {
+			return "", errors.New("flag '--subject-from-token': token does not contain a subject")
+		}
+		return claims.Subject, nil
+	}
+	emails := claims.emails()
+	if len(emails) == 0 {
+		return "", errors.New("flag '--subject-from-token': token does not contain an email claim")
+	}
+	return emails[0], nil
+}
+
+// certificateArgs returns the positional arguments of step ca certificate,
+// the subject is empty if it is taken from the token.
+func certificateArgs(ctx *cli.Context) (subject, crtFile, keyFile string) {
+	args := ctx.Args()
+	if ctx.Bool("subject-from-token") {
+		return "", args.Get(0), args.Get(1)
+	}
+	return args.Get(0), args.Get(1), args.Get(2)
 }
 
 func isStepCertificatesToken(token string) bool {
@@ -207,11 +756,7 @@ func newCertificateFlow(ctx *cli.Context) (*certificateFlow, error) {
 
 	offline := ctx.Bool("offline")
 	if offline {
-		caConfig := ctx.String("ca-config")
-		if caConfig == "" {
-			return nil, errs.InvalidFlagValue(ctx, "ca-config", "", "")
-		}
-		offlineClient, err = newOfflineCA(caConfig)
+		offlineClient, err = newOfflineClient(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -224,14 +769,11 @@ func newCertificateFlow(ctx *cli.Context) (*certificateFlow, error) {
 }
 
 func (f *certificateFlow) getClient(ctx *cli.Context, subject, token string) (caClient, error) {
+	debug.Token("token", token)
 	if f.offline {
 		return f.offlineCA, nil
 	}
 
-	// Create online client
-	root := ctx.String("root")
-	caURL := ctx.String("ca-url")
-
 	tok, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, errors.Wrap(err, "error parsing flag '--token'")
@@ -240,30 +782,44 @@ func (f *certificateFlow) getClient(ctx *cli.Context, subject, token string) (ca
 	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
 		return nil, errors.Wrap(err, "error parsing flag '--token'")
 	}
-	if strings.ToLower(claims.Subject) != strings.ToLower(subject) {
+	if !x509util.EqualNames(claims.Subject, subject) {
 		return nil, errors.Errorf("token subject '%s' and CSR CommonName '%s' do not match", claims.Subject, subject)
 	}
 
 	// Prepare client for bootstrap or provisioning tokens
-	var options []ca.ClientOption
 	if len(claims.SHA) > 0 && len(claims.Audience) > 0 && strings.HasPrefix(strings.ToLower(claims.Audience[0]), "http") {
-		caURL = claims.Audience[0]
-		options = append(options, ca.WithRootSHA256(claims.SHA))
-	} else {
-		if len(caURL) == 0 {
-			return nil, errs.RequiredFlag(ctx, "ca-url")
-		}
-		if len(root) == 0 {
-			root = pki.GetRootCAPath()
-			if _, err := os.Stat(root); err != nil {
-				return nil, errs.RequiredFlag(ctx, "root")
-			}
-		}
-		options = append(options, ca.WithRootFile(root))
+		caURL := claims.Audience[0]
+		ui.PrintSelected("CA", caURL)
+		return pki.NewBootstrapClient(caURL, claims.SHA)
+	}
+
+	return f.client(ctx)
+}
+
+// client returns the client used to sign certificates, the offline CA or a
+// client for the CA in the --ca-url flag.
+func (f *certificateFlow) client(ctx *cli.Context) (caClient, error) {
+	if f.offline {
+		return f.offlineCA, nil
+	}
+
+	caURL := ctx.String("ca-url")
+	if len(caURL) == 0 {
+		return nil, errs.RequiredFlag(ctx, "ca-url")
+	}
+	root, fingerprint, err := caRoot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if root == "" && fingerprint == "" {
+		return nil, errs.RequiredOrFlag(ctx, "root", "fingerprint")
 	}
 
 	ui.PrintSelected("CA", caURL)
-	return ca.NewClient(caURL, options...)
+	if fingerprint != "" {
+		return pki.NewBootstrapClient(caURL, fingerprint)
+	}
+	return pki.NewClient(caURL, root)
 }
 
 func (f *certificateFlow) GenerateToken(ctx *cli.Context, subject string, sans []string) (string, error) {
@@ -278,12 +834,12 @@ func (f *certificateFlow) GenerateToken(ctx *cli.Context, subject string, sans [
 		return "", errs.RequiredUnlessFlag(ctx, "ca-url", "token")
 	}
 
-	root := ctx.String("root")
-	if len(root) == 0 {
-		root = pki.GetRootCAPath()
-		if _, err := os.Stat(root); err != nil {
-			return "", errs.RequiredUnlessFlag(ctx, "root", "token")
-		}
+	root, fingerprint, err := caRoot(ctx)
+	if err != nil {
+		return "", err
+	}
+	if root == "" && fingerprint == "" {
+		return "", errs.RequiredUnlessFlag(ctx, "root", "token")
 	}
 
 	// parse times or durations
@@ -296,7 +852,6 @@ func (f *certificateFlow) GenerateToken(ctx *cli.Context, subject string, sans [
 		return "", errs.InvalidFlagValue(ctx, "not-after", ctx.String("not-after"), "")
 	}
 
-	var err error
 	if subject == "" {
 		subject, err = ui.Prompt("What DNS names or IP addresses would you like to use? (e.g. internal.smallstep.com)", ui.WithValidateNotEmpty())
 		if err != nil {
@@ -304,19 +859,24 @@ func (f *certificateFlow) GenerateToken(ctx *cli.Context, subject string, sans [
 		}
 	}
 
-	return newTokenFlow(ctx, subject, sans, caURL, root, "", "", "", "", notBefore, notAfter)
+	kid := ctx.String("kid")
+	issuer := ctx.String("issuer")
+	passwordFile := ctx.String("password-file")
+	return newTokenFlow(ctx, subject, sans, caURL, root, kid, issuer, passwordFile, "", notBefore, notAfter)
 }
 
-func (f *certificateFlow) Sign(ctx *cli.Context, token string, csr api.CertificateRequest, crtFile string) error {
+// Sign signs the given certificate request and writes the certificate and
+// its intermediate to crtFile. The file is not written if crtFile is empty.
+func (f *certificateFlow) Sign(ctx *cli.Context, token string, csr api.CertificateRequest, crtFile string) (*api.SignResponse, error) {
 	client, err := f.getClient(ctx, csr.Subject.CommonName, token)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// parse times or durations
 	notBefore, notAfter, err := parseValidity(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req := &api.SignRequest{
@@ -328,9 +888,45 @@ func (f *certificateFlow) Sign(ctx *cli.Context, token string, csr api.Certifica
 
 	resp, err := client.Sign(req)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if crtFile != "" {
+		if err := writeCertificateFile(crtFile, resp); err != nil {
+			return nil, err
+		}
+	}
+
+	f.refreshRoots(ctx, client)
+	return resp, nil
+}
+
+// refreshRoots adds the new roots of the CA to the bundle written by step ca
+// bootstrap. It's called after a certificate is signed, so an error
+// refreshing the roots is only reported.
+func (f *certificateFlow) refreshRoots(ctx *cli.Context, client caClient) {
+	if rootFile, _, err := caRoot(ctx); err == nil && !f.offline && isBootstrapRoot(rootFile) {
+		if n, err := refreshRoots(client, rootFile); err != nil {
+			ui.Printf("Warning: the roots in %s could not be refreshed: %v\n", rootFile, err)
+		} else if n > 0 {
+			ui.Printf("The root certificate bundle in %s has been updated with %d new roots.\n", rootFile, n)
+		}
 	}
+}
 
+// rootFile returns the path of the root certificate used by the flow.
+func (f *certificateFlow) rootFile(ctx *cli.Context) string {
+	if f.offline {
+		return f.offlineCA.Root()
+	}
+	if root := ctx.String("root"); root != "" {
+		return root
+	}
+	return pki.GetRootCAPath()
+}
+
+// writeCertificateFile writes the certificate and the intermediate in the
+// given response to crtFile.
+func writeCertificateFile(crtFile string, resp *api.SignResponse) error {
 	serverBlock, err := pemutil.Serialize(resp.ServerPEM.Certificate)
 	if err != nil {
 		return err
@@ -344,8 +940,9 @@ func (f *certificateFlow) Sign(ctx *cli.Context, token string, csr api.Certifica
 }
 
 // CreateSignRequest is a helper function that given an x509 OTT returns a
-// simple but secure sign request as well as the private key used.
-func (f *certificateFlow) CreateSignRequest(token string, sans []string) (*api.SignRequest, crypto.PrivateKey, error) {
+// simple but secure sign request as well as the private key used. If the
+// --key flag is set the given key is used, otherwise a new key is generated.
+func (f *certificateFlow) CreateSignRequest(ctx *cli.Context, token string, sans []string) (*api.SignRequest, crypto.PrivateKey, error) {
 	tok, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "error parsing token")
@@ -355,25 +952,93 @@ func (f *certificateFlow) CreateSignRequest(token string, sans []string) (*api.S
 		return nil, nil, errors.Wrap(err, "error parsing token")
 	}
 
-	pk, err := keys.GenerateDefaultKey()
+	var pk crypto.PrivateKey
+	var extensions []pkix.Extension
+	switch keyFile := ctx.String("key"); {
+	case kms.IsURI(keyFile):
+		if pk, err = kms.NewSigner(keyFile); err != nil {
+			return nil, nil, err
+		}
+	case isStoreURI(keyFile):
+		if pk, err = storeSigner(keyFile); err != nil {
+			return nil, nil, err
+		}
+	case tpm.IsKeyFile(keyFile):
+		t, err := tpm.Open(ctx.String("tpm-device"))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer t.Close()
+		if pk, extensions, err = tpmSigner(ctx, t, keyFile, token); err != nil {
+			return nil, nil, err
+		}
+	case keyFile != "":
+		if pk, err = pemutil.ReadPrivateKey(keyFile); err != nil {
+			return nil, nil, err
+		}
+	default:
+		kty, crv, size, err := utils.GetKeyDetailsFromCLI(ctx, false, "kty", "curve", "size")
+		if err != nil {
+			return nil, nil, err
+		}
+		// Keys with a store URI in <key-file> are created in the store.
+		if _, _, name := certificateArgs(ctx); isStoreURI(name) {
+			pk, err = storeCreateKey(name, kty, crv, size)
+		} else {
+			pk, err = keys.GenerateKey(kty, crv, size)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The key usages are requested as extensions, the CA decides if they are
+	// used in the certificate.
+	usages := &x509util.Extensions{
+		KeyUsage:    ctx.StringSlice("key-usage"),
+		ExtKeyUsage: ctx.StringSlice("eku"),
+	}
+	if preset, ok := x509util.GetPreset(ctx.String("profile")); ok {
+		kty := "EC"
+		if signer, ok := pk.(crypto.Signer); ok {
+			if _, ok := signer.Public().(*rsa.PublicKey); ok {
+				kty = "RSA"
+			}
+		}
+		usages = preset.Apply(usages, kty)
+	}
+	if len(usages.KeyUsage) > 0 || len(usages.ExtKeyUsage) > 0 {
+		if signer, ok := pk.(crypto.Signer); ok {
+			if err := x509util.ValidateKeyUsage(signer.Public(), usages.KeyUsage); err != nil {
+				return nil, nil, errors.Wrap(err, "error parsing flag '--key-usage'")
+			}
+		}
+		exts, err := usages.CSRExtensions()
+		if err != nil {
+			return nil, nil, err
+		}
+		extensions = append(extensions, exts...)
+	}
+
+	dnsNames, ips, uris, err := splitSANs(sans, claims.SANs)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	var emails []string
-	dnsNames, ips := splitSANs(sans, claims.SANs)
-	if claims.Email != "" {
-		emails = append(emails, claims.Email)
+	for _, name := range dnsNames {
+		if name != claims.Subject && strings.EqualFold(name, claims.Subject) {
+			return nil, nil, errors.Errorf("subject '%s' and SAN '%s' differ only in case", claims.Subject, name)
+		}
 	}
 
 	template := &x509.CertificateRequest{
 		Subject: pkix.Name{
 			CommonName: claims.Subject,
 		},
-		SignatureAlgorithm: keys.DefaultSignatureAlgorithm,
-		DNSNames:           dnsNames,
-		IPAddresses:        ips,
-		EmailAddresses:     emails,
+		DNSNames:        dnsNames,
+		IPAddresses:     ips,
+		EmailAddresses:  claims.emails(),
+		URIs:            uris,
+		ExtraExtensions: extensions,
 	}
 
 	csr, err := x509.CreateCertificateRequest(rand.Reader, template, pk)
@@ -393,18 +1058,98 @@ func (f *certificateFlow) CreateSignRequest(token string, sans []string) (*api.S
 	}, pk, nil
 }
 
-// splitSANs unifies the SAN collections passed as arguments and returns a list
-// of DNS names and a list of IP addresses.
-func splitSANs(args ...[]string) (dnsNames []string, ipAddresses []net.IP) {
-	m := make(map[string]bool)
-	var unique []string
+// tpmSigner returns a signer for the TPM key in the given file. If the --ak
+// flag is set it also returns the extension with the attestation of the key.
+func tpmSigner(ctx *cli.Context, t *tpm.TPM, keyFile, token string) (crypto.Signer, []pkix.Extension, error) {
+	key, err := tpm.ReadKey(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := t.Signer(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	akFile := ctx.String("ak")
+	if akFile == "" {
+		return signer, nil, nil
+	}
+	ak, err := tpm.ReadKey(akFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The hash of the token binds the attestation to this request.
+	nonce := sha256.Sum256([]byte(token))
+	att, err := t.Attest(key, ak, nonce[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if filename := ctx.String("ak-cert"); filename != "" {
+		certs, err := pemutil.ReadCertificateBundle(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, crt := range certs {
+			att.AKCertificates = append(att.AKCertificates, crt.Raw)
+		}
+	}
+	ext, err := att.Extension()
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, []pkix.Extension{ext}, nil
+}
+
+// splitSANs unifies the SAN collections passed as arguments and returns a
+// sorted list of DNS names, a list of IP addresses and a list of URIs, like
+// SPIFFE IDs. The order of the arguments does not change the result, so the
+// certificate requests are the same between renewals.
+func splitSANs(args ...[]string) (dnsNames []string, ipAddresses []net.IP, uris []*url.URL, err error) {
+	var all []string
 	for _, sans := range args {
-		for _, san := range sans {
-			if ok := m[san]; !ok {
-				m[san] = true
-				unique = append(unique, san)
+		all = append(all, sans...)
+	}
+	unique, err := x509util.UniqueSANs(all)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var names []string
+	for _, san := range unique {
+		if strings.Contains(san, "://") {
+			if u, err := url.Parse(san); err == nil {
+				uris = append(uris, u)
+				continue
 			}
 		}
+		names = append(names, san)
+	}
+	dnsNames, ipAddresses = x509util.SplitSANs(names)
+	return dnsNames, ipAddresses, uris, nil
+}
+
+// readTokenFile sets the --token flag with the contents of the --token-file
+// flag, if it is set.
+func readTokenFile(ctx *cli.Context) error {
+	filename := ctx.String("token-file")
+	if filename == "" {
+		return nil
+	}
+	if ctx.String("token") != "" {
+		return errs.MutuallyExclusiveFlags(ctx, "token", "token-file")
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errs.FileError(err, filename)
+	}
+	return errors.Wrap(ctx.Set("token", strings.TrimSpace(string(b))), "error setting flag '--token'")
+}
+
+// contains returns true if the given slice contains s.
+func contains(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
 	}
-	return x509util.SplitSANs(unique)
+	return false
 }
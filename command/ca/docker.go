@@ -0,0 +1,68 @@
+package ca
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+// Files in the certificate directory of a registry used by Docker and other
+// OCI clients. The client certificate must use the '.cert' extension, files
+// with the '.crt' extension are used as root certificates.
+const (
+	dockerClientCert = "client.cert"
+	dockerClientKey  = "client.key"
+	dockerRootCert   = "ca.crt"
+)
+
+var (
+	dockerRegistryFlag = cli.StringFlag{
+		Name: "docker-registry",
+		Usage: `Use the client certificate, private key and root certificate of the private
+registry <host[:port]>, in the directory '<certs-dir>/<host[:port]>' used by
+Docker and other OCI clients for mutual TLS, instead of <crt-file> and
+<key-file>.`,
+	}
+
+	dockerCertsDirFlag = cli.StringFlag{
+		Name: "docker-certs-dir",
+		Usage: `The <directory> with the certificates of the registries. Use
+'/etc/containers/certs.d' for Podman and other clients using the
+containers libraries.`,
+		Value: "/etc/docker/certs.d",
+	}
+)
+
+// dockerRegistryDir validates the --docker-registry flag and returns the
+// directory of the registry certificates. It returns an empty string if the
+// flag is not set.
+func dockerRegistryDir(ctx *cli.Context) (string, error) {
+	registry := ctx.String("docker-registry")
+	if registry == "" {
+		if ctx.IsSet("docker-certs-dir") {
+			return "", errs.RequiredWithFlag(ctx, "docker-certs-dir", "docker-registry")
+		}
+		return "", nil
+	}
+	if strings.ContainsAny(registry, `/\`) || registry == "." || registry == ".." {
+		return "", errs.InvalidFlagValue(ctx, "docker-registry", registry, "")
+	}
+	return filepath.Join(ctx.String("docker-certs-dir"), registry), nil
+}
+
+// writeDockerRoot writes the root certificates in rootFile to the directory
+// of the registry certificates, so the registry is trusted.
+func writeDockerRoot(dir, rootFile string) (string, error) {
+	b, err := utils.ReadFile(rootFile)
+	if err != nil {
+		return "", err
+	}
+	filename := filepath.Join(dir, dockerRootCert)
+	if err := utils.WriteFile(filename, b, 0644); err != nil {
+		return "", errs.FileError(err, filename)
+	}
+	return filename, nil
+}
@@ -0,0 +1,315 @@
+package ca
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/jose"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func enrollCommand() cli.Command {
+	return cli.Command{
+		Name:   "enroll",
+		Action: command.ActionFunc(enrollAction),
+		Usage:  "enroll a new host using a one-time enrollment token",
+		UsageText: `**step ca enroll** <crt-file> <key-file>
+[**--token**=<token>] [**--token-file**=<file>]
+[**--kty**=<type>] [**--curve**=<curve>] [**--size**=<size>]
+[**--renew-unit**=<file>] [**--expires-in**=<duration>] [**--exec**=<command>]
+[**--install**] [**--force**]`,
+		Description: `**step ca enroll** joins a new host to the certificate authority using a
+one-time enrollment token, usually delivered with cloud-init or other user-data
+mechanism. In a single step it:
+
+1. Bootstraps the host, downloading the root certificate using the CA URL and
+the root fingerprint in the token, like **step ca bootstrap**.
+
+2. Creates a new private key and gets the first certificate of the host using
+the token.
+
+3. Persists the renewal configuration. With **--renew-unit** a systemd service
+that runs **step ca renew --daemon** is written, otherwise the command to renew
+the certificate is printed.
+
+The enrollment token is a token created with **step ca token** on a machine
+with the root certificate available, so it contains the CA URL in the audience
+and the root fingerprint in the 'sha' claim. The CA only accepts a token once,
+so a leaked token cannot be used after the enrollment.
+
+## POSITIONAL ARGUMENTS
+
+<crt-file>
+:  File to write the certificate (PEM format).
+
+<key-file>
+:  File to write the private key (PEM format).
+
+## EXAMPLES
+
+Create an enrollment token for a new host and add it to its user-data:
+'''
+$ step ca token --not-after 1h web1.example.com > enroll.token
+'''
+
+Enroll the host from cloud-init and start the renewal daemon:
+'''
+#cloud-config
+write_files:
+- path: /run/step/enroll.token
+  permissions: '0600'
+  content: <token>
+runcmd:
+- step ca enroll --token-file /run/step/enroll.token --install
+  --renew-unit /etc/systemd/system/step-renew.service
+  /etc/ssl/web1.crt /etc/ssl/web1.key
+- systemctl enable --now step-renew.service
+'''
+
+Enroll a host and reload nginx after each renewal:
+'''
+$ step ca enroll --token $TOKEN --exec "systemctl reload nginx" \
+  --renew-unit /etc/systemd/system/step-renew.service \
+  /etc/nginx/web1.crt /etc/nginx/web1.key
+'''`,
+		Flags: []cli.Flag{
+			tokenFlag,
+			cli.StringFlag{
+				Name:  "token-file",
+				Usage: "The <file> with the one-time enrollment token.",
+			},
+			ktyFlag,
+			curveFlag,
+			sizeFlag,
+			cli.StringFlag{
+				Name: "renew-unit",
+				Usage: `The <file> where the systemd service that renews the certificate is written,
+e.g. /etc/systemd/system/step-renew.service.`,
+			},
+			cli.StringFlag{
+				Name: "expires-in",
+				Usage: `The amount of time remaining before certificate expiration at which the
+renewal daemon renews the certificate, see **step ca renew**. The <duration> is
+a sequence of decimal numbers, each with optional fraction and a unit suffix,
+such as "300ms", "1.5h" or "2h45m".`,
+			},
+			cli.StringFlag{
+				Name:  "exec",
+				Usage: "The <command> the renewal daemon runs after the certificate has been renewed.",
+			},
+			cli.BoolFlag{
+				Name:  "install",
+				Usage: "Install the root certificate into the system truststore.",
+			},
+			flags.Force,
+		},
+	}
+}
+
+func enrollAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	args := ctx.Args()
+	crtFile, keyFile := args.Get(0), args.Get(1)
+
+	token, err := readEnrollmentToken(ctx)
+	if err != nil {
+		return err
+	}
+	caURL, fingerprint, err := parseEnrollmentToken(token)
+	if err != nil {
+		return err
+	}
+	if s := ctx.String("expires-in"); s != "" {
+		if _, err := time.ParseDuration(s); err != nil {
+			return errs.InvalidFlagValue(ctx, "expires-in", s, "")
+		}
+	}
+
+	// Bootstrap
+	rootFile, err := bootstrap(caURL, fingerprint)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("install") {
+		if err := installRoot(rootFile); err != nil {
+			return err
+		}
+	}
+
+	// First certificate
+	flow := &certificateFlow{}
+	req, pk, err := flow.CreateSignRequest(ctx, token, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := flow.Sign(ctx, token, req.CsrPEM, crtFile); err != nil {
+		return err
+	}
+	ui.PrintSelected("Certificate", crtFile)
+	if _, err := pemutil.Serialize(pk, pemutil.ToFile(keyFile, 0600)); err != nil {
+		return err
+	}
+	ui.PrintSelected("Private Key", keyFile)
+
+	// Renewal configuration
+	crtFile, err = filepath.Abs(crtFile)
+	if err != nil {
+		return errors.Wrapf(err, "error getting absolute path of %s", crtFile)
+	}
+	keyFile, err = filepath.Abs(keyFile)
+	if err != nil {
+		return errors.Wrapf(err, "error getting absolute path of %s", keyFile)
+	}
+	step, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "error getting the path of the step binary")
+	}
+	renewArgs := []string{step, "ca", "renew", "--daemon"}
+	if s := ctx.String("expires-in"); s != "" {
+		renewArgs = append(renewArgs, "--expires-in", s)
+	}
+	if s := ctx.String("exec"); s != "" {
+		renewArgs = append(renewArgs, "--exec", s)
+	}
+	renewArgs = append(renewArgs, crtFile, keyFile)
+
+	unitFile := ctx.String("renew-unit")
+	if unitFile == "" {
+		ui.Println("Run the following command to renew the certificate:")
+		ui.Printf("STEPPATH=%s %s\n", shellQuote(config.StepPath()), strings.Join(quoteAll(renewArgs, shellQuote), " "))
+		return nil
+	}
+
+	unit, err := renewUnit(req.CsrPEM.Subject.CommonName, config.StepPath(), renewArgs)
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFile(unitFile, unit, 0644); err != nil {
+		return err
+	}
+	ui.PrintSelected("Renewal Service", unitFile)
+	ui.Printf("Run 'systemctl daemon-reload && systemctl enable --now %s' to start renewing the certificate.\n", filepath.Base(unitFile))
+	return nil
+}
+
+// readEnrollmentToken returns the token in the --token or --token-file flags.
+func readEnrollmentToken(ctx *cli.Context) (string, error) {
+	token, tokenFile := ctx.String("token"), ctx.String("token-file")
+	switch {
+	case token != "" && tokenFile != "":
+		return "", errs.IncompatibleFlagWithFlag(ctx, "token", "token-file")
+	case token != "":
+		return strings.TrimSpace(token), nil
+	case tokenFile != "":
+		b, err := utils.ReadFile(tokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	default:
+		return "", errs.RequiredOrFlag(ctx, "token", "token-file")
+	}
+}
+
+// parseEnrollmentToken returns the CA URL and the root fingerprint in the
+// given token.
+func parseEnrollmentToken(token string) (string, string, error) {
+	tok, err := jose.ParseSigned(token)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error parsing enrollment token")
+	}
+	var claims tokenClaims
+	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", "", errors.Wrap(err, "error parsing enrollment token")
+	}
+	if claims.SHA == "" {
+		return "", "", errors.New("enrollment token does not contain the root fingerprint; " +
+			"create it with the root certificate available")
+	}
+	if len(claims.Audience) == 0 {
+		return "", "", errors.New("enrollment token does not contain the CA URL")
+	}
+	u, err := url.Parse(claims.Audience[0])
+	if err != nil || u.Host == "" || !strings.EqualFold(u.Scheme, "https") {
+		return "", "", errors.Errorf("enrollment token audience '%s' is not a valid CA URL", claims.Audience[0])
+	}
+	caURL := (&url.URL{Scheme: "https", Host: u.Host}).String()
+	return caURL, claims.SHA, nil
+}
+
+var renewUnitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=Certificate renewal of {{.Name}} with step
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+Environment={{.Env}}
+ExecStart={{.Exec}}
+Restart=on-failure
+RestartSec=10
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// renewUnit returns a systemd service that renews a certificate running the
+// given command.
+func renewUnit(name, stepPath string, args []string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := renewUnitTemplate.Execute(&buf, map[string]string{
+		"Name": strings.Replace(name, "%", "%%", -1),
+		"Env":  systemdQuote("STEPPATH=" + stepPath),
+		"Exec": strings.Join(quoteAll(args, systemdQuote), " "),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating renewal service")
+	}
+	return buf.Bytes(), nil
+}
+
+func quoteAll(args []string, quote func(string) string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quote(arg)
+	}
+	return quoted
+}
+
+// systemdQuote quotes an argument of a systemd unit if necessary.
+func systemdQuote(s string) string {
+	s = strings.Replace(s, "%", "%%", -1)
+	s = strings.Replace(s, "$", "$$", -1)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
+
+// shellQuote quotes an argument of a shell command if necessary.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@%+,", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/api"
-	"github.com/smallstep/certificates/ca"
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/crypto/pki"
@@ -123,7 +122,7 @@ func rootsAndFederationFlow(ctx *cli.Context, typ flowType) error {
 		}
 	}
 
-	client, err := ca.NewClient(caURL, ca.WithRootFile(root))
+	client, err := pki.NewClient(caURL, root)
 	if err != nil {
 		return err
 	}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/smallstep/certificates/ca"
 	"github.com/smallstep/cli/crypto/pki"
 	"github.com/smallstep/cli/errs"
 	"github.com/urfave/cli"
@@ -56,8 +55,6 @@ func healthAction(ctx *cli.Context) error {
 	caURL := ctx.String("ca-url")
 	root := ctx.String("root")
 
-	// Prepare client for bootstrap or provisioning tokens
-	var options []ca.ClientOption
 	if len(caURL) == 0 {
 		return errs.RequiredFlag(ctx, "ca-url")
 	}
@@ -67,9 +64,8 @@ func healthAction(ctx *cli.Context) error {
 			return errs.RequiredFlag(ctx, "root")
 		}
 	}
-	options = append(options, ca.WithRootFile(root))
 
-	client, err := ca.NewClient(caURL, options...)
+	client, err := pki.NewClient(caURL, root)
 	if err != nil {
 		return err
 	}
@@ -9,7 +9,9 @@ import (
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
 	stepx509 "github.com/smallstep/cli/pkg/x509"
 	"github.com/smallstep/cli/ui"
 	"github.com/smallstep/cli/utils"
@@ -22,9 +24,16 @@ func initCommand() cli.Command {
 		Action: cli.ActionFunc(initAction),
 		Usage:  "initialize the CA PKI",
 		UsageText: `**step ca init**
-		[**--root**=<file>] [**--key**=<file>] [**--pki**]`,
+		[**--root**=<file>] [**--key**=<file>] [**--pki**]
+		[**--password-file**=<file>] [**--password-gen**[=<length>]]
+		[**--name-constraint-permit**=<subtree>] [**--name-constraint-exclude**=<subtree>]`,
 		Description: `**step ca init** command initializes a public key infrastructure (PKI) to be
- used by the Certificate Authority`,
+ used by the Certificate Authority.
+
+ The intermediate certificate can be technically constrained using the
+ **--name-constraint-permit** and **--name-constraint-exclude** flags, so the
+ CA can only issue certificates for the permitted names. The DNS names and IP
+ addresses of the CA must be permitted by the constraints.`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:   "root",
@@ -60,6 +69,7 @@ func initCommand() cli.Command {
 				Name:  "password-file",
 				Usage: `The path to the <file> containing the password to encrypt the keys.`,
 			},
+			flags.PasswordGen,
 			cli.StringFlag{
 				Name:  "provisioner-password-file",
 				Usage: `The path to the <file> containing the password to encrypt the provisioner key.`,
@@ -68,6 +78,8 @@ func initCommand() cli.Command {
 				Name:  "with-ca-url",
 				Usage: `<URI> of the Step Certificate Authority to write in defaults.json`,
 			},
+			flags.NameConstraintPermit,
+			flags.NameConstraintExclude,
 		},
 	}
 }
@@ -99,12 +111,15 @@ func initAction(ctx *cli.Context) (err error) {
 		}
 	}
 
-	var password string
-	if passwordFile := ctx.String("password-file"); passwordFile != "" {
-		password, err = utils.ReadStringPasswordFromFile(passwordFile)
-		if err != nil {
-			return err
-		}
+	nc, err := x509util.ParseNameConstraints(ctx.StringSlice("name-constraint-permit"),
+		ctx.StringSlice("name-constraint-exclude"))
+	if err != nil {
+		return err
+	}
+
+	password, err := utils.GetNewPasswordFromCLI(ctx, "password-file")
+	if err != nil {
+		return err
 	}
 
 	// Provisioner password will be equal to the certificate private keys if
@@ -123,14 +138,14 @@ func initAction(ctx *cli.Context) (err error) {
 	}
 
 	name, err := ui.Prompt("What would you like to name your new PKI? (e.g. Smallstep)",
-		ui.WithValidateNotEmpty(), ui.WithValue(ctx.String("name")))
+		ui.WithValidateNotEmpty(), ui.WithValue(ctx.String("name")), ui.WithFlag("name"))
 	if err != nil {
 		return err
 	}
 
 	if configure {
 		names, err := ui.Prompt("What DNS names or IP addresses would you like to add to your new CA? (e.g. ca.smallstep.com[,1.1.1.1,etc.])",
-			ui.WithValidateFunc(ui.DNS()), ui.WithValue(ctx.String("dns")))
+			ui.WithValidateFunc(ui.DNS()), ui.WithValue(ctx.String("dns")), ui.WithFlag("dns"))
 		if err != nil {
 			return err
 		}
@@ -145,13 +160,13 @@ func initAction(ctx *cli.Context) (err error) {
 		}
 
 		address, err := ui.Prompt("What address will your new CA listen at? (e.g. :443)",
-			ui.WithValidateFunc(ui.Address()), ui.WithValue(ctx.String("address")))
+			ui.WithValidateFunc(ui.Address()), ui.WithValue(ctx.String("address")), ui.WithFlag("address"))
 		if err != nil {
 			return err
 		}
 
 		provisioner, err := ui.Prompt("What would you like to name the first provisioner for your new CA? (e.g. you@smallstep.com)",
-			ui.WithValidateNotEmpty(), ui.WithValue(ctx.String("provisioner")))
+			ui.WithValidateNotEmpty(), ui.WithValue(ctx.String("provisioner")), ui.WithFlag("provisioner"))
 		if err != nil {
 			return err
 		}
@@ -163,7 +178,7 @@ func initAction(ctx *cli.Context) (err error) {
 	}
 
 	pass, err := ui.PromptPasswordGenerate("What do you want your password to be? [leave empty and we'll generate one]",
-		ui.WithRichPrompt(), ui.WithValue(password))
+		ui.WithRichPrompt(), ui.WithValue(password), ui.WithFlag("password-file"), ui.WithValidateEntropy())
 	if err != nil {
 		return err
 	}
@@ -204,7 +219,8 @@ func initAction(ctx *cli.Context) (err error) {
 	fmt.Println()
 	fmt.Print("Generating intermediate certificate... \n")
 
-	err = p.GenerateIntermediateCertificate(name+" Intermediate CA", rootCrt, rootKey, pass)
+	err = p.GenerateIntermediateCertificate(name+" Intermediate CA", rootCrt, rootKey, pass,
+		x509util.WithExtensions(&x509util.Extensions{NameConstraints: nc}))
 	if err != nil {
 		return err
 	}
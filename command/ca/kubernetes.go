@@ -0,0 +1,177 @@
+package ca
+
+import (
+	"context"
+	"crypto/x509"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/kubecsr"
+	"github.com/urfave/cli"
+)
+
+func kubernetesCSRCommand() cli.Command {
+	return cli.Command{
+		Name:   "kubernetes-csr",
+		Action: command.ActionFunc(kubernetesCSRAction),
+		Usage:  "sign approved Kubernetes certificate signing requests",
+		UsageText: `**step ca kubernetes-csr**
+		[**--signer-name**=<name>] [**--selector**=<selector>] [**--kubeconfig**=<file>]
+		[**--once**] [**--issuer**=<name>] [**--password-file**=<file>]
+		[**--ca-url**=<uri>] [**--root**=<file>] [**--offline**] [**--ca-config**=<file>]`,
+		Description: `**step ca kubernetes-csr** command watches the CertificateSigningRequest
+objects of a Kubernetes cluster, signs the approved requests using the CA, and
+adds the signed certificates to the status of the requests. It's a lightweight
+alternative to running a controller in the cluster.
+
+Only the requests with the signer name in the **--signer-name** flag, and
+matching the label selector in the **--selector** flag, are signed. The
+requests must be approved in Kubernetes, for example using
+'kubectl certificate approve', and the requests denied are never signed. If a
+request cannot be signed, a Failed condition with the error is added to it.
+
+The requests are signed using a token generated for the subject and SANs of
+each request, so a provisioner and its password must be given if they cannot
+be prompted. The lifetime requested in 'spec.expirationSeconds' is used as the
+validity of the certificate. In offline mode the requests are signed with the
+configuration, certificates, and keys created with **step ca init**.
+
+Running in a pod, the service account of the pod is used if **--kubeconfig** is
+not set. It requires permissions to list, watch and update the status of
+certificatesigningrequests, and to sign for the signer name.
+
+This command requires step to be compiled with the kubernetes build tag.
+
+## EXAMPLES
+
+Sign the approved requests for the signer smallstep.com/step-ca:
+'''
+$ step ca kubernetes-csr --issuer k8s --password-file pass.txt
+'''
+
+Sign the requests with the label app=web, using a different signer name:
+'''
+$ step ca kubernetes-csr --signer-name example.com/web --selector app=web \
+  --issuer k8s --password-file pass.txt
+'''
+
+Sign the requests approved and pending, and exit:
+'''
+$ step ca kubernetes-csr --once --issuer k8s --password-file pass.txt
+'''
+
+Sign the requests using the offline mode:
+'''
+$ step ca kubernetes-csr --offline --issuer k8s --password-file pass.txt
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "signer-name",
+				Usage: "The signer <name> of the requests to sign.",
+				Value: kubecsr.DefaultSignerName,
+			},
+			cli.StringFlag{
+				Name: "l,selector",
+				Usage: `The label <selector> of the requests to sign, e.g. 'app=web' or
+'app in (web,api),env!=dev'.`,
+			},
+			cli.StringFlag{
+				Name: "kubeconfig",
+				Usage: `The kubeconfig <file> used to connect to Kubernetes. By default the service
+account of the pod is used in a cluster, and the default kubeconfig files
+otherwise.`,
+			},
+			cli.BoolFlag{
+				Name:  "once",
+				Usage: "Sign the requests approved and pending, and exit.",
+			},
+			provisionerKidFlag,
+			provisionerIssuerFlag,
+			passwordFileFlag,
+			caURLFlag,
+			rootFlag,
+			offlineFlag,
+			caConfigFlag,
+		},
+	}
+}
+
+func kubernetesCSRAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+
+	client, err := kubecsr.NewClient(ctx.String("kubeconfig"))
+	if err != nil {
+		return err
+	}
+
+	// certificate flow unifies online and offline flows on a single api
+	flow, err := newCertificateFlow(ctx)
+	if err != nil {
+		return err
+	}
+
+	sign := func(csr *x509.CertificateRequest, lifetime time.Duration) ([]*x509.Certificate, error) {
+		// Requests without a common name use the first SAN as the subject.
+		subject, sans := csr.Subject.CommonName, mergeSans(ctx, csr)
+		if subject == "" && len(sans) > 0 {
+			subject = sans[0]
+		}
+		token, err := flow.GenerateToken(ctx, subject, sans)
+		if err != nil {
+			return nil, err
+		}
+		caClient, err := flow.getClient(ctx, subject, token)
+		if err != nil {
+			return nil, err
+		}
+		req := &api.SignRequest{
+			CsrPEM: api.NewCertificateRequest(csr),
+			OTT:    token,
+		}
+		if lifetime > 0 {
+			req.NotAfter = time.Now().Add(lifetime)
+		}
+		resp, err := caClient.Sign(req)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{resp.ServerPEM.Certificate, resp.CaPEM.Certificate}, nil
+	}
+
+	bridge, err := kubecsr.New(client, sign,
+		kubecsr.WithSignerName(ctx.String("signer-name")),
+		kubecsr.WithLabelSelector(ctx.String("selector")),
+		kubecsr.WithLogger(log.New(os.Stderr, "", log.LstdFlags)))
+	if err != nil {
+		return err
+	}
+
+	// The requests to the CA are aborted when the context is canceled.
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pki.SetContext(c)
+
+	if ctx.Bool("once") {
+		_, err := bridge.Sync(c)
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	return bridge.Run(c)
+}
@@ -2,14 +2,19 @@ package ca
 
 import (
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/debug"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/jose"
 	"github.com/smallstep/cli/ui"
@@ -31,10 +36,25 @@ type caClient interface {
 
 // offlineCA is a wrapper on top of the certificates authority methods that is
 // used to sign certificates without an online CA.
+//
+// The authority is only initialized when a certificate is signed or renewed.
+// Generating tokens only requires the configuration, so it works in read-only
+// mode, without opening the database, even if the database is locked by a
+// running step-ca.
 type offlineCA struct {
 	authority  *authority.Authority
 	config     authority.Config
 	configFile string
+	hasDB      bool
+	policies   offlinePolicies
+}
+
+// offlinePolicies contains the name policies of the authority and of the JWK
+// provisioners in ca.json. The policies of the provisioners are indexed by
+// name and key id.
+type offlinePolicies struct {
+	authority    *namePolicy
+	provisioners map[[2]string]*namePolicy
 }
 
 // newOfflineCA initializes an offliceCA.
@@ -53,18 +73,120 @@ func newOfflineCA(configFile string) (*offlineCA, error) {
 		return nil, errors.Errorf("error parsing %s: no provisioners found", configFile)
 	}
 
-	auth, err := authority.New(&config)
+	// Check if the configuration has a database
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", configFile)
+	}
+	db, ok := raw["db"]
+
+	// Initialize the claims of the JWK provisioners with the global claims and
+	// the defaults of the authority. The rest of provisioners are skipped, the
+	// initialization of an OIDC provisioner requires network access.
+	var jwks provisioner.List
+	for _, p := range config.AuthorityConfig.Provisioners {
+		if p.GetType() == provisioner.TypeJWK {
+			jwks = append(jwks, p)
+		}
+	}
+	if len(jwks) > 0 {
+		authConfig := &authority.AuthConfig{
+			Provisioners: jwks,
+			Claims:       config.AuthorityConfig.Claims,
+		}
+		if err := authConfig.Validate(nil); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", configFile)
+		}
+	}
+
+	policies, err := parsePolicies(b)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "error parsing %s", configFile)
 	}
 
 	return &offlineCA{
-		authority:  auth,
 		config:     config,
 		configFile: configFile,
+		hasDB:      ok && string(db) != "null",
+		policies:   policies,
 	}, nil
 }
 
+// parsePolicies returns the name policies of the authority and the JWK
+// provisioners in the given ca.json.
+func parsePolicies(b []byte) (offlinePolicies, error) {
+	var v struct {
+		Authority struct {
+			Policy       *namePolicy `json:"policy"`
+			Provisioners []struct {
+				Type   string          `json:"type"`
+				Name   string          `json:"name"`
+				Key    json.RawMessage `json:"key"`
+				Policy *namePolicy     `json:"policy"`
+			} `json:"provisioners"`
+		} `json:"authority"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return offlinePolicies{}, errors.Wrap(err, "error reading policies")
+	}
+	policies := offlinePolicies{
+		authority:    v.Authority.Policy,
+		provisioners: make(map[[2]string]*namePolicy),
+	}
+	for _, p := range v.Authority.Provisioners {
+		if p.Policy == nil || !strings.EqualFold(p.Type, "jwk") {
+			continue
+		}
+		var key struct {
+			KeyID string `json:"kid"`
+		}
+		if err := json.Unmarshal(p.Key, &key); err != nil {
+			return offlinePolicies{}, errors.Wrapf(err, "error reading the key of provisioner '%s'", p.Name)
+		}
+		policies.provisioners[[2]string{p.Name, key.KeyID}] = p.Policy
+	}
+	return policies, nil
+}
+
+// validateNames returns an error if any of the given names is not allowed by
+// the policy of the authority or by the policy of the JWK provisioner with
+// the given name and key id.
+func (c *offlineCA) validateNames(name, kid string, names []string) error {
+	if err := c.policies.authority.validate("the authority", names); err != nil {
+		return err
+	}
+	return c.policies.provisioners[[2]string{name, kid}].validate("provisioner '"+name+"'", names)
+}
+
+// getAuthority initializes the authority the first time it's called and
+// returns it.
+func (c *offlineCA) getAuthority() (*authority.Authority, error) {
+	if c.authority != nil {
+		return c.authority, nil
+	}
+	auth, err := authority.New(&c.config)
+	if err != nil {
+		if c.hasDB {
+			return nil, errors.Wrapf(err, "error initializing the offline CA using %s: "+
+				"if step-ca is running its database might be locked, stop it or use the online mode", c.configFile)
+		}
+		return nil, errors.Wrapf(err, "error initializing the offline CA using %s", c.configFile)
+	}
+	c.authority = auth
+	return auth, nil
+}
+
+// newOfflineClient initializes an offlineCA using the configuration in the
+// --ca-config flag. It's used by all the commands that support the --offline
+// flag.
+func newOfflineClient(ctx *cli.Context) (*offlineCA, error) {
+	caConfig := ctx.String("ca-config")
+	if caConfig == "" {
+		return nil, errs.InvalidFlagValue(ctx, "ca-config", "", "")
+	}
+	return newOfflineCA(caConfig)
+}
+
 // Audience returns the token audience.
 func (c *offlineCA) Audience() string {
 	return fmt.Sprintf("https://%s/sign", c.config.DNSNames[0])
@@ -80,6 +202,24 @@ func (c *offlineCA) Root() string {
 	return c.config.Root.First()
 }
 
+// Roots returns the root certificates in the configuration.
+func (c *offlineCA) Roots() ([]*x509.Certificate, error) {
+	var roots []*x509.Certificate
+	for _, filename := range c.config.Root {
+		certs, err := pemutil.ReadCertificateBundle(filename)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, certs...)
+	}
+	return roots, nil
+}
+
+// Intermediates returns the intermediate certificates in the configuration.
+func (c *offlineCA) Intermediates() ([]*x509.Certificate, error) {
+	return pemutil.ReadCertificateBundle(c.config.IntermediateCert)
+}
+
 // Provisioners returns the list of configured provisioners.
 func (c *offlineCA) Provisioners() provisioner.List {
 	return c.config.AuthorityConfig.Provisioners
@@ -89,7 +229,11 @@ func (c *offlineCA) Provisioners() provisioner.List {
 // returns an api.SignResponse with the requested certificate and the
 // intermediate.
 func (c *offlineCA) Sign(req *api.SignRequest) (*api.SignResponse, error) {
-	opts, err := c.authority.Authorize(req.OTT)
+	auth, err := c.getAuthority()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := auth.Authorize(req.OTT)
 	if err != nil {
 		return nil, err
 	}
@@ -97,20 +241,24 @@ func (c *offlineCA) Sign(req *api.SignRequest) (*api.SignResponse, error) {
 		NotBefore: req.NotBefore,
 		NotAfter:  req.NotAfter,
 	}
-	cert, ca, err := c.authority.Sign(req.CsrPEM.CertificateRequest, signOpts, opts...)
+	cert, ca, err := auth.Sign(req.CsrPEM.CertificateRequest, signOpts, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return &api.SignResponse{
 		ServerPEM:  api.Certificate{cert},
 		CaPEM:      api.Certificate{ca},
-		TLSOptions: c.authority.GetTLSOptions(),
+		TLSOptions: auth.GetTLSOptions(),
 	}, nil
 }
 
 // Renew is a wrapper on top of certificates Renew method. It returns an
 // api.SignResponse with the requested certificate and the intermediate.
 func (c *offlineCA) Renew(rt http.RoundTripper) (*api.SignResponse, error) {
+	auth, err := c.getAuthority()
+	if err != nil {
+		return nil, err
+	}
 	// it should not panic as this is always internal code
 	tr := rt.(*http.Transport)
 	asn1Data := tr.TLSClientConfig.Certificates[0].Certificate[0]
@@ -118,20 +266,39 @@ func (c *offlineCA) Renew(rt http.RoundTripper) (*api.SignResponse, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "error parsing certificate")
 	}
+	// The authority does not say why a renewal fails, so the disableRenewal
+	// claim of the provisioner that signed the certificate is checked first.
+	if name, kid, ok := certificateProvisioner(peer); ok {
+		if claims, ok := c.provisionerClaims(name, kid); ok && claims.IsDisableRenewal() {
+			return nil, errs.WithCode(errors.Errorf("error renewing certificate: renewals are disabled for provisioner '%s'", name), errs.CodePolicy)
+		}
+	}
 	// renew cert using authority
-	cert, ca, err := c.authority.Renew(peer)
+	cert, ca, err := auth.Renew(peer)
 	if err != nil {
 		return nil, err
 	}
 	return &api.SignResponse{
 		ServerPEM:  api.Certificate{cert},
 		CaPEM:      api.Certificate{ca},
-		TLSOptions: c.authority.GetTLSOptions(),
+		TLSOptions: auth.GetTLSOptions(),
 	}, nil
 }
 
 // GenerateToken creates the token used by the authority to sign certificates.
+// The subject and SANs must be allowed by the policies of the authority and of
+// the provisioner.
 func (c *offlineCA) GenerateToken(ctx *cli.Context, subject string, sans []string) (string, error) {
+	signer, err := c.tokenSigner(ctx)
+	if err != nil {
+		return "", err
+	}
+	return signer.Token(ctx, subject, sans)
+}
+
+// tokenSigner returns a tokenSigner with the decrypted key of one of the JWK
+// provisioners in the configuration.
+func (c *offlineCA) tokenSigner(ctx *cli.Context) (*tokenSigner, error) {
 	// Use ca.json configuration for the root and audience
 	root := c.Root()
 	audience := c.Audience()
@@ -140,7 +307,7 @@ func (c *offlineCA) GenerateToken(ctx *cli.Context, subject string, sans []strin
 	passwordFile := ctx.String("password-file")
 	notBefore, notAfter, err := parseValidity(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Get provisioner to use
@@ -161,7 +328,7 @@ func (c *offlineCA) GenerateToken(ctx *cli.Context, subject string, sans []strin
 			return false
 		})
 		if len(provisioners) == 0 {
-			return "", errs.InvalidFlagValue(ctx, "kid", kid, "")
+			return nil, errs.InvalidFlagValue(ctx, "kid", kid, "")
 		}
 	}
 
@@ -171,7 +338,7 @@ func (c *offlineCA) GenerateToken(ctx *cli.Context, subject string, sans []strin
 			return p.GetName() == issuer
 		})
 		if len(provisioners) == 0 {
-			return "", errs.InvalidFlagValue(ctx, "issuer", issuer, "")
+			return nil, errs.InvalidFlagValue(ctx, "issuer", issuer, "")
 		}
 	}
 
@@ -191,36 +358,139 @@ func (c *offlineCA) GenerateToken(ctx *cli.Context, subject string, sans []strin
 				EncryptedKey: p.EncryptedKey,
 			})
 		}
-		i, _, err := ui.Select("What provisioner key do you want to use?", items, ui.WithSelectTemplates(ui.NamedSelectTemplates("Key ID")))
+		i, _, err := ui.Select("What provisioner key do you want to use?", items, ui.WithSelectTemplates(ui.NamedSelectTemplates("Key ID")), ui.WithFlag("kid"))
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		kid = items[i].Kid
 		issuer = items[i].Issuer
 		encryptedKey = items[i].EncryptedKey
 	}
 
+	// Fail before asking for the password if the claims of the provisioner
+	// don't allow the requested validity.
+	if err := c.validateClaims(issuer, kid, notBefore, notAfter); err != nil {
+		return nil, err
+	}
+
 	// Decrypt encrypted key
 	opts := []jose.Option{
-		jose.WithUIOptions(ui.WithPromptTemplates(ui.PromptTemplates())),
+		jose.WithUIOptions(ui.WithPromptTemplates(ui.PromptTemplates()), ui.WithFlag("password-file")),
 	}
 	if len(passwordFile) != 0 {
 		opts = append(opts, jose.WithPasswordFile(passwordFile))
 	}
 
 	if len(encryptedKey) == 0 {
-		return "", errors.Errorf("provisioner '%s' does not have an 'encryptedKey' property", kid)
+		return nil, errors.Errorf("provisioner '%s' does not have an 'encryptedKey' property", kid)
 	}
 
 	decrypted, err := jose.Decrypt("Please enter the password to decrypt the provisioner key", []byte(encryptedKey), opts...)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	jwk := new(jose.JSONWebKey)
 	if err := json.Unmarshal(decrypted, jwk); err != nil {
-		return "", errors.Wrap(err, "error unmarshalling provisioning key")
+		return nil, errors.Wrap(err, "error unmarshalling provisioning key")
 	}
 
-	return generateToken(subject, sans, kid, issuer, audience, root, notBefore, notAfter, jwk)
+	return &tokenSigner{
+		kid:       kid,
+		issuer:    issuer,
+		audience:  audience,
+		root:      root,
+		notBefore: notBefore,
+		notAfter:  notAfter,
+		jwk:       jwk,
+		validateNames: func(names []string) error {
+			return c.validateNames(issuer, kid, names)
+		},
+	}, nil
+}
+
+// oidStepProvisioner is the OID of the certificate extension with the
+// provisioner that authorized the certificate.
+var oidStepProvisioner = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}
+
+// stepProvisionerASN1 is the value of the provisioner extension.
+type stepProvisionerASN1 struct {
+	Type         int
+	Name         []byte
+	CredentialID []byte
+}
+
+// validateValidity returns an error if the certificate validity requested
+// with the --not-before and --not-after flags is not allowed by the claims of
+// the provisioner with the given name. A zero notAfter uses the default
+// duration of the provisioner.
+func validateValidity(claims *provisioner.Claims, name string, notBefore, notAfter time.Time) error {
+	if notAfter.IsZero() {
+		return nil
+	}
+	if notBefore.IsZero() {
+		notBefore = time.Now()
+	}
+	d := notAfter.Sub(notBefore)
+	switch {
+	case d < claims.MinTLSCertDuration():
+		return errs.WithCode(errors.Errorf("requested certificate duration %s is shorter than the minimum %s allowed by provisioner '%s'",
+			d.Round(time.Second), claims.MinTLSCertDuration(), name), errs.CodePolicy)
+	case d > claims.MaxTLSCertDuration():
+		return errs.WithCode(errors.Errorf("requested certificate duration %s is longer than the maximum %s allowed by provisioner '%s'",
+			d.Round(time.Second), claims.MaxTLSCertDuration(), name), errs.CodePolicy)
+	default:
+		return nil
+	}
+}
+
+// provisionerClaims returns the claims of the JWK provisioner with the given
+// name and key id. The claims are initialized by newOfflineCA, the ones not
+// set in the provisioner use the global claims and the defaults of the
+// authority.
+func (c *offlineCA) provisionerClaims(name, kid string) (*provisioner.Claims, bool) {
+	for _, p := range c.Provisioners() {
+		if p, ok := p.(*provisioner.JWK); ok && p.Name == name && p.Key != nil && p.Key.KeyID == kid && p.Claims != nil {
+			return p.Claims, true
+		}
+	}
+	return nil, false
+}
+
+// validateClaims returns an error if the certificate validity requested with
+// the --not-before and --not-after flags is not allowed by the claims of the
+// given provisioner, so the request fails before the authority rejects it.
+// If the provisioner does not allow renewals a warning is printed. The claims
+// are logged if the verbose logs are enabled.
+func (c *offlineCA) validateClaims(name, kid string, notBefore, notAfter time.Time) error {
+	claims, ok := c.provisionerClaims(name, kid)
+	if !ok {
+		return errors.Errorf("provisioner '%s' with key id '%s' not found", name, kid)
+	}
+	debug.Log(debug.LevelVerbose, "provisioner claims", "provisioner", name,
+		"minTLSCertDuration", claims.MinTLSCertDuration(), "maxTLSCertDuration", claims.MaxTLSCertDuration(),
+		"defaultTLSCertDuration", claims.DefaultTLSCertDuration(), "disableRenewal", claims.IsDisableRenewal())
+	if err := validateValidity(claims, name, notBefore, notAfter); err != nil {
+		return err
+	}
+	if claims.IsDisableRenewal() {
+		ui.Printf("Provisioner '%s' does not allow renewals, a new certificate must be requested before it expires.\n", name)
+	}
+	return nil
+}
+
+// certificateProvisioner returns the name and the key id of the provisioner
+// in the provisioner extension of the given certificate.
+func certificateProvisioner(cert *x509.Certificate) (name, kid string, ok bool) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidStepProvisioner) {
+			continue
+		}
+		var p stepProvisionerASN1
+		if _, err := asn1.Unmarshal(ext.Value, &p); err != nil {
+			return "", "", false
+		}
+		return string(p.Name), string(p.CredentialID), true
+	}
+	return "", "", false
 }
@@ -0,0 +1,215 @@
+package ca
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/cli/errs"
+)
+
+const testOfflineConfig = `{
+	"root": "root_ca.crt",
+	"crt": "intermediate_ca.crt",
+	"key": "intermediate_ca_key",
+	"address": ":443",
+	"dnsNames": ["ca.smallstep.com"],
+	"authority": {
+		"claims": {
+			"maxTLSCertDuration": "48h"
+		},
+		"provisioners": [{
+			"type": "JWK",
+			"name": "default",
+			"key": {"kty": "EC", "crv": "P-256", "kid": "default-kid",
+				"x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4",
+				"y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"}
+		}, {
+			"type": "JWK",
+			"name": "short",
+			"key": {"kty": "EC", "crv": "P-256", "kid": "short-kid",
+				"x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4",
+				"y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"},
+			"claims": {
+				"minTLSCertDuration": "1m",
+				"maxTLSCertDuration": "1h",
+				"defaultTLSCertDuration": "30m",
+				"disableRenewal": true
+			}
+		}]
+	}
+}`
+
+func mustOfflineCA(t *testing.T, config string) *offlineCA {
+	dir, err := ioutil.TempDir("", "step-offline")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "ca.json")
+	assert.FatalError(t, ioutil.WriteFile(filename, []byte(config), 0600))
+	c, err := newOfflineCA(filename)
+	assert.FatalError(t, err)
+	return c
+}
+
+func TestOfflineCA_provisionerClaims(t *testing.T) {
+	c := mustOfflineCA(t, testOfflineConfig)
+
+	type want struct {
+		min, max, def  time.Duration
+		disableRenewal bool
+	}
+	tests := map[string]struct {
+		name, kid string
+		ok        bool
+		want      want
+	}{
+		"global":        {"default", "default-kid", true, want{5 * time.Minute, 48 * time.Hour, 24 * time.Hour, false}},
+		"provisioner":   {"short", "short-kid", true, want{time.Minute, time.Hour, 30 * time.Minute, true}},
+		"fail-name":     {"foo", "default-kid", false, want{}},
+		"fail-kid":      {"short", "default-kid", false, want{}},
+		"fail-no-match": {"", "", false, want{}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims, ok := c.provisionerClaims(tc.name, tc.kid)
+			assert.Equals(t, tc.ok, ok)
+			if !ok {
+				assert.Nil(t, claims)
+				return
+			}
+			assert.Equals(t, tc.want.min, claims.MinTLSCertDuration())
+			assert.Equals(t, tc.want.max, claims.MaxTLSCertDuration())
+			assert.Equals(t, tc.want.def, claims.DefaultTLSCertDuration())
+			assert.Equals(t, tc.want.disableRenewal, claims.IsDisableRenewal())
+		})
+	}
+}
+
+func TestNewOfflineCA_invalidClaims(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-offline")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "ca.json")
+	assert.FatalError(t, ioutil.WriteFile(filename, []byte(`{
+	"dnsNames": ["ca.smallstep.com"],
+	"authority": {
+		"claims": {"minTLSCertDuration": "48h"},
+		"provisioners": [{
+			"type": "JWK",
+			"name": "default",
+			"key": {"kty": "EC", "crv": "P-256", "kid": "default-kid",
+				"x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4",
+				"y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"}
+		}]
+	}
+}`), 0600))
+	_, err = newOfflineCA(filename)
+	assert.Error(t, err)
+}
+
+func TestValidateValidity(t *testing.T) {
+	c := mustOfflineCA(t, testOfflineConfig)
+	claims, ok := c.provisionerClaims("short", "short-kid")
+	if !ok {
+		t.Fatal("provisioner short not found")
+	}
+
+	now := time.Now()
+	tests := map[string]struct {
+		notBefore, notAfter time.Time
+		wantErr             bool
+	}{
+		"default":         {time.Time{}, time.Time{}, false},
+		"default-after":   {now.Add(time.Hour), time.Time{}, false},
+		"ok":              {now, now.Add(30 * time.Minute), false},
+		"ok-min":          {now, now.Add(time.Minute), false},
+		"ok-max":          {now, now.Add(time.Hour), false},
+		"ok-not-before":   {now.Add(24 * time.Hour), now.Add(25 * time.Hour), false},
+		"ok-now":          {time.Time{}, now.Add(30 * time.Minute), false},
+		"fail-min":        {now, now.Add(30 * time.Second), true},
+		"fail-max":        {now, now.Add(2 * time.Hour), true},
+		"fail-now-max":    {time.Time{}, now.Add(2 * time.Hour), true},
+		"fail-not-before": {now.Add(24 * time.Hour), now.Add(24*time.Hour + time.Second), true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateValidity(claims, "short", tc.notBefore, tc.notAfter)
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Equals(t, errs.CodePolicy, errs.GetCode(err))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateValidity_defaults(t *testing.T) {
+	claims, err := (&provisioner.Claims{}).Init(&provisioner.Claims{
+		MinTLSDur:     &provisioner.Duration{Duration: 5 * time.Minute},
+		MaxTLSDur:     &provisioner.Duration{Duration: 24 * time.Hour},
+		DefaultTLSDur: &provisioner.Duration{Duration: 24 * time.Hour},
+	})
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	assert.NoError(t, validateValidity(claims, "default", now, now.Add(24*time.Hour)))
+	assert.Error(t, validateValidity(claims, "default", now, now.Add(24*time.Hour+time.Minute)))
+	assert.Error(t, validateValidity(claims, "default", now, now.Add(time.Minute)))
+}
+
+func TestOfflineCA_validateNames(t *testing.T) {
+	c := mustOfflineCA(t, `{
+	"dnsNames": ["ca.smallstep.com"],
+	"authority": {
+		"policy": {"x509": {"deny": {"dns": ["*.internal.example.com"]}}},
+		"provisioners": [{
+			"type": "JWK",
+			"name": "default",
+			"key": {"kty": "EC", "crv": "P-256", "kid": "default-kid",
+				"x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4",
+				"y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"}
+		}, {
+			"type": "JWK",
+			"name": "web",
+			"key": {"kty": "EC", "crv": "P-256", "kid": "web-kid",
+				"x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4",
+				"y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"},
+			"policy": {"x509": {"allow": {"dns": ["*.example.com"], "ip": ["10.0.0.0/8"]}}}
+		}]
+	}
+}`)
+
+	tests := map[string]struct {
+		name, kid string
+		names     []string
+		err       string
+	}{
+		"ok":                  {"web", "web-kid", []string{"www.example.com", "10.0.1.10"}, ""},
+		"ok-no-policy":        {"default", "default-kid", []string{"www.smallstep.com"}, ""},
+		"fail-not-allowed":    {"web", "web-kid", []string{"www.example.com", "www.smallstep.com"}, "name 'www.smallstep.com' is not allowed by the policy of provisioner 'web'"},
+		"fail-type":           {"web", "web-kid", []string{"jane@example.com"}, "name 'jane@example.com' is not allowed by the policy of provisioner 'web'"},
+		"fail-ip":             {"web", "web-kid", []string{"192.168.0.1"}, "name '192.168.0.1' is not allowed by the policy of provisioner 'web'"},
+		"fail-authority":      {"web", "web-kid", []string{"db.internal.example.com"}, "name 'db.internal.example.com' is denied by the policy of the authority"},
+		"fail-authority-only": {"default", "default-kid", []string{"db.internal.example.com"}, "name 'db.internal.example.com' is denied by the policy of the authority"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := c.validateNames(tc.name, tc.kid, tc.names)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equals(t, tc.err, err.Error())
+				assert.Equals(t, errs.CodePolicy, errs.GetCode(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package ca
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+)
+
+// namePolicy is the policy of the names that can be in the certificates of a
+// provisioner or of the authority, in the "policy" property of ca.json. It's
+// used by the offline CA to reject a token before the CA rejects the
+// certificate signing request.
+type namePolicy struct {
+	X509 *x509Policy `json:"x509"`
+}
+
+// x509Policy contains the allowed and denied names of the X.509 certificates.
+// If a name matches a denied name it is rejected. If there are allowed names,
+// every name must match one of the allowed names of its type.
+type x509Policy struct {
+	Allow *x509NameOptions `json:"allow"`
+	Deny  *x509NameOptions `json:"deny"`
+}
+
+// x509NameOptions is a list of names by type. DNS names and URI hosts can use
+// a wildcard, like '*.example.com', to match any subdomain. IPs can be ranges
+// in CIDR notation, and emails a domain, like '@example.com'.
+type x509NameOptions struct {
+	DNSDomains     []string `json:"dns"`
+	IPRanges       []string `json:"ip"`
+	EmailAddresses []string `json:"email"`
+	URIDomains     []string `json:"uri"`
+}
+
+// isEmpty returns true if the options do not contain any name.
+func (o *x509NameOptions) isEmpty() bool {
+	return o == nil || len(o.DNSDomains)+len(o.IPRanges)+len(o.EmailAddresses)+len(o.URIDomains) == 0
+}
+
+// matches returns true if the given name matches one of the names in the
+// options of its type.
+func (o *x509NameOptions) matches(name string) bool {
+	if o == nil {
+		return false
+	}
+	switch {
+	case net.ParseIP(name) != nil:
+		ip := net.ParseIP(name)
+		for _, r := range o.IPRanges {
+			if matchIP(ip, r) {
+				return true
+			}
+		}
+	case strings.Contains(name, "://"):
+		u, err := url.Parse(name)
+		if err != nil {
+			return false
+		}
+		for _, d := range o.URIDomains {
+			if matchDomain(u.Hostname(), d) {
+				return true
+			}
+		}
+	case strings.Contains(name, "@"):
+		for _, e := range o.EmailAddresses {
+			if matchEmail(name, e) {
+				return true
+			}
+		}
+	default:
+		for _, d := range o.DNSDomains {
+			if matchDomain(name, d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validate returns an error if any of the given names is not allowed by the
+// policy. The owner is used in the errors, e.g. "provisioner 'admin'".
+func (p *namePolicy) validate(owner string, names []string) error {
+	if p == nil || p.X509 == nil {
+		return nil
+	}
+	for _, name := range x509util.NormalizeSANs(names) {
+		if p.X509.Deny.matches(name) {
+			return errs.WithCode(errors.Errorf("name '%s' is denied by the policy of %s", name, owner), errs.CodePolicy)
+		}
+		if !p.X509.Allow.isEmpty() && !p.X509.Allow.matches(name) {
+			return errs.WithCode(errors.Errorf("name '%s' is not allowed by the policy of %s", name, owner), errs.CodePolicy)
+		}
+	}
+	return nil
+}
+
+// matchDomain returns true if the domain matches the pattern. A pattern like
+// '*.example.com' matches any subdomain of example.com, but not example.com.
+// Domains are compared in punycode and ignoring the case.
+func matchDomain(domain, pattern string) bool {
+	if d, err := x509util.NormalizeDNSName(domain); err == nil {
+		domain = d
+	}
+	if p, err := x509util.NormalizeDNSName(pattern); err == nil {
+		pattern = p
+	}
+	domain, pattern = strings.ToLower(domain), strings.ToLower(pattern)
+	if strings.HasPrefix(pattern, "*.") {
+		return len(domain) > len(pattern)-1 && strings.HasSuffix(domain, pattern[1:])
+	}
+	return domain == pattern
+}
+
+// matchIP returns true if the ip is the given one, or it is in the given
+// range in CIDR notation.
+func matchIP(ip net.IP, pattern string) bool {
+	if strings.Contains(pattern, "/") {
+		_, ipNet, err := net.ParseCIDR(pattern)
+		return err == nil && ipNet.Contains(ip)
+	}
+	return ip.Equal(net.ParseIP(pattern))
+}
+
+// matchEmail returns true if the email is the given one, or if the pattern
+// is a domain, like '@example.com' or 'example.com', if the email is in that
+// domain.
+func matchEmail(email, pattern string) bool {
+	if strings.Contains(pattern, "@") && !strings.HasPrefix(pattern, "@") {
+		return strings.EqualFold(email, pattern)
+	}
+	i := strings.LastIndex(email, "@")
+	return matchDomain(email[i+1:], strings.TrimPrefix(pattern, "@"))
+}
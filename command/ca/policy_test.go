@@ -0,0 +1,66 @@
+package ca
+
+import (
+	"net"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestMatchDomain(t *testing.T) {
+	tests := []struct {
+		domain, pattern string
+		want            bool
+	}{
+		{"example.com", "example.com", true},
+		{"EXAMPLE.com", "example.COM", true},
+		{"www.example.com", "*.example.com", true},
+		{"a.b.example.com", "*.example.com", true},
+		{"xn--bcher-kva.example.com", "bücher.example.com", true},
+		{"example.com", "*.example.com", false},
+		{"wwwexample.com", "*.example.com", false},
+		{"www.example.com", "example.com", false},
+	}
+	for _, tc := range tests {
+		assert.Equals(t, tc.want, matchDomain(tc.domain, tc.pattern), tc.domain+" "+tc.pattern)
+	}
+}
+
+func TestMatchIP(t *testing.T) {
+	assert.True(t, matchIP(net.ParseIP("10.0.0.1"), "10.0.0.1"))
+	assert.True(t, matchIP(net.ParseIP("10.1.2.3"), "10.0.0.0/8"))
+	assert.True(t, matchIP(net.ParseIP("2001:db8::1"), "2001:db8::/32"))
+	assert.False(t, matchIP(net.ParseIP("10.0.0.2"), "10.0.0.1"))
+	assert.False(t, matchIP(net.ParseIP("11.0.0.1"), "10.0.0.0/8"))
+	assert.False(t, matchIP(net.ParseIP("10.0.0.1"), "foo/8"))
+}
+
+func TestMatchEmail(t *testing.T) {
+	assert.True(t, matchEmail("jane@example.com", "jane@example.com"))
+	assert.True(t, matchEmail("Jane@example.com", "jane@EXAMPLE.com"))
+	assert.True(t, matchEmail("jane@example.com", "@example.com"))
+	assert.True(t, matchEmail("jane@example.com", "example.com"))
+	assert.False(t, matchEmail("joe@example.com", "jane@example.com"))
+	assert.False(t, matchEmail("jane@smallstep.com", "@example.com"))
+}
+
+func TestX509NameOptions_matches(t *testing.T) {
+	o := &x509NameOptions{
+		DNSDomains:     []string{"*.example.com"},
+		IPRanges:       []string{"10.0.0.0/8"},
+		EmailAddresses: []string{"@example.com"},
+		URIDomains:     []string{"*.example.com"},
+	}
+	assert.True(t, o.matches("www.example.com"))
+	assert.True(t, o.matches("10.0.0.1"))
+	assert.True(t, o.matches("jane@example.com"))
+	assert.True(t, o.matches("spiffe://web.example.com/service"))
+	assert.False(t, o.matches("www.smallstep.com"))
+	assert.False(t, o.matches("192.168.0.1"))
+	assert.False(t, o.matches("spiffe://example.com/service"))
+
+	var empty *x509NameOptions
+	assert.True(t, empty.isEmpty())
+	assert.False(t, empty.matches("www.example.com"))
+	assert.False(t, o.isEmpty())
+}
@@ -26,7 +26,8 @@ func addCommand() cli.Command {
 		Action: cli.ActionFunc(addAction),
 		Usage:  "add one or more provisioners the CA configuration",
 		UsageText: `**step ca provisioner add** <name> <jwk-file> [<jwk-file> ...]
-		[**--ca-config**=<file>] [**--create**] [**--password-file**=<file>]`,
+		[**--ca-config**=<file>] [**--create**] [**--password-file**=<file>]
+		[**--password-gen**[=<length>]]`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "ca-config",
@@ -73,6 +74,7 @@ will not have restrictions in the certificates to sign. Use the
 Use the '--domain' flag multiple times to configure multiple domains.`,
 			},
 			flags.PasswordFile,
+			flags.PasswordGen,
 		},
 		Description: `**step ca provisioner add** adds one or more provisioners
 to the configuration and writes the new configuration back to the CA config.
@@ -99,6 +101,13 @@ $ step ca provisioner add max@smallstep.com --ca-config ca.json \
 --create
 '''
 
+Add a single JWK provisioner using an auto-generated asymmetric key pair
+encrypted with a random passphrase that is written to a file:
+'''
+$ step ca provisioner add max@smallstep.com --ca-config ca.json \
+--create --password-gen --password-file max.pass
+'''
+
 Add a list of provisioners for a single name:
 '''
 $ step ca provisioner add max@smallstep.com ./max-laptop.jwk ./max-phone.pem ./max-work.pem \
@@ -171,19 +180,15 @@ func addAction(ctx *cli.Context) (err error) {
 }
 
 func addJWKProvider(ctx *cli.Context, name string, provMap map[string]bool) (list provisioner.List, err error) {
-	var password string
-	if passwordFile := ctx.String("password-file"); len(passwordFile) > 0 {
-		password, err = utils.ReadStringPasswordFromFile(passwordFile)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	if ctx.Bool("create") {
 		if ctx.NArg() > 1 {
 			return nil, errs.IncompatibleFlag(ctx, "create", "<jwk-path> positional arg")
 		}
-		pass, err := ui.PromptPasswordGenerate("Please enter a password to encrypt the provisioner private key? [leave empty and we'll generate one]", ui.WithValue(password))
+		password, err := utils.GetNewPasswordFromCLI(ctx, "password-file")
+		if err != nil {
+			return nil, err
+		}
+		pass, err := ui.PromptPasswordGenerate("Please enter a password to encrypt the provisioner private key? [leave empty and we'll generate one]", ui.WithValue(password), ui.WithFlag("password-file"), ui.WithValidateEntropy())
 		if err != nil {
 			return nil, err
 		}
@@ -214,6 +219,9 @@ func addJWKProvider(ctx *cli.Context, name string, provMap map[string]bool) (lis
 	}
 
 	// Add multiple provisioners using JWK files.
+	if ctx.IsSet("password-gen") {
+		return nil, errs.RequiredWithFlag(ctx, "password-gen", "create")
+	}
 	if ctx.NArg() < 2 {
 		return nil, errs.TooFewArguments(ctx)
 	}
@@ -3,8 +3,13 @@ package provisioner
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/crypto/pki"
 	"github.com/smallstep/cli/errs"
 	"github.com/urfave/cli"
@@ -13,10 +18,11 @@ import (
 func listCommand() cli.Command {
 	return cli.Command{
 		Name:   "list",
-		Action: cli.ActionFunc(listAction),
+		Action: command.ActionFunc(listAction),
 		Usage:  "list provisioners configured in the CA",
 		UsageText: `**step ca provisioner list** [**--ca-url**=<uri>]
-[**--root**=<file>]`,
+[**--root**=<file>] [**--type**=<type>] [**--name**=<name>] [**--kid**=<kid>]
+[**--format**=<format>]`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "ca-url",
@@ -26,15 +32,56 @@ func listCommand() cli.Command {
 				Name:  "root",
 				Usage: "The path to the PEM <file> used as the root certificate authority.",
 			},
+			cli.StringFlag{
+				Name: "type",
+				Usage: `List only the provisioners of the given <type>, e.g. **JWK**, **OIDC**, **AWS**,
+**GCP** or **Azure**. The type is case-insensitive.`,
+			},
+			cli.StringFlag{
+				Name:  "name",
+				Usage: "List only the provisioners with the given <name>, the issuer of their tokens.",
+			},
+			cli.StringFlag{
+				Name:  "kid",
+				Usage: "List only the JWK provisioners with the given key id <kid>.",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "json",
+				Usage: `The output <format> of the list.
+
+: <format> is a case-sensitive string and must be one of:
+
+    **json**
+    :  A JSON list with the configuration of the provisioners (default).
+
+    **table**
+    :  A table with the name, the type and the key id or client id of the
+    provisioners.`,
+			},
 		},
 		Description: `**step ca provisioner list** lists the provisioners configured
-in the CA.
+in the CA. The provisioners are requested to the online CA, so operators can
+discover the values to use in the **--issuer** and **--kid** flags of
+**step ca token** without access to the CA configuration.
 
 ## EXAMPLES
 
 Prints a JSON list with active provisioners:
 '''
 $ step ca provisioner list
+'''
+
+Prints a table with the JWK provisioners:
+'''
+$ step ca provisioner list --type jwk --format table
+NAME                TYPE  ID
+admin@example.com   JWK   4vn46fbZT68Uxfs9LBwHkTvrjEvxQqx-W8nnE-qDjts
+'''
+
+Prints the provisioner that uses a given key id:
+'''
+$ step ca provisioner list --kid 4vn46fbZT68Uxfs9LBwHkTvrjEvxQqx-W8nnE-qDjts
 '''`,
 	}
 }
@@ -50,12 +97,40 @@ func listAction(ctx *cli.Context) error {
 		return errs.RequiredFlag(ctx, "ca-url")
 	}
 
+	format := ctx.String("format")
+	switch format {
+	case "json", "table":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "json, table")
+	}
+
 	provisioners, err := pki.GetProvisioners(caURL, root)
 	if err != nil {
 		return errors.Wrap(err, "error getting the provisioners")
 	}
 
-	b, err := json.MarshalIndent(provisioners, "", "   ")
+	typ, name, kid := ctx.String("type"), ctx.String("name"), ctx.String("kid")
+	list := provisioner.List{}
+	for _, p := range provisioners {
+		switch {
+		case typ != "" && !strings.EqualFold(p.GetType().String(), typ):
+		case name != "" && p.GetName() != name:
+		case kid != "" && !hasKeyID(p, kid):
+		default:
+			list = append(list, p)
+		}
+	}
+
+	if format == "table" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTYPE\tID")
+		for _, p := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", p.GetName(), p.GetType(), provisionerID(p))
+		}
+		return w.Flush()
+	}
+
+	b, err := json.MarshalIndent(list, "", "   ")
 	if err != nil {
 		return errors.Wrap(err, "error marshaling provisioners")
 	}
@@ -63,3 +138,25 @@ func listAction(ctx *cli.Context) error {
 	fmt.Println(string(b))
 	return nil
 }
+
+// hasKeyID returns true if p is a JWK provisioner with the given key id.
+func hasKeyID(p provisioner.Interface, kid string) bool {
+	if pp, ok := p.(*provisioner.JWK); ok {
+		return pp.Key.KeyID == kid
+	}
+	return false
+}
+
+// provisionerID returns the value used to select the provisioner in
+// **step ca token**, the key id of JWK provisioners or the client id of OIDC
+// provisioners.
+func provisionerID(p provisioner.Interface) string {
+	switch pp := p.(type) {
+	case *provisioner.JWK:
+		return pp.Key.KeyID
+	case *provisioner.OIDC:
+		return pp.ClientID
+	default:
+		return ""
+	}
+}
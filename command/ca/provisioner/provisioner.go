@@ -1,6 +1,9 @@
 package provisioner
 
-import "github.com/urfave/cli"
+import (
+	"github.com/smallstep/cli/command"
+	"github.com/urfave/cli"
+)
 
 // Command returns the jwk subcommand.
 func Command() cli.Command {
@@ -9,7 +12,7 @@ func Command() cli.Command {
 		Usage:     "create and manage the certificate authority provisioners",
 		UsageText: "step ca provisioner <subcommand> [arguments] [global-flags] [subcommand-flags]",
 		Subcommands: cli.Commands{
-			listCommand(),
+			command.StructuredOutput(listCommand()),
 			getEncryptedKeyCommand(),
 			addCommand(),
 			removeCommand(),
@@ -1,15 +1,18 @@
 package ca
 
 import (
+	"crypto"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -20,10 +23,12 @@ import (
 	"github.com/smallstep/certificates/ca"
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pkcs12util"
 	"github.com/smallstep/cli/crypto/pki"
 	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/sds"
 	"github.com/smallstep/cli/ui"
 	"github.com/smallstep/cli/utils"
 	"github.com/urfave/cli"
@@ -34,9 +39,15 @@ func renewCertificateCommand() cli.Command {
 		Name:   "renew",
 		Action: command.ActionFunc(renewCertificateAction),
 		Usage:  "renew a valid certificate",
-		UsageText: `**step ca renew** <crt-file> <key-file>
-		[**--ca-url**=<uri>] [**--root**=<file>]
-		[**--out**=<file>] [**--expires-in**=<duration>] [**--force**]`,
+		UsageText: `**step ca renew** <crt-file> [<key-file>]
+		[**--ca-url**=<uri>] [**--root**=<file>] [**--fingerprint**=<fingerprint>]
+		[**--password-file**=<file>]
+		[**--out**=<file>] [**--expires-in**=<duration>] [**--force**]
+		[**--vault**=<mount/path>] [**--vault-role**=<role>] [**--vault-auth-mount**=<path>]
+		[**--aws-secret**=<name>] [**--aws-parameter**=<path>]
+		[**--aws-kms-key**=<key>] [**--aws-region**=<region>] [**--aws-profile**=<profile>]
+		[**--daemon**] [**--sds-listen**=<address>]
+		[**--docker-registry**=<host[:port]>] [**--docker-certs-dir**=<directory>]`,
 		Description: `
 **step ca renew** command renews the given certificate (with a request to the
 certificate authority) and writes the new certificate to disk - either overwriting
@@ -50,15 +61,54 @@ certificate expiration can be configured using the **--expires-in** flag, or a
 fixed period can be set with the **--renew-period** flag.
 
 The **--daemon** flag can be combined with **--pid**, **--signal**, or **--exec**
-to provide certificate reloads on your services.
+to provide certificate reloads on your services. To provide certificates to
+Envoy, the **--sds-listen** flag serves the certificate and key over the Envoy
+Secret Discovery Service API, and Envoy gets the renewed certificate without
+reloading files.
+
+If the <key-file> is encrypted, the password is read from the
+**--password-file** flag, or it is prompted before the first renewal.
+
+The certificate and key can also be read from a PKCS#12 file (with a .p12 or
+.pfx extension). In this case the <key-file> must not be given, and the password
+of the container can be passed with the **--password-file** flag. The renewed
+certificate, its chain, and the key are written back to the PKCS#12 file with
+the same password, or in PEM format to the file specified with the **--out**
+flag.
+
+On macOS, the certificate and key can also be an identity in the Keychain using
+a Keychain URI like 'keychain:label=<label>' as <crt-file>. In this case the
+<key-file> must not be given, and the renewed certificate is imported into the
+Keychain, and written to the file specified with the **--out** flag if it's
+set. A Keychain URI can also be used as <key-file> to renew a certificate file
+with a key stored in the Keychain.
+
+On Windows, the same applies to certificate store URIs like
+'capi:friendly-name=<name>;store-location=machine'. The renewed certificate is
+added to the store, and the previous one is archived and marked as renewed by
+the new one.
+
+With the **--vault** flag the renewed certificate is written to the given
+secret in HashiCorp Vault, instead of overwriting <crt-file>. The same applies
+to AWS Secrets Manager secrets with the **--aws-secret** flag, and to AWS
+Parameter Store parameters with the **--aws-parameter** flag. The private key
+already in the secret is kept. The certificate is also written to a file if
+the **--out** flag is used.
+
+With the **--docker-registry** flag the client certificate of a private
+registry, in the directory used by Docker and other OCI clients, is renewed.
+In this case <crt-file> and <key-file> must not be given. Combined with the
+**--daemon** flag the certificate is rotated without manual intervention.
 
 ## POSITIONAL ARGUMENTS
 
 <crt-file>
-:  The certificate in PEM format that we want to renew.
+:  The certificate in PEM format, the PKCS#12 file, or the Keychain or Windows
+certificate store identity that we want to renew.
 
 <key-file>
-:  They key file of the certificate.
+:  They key file of the certificate. Not used with PKCS#12 files or identities
+in a store.
 
 ## EXAMPLES
 
@@ -118,14 +168,59 @@ $ step ca renew --daemon --renew-period 16h \
   internal.crt internal.key
 '''
 
+Renew the certificate as a daemon, and serve it to Envoy over SDS on a unix socket:
+'''
+$ step ca renew --daemon --sds-listen unix:///tmp/sds.sock internal.crt internal.key
+'''
+
 Renew a certificate using the offline mode, requires the configuration
 files, certificates, and keys created with **step ca init**:
 '''
 $ step ca renew --offline internal.crt internal.key
+'''
+
+Renew a certificate stored in a PKCS#12 file:
+'''
+$ step ca renew --password-file pass.txt internal.p12
+'''
+
+Renew a certificate stored in a PKCS#12 file, and write the renewed certificate
+in PEM format:
+'''
+$ step ca renew --password-file pass.txt --out renewed.crt internal.p12
+'''
+
+Renew a certificate as a daemon, and write the renewed certificates to
+HashiCorp Vault:
+'''
+$ step ca renew --daemon --vault secret/step/internal internal.crt internal.key
+'''
+
+Renew a certificate as a daemon, and write the renewed certificates to AWS
+Parameter Store:
+'''
+$ step ca renew --daemon --aws-parameter /step/internal internal.crt internal.key
+'''
+
+Renew the client certificate of a private registry in /etc/docker/certs.d as a
+daemon:
+'''
+$ step ca renew --daemon --docker-registry registry.example.com:5000
+'''
+
+Renew an identity stored in the macOS Keychain:
+'''
+$ step ca renew keychain:label=internal.example.com
+'''
+
+Renew a certificate stored in the Windows local machine store as a daemon:
+'''
+$ step ca renew --daemon 'capi:friendly-name=internal.example.com;store-location=machine'
 '''`,
 		Flags: []cli.Flag{
 			caURLFlag,
 			rootFlag,
+			rootFingerprintFlag,
 			cli.StringFlag{
 				Name:  "out,output-file",
 				Usage: "The new certificate <file> path. Defaults to overwriting the <crt-file> positional argument",
@@ -170,6 +265,23 @@ Requires the **--daemon** flag. The <duration> is a sequence of decimal numbers,
 each with optional fraction and a unit suffix, such as "300ms", "1.5h", or "2h45m".
 Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".`,
 			},
+			cli.StringFlag{
+				Name: "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the PKCS#12 file
+or the encrypted <key-file>. The password is prompted if the key is encrypted
+and this flag is not set.`,
+			},
+			vaultFlag,
+			vaultRoleFlag,
+			vaultAuthMountFlag,
+			awsSecretFlag,
+			awsParameterFlag,
+			awsKMSKeyFlag,
+			awsRegionFlag,
+			awsProfileFlag,
+			sdsListenFlag,
+			dockerRegistryFlag,
+			dockerCertsDirFlag,
 			offlineFlag,
 			caConfigFlag,
 			flags.Force,
@@ -178,30 +290,81 @@ Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".`,
 }
 
 func renewCertificateAction(ctx *cli.Context) error {
-	err := errs.NumberOfArguments(ctx, 2)
+	var err error
+	args := ctx.Args()
+	crtFile := args.Get(0)
+	isP12 := isPKCS12File(crtFile)
+	isStore := isStoreURI(crtFile)
+	switch {
+	case ctx.String("docker-registry") != "":
+		err = errs.NumberOfArguments(ctx, 0)
+	case isP12 || isStore:
+		err = errs.NumberOfArguments(ctx, 1)
+	default:
+		err = errs.NumberOfArguments(ctx, 2)
+	}
 	if err != nil {
 		return err
 	}
 
-	args := ctx.Args()
-	crtFile := args.Get(0)
 	keyFile := args.Get(1)
+	dockerDir, err := dockerRegistryDir(ctx)
+	if err != nil {
+		return err
+	}
+	if dockerDir != "" {
+		crtFile = filepath.Join(dockerDir, dockerClientCert)
+		keyFile = filepath.Join(dockerDir, dockerClientKey)
+	}
 	isDaemon := ctx.Bool("daemon")
 	execCmd := ctx.String("exec")
+	sdsListen := ctx.String("sds-listen")
+	if sdsListen != "" && !isDaemon {
+		return errs.RequiredWithFlag(ctx, "sds-listen", "daemon")
+	}
 
+	targets, err := newSecretTargets(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Without --out, the renewed certificate of a PKCS#12 file is written
+	// back into it.
+	var p12File string
 	outFile := ctx.String("out")
-	if len(outFile) == 0 {
-		outFile = crtFile
+	if len(outFile) == 0 && !isStore && targets == nil {
+		if isP12 {
+			p12File = crtFile
+		} else {
+			outFile = crtFile
+		}
+	}
+
+	// Renewed certificates of keys in a store are also imported into it.
+	var storeURI string
+	switch {
+	case isStore:
+		storeURI = crtFile
+	case isStoreURI(keyFile):
+		storeURI = keyFile
 	}
 
-	rootFile := ctx.String("root")
-	if len(rootFile) == 0 {
+	rootFile, fingerprint, err := caRoot(ctx)
+	if err != nil {
+		return err
+	}
+	if rootFile == "" && fingerprint == "" {
 		rootFile = pki.GetRootCAPath()
 	}
+	if rootFile == "" && sdsListen != "" {
+		return errs.RequiredWithFlag(ctx, "sds-listen", "root")
+	}
 
+	// The ca-url is not required in offline mode, the certificate will be
+	// renewed using the configuration in --ca-config.
 	caURL := ctx.String("ca-url")
-	if len(caURL) == 0 {
-		return errs.RequiredFlag(ctx, "ca-url")
+	if len(caURL) == 0 && !ctx.Bool("offline") {
+		return errs.RequiredUnlessFlag(ctx, "ca-url", "offline")
 	}
 
 	var expiresIn, renewPeriod time.Duration
@@ -232,12 +395,20 @@ func renewCertificateAction(ctx *cli.Context) error {
 		return errs.InvalidFlagValue(ctx, "signal", strconv.Itoa(signum), "")
 	}
 
-	cert, err := tls.LoadX509KeyPair(crtFile, keyFile)
-	if err != nil {
-		return errors.Wrap(err, "error loading certificates")
+	var cert tls.Certificate
+	var p12Password string
+	switch {
+	case isP12:
+		cert, p12Password, err = loadPKCS12KeyPair(crtFile, ctx.String("password-file"))
+	case isStore:
+		cert, err = storeLoadIdentity(crtFile)
+	case storeURI != "":
+		cert, err = loadStoreKeyPair(crtFile, keyFile)
+	default:
+		cert, err = loadX509KeyPair(crtFile, keyFile, ctx.String("password-file"))
 	}
-	if len(cert.Certificate) == 0 {
-		return errors.New("error loading certificate: certificate chain is empty")
+	if err != nil {
+		return err
 	}
 
 	leaf, err := x509.ParseCertificate(cert.Certificate[0])
@@ -253,10 +424,23 @@ func renewCertificateAction(ctx *cli.Context) error {
 			"validity period; renew-period=%v, cert-validity-period=%v", renewPeriod, cvp)
 	}
 
-	renewer, err := newRenewer(ctx, caURL, crtFile, keyFile, rootFile)
+	renewer, err := newRenewer(ctx, caURL, cert, rootFile, fingerprint)
 	if err != nil {
 		return err
 	}
+	renewer.store = storeURI
+	renewer.secrets = targets
+	renewer.p12File = p12File
+	renewer.p12Password = p12Password
+
+	if sdsListen != "" {
+		srv, err := startSDSServer(sdsListen, rootFile, cert)
+		if err != nil {
+			return err
+		}
+		defer srv.Stop()
+		renewer.sdsServer = srv
+	}
 
 	afterRenew := getAfterRenewFunc(pid, signum, execCmd)
 	if isDaemon {
@@ -279,7 +463,20 @@ func renewCertificateAction(ctx *cli.Context) error {
 		return err
 	}
 
-	ui.Printf("Your certificate has been saved in %s.\n", outFile)
+	if outFile != "" {
+		ui.Printf("Your certificate has been saved in %s.\n", outFile)
+	}
+	if p12File != "" {
+		ui.Printf("Your certificate has been saved in %s.\n", p12File)
+	}
+	if storeURI != "" {
+		ui.Printf("Your certificate has been imported into %s.\n", storeURI)
+	}
+	if targets != nil {
+		for _, d := range targets.Destinations() {
+			ui.Printf("Your certificate has been written to %s.\n", d)
+		}
+	}
 	return afterRenew()
 }
 
@@ -338,63 +535,155 @@ func runExecCmd(execCmd string) error {
 	return cmd.Run()
 }
 
-type renewer struct {
-	client    caClient
-	transport *http.Transport
-	keyFile   string
-	offline   bool
+// isPKCS12File returns true if the given file name has a PKCS#12 extension.
+func isPKCS12File(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".p12", ".pfx":
+		return true
+	default:
+		return false
+	}
 }
 
-func newRenewer(ctx *cli.Context, caURL, crtFile, keyFile, rootFile string) (*renewer, error) {
-	cert, err := tls.LoadX509KeyPair(crtFile, keyFile)
+// loadX509KeyPair reads a certificate and a private key from the given PEM
+// files. If the key is encrypted, the password in passwordFile is used, or it
+// is prompted.
+func loadX509KeyPair(crtFile, keyFile, passwordFile string) (tls.Certificate, error) {
+	var opts []pemutil.Options
+	if passwordFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(passwordFile))
+	}
+	cert, err := pemutil.LoadX509KeyPair(crtFile, keyFile, opts...)
 	if err != nil {
-		return nil, errors.Wrap(err, "error loading certificates")
+		return cert, errors.Wrap(err, "error loading certificates")
 	}
 	if len(cert.Certificate) == 0 {
-		return nil, errors.New("error loading certificate: certificate chain is empty")
+		return cert, errors.New("error loading certificate: certificate chain is empty")
 	}
+	return cert, nil
+}
 
-	rootCAs, err := x509util.ReadCertPool(rootFile)
+// loadStoreKeyPair reads a certificate from the given PEM file, and uses the
+// private key in the given store URI.
+func loadStoreKeyPair(crtFile, rawuri string) (tls.Certificate, error) {
+	var cert tls.Certificate
+	certs, err := pemutil.ReadCertificateBundle(crtFile)
 	if err != nil {
-		return nil, err
+		return cert, err
+	}
+	signer, err := storeSigner(rawuri)
+	if err != nil {
+		return cert, err
+	}
+	for _, crt := range certs {
+		cert.Certificate = append(cert.Certificate, crt.Raw)
 	}
+	cert.PrivateKey = signer
+	cert.Leaf = certs[0]
+	return cert, nil
+}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			Certificates:             []tls.Certificate{cert},
-			RootCAs:                  rootCAs,
-			PreferServerCipherSuites: true,
-		},
+// loadPKCS12KeyPair reads a certificate, its chain, and a private key from the
+// given PKCS#12 file, and returns them with the password of the file. If
+// passwordFile is empty the password will be prompted.
+func loadPKCS12KeyPair(filename, passwordFile string) (tls.Certificate, string, error) {
+	var cert tls.Certificate
+	b, err := utils.ReadFile(filename)
+	if err != nil {
+		return cert, "", err
+	}
+
+	var pass []byte
+	if passwordFile != "" {
+		if pass, err = utils.ReadPasswordFromFile(passwordFile); err != nil {
+			return cert, "", err
+		}
+	} else {
+		if pass, err = ui.PromptPassword(fmt.Sprintf("Please enter the password to decrypt %s", filename), ui.WithFlag("password-file")); err != nil {
+			return cert, "", err
+		}
 	}
 
+	key, leaf, caCerts, err := pkcs12util.Decode(b, string(pass))
+	if err != nil {
+		return cert, "", errors.Wrapf(err, "error decoding %s", filename)
+	}
+	cert = tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	for _, crt := range caCerts {
+		cert.Certificate = append(cert.Certificate, crt.Raw)
+	}
+	return cert, string(pass), nil
+}
+
+type renewer struct {
+	client      caClient
+	transport   *http.Transport
+	key         crypto.PrivateKey
+	offline     bool
+	rootFile    string
+	store       string
+	secrets     *secretTargets
+	sdsServer   *sds.Server
+	p12File     string
+	p12Password string
+}
+
+func newRenewer(ctx *cli.Context, caURL string, cert tls.Certificate, rootFile, fingerprint string) (*renewer, error) {
+	tr := pki.NewTransport(&tls.Config{
+		Certificates:             []tls.Certificate{cert},
+		PreferServerCipherSuites: true,
+	})
+
+	var err error
 	var client caClient
 	offline := ctx.Bool("offline")
 	if offline {
-		caConfig := ctx.String("ca-config")
-		if caConfig == "" {
-			return nil, errs.InvalidFlagValue(ctx, "ca-config", "", "")
-		}
-		client, err = newOfflineCA(caConfig)
+		// The offline CA gets the certificate from the transport, the root is
+		// not required.
+		client, err = newOfflineClient(ctx)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		client, err = ca.NewClient(caURL, ca.WithTransport(tr))
+		if fingerprint != "" {
+			tr.TLSClientConfig.RootCAs, err = pki.NewBootstrapPool(caURL, fingerprint)
+		} else {
+			tr.TLSClientConfig.RootCAs, err = x509util.ReadCertPool(rootFile)
+		}
+		if err != nil {
+			return nil, err
+		}
+		client, err = ca.NewClient(caURL, ca.WithTransport(pki.WrapTransport(tr)))
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// Only the bundle written by step ca bootstrap is refreshed.
+	if offline || !isBootstrapRoot(rootFile) {
+		rootFile = ""
+	}
+
 	return &renewer{
 		client:    client,
 		transport: tr,
-		keyFile:   keyFile,
+		key:       cert.PrivateKey,
 		offline:   offline,
+		rootFile:  rootFile,
 	}, nil
 }
 
 func (r *renewer) Renew(outFile string) (*api.SignResponse, error) {
-	resp, err := r.client.Renew(r.transport)
+	// The offline CA requires the *http.Transport
+	var tr http.RoundTripper = r.transport
+	if !r.offline {
+		tr = pki.WrapTransport(r.transport)
+	}
+	resp, err := r.client.Renew(tr)
 	if err != nil {
 		return nil, errors.Wrap(err, "error renewing certificate")
 	}
@@ -409,13 +698,64 @@ func (r *renewer) Renew(outFile string) (*api.SignResponse, error) {
 	}
 	data := append(pem.EncodeToMemory(serverBlock), pem.EncodeToMemory(caBlock)...)
 
-	if err := utils.WriteFile(outFile, data, 0600); err != nil {
-		return nil, errs.FileError(err, outFile)
+	if outFile != "" {
+		if err := utils.WriteFile(outFile, data, 0600); err != nil {
+			return nil, errs.FileError(err, outFile)
+		}
+	}
+	if r.p12File != "" {
+		b, err := pkcs12util.Encode(r.key, resp.ServerPEM.Certificate, []*x509.Certificate{resp.CaPEM.Certificate}, r.p12Password)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error encoding %s", r.p12File)
+		}
+		if err := utils.WriteFile(r.p12File, b, 0600); err != nil {
+			return nil, errs.FileError(err, r.p12File)
+		}
+	}
+	if r.store != "" {
+		if err := storeImportCertificate(r.store, resp.ServerPEM.Certificate); err != nil {
+			return nil, err
+		}
+	}
+	if r.secrets != nil {
+		if err := r.secrets.Write(resp, nil); err != nil {
+			return nil, err
+		}
+	}
+	if r.sdsServer != nil {
+		chain := []*x509.Certificate{resp.ServerPEM.Certificate, resp.CaPEM.Certificate}
+		if err := r.sdsServer.Update(chain, r.key); err != nil {
+			return nil, err
+		}
+	}
+	if r.rootFile != "" {
+		r.refreshRoots()
 	}
 
 	return resp, nil
 }
 
+// refreshRoots adds the new roots of the CA to the root bundle, and trusts
+// them in the next renewals. The certificate is already renewed, so errors
+// are only reported.
+func (r *renewer) refreshRoots() {
+	n, err := refreshRoots(r.client, r.rootFile)
+	if err != nil {
+		ui.Printf("Warning: the roots in %s could not be refreshed: %v\n", r.rootFile, err)
+		return
+	}
+	if n == 0 {
+		return
+	}
+	pool, err := x509util.ReadCertPool(r.rootFile)
+	if err != nil {
+		ui.Printf("Warning: the roots in %s could not be refreshed: %v\n", r.rootFile, err)
+		return
+	}
+	r.transport.TLSClientConfig.RootCAs = pool
+	ui.Printf("The root certificate bundle in %s has been updated with %d new roots.\n", r.rootFile, n)
+}
+
 func (r *renewer) RenewAndPrepareNext(outFile string, expiresIn, renewPeriod time.Duration) (time.Duration, error) {
 	const durationOnErrors = 1 * time.Minute
 
@@ -424,15 +764,12 @@ func (r *renewer) RenewAndPrepareNext(outFile string, expiresIn, renewPeriod tim
 		return durationOnErrors, err
 	}
 
-	cert, err := tls.LoadX509KeyPair(outFile, r.keyFile)
-	if err != nil {
-		return durationOnErrors, errors.Wrap(err, "error loading certificates")
+	// Prepare next transport using the renewed certificate
+	cert := tls.Certificate{
+		Certificate: [][]byte{resp.ServerPEM.Raw, resp.CaPEM.Raw},
+		PrivateKey:  r.key,
+		Leaf:        resp.ServerPEM.Certificate,
 	}
-	if len(cert.Certificate) == 0 {
-		return durationOnErrors, errors.New("error loading certificate: certificate chain is empty")
-	}
-
-	// Prepare next transport
 	r.transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
 
 	// Get next renew duration
@@ -444,6 +781,10 @@ func (r *renewer) Daemon(outFile string, next, expiresIn, renewPeriod time.Durat
 	Info := log.New(os.Stdout, "INFO: ", log.LstdFlags)
 	Error := log.New(os.Stderr, "ERROR: ", log.LstdFlags)
 
+	// Abort the requests in progress on an interrupt or termination signal
+	cancel := pki.CancelOnSignal()
+	defer cancel()
+
 	// Daemon loop
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
@@ -0,0 +1,219 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func revokeCertificateCommand() cli.Command {
+	return cli.Command{
+		Name:   "revoke",
+		Action: command.ActionFunc(revokeCertificateAction),
+		Usage:  "revoke a certificate",
+		UsageText: `**step ca revoke** <crt-file> [<key-file>]
+[**--reason**=<string>] [**--reasonCode**=<code>] [**--password-file**=<file>]
+[**--ca-url**=<uri>] [**--root**=<file>] [**--fingerprint**=<fingerprint>]
+[**--force**]`,
+		Description: `**step ca revoke** command revokes a certificate using the certificate and
+its private key to authenticate with the CA over mutual TLS. Revoked
+certificates cannot be renewed.
+
+Before revoking the certificate, the command prints its subject and serial
+number and asks for confirmation. Use **--force**, or its alias **--yes**, to
+revoke it without asking.
+
+## POSITIONAL ARGUMENTS
+
+<crt-file>
+:  The certificate in PEM format to revoke. A PKCS#12 file with the
+extension .p12 or .pfx can be used instead of the certificate and the key.
+
+<key-file>
+:  The private key of the certificate.
+
+## EXAMPLES
+
+Revoke a certificate:
+'''
+$ step ca revoke --ca-url https://ca.smallstep.com --root root_ca.crt \
+  internal.crt internal.key
+'''
+
+Revoke a certificate, the ca-url and root are read from
+<$STEPPATH/config/defaults.json>:
+'''
+$ step ca revoke internal.crt internal.key
+'''
+
+Revoke a certificate specifying the reason:
+'''
+$ step ca revoke --ca-url https://ca.smallstep.com --root root_ca.crt \
+  --reason "laptop stolen" --reasonCode 1 internal.crt internal.key
+'''
+
+Revoke a certificate stored in a PKCS#12 file:
+'''
+$ step ca revoke --ca-url https://ca.smallstep.com --root root_ca.crt \
+  --password-file pass.txt internal.p12
+'''
+
+Revoke a certificate from a script, without asking for confirmation:
+'''
+$ step ca revoke --yes --ca-url https://ca.smallstep.com --root root_ca.crt \
+  internal.crt internal.key
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "reason",
+				Usage: `The <string> representing the reason for which the certificate is being revoked.`,
+			},
+			cli.IntFlag{
+				Name: "reasonCode",
+				Usage: `The <code> representing the reason for which the certificate is being revoked,
+as defined in RFC 5280, e.g. 1 for keyCompromise.`,
+			},
+			cli.StringFlag{
+				Name: "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the private key or
+the PKCS#12 file.`,
+			},
+			caURLFlag,
+			rootFlag,
+			rootFingerprintFlag,
+			flags.Force,
+		},
+	}
+}
+
+// revokeRequest is the request body sent to the revoke endpoint of the CA.
+// Without a token the CA authenticates the request using the client
+// certificate, that must be the one to revoke.
+type revokeRequest struct {
+	Serial     string `json:"serial"`
+	OTT        string `json:"ott"`
+	ReasonCode int    `json:"reasonCode"`
+	Reason     string `json:"reason,omitempty"`
+	Passive    bool   `json:"passive"`
+}
+
+func revokeCertificateAction(ctx *cli.Context) error {
+	crtFile := ctx.Args().Get(0)
+	if isPKCS12File(crtFile) {
+		if err := errs.NumberOfArguments(ctx, 1); err != nil {
+			return err
+		}
+	} else if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+	keyFile := ctx.Args().Get(1)
+
+	caURL := ctx.String("ca-url")
+	if caURL == "" {
+		return errs.RequiredFlag(ctx, "ca-url")
+	}
+	rootFile, fingerprint, err := caRoot(ctx)
+	if err != nil {
+		return err
+	}
+	if rootFile == "" && fingerprint == "" {
+		return errs.RequiredOrFlag(ctx, "root", "fingerprint")
+	}
+
+	var cert tls.Certificate
+	if keyFile == "" {
+		cert, _, err = loadPKCS12KeyPair(crtFile, ctx.String("password-file"))
+	} else {
+		cert, err = loadX509KeyPair(crtFile, keyFile, ctx.String("password-file"))
+	}
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return errors.Wrap(err, "error parsing certificate")
+	}
+	serial := leaf.SerialNumber.String()
+
+	if err := utils.Confirm("Would you like to revoke this certificate", utils.CertificateSummary(leaf)...); err != nil {
+		return err
+	}
+
+	tr := pki.NewTransport(&tls.Config{
+		Certificates:             []tls.Certificate{cert},
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+	})
+	if fingerprint != "" {
+		tr.TLSClientConfig.RootCAs, err = pki.NewBootstrapPool(caURL, fingerprint)
+	} else {
+		tr.TLSClientConfig.RootCAs, err = x509util.ReadCertPool(rootFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := postRevoke(caURL, pki.WrapTransport(tr), &revokeRequest{
+		Serial:     serial,
+		ReasonCode: ctx.Int("reasonCode"),
+		Reason:     ctx.String("reason"),
+		Passive:    true,
+	}); err != nil {
+		return errors.Wrap(err, "error revoking certificate")
+	}
+
+	ui.Printf("Certificate with Serial Number %s has been revoked.\n", serial)
+	return nil
+}
+
+// postRevoke sends the given revocation request to the CA in caURL.
+func postRevoke(caURL string, tr http.RoundTripper, req *revokeRequest) error {
+	if !strings.Contains(caURL, "://") {
+		caURL = "https://" + caURL
+	}
+	u, err := url.Parse(caURL)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing %s", caURL)
+	}
+	u = u.ResolveReference(&url.URL{Path: "/1.0/revoke"})
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling request")
+	}
+	client := &http.Client{Transport: tr}
+	resp, err := client.Post(u.String(), "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrapf(err, "client POST %s failed", u)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		code := errs.StatusCode(resp.StatusCode)
+		if body, err := ioutil.ReadAll(resp.Body); err == nil {
+			if err := json.Unmarshal(body, &e); err == nil && e.Message != "" {
+				return errs.WithCode(errors.Errorf("client POST %s failed: %s", u, e.Message), code)
+			}
+		}
+		return errs.WithCode(errors.Errorf("client POST %s failed: %s", u, resp.Status), code)
+	}
+	return nil
+}
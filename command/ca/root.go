@@ -1,17 +1,26 @@
 package ca
 
 import (
+	"bytes"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 
+	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/ca"
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pki"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
 	"github.com/urfave/cli"
 )
 
@@ -21,10 +30,19 @@ func rootComand() cli.Command {
 		Action: command.ActionFunc(rootAction),
 		Usage:  "download and validate the root certificate",
 		UsageText: `**step ca root** <root-file>
-		[**--ca-url**=<uri>] [**--fingerprint**=<fingerprint>]`,
+		[**--ca-url**=<uri>] [**--fingerprint**=<fingerprint>] [**--intermediates**]
+
+**step ca root** <root-file> **--offline** [**--ca-config**=<file>] [**--intermediates**]`,
 		Description: `**step ca root** downloads and validates the root certificate from the
 certificate authority.
 
+With the **--offline** flag the root certificates are read from the
+configuration of the certificate authority instead, so a trust bundle can be
+distributed without contacting it. With the **--intermediates** flag the
+intermediate certificates are also written to the bundle, after the roots.
+Online, the intermediates are the ones sent by the certificate authority in the
+TLS handshake, verified with the downloaded root.
+
 ## POSITIONAL ARGUMENTS
 
 <root-file>
@@ -49,10 +67,33 @@ Download the root certificate using a given certificate authority:
 $ step ca root root_ca.crt \
   --ca-url https://ca.smallstep.com:9000 \
   --fingerprint 0d7d3834cf187726cf331c40a31aa7ef6b29ba4df601416c9788f6ee01058cf3
+'''
+
+Download the root and the intermediate certificates of a certificate authority:
+'''
+$ step ca root ca_bundle.crt --intermediates \
+  --ca-url https://ca.smallstep.com:9000 \
+  --fingerprint 0d7d3834cf187726cf331c40a31aa7ef6b29ba4df601416c9788f6ee01058cf3
+'''
+
+Export the roots and intermediates in the configuration of the certificate
+authority:
+'''
+$ step ca root ca_bundle.crt --offline --intermediates --ca-config ca.json
 '''`,
 		Flags: []cli.Flag{
 			caURLFlag,
 			fingerprintFlag,
+			cli.BoolFlag{
+				Name:  "intermediates",
+				Usage: `Write the intermediate certificates of the CA after the roots.`,
+			},
+			cli.BoolFlag{
+				Name: "offline",
+				Usage: `Read the root certificates from the configuration in **--ca-config**
+instead of downloading them from the certificate authority.`,
+			},
+			caConfigFlag,
 			flags.Force,
 		},
 	}
@@ -63,39 +104,216 @@ func rootAction(ctx *cli.Context) error {
 		return err
 	}
 
-	caURL := ctx.String("ca-url")
-	fingerprint := ctx.String("fingerprint")
 	rootFile := ctx.Args().Get(0)
+	intermediates := ctx.Bool("intermediates")
 
-	switch {
-	case len(caURL) == 0:
-		return errs.RequiredFlag(ctx, "ca-url")
-	case len(fingerprint) == 0:
-		return errs.RequiredFlag(ctx, "fingerprint")
+	var roots, ints []*x509.Certificate
+	if ctx.Bool("offline") {
+		c, err := newOfflineClient(ctx)
+		if err != nil {
+			return err
+		}
+		if roots, err = c.Roots(); err != nil {
+			return err
+		}
+		if intermediates {
+			if ints, err = c.Intermediates(); err != nil {
+				return err
+			}
+			if err := verifyIntermediates(ints, roots); err != nil {
+				return err
+			}
+		}
+	} else {
+		caURL := ctx.String("ca-url")
+		fingerprint := ctx.String("fingerprint")
+		switch {
+		case len(caURL) == 0:
+			return errs.RequiredFlag(ctx, "ca-url")
+		case len(fingerprint) == 0:
+			return errs.RequiredFlag(ctx, "fingerprint")
+		}
+
+		tr := getInsecureTransport()
+		client, err := ca.NewClient(caURL, ca.WithTransport(pki.WrapTransport(tr)))
+		if err != nil {
+			return err
+		}
+
+		// Root already validates the certificate
+		resp, err := client.Root(fingerprint)
+		if err != nil {
+			return errors.Wrap(err, "error downloading root certificate")
+		}
+		roots = []*x509.Certificate{resp.RootPEM.Certificate}
+		if intermediates {
+			if ints, err = downloadIntermediates(caURL, resp.RootPEM.Certificate); err != nil {
+				return err
+			}
+		}
 	}
 
-	tr := getInsecureTransport()
-	client, err := ca.NewClient(caURL, ca.WithTransport(tr))
-	if err != nil {
+	var data []byte
+	for _, crt := range append(roots, ints...) {
+		data = append(data, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+	if err := utils.WriteFile(rootFile, data, 0600); err != nil {
 		return err
 	}
 
-	// Root already validates the certificate
-	resp, err := client.Root(fingerprint)
+	switch {
+	case len(ints) > 0:
+		ui.Printf("The root and intermediate certificates have been saved in %s.\n", rootFile)
+	case len(roots) > 1:
+		ui.Printf("The root certificates have been saved in %s.\n", rootFile)
+	default:
+		ui.Printf("The root certificate has been saved in %s.\n", rootFile)
+	}
+	return nil
+}
+
+// downloadIntermediates returns the intermediate certificates sent by the CA
+// at caURL in the TLS handshake, verified with the given root.
+func downloadIntermediates(caURL string, root *x509.Certificate) ([]*x509.Certificate, error) {
+	u, err := url.Parse(caURL)
 	if err != nil {
-		return errors.Wrap(err, "error downloading root certificate")
+		return nil, errors.Wrapf(err, "error parsing %s", caURL)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(root)
+	client := &http.Client{
+		Transport: pki.WrapTransport(pki.NewTransport(&tls.Config{RootCAs: pool})),
+	}
+	resp, err := client.Get(u.ResolveReference(&url.URL{Path: "/health"}).String())
+	if err != nil {
+		return nil, errors.Wrap(err, "error downloading intermediate certificates")
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || len(resp.TLS.VerifiedChains) == 0 {
+		return nil, errors.Errorf("error downloading intermediate certificates: %s does not use TLS", caURL)
 	}
 
-	if _, err := pemutil.Serialize(resp.RootPEM.Certificate, pemutil.ToFile(rootFile, 0600)); err != nil {
-		return err
+	// The chain is leaf, intermediates, and root.
+	var ints []*x509.Certificate
+	for _, chain := range resp.TLS.VerifiedChains {
+		for i := 1; i < len(chain)-1; i++ {
+			if !containsCertificate(ints, chain[i]) {
+				ints = append(ints, chain[i])
+			}
+		}
 	}
+	return ints, nil
+}
 
-	ui.Printf("The root certificate has been saved in %s.\n", rootFile)
+// verifyIntermediates returns an error if one of the intermediates is not
+// signed by the given roots.
+func verifyIntermediates(ints, roots []*x509.Certificate) error {
+	pool := x509.NewCertPool()
+	for _, root := range roots {
+		pool.AddCert(root)
+	}
+	for _, crt := range ints {
+		if _, err := crt.Verify(x509.VerifyOptions{
+			Roots:     pool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return errors.Wrapf(err, "error verifying intermediate certificate '%s'", crt.Subject.CommonName)
+		}
+	}
 	return nil
 }
 
+// containsCertificate returns true if certs contains crt.
+func containsCertificate(certs []*x509.Certificate, crt *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(crt) {
+			return true
+		}
+	}
+	return false
+}
+
 func getInsecureTransport() *http.Transport {
-	return &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	return pki.NewTransport(&tls.Config{InsecureSkipVerify: true})
+}
+
+// rootsClient is the interface of the clients that can download the roots of
+// the CA, the offline CA does not implement it.
+type rootsClient interface {
+	Roots() (*api.RootsResponse, error)
+}
+
+// isBootstrapRoot returns true if rootFile is the root bundle written by step
+// ca bootstrap, the only one that is refreshed with the roots of the CA.
+func isBootstrapRoot(rootFile string) bool {
+	return rootFile != "" && filepath.Clean(rootFile) == filepath.Clean(pki.GetRootCAPath())
+}
+
+// refreshRoots downloads the roots of the CA and appends the new ones to the
+// bundle in rootFile, so the commands keep working after the CA rotates its
+// root. The new roots are trusted because the connection to the CA is
+// verified using the current ones, but the bundle is not modified if any of
+// them is not a self-signed CA certificate. It returns the number of roots
+// added.
+func refreshRoots(client caClient, rootFile string) (int, error) {
+	rc, ok := client.(rootsClient)
+	if !ok {
+		return 0, nil
+	}
+	resp, err := rc.Roots()
+	if err != nil {
+		return 0, errors.Wrap(err, "error downloading root certificates")
 	}
+	current, err := pemutil.ReadCertificateBundle(rootFile)
+	if err != nil {
+		return 0, err
+	}
+
+	var added int
+	var data []byte
+	for _, root := range resp.Certificates {
+		if !isSelfSignedCA(root.Certificate) {
+			return 0, errs.WithCode(errors.Errorf("error refreshing %s: the CA returned a root certificate that is not a self-signed CA certificate (subject '%s')", rootFile, root.Subject), errs.CodeValidation)
+		}
+		found := false
+		for _, crt := range current {
+			if bytes.Equal(crt.Raw, root.Raw) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			data = append(data, pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: root.Raw,
+			})...)
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	b, err := ioutil.ReadFile(rootFile)
+	if err != nil {
+		return 0, errs.FileError(err, rootFile)
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	// The bundle is updated without prompting, it only adds roots.
+	if err := ioutil.WriteFile(rootFile, append(b, data...), 0600); err != nil {
+		return 0, errs.FileError(err, rootFile)
+	}
+	return added, nil
+}
+
+// isSelfSignedCA returns true if the certificate is a CA certificate signed
+// by its own key.
+func isSelfSignedCA(cert *x509.Certificate) bool {
+	return cert != nil && cert.IsCA && bytes.Equal(cert.RawSubject, cert.RawIssuer) &&
+		cert.CheckSignatureFrom(cert) == nil
 }
@@ -0,0 +1,99 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+type rootsClientMock struct {
+	roots []*x509.Certificate
+}
+
+func (c *rootsClientMock) Sign(req *api.SignRequest) (*api.SignResponse, error) {
+	return nil, nil
+}
+
+func (c *rootsClientMock) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
+	return nil, nil
+}
+
+func (c *rootsClientMock) Roots() (*api.RootsResponse, error) {
+	resp := new(api.RootsResponse)
+	for _, crt := range c.roots {
+		resp.Certificates = append(resp.Certificates, api.Certificate{Certificate: crt})
+	}
+	return resp, nil
+}
+
+func mustRootCertificate(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.FatalError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return cert, key
+}
+
+func TestRefreshRoots(t *testing.T) {
+	root, rootKey := mustRootCertificate(t, "Root CA", true, nil, nil)
+	newRoot, _ := mustRootCertificate(t, "New Root CA", true, nil, nil)
+	intermediate, _ := mustRootCertificate(t, "Intermediate CA", true, root, rootKey)
+	leaf, _ := mustRootCertificate(t, "Leaf", false, nil, nil)
+
+	dir, err := ioutil.TempDir("", "step-roots")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	rootFile := filepath.Join(dir, "root_ca.crt")
+	assert.FatalError(t, ioutil.WriteFile(rootFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0600))
+
+	tests := []struct {
+		name      string
+		roots     []*x509.Certificate
+		want      int
+		wantErr   bool
+		wantRoots int
+	}{
+		{"ok same", []*x509.Certificate{root}, 0, false, 1},
+		{"fail intermediate", []*x509.Certificate{root, newRoot, intermediate}, 0, true, 1},
+		{"fail not CA", []*x509.Certificate{newRoot, leaf}, 0, true, 1},
+		{"ok new", []*x509.Certificate{root, newRoot}, 1, false, 2},
+		{"ok again", []*x509.Certificate{root, newRoot}, 0, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := refreshRoots(&rootsClientMock{roots: tt.roots}, rootFile)
+			assert.Equals(t, tt.wantErr, err != nil)
+			assert.Equals(t, tt.want, got)
+			bundle, err := pemutil.ReadCertificateBundle(rootFile)
+			assert.FatalError(t, err)
+			assert.Len(t, tt.wantRoots, bundle)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/sds"
+	"github.com/urfave/cli"
+)
+
+var sdsListenFlag = cli.StringFlag{
+	Name: "sds-listen",
+	Usage: `Serve the certificate, the private key and the root certificates over the
+Envoy Secret Discovery Service (SDS) API on the given <address>, and push them
+to Envoy after each renewal. The <address> can be a unix socket like
+'unix:///tmp/sds.sock' or a TCP address like 'tcp://127.0.0.1:8234'. The
+certificate is served as the secret 'default' and the root certificates as the
+secret 'ROOTCA'. Requires the **--daemon** flag, and step compiled with the
+sds build tag.`,
+}
+
+// startSDSServer starts an SDS server on addr that serves the given
+// certificate and the roots in rootFile.
+func startSDSServer(addr, rootFile string, cert tls.Certificate) (*sds.Server, error) {
+	roots, err := pemutil.ReadCertificateBundle(rootFile)
+	if err != nil {
+		return nil, err
+	}
+	srv, err := sds.NewServer(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make([]*x509.Certificate, len(cert.Certificate))
+	for i, b := range cert.Certificate {
+		if chain[i], err = x509.ParseCertificate(b); err != nil {
+			return nil, errors.Wrap(err, "error parsing certificate")
+		}
+	}
+	if err := srv.Update(chain, cert.PrivateKey); err != nil {
+		return nil, err
+	}
+
+	l, err := sds.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			log.New(os.Stderr, "ERROR: ", log.LstdFlags).Println(err)
+		}
+	}()
+	log.New(os.Stdout, "INFO: ", log.LstdFlags).Printf("serving secrets on %s", addr)
+	return srv, nil
+}
@@ -0,0 +1,118 @@
+package ca
+
+import (
+	"context"
+	"crypto"
+	"encoding/pem"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/cli/awssecrets"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/vault"
+	"github.com/urfave/cli"
+)
+
+// Fields of the secrets with the certificate and the private key. They match
+// the fields returned by the Vault PKI secrets engine.
+const (
+	certificateField = "certificate"
+	issuingCAField   = "issuing_ca"
+	privateKeyField  = "private_key"
+)
+
+// secretTargets are the secret stores where certificates and keys are written
+// instead of files: a HashiCorp Vault secret set with --vault, an AWS Secrets
+// Manager secret set with --aws-secret, and AWS Parameter Store parameters set
+// with --aws-parameter.
+type secretTargets struct {
+	vault        *vault.Client
+	vaultPath    string
+	aws          *awssecrets.Client
+	awsSecret    string
+	awsParameter string
+}
+
+// hasSecretTargets returns true if any of the flags of the secret stores is
+// set.
+func hasSecretTargets(ctx *cli.Context) bool {
+	return ctx.String("vault") != "" || ctx.String("aws-secret") != "" || ctx.String("aws-parameter") != ""
+}
+
+// newSecretTargets validates the flags of the secret stores and returns the
+// targets. It returns nil if none of them is set.
+func newSecretTargets(ctx *cli.Context) (*secretTargets, error) {
+	vaultClient, vaultPath, err := newVaultClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	awsClient, awsSecret, awsParameter, err := newAWSSecretsClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if vaultClient == nil && awsClient == nil {
+		return nil, nil
+	}
+	return &secretTargets{
+		vault:        vaultClient,
+		vaultPath:    vaultPath,
+		aws:          awsClient,
+		awsSecret:    awsSecret,
+		awsParameter: awsParameter,
+	}, nil
+}
+
+// Write writes the certificate and intermediate in the given response, and
+// the private key if it's not nil, to all the targets.
+func (t *secretTargets) Write(resp *api.SignResponse, key crypto.PrivateKey) error {
+	data := make(map[string]string)
+	for k, crt := range map[string]api.Certificate{
+		certificateField: resp.ServerPEM,
+		issuingCAField:   resp.CaPEM,
+	} {
+		block, err := pemutil.Serialize(crt.Certificate)
+		if err != nil {
+			return err
+		}
+		data[k] = string(pem.EncodeToMemory(block))
+	}
+	if key != nil {
+		block, err := pemutil.Serialize(key)
+		if err != nil {
+			return err
+		}
+		data[privateKeyField] = string(pem.EncodeToMemory(block))
+	}
+
+	if t.vault != nil {
+		if err := t.vault.Write(t.vaultPath, data); err != nil {
+			return err
+		}
+	}
+	if t.awsSecret != "" {
+		if err := t.aws.PutSecret(context.Background(), t.awsSecret, data); err != nil {
+			return err
+		}
+	}
+	if t.awsParameter != "" {
+		if err := t.aws.PutParameters(context.Background(), t.awsParameter, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Destinations returns a description of each of the targets, e.g. "Vault
+// secret secret/step/internal".
+func (t *secretTargets) Destinations() []string {
+	var s []string
+	if t.vault != nil {
+		s = append(s, "Vault secret "+t.vaultPath)
+	}
+	if t.awsSecret != "" {
+		s = append(s, "AWS secret "+t.awsSecret)
+	}
+	if t.awsParameter != "" {
+		s = append(s, "AWS parameters "+t.awsParameter)
+	}
+	return s
+}
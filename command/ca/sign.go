@@ -19,8 +19,8 @@ func signCertificateCommand() cli.Command {
 		Action: command.ActionFunc(signCertificateAction),
 		Usage:  "generate a new certificate signing a certificate request",
 		UsageText: `**step ca sign** <csr-file> <crt-file>
-		[**--token**=<token>] [**--ca-url**=<uri>] [**--root**=<file>]
-		[**--not-before**=<time|duration>] [**--not-after**=<time|duration>]`,
+		[**--token**=<token>] [**--ca-url**=<uri>] [**--root**=<file>] [**--fingerprint**=<fingerprint>]
+		[**--not-before**=<time|duration>] [**--not-after**=<time|duration>] [**--wildcard**]`,
 		Description: `**step ca sign** command signs the given csr and generates a new certificate.
 
 ## POSITIONAL ARGUMENTS
@@ -54,10 +54,13 @@ $ step ca sign --offline internal internal.csr internal.crt
 			tokenFlag,
 			caURLFlag,
 			rootFlag,
+			rootFingerprintFlag,
 			notBeforeFlag,
 			notAfterFlag,
 			offlineFlag,
+			auditLogFlag,
 			caConfigFlag,
+			flags.Wildcard,
 			flags.Force,
 		},
 	}
@@ -97,6 +100,9 @@ func signCertificateAction(ctx *cli.Context) error {
 
 	if len(token) == 0 {
 		sans := mergeSans(ctx, csr)
+		if err := validateSANs(ctx, csr.Subject.CommonName, sans); err != nil {
+			return err
+		}
 		if tok, err := flow.GenerateToken(ctx, csr.Subject.CommonName, sans); err == nil {
 			token = tok
 		} else {
@@ -108,7 +114,7 @@ func signCertificateAction(ctx *cli.Context) error {
 		}
 	}
 
-	if err := flow.Sign(ctx, token, api.NewCertificateRequest(csr), crtFile); err != nil {
+	if _, err := flow.Sign(ctx, token, api.NewCertificateRequest(csr), crtFile); err != nil {
 		return err
 	}
 
@@ -0,0 +1,78 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/spiffe"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+var (
+	spiffeFlag = cli.BoolFlag{
+		Name: "spiffe",
+		Usage: `Request an X509-SVID, with the SPIFFE ID in <subject> as the only URI SAN. The
+trust domain of the SPIFFE ID is validated against the SPIFFE IDs and name
+constraints of the CA certificates, and the certificate is validated before
+it's written.`,
+	}
+
+	spiffeDirFlag = cli.StringFlag{
+		Name: "spiffe-dir",
+		Usage: `Write the X509-SVID, the private key and the trust bundle to <dir> using the
+file names of the SPIFFE Workload API disk layout: 'svid.pem', 'svid_key.pem'
+and 'svid_bundle.pem'. Requires the **--spiffe** flag.`,
+	}
+)
+
+// verifySVID verifies that the certificate in the given response is a valid
+// X509-SVID for id, issued by a CA in the same trust domain.
+func verifySVID(id *url.URL, resp *api.SignResponse) error {
+	if err := spiffe.VerifyTrustDomain(id.Host, resp.CaPEM.Certificate); err != nil {
+		return err
+	}
+	return spiffe.VerifySVID(resp.ServerPEM.Certificate, id)
+}
+
+// writeSVID writes the X509-SVID and intermediate in the given response, the
+// private key and the trust bundle to dir using the file names of the SPIFFE
+// Workload API disk layout.
+func writeSVID(dir string, resp *api.SignResponse, key crypto.PrivateKey, roots []*x509.Certificate) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errs.FileError(err, dir)
+	}
+
+	svidFile := filepath.Join(dir, spiffe.SVIDFile)
+	if err := writeCertificateFile(svidFile, resp); err != nil {
+		return err
+	}
+	keyFile := filepath.Join(dir, spiffe.KeyFile)
+	if _, err := pemutil.Serialize(key, pemutil.WithPKCS8(true), pemutil.ToFile(keyFile, 0600)); err != nil {
+		return err
+	}
+	var bundle []byte
+	for _, crt := range roots {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+	bundleFile := filepath.Join(dir, spiffe.BundleFile)
+	if err := utils.WriteFile(bundleFile, bundle, 0600); err != nil {
+		return err
+	}
+
+	ui.PrintSelected("SVID", svidFile)
+	ui.PrintSelected("Private Key", keyFile)
+	ui.PrintSelected("Trust Bundle", bundleFile)
+	return nil
+}
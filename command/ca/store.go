@@ -0,0 +1,77 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/smallstep/cli/crypto/capi"
+	"github.com/smallstep/cli/crypto/keychain"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+// The functions below dispatch to the operating system stores that can keep
+// keys and certificates instead of files: the macOS Keychain, with URIs like
+// 'keychain:label=<label>', and the Windows certificate stores, with URIs like
+// 'capi:friendly-name=<name>'.
+
+// isStoreURI returns true if the given name is the URI of a key in an
+// operating system store.
+func isStoreURI(name string) bool {
+	return keychain.IsURI(name) || capi.IsURI(name)
+}
+
+// parseStoreURI validates the given store URI.
+func parseStoreURI(rawuri string) error {
+	var err error
+	if keychain.IsURI(rawuri) {
+		_, err = keychain.ParseURI(rawuri)
+	} else {
+		_, err = capi.ParseURI(rawuri)
+	}
+	return err
+}
+
+// storeCreateKey creates a new key in the store of the given URI.
+func storeCreateKey(rawuri, kty, crv string, size int) (crypto.Signer, error) {
+	if keychain.IsURI(rawuri) {
+		return keychain.CreateKey(rawuri, kty, crv, size)
+	}
+	return capi.CreateKey(rawuri, kty, crv, size)
+}
+
+// storeSigner returns a signer with the key in the given store URI.
+func storeSigner(rawuri string) (crypto.Signer, error) {
+	if keychain.IsURI(rawuri) {
+		return keychain.NewSigner(rawuri)
+	}
+	return capi.NewSigner(rawuri)
+}
+
+// storeImportCertificate imports the certificate into the store of the given
+// URI, so it can be used as an identity with the key in the same URI.
+func storeImportCertificate(rawuri string, crt *x509.Certificate) error {
+	if keychain.IsURI(rawuri) {
+		return keychain.ImportCertificate(rawuri, crt)
+	}
+	return capi.ImportCertificate(rawuri, crt)
+}
+
+// storeImportCertificateFile imports the certificate in crtFile into the
+// store of the given URI.
+func storeImportCertificateFile(rawuri, crtFile string) error {
+	crt, err := pemutil.ReadCertificate(crtFile)
+	if err != nil {
+		return err
+	}
+	return storeImportCertificate(rawuri, crt)
+}
+
+// storeLoadIdentity returns the certificate and the key in the given store
+// URI.
+func storeLoadIdentity(rawuri string) (tls.Certificate, error) {
+	if keychain.IsURI(rawuri) {
+		return keychain.LoadIdentity(rawuri)
+	}
+	return capi.LoadIdentity(rawuri)
+}
@@ -15,8 +15,11 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/kms"
 	"github.com/smallstep/cli/crypto/pki"
 	"github.com/smallstep/cli/crypto/randutil"
+	"github.com/smallstep/cli/crypto/tpm"
+	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/jose"
@@ -41,9 +44,13 @@ func tokenCommand() cli.Command {
 		Usage:  "generate an OTT granting access to the CA",
 		UsageText: `**step ca token** <subject>
 		[--**kid**=<kid>] [--**issuer**=<issuer>] [**--ca-url**=<uri>] [**--root**=<file>]
+		[**--fingerprint**=<fingerprint>]
 		[**--not-before**=<time|duration>] [**--not-after**=<time|duration>]
 		[**--password-file**=<file>] [**--output-file**=<file>] [**--key**=<file>]
-		[**--san**=<SAN>] [**--offline**]`,
+		[**--san**=<SAN>] [**--wildcard**] [**--offline**] [**--audit-log**=<file>]
+		[**--attestation**=<file>]
+
+**step ca token** **--inspect** [<token>]`,
 		Description: `**step ca token** command generates a one-time token granting access to the
 certificates authority.
 
@@ -55,6 +62,10 @@ When there are no additional Subject Alternative Names configured (via the
 --san flag), the subject will be added as the only element of the 'sans' claim
 on the token.
 
+<token>
+:  The token to decode with **--inspect**. It is read from STDIN if it is not
+passed.
+
 ## EXAMPLES
 
  Most of the following examples assumes that **--ca-url** and **--root** are
@@ -92,6 +103,12 @@ Get a new token that becomes valid in 30 minutes and expires 5 minutes after tha
 $ step ca token --not-before 30m --not-after 35m internal.example.com
 '''
 
+Get a new token for a CA with a clock up to 2 minutes behind the local one, the
+not before (nbf) and issued at (iat) claims are set 2 minutes in the past:
+'''
+$ step --skew 2m ca token internal.example.com
+'''
+
 Get a new token signed with the given private key, the public key must be
 configured in the certificate authority:
 '''
@@ -106,6 +123,31 @@ $ step ca token internal.example.com \
     --root /path/to/root_ca.crt
 '''
 
+Get a new token with the attestation of a TPM key created with **step crypto tpm**:
+'''
+$ step crypto tpm attest --ak ak.tpm key.tpm > attestation.json
+$ step ca token --attestation attestation.json device.example.com
+'''
+
+Get a new token and keep an audit record of it:
+'''
+$ step ca token --audit-log /var/log/step/tokens.log internal.example.com
+'''
+
+Decode a token to debug why the certificate authority does not accept it, the
+token is not verified:
+'''
+$ step ca token --inspect $TOKEN
+✔ Issuer: joe@example.com
+✔ Audience: https://ca.example.com/1.0/sign
+✔ Subject: internal.example.com
+✔ SANs: internal.example.com
+✔ SHA: 0d7d3834cf187726cf331c40a31aa7ef6b29ba4df601416c9788f6ee01058cf3
+✔ Key ID: 4vn46fbZT68Uxfs9LBwHkTvrjEvxQqx-W8nnE-qDjts
+✔ Not Before: 2026-10-16T09:21:04Z (valid since 1m10s)
+✔ Expires: 2026-10-16T09:26:04Z (expires in 3m50s)
+'''
+
 Get a new token using the simple offline mode, requires the configuration
 files, certificates, and keys created with **step ca init**:
 '''
@@ -129,6 +171,7 @@ $ step ca token internal.example.com \
 			provisionerIssuerFlag,
 			caURLFlag,
 			rootFlag,
+			rootFingerprintFlag,
 			notBeforeFlag,
 			notAfterFlag,
 			cli.StringSliceFlag{
@@ -138,12 +181,20 @@ authorized to request. A certificate signing request using this token must match
 the complete set of subjective alternative names in the token 1:1. Use the '--san'
 flag multiple times to configure multiple SANs.`,
 			},
+			flags.Wildcard,
 			cli.StringFlag{
 				Name: "key",
 				Usage: `The private key <file> used to sign the JWT. This is usually downloaded from
-the certificate authority.`,
+the certificate authority. It can also be a PKCS #11 URI of a key stored in an HSM,
+or an awskms, cloudkms or azurekms URI of a key stored in a cloud KMS.`,
 			},
 			passwordFileFlag,
+			auditLogFlag,
+			cli.StringFlag{
+				Name: "attestation",
+				Usage: `The <file> with the attestation of a TPM key, in the format generated by
+**step crypto tpm attest**. The attestation is added to the 'tpm' claim of the token.`,
+			},
 			cli.StringFlag{
 				Name:  "output-file",
 				Usage: "The destination <file> of the generated one-time token.",
@@ -151,15 +202,27 @@ the certificate authority.`,
 			cli.BoolFlag{
 				Name: "offline",
 				Usage: `Creates a token without contacting the certificate authority. Offline mode
-requires the flags <--ca-config> or <--kid>, <--issuer>, <--key>, <--ca-url>, and <--root>.`,
+requires the flags <--ca-config> or <--kid>, <--issuer>, <--key>, <--ca-url>, and <--root>.
+Offline tokens only read the configuration in <--ca-config>, they can be
+generated while step-ca is running. The validity and the names of the token
+are checked against the claims and the name policies of the authority and the
+provisioner in <--ca-config>.`,
 			},
 			caConfigFlag,
+			cli.BoolFlag{
+				Name: "inspect",
+				Usage: `Decode the <token> and print its issuer, audience, subject, SANs, root
+fingerprint, key id, and validity without verifying it.`,
+			},
 			flags.Force,
 		},
 	}
 }
 
 func tokenAction(ctx *cli.Context) error {
+	if ctx.Bool("inspect") {
+		return inspectTokenAction(ctx)
+	}
 	if err := errs.NumberOfArguments(ctx, 1); err != nil {
 		return err
 	}
@@ -172,17 +235,23 @@ func tokenAction(ctx *cli.Context) error {
 	keyFile := ctx.String("key")
 	offline := ctx.Bool("offline")
 	sans := ctx.StringSlice("san")
+	if err := validateSANs(ctx, subject, sans); err != nil {
+		return err
+	}
 
 	caURL := ctx.String("ca-url")
-	if len(caURL) == 0 {
-		return errs.RequiredFlag(ctx, "ca-url")
+	root, fingerprint, err := caRoot(ctx)
+	if err != nil {
+		return err
 	}
-
-	root := ctx.String("root")
-	if len(root) == 0 {
-		root = pki.GetRootCAPath()
-		if _, err := os.Stat(root); err != nil {
-			return errs.RequiredFlag(ctx, "root")
+	// The offline CA gets the audience and the root from --ca-config, so the
+	// CA flags are only required without it.
+	if !offline || !utils.FileExists(ctx.String("ca-config")) {
+		if len(caURL) == 0 {
+			return errs.RequiredFlag(ctx, "ca-url")
+		}
+		if root == "" && fingerprint == "" {
+			return errs.RequiredOrFlag(ctx, "root", "fingerprint")
 		}
 	}
 
@@ -196,7 +265,6 @@ func tokenAction(ctx *cli.Context) error {
 		return errs.InvalidFlagValue(ctx, "not-after", ctx.String("not-after"), "")
 	}
 
-	var err error
 	var token string
 	if offline {
 		token, err = offlineTokenFlow(ctx, subject, sans)
@@ -212,6 +280,9 @@ func tokenAction(ctx *cli.Context) error {
 	if len(outputFile) > 0 {
 		return utils.WriteFile(outputFile, []byte(token), 0600)
 	}
+	if ui.IsStructured() {
+		return ui.PrintSelected("Token", token)
+	}
 	fmt.Println(token)
 	return nil
 }
@@ -239,7 +310,7 @@ func parseAudience(ctx *cli.Context) (string, error) {
 
 // generateToken generates a provisioning or bootstrap token with the given
 // parameters.
-func generateToken(sub string, sans []string, kid, iss, aud, root string, notBefore, notAfter time.Time, jwk *jose.JSONWebKey) (string, error) {
+func generateToken(ctx *cli.Context, sub string, sans []string, kid, iss, aud, root string, notBefore, notAfter time.Time, jwk *jose.JSONWebKey) (string, error) {
 	// A random jwt id will be used to identify duplicated tokens
 	jwtID, err := randutil.Hex(64) // 256 bits
 	if err != nil {
@@ -260,11 +331,23 @@ func generateToken(sub string, sans []string, kid, iss, aud, root string, notBef
 	if len(sans) == 0 {
 		sans = []string{sub}
 	}
+	// Internationalized DNS names are requested in punycode, and the SANs are
+	// sorted so the token does not depend on the order of the flags.
+	if sans, err = x509util.UniqueSANs(sans); err != nil {
+		return "", err
+	}
 
 	tokOptions = append(tokOptions, token.WithSANS(sans))
+	if filename := ctx.String("attestation"); filename != "" {
+		att, err := tpm.ReadAttestation(filename)
+		if err != nil {
+			return "", err
+		}
+		tokOptions = append(tokOptions, token.WithClaim("tpm", att))
+	}
 	if !notBefore.IsZero() || !notAfter.IsZero() {
 		if notBefore.IsZero() {
-			notBefore = time.Now()
+			notBefore = time.Now().Add(-token.Skew())
 		}
 		if notAfter.IsZero() {
 			notAfter = notBefore.Add(token.DefaultValidity)
@@ -277,24 +360,86 @@ func generateToken(sub string, sans []string, kid, iss, aud, root string, notBef
 		return "", err
 	}
 
-	return tok.SignedString(jwk.Algorithm, jwk.Key)
+	signed, err := tok.SignedString(jwk.Algorithm, jwk.Key)
+	if err != nil {
+		return "", err
+	}
+
+	expiry := notAfter
+	if expiry.IsZero() {
+		expiry = time.Now().Add(token.DefaultValidity)
+	}
+	if err := auditToken(ctx, &auditRecord{
+		Subject:     sub,
+		SANs:        sans,
+		Provisioner: iss,
+		KeyID:       kid,
+		Audience:    aud,
+		TokenID:     jwtID,
+		Expiry:      &expiry,
+	}); err != nil {
+		return "", err
+	}
+
+	return signed, nil
 }
 
 // newTokenFlow implements the common flow used to generate a token
 func newTokenFlow(ctx *cli.Context, subject string, sans []string, caURL, root, kid, issuer, passwordFile, keyFile string, notBefore, notAfter time.Time) (string, error) {
-	// Get audience from ca-url
-	audience, err := parseAudience(ctx)
+	p, err := selectProvisioner(ctx, caURL, root, kid, issuer)
 	if err != nil {
 		return "", err
 	}
 
-	provisioners, err := pki.GetProvisioners(caURL, root)
+	if p, ok := p.(*provisioner.OIDC); ok {
+		audience, err := parseAudience(ctx)
+		if err != nil {
+			return "", err
+		}
+		out, err := exec.Step("oauth", "--oidc", "--bare",
+			"--provider", p.ConfigurationEndpoint,
+			"--client-id", p.ClientID, "--client-secret", p.ClientSecret)
+		if err != nil {
+			return "", err
+		}
+		if err := auditToken(ctx, &auditRecord{
+			Subject:     subject,
+			SANs:        sans,
+			Provisioner: p.Name,
+			KeyID:       p.ClientID,
+			Audience:    audience,
+		}); err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+
+	signer, err := newTokenSigner(ctx, p.(*provisioner.JWK), caURL, root, passwordFile, keyFile, notBefore, notAfter)
 	if err != nil {
 		return "", err
 	}
+	return signer.Token(ctx, subject, sans)
+}
+
+// selectProvisioner returns the JWK or OIDC provisioner used to generate
+// tokens. The provisioners are filtered by kid and issuer, and the user is
+// asked to select one if there are more than one.
+func selectProvisioner(ctx *cli.Context, caURL, root, kid, issuer string) (provisioner.Interface, error) {
+	// Without root the CA is verified using the --fingerprint flag.
+	fingerprint := ctx.String("fingerprint")
+	var provisioners provisioner.List
+	var err error
+	if root == "" && fingerprint != "" {
+		provisioners, err = pki.GetProvisionersWithFingerprint(caURL, fingerprint)
+	} else {
+		provisioners, err = pki.GetProvisioners(caURL, root)
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	if len(provisioners) == 0 {
-		return "", errors.New("cannot create a new token: the CA does not have any provisioner configured")
+		return nil, errors.New("cannot create a new token: the CA does not have any provisioner configured")
 	}
 
 	// Filter by type
@@ -311,7 +456,7 @@ func newTokenFlow(ctx *cli.Context, subject string, sans []string, caURL, root,
 			return false
 		})
 		if len(provisioners) == 0 {
-			return "", errs.InvalidFlagValue(ctx, "kid", kid, "")
+			return nil, errs.InvalidFlagValue(ctx, "kid", kid, "")
 		}
 	}
 
@@ -321,56 +466,63 @@ func newTokenFlow(ctx *cli.Context, subject string, sans []string, caURL, root,
 			return p.GetName() == issuer
 		})
 		if len(provisioners) == 0 {
-			return "", errs.InvalidFlagValue(ctx, "issuer", issuer, "")
+			return nil, errs.InvalidFlagValue(ctx, "issuer", issuer, "")
 		}
 	}
 
-	if len(provisioners) == 1 {
-		p := provisioners[0].(*provisioner.JWK)
-		kid = p.Key.KeyID
-		issuer = p.Name
-		// Prints kid/issuer used
-		if err := ui.PrintSelected("Key ID", kid+" ("+issuer+")"); err != nil {
-			return "", err
-		}
-	} else {
-		var items []*provisionersSelect
-		for _, prov := range provisioners {
-			switch p := prov.(type) {
-			case *provisioner.JWK:
-				items = append(items, &provisionersSelect{
-					Name:        p.Key.KeyID + " (" + p.Name + ")",
-					Issuer:      p.Name,
-					JWK:         *p.Key,
-					Provisioner: p,
-				})
-			case *provisioner.OIDC:
-				items = append(items, &provisionersSelect{
-					Name:        p.ClientID + " (" + p.Name + ")",
-					Issuer:      p.Name,
-					Provisioner: p,
-				})
-			default:
-				continue
-			}
-		}
-		i, _, err := ui.Select("What provisioner key do you want to use?", items, ui.WithSelectTemplates(ui.NamedSelectTemplates("Key ID")))
-		if err != nil {
-			return "", err
+	var items []*provisionersSelect
+	for _, prov := range provisioners {
+		switch p := prov.(type) {
+		case *provisioner.JWK:
+			items = append(items, &provisionersSelect{
+				Name:        p.Key.KeyID + " (" + p.Name + ")",
+				Issuer:      p.Name,
+				JWK:         *p.Key,
+				Provisioner: p,
+			})
+		case *provisioner.OIDC:
+			items = append(items, &provisionersSelect{
+				Name:        p.ClientID + " (" + p.Name + ")",
+				Issuer:      p.Name,
+				Provisioner: p,
+			})
 		}
+	}
 
-		if p, ok := items[i].Provisioner.(*provisioner.OIDC); ok {
-			out, err := exec.Step("oauth", "--oidc", "--bare",
-				"--provider", p.ConfigurationEndpoint,
-				"--client-id", p.ClientID, "--client-secret", p.ClientSecret)
-			if err != nil {
-				return "", err
-			}
-			return string(out), nil
+	if len(items) == 1 {
+		// Prints kid/issuer used
+		if err := ui.PrintSelected("Key ID", items[0].Name); err != nil {
+			return nil, err
 		}
+		return items[0].Provisioner, nil
+	}
+
+	i, _, err := ui.Select("What provisioner key do you want to use?", items, ui.WithSelectTemplates(ui.NamedSelectTemplates("Key ID")), ui.WithFlag("kid"))
+	if err != nil {
+		return nil, err
+	}
+	return items[i].Provisioner, nil
+}
 
-		kid = items[i].JWK.KeyID
-		issuer = items[i].Issuer
+// tokenSigner generates tokens with the key of a JWK provisioner. The key is
+// decrypted once, so multiple tokens can be generated with only one password
+// prompt.
+type tokenSigner struct {
+	kid, issuer, audience, root string
+	notBefore, notAfter         time.Time
+	jwk                         *jose.JSONWebKey
+	// validateNames, if set, checks that the names of a token are allowed by
+	// the policies of the CA, it's only available with an offline CA.
+	validateNames func(names []string) error
+}
+
+// newTokenSigner returns a tokenSigner for the given provisioner. If keyFile
+// is empty the encrypted key of the provisioner is downloaded from the CA.
+func newTokenSigner(ctx *cli.Context, p *provisioner.JWK, caURL, root, passwordFile, keyFile string, notBefore, notAfter time.Time) (*tokenSigner, error) {
+	// Get audience from ca-url
+	audience, err := parseAudience(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	var opts []jose.Option
@@ -378,37 +530,67 @@ func newTokenFlow(ctx *cli.Context, subject string, sans []string, caURL, root,
 		opts = append(opts, jose.WithPasswordFile(passwordFile))
 	}
 
+	kid := p.Key.KeyID
 	var jwk *jose.JSONWebKey
 	if len(keyFile) == 0 {
 		// Get private key from CA
-		encrypted, err := pki.GetProvisionerKey(caURL, root, kid)
+		var encrypted string
+		if fingerprint := ctx.String("fingerprint"); root == "" && fingerprint != "" {
+			encrypted, err = pki.GetProvisionerKeyWithFingerprint(caURL, fingerprint, kid)
+		} else {
+			encrypted, err = pki.GetProvisionerKey(caURL, root, kid)
+		}
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		// Add template with check mark
 		opts = append(opts, jose.WithUIOptions(
 			ui.WithPromptTemplates(ui.PromptTemplates()),
+			ui.WithFlag("password-file"),
 		))
 
 		decrypted, err := jose.Decrypt("Please enter the password to decrypt the provisioner key", []byte(encrypted), opts...)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		jwk = new(jose.JSONWebKey)
 		if err := json.Unmarshal(decrypted, jwk); err != nil {
-			return "", errors.Wrap(err, "error unmarshalling provisioning key")
+			return nil, errors.Wrap(err, "error unmarshalling provisioning key")
 		}
 	} else {
 		// Get private key from given key file
 		jwk, err = jose.ParseKey(keyFile, opts...)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
-	return generateToken(subject, sans, kid, issuer, audience, root, notBefore, notAfter, jwk)
+	return &tokenSigner{
+		kid:       kid,
+		issuer:    p.Name,
+		audience:  audience,
+		root:      root,
+		notBefore: notBefore,
+		notAfter:  notAfter,
+		jwk:       jwk,
+	}, nil
+}
+
+// Token generates a token for the given subject and SANs.
+func (s *tokenSigner) Token(ctx *cli.Context, subject string, sans []string) (string, error) {
+	if s.validateNames != nil {
+		// Without SANs the subject is the only name in the certificate.
+		names := sans
+		if len(names) == 0 {
+			names = []string{subject}
+		}
+		if err := s.validateNames(names); err != nil {
+			return "", err
+		}
+	}
+	return generateToken(ctx, subject, sans, s.kid, s.issuer, s.audience, s.root, s.notBefore, s.notAfter, s.jwk)
 }
 
 // offlineTokenFlow generates a provisioning token using either
@@ -423,7 +605,7 @@ func offlineTokenFlow(ctx *cli.Context, subject string, sans []string) (string,
 
 	// Using the offline CA
 	if utils.FileExists(caConfig) {
-		offlineCA, err := newOfflineCA(caConfig)
+		offlineCA, err := newOfflineClient(ctx)
 		if err != nil {
 			return "", err
 		}
@@ -464,6 +646,23 @@ func offlineTokenFlow(ctx *cli.Context, subject string, sans []string) (string,
 		}
 	}
 
+	// Keys in an HSM or a cloud KMS are used through a crypto.Signer
+	if kms.IsURI(keyFile) {
+		signer, err := kms.NewSigner(keyFile)
+		if err != nil {
+			return "", err
+		}
+		pub, err := jose.PublicJWK(signer.Public())
+		if err != nil {
+			return "", err
+		}
+		if len(kid) == 0 {
+			kid = pub.KeyID
+		}
+		jwk := &jose.JSONWebKey{Key: signer, Algorithm: pub.Algorithm}
+		return generateToken(ctx, subject, sans, kid, issuer, audience, root, notBefore, notAfter, jwk)
+	}
+
 	// Parse key
 	var opts []jose.Option
 	if len(passwordFile) != 0 {
@@ -483,7 +682,7 @@ func offlineTokenFlow(ctx *cli.Context, subject string, sans []string) (string,
 		kid = base64.RawURLEncoding.EncodeToString(hash)
 	}
 
-	return generateToken(subject, sans, kid, issuer, audience, root, notBefore, notAfter, jwk)
+	return generateToken(ctx, subject, sans, kid, issuer, audience, root, notBefore, notAfter, jwk)
 }
 
 // provisionerFilter returns a slice of provisioners that pass the given filter.
@@ -496,3 +695,67 @@ func provisionerFilter(provisioners provisioner.List, f func(provisioner.Interfa
 	}
 	return result
 }
+
+// inspectTokenAction prints the claims of the token in the arguments or
+// STDIN, without verifying it, to debug tokens rejected by the CA.
+func inspectTokenAction(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errs.TooManyArguments(ctx)
+	}
+
+	tok := ctx.Args().Get(0)
+	if tok == "" {
+		var err error
+		if tok, err = utils.ReadString(os.Stdin); err != nil {
+			return err
+		}
+	}
+
+	jwt, err := jose.ParseSigned(tok)
+	if err != nil {
+		return errors.Wrap(jose.TrimPrefix(err), "error parsing token")
+	}
+	var claims tokenClaims
+	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return errors.Wrap(jose.TrimPrefix(err), "error parsing token")
+	}
+
+	ui.Println("WARNING: the token has not been verified, do not trust its contents.")
+	ui.PrintSelected("Issuer", claims.Issuer)
+	ui.PrintSelected("Audience", strings.Join(claims.Audience, ", "))
+	ui.PrintSelected("Subject", claims.Subject)
+	if len(claims.SANs) > 0 {
+		ui.PrintSelected("SANs", strings.Join(claims.SANs, ", "))
+	}
+	if emails := claims.emails(); len(emails) > 0 {
+		ui.PrintSelected("Emails", strings.Join(emails, ", "))
+	}
+	if claims.SHA != "" {
+		ui.PrintSelected("SHA", claims.SHA)
+	}
+	if len(jwt.Headers) > 0 && jwt.Headers[0].KeyID != "" {
+		ui.PrintSelected("Key ID", jwt.Headers[0].KeyID)
+	}
+
+	now := time.Now()
+	if claims.IssuedAt != 0 {
+		ui.PrintSelected("Issued At", claims.IssuedAt.Time().UTC().Format(time.RFC3339))
+	}
+	if claims.NotBefore != 0 {
+		nbf := claims.NotBefore.Time()
+		status := fmt.Sprintf("valid since %s", now.Sub(nbf).Round(time.Second))
+		if nbf.After(now) {
+			status = fmt.Sprintf("not valid for %s", nbf.Sub(now).Round(time.Second))
+		}
+		ui.PrintSelected("Not Before", fmt.Sprintf("%s (%s)", nbf.UTC().Format(time.RFC3339), status))
+	}
+	if claims.Expiry != 0 {
+		exp := claims.Expiry.Time()
+		status := fmt.Sprintf("expires in %s", exp.Sub(now).Round(time.Second))
+		if !exp.After(now) {
+			status = fmt.Sprintf("expired %s ago", now.Sub(exp).Round(time.Second))
+		}
+		ui.PrintSelected("Expires", fmt.Sprintf("%s (%s)", exp.UTC().Format(time.RFC3339), status))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package ca
+
+import (
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/vault"
+	"github.com/urfave/cli"
+)
+
+var (
+	vaultFlag = cli.StringFlag{
+		Name: "vault",
+		Usage: `Write the certificate and private key to the HashiCorp Vault secret in
+<mount/path>, e.g. 'secret/step/internal', instead of files. The secret has the
+fields 'certificate', 'issuing_ca' and 'private_key', and other fields in the
+secret are kept. Both versions of the key/value secrets engine are supported.
+The address and token of Vault are read from VAULT_ADDR and VAULT_TOKEN.`,
+	}
+
+	vaultRoleFlag = cli.StringFlag{
+		Name: "vault-role",
+		Usage: `The <role> used to log in to HashiCorp Vault using the Kubernetes auth method,
+with the service account token of the pod. Requires the **--vault** flag.`,
+	}
+
+	vaultAuthMountFlag = cli.StringFlag{
+		Name:  "vault-auth-mount",
+		Usage: `The <path> where the Kubernetes auth method is enabled in HashiCorp Vault.`,
+		Value: vault.DefaultKubernetesMount,
+	}
+)
+
+// newVaultClient validates the --vault flags and returns a Vault client and
+// the path of the secret. It returns a nil client if the --vault flag is not
+// set.
+func newVaultClient(ctx *cli.Context) (*vault.Client, string, error) {
+	vaultPath := ctx.String("vault")
+	if vaultPath == "" {
+		for _, f := range []string{"vault-role", "vault-auth-mount"} {
+			if ctx.IsSet(f) {
+				return nil, "", errs.RequiredWithFlag(ctx, f, "vault")
+			}
+		}
+		return nil, "", nil
+	}
+	vaultPath, err := vault.ParsePath(vaultPath)
+	if err != nil {
+		return nil, "", errs.InvalidFlagValue(ctx, "vault", ctx.String("vault"), "")
+	}
+
+	var opts []vault.Option
+	if role := ctx.String("vault-role"); role != "" {
+		opts = append(opts, vault.WithKubernetesAuth(role, ctx.String("vault-auth-mount")))
+	}
+	client, err := vault.NewClient(opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, vaultPath, nil
+}
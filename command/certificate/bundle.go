@@ -2,10 +2,12 @@ package certificate
 
 import (
 	"encoding/pem"
-	"io/ioutil"
+	"fmt"
+	"os"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/ui"
@@ -22,6 +24,10 @@ func bundleCommand() cli.Command {
 		Description: `**step certificate bundle** bundles a certificate
 		with any intermediates necessary to validate the certificate.
 
+The certificates can be PEM or DER encoded, and <ca> can contain more than one
+certificate, e.g. an intermediate and the certificate that signed it. The bundle
+is always written in PEM format.
+
 ## POSITIONAL ARGUMENTS
 
 <crt_file>
@@ -44,42 +50,139 @@ Bundle a certificate with the intermediate certificate authority (issuer):
 '''
 $ step certificate bundle foo.crt intermediate-ca.crt foo-bundle.crt
 '''
+
+Bundle a certificate with two levels of intermediates:
+
+'''
+$ cat intermediate-ca.crt issuing-ca.crt > chain.crt
+$ step certificate bundle foo.crt chain.crt foo-bundle.crt
+'''
 `,
 		Flags: []cli.Flag{flags.Force},
 	}
 }
 
+func unbundleCommand() cli.Command {
+	return cli.Command{
+		Name:   "unbundle",
+		Action: command.ActionFunc(unbundleAction),
+		Usage:  `split a certificate bundle into its certificates`,
+		UsageText: `**step certificate unbundle** <bundle_file>
+		[**--prefix**=<prefix>] [**--index**=<n>]`,
+		Description: `**step certificate unbundle** splits a certificate bundle into the
+certificates that it contains. By default the certificates are printed to
+STDOUT in PEM format. If **--prefix** is used, each certificate is written to
+a numbered file, starting at 0 for the first certificate in the bundle.
+
+## POSITIONAL ARGUMENTS
+
+<bundle_file>
+: The path to a PEM or DER encoded certificate bundle.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Split a bundle into foo_0.crt, foo_1.crt, ...:
+
+'''
+$ step certificate unbundle --prefix foo_ foo-bundle.crt
+Your certificate has been saved in foo_0.crt.
+Your certificate has been saved in foo_1.crt.
+'''
+
+Print the intermediate of a bundle:
+
+'''
+$ step certificate unbundle --index 1 foo-bundle.crt
+'''
+`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "prefix",
+				Usage: `Write each certificate to a file named <prefix>\<n\>.crt, where \<n\> is the
+position of the certificate in the bundle.`,
+			},
+			cli.IntFlag{
+				Name:  "index",
+				Value: -1,
+				Usage: `Only output the certificate at position <n> in the bundle, starting at 0.`,
+			},
+			flags.Force,
+		},
+	}
+}
+
 func bundleAction(ctx *cli.Context) error {
 	if err := errs.NumberOfArguments(ctx, 3); err != nil {
 		return err
 	}
 
 	crtFile := ctx.Args().Get(0)
-	crtBytes, err := ioutil.ReadFile(crtFile)
+	// Only the first certificate of crtFile is used
+	crts, err := pemutil.ReadCertificateBundle(crtFile)
 	if err != nil {
-		return errs.FileError(err, crtFile)
-	}
-	crtBlock, _ := pem.Decode(crtBytes)
-	if crtBlock == nil {
-		return errors.Errorf("could not parse certificate file '%s'", crtFile)
+		return err
 	}
+	crt := crts[0]
 
 	caFile := ctx.Args().Get(1)
-	caBytes, err := ioutil.ReadFile(caFile)
+	cas, err := pemutil.ReadCertificateBundle(caFile)
 	if err != nil {
-		return errs.FileError(err, caFile)
+		return err
 	}
-	caBlock, _ := pem.Decode(caBytes)
-	if caBlock == nil {
-		return errors.Errorf("could not parse certificate file '%s'", caFile)
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})
+	for _, ca := range cas {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})...)
 	}
 
 	chainFile := ctx.Args().Get(2)
-	if err := utils.WriteFile(chainFile,
-		append(pem.EncodeToMemory(crtBlock), pem.EncodeToMemory(caBlock)...), 0600); err != nil {
+	if err := utils.WriteFile(chainFile, chain, 0600); err != nil {
 		return err
 	}
 
 	ui.Printf("Your certificate has been saved in %s.\n", chainFile)
 	return nil
 }
+
+func unbundleAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	bundleFile := ctx.Args().Get(0)
+	certs, err := pemutil.ReadCertificateBundle(bundleFile)
+	if err != nil {
+		return err
+	}
+
+	var indexes []int
+	switch index := ctx.Int("index"); {
+	case index < -1 || index >= len(certs):
+		return errors.Errorf("flag '--index' must be between 0 and %d", len(certs)-1)
+	case index == -1:
+		for i := range certs {
+			indexes = append(indexes, i)
+		}
+	default:
+		indexes = []int{index}
+	}
+
+	prefix := ctx.String("prefix")
+	for _, i := range indexes {
+		b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[i].Raw})
+		if prefix == "" {
+			os.Stdout.Write(b)
+			continue
+		}
+		filename := fmt.Sprintf("%s%d.crt", prefix, i)
+		if err := utils.WriteFile(filename, b, 0600); err != nil {
+			return err
+		}
+		ui.Printf("Your certificate has been saved in %s.\n", filename)
+	}
+	return nil
+}
@@ -82,12 +82,19 @@ $ step certificate uninstall root-ca.crt
 
 		Subcommands: cli.Commands{
 			bundleCommand(),
+			chainCommand(),
+			unbundleCommand(),
 			createCommand(),
+			csrCommand(),
+			command.StructuredOutput(ctCommand()),
 			formatCommand(),
-			inspectCommand(),
+			command.StructuredOutput(inspectCommand()),
 			fingerprintCommand(),
-			lintCommand(),
+			command.StructuredOutput(lintCommand()),
+			needsRenewalCommand(),
+			monitorCommand(),
 			signCommand(),
+			stapleCommand(),
 			verifyCommand(),
 			keyCommand(),
 			installCommand(),
@@ -0,0 +1,264 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+// maxChainLength is the maximum number of certificates that the chain command
+// will follow.
+const maxChainLength = 10
+
+func chainCommand() cli.Command {
+	return cli.Command{
+		Name:   "chain",
+		Action: command.ActionFunc(chainAction),
+		Usage:  "build a complete certificate chain using the Authority Information Access",
+		UsageText: `**step certificate chain** <crt-file>
+		[**--out**=<file>] [**--roots**=<root-bundle>] [**--include-root**]
+		[**--servername**=<name>] [**--insecure**]`,
+		Description: `**step certificate chain** builds the certificate chain of a certificate,
+fetching the missing intermediates from the URLs in the caIssuers field of the
+Authority Information Access (AIA) extension. The chain is validated and the
+bundle with the certificate followed by its intermediates is printed to STDOUT
+or written to a file.
+
+Certificates after the first one in <crt-file> are used before fetching
+anything from the network, so an incomplete bundle can also be fixed.
+
+This command can be used to fix servers that send an incomplete chain, that
+will fail with some clients that don't fetch the missing intermediates
+themselves.
+
+## POSITIONAL ARGUMENTS
+
+<crt-file>
+:  The path to a certificate or certificate bundle, or the address of a remote
+server.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Build the chain of a certificate and write it to a file:
+'''
+$ step certificate chain leaf.crt --out bundle.crt
+'''
+
+Build the chain of a remote server that sends an incomplete chain:
+'''
+$ step certificate chain https://incomplete-chain.badssl.com
+'''
+
+Build the chain of a certificate issued by an internal CA, including the root:
+'''
+$ step certificate chain --roots root_ca.crt --include-root leaf.crt
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "out",
+				Usage: "The <file> to write the bundle. Defaults to STDOUT.",
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) that will be used to validate the chain. Defaults to the
+operating system's root certificate bundle.`,
+			},
+			cli.BoolFlag{
+				Name:  "include-root",
+				Usage: "Add the root certificate at the end of the bundle.",
+			},
+			cli.BoolFlag{
+				Name: "insecure",
+				Usage: `Do not validate the chain. The chain will end with the last certificate that
+could be fetched.`,
+			},
+			serverNameFlag,
+			flags.Force,
+		},
+	}
+}
+
+func chainAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	var (
+		err      error
+		certs    []*x509.Certificate
+		crtFile  = ctx.Args().First()
+		roots    = ctx.String("roots")
+		insecure = ctx.Bool("insecure")
+	)
+
+	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
+		// The chain sent by the server is probably incomplete, do not verify it
+		certs, err = getPeerCertificates(addr, ctx.String("servername"), "", true)
+	} else {
+		certs, err = pemutil.ReadCertificateBundle(crtFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	var rootPool *x509.CertPool
+	if roots != "" {
+		if rootPool, err = x509util.ReadCertPool(roots); err != nil {
+			return errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
+		}
+	}
+
+	chain, err := buildChain(certs[0], certs[1:])
+	if err != nil {
+		return err
+	}
+
+	if !insecure {
+		intermediates := x509.NewCertPool()
+		for _, crt := range chain[1:] {
+			intermediates.AddCert(crt)
+		}
+		chains, err := chain[0].Verify(x509.VerifyOptions{
+			Roots:         rootPool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to verify certificate chain")
+		}
+		// Use the verified chain, it might be shorter if a fetched
+		// intermediate is already trusted.
+		chain = chains[0]
+		if !ctx.Bool("include-root") {
+			chain = chain[:len(chain)-1]
+		}
+	} else if last := chain[len(chain)-1]; len(chain) > 1 && !ctx.Bool("include-root") && isSelfSigned(last) {
+		chain = chain[:len(chain)-1]
+	}
+
+	var b []byte
+	for _, crt := range chain {
+		b = append(b, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+
+	if out := ctx.String("out"); out != "" {
+		if err := utils.WriteFile(out, b, 0600); err != nil {
+			return err
+		}
+		ui.Printf("Your certificate chain has been saved in %s.\n", out)
+		return nil
+	}
+
+	os.Stdout.Write(b)
+	return nil
+}
+
+// buildChain returns the chain for the given certificate using the given
+// certificates, or fetching the issuers using the AIA extension. The chain
+// stops at the first self-signed certificate or when the certificate does
+// not have a caIssuers URL.
+func buildChain(leaf *x509.Certificate, certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	chain := []*x509.Certificate{leaf}
+	for crt := leaf; len(chain) < maxChainLength; {
+		if isSelfSigned(crt) {
+			return chain, nil
+		}
+
+		issuer := findIssuer(crt, certs)
+		if issuer == nil {
+			if len(crt.IssuingCertificateURL) == 0 {
+				return chain, nil
+			}
+			var err error
+			if issuer, err = fetchIssuer(crt); err != nil {
+				return nil, err
+			}
+		}
+
+		chain = append(chain, issuer)
+		crt = issuer
+	}
+	return nil, errors.Errorf("certificate chain is longer than %d certificates", maxChainLength)
+}
+
+// findIssuer returns the certificate in certs that signed the given
+// certificate, or nil if there is none.
+func findIssuer(crt *x509.Certificate, certs []*x509.Certificate) *x509.Certificate {
+	for _, c := range certs {
+		if bytes.Equal(crt.RawIssuer, c.RawSubject) && crt.CheckSignatureFrom(c) == nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// fetchIssuer downloads the issuer of the given certificate from its caIssuers
+// URLs. The response can be a DER or PEM certificate, or a PKCS#7 bundle.
+func fetchIssuer(crt *x509.Certificate) (*x509.Certificate, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	var lastErr error
+	for _, u := range crt.IssuingCertificateURL {
+		certs, err := fetchCertificates(client, u)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if issuer := findIssuer(crt, certs); issuer != nil {
+			return issuer, nil
+		}
+		lastErr = errors.Errorf("%s does not contain the issuer of '%s'", u, crt.Subject.CommonName)
+	}
+	return nil, lastErr
+}
+
+func fetchCertificates(client *http.Client, u string) ([]*x509.Certificate, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error downloading %s: %s", u, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", u)
+	}
+
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	if crt, err := x509.ParseCertificate(b); err == nil {
+		return []*x509.Certificate{crt}, nil
+	}
+	certs, err := pemutil.ParsePKCS7Certificates(b)
+	if err != nil {
+		return nil, errors.Errorf("error parsing %s: unsupported format", u)
+	}
+	return certs, nil
+}
+
+func isSelfSigned(crt *x509.Certificate) bool {
+	return bytes.Equal(crt.RawIssuer, crt.RawSubject) && crt.CheckSignatureFrom(crt) == nil
+}
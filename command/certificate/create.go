@@ -25,13 +25,42 @@ func createCommand() cli.Command {
 		Usage:  "create a certificate or certificate signing request",
 		UsageText: `**step certificate create** <subject> <crt_file> <key_file>
 [**ca**=<issuer-cert>] [**ca-key**=<issuer-key>] [**--csr**]
-[**--curve**=<curve>] [**no-password**] [**--profile**=<profile>]
-[**--size**=<size>] [**--type**=<type>] [**--san**=<SAN>]`,
+[**--curve**=<curve>] [**no-password**] [**--password-gen**[=<length>]] [**--profile**=<profile>]
+[**--size**=<size>] [**--type**=<type>] [**--san**=<SAN>] [**--wildcard**]
+[**--key-usage**=<usage>] [**--eku**=<usage>] [**--extension**=<extension>]
+[**--template**=<file>] [**--name-constraint-permit**=<subtree>]
+[**--name-constraint-exclude**=<subtree>]`,
 		Description: `**step certificate create** generates a certificate or a
 certificate signing requests (CSR) that can be signed later using 'step
 certificates sign' (or some other tool) to produce a certificate.
 
-This command creates x.509 certificates for use with TLS.
+This command creates x.509 certificates for use with TLS. The key usage,
+extended key usage, name constraints and arbitrary extensions of the
+certificate or CSR can be customized using flags or a JSON template file, so
+profiles for other uses, like code signing or IPSec, can be created too.
+
+The template file has the following format, all the fields are optional:
+
+'''
+{
+  "keyUsage": ["digital-signature"],
+  "extKeyUsage": ["code-signing"],
+  "nameConstraints": {
+    "critical": true,
+    "permittedDNSDomains": ["example.com"],
+    "excludedIPRanges": ["10.0.0.0/8"]
+  },
+  "extensions": [
+    {"id": "1.2.3.4", "critical": false, "value": "hex:0500"}
+  ]
+}
+'''
+
+The name constraints can use the fields **permittedDNSDomains**,
+**excludedDNSDomains**, **permittedIPRanges**, **excludedIPRanges**,
+**permittedEmailAddresses**, **excludedEmailAddresses**,
+**permittedURIDomains** and **excludedURIDomains**. Name constraints are not
+supported in CSRs. Values set using flags replace the ones in the template.
 
 ## POSITIONAL ARGUMENTS
 
@@ -75,6 +104,13 @@ Create a root certificate and key:
 $ step certificate create root-ca root-ca.crt root-ca.key --profile root-ca
 '''
 
+Create a self-signed leaf certificate and key:
+
+'''
+$ step certificate create self-signed.smallstep.com foo.crt foo.key --profile self-signed \
+  --subtle
+'''
+
 Create an intermediate certificate and key:
 
 '''
@@ -90,6 +126,17 @@ $ step certificate create intermediate-ca intermediate-ca.crt intermediate-ca.ke
   --san inter.smallstep.com --san 1.1.1.1 --san ca.smallstep.com
 '''
 
+Create an intermediate certificate and key that can only issue certificates
+for a domain and a private network:
+
+'''
+$ step certificate create intermediate-ca intermediate-ca.crt intermediate-ca.key \
+  --profile intermediate-ca --ca ./root-ca.crt --ca-key ./root-ca.key \
+  --name-constraint-permit dns:internal.smallstep.com \
+  --name-constraint-permit ip:10.0.0.0/8 \
+  --name-constraint-exclude dns:public.internal.smallstep.com
+'''
+
 Create a leaf certificate and key:
 
 '''
@@ -139,6 +186,43 @@ Create a CSR and key with underlying OKP Ed25519:
 '''
 $ step certificate create foo foo.csr foo.key --csr --kty OKP --curve Ed25519
 '''
+
+Create a code signing certificate:
+
+'''
+$ step certificate create "Acme Code Signing" code.crt code.key \
+  --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key \
+  --key-usage digital-signature --eku code-signing
+'''
+
+Create a code signing certificate using the code-signing preset:
+
+'''
+$ step certificate create "Acme Code Signing" code.crt code.key \
+  --profile code-signing --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key
+'''
+
+Create a certificate for a peer in a mutual TLS mesh:
+
+'''
+$ step certificate create peer1.example.com peer1.crt peer1.key \
+  --profile mtls-peer --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key
+'''
+
+Create a CSR for a client certificate with a custom extension:
+
+'''
+$ step certificate create jane jane.csr jane.key --csr --eku client-auth \
+  --extension 1.3.6.1.4.1.37476.9000.64.1=hex:0c046a616e65
+'''
+
+Create a leaf certificate using a template:
+
+'''
+$ step certificate create ipsec.example.com ipsec.crt ipsec.key \
+  --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key \
+  --template ipsec.json
+'''
 `,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -146,8 +230,10 @@ $ step certificate create foo foo.csr foo.key --csr --kty OKP --curve Ed25519
 				Usage: `The certificate authority used to issue the new certificate (PEM file).`,
 			},
 			cli.StringFlag{
-				Name:  "ca-key",
-				Usage: `The certificate authority private key used to sign the new certificate (PEM file).`,
+				Name: "ca-key",
+				Usage: `The certificate authority private key used to sign the new certificate
+(PEM file). It can also be a PKCS #11 URI of a key stored in an HSM, or an
+awskms, cloudkms or azurekms URI of a key stored in a cloud KMS.`,
 			},
 			cli.BoolFlag{
 				Name:  "csr",
@@ -163,6 +249,7 @@ $ step certificate create foo foo.csr foo.key --csr --kty OKP --curve Ed25519
 Sensitive key material will be written to disk unencrypted. This is not
 recommended. Requires **--insecure** flag.`,
 			},
+			flags.PasswordGen,
 			cli.StringFlag{
 				Name:  "profile",
 				Value: "leaf",
@@ -179,7 +266,33 @@ recommended. Requires **--insecure** flag.`,
     :  Generate a certificate that can be used to sign additional leaf or intermediate certificates.
 
     **root-ca**
-    :  Generate a new self-signed root certificate suitable for use as a root CA.`,
+    :  Generate a new self-signed root certificate suitable for use as a root CA.
+
+    **self-signed**
+    :  Generate a new self-signed leaf certificate suitable for use with TLS.
+    This profile requires the **--subtle** flag because the use of self-signed leaf
+    certificates is discouraged unless absolutely necessary.
+
+    **tls-server**
+    :  Generate a leaf certificate for a TLS server, with the **server-auth**
+    extended key usage.
+
+    **tls-client**
+    :  Generate a leaf certificate for a TLS client, with the **client-auth**
+    extended key usage.
+
+    **mtls-peer**
+    :  Generate a leaf certificate for a peer in mutual TLS, with the
+    **server-auth** and **client-auth** extended key usages.
+
+    **code-signing**
+    :  Generate a leaf certificate for code signing, with the **code-signing**
+    extended key usage. The <subject> is not added as a SAN.
+
+: The **tls-server**, **tls-client**, **mtls-peer** and **code-signing** presets
+use the **digital-signature** key usage, and **key-encipherment** for RSA keys
+in TLS servers. The **--key-usage** and **--eku** flags replace the usages of
+the preset. Unlike the other profiles, presets can be used with **--csr**.`,
 			},
 			cli.StringFlag{
 				Name:  "kty",
@@ -246,7 +359,44 @@ unit suffix, such as "300ms", "-1.5h" or "2h45m". Valid time units are "ns",
 				Usage: `Add DNS or IP Address Subjective Alternative Names (SANs). Use the '--san'
 flag multiple times to configure multiple SANs.`,
 			},
+			flags.Wildcard,
+			cli.StringSliceFlag{
+				Name: "key-usage",
+				Usage: `The key <usage> of the certificate, replacing the default of the profile. Use
+the '--key-usage' flag multiple times to add multiple usages.
+
+: <usage> is a case-insensitive string and must be one of:
+
+    **digital-signature**, **content-commitment** (or **non-repudiation**),
+    **key-encipherment**, **data-encipherment**, **key-agreement**,
+    **cert-sign**, **crl-sign**, **encipher-only** or **decipher-only**.`,
+			},
+			cli.StringSliceFlag{
+				Name: "eku",
+				Usage: `The extended key <usage> of the certificate, replacing the default of the
+profile. Use the '--eku' flag multiple times to add multiple usages.
+
+: <usage> is a case-insensitive string and must be one of:
+
+    **server-auth**, **client-auth**, **code-signing**, **email-protection**,
+    **time-stamping**, **ocsp-signing**, **ipsec-end-system**, **ipsec-tunnel**,
+    **ipsec-user**, **any**, or an object identifier in dotted notation.`,
+			},
+			cli.StringSliceFlag{
+				Name: "extension",
+				Usage: `Add a custom <extension> in the format '<oid>[,critical]=<value>', where
+<value> is the DER-encoded value of the extension in base64, or in hexadecimal
+using the 'hex:' prefix. Use the '--extension' flag multiple times to add
+multiple extensions.`,
+			},
+			cli.StringFlag{
+				Name:  "template",
+				Usage: `The JSON <file> with the key usages, name constraints and extensions.`,
+			},
+			flags.NameConstraintPermit,
+			flags.NameConstraintExclude,
 			flags.Force,
+			flags.Subtle,
 		},
 	}
 }
@@ -261,6 +411,9 @@ func createAction(ctx *cli.Context) error {
 	if noPass && !insecure {
 		return errs.RequiredWithFlag(ctx, "insecure", "no-password")
 	}
+	if noPass && ctx.IsSet("password-gen") {
+		return errs.IncompatibleFlagWithFlag(ctx, "no-password", "password-gen")
+	}
 
 	subject := ctx.Args().Get(0)
 	crtFile := ctx.Args().Get(1)
@@ -293,12 +446,26 @@ func createAction(ctx *cli.Context) error {
 		return err
 	}
 
+	// Presets are leaf certificates with the key usages of a common use.
+	preset, isPreset := x509util.GetPreset(ctx.String("profile"))
+
 	sans := ctx.StringSlice("san")
-	if len(sans) == 0 {
+	if len(sans) == 0 && (!isPreset || preset.SubjectSAN) {
 		sans = []string{subject}
 	}
+	if err := x509util.ValidateSANs(sans, ctx.Bool("wildcard")); err != nil {
+		return err
+	}
 	dnsNames, ips := x509util.SplitSANs(sans)
 
+	extensions, err := getExtensions(ctx)
+	if err != nil {
+		return err
+	}
+	if isPreset {
+		extensions = preset.Apply(extensions, kty)
+	}
+
 	var (
 		priv       interface{}
 		pubPEM     *pem.Block
@@ -306,7 +473,7 @@ func createAction(ctx *cli.Context) error {
 	)
 	switch typ {
 	case "x509-csr":
-		if ctx.IsSet("profile") {
+		if ctx.IsSet("profile") && !isPreset {
 			return errs.IncompatibleFlagWithFlag(ctx, "profile", "csr")
 		}
 		priv, err = keys.GenerateKey(kty, crv, size)
@@ -321,6 +488,9 @@ func createAction(ctx *cli.Context) error {
 			DNSNames:    dnsNames,
 			IPAddresses: ips,
 		}
+		if _csr.ExtraExtensions, err = extensions.CSRExtensions(); err != nil {
+			return err
+		}
 		csrBytes, err := x509.CreateCertificateRequest(rand.Reader, _csr, priv)
 		if err != nil {
 			return errors.WithStack(err)
@@ -339,8 +509,12 @@ func createAction(ctx *cli.Context) error {
 			caPath    = ctx.String("ca")
 			caKeyPath = ctx.String("ca-key")
 			profile   x509util.Profile
+			base      = prof
 		)
-		switch prof {
+		if isPreset {
+			base = "leaf"
+		}
+		switch base {
 		case "leaf", "intermediate-ca":
 			if caPath == "" {
 				return errs.RequiredWithFlagValue(ctx, "profile", prof, "ca")
@@ -348,7 +522,7 @@ func createAction(ctx *cli.Context) error {
 			if caKeyPath == "" {
 				return errs.RequiredWithFlagValue(ctx, "profile", prof, "ca-key")
 			}
-			switch prof {
+			switch base {
 			case "leaf":
 				issIdentity, err := loadIssuerIdentity(ctx, prof, caPath, caKeyPath)
 				if err != nil {
@@ -358,7 +532,8 @@ func createAction(ctx *cli.Context) error {
 					issIdentity.Key, x509util.GenerateKeyPair(kty, crv, size),
 					x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
 					x509util.WithDNSNames(dnsNames),
-					x509util.WithIPAddresses(ips))
+					x509util.WithIPAddresses(ips),
+					x509util.WithExtensions(extensions))
 				if err != nil {
 					return errors.WithStack(err)
 				}
@@ -375,22 +550,37 @@ func createAction(ctx *cli.Context) error {
 					x509util.GenerateKeyPair(kty, crv, size),
 					x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
 					x509util.WithDNSNames(dnsNames),
-					x509util.WithIPAddresses(ips))
+					x509util.WithIPAddresses(ips),
+					x509util.WithExtensions(extensions))
 				if err != nil {
 					return errors.WithStack(err)
 				}
 			}
+		case "self-signed":
+			if !ctx.Bool("subtle") {
+				return errs.RequiredWithFlagValue(ctx, "profile", prof, "subtle")
+			}
+			profile, err = x509util.NewSelfSignedLeafProfile(subject,
+				x509util.GenerateKeyPair(kty, crv, size),
+				x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
+				x509util.WithDNSNames(dnsNames),
+				x509util.WithIPAddresses(ips),
+				x509util.WithExtensions(extensions))
+			if err != nil {
+				return errors.WithStack(err)
+			}
 		case "root-ca":
 			profile, err = x509util.NewRootProfile(subject,
 				x509util.GenerateKeyPair(kty, crv, size),
 				x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
 				x509util.WithDNSNames(dnsNames),
-				x509util.WithIPAddresses(ips))
+				x509util.WithIPAddresses(ips),
+				x509util.WithExtensions(extensions))
 			if err != nil {
 				return errors.WithStack(err)
 			}
 		default:
-			return errs.InvalidFlagValue(ctx, "profile", prof, "leaf, intermediate-ca, root-ca")
+			return errs.InvalidFlagValue(ctx, "profile", prof, "leaf, intermediate-ca, root-ca, self-signed, "+x509util.PresetNames())
 		}
 		crtBytes, err := profile.CreateCertificate()
 		if err != nil {
@@ -417,7 +607,11 @@ func createAction(ctx *cli.Context) error {
 			return errors.WithStack(err)
 		}
 	} else {
-		pass, err := ui.PromptPassword("Please enter the password to encrypt the private key")
+		password, err := utils.GetNewPasswordFromCLI(ctx, "")
+		if err != nil {
+			return err
+		}
+		pass, err := ui.PromptPassword("Please enter the password to encrypt the private key", ui.WithValue(password), ui.WithValidateEntropy())
 		if err != nil {
 			return errors.Wrap(err, "error reading password")
 		}
@@ -434,6 +628,63 @@ func createAction(ctx *cli.Context) error {
 	return nil
 }
 
+// getExtensions returns the extensions in the template file, replacing the
+// values set with flags.
+func getExtensions(ctx *cli.Context) (*x509util.Extensions, error) {
+	extensions := new(x509util.Extensions)
+	if filename := ctx.String("template"); filename != "" {
+		var err error
+		if extensions, err = x509util.ReadExtensionsTemplate(filename); err != nil {
+			return nil, err
+		}
+	}
+	if v := ctx.StringSlice("key-usage"); len(v) > 0 {
+		if _, err := x509util.ParseKeyUsage(v); err != nil {
+			return nil, errors.Wrap(err, "error parsing flag '--key-usage'")
+		}
+		extensions.KeyUsage = v
+	}
+	if v := ctx.StringSlice("eku"); len(v) > 0 {
+		if _, _, err := x509util.ParseExtKeyUsage(v); err != nil {
+			return nil, errors.Wrap(err, "error parsing flag '--eku'")
+		}
+		extensions.ExtKeyUsage = v
+	}
+	if v := ctx.StringSlice("extension"); len(v) > 0 {
+		extensions.Extensions = nil
+		for _, s := range v {
+			ext, err := x509util.ParseExtension(s)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing flag '--extension'")
+			}
+			extensions.Extensions = append(extensions.Extensions, ext)
+		}
+	}
+
+	permitted := ctx.StringSlice("name-constraint-permit")
+	excluded := ctx.StringSlice("name-constraint-exclude")
+	if len(permitted) > 0 || len(excluded) > 0 {
+		flag := "name-constraint-permit"
+		if len(permitted) == 0 {
+			flag = "name-constraint-exclude"
+		}
+		if ctx.Bool("csr") {
+			return nil, errs.IncompatibleFlagWithFlag(ctx, flag, "csr")
+		}
+		switch prof := ctx.String("profile"); prof {
+		case "intermediate-ca", "root-ca":
+		default:
+			return nil, errs.IncompatibleFlagValue(ctx, flag, "profile", prof)
+		}
+		nc, err := x509util.ParseNameConstraints(permitted, excluded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing flag '--%s'", flag)
+		}
+		extensions.NameConstraints = nc
+	}
+	return extensions, nil
+}
+
 func loadIssuerIdentity(ctx *cli.Context, profile, caPath, caKeyPath string) (*x509util.Identity, error) {
 	if caPath == "" {
 		return nil, errs.RequiredWithFlagValue(ctx, "profile", profile, "ca")
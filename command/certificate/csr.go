@@ -0,0 +1,391 @@
+package certificate
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	x509 "github.com/smallstep/cli/pkg/x509"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func csrCommand() cli.Command {
+	return cli.Command{
+		Name:   "csr",
+		Action: command.ActionFunc(csrAction),
+		Usage:  "create a certificate signing request",
+		UsageText: `**step certificate csr** <subject> <csr-file> [<key-file>]
+[**--key**=<file>] [**--kty**=<type>] [**--curve**=<curve>] [**--size**=<size>]
+[**--san**=<SAN>] [**--organization**=<name>] [**--organizational-unit**=<name>]
+[**--country**=<code>] [**--province**=<name>] [**--locality**=<name>]
+[**--street-address**=<address>] [**--postal-code**=<code>]
+[**--serial-number**=<serial>] [**--profile**=<profile>] [**--key-usage**=<usage>]
+[**--eku**=<usage>] [**--extension**=<extension>] [**--template**=<file>]
+[**--challenge-file**=<file>] [**--no-password**] [**--password-gen**[=<length>]]
+[**--insecure**]`,
+		Description: `**step certificate csr** creates a certificate signing request (CSR) without
+contacting any CA, e.g. to get a certificate signed by a third-party CA.
+
+The CSR uses a new key, written to <key-file>, or the existing key in the
+**--key** flag. All the fields of the subject, the SANs, the requested
+extensions and the challenge password of the request can be set with flags.
+The key usages, extended key usages and extensions can also be set with the
+JSON template file of **step certificate create**.
+
+## POSITIONAL ARGUMENTS
+
+<subject>
+:  The Common Name of the subject of the request.
+
+<csr-file>
+:  File to write the CSR (PEM format)
+
+<key-file>
+:  File to write the new private key (PEM format). It is not used with the
+**--key** flag.
+
+## EXAMPLES
+
+Create a CSR and a new key:
+'''
+$ step certificate csr www.example.com www.csr www.key
+'''
+
+Create a CSR for an organization validated certificate, with multiple SANs:
+'''
+$ step certificate csr www.example.com www.csr www.key \
+  --san www.example.com --san example.com \
+  --organization "Example Inc." --country US --province California \
+  --locality "San Francisco"
+'''
+
+Create a CSR for an existing key:
+'''
+$ step certificate csr www.example.com www.csr --key www.key
+'''
+
+Create a CSR for a TLS client with an RSA key and a challenge password:
+'''
+$ step certificate csr device01 device01.csr device01.key \
+  --profile tls-client --kty RSA --size 3072 --challenge-file challenge.txt
+'''
+
+Create a CSR with a custom extension:
+'''
+$ step certificate csr jane jane.csr jane.key --eku client-auth \
+  --extension 1.3.6.1.4.1.37476.9000.64.1=hex:0c046a616e65
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "key",
+				Usage: `The <file> with the existing private key used to sign the request.`,
+			},
+			cli.StringFlag{
+				Name: "kty",
+				Usage: `The <kty> of the new private key. If unset, default is EC.
+
+: <kty> is a case-sensitive string and must be one of:
+
+    **EC**
+    :  Create an **elliptic curve** keypair
+
+    **OKP**
+    :  Create an octet key pair (for **"Ed25519"** curve)
+
+    **RSA**
+    :  Create an **RSA** keypair`,
+			},
+			cli.StringFlag{
+				Name: "crv, curve",
+				Usage: `The elliptic <curve> to use for EC and OKP key types. If unset, default is
+P-256 for EC keys and Ed25519 for OKP keys.
+
+: <curve> is a case-sensitive string and must be one of:
+
+    **P-256**
+    :  NIST P-256 Curve
+
+    **P-384**
+    :  NIST P-384 Curve
+
+    **P-521**
+    :  NIST P-521 Curve
+
+    **Ed25519**
+    :  Ed25519 Curve`,
+			},
+			cli.IntFlag{
+				Name: "size",
+				Usage: `The <size> (in bits) of the key for RSA key types. RSA keys require a minimum
+key size of 2048 bits. If unset, default is 2048 bits.`,
+			},
+			cli.StringSliceFlag{
+				Name: "san",
+				Usage: `Add DNS, IP Address, Email or URI Subjective Alternative Names (SANs). Use
+the '--san' flag multiple times to configure multiple SANs. If unset, the
+<subject> is used as a SAN.`,
+			},
+			cli.StringSliceFlag{
+				Name:  "organization,o",
+				Usage: `The <name> of the organization (O) of the subject.`,
+			},
+			cli.StringSliceFlag{
+				Name:  "organizational-unit,ou",
+				Usage: `The <name> of the organizational unit (OU) of the subject.`,
+			},
+			cli.StringSliceFlag{
+				Name:  "country,c",
+				Usage: `The two-letter <code> of the country (C) of the subject.`,
+			},
+			cli.StringSliceFlag{
+				Name:  "province,st",
+				Usage: `The <name> of the state or province (ST) of the subject.`,
+			},
+			cli.StringSliceFlag{
+				Name:  "locality,l",
+				Usage: `The <name> of the locality (L) of the subject.`,
+			},
+			cli.StringSliceFlag{
+				Name:  "street-address",
+				Usage: `The street <address> of the subject.`,
+			},
+			cli.StringSliceFlag{
+				Name:  "postal-code",
+				Usage: `The postal <code> of the subject.`,
+			},
+			cli.StringFlag{
+				Name:  "serial-number",
+				Usage: `The <serial> number attribute of the subject, e.g. the serial of a device.`,
+			},
+			cli.StringFlag{
+				Name: "profile",
+				Usage: `The <profile> with the key usages of the request, one of **tls-server**,
+**tls-client**, **mtls-peer** or **code-signing**. See **step certificate create**.`,
+			},
+			cli.StringSliceFlag{
+				Name: "key-usage",
+				Usage: `The key <usage> requested, replacing the default of the profile. Use
+the '--key-usage' flag multiple times to add multiple usages.
+
+: <usage> is a case-insensitive string and must be one of:
+
+    **digital-signature**, **content-commitment** (or **non-repudiation**),
+    **key-encipherment**, **data-encipherment**, **key-agreement**,
+    **cert-sign**, **crl-sign**, **encipher-only** or **decipher-only**.`,
+			},
+			cli.StringSliceFlag{
+				Name: "eku",
+				Usage: `The extended key <usage> requested, replacing the default of the
+profile. Use the '--eku' flag multiple times to add multiple usages.
+
+: <usage> is a case-insensitive string and must be one of:
+
+    **server-auth**, **client-auth**, **code-signing**, **email-protection**,
+    **time-stamping**, **ocsp-signing**, **ipsec-end-system**, **ipsec-tunnel**,
+    **ipsec-user**, **any**, or an object identifier in dotted notation.`,
+			},
+			cli.StringSliceFlag{
+				Name: "extension",
+				Usage: `Add a custom <extension> in the format '<oid>[,critical]=<value>', where
+<value> is the DER-encoded value of the extension in base64, or in hexadecimal
+using the 'hex:' prefix. Use the '--extension' flag multiple times to add
+multiple extensions.`,
+			},
+			cli.StringFlag{
+				Name:  "template",
+				Usage: `The JSON <file> with the key usages and extensions.`,
+			},
+			cli.StringFlag{
+				Name:  "challenge-file",
+				Usage: `The path to the <file> containing the challenge password of the request.`,
+			},
+			cli.BoolFlag{
+				Name: "no-password",
+				Usage: `Do not ask for a password to encrypt the new private key. Sensitive key
+material will be written to disk unencrypted. This is not recommended. Requires
+**--insecure** flag.`,
+			},
+			flags.PasswordGen,
+			flags.Insecure,
+			flags.Force,
+		},
+	}
+}
+
+func csrAction(ctx *cli.Context) error {
+	keyFile := ctx.String("key")
+	if keyFile != "" {
+		if err := errs.NumberOfArguments(ctx, 2); err != nil {
+			return err
+		}
+		for _, f := range []string{"kty", "curve", "size", "no-password", "password-gen"} {
+			if ctx.IsSet(f) {
+				return errs.IncompatibleFlagWithFlag(ctx, f, "key")
+			}
+		}
+	} else if err := errs.NumberOfArguments(ctx, 3); err != nil {
+		return err
+	}
+
+	args := ctx.Args()
+	subject, csrFile, newKeyFile := args.Get(0), args.Get(1), args.Get(2)
+	if csrFile == newKeyFile {
+		return errs.EqualArguments(ctx, "CSR_FILE", "KEY_FILE")
+	}
+	noPass := ctx.Bool("no-password")
+	if noPass && !ctx.Bool("insecure") {
+		return errs.RequiredWithFlag(ctx, "insecure", "no-password")
+	}
+	if noPass && ctx.IsSet("password-gen") {
+		return errs.IncompatibleFlagWithFlag(ctx, "no-password", "password-gen")
+	}
+
+	var challenge string
+	if filename := ctx.String("challenge-file"); filename != "" {
+		var err error
+		if challenge, err = utils.ReadStringPasswordFromFile(filename); err != nil {
+			return err
+		}
+	}
+
+	// Get the existing key, or generate a new one.
+	var priv interface{}
+	var kty string
+	if keyFile != "" {
+		var err error
+		if priv, err = pemutil.ReadPrivateKey(keyFile); err != nil {
+			return err
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return errors.Errorf("file %s does not contain a valid private key", keyFile)
+		}
+		kty = "EC"
+		if _, ok := signer.Public().(*rsa.PublicKey); ok {
+			kty = "RSA"
+		}
+	} else {
+		var crv string
+		var size int
+		var err error
+		if kty, crv, size, err = utils.GetKeyDetailsFromCLI(ctx, false, "kty", "curve", "size"); err != nil {
+			return err
+		}
+		if priv, err = keys.GenerateKey(kty, crv, size); err != nil {
+			return err
+		}
+	}
+
+	extensions, err := getExtensions(ctx)
+	if err != nil {
+		return err
+	}
+	if prof := ctx.String("profile"); prof != "" {
+		preset, ok := x509util.GetPreset(prof)
+		if !ok {
+			return errs.InvalidFlagValue(ctx, "profile", prof, x509util.PresetNames())
+		}
+		extensions = preset.Apply(extensions, kty)
+	}
+
+	sans := ctx.StringSlice("san")
+	if len(sans) == 0 {
+		sans = []string{subject}
+	}
+	dnsNames, ips, emails, uris, err := splitCSRSANs(sans)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:         subject,
+			Organization:       ctx.StringSlice("organization"),
+			OrganizationalUnit: ctx.StringSlice("organizational-unit"),
+			Country:            ctx.StringSlice("country"),
+			Province:           ctx.StringSlice("province"),
+			Locality:           ctx.StringSlice("locality"),
+			StreetAddress:      ctx.StringSlice("street-address"),
+			PostalCode:         ctx.StringSlice("postal-code"),
+			SerialNumber:       ctx.String("serial-number"),
+		},
+		DNSNames:          dnsNames,
+		IPAddresses:       ips,
+		EmailAddresses:    emails,
+		URIs:              uris,
+		ChallengePassword: challenge,
+	}
+	if template.ExtraExtensions, err = extensions.CSRExtensions(); err != nil {
+		return err
+	}
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, priv)
+	if err != nil {
+		return errors.Wrap(err, "error creating certificate request")
+	}
+	if err := utils.WriteFile(csrFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csrBytes,
+	}), 0600); err != nil {
+		return err
+	}
+
+	if keyFile == "" {
+		opts := []pemutil.Options{pemutil.ToFile(newKeyFile, 0600)}
+		if !noPass {
+			password, err := utils.GetNewPasswordFromCLI(ctx, "")
+			if err != nil {
+				return err
+			}
+			pass, err := ui.PromptPassword("Please enter the password to encrypt the private key", ui.WithValue(password), ui.WithValidateEntropy())
+			if err != nil {
+				return errors.Wrap(err, "error reading password")
+			}
+			opts = append(opts, pemutil.WithPassword(pass))
+		}
+		if _, err := pemutil.Serialize(priv, opts...); err != nil {
+			return err
+		}
+	}
+
+	ui.Printf("Your certificate signing request has been saved in %s.\n", csrFile)
+	if keyFile == "" {
+		ui.Printf("Your private key has been saved in %s.\n", newKeyFile)
+	}
+	return nil
+}
+
+// splitCSRSANs splits the given SANs into DNS names, IP addresses, emails and
+// URIs.
+func splitCSRSANs(sans []string) (dnsNames []string, ips []net.IP, emails []string, uris []*url.URL, err error) {
+	for _, san := range x509util.NormalizeSANs(sans) {
+		switch {
+		case strings.Contains(san, "://"):
+			u, err := url.Parse(san)
+			if err != nil {
+				return nil, nil, nil, nil, errors.Wrapf(err, "error parsing SAN '%s'", san)
+			}
+			uris = append(uris, u)
+		case strings.Contains(san, "@"):
+			emails = append(emails, san)
+		case net.ParseIP(san) != nil:
+			ips = append(ips, net.ParseIP(san))
+		default:
+			dnsNames = append(dnsNames, san)
+		}
+	}
+	return
+}
@@ -0,0 +1,298 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+// oidSignedCertificateTimestampList is the OID of the extension with the
+// embedded SCTs, defined in RFC 6962 section 3.3.
+var oidSignedCertificateTimestampList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+const defaultCTSearchURL = "https://crt.sh/"
+
+func ctCommand() cli.Command {
+	return cli.Command{
+		Name:   "ct",
+		Action: cli.ActionFunc(ctAction),
+		Usage:  "search Certificate Transparency logs",
+		UsageText: `**step certificate ct** <domain|crt-file>
+		[**--lookup**] [**--exclude-expired**] [**--format**=<format>]
+		[**--search-url**=<url>]`,
+		Description: `**step certificate ct** queries Certificate Transparency (CT) logs, using the
+crt.sh search service, for the certificates issued for a domain. It can be used
+to monitor the certificates issued for your domains by other parties.
+
+If the argument is a certificate file, the command prints the Signed
+Certificate Timestamps (SCTs) embedded in the certificate. With **--lookup**
+the command will also check if the certificate was logged.
+
+## POSITIONAL ARGUMENTS
+
+<domain>
+:  The domain to search. Use '%' as a wildcard, e.g. '%.example.com'.
+
+<crt-file>
+:  The path to a certificate.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs. If **--lookup**
+is used and the certificate is not found in the logs the command returns 1.
+
+## EXAMPLES
+
+Search the unexpired certificates issued for a domain:
+'''
+$ step certificate ct --exclude-expired smallstep.com
+'''
+
+Search the certificates issued for any subdomain in JSON format:
+'''
+$ step certificate ct --format json %.smallstep.com
+'''
+
+Print the SCTs of a certificate and check if it was logged:
+'''
+$ step certificate ct --lookup smallstep.crt
+'''`,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "lookup",
+				Usage: "Check if the given certificate is in the logs.",
+			},
+			cli.BoolFlag{
+				Name:  "exclude-expired",
+				Usage: "Do not show expired certificates.",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "text",
+				Usage: `The output <format>: **text** or **json**.`,
+			},
+			cli.StringFlag{
+				Name:  "search-url",
+				Value: defaultCTSearchURL,
+				Usage: "The <url> of a crt.sh compatible search service.",
+			},
+		},
+	}
+}
+
+// ctEntry is the JSON representation of a certificate in crt.sh.
+type ctEntry struct {
+	ID             int64  `json:"id"`
+	IssuerName     string `json:"issuer_name"`
+	CommonName     string `json:"common_name"`
+	NameValue      string `json:"name_value"`
+	SerialNumber   string `json:"serial_number"`
+	NotBefore      string `json:"not_before"`
+	NotAfter       string `json:"not_after"`
+	EntryTimestamp string `json:"entry_timestamp"`
+}
+
+// signedCertificateTimestamp is the representation of an embedded SCT.
+type signedCertificateTimestamp struct {
+	Version   int       `json:"version"`
+	LogID     string    `json:"log_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func ctAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	arg := ctx.Args().First()
+	format := ctx.String("format")
+	switch format {
+	case "text", "json":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	}
+
+	params := url.Values{
+		"output": []string{"json"},
+	}
+	if ctx.Bool("exclude-expired") {
+		params.Set("exclude", "expired")
+	}
+
+	// Domain search
+	if !utils.FileExists(arg) {
+		if ctx.Bool("lookup") {
+			return errors.Errorf("flag '--lookup' requires a certificate file")
+		}
+		params.Set("q", arg)
+		entries, err := ctSearch(ctx.String("search-url"), params)
+		if err != nil {
+			return err
+		}
+		return printCTEntries(entries, format)
+	}
+
+	certs, err := pemutil.ReadCertificateBundle(arg)
+	if err != nil {
+		return err
+	}
+	crt := certs[0]
+	scts, err := parseSCTs(crt)
+	if err != nil {
+		return err
+	}
+
+	var entries []ctEntry
+	if ctx.Bool("lookup") {
+		params.Set("sha256", x509util.Fingerprint(crt))
+		if entries, err = ctSearch(ctx.String("search-url"), params); err != nil {
+			return err
+		}
+	}
+
+	if format == "json" {
+		b, err := json.MarshalIndent(struct {
+			SCTs    []signedCertificateTimestamp `json:"scts"`
+			Entries []ctEntry                    `json:"entries,omitempty"`
+		}{scts, entries}, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "error marshaling results")
+		}
+		fmt.Println(string(b))
+	} else {
+		if len(scts) == 0 {
+			fmt.Println("The certificate does not contain embedded SCTs.")
+		}
+		for _, sct := range scts {
+			fmt.Printf("SCT v%d log %s at %s\n", sct.Version+1, sct.LogID, sct.Timestamp.Format(time.RFC3339))
+		}
+		if ctx.Bool("lookup") {
+			if err := printCTEntries(entries, format); err != nil {
+				return err
+			}
+		}
+	}
+
+	if ctx.Bool("lookup") && len(entries) == 0 {
+		return errs.NewExitError(errors.New("certificate not found in the logs"), 1)
+	}
+	return nil
+}
+
+func ctSearch(searchURL string, params url.Values) ([]ctEntry, error) {
+	u, err := url.Parse(searchURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", searchURL)
+	}
+	u.RawQuery = params.Encode()
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "error searching %s", u.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error searching %s: %s", u.Host, resp.Status)
+	}
+
+	var entries []ctEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s response", u.Host)
+	}
+	return entries, nil
+}
+
+func printCTEntries(entries []ctEntry, format string) error {
+	if format == "json" {
+		if entries == nil {
+			entries = []ctEntry{}
+		}
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "error marshaling results")
+		}
+		os.Stdout.Write(append(b, '\n'))
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No certificates found.")
+		return nil
+	}
+	for _, e := range entries {
+		fmt.Printf("%d: %s\n", e.ID, e.CommonName)
+		fmt.Printf("    Serial:   %s\n", e.SerialNumber)
+		fmt.Printf("    Issuer:   %s\n", e.IssuerName)
+		fmt.Printf("    Validity: %s to %s\n", e.NotBefore, e.NotAfter)
+		fmt.Printf("    Names:    %s\n", strings.Replace(e.NameValue, "\n", ", ", -1))
+	}
+	return nil
+}
+
+// parseSCTs returns the list of SCTs in the certificate extension defined in
+// RFC 6962 section 3.3.
+func parseSCTs(crt *x509.Certificate) ([]signedCertificateTimestamp, error) {
+	var data []byte
+	for _, ext := range crt.Extensions {
+		if ext.Id.Equal(oidSignedCertificateTimestampList) {
+			if _, err := asn1.Unmarshal(ext.Value, &data); err != nil {
+				return nil, errors.Wrap(err, "error parsing SCT list")
+			}
+			break
+		}
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	readVector := func(b []byte) ([]byte, []byte, error) {
+		if len(b) < 2 {
+			return nil, nil, errors.New("error parsing SCT list: data truncated")
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+n {
+			return nil, nil, errors.New("error parsing SCT list: data truncated")
+		}
+		return b[2 : 2+n], b[2+n:], nil
+	}
+
+	list, _, err := readVector(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var scts []signedCertificateTimestamp
+	for len(list) > 0 {
+		var sct []byte
+		if sct, list, err = readVector(list); err != nil {
+			return nil, err
+		}
+		// version (1) + log id (32) + timestamp (8)
+		if len(sct) < 41 {
+			return nil, errors.New("error parsing SCT: data truncated")
+		}
+		ms := int64(binary.BigEndian.Uint64(sct[33:41]))
+		scts = append(scts, signedCertificateTimestamp{
+			Version:   int(sct[0]),
+			LogID:     base64.StdEncoding.EncodeToString(sct[1:33]),
+			Timestamp: time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).UTC(),
+		})
+	}
+	return scts, nil
+}
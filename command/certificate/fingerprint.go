@@ -1,22 +1,31 @@
 package certificate
 
 import (
+	"crypto"
+	_ "crypto/md5" // required for the md5 fingerprint
+	_ "crypto/sha1"
+	_ "crypto/sha256"
 	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 
-	"github.com/smallstep/cli/crypto/x509util"
-
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/keys"
 	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/urfave/cli"
 )
 
 func fingerprintCommand() cli.Command {
 	return cli.Command{
-		Name:      "fingerprint",
-		Action:    cli.ActionFunc(fingerprintAction),
-		Usage:     "print the fingerprint of a certificate",
-		UsageText: `**step certificate fingerprint** <crt-file>`,
+		Name:   "fingerprint",
+		Action: cli.ActionFunc(fingerprintAction),
+		Usage:  "print the fingerprint of a certificate, CSR or public key",
+		UsageText: `**step certificate fingerprint** <crt-file>
+		[**--alg**=<algorithm>] [**--format**=<format>] [**--bundle**]
+		[**--roots**=<root-bundle>] [**--servername**=<name>] [**--insecure**]`,
 		Description: `**step certificate fingerprint** reads a certificate and prints to STDOUT the
 certificate SHA256 of the raw certificate.
 
@@ -25,10 +34,19 @@ If <crt-file> contains multiple certificates (i.e., it is a certificate
 printed. Pass the --bundle option to print all fingerprints in the order in
 which they appear in the bundle.
 
+If <crt-file> is a certificate signing request the fingerprint is computed
+over the raw CSR. If it is a public or private key, the fingerprint is computed
+over the DER-encoded PKIX public key (the SubjectPublicKeyInfo).
+
+The **--alg** and **--format** flags allow to print fingerprints that are
+easier to compare over the phone or in a chat, for example when bootstrapping
+a new host.
+
 ## POSITIONAL ARGUMENTS
 
 <crt-file>
-:  A certificate PEM file, usually the root certificate.
+:  A certificate PEM file, usually the root certificate. It can also be a
+certificate signing request, a public key or a private key.
 
 ## EXAMPLES
 
@@ -49,6 +67,27 @@ Get the fingerprints for a remote certificate with its intemediate:
 $ step certificate fingerprint --bundle https://smallstep.com
 e2c4f12edfc1816cc610755d32e6f45d5678ba21ecda1693bb5b246e3c48c03d
 25847d668eb4f04fdd40b12b6b0740c567da7d024308eb6c2c96fe41d9de218d
+'''
+
+Get the fingerprint of a root certificate encoded using base64url:
+'''
+$ step certificate fingerprint --format base64url root_ca.crt
+DX04NM8YdybPMxxAoxqn72spuk32AUFsl4j27gEFjPM
+'''
+
+Get the SHA-1 fingerprint of a certificate:
+'''
+$ step certificate fingerprint --alg sha1 root_ca.crt
+'''
+
+Get the fingerprint of a certificate signing request:
+'''
+$ step certificate fingerprint foo.csr
+'''
+
+Get the fingerprint of a public key as emojis:
+'''
+$ step certificate fingerprint --format emoji foo.pub
 '''`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -76,6 +115,42 @@ authenticity of the remote server.
 				Usage: `Use an insecure client to retrieve a remote peer certificate. Useful for
 debugging invalid certificates remotely.`,
 			},
+			serverNameFlag,
+			cli.StringFlag{
+				Name:  "alg",
+				Value: "sha256",
+				Usage: `The hash <algorithm> used to compute the fingerprint.
+
+: <algorithm> is a case-sensitive string and must be one of:
+
+    **sha256**
+    :  SHA-256 (default)
+
+    **sha1** (or sha)
+    :  SHA-1
+
+    **md5** (requires --insecure)
+    :  MD5`,
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "hex",
+				Usage: `The <format> of the fingerprint.
+
+: <format> is a case-sensitive string and must be one of:
+
+    **hex**
+    :  Lowercase hexadecimal encoding (default).
+
+    **base64**
+    :  Standard base64 encoding.
+
+    **base64url**
+    :  URL-safe base64 encoding without padding.
+
+    **emoji**
+    :  One emoji per byte of the fingerprint.`,
+			},
 		},
 	}
 }
@@ -86,7 +161,7 @@ func fingerprintAction(ctx *cli.Context) error {
 	}
 
 	var (
-		certs    []*x509.Certificate
+		data     [][]byte
 		err      error
 		roots    = ctx.String("roots")
 		bundle   = ctx.Bool("bundle")
@@ -94,28 +169,118 @@ func fingerprintAction(ctx *cli.Context) error {
 		crtFile  = ctx.Args().First()
 	)
 
+	h, err := getFingerprintHash(ctx, ctx.String("alg"), insecure)
+	if err != nil {
+		return err
+	}
+	encoding, err := getFingerprintEncoding(ctx, ctx.String("format"))
+	if err != nil {
+		return err
+	}
+
 	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
-		certs, err = getPeerCertificates(addr, roots, insecure)
+		certs, err := getPeerCertificates(addr, ctx.String("servername"), roots, insecure)
 		if err != nil {
 			return err
 		}
+		for _, crt := range certs {
+			data = append(data, crt.Raw)
+		}
 	} else {
-		certs, err = pemutil.ReadCertificateBundle(crtFile)
+		data, err = readFingerprintData(crtFile)
 		if err != nil {
 			return err
 		}
 	}
 
 	if !bundle {
-		certs = certs[:1]
+		data = data[:1]
 	}
 
-	for i, crt := range certs {
+	for i, b := range data {
+		fp, err := x509util.EncodedFingerprint(b, h, encoding)
+		if err != nil {
+			return err
+		}
 		if bundle {
-			fmt.Printf("%d: %s\n", i, x509util.Fingerprint(crt))
+			fmt.Printf("%d: %s\n", i, fp)
 		} else {
-			fmt.Println(x509util.Fingerprint(crt))
+			fmt.Println(fp)
 		}
 	}
 	return nil
 }
+
+// readFingerprintData returns the raw bytes to fingerprint in the given file.
+// Certificates return all the certificates in the file, certificate requests
+// the raw CSR, and keys the DER-encoded PKIX public key.
+func readFingerprintData(filename string) ([][]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+
+	// Certificate bundles and DER certificates
+	if block, _ := pem.Decode(b); block == nil || block.Type == "CERTIFICATE" {
+		certs, err := pemutil.ReadCertificateBundle(filename)
+		if err != nil {
+			return nil, err
+		}
+		data := make([][]byte, len(certs))
+		for i, crt := range certs {
+			data[i] = crt.Raw
+		}
+		return data, nil
+	}
+
+	v, err := pemutil.Parse(b, pemutil.WithFilename(filename), pemutil.WithFirstBlock())
+	if err != nil {
+		return nil, err
+	}
+	if csr, ok := v.(*x509.CertificateRequest); ok {
+		return [][]byte{csr.Raw}, nil
+	}
+	pub, err := keys.PublicKey(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshaling public key in %s", filename)
+	}
+	return [][]byte{der}, nil
+}
+
+// getFingerprintHash returns the hash function for the given algorithm. The
+// md5 algorithm can only be used if the insecure flag is passed.
+func getFingerprintHash(ctx *cli.Context, alg string, insecure bool) (crypto.Hash, error) {
+	switch alg {
+	case "sha256", "":
+		return crypto.SHA256, nil
+	case "sha", "sha1":
+		return crypto.SHA1, nil
+	case "md5":
+		if insecure {
+			return crypto.MD5, nil
+		}
+		return 0, errs.FlagValueInsecure(ctx, "alg", alg)
+	default:
+		return 0, errs.InvalidFlagValue(ctx, "alg", alg, "sha256, sha1, md5")
+	}
+}
+
+// getFingerprintEncoding returns the fingerprint encoding for the given format.
+func getFingerprintEncoding(ctx *cli.Context, format string) (x509util.FingerprintEncoding, error) {
+	switch format {
+	case "hex", "":
+		return x509util.HexFingerprint, nil
+	case "base64":
+		return x509util.Base64Fingerprint, nil
+	case "base64url":
+		return x509util.Base64URLFingerprint, nil
+	case "emoji":
+		return x509util.EmojiFingerprint, nil
+	default:
+		return 0, errs.InvalidFlagValue(ctx, "format", format, "hex, base64, base64url, emoji")
+	}
+}
@@ -2,17 +2,21 @@ package certificate
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"os"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/ui"
 	"github.com/smallstep/cli/utils"
 	"github.com/urfave/cli"
+	"golang.org/x/crypto/ed25519"
 )
 
 func formatCommand() cli.Command {
@@ -20,17 +24,24 @@ func formatCommand() cli.Command {
 		Name:      "format",
 		Action:    command.ActionFunc(formatAction),
 		Usage:     `reformat certificate`,
-		UsageText: `**step certificate format** <crt_file> [**--out**=<path>]`,
+		UsageText: `**step certificate format** <crt_file> [**--format**=<format>] [**--out**=<path>]`,
 		Description: `**step certificate format** prints the certificate in
 a different format.
 
-Only 2 formats are currently supported; PEM and ASN.1 DER. This tool will convert
-a certificate in one format to the other.
+The supported formats are PEM, ASN.1 DER and PKCS#7 (also known as .p7b or .p7c
+files). The format of the input is detected automatically, and by default PEM
+files are converted to DER, and DER and PKCS#7 files to PEM. Use **--format**
+to choose the output format.
+
+Certificate bundles are kept when the output is PEM or PKCS#7, but only the
+first certificate is used for DER outputs. Certificate signing requests and
+public keys can also be converted between PEM and DER. To convert private keys
+use **step crypto key format**.
 
 ## POSITIONAL ARGUMENTS
 
 <crt_file>
-:  Path to a certificate file.
+:  Path to a certificate, certificate bundle, CSR or public key file.
 
 ## EXIT CODES
 
@@ -52,8 +63,39 @@ Convert PEM format to DER and write to disk.
 '''
 $ step certificate format foo.pem --out foo.der
 '''
+
+Convert a PEM bundle to PKCS#7.
+'''
+$ step certificate format --format p7b bundle.crt --out bundle.p7b
+'''
+
+Convert a PKCS#7 file to a PEM bundle.
+'''
+$ step certificate format bundle.p7b --out bundle.crt
+'''
+
+Convert a CSR in PEM format to DER.
+'''
+$ step certificate format foo.csr --out foo.csr.der
+'''
 `,
 		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "format",
+				Usage: `The output <format>. By default PEM inputs are converted to DER, and the rest
+to PEM.
+
+: <format> is a case-sensitive string and must be one of:
+
+    **pem**
+    :  PEM encoding.
+
+    **der**
+    :  ASN.1 DER encoding.
+
+    **p7b**
+    :  DER-encoded PKCS#7 certificate bundle.`,
+			},
 			cli.StringFlag{
 				Name:  "out",
 				Usage: `Path to write the reformatted result.`,
@@ -71,9 +113,18 @@ func formatAction(ctx *cli.Context) error {
 	var (
 		crtFile = ctx.Args().Get(0)
 		out     = ctx.String("out")
+		format  = ctx.String("format")
+		certs   []*x509.Certificate
+		v       interface{}
 		ob      []byte
 	)
 
+	switch format {
+	case "", "pem", "der", "p7b":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "pem, der, p7b")
+	}
+
 	crtBytes, err := utils.ReadFile(crtFile)
 	if err != nil {
 		return errs.FileError(err, crtFile)
@@ -81,34 +132,34 @@ func formatAction(ctx *cli.Context) error {
 
 	switch {
 	case bytes.HasPrefix(crtBytes, []byte("-----BEGIN ")): // PEM format
-		var (
-			blocks []*pem.Block
-			block  *pem.Block
-		)
-		for len(crtBytes) > 0 {
-			block, crtBytes = pem.Decode(crtBytes)
-			if block == nil {
-				return errors.Errorf("%s contains an invalid PEM block", crtFile)
-			}
-			if block.Type != "CERTIFICATE" {
-				return errors.Errorf("certificate bundle %s contains an "+
-					"unexpected PEM block of type %s\n\n  expected type: "+
-					"CERTIFICATE", crtFile, block.Type)
+		if format == "" {
+			format = "der"
+		}
+		if block, _ := pem.Decode(crtBytes); block != nil && (block.Type == "CERTIFICATE" || block.Type == "PKCS7") {
+			if certs, err = pemutil.ReadCertificateBundle(crtFile); err != nil {
+				return err
 			}
-			blocks = append(blocks, block)
+		} else if v, err = pemutil.Parse(crtBytes, pemutil.WithFilename(crtFile)); err != nil {
+			return err
 		}
-		// Only format the first certificate in the chain.
-		crt, err := x509.ParseCertificate(blocks[0].Bytes)
-		if err != nil {
+	default: // DER format, a certificate, PKCS#7, CSR or public key
+		if format == "" {
+			format = "pem"
+		}
+		if certs, v, err = parseDER(crtBytes); err != nil {
+			return errors.Wrapf(err, "error parsing %s", crtFile)
+		}
+	}
+
+	switch {
+	case certs != nil:
+		if ob, err = formatCertificates(certs, format); err != nil {
 			return err
 		}
-		ob = crt.Raw
-	default: // assuming DER format
-		p := &pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: crtBytes,
+	default:
+		if ob, err = formatCSROrKey(v, format); err != nil {
+			return errors.Wrapf(err, "error formatting %s", crtFile)
 		}
-		ob = pem.EncodeToMemory(p)
 	}
 
 	if out == "" {
@@ -126,3 +177,71 @@ func formatAction(ctx *cli.Context) error {
 
 	return nil
 }
+
+// parseDER parses a DER-encoded certificate, PKCS#7 bundle, certificate
+// request or public key.
+func parseDER(b []byte) ([]*x509.Certificate, interface{}, error) {
+	if crt, err := x509.ParseCertificate(b); err == nil {
+		return []*x509.Certificate{crt}, nil, nil
+	}
+	if certs, err := pemutil.ParsePKCS7Certificates(b); err == nil {
+		return certs, nil, nil
+	}
+	if csr, err := x509.ParseCertificateRequest(b); err == nil {
+		return nil, csr, nil
+	}
+	key, err := pemutil.ParseDER(b)
+	if err != nil {
+		return nil, nil, errors.New("unsupported format")
+	}
+	return nil, key, nil
+}
+
+// formatCertificates encodes the given certificates using the given format.
+// Only the first certificate is encoded using DER.
+func formatCertificates(certs []*x509.Certificate, format string) ([]byte, error) {
+	switch format {
+	case "der":
+		return certs[0].Raw, nil
+	case "p7b":
+		return pemutil.MarshalPKCS7Certificates(certs)
+	default:
+		var b []byte
+		for _, crt := range certs {
+			b = append(b, pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: crt.Raw,
+			})...)
+		}
+		return b, nil
+	}
+}
+
+// formatCSROrKey encodes the given certificate request or public key using
+// the given format.
+func formatCSROrKey(v interface{}, format string) ([]byte, error) {
+	var block *pem.Block
+	switch v := v.(type) {
+	case *x509.CertificateRequest:
+		block = &pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: v.Raw,
+		}
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return nil, errors.New("private keys are not supported, use 'step crypto key format'")
+	default:
+		var err error
+		if block, err = pemutil.Serialize(v); err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case "der":
+		return block.Bytes, nil
+	case "p7b":
+		return nil, errors.New("only certificates can be encoded using PKCS#7")
+	default:
+		return pem.EncodeToMemory(block), nil
+	}
+}
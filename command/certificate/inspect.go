@@ -23,7 +23,8 @@ func inspectCommand() cli.Command {
 		Action: cli.ActionFunc(inspectAction),
 		Usage:  `print certificate or CSR details in human readable format`,
 		UsageText: `**step certificate inspect** <crt_file> [**--bundle**]
-[**--format**=<format>] [**--roots**=<root-bundle>]`,
+[**--format**=<format>] [**--roots**=<root-bundle>] [**--servername**=<name>]
+[**--insecure**]`,
 		Description: `**step certificate inspect** prints the details of a certificate
 or CSR in a human readable format. Output from the inspect command is printed to
 STDERR instead of STDOUT unless. This is an intentional barrier to accidental
@@ -57,6 +58,12 @@ Inspect a local certificate bundle (default to text format):
 $ step certificate inspect ./certificate-bundle.crt --bundle
 '''
 
+Inspect a local certificate in a short format:
+
+'''
+$ step certificate inspect ./certificate.crt --format short
+'''
+
 Inspect a local certificate in json format:
 
 '''
@@ -69,6 +76,15 @@ Inspect a local certificate bundle in json format:
 $ step certificate inspect ./certificate.crt --format json --bundle
 '''
 
+Get the expiration date and the SANs of a certificate using jq:
+
+'''
+$ step certificate inspect ./certificate.crt --format json | jq -r .validity.end
+2019-02-28T17:31:39Z
+$ step certificate inspect ./certificate.crt --format json | jq -r '.extensions.subject_alt_name.dns_names[]'
+internal.example.com
+'''
+
 Inspect a remote certificate (using the default root certificate bundle to verify the server):
 
 '''
@@ -87,6 +103,12 @@ Inspect a remote certificate chain (using the default root certificate bundle to
 $ step certificate inspect https://google.com --bundle
 '''
 
+Inspect a remote certificate using a different server name (SNI):
+
+'''
+$ step certificate inspect https://10.0.0.1:8443 --servername internal.example.com
+'''
+
 Inspect a remote certificate using a custom root certificate to verify the server:
 
 '''
@@ -138,6 +160,10 @@ $ step certificate inspect foo.csr --format json
     **text**
     :  Print output in unstructured text suitable for a human to read.
 
+    **short**
+    :  Print output in a shorter and more friendly text format, same as using
+    the **--short** flag.
+
     **json**
     :  Print output in JSON format.`,
 			},
@@ -173,6 +199,7 @@ if the input bundle includes any PEM that does not have type CERTIFICATE.`,
 				Usage: `Use an insecure client to retrieve a remote peer certificate. Useful for
 debugging invalid certificates remotely.`,
 			},
+			serverNameFlag,
 		},
 	}
 }
@@ -191,8 +218,19 @@ func inspectAction(ctx *cli.Context) error {
 		insecure = ctx.Bool("insecure")
 	)
 
-	if format != "text" && format != "json" {
-		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	switch format {
+	case "text", "json":
+	case "short":
+		// --format short is an alias of --format text --short
+		format, short = "text", true
+		if err := ctx.Set("format", format); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := ctx.Set("short", "true"); err != nil {
+			return errors.WithStack(err)
+		}
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "text, short, json")
 	}
 	if short && format == "json" {
 		return errs.IncompatibleFlagWithFlag(ctx, "short", "format json")
@@ -201,7 +239,7 @@ func inspectAction(ctx *cli.Context) error {
 	var block *pem.Block
 	var blocks []*pem.Block
 	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
-		peerCertificates, err := getPeerCertificates(addr, roots, insecure)
+		peerCertificates, err := getPeerCertificates(addr, ctx.String("servername"), roots, insecure)
 		if err != nil {
 			return err
 		}
@@ -297,7 +335,7 @@ func inspectCertificates(ctx *cli.Context, blocks []*pem.Block) error {
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		os.Stdout.Write(b)
+		os.Stdout.Write(append(b, '\n'))
 		return nil
 	default:
 		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
@@ -337,7 +375,7 @@ func inspectCertificateRequest(ctx *cli.Context, block *pem.Block) error {
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		os.Stdout.Write(b)
+		os.Stdout.Write(append(b, '\n'))
 		return nil
 	default:
 		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
@@ -1,13 +1,18 @@
 package certificate
 
 import (
+	"bytes"
+	"crypto/x509"
 	"fmt"
+	"os"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certinfo"
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/trust"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/truststore"
 	"github.com/urfave/cli"
@@ -17,19 +22,35 @@ func installCommand() cli.Command {
 	return cli.Command{
 		Name:   "install",
 		Action: command.ActionFunc(installAction),
-		Usage:  "install a root certificate in the system truststore",
+		Usage:  "install a root or intermediate certificate in the system truststore",
 		UsageText: `**step certificate install** <crt-file>
 		[**--prefix**=<name>] [**--all**]
-		[**--java**] [**--firefox**] [**--no-system**]`,
+		[**--java**] [**--firefox**] [**--no-system**]
+
+**step certificate install** **--list**`,
 		Description: `**step certificate install** installs a root certificate in the system
 truststore.
 
 Java and Firefox truststores are also supported via the respective flags.
 
+Intermediate certificates are never installed as trust anchors, an
+intermediate installed in a truststore would be trusted as a root, without
+checking its chain or the constraints imposed by its issuer. Instead, they are
+installed in the intermediate stores, that are only used to build the chain of
+a certificate to a trusted root: the intermediate certificate authorities store
+on Windows, the system keychain without trust settings on macOS, and the NSS
+security databases without trust flags with **--firefox**. The system
+truststore on Linux and the Java key store do not have an intermediate store,
+and the install fails if they are selected.
+
+The installed certificates and their truststores are recorded in
+<$STEPPATH/config/truststore.json>, and they can be listed using the **--list**
+flag.
+
 ## POSITIONAL ARGUMENTS
 
 <crt-file>
-:  Certificate to install in the system truststore
+:  Root or intermediate certificate to install in the system truststore
 
 ## EXAMPLES
 
@@ -38,6 +59,11 @@ Install a certificate in the system truststore:
 $ step certificate install root-ca.pem
 '''
 
+Install an intermediate certificate in the Firefox intermediate store only:
+'''
+$ step certificate install --firefox --no-system intermediate-ca.pem
+'''
+
 Install a certificate in all the supported truststores:
 '''
 $ step certificate install --all root-ca.pem
@@ -56,6 +82,11 @@ $ step certificate install --java root-ca.pem
 Install a certificate in Firefox, Java, but not in the system trustore:
 '''
 $ step certificate install --firefox --java --no-system root-ca.pem
+'''
+
+List the certificates installed by step:
+'''
+$ step certificate install --list
 '''`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -79,6 +110,10 @@ certificate common name.`,
 				Name:  "all",
 				Usage: "install on the system, Firefox and Java truststores",
 			},
+			cli.BoolFlag{
+				Name:  "list",
+				Usage: "list the certificates installed by step and their truststores",
+			},
 		},
 	}
 }
@@ -87,12 +122,15 @@ func uninstallCommand() cli.Command {
 	return cli.Command{
 		Name:   "uninstall",
 		Action: command.ActionFunc(uninstallAction),
-		Usage:  "uninstall a root certificate from the system truststore",
+		Usage:  "uninstall a root or intermediate certificate from the system truststore",
 		UsageText: `**step certificate uninstall** <crt-file>
 		[**--prefix**=<name>] [**--all**]
 		[**--java**] [**--firefox**] [**--no-system**]`,
-		Description: `**step certificate install** uninstalls a root certificate from the system
-truststore.
+		Description: `**step certificate uninstall** uninstalls a root certificate from the
+system truststore, and removes it from the list of installed certificates.
+Intermediate certificates are uninstalled from the intermediate stores where
+they were installed, or from the truststores if they were installed as trust
+anchors by previous versions of step.
 
 Java and Firefox truststores are also supported via the respective flags.
 
@@ -154,23 +192,44 @@ certificate common name.`,
 }
 
 func installAction(ctx *cli.Context) error {
+	if ctx.Bool("list") {
+		if err := errs.NumberOfArguments(ctx, 0); err != nil {
+			return err
+		}
+		return listInstalled()
+	}
 	if err := errs.NumberOfArguments(ctx, 1); err != nil {
 		return err
 	}
 
 	filename := ctx.Args().Get(0)
-	opts, err := getTruststoreOptions(ctx)
+	to, err := getTruststoreOptions(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err := truststore.InstallFile(filename, opts...); err != nil {
-		switch err := err.(type) {
-		case *truststore.CmdError:
-			return errors.Errorf("failed to execute \"%s\" failed with: %s", strings.Join(err.Cmd().Args, " "), err.Err())
-		default:
+	stores := to.stores
+	if isRoot(to.cert) {
+		if err := truststore.InstallFile(filename, to.opts...); err != nil {
+			switch err := err.(type) {
+			case *truststore.CmdError:
+				return errors.Errorf("failed to execute \"%s\" failed with: %s", strings.Join(err.Cmd().Args, " "), err.Err())
+			default:
+				return errors.Wrapf(err, "failed to install %s", filename)
+			}
+		}
+	} else {
+		if stores, err = intermediateStores(to.stores); err != nil {
 			return errors.Wrapf(err, "failed to install %s", filename)
 		}
+		if err := trust.InstallIntermediate(filename, strings.TrimSpace(to.prefix), stores); err != nil {
+			return err
+		}
+	}
+	if err := updateInventory(func(inv *trust.Inventory) {
+		inv.Add(to.cert, filename, to.prefix, stores)
+	}); err != nil {
+		return err
 	}
 
 	fmt.Printf("Certificate %s has been installed.\n", filename)
@@ -190,19 +249,37 @@ func uninstallAction(ctx *cli.Context) error {
 	}
 
 	filename := ctx.Args().Get(0)
-	opts, err := getTruststoreOptions(ctx)
+	to, err := getTruststoreOptions(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err := truststore.UninstallFile(filename, opts...); err != nil {
-		switch err := err.(type) {
-		case *truststore.CmdError:
-			return errors.Errorf("failed to execute \"%s\" failed with: %s", strings.Join(err.Cmd().Args, " "), err.Err())
-		default:
-			return errors.Wrapf(err, "failed to uninstall %s", filename)
+	// Intermediates installed by this version are in the intermediate stores,
+	// the ones installed by previous versions are in the truststores.
+	stores, err := installedIntermediateStores(to)
+	if err != nil {
+		return err
+	}
+	if len(stores) > 0 {
+		if err := trust.UninstallIntermediate(to.cert, strings.TrimSpace(to.prefix), stores); err != nil {
+			return err
+		}
+	} else {
+		stores = to.stores
+		if err := truststore.UninstallFile(filename, to.opts...); err != nil {
+			switch err := err.(type) {
+			case *truststore.CmdError:
+				return errors.Errorf("failed to execute \"%s\" failed with: %s", strings.Join(err.Cmd().Args, " "), err.Err())
+			default:
+				return errors.Wrapf(err, "failed to uninstall %s", filename)
+			}
 		}
 	}
+	if err := updateInventory(func(inv *trust.Inventory) {
+		inv.Remove(to.cert, stores)
+	}); err != nil {
+		return err
+	}
 
 	fmt.Printf("Certificate %s has been removed.\n", filename)
 	// Print certificate info (ignore errors)
@@ -215,14 +292,49 @@ func uninstallAction(ctx *cli.Context) error {
 	return nil
 }
 
-func getTruststoreOptions(ctx *cli.Context) ([]truststore.Option, error) {
+// listInstalled prints the certificates in the inventory.
+func listInstalled() error {
+	inv, err := trust.ReadInventory(trust.InventoryPath())
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SUBJECT\tSTORES\tFINGERPRINT\tFILE")
+	for _, e := range inv.Entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Subject, strings.Join(e.Stores, ","), e.Fingerprint, e.Filename)
+	}
+	return w.Flush()
+}
+
+// updateInventory applies fn to the inventory of installed certificates and
+// writes it.
+func updateInventory(fn func(inv *trust.Inventory)) error {
+	filename := trust.InventoryPath()
+	inv, err := trust.ReadInventory(filename)
+	if err != nil {
+		return err
+	}
+	fn(inv)
+	return inv.Write(filename)
+}
+
+type truststoreOptions struct {
+	cert   *x509.Certificate
+	prefix string
+	stores []string
+	opts   []truststore.Option
+}
+
+func getTruststoreOptions(ctx *cli.Context) (*truststoreOptions, error) {
 	cert, err := pemutil.ReadCertificate(ctx.Args().Get(0))
 	if err != nil {
 		return nil, err
 	}
 
-	if !cert.IsCA || cert.CheckSignatureFrom(cert) != nil {
-		return nil, errors.Errorf("certificate %s is not a root CA", ctx.Args().Get(0))
+	// Roots are installed in the truststores and intermediates in the
+	// intermediate stores.
+	if !cert.IsCA {
+		return nil, errors.Errorf("certificate %s is not a CA certificate", ctx.Args().Get(0))
 	}
 
 	prefix := ctx.String("prefix")
@@ -238,18 +350,75 @@ func getTruststoreOptions(ctx *cli.Context) ([]truststore.Option, error) {
 		truststore.WithPrefix(prefix),
 	}
 
+	var stores []string
 	if ctx.Bool("all") {
 		opts = append(opts, truststore.WithJava(), truststore.WithFirefox())
+		stores = append(stores, trust.Java, trust.Firefox)
 	} else {
 		if ctx.Bool("java") {
 			opts = append(opts, truststore.WithJava())
+			stores = append(stores, trust.Java)
 		}
 		if ctx.Bool("firefox") {
 			opts = append(opts, truststore.WithFirefox())
+			stores = append(stores, trust.Firefox)
 		}
 	}
 	if ctx.Bool("no-system") {
 		opts = append(opts, truststore.WithNoSystem())
+	} else {
+		stores = append(stores, trust.System)
+	}
+	return &truststoreOptions{
+		cert:   cert,
+		prefix: prefix,
+		stores: stores,
+		opts:   opts,
+	}, nil
+}
+
+// intermediateStores returns the intermediate stores used instead of the given
+// truststores. It fails if any of the truststores does not have one.
+func intermediateStores(stores []string) ([]string, error) {
+	var result []string
+	for _, store := range stores {
+		s, err := trust.IntermediateStore(store)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// installedIntermediateStores returns the intermediate stores, of the ones
+// selected, where the certificate has been installed according to the
+// inventory.
+func installedIntermediateStores(to *truststoreOptions) ([]string, error) {
+	if isRoot(to.cert) {
+		return nil, nil
+	}
+	inv, err := trust.ReadInventory(trust.InventoryPath())
+	if err != nil {
+		return nil, err
 	}
-	return opts, nil
+	installed := inv.Stores(to.cert)
+	var stores []string
+	for _, store := range to.stores {
+		s, err := trust.IntermediateStore(store)
+		if err != nil {
+			continue
+		}
+		for _, i := range installed {
+			if i == s {
+				stores = append(stores, s)
+			}
+		}
+	}
+	return stores, nil
+}
+
+// isRoot returns true if the given certificate is self-signed.
+func isRoot(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
 }
@@ -0,0 +1,64 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/trust"
+)
+
+// mustCertificate creates a certificate with the given template, signed by
+// parent and parentKey, or self-signed if parent is nil. It returns the
+// certificate and its key.
+func mustCertificate(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(1)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.FatalError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return cert, key
+}
+
+func TestIsRoot(t *testing.T) {
+	ca := func(cn string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+	}
+	root, rootKey := mustCertificate(t, ca("Root CA"), nil, nil)
+	intermediate, _ := mustCertificate(t, ca("Intermediate CA"), root, rootKey)
+	// Same subject and issuer, but signed by another key
+	crossSigned, _ := mustCertificate(t, ca("Root CA"), root, rootKey)
+
+	assert.True(t, isRoot(root))
+	assert.False(t, isRoot(intermediate))
+	assert.False(t, isRoot(crossSigned))
+}
+
+func TestIntermediateStores(t *testing.T) {
+	got, err := intermediateStores([]string{trust.Firefox})
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{trust.FirefoxIntermediate}, got)
+
+	_, err = intermediateStores([]string{trust.Firefox, trust.Java})
+	assert.Error(t, err)
+}
@@ -1,25 +1,30 @@
 package certificate
 
 import (
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 
-	"github.com/smallstep/cli/flags"
-	"github.com/smallstep/cli/ui"
-
+	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
 	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/jose"
+	"github.com/smallstep/cli/ui"
 	"github.com/smallstep/cli/utils"
 	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
 )
 
 func keyCommand() cli.Command {
 	return cli.Command{
-		Name:      "key",
-		Action:    command.ActionFunc(keyAction),
-		Usage:     "print public key embedded in a certificate",
-		UsageText: "**step certificate key** <crt-file> [**--out**=<file>]",
+		Name:   "key",
+		Action: command.ActionFunc(keyAction),
+		Usage:  "print public key embedded in a certificate",
+		UsageText: `**step certificate key** <crt-file> [**--out**=<file>]
+		[**--format**=<format>]`,
 		Description: `**step certificate key** prints the public key embedded in a certificate or 
 a certificate signing request. If <crt-file> is a certificate bundle, only the
 first block will be taken into account.
@@ -27,6 +32,9 @@ first block will be taken into account.
 The command will print a public or a decrypted private key if <crt-file> 
 contains only a key.
 
+The public key can be printed in PEM format, as a JSON Web Key (JWK) to
+configure JWT verifiers, or in the OpenSSH authorized_keys format.
+
 ## POSITIONAL ARGUMENTS
 
 <crt-file>
@@ -46,12 +54,48 @@ MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEio9DLyuglMxakS3w00DUKdGbeXXB
 Get the public key of a CSR and save it to a file:
 '''
 $ step certificate key certificate.csr --out key.pem
+'''
+
+Get the public key of a certificate as a JWK:
+'''
+$ step certificate key --format jwk certificate.crt
+{
+  "use": "sig",
+  "kty": "EC",
+  "kid": "5dNpXEVXtV_WVH2761YQ3R4zQsHFaNSoRrjtpq8I_N8",
+  "crv": "P-256",
+  "alg": "ES256",
+  "x": "io9DLyuglMxakS3w00DUKdGbeXXB2Mfg6tVofeXYan8",
+  "y": "UW737Wbn4sqSAFahmajuwkfRG5KMh2_-xnCkGuR2faw"
+}
+'''
+
+Get the public key of a certificate in the OpenSSH format:
+'''
+$ step certificate key --format ssh certificate.crt
+ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBIqPQy8roJTMWpEt8NNA1CnRm3l1wdjH4OrVaH3l2Gp/UW737Wbn4sqSAFahmajuwkfRG5KMh2/+xnCkGuR2faw=
 '''`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "out,output-file",
 				Usage: "The destination <file> of the public key.",
 			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "pem",
+				Usage: `The <format> of the public key.
+
+: <format> is a case-sensitive string and must be one of:
+
+    **pem**
+    :  PEM-encoded PKIX public key (default).
+
+    **jwk**
+    :  JSON Web Key, with the JWK thumbprint as the key id.
+
+    **ssh**
+    :  OpenSSH authorized_keys format.`,
+			},
 			flags.Force,
 		},
 	}
@@ -62,6 +106,13 @@ func keyAction(ctx *cli.Context) error {
 		return err
 	}
 
+	format := ctx.String("format")
+	switch format {
+	case "pem", "jwk", "ssh", "":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "pem, jwk, ssh")
+	}
+
 	filename := ctx.Args().Get(0)
 	b, err := utils.ReadFile(filename)
 	if err != nil {
@@ -73,19 +124,48 @@ func keyAction(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	block, err := pemutil.Serialize(key)
-	if err != nil {
-		return err
+
+	var out []byte
+	switch format {
+	case "jwk":
+		pub, err := keys.PublicKey(key)
+		if err != nil {
+			return err
+		}
+		jwk, err := jose.PublicJWK(pub)
+		if err != nil {
+			return err
+		}
+		if out, err = json.MarshalIndent(jwk, "", "  "); err != nil {
+			return errors.Wrap(err, "error marshaling JWK")
+		}
+		out = append(out, '\n')
+	case "ssh":
+		pub, err := keys.PublicKey(key)
+		if err != nil {
+			return err
+		}
+		sshPub, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			return errors.Wrap(err, "error converting public key")
+		}
+		out = ssh.MarshalAuthorizedKey(sshPub)
+	default:
+		block, err := pemutil.Serialize(key)
+		if err != nil {
+			return err
+		}
+		out = pem.EncodeToMemory(block)
 	}
 
 	if outputFile := ctx.String("output-file"); len(outputFile) > 0 {
-		if err := utils.WriteFile(outputFile, pem.EncodeToMemory(block), 0600); err != nil {
+		if err := utils.WriteFile(outputFile, out, 0600); err != nil {
 			return err
 		}
 		ui.Printf("The public key has been saved in %s.\n", outputFile)
 		return nil
 	}
 
-	fmt.Print(string(pem.EncodeToMemory(block)))
+	fmt.Print(string(out))
 	return nil
 }
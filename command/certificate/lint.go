@@ -3,33 +3,40 @@ package certificate
 import (
 	"encoding/json"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/errs"
 	zx509 "github.com/smallstep/zcrypto/x509"
 	"github.com/smallstep/zlint"
+	"github.com/smallstep/zlint/lints"
 	"github.com/urfave/cli"
 )
 
 func lintCommand() cli.Command {
 	return cli.Command{
-		Name:      "lint",
-		Action:    cli.ActionFunc(lintAction),
-		Usage:     `lint certificate details`,
-		UsageText: `**step certificate lint** <crt_file> [**--roots**=<root-bundle>]`,
+		Name:   "lint",
+		Action: cli.ActionFunc(lintAction),
+		Usage:  `lint certificate details`,
+		UsageText: `**step certificate lint** <crt_file> [**--roots**=<root-bundle>]
+		[**--format**=<format>] [**--insecure**]`,
 		Description: `**step certificate lint** checks a certificate for common
-errors and outputs the result in JSON format.
+errors using the zlint checks and outputs the result in JSON format, or in
+a human readable format with **--format text**.
 
 ## POSITIONAL ARGUMENTS
 
 <crt_file>
-:  Path to a certificate or certificate signing request (CSR) to lint.
+:  Path to a PEM or DER encoded certificate to lint.
 
 ## EXIT CODES
 
-This command returns 0 on success and \>0 if any error occurs.
+This command returns 0 on success and \>0 if any error occurs or if any of the
+lints reports an error or a fatal result. Warnings and notices do not change the
+exit code.
 
 ## EXAMPLES
 
@@ -37,6 +44,15 @@ This command returns 0 on success and \>0 if any error occurs.
 $ step certificate lint ./certificate.crt
 '''
 
+Lint a certificate and print only the lints that did not pass:
+
+'''
+$ step certificate lint --format text ./certificate.crt
+warn    w_sub_cert_aia_does_not_contain_issuing_ca_url
+error   e_sub_cert_aia_missing
+1 errors, 1 warnings, 0 notices
+'''
+
 Lint a remote certificate (using the default root certificate bundle to verify the server):
 
 '''
@@ -84,6 +100,20 @@ authenticity of the remote server.
 				Usage: `Use an insecure client to retrieve a remote peer certificate. Useful for
 debugging invalid certificates remotely.`,
 			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "json",
+				Usage: `The output <format> of the results.
+
+: <format> is a case-sensitive string and must be one of:
+
+    **json**
+    :  Print all the lint results in JSON format (default).
+
+    **text**
+    :  Print only the notices, warnings, errors and fatal results, one per line,
+    followed by a summary.`,
+			},
 		},
 	}
 }
@@ -97,41 +127,93 @@ func lintAction(ctx *cli.Context) error {
 		crtFile  = ctx.Args().Get(0)
 		roots    = ctx.String("roots")
 		insecure = ctx.Bool("insecure")
-		block    *pem.Block
+		format   = ctx.String("format")
+		der      []byte
 	)
+
+	switch format {
+	case "json", "text":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "json, text")
+	}
+
 	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
-		peerCertificates, err := getPeerCertificates(addr, roots, insecure)
+		peerCertificates, err := getPeerCertificates(addr, "", roots, insecure)
 		if err != nil {
 			return err
 		}
-		crt := peerCertificates[0]
-		block = &pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: crt.Raw,
-		}
+		der = peerCertificates[0].Raw
 	} else {
 		crtBytes, err := ioutil.ReadFile(crtFile)
 		if err != nil {
 			return errs.FileError(err, crtFile)
 		}
-		block, _ = pem.Decode(crtBytes)
-		if block == nil {
-			return errors.Errorf("could not parse certificate file '%s'", crtFile)
+		// Use the input as DER if it's not PEM encoded
+		if block, _ := pem.Decode(crtBytes); block != nil {
+			der = block.Bytes
+		} else {
+			der = crtBytes
 		}
 	}
 
-	zcrt, err := zx509.ParseCertificate(block.Bytes)
+	zcrt, err := zx509.ParseCertificate(der)
 	if err != nil {
-		return errors.WithStack(err)
+		return errors.Wrapf(err, "could not parse certificate file '%s'", crtFile)
 	}
 	zlintResult := zlint.LintCertificate(zcrt)
-	b, err := json.MarshalIndent(struct {
-		*zlint.ResultSet
-	}{zlintResult}, "", " ")
-	if err != nil {
-		return errors.WithStack(err)
+
+	if format == "text" {
+		printLintResults(zlintResult)
+	} else {
+		b, err := json.MarshalIndent(struct {
+			*zlint.ResultSet
+		}{zlintResult}, "", " ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		os.Stdout.Write(append(b, '\n'))
 	}
-	os.Stdout.Write(b)
 
+	if zlintResult.ErrorsPresent || zlintResult.FatalsPresent {
+		return errs.NewExitError(errors.Errorf("certificate '%s' has lint errors", crtFile), 1)
+	}
 	return nil
 }
+
+// printLintResults prints the lints that did not pass, sorted by severity and
+// name, and a summary line.
+func printLintResults(rs *zlint.ResultSet) {
+	var names []string
+	var nErrors, nWarnings, nNotices int
+	for name, r := range rs.Results {
+		switch r.Status {
+		case lints.Fatal, lints.Error:
+			nErrors++
+		case lints.Warn:
+			nWarnings++
+		case lints.Notice:
+			nNotices++
+		default:
+			continue
+		}
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		si, sj := rs.Results[names[i]].Status, rs.Results[names[j]].Status
+		if si != sj {
+			return si < sj
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		r := rs.Results[name]
+		if r.Details != "" {
+			fmt.Printf("%-7s %s: %s\n", r.Status, name, r.Details)
+		} else {
+			fmt.Printf("%-7s %s\n", r.Status, name)
+		}
+	}
+	fmt.Printf("%d errors, %d warnings, %d notices\n", nErrors, nWarnings, nNotices)
+}
@@ -0,0 +1,479 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func monitorCommand() cli.Command {
+	return cli.Command{
+		Name:   "monitor",
+		Action: cli.ActionFunc(monitorAction),
+		Usage:  "watch certificates for upcoming expirations",
+		UsageText: `**step certificate monitor** **--config**=<file>
+		[**--once**] [**--listen**=<address>] [**--webhook**=<url>]`,
+		Description: `**step certificate monitor** periodically checks the certificates in a list of
+files and remote servers, and reports the ones that are about to expire. The
+results of each check are printed to STDOUT, and they can also be sent to a
+webhook, or exposed as Prometheus metrics.
+
+Like **step certificate needs-renewal**, a certificate is expiring when its
+remaining lifetime is below a threshold, a duration like '72h' or a percentage
+of its total lifetime like '33%'.
+
+The configuration is a YAML (or JSON) file with the following format:
+'''
+interval: 1h
+expires-in: 33%
+webhook: https://hooks.example.com/certificates
+listen: :9100
+targets:
+  - name: web
+    file: /etc/nginx/certs/web.crt
+  - name: api
+    address: https://api.example.com
+    roots: /etc/step/certs/root_ca.crt
+    expires-in: 72h
+  - file: /etc/envoy/bundle.crt
+    bundle: true
+'''
+
+**interval**
+:  The time between checks, by default 1h.
+
+**expires-in**
+:  The default threshold of the targets, by default 33%.
+
+**webhook**
+:  The URL that receives a POST request with a JSON body when the status of a
+target changes. Healthy targets are not sent in the first check.
+
+**listen**
+:  The address of the HTTP server that exposes the results as Prometheus
+metrics in /metrics.
+
+**targets**
+:  The list of certificates to check. Each target has a **file** with a
+certificate or bundle, or the **address** of a remote server, and optionally
+a **name**, the **servername** and **roots** used to connect to the server,
+its own **expires-in** threshold, and **bundle** to check all the
+certificates of the bundle instead of the first one.
+
+## EXIT CODES
+
+With the **--once** flag, this command returns 0 if no certificate is
+expiring, 1 if a certificate is expiring, 2 if a certificate has expired or it
+could not be checked, and 255 if the configuration is not valid.
+
+## EXAMPLES
+
+Check the certificates once, e.g. in a cron job:
+'''
+$ step certificate monitor --config monitors.yaml --once
+web: expires in 719h59m0s
+api: expiring, expires in 48h0m0s
+/etc/envoy/bundle.crt: expires in 2159h59m0s
+'''
+
+Watch the certificates and expose the metrics in port 9100:
+'''
+$ step certificate monitor --config monitors.yaml --listen :9100
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "config",
+				Usage: `The YAML <file> with the targets to monitor.`,
+			},
+			cli.BoolFlag{
+				Name:  "once",
+				Usage: `Check the certificates once and exit with the status of the check.`,
+			},
+			cli.StringFlag{
+				Name:  "listen",
+				Usage: `The <address> of the Prometheus metrics server, overrides the configuration.`,
+			},
+			cli.StringFlag{
+				Name:  "webhook",
+				Usage: `The <url> of the webhook, overrides the configuration.`,
+			},
+		},
+	}
+}
+
+// monitorConfig is the configuration of step certificate monitor.
+type monitorConfig struct {
+	Interval  string          `yaml:"interval"`
+	ExpiresIn string          `yaml:"expires-in"`
+	Webhook   string          `yaml:"webhook"`
+	Listen    string          `yaml:"listen"`
+	Targets   []monitorTarget `yaml:"targets"`
+	interval  time.Duration
+}
+
+// monitorTarget is a certificate file or a remote server to monitor.
+type monitorTarget struct {
+	Name       string `yaml:"name"`
+	File       string `yaml:"file"`
+	Address    string `yaml:"address"`
+	ServerName string `yaml:"servername"`
+	Roots      string `yaml:"roots"`
+	Bundle     bool   `yaml:"bundle"`
+	ExpiresIn  string `yaml:"expires-in"`
+	threshold  func(*x509.Certificate) time.Duration
+}
+
+type monitorStatus int
+
+const (
+	monitorOK monitorStatus = iota
+	monitorExpiring
+	monitorExpired
+	monitorError
+)
+
+func (s monitorStatus) String() string {
+	switch s {
+	case monitorOK:
+		return "ok"
+	case monitorExpiring:
+		return "expiring"
+	case monitorExpired:
+		return "expired"
+	default:
+		return "error"
+	}
+}
+
+// monitorResult is the result of the check of a target, the certificate is
+// the one that expires first.
+type monitorResult struct {
+	Target   string    `json:"target"`
+	Status   string    `json:"status"`
+	Subject  string    `json:"subject,omitempty"`
+	NotAfter time.Time `json:"notAfter,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	status   monitorStatus
+}
+
+func (r *monitorResult) String() string {
+	switch r.status {
+	case monitorError:
+		return fmt.Sprintf("%s: error, %s", r.Target, r.Error)
+	case monitorExpired:
+		return fmt.Sprintf("%s: expired %s ago", r.Target, time.Since(r.NotAfter).Round(time.Second))
+	case monitorExpiring:
+		return fmt.Sprintf("%s: expiring, expires in %s", r.Target, time.Until(r.NotAfter).Round(time.Second))
+	default:
+		return fmt.Sprintf("%s: expires in %s", r.Target, time.Until(r.NotAfter).Round(time.Second))
+	}
+}
+
+func monitorAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+	filename := ctx.String("config")
+	if filename == "" {
+		return errs.RequiredFlag(ctx, "config")
+	}
+	cfg, err := readMonitorConfig(filename)
+	if err != nil {
+		return errs.NewExitError(err, 255)
+	}
+	if v := ctx.String("listen"); v != "" {
+		cfg.Listen = v
+	}
+	if v := ctx.String("webhook"); v != "" {
+		cfg.Webhook = v
+	}
+
+	m := &monitor{config: cfg}
+	if ctx.Bool("once") {
+		results := m.check()
+		if err := m.notify(results); err != nil {
+			return errs.NewExitError(err, 2)
+		}
+		switch code := exitCode(results); code {
+		case 0:
+			return nil
+		default:
+			return errs.NewExitError(errors.New(""), code)
+		}
+	}
+	return m.run()
+}
+
+func readMonitorConfig(filename string) (*monitorConfig, error) {
+	b, err := utils.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(monitorConfig)
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+
+	cfg.interval = time.Hour
+	if cfg.Interval != "" {
+		if cfg.interval, err = time.ParseDuration(cfg.Interval); err != nil || cfg.interval <= 0 {
+			return nil, errors.Errorf("error parsing %s: invalid interval '%s'", filename, cfg.Interval)
+		}
+	}
+	if cfg.ExpiresIn == "" {
+		cfg.ExpiresIn = "33%"
+	}
+	if len(cfg.Targets) == 0 {
+		return nil, errors.Errorf("error parsing %s: targets cannot be empty", filename)
+	}
+
+	seen := make(map[string]bool)
+	for i := range cfg.Targets {
+		t := &cfg.Targets[i]
+		switch {
+		case t.File == "" && t.Address == "":
+			return nil, errors.Errorf("error parsing %s: target %d: file or address is required", filename, i+1)
+		case t.File != "" && t.Address != "":
+			return nil, errors.Errorf("error parsing %s: target %d: file and address are mutually exclusive", filename, i+1)
+		}
+		if t.Address != "" {
+			if _, _, isURL := trimURLPrefix(t.Address); !isURL {
+				t.Address = "https://" + t.Address
+			}
+		}
+		if t.Name == "" {
+			t.Name = t.File + t.Address
+		}
+		if seen[t.Name] {
+			return nil, errors.Errorf("error parsing %s: target %s is used more than once", filename, t.Name)
+		}
+		seen[t.Name] = true
+
+		expiresIn := t.ExpiresIn
+		if expiresIn == "" {
+			expiresIn = cfg.ExpiresIn
+		}
+		if t.threshold, err = parseRenewalThreshold(expiresIn); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s: target %s", filename, t.Name)
+		}
+	}
+	return cfg, nil
+}
+
+// exitCode returns the exit code of a check, the highest of the status of
+// the targets.
+func exitCode(results []*monitorResult) int {
+	code := 0
+	for _, r := range results {
+		c := 0
+		switch r.status {
+		case monitorExpiring:
+			c = 1
+		case monitorExpired, monitorError:
+			c = 2
+		}
+		if c > code {
+			code = c
+		}
+	}
+	return code
+}
+
+// monitor checks the targets, and keeps the last results for the metrics
+// and the webhook.
+type monitor struct {
+	config *monitorConfig
+	mu     sync.RWMutex
+	last   map[string]*monitorResult
+}
+
+// check checks all the targets and prints the results.
+func (m *monitor) check() []*monitorResult {
+	results := make([]*monitorResult, len(m.config.Targets))
+	for i := range m.config.Targets {
+		results[i] = checkTarget(&m.config.Targets[i])
+		fmt.Println(results[i])
+	}
+	return results
+}
+
+func checkTarget(t *monitorTarget) *monitorResult {
+	var err error
+	var certs []*x509.Certificate
+	if t.Address != "" {
+		_, addr, _ := trimURLPrefix(t.Address)
+		certs, err = getPeerCertificates(addr, t.ServerName, t.Roots, false)
+	} else {
+		certs, err = pemutil.ReadCertificateBundle(t.File)
+	}
+	if err != nil {
+		return &monitorResult{Target: t.Name, Status: monitorError.String(), Error: err.Error(), status: monitorError}
+	}
+	if !t.Bundle {
+		certs = certs[:1]
+	}
+
+	now := time.Now()
+	var crt *x509.Certificate
+	status := monitorOK
+	for _, c := range certs {
+		left := c.NotAfter.Sub(now)
+		s := monitorOK
+		switch {
+		case left <= 0:
+			s = monitorExpired
+		case left < t.threshold(c):
+			s = monitorExpiring
+		}
+		if crt == nil || s > status || (s == status && c.NotAfter.Before(crt.NotAfter)) {
+			crt, status = c, s
+		}
+	}
+	return &monitorResult{
+		Target:   t.Name,
+		Status:   status.String(),
+		Subject:  crt.Subject.String(),
+		NotAfter: crt.NotAfter,
+		status:   status,
+	}
+}
+
+// notify sends the results with a new status to the webhook, and keeps them
+// for the next check and the metrics.
+func (m *monitor) notify(results []*monitorResult) error {
+	m.mu.Lock()
+	var changed []*monitorResult
+	for _, r := range results {
+		prev, ok := m.last[r.Target]
+		if (ok && prev.status != r.status) || (!ok && r.status != monitorOK) {
+			changed = append(changed, r)
+		}
+	}
+	m.last = make(map[string]*monitorResult, len(results))
+	for _, r := range results {
+		m.last[r.Target] = r
+	}
+	m.mu.Unlock()
+
+	if m.config.Webhook == "" || len(changed) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"results": changed,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling webhook request")
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: pki.WrapTransport(pki.NewTransport(nil)),
+	}
+	resp, err := client.Post(m.config.Webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "error sending webhook request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.Errorf("error sending webhook request: %s", resp.Status)
+	}
+	return nil
+}
+
+// run checks the targets until the process receives an interrupt or
+// termination signal.
+func (m *monitor) run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if m.config.Listen != "" {
+		ln, err := net.Listen("tcp", m.config.Listen)
+		if err != nil {
+			return errors.Wrapf(err, "error listening on %s", m.config.Listen)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", m.serveMetrics)
+		srv := &http.Server{Handler: mux}
+		go srv.Serve(ln)
+		defer srv.Shutdown(ctx)
+	}
+
+	ticker := time.NewTicker(m.config.interval)
+	defer ticker.Stop()
+	for {
+		if err := m.notify(m.check()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveMetrics writes the last results in the Prometheus text format.
+func (m *monitor) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var buf bytes.Buffer
+	buf.WriteString("# HELP step_certificate_check_success Whether the last check of the target succeeded.\n")
+	buf.WriteString("# TYPE step_certificate_check_success gauge\n")
+	for _, t := range m.config.Targets {
+		if r, ok := m.last[t.Name]; ok {
+			fmt.Fprintf(&buf, "step_certificate_check_success{target=\"%s\"} %d\n", escapeLabel(t.Name), boolToInt(r.status != monitorError))
+		}
+	}
+	buf.WriteString("# HELP step_certificate_not_after_seconds Expiration time of the certificate in seconds since the epoch.\n")
+	buf.WriteString("# TYPE step_certificate_not_after_seconds gauge\n")
+	for _, t := range m.config.Targets {
+		if r, ok := m.last[t.Name]; ok && r.status != monitorError {
+			fmt.Fprintf(&buf, "step_certificate_not_after_seconds{target=\"%s\"} %d\n", escapeLabel(t.Name), r.NotAfter.Unix())
+		}
+	}
+	buf.WriteString("# HELP step_certificate_expiring Whether the certificate is expiring or has expired.\n")
+	buf.WriteString("# TYPE step_certificate_expiring gauge\n")
+	for _, t := range m.config.Targets {
+		if r, ok := m.last[t.Name]; ok && r.status != monitorError {
+			fmt.Fprintf(&buf, "step_certificate_expiring{target=\"%s\"} %d\n", escapeLabel(t.Name), boolToInt(r.status != monitorOK))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value in the Prometheus text format.
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
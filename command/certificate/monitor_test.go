@@ -0,0 +1,213 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func mustWriteCertificates(t *testing.T, filename string, certs ...*x509.Certificate) string {
+	var b []byte
+	for _, c := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	assert.FatalError(t, ioutil.WriteFile(filename, b, 0600))
+	return filename
+}
+
+func TestReadMonitorConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-monitor")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	type target struct {
+		name, file, address string
+		threshold           time.Duration
+	}
+	// The lifetime of the certificate is 100h, so percentages are hours.
+	now := time.Now()
+	cert := &x509.Certificate{NotBefore: now, NotAfter: now.Add(100 * time.Hour)}
+
+	tests := map[string]struct {
+		config       string
+		wantInterval time.Duration
+		wantTargets  []target
+		wantErr      string
+	}{
+		"ok-defaults": {
+			config:       "targets:\n  - file: web.crt\n",
+			wantInterval: time.Hour,
+			wantTargets:  []target{{"web.crt", "web.crt", "", 33 * time.Hour}},
+		},
+		"ok": {
+			config: `interval: 5m
+expires-in: 50%
+webhook: https://hooks.example.com/certificates
+listen: :9100
+targets:
+  - name: web
+    file: web.crt
+  - name: api
+    address: https://api.example.com
+    expires-in: 72h
+  - address: db.example.com:5432
+    servername: db
+`,
+			wantInterval: 5 * time.Minute,
+			wantTargets: []target{
+				{"web", "web.crt", "", 50 * time.Hour},
+				{"api", "", "https://api.example.com", 72 * time.Hour},
+				{"https://db.example.com:5432", "", "https://db.example.com:5432", 50 * time.Hour},
+			},
+		},
+		"ok-json": {
+			config:       `{"interval": "30s", "targets": [{"name": "web", "file": "web.crt", "expires-in": "10%"}]}`,
+			wantInterval: 30 * time.Second,
+			wantTargets:  []target{{"web", "web.crt", "", 10 * time.Hour}},
+		},
+		"fail-yaml":              {config: "targets: [", wantErr: "error parsing"},
+		"fail-unknown-field":     {config: "targets:\n  - file: web.crt\n    foo: bar\n", wantErr: "error parsing"},
+		"fail-interval":          {config: "interval: 1x\ntargets:\n  - file: web.crt\n", wantErr: "invalid interval '1x'"},
+		"fail-interval-zero":     {config: "interval: 0s\ntargets:\n  - file: web.crt\n", wantErr: "invalid interval '0s'"},
+		"fail-no-targets":        {config: "interval: 1h\n", wantErr: "targets cannot be empty"},
+		"fail-no-source":         {config: "targets:\n  - name: web\n", wantErr: "target 1: file or address is required"},
+		"fail-both-sources":      {config: "targets:\n  - file: web.crt\n    address: web.example.com\n", wantErr: "target 1: file and address are mutually exclusive"},
+		"fail-duplicate":         {config: "targets:\n  - file: web.crt\n  - name: web.crt\n    address: web.example.com\n", wantErr: "target web.crt is used more than once"},
+		"fail-expires-in":        {config: "expires-in: 120%\ntargets:\n  - file: web.crt\n", wantErr: "target web.crt: invalid percentage '120%'"},
+		"fail-target-expires-in": {config: "targets:\n  - file: web.crt\n    expires-in: -1h\n", wantErr: "target web.crt: invalid duration '-1h'"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name+".yaml")
+			assert.FatalError(t, ioutil.WriteFile(filename, []byte(tc.config), 0600))
+
+			cfg, err := readMonitorConfig(filename)
+			if tc.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.True(t, strings.Contains(err.Error(), tc.wantErr), err.Error())
+				}
+				assert.Nil(t, cfg)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.wantInterval, cfg.interval)
+			if assert.Equals(t, len(tc.wantTargets), len(cfg.Targets)) {
+				for i, want := range tc.wantTargets {
+					got := cfg.Targets[i]
+					assert.Equals(t, want.name, got.Name)
+					assert.Equals(t, want.file, got.File)
+					assert.Equals(t, want.address, got.Address)
+					assert.Equals(t, want.threshold, got.threshold(cert))
+				}
+			}
+		})
+	}
+
+	_, err = readMonitorConfig(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestCheckTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-monitor")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	// All the certificates have a lifetime of 100h.
+	leaf := func(cn string, notBefore time.Duration) *x509.Certificate {
+		crt, _ := mustCertificate(t, &x509.Certificate{
+			Subject:   pkix.Name{CommonName: cn},
+			NotBefore: now.Add(notBefore),
+			NotAfter:  now.Add(notBefore + 100*time.Hour),
+		}, nil, nil)
+		return crt
+	}
+	valid := leaf("valid", -time.Hour)
+	valid2 := leaf("valid2", -2*time.Hour)
+	expiring := leaf("expiring", -90*time.Hour)
+	expired := leaf("expired", -101*time.Hour)
+
+	validFile := mustWriteCertificates(t, filepath.Join(dir, "valid.crt"), valid)
+	expiringFile := mustWriteCertificates(t, filepath.Join(dir, "expiring.crt"), expiring)
+	expiredFile := mustWriteCertificates(t, filepath.Join(dir, "expired.crt"), expired)
+	bundleFile := mustWriteCertificates(t, filepath.Join(dir, "bundle.crt"), valid, expired, expiring)
+	validBundleFile := mustWriteCertificates(t, filepath.Join(dir, "valid-bundle.crt"), valid, valid2)
+	invalidFile := filepath.Join(dir, "invalid.crt")
+	assert.FatalError(t, ioutil.WriteFile(invalidFile, []byte("not a certificate"), 0600))
+
+	tests := map[string]struct {
+		file      string
+		bundle    bool
+		expiresIn string
+		want      monitorStatus
+		wantCert  *x509.Certificate
+	}{
+		"ok":                   {validFile, false, "33%", monitorOK, valid},
+		"ok-duration":          {expiringFile, false, "9h", monitorOK, expiring},
+		"ok-zero":              {expiringFile, false, "0%", monitorOK, expiring},
+		"ok-bundle-first":      {bundleFile, false, "33%", monitorOK, valid},
+		"ok-bundle-earliest":   {validBundleFile, true, "33%", monitorOK, valid2},
+		"expiring":             {expiringFile, false, "33%", monitorExpiring, expiring},
+		"expiring-duration":    {validFile, false, "100h", monitorExpiring, valid},
+		"expiring-bundle":      {validBundleFile, true, "99h", monitorExpiring, valid2},
+		"expired":              {expiredFile, false, "33%", monitorExpired, expired},
+		"expired-zero":         {expiredFile, false, "0s", monitorExpired, expired},
+		"expired-bundle":       {bundleFile, true, "33%", monitorExpired, expired},
+		"error-missing-file":   {filepath.Join(dir, "missing.crt"), false, "33%", monitorError, nil},
+		"error-invalid-file":   {invalidFile, false, "33%", monitorError, nil},
+		"error-invalid-bundle": {invalidFile, true, "33%", monitorError, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			threshold, err := parseRenewalThreshold(tc.expiresIn)
+			assert.FatalError(t, err)
+			r := checkTarget(&monitorTarget{
+				Name:      name,
+				File:      tc.file,
+				Bundle:    tc.bundle,
+				threshold: threshold,
+			})
+			assert.Equals(t, name, r.Target)
+			assert.Equals(t, tc.want, r.status)
+			assert.Equals(t, tc.want.String(), r.Status)
+			if tc.wantCert == nil {
+				assert.True(t, r.Error != "")
+				assert.Equals(t, "", r.Subject)
+				assert.True(t, r.NotAfter.IsZero())
+				return
+			}
+			assert.Equals(t, "", r.Error)
+			assert.Equals(t, tc.wantCert.Subject.String(), r.Subject)
+			assert.Equals(t, tc.wantCert.NotAfter, r.NotAfter)
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	result := func(s monitorStatus) *monitorResult {
+		return &monitorResult{status: s}
+	}
+	tests := map[string]struct {
+		results []*monitorResult
+		want    int
+	}{
+		"empty":    {nil, 0},
+		"ok":       {[]*monitorResult{result(monitorOK), result(monitorOK)}, 0},
+		"expiring": {[]*monitorResult{result(monitorOK), result(monitorExpiring)}, 1},
+		"expired":  {[]*monitorResult{result(monitorExpired), result(monitorExpiring)}, 2},
+		"error":    {[]*monitorResult{result(monitorOK), result(monitorError)}, 2},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equals(t, tc.want, exitCode(tc.results))
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+func needsRenewalCommand() cli.Command {
+	return cli.Command{
+		Name:   "needs-renewal",
+		Action: cli.ActionFunc(needsRenewalAction),
+		Usage:  "check if a certificate needs to be renewed",
+		UsageText: `**step certificate needs-renewal** <crt-file>
+		[**--expires-in**=<duration|percent>] [**--bundle**] [**--verbose**]
+		[**--roots**=<root-bundle>] [**--servername**=<name>]`,
+		Description: `**step certificate needs-renewal** checks if the remaining lifetime of a
+certificate is below a threshold. It is designed to be used in cron jobs and
+health checks to decide whether to call **step ca renew**.
+
+The threshold can be a duration, e.g. '8h' or '72h', or a percentage of the
+total lifetime of the certificate, e.g. '33%'. By default a certificate needs
+to be renewed when less than a third of its lifetime remains.
+
+## POSITIONAL ARGUMENTS
+
+<crt-file>
+:  The path to a certificate or certificate bundle, or the address of a remote
+server.
+
+## EXIT CODES
+
+This command returns 0 if the certificate needs to be renewed, 1 if it does not
+need to be renewed, and 255 if an error occurs.
+
+## EXAMPLES
+
+Check if a certificate needs to be renewed using the default threshold:
+'''
+$ step certificate needs-renewal internal.crt
+'''
+
+Renew the certificate if it expires in less than 8 hours:
+'''
+$ step certificate needs-renewal --expires-in 8h internal.crt && \
+  step ca renew --force internal.crt internal.key
+'''
+
+Check if less than 10% of the lifetime of any certificate in a bundle remains:
+'''
+$ step certificate needs-renewal --expires-in 10% --bundle --verbose bundle.crt
+certificate 1 needs renewal: expires in 12h30m0s
+'''
+
+Check the certificate of a remote server:
+'''
+$ step certificate needs-renewal https://smallstep.com
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "expires-in",
+				Value: "33%",
+				Usage: `The <duration> or <percent> of the remaining lifetime below which the
+certificate needs to be renewed.`,
+			},
+			cli.BoolFlag{
+				Name:  "bundle",
+				Usage: `Check all the certificates in the bundle, not only the first one.`,
+			},
+			cli.BoolFlag{
+				Name:  "verbose,v",
+				Usage: `Print the reason of the result to STDOUT.`,
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) that will be used to verify the
+authenticity of the remote server.`,
+			},
+			serverNameFlag,
+		},
+	}
+}
+
+func needsRenewalAction(ctx *cli.Context) error {
+	needsRenewal, err := needsRenewal(ctx)
+	if err != nil {
+		return errs.NewExitError(err, 255)
+	}
+	if !needsRenewal {
+		return errs.NewExitError(errors.New(""), 1)
+	}
+	return nil
+}
+
+func needsRenewal(ctx *cli.Context) (bool, error) {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return false, err
+	}
+
+	var (
+		certs   []*x509.Certificate
+		err     error
+		crtFile = ctx.Args().First()
+		verbose = ctx.Bool("verbose")
+	)
+
+	expiresIn := ctx.String("expires-in")
+	threshold, err := parseRenewalThreshold(expiresIn)
+	if err != nil {
+		return false, errs.InvalidFlagValue(ctx, "expires-in", expiresIn, "")
+	}
+
+	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
+		certs, err = getPeerCertificates(addr, ctx.String("servername"), ctx.String("roots"), false)
+	} else {
+		certs, err = pemutil.ReadCertificateBundle(crtFile)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !ctx.Bool("bundle") {
+		certs = certs[:1]
+	}
+
+	now := time.Now()
+	for i, crt := range certs {
+		left := crt.NotAfter.Sub(now)
+		if left < threshold(crt) {
+			if verbose {
+				if left <= 0 {
+					fmt.Printf("certificate %d needs renewal: expired %s ago\n", i, (-left).Round(time.Second))
+				} else {
+					fmt.Printf("certificate %d needs renewal: expires in %s\n", i, left.Round(time.Second))
+				}
+			}
+			return true, nil
+		}
+	}
+
+	if verbose {
+		fmt.Println("certificate does not need renewal")
+	}
+	return false, nil
+}
+
+// parseRenewalThreshold parses a duration or a percentage and returns a
+// function that returns the threshold for a given certificate.
+func parseRenewalThreshold(s string) (func(*x509.Certificate) time.Duration, error) {
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, errors.Errorf("invalid percentage '%s'", s)
+		}
+		return func(crt *x509.Certificate) time.Duration {
+			lifetime := crt.NotAfter.Sub(crt.NotBefore)
+			return time.Duration(float64(lifetime) * p / 100)
+		}, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return nil, errors.Errorf("invalid duration '%s'", s)
+	}
+	return func(*x509.Certificate) time.Duration {
+		return d
+	}, nil
+}
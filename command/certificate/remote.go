@@ -3,25 +3,36 @@ package certificate
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"net"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/urfave/cli"
 )
 
 var urlPrefixes = []string{"https://", "tcp://", "tls://"}
 
+// serverNameFlag is the flag used to set the SNI on remote connections.
+var serverNameFlag = cli.StringFlag{
+	Name: "servername",
+	Usage: `The TLS server <name> used for Server Name Indication (SNI) and to verify the
+hostname of a remote server. Defaults to the host in the URL.`,
+}
+
 // getPeerCertificates creates a connection to a remote server and returns the
 // list of server certificates.
 //
 // If the address does not contain a port then default to port 443.
 //
 // Params
-//   *addr*:     e.g. smallstep.com
-//   *roots*:    a file, a directory, or a comma-separated list of files.
-//   *insecure*: do not verify that the server's certificate has been signed by
-//               a trusted root
-func getPeerCertificates(addr, roots string, insecure bool) ([]*x509.Certificate, error) {
+//   *addr*:       e.g. smallstep.com
+//   *serverName*: the name used for SNI and to verify the server's hostname,
+//                 defaults to the host in addr.
+//   *roots*:      a file, a directory, or a comma-separated list of files.
+//   *insecure*:   do not verify that the server's certificate has been signed
+//                 by a trusted root
+func getPeerCertificates(addr, serverName, roots string, insecure bool) ([]*x509.Certificate, error) {
 	var (
 		err     error
 		rootCAs *x509.CertPool
@@ -32,10 +43,11 @@ func getPeerCertificates(addr, roots string, insecure bool) ([]*x509.Certificate
 			return nil, errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
 		}
 	}
-	if !strings.Contains(addr, ":") {
-		addr += ":443"
+	addr = getPeerAddress(addr)
+	tlsConfig := &tls.Config{
+		RootCAs:    rootCAs,
+		ServerName: serverName,
 	}
-	tlsConfig := &tls.Config{RootCAs: rootCAs}
 	if insecure {
 		tlsConfig.InsecureSkipVerify = true
 	}
@@ -47,6 +59,24 @@ func getPeerCertificates(addr, roots string, insecure bool) ([]*x509.Certificate
 	return conn.ConnectionState().PeerCertificates, nil
 }
 
+// getPeerAddress removes the path from the given address and adds the
+// default port 443 if the address does not contain one.
+//
+// Examples:
+// getPeerAddress("smallstep.com") -> "smallstep.com:443"
+// getPeerAddress("smallstep.com:8443/path") -> "smallstep.com:8443"
+// getPeerAddress("[::1]") -> "[::1]:443"
+func getPeerAddress(addr string) string {
+	if i := strings.IndexAny(addr, "/?#"); i >= 0 {
+		addr = addr[:i]
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		return net.JoinHostPort(host, "443")
+	}
+	return addr
+}
+
 // trimURLPrefix returns the url split into prefix and suffix and a bool which
 // tells if the input string had a recognizable URL prefix.
 //
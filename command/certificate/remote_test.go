@@ -28,3 +28,24 @@ func TestTrimUrlPrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPeerAddress(t *testing.T) {
+	tests := map[string]struct {
+		input, want string
+	}{
+		"host":           {"smallstep.com", "smallstep.com:443"},
+		"host-port":      {"smallstep.com:8443", "smallstep.com:8443"},
+		"host-path":      {"smallstep.com/foo/bar", "smallstep.com:443"},
+		"host-port-path": {"smallstep.com:8443/foo?bar=zar", "smallstep.com:8443"},
+		"ipv4":           {"127.0.0.1", "127.0.0.1:443"},
+		"ipv4-port":      {"127.0.0.1:9000", "127.0.0.1:9000"},
+		"ipv6":           {"[::1]", "[::1]:443"},
+		"ipv6-port":      {"[::1]:9000", "[::1]:9000"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equals(t, tc.want, getPeerAddress(tc.input))
+		})
+	}
+}
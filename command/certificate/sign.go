@@ -1,24 +1,36 @@
 package certificate
 
 import (
+	"bytes"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/pkg/x509"
 	"github.com/urfave/cli"
 )
 
 func signCommand() cli.Command {
 	return cli.Command{
-		Name:      "sign",
-		Action:    cli.ActionFunc(signAction),
-		Usage:     "sign a certificate signing request (CSR)",
-		UsageText: `**step certificate sign** <csr_file> <crt_file> <key_file>`,
+		Name:   "sign",
+		Action: cli.ActionFunc(signAction),
+		Usage:  "sign a certificate signing request (CSR)",
+		UsageText: `**step certificate sign** <csr_file> <crt_file> <key_file>
+[**--profile**=<profile>] [**--not-before**=<time|duration>]
+[**--not-after**=<time|duration>] [**--password-file**=<file>] [**--bundle**]`,
 		Description: `**step certificate sign** generates a signed
-certificate from a certificate signing request (CSR).
+certificate from a certificate signing request (CSR) using a local CA
+certificate and key, without a running step-ca. It can be used to bootstrap
+a PKI or in lab environments.
+
+The subject, Subject Alternative Names and public key of the certificate are
+taken from the CSR. The signature of the CSR is always verified.
 
 ## POSITIONAL ARGUMENTS
 
@@ -29,7 +41,30 @@ certificate from a certificate signing request (CSR).
 : The path to an issuing certificate.
 
 <key_file>
-: The path to a private key for signing the CSR.
+: The path to a private key for signing the CSR. If the key is encrypted the
+command will ask for the password, or read it from **--password-file**.
+It can also be a PKCS #11 URI of a key stored in an HSM, e.g.
+'pkcs11:token=step;object=intermediate-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/run/pin.txt',
+or the URI of a key stored in a cloud KMS:
+
+**awskms:key-id=<id>[;region=<region>][;profile=<profile>][;credentials-file=<file>]**
+:  A key in AWS KMS, the <id> is the key id, ARN or alias. By default the
+credentials and the region are loaded from the environment and the shared AWS
+configuration.
+
+**cloudkms:name=<key-version>[;credentials-file=<file>]**
+:  A key version in Google Cloud KMS, e.g.
+'projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>/cryptoKeyVersions/<version>'.
+By default the application default credentials are used.
+
+**azurekms:vault=<vault>;name=<key>[;version=<version>]**
+:  A key in Azure Key Vault, the <vault> is the name or the host of the key
+vault. By default the current version of the key is used. The credentials are
+loaded from the environment, a managed identity or the Azure CLI.
+
+The cloud KMS are only supported if step is compiled with the build tag of the
+KMS, awskms, cloudkms or azurekms, e.g. 'make build TAGS=awskms'. PKCS #11
+requires step compiled with cgo and the pkcs11 build tag.
 
 ## EXIT CODES
 
@@ -43,7 +78,87 @@ Sign a certificate signing request:
 $ step certificate sign ./certificate-signing-request.csr \
 ./issuer-certificate.crt ./issuer-private-key.priv
 '''
+
+Sign a certificate signing request for an intermediate CA valid for 5 years:
+
+'''
+$ step certificate sign --profile intermediate-ca --not-after 43800h \
+intermediate.csr root_ca.crt root_ca_key > intermediate_ca.crt
+'''
+
+Sign a certificate signing request using a key stored in an HSM:
+
+'''
+$ step certificate sign foo.csr intermediate_ca.crt \
+'pkcs11:token=step;object=intermediate-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/run/pin.txt'
+'''
+
+Sign a certificate signing request using a key in AWS KMS:
+
+'''
+$ step certificate sign foo.csr intermediate_ca.crt 'awskms:key-id=alias/intermediate-key;region=us-east-1'
+'''
+
+Sign a certificate signing request using a key in Google Cloud KMS:
+
+'''
+$ step certificate sign foo.csr intermediate_ca.crt \
+'cloudkms:name=projects/my-project/locations/global/keyRings/step/cryptoKeys/intermediate/cryptoKeyVersions/1'
+'''
+
+Sign a certificate signing request using a key in Azure Key Vault:
+
+'''
+$ step certificate sign foo.csr intermediate_ca.crt 'azurekms:vault=my-vault;name=intermediate-key'
+'''
+
+Sign a certificate signing request and bundle it with the issuer:
+
+'''
+$ step certificate sign --bundle --password-file ./password.txt \
+foo.csr intermediate_ca.crt intermediate_ca_key > foo.crt
+'''
 `,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "profile",
+				Value: "leaf",
+				Usage: `The certificate profile sets various certificate details such as
+  certificate use and expiration. The default profile is 'leaf'.
+
+: <profile> is a case-sensitive string and must be one of:
+
+    **leaf**
+    :  Generate a leaf x.509 certificate suitable for use with TLS.
+
+    **intermediate-ca**
+    :  Generate a certificate that can be used to sign additional leaf certificates.`,
+			},
+			cli.StringFlag{
+				Name: "not-before",
+				Usage: `The <time|duration> set in the NotBefore property of the certificate. If a
+<time> is used it is expected to be in RFC 3339 format. If a <duration> is
+used, it is a sequence of decimal numbers, each with optional fraction and a
+unit suffix, such as "300ms", "-1.5h" or "2h45m". Valid time units are "ns",
+"us" (or "µs"), "ms", "s", "m", "h".`,
+			},
+			cli.StringFlag{
+				Name: "not-after",
+				Usage: `The <time|duration> set in the NotAfter property of the certificate. If a
+<time> is used it is expected to be in RFC 3339 format. If a <duration> is
+used, it is a sequence of decimal numbers, each with optional fraction and a
+unit suffix, such as "300ms", "-1.5h" or "2h45m". Valid time units are "ns",
+"us" (or "µs"), "ms", "s", "m", "h".`,
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the issuer private key.`,
+			},
+			cli.BoolFlag{
+				Name:  "bundle",
+				Usage: `Print the issuer certificate after the new certificate.`,
+			},
+		},
 	}
 }
 
@@ -56,9 +171,21 @@ func signAction(ctx *cli.Context) error {
 	crtFile := ctx.Args().Get(1)
 	keyFile := ctx.Args().Get(2)
 
+	notBefore, ok := flags.ParseTimeOrDuration(ctx.String("not-before"))
+	if !ok {
+		return errs.InvalidFlagValue(ctx, "not-before", ctx.String("not-before"), "")
+	}
+	notAfter, ok := flags.ParseTimeOrDuration(ctx.String("not-after"))
+	if !ok {
+		return errs.InvalidFlagValue(ctx, "not-after", ctx.String("not-after"), "")
+	}
+	if !notAfter.IsZero() && !notBefore.IsZero() && notBefore.After(notAfter) {
+		return errs.IncompatibleFlagValues(ctx, "not-before", ctx.String("not-before"), "not-after", ctx.String("not-after"))
+	}
+
 	csrBytes, err := ioutil.ReadFile(csrFile)
 	if err != nil {
-		return errors.WithStack(err)
+		return errs.FileError(err, csrFile)
 	}
 	csr, err := x509util.LoadCSRFromBytes(csrBytes)
 	if err != nil {
@@ -68,20 +195,38 @@ func signAction(ctx *cli.Context) error {
 		return errors.Wrapf(err, "Certificate Request has invalid signature")
 	}
 
-	issuerIdentity, err := x509util.LoadIdentityFromDisk(crtFile, keyFile)
+	var opts []pemutil.Options
+	if passFile := ctx.String("password-file"); passFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(passFile))
+	}
+	issuerIdentity, err := x509util.LoadIdentityFromDisk(crtFile, keyFile, opts...)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	if err := validateIssuer(issuerIdentity); err != nil {
+		return err
+	}
 
-	leafProfile, err := x509util.NewLeafProfileWithCSR(csr, issuerIdentity.Crt,
-		issuerIdentity.Key)
+	validity := x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0)
+
+	var profile x509util.Profile
+	switch prof := ctx.String("profile"); prof {
+	case "leaf":
+		profile, err = x509util.NewLeafProfileWithCSR(csr, issuerIdentity.Crt,
+			issuerIdentity.Key, validity)
+	case "intermediate-ca":
+		profile, err = x509util.NewIntermediateProfileWithCSR(csr, issuerIdentity.Crt,
+			issuerIdentity.Key, validity)
+	default:
+		return errs.InvalidFlagValue(ctx, "profile", prof, "leaf, intermediate-ca")
+	}
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	crtBytes, err := leafProfile.CreateCertificate()
+	crtBytes, err := profile.CreateCertificate()
 	if err != nil {
-		return errors.Wrapf(err, "failure creating new leaf certificate from input csr")
+		return errors.Wrapf(err, "failure creating new certificate from input csr")
 	}
 	block := &pem.Block{
 		Type:  "CERTIFICATE",
@@ -89,6 +234,31 @@ func signAction(ctx *cli.Context) error {
 	}
 	fmt.Printf("%s", string(pem.EncodeToMemory(block)))
 
-	//tok := ctx.String("token")
+	if ctx.Bool("bundle") {
+		fmt.Printf("%s", string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: issuerIdentity.Crt.Raw,
+		})))
+	}
+	return nil
+}
+
+// validateIssuer checks that the issuer certificate is a CA and that the key
+// matches the certificate.
+func validateIssuer(iss *x509util.Identity) error {
+	if !iss.Crt.IsCA {
+		return errors.Errorf("certificate '%s' is not a CA certificate", iss.Crt.Subject.CommonName)
+	}
+	pub, err := keys.PublicKey(iss.Key)
+	if err != nil {
+		return err
+	}
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling public key")
+	}
+	if !bytes.Equal(b, iss.Crt.RawSubjectPublicKeyInfo) {
+		return errors.New("the issuer private key does not match the issuer certificate")
+	}
 	return nil
 }
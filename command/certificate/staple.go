@@ -0,0 +1,398 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// stapleDefaultRefresh is the time between refreshes of the responses
+	// without next update.
+	stapleDefaultRefresh = time.Hour
+	// stapleMinRefresh is the minimum time between refreshes.
+	stapleMinRefresh = time.Minute
+	// stapleMaxBackoff is the maximum time between retries after an error.
+	stapleMaxBackoff = time.Hour
+)
+
+func stapleCommand() cli.Command {
+	return cli.Command{
+		Name:   "staple",
+		Action: cli.ActionFunc(stapleAction),
+		Usage:  "fetch the OCSP response of a certificate for OCSP stapling",
+		UsageText: `**step certificate staple** <crt-file> **--out**=<file>
+		[**--issuer**=<file>] [**--url**=<url>] [**--daemon**] [**--exec**=<command>]`,
+		Description: `**step certificate staple** fetches a fresh OCSP response for a certificate
+from its OCSP responder, and writes it in DER format to the file that web
+servers like nginx ('ssl_stapling_file') or HAProxy ('<crt-file>.ocsp') send
+in the TLS handshake.
+
+The response is verified before it's written, it must be signed by the issuer
+of the certificate or by a responder authorized by it, and it must have a good
+status. The file is replaced atomically, so servers never read a partial
+response.
+
+The issuer is the **--issuer** certificate, the next certificate in <crt-file>
+if it's a bundle, or the certificate downloaded from the caIssuers URL of the
+certificate.
+
+With the **--daemon** flag, the response is refreshed in the middle of its
+validity period, or every hour if it does not have a next update. After an
+error, the request is retried with an exponential backoff, from 1m up to 1h. A
+SIGHUP signal refreshes the response immediately.
+
+## POSITIONAL ARGUMENTS
+
+<crt-file>
+:  The certificate or bundle in PEM format.
+
+## EXAMPLES
+
+Fetch the OCSP response of a certificate bundle for nginx:
+'''
+$ step certificate staple /etc/nginx/certs/web.crt --out /etc/nginx/certs/web.ocsp
+'''
+
+Keep the OCSP response of an HAProxy certificate fresh, and update it in the
+running HAProxy after each refresh:
+'''
+$ step certificate staple web.pem --issuer intermediate_ca.crt --out web.pem.ocsp \
+  --daemon --exec "/usr/local/bin/haproxy-ocsp-update web.pem"
+'''
+
+Reload nginx after each refresh:
+'''
+$ step certificate staple web.crt --out web.ocsp --daemon --exec "nginx -s reload"
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "out",
+				Usage: `The <file> to write the OCSP response in DER format.`,
+			},
+			cli.StringFlag{
+				Name:  "issuer",
+				Usage: `The <file> with the certificate of the issuer.`,
+			},
+			cli.StringFlag{
+				Name:  "url",
+				Usage: `The <url> of the OCSP responder, instead of the URL in the certificate.`,
+			},
+			cli.BoolFlag{
+				Name:  "daemon",
+				Usage: `Keep refreshing the OCSP response until the process is interrupted.`,
+			},
+			cli.StringFlag{
+				Name:  "exec",
+				Usage: `The <command> to run after the OCSP response is written, e.g. to reload the server.`,
+			},
+		},
+	}
+}
+
+func stapleAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+	crtFile := ctx.Args().Get(0)
+	out := ctx.String("out")
+	if out == "" {
+		return errs.RequiredFlag(ctx, "out")
+	}
+	if ctx.String("exec") != "" && !ctx.Bool("daemon") {
+		return errs.RequiredWithFlag(ctx, "exec", "daemon")
+	}
+
+	certs, err := pemutil.ReadCertificateBundle(crtFile)
+	if err != nil {
+		return err
+	}
+	leaf := certs[0]
+
+	var issuer *x509.Certificate
+	switch issuerFile := ctx.String("issuer"); {
+	case issuerFile != "":
+		if issuer, err = pemutil.ReadCertificate(issuerFile); err != nil {
+			return err
+		}
+		if err := leaf.CheckSignatureFrom(issuer); err != nil {
+			return errors.Errorf("certificate '%s' is not signed by '%s'", leaf.Subject.CommonName, issuer.Subject.CommonName)
+		}
+	default:
+		if issuer = findIssuer(leaf, certs[1:]); issuer == nil {
+			if issuer, err = fetchIssuer(leaf); err != nil {
+				return errors.Wrap(err, "error downloading the issuer; use the '--issuer' flag")
+			}
+			if issuer == nil {
+				return errors.Errorf("certificate '%s' does not have a caIssuers URL; use the '--issuer' flag", leaf.Subject.CommonName)
+			}
+		}
+	}
+
+	urls := leaf.OCSPServer
+	if u := ctx.String("url"); u != "" {
+		urls = []string{u}
+	}
+	if len(urls) == 0 {
+		return errors.Errorf("certificate '%s' does not have an OCSP responder; use the '--url' flag", leaf.Subject.CommonName)
+	}
+
+	s := &stapler{
+		leaf:    leaf,
+		issuer:  issuer,
+		urls:    urls,
+		out:     out,
+		execCmd: ctx.String("exec"),
+		client: &http.Client{
+			Transport: pki.WrapTransport(pki.NewTransport(nil)),
+		},
+	}
+	if ctx.Bool("daemon") {
+		return s.daemon()
+	}
+
+	resp, err := s.update()
+	if err != nil {
+		return err
+	}
+	ui.PrintSelected("OCSP Response", out)
+	if !resp.NextUpdate.IsZero() {
+		ui.Printf("The response is valid until %s.\n", resp.NextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// stapler fetches and writes the OCSP responses of a certificate.
+type stapler struct {
+	leaf, issuer *x509.Certificate
+	urls         []string
+	out          string
+	execCmd      string
+	client       *http.Client
+}
+
+// fetch requests the OCSP response from the responders and returns the
+// first valid one.
+func (s *stapler) fetch() (*ocsp.Response, []byte, error) {
+	req, err := ocsp.CreateRequest(s.leaf, s.issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating OCSP request")
+	}
+
+	var lastErr error
+	for _, u := range s.urls {
+		resp, der, err := s.post(u, req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return resp, der, nil
+	}
+	return nil, nil, lastErr
+}
+
+func (s *stapler) post(u string, req []byte) (*ocsp.Response, []byte, error) {
+	r, err := http.NewRequest("POST", u, bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error creating request to %s", u)
+	}
+	r.Header.Set("Content-Type", "application/ocsp-request")
+	r.Header.Set("Accept", "application/ocsp-response")
+	resp, err := s.client.Do(r)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error requesting %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, nil, errs.WithCode(errors.Errorf("error requesting %s: %s", u, resp.Status), errs.StatusCode(resp.StatusCode))
+	}
+	der, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error requesting %s", u)
+	}
+
+	res, err := ocsp.ParseResponseForCert(der, s.leaf, s.issuer)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error parsing OCSP response from %s", u)
+	}
+	now := time.Now()
+	switch {
+	case res.Status == ocsp.Revoked:
+		return nil, nil, errors.Errorf("certificate '%s' was revoked at %s", s.leaf.Subject.CommonName, res.RevokedAt.Format(time.RFC3339))
+	case res.Status != ocsp.Good:
+		return nil, nil, errors.Errorf("error validating OCSP response from %s: certificate status is unknown", u)
+	case res.ThisUpdate.After(now.Add(5 * time.Minute)):
+		return nil, nil, errors.Errorf("error validating OCSP response from %s: response is not valid until %s", u, res.ThisUpdate.Format(time.RFC3339))
+	case !res.NextUpdate.IsZero() && res.NextUpdate.Before(now):
+		return nil, nil, errors.Errorf("error validating OCSP response from %s: response expired at %s", u, res.NextUpdate.Format(time.RFC3339))
+	}
+	return res, der, nil
+}
+
+// update fetches a new OCSP response and writes it.
+func (s *stapler) update() (*ocsp.Response, error) {
+	resp, der, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.out, der, 0644); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// current returns the OCSP response in the output file if it is still valid
+// for the certificate.
+func (s *stapler) current() *ocsp.Response {
+	der, err := ioutil.ReadFile(s.out)
+	if err != nil {
+		return nil
+	}
+	resp, err := ocsp.ParseResponseForCert(der, s.leaf, s.issuer)
+	if err != nil || resp.Status != ocsp.Good {
+		return nil
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(time.Now()) {
+		return nil
+	}
+	return resp
+}
+
+// daemon refreshes the OCSP response until the process receives an interrupt
+// or termination signal.
+func (s *stapler) daemon() error {
+	// Loggers
+	Info := log.New(os.Stdout, "INFO: ", log.LstdFlags)
+	Error := log.New(os.Stderr, "ERROR: ", log.LstdFlags)
+
+	// Abort the requests in progress on an interrupt or termination signal
+	cancel := pki.CancelOnSignal()
+	defer cancel()
+
+	// Daemon loop
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	// A valid response in the output file is used until it needs a refresh.
+	var next, backoff time.Duration
+	if resp := s.current(); resp != nil {
+		next = nextStapleRefresh(resp, time.Now())
+		Info.Printf("OCSP response in %s is valid, next refresh in %s", s.out, next.Round(time.Second))
+	}
+
+	refresh := func() {
+		resp, err := s.update()
+		if err != nil {
+			backoff = nextStapleBackoff(backoff)
+			next = backoff
+			Error.Printf("%v, retrying in %s", err, next)
+			return
+		}
+		backoff = 0
+		next = nextStapleRefresh(resp, time.Now())
+		Info.Printf("OCSP response written to %s, next refresh in %s", s.out, next.Round(time.Second))
+		if err := runStapleExec(s.execCmd); err != nil {
+			Error.Println(err)
+		}
+	}
+
+	for {
+		select {
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGHUP:
+				refresh()
+			case syscall.SIGINT, syscall.SIGTERM:
+				return nil
+			}
+		case <-time.After(next):
+			refresh()
+		}
+	}
+}
+
+// nextStapleRefresh returns the time until the given response must be
+// refreshed, the middle of its validity period.
+func nextStapleRefresh(resp *ocsp.Response, now time.Time) time.Duration {
+	if resp.NextUpdate.IsZero() {
+		return stapleDefaultRefresh
+	}
+	thisUpdate := resp.ThisUpdate
+	if thisUpdate.IsZero() || thisUpdate.After(now) {
+		thisUpdate = now
+	}
+	d := thisUpdate.Add(resp.NextUpdate.Sub(thisUpdate) / 2).Sub(now)
+	if d < stapleMinRefresh {
+		d = stapleMinRefresh
+	}
+	return d
+}
+
+// nextStapleBackoff returns the time until the next retry after an error.
+func nextStapleBackoff(backoff time.Duration) time.Duration {
+	switch {
+	case backoff < stapleMinRefresh:
+		return stapleMinRefresh
+	case 2*backoff > stapleMaxBackoff:
+		return stapleMaxBackoff
+	default:
+		return 2 * backoff
+	}
+}
+
+// runStapleExec runs the command of the --exec flag.
+func runStapleExec(execCmd string) error {
+	parts := strings.Fields(execCmd)
+	if len(parts) == 0 {
+		return nil
+	}
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return errors.Wrapf(cmd.Run(), "error running '%s'", execCmd)
+}
+
+// writeFileAtomic writes the data in a temporary file in the same directory,
+// and renames it to the given filename.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return errs.FileError(err, filename)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		return errs.FileError(err, filename)
+	}
+	return nil
+}
@@ -4,8 +4,11 @@ import (
 	realx509 "crypto/x509"
 	"encoding/pem"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/urfave/cli"
@@ -17,12 +20,16 @@ func verifyCommand() cli.Command {
 		Action: cli.ActionFunc(verifyAction),
 		Usage:  `verify a certificate`,
 		UsageText: `**step certificate verify** <crt_file> [**--host**=<host>]
-		[**--roots**=<root-bundle>]`,
+		[**--email**=<email>] [**--purpose**=<purpose>] [**--roots**=<root-bundle>]
+		[**--intermediates**=<file>]`,
 		Description: `**step certificate verify** executes the certificate path
 validation algorithm for x.509 certificates defined in RFC 5280. If the
 certificate is valid this command will return '0'. If validation fails, or if
 an error occurs, this command will produce a non-zero return value.
 
+Besides the path validation, the certificate can be checked against a hostname
+or IP address, an email address, and the purpose it will be used for.
+
 ## POSITIONAL ARGUMENTS
 
 <crt_file>
@@ -30,7 +37,25 @@ an error occurs, this command will produce a non-zero return value.
 
 ## EXIT CODES
 
-This command returns 0 on success and \>0 if any error occurs.
+This command returns 0 on success and \>0 if any error occurs. The failures
+of the verification use their own exit codes, starting at 10 so they are not
+confused with the exit codes shared by all the commands:
+
+**10**
+:  The certificate chain cannot be built or verified with the given roots.
+
+**11**
+:  The certificate or a certificate in its chain has expired or is not yet valid.
+
+**12**
+:  The certificate is not valid for the given host, IP address or email.
+
+**13**
+:  The key usage or extended key usage of the certificate does not allow the
+given purpose.
+
+Other errors, like a file that cannot be read or a malformed certificate, use
+the common exit codes, e.g. 4 for a file error or 3 for a validation error.
 
 ## EXAMPLES
 
@@ -64,11 +89,59 @@ Verify a certificate using a custom directory of root certificates for path vali
 '''
 $ step certificate verify ./certificate.crt --roots "./path/to/root-certificates/"
 '''
+
+Verify a client certificate issued by an intermediate that is not in the
+certificate file:
+
+'''
+$ step certificate verify client.crt --roots root_ca.crt \
+--intermediates intermediate_ca.crt --purpose client-auth
+'''
+
+Verify an email certificate and check the exit code:
+
+'''
+$ step certificate verify jane.crt --roots root_ca.crt \
+--email jane@example.com --purpose email-protection
+$ echo $?
+0
+'''
 `,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "host",
-				Usage: `Check whether the certificate is for the specified host.`,
+				Usage: `Check whether the certificate is for the specified host or IP address.`,
+			},
+			cli.StringFlag{
+				Name:  "email",
+				Usage: `Check whether the certificate is for the specified <email> address.`,
+			},
+			cli.StringFlag{
+				Name:  "purpose",
+				Value: "server-auth",
+				Usage: `Check whether the certificate can be used for the given <purpose>.
+
+: <purpose> is a case-sensitive string and must be one of:
+
+    **server-auth**
+    :  TLS server authentication (default).
+
+    **client-auth**
+    :  TLS client authentication.
+
+    **email-protection**
+    :  Email signing and encryption (S/MIME).
+
+    **code-signing**
+    :  Code signing.
+
+    **any**
+    :  Do not check the purpose of the certificate.`,
+			},
+			cli.StringFlag{
+				Name: "intermediates",
+				Usage: `The path to a PEM <file> with intermediate certificates used to build the
+chain, in addition to the ones after the leaf in <crt_file>.`,
 			},
 			cli.StringFlag{
 				Name: "roots",
@@ -90,6 +163,15 @@ authenticity of the remote server.
 	}
 }
 
+// Exit codes used by step certificate verify. They start at 10 so they do not
+// collide with the codes in the errs package.
+const (
+	verifyExitChain   = 10
+	verifyExitExpired = 11
+	verifyExitName    = 12
+	verifyExitUsage   = 13
+)
+
 func verifyAction(ctx *cli.Context) error {
 	if err := errs.NumberOfArguments(ctx, 1); err != nil {
 		return err
@@ -99,16 +181,22 @@ func verifyAction(ctx *cli.Context) error {
 		err              error
 		crtFile          = ctx.Args().Get(0)
 		host             = ctx.String("host")
+		email            = ctx.String("email")
 		roots            = ctx.String("roots")
 		intermediatePool = realx509.NewCertPool()
 		rootPool         *realx509.CertPool
 		cert             *realx509.Certificate
 	)
 
+	extKeyUsage, keyUsage, err := getVerifyPurpose(ctx, ctx.String("purpose"))
+	if err != nil {
+		return err
+	}
+
 	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
-		peerCertificates, err := getPeerCertificates(addr, roots, false)
+		peerCertificates, err := getPeerCertificates(addr, "", roots, false)
 		if err != nil {
-			return err
+			return errs.NewExitError(err, verifyExitCode(err))
 		}
 		cert = peerCertificates[0]
 		for _, pc := range peerCertificates {
@@ -152,22 +240,107 @@ func verifyAction(ctx *cli.Context) error {
 		}
 	}
 
+	if filename := ctx.String("intermediates"); filename != "" {
+		certs, err := pemutil.ReadCertificateBundle(filename)
+		if err != nil {
+			return err
+		}
+		for _, crt := range certs {
+			intermediatePool.AddCert(crt)
+		}
+	}
+
 	if roots != "" {
 		rootPool, err = x509util.ReadCertPool(roots)
 		if err != nil {
-			errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
+			return errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
 		}
 	}
 
+	// Check the validity of the leaf before the path validation to report
+	// a meaningful error.
+	now := time.Now()
+	switch {
+	case now.Before(cert.NotBefore):
+		return errs.NewExitError(errors.Errorf("certificate is not valid before %s", cert.NotBefore.Format(time.RFC3339)), verifyExitExpired)
+	case now.After(cert.NotAfter):
+		return errs.NewExitError(errors.Errorf("certificate has expired on %s", cert.NotAfter.Format(time.RFC3339)), verifyExitExpired)
+	}
+
 	opts := realx509.VerifyOptions{
 		DNSName:       host,
 		Roots:         rootPool,
 		Intermediates: intermediatePool,
+		KeyUsages:     []realx509.ExtKeyUsage{extKeyUsage},
 	}
 
 	if _, err := cert.Verify(opts); err != nil {
-		return errors.Wrapf(err, "failed to verify certificate")
+		return errs.NewExitError(errors.Wrap(err, "failed to verify certificate"), verifyExitCode(err))
+	}
+
+	if email != "" && !hasEmailAddress(cert, email) {
+		return errs.NewExitError(errors.Errorf("failed to verify certificate: certificate is not valid for %s", email), verifyExitName)
+	}
+
+	if keyUsage != 0 && cert.KeyUsage != 0 && cert.KeyUsage&keyUsage == 0 {
+		return errs.NewExitError(errors.Errorf("failed to verify certificate: key usage does not allow the purpose %s", ctx.String("purpose")), verifyExitUsage)
 	}
 
 	return nil
 }
+
+// getVerifyPurpose returns the extended key usage and the key usages, any of
+// them being enough, required by the given purpose.
+func getVerifyPurpose(ctx *cli.Context, purpose string) (realx509.ExtKeyUsage, realx509.KeyUsage, error) {
+	switch purpose {
+	case "server-auth", "":
+		return realx509.ExtKeyUsageServerAuth, realx509.KeyUsageDigitalSignature | realx509.KeyUsageKeyEncipherment | realx509.KeyUsageKeyAgreement, nil
+	case "client-auth":
+		return realx509.ExtKeyUsageClientAuth, realx509.KeyUsageDigitalSignature | realx509.KeyUsageKeyAgreement, nil
+	case "email-protection":
+		return realx509.ExtKeyUsageEmailProtection, realx509.KeyUsageDigitalSignature | realx509.KeyUsageContentCommitment | realx509.KeyUsageKeyEncipherment | realx509.KeyUsageKeyAgreement, nil
+	case "code-signing":
+		return realx509.ExtKeyUsageCodeSigning, realx509.KeyUsageDigitalSignature, nil
+	case "any":
+		return realx509.ExtKeyUsageAny, 0, nil
+	default:
+		return 0, 0, errs.InvalidFlagValue(ctx, "purpose", purpose, "server-auth, client-auth, email-protection, code-signing, any")
+	}
+}
+
+// verifyExitCode returns the exit code for an error returned by the path
+// validation. Other errors use the code of the errs package.
+func verifyExitCode(err error) int {
+	switch e := errors.Cause(err).(type) {
+	case realx509.HostnameError:
+		return verifyExitName
+	case realx509.CertificateInvalidError:
+		switch e.Reason {
+		case realx509.Expired:
+			return verifyExitExpired
+		case realx509.IncompatibleUsage:
+			return verifyExitUsage
+		default:
+			return verifyExitChain
+		}
+	case realx509.UnknownAuthorityError, realx509.SystemRootsError:
+		return verifyExitChain
+	default:
+		return errs.ExitCode(err)
+	}
+}
+
+// hasEmailAddress returns true if the certificate contains the given email
+// address. The domain part is compared case-insensitively.
+func hasEmailAddress(cert *realx509.Certificate, email string) bool {
+	for _, e := range cert.EmailAddresses {
+		if e == email {
+			return true
+		}
+		i, j := strings.LastIndex(e, "@"), strings.LastIndex(email, "@")
+		if i > 0 && i == j && e[:i] == email[:j] && strings.EqualFold(e[i:], email[j:]) {
+			return true
+		}
+	}
+	return false
+}
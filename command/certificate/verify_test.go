@@ -0,0 +1,32 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/errs"
+)
+
+func TestVerifyExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"hostname", x509.HostnameError{}, verifyExitName},
+		{"expired", x509.CertificateInvalidError{Reason: x509.Expired}, verifyExitExpired},
+		{"usage", x509.CertificateInvalidError{Reason: x509.IncompatibleUsage}, verifyExitUsage},
+		{"constraints", x509.CertificateInvalidError{Reason: x509.NotAuthorizedToSign}, verifyExitChain},
+		{"unknown authority", errors.Wrap(x509.UnknownAuthorityError{}, "failed"), verifyExitChain},
+		{"file", &os.PathError{Op: "open", Path: "crt", Err: os.ErrNotExist}, int(errs.CodeFile)},
+		{"unknown", errors.New("failed"), int(errs.CodeUnknown)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, verifyExitCode(tt.err))
+		})
+	}
+}
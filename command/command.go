@@ -1,6 +1,7 @@
 package command
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -55,7 +56,14 @@ func IsForce() bool {
 }
 
 // getConfigVars load the defaults.json file and sets the flags if they are not
-// already set or the EnvVar is set to IgnoreEnvVar.
+// already set or the EnvVar is set to IgnoreEnvVar. Flags passed in the command
+// line or using environment variables always take precedence over the values
+// in the file.
+//
+// The properties in the file can use any of the names of a flag, e.g.
+// "provisioner" for a flag named "issuer,provisioner", and arrays can be used
+// to set flags that accept multiple values. Values that are not valid for a
+// flag are ignored, as the file is shared by all the commands.
 //
 // TODO(mariano): right now it only supports parameters at first level.
 func getConfigVars(ctx *cli.Context) error {
@@ -70,34 +78,93 @@ func getConfigVars(ctx *cli.Context) error {
 	}
 
 	m := make(map[string]interface{})
-	if err := json.Unmarshal(b, &m); err != nil {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
 		return errors.Wrapf(err, "error parsing %s", configFile)
 	}
 
-	flags := make(map[string]cli.Flag)
 	for _, f := range ctx.Command.Flags {
-		name := strings.Split(f.GetName(), ",")[0]
-		flags[name] = f
-	}
-
-	for _, name := range ctx.FlagNames() {
-		if ctx.IsSet(name) {
+		names := getFlagNames(f)
+		if len(names) == 0 || isFlagSet(ctx, names) {
 			continue
 		}
 
 		// Skip if EnvVar == IgnoreEnvVar
-		if f, ok := flags[name]; ok {
-			if getFlagEnvVar(f) == IgnoreEnvVar {
+		if getFlagEnvVar(f) == IgnoreEnvVar {
+			continue
+		}
+
+		for _, name := range names {
+			v, ok := m[name]
+			if !ok {
 				continue
 			}
+			if values, ok := v.([]interface{}); ok {
+				for _, vv := range values {
+					ctx.Set(names[0], configValue(vv))
+				}
+			} else {
+				ctx.Set(names[0], configValue(v))
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
+// configValue returns the string representation of a value in the
+// configuration file. Numbers are decoded as json.Number, so they keep the
+// format used in the file, e.g. 1000000 instead of 1e+06.
+func configValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// getFlagNames returns all the names of a flag, the first one is the main
+// name.
+func getFlagNames(f cli.Flag) []string {
+	var names []string
+	for _, name := range strings.Split(f.GetName(), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
 		}
+	}
+	return names
+}
 
-		if v, ok := m[name]; ok {
-			ctx.Set(name, fmt.Sprintf("%v", v))
+// isFlagSet returns true if any of the names of a flag has been set.
+func isFlagSet(ctx *cli.Context, names []string) bool {
+	for _, name := range names {
+		if ctx.IsSet(name) {
+			return true
 		}
 	}
+	return false
+}
 
-	return nil
+// globalEnvVars are the environment variables of the global flags. They are
+// not used for the flags of the commands with the same name, e.g. STEP_TIMEOUT
+// only sets the global --timeout and not the --timeout of a command.
+var globalEnvVars = map[string]bool{
+	"STEP_FORMAT":                   true,
+	"STEP_NO_PROMPT":                true,
+	"STEP_VERBOSE":                  true,
+	"STEP_DEBUG":                    true,
+	"STEP_RESOLVE":                  true,
+	"STEP_TIMEOUT":                  true,
+	"STEP_SKEW":                     true,
+	"STEP_MIN_PASSWORD_ENTROPY":     true,
+	"STEP_CLIENT_CRT":               true,
+	"STEP_CLIENT_KEY":               true,
+	"STEP_CLIENT_KEY_PASSWORD_FILE": true,
 }
 
 // getEnvVar generates the environment variable for the given flag name.
@@ -110,33 +177,44 @@ func getEnvVar(name string) string {
 
 // getFlagEnvVar returns the value of the EnvVar field of a flag.
 func getFlagEnvVar(f cli.Flag) string {
+	if envVar := getFlagField(f, "EnvVar"); envVar.IsValid() {
+		return envVar.String()
+	}
+	return ""
+}
+
+// getFlagField returns the field of a flag with the given name, or the zero
+// value if the flag does not have it.
+func getFlagField(f cli.Flag, name string) reflect.Value {
 	v := reflect.ValueOf(f)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
 	if v.Kind() == reflect.Struct {
-		envVar := v.FieldByName("EnvVar")
-		if envVar.IsValid() {
-			return envVar.String()
-		}
+		return v.FieldByName(name)
 	}
-	return ""
+	return reflect.Value{}
 }
 
-// setEnvVar sets the the EnvVar element to each flag recursively.
+// setEnvVar sets the the EnvVar element to each flag recursively, and the
+// functions used to load the defaults and complete the command.
 func setEnvVar(c *cli.Command) {
 	if c == nil {
 		return
 	}
 
-	// Enable getting the flags from a json file
+	// Enable getting the flags from a json file, commands not marked with
+	// StructuredOutput only support the text format
 	if c.Before == nil && c.Action != nil {
-		c.Before = getConfigVars
+		c.Before = textOutput
 	}
 
 	// Enable getting the flags from environment variables
 	for i := range c.Flags {
 		envVar := getEnvVar(c.Flags[i].GetName())
+		if globalEnvVars[envVar] {
+			continue
+		}
 		switch f := c.Flags[i].(type) {
 		case cli.BoolFlag:
 			if f.EnvVar == "" {
@@ -209,4 +287,9 @@ func setEnvVar(c *cli.Command) {
 	for i := range c.Subcommands {
 		setEnvVar(&c.Subcommands[i])
 	}
+
+	// Enable the completion of flags, subcommands and values
+	if c.BashComplete == nil {
+		c.BashComplete = completeCommand(c.Flags, c.Subcommands)
+	}
 }
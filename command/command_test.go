@@ -0,0 +1,80 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/urfave/cli"
+)
+
+func TestGetConfigVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-config")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "defaults.json")
+	assert.FatalError(t, ioutil.WriteFile(configFile, []byte(`{
+	"ca-url": "https://ca.example.com",
+	"provisioner": "admin@example.com",
+	"not-after": 1000000,
+	"size": 2048,
+	"ratio": 0.5,
+	"force": "maybe",
+	"san": ["foo.example.com", 1000000]
+}`), 0600))
+
+	var got *cli.Context
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{cli.StringFlag{Name: "config"}}
+	app.Commands = []cli.Command{{
+		Name:   "test",
+		Before: getConfigVars,
+		Action: func(ctx *cli.Context) error {
+			got = ctx
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "ca-url"},
+			cli.StringFlag{Name: "issuer,provisioner"},
+			cli.StringFlag{Name: "not-after"},
+			cli.IntFlag{Name: "size"},
+			cli.Float64Flag{Name: "ratio"},
+			cli.BoolFlag{Name: "force"},
+			cli.StringSliceFlag{Name: "san"},
+		},
+	}}
+	assert.FatalError(t, app.Run([]string{"step", "--config", configFile, "test", "--ca-url", "https://other.example.com"}))
+
+	assert.Equals(t, "https://other.example.com", got.String("ca-url"))
+	assert.Equals(t, "admin@example.com", got.String("issuer"))
+	assert.Equals(t, "1000000", got.String("not-after"))
+	assert.Equals(t, 2048, got.Int("size"))
+	assert.Equals(t, 0.5, got.Float64("ratio"))
+	assert.False(t, got.Bool("force"))
+	assert.Equals(t, []string{"foo.example.com", "1000000"}, got.StringSlice("san"))
+}
+
+func TestSetEnvVar(t *testing.T) {
+	c := cli.Command{
+		Name:   "test",
+		Action: func(ctx *cli.Context) error { return nil },
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "ca-url"},
+			cli.StringFlag{Name: "root", EnvVar: "STEP_CA_ROOT"},
+			cli.StringFlag{Name: "format"},
+			cli.BoolFlag{Name: "verbose"},
+			cli.DurationFlag{Name: "timeout"},
+			cli.IntFlag{Name: "skew"},
+		},
+	}
+	setEnvVar(&c)
+
+	assert.Equals(t, "STEP_CA_URL", getFlagEnvVar(c.Flags[0]))
+	assert.Equals(t, "STEP_CA_ROOT", getFlagEnvVar(c.Flags[1]))
+	for _, f := range c.Flags[2:] {
+		assert.Equals(t, "", getFlagEnvVar(f))
+	}
+}
@@ -0,0 +1,195 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/smallstep/cli/config"
+	"github.com/urfave/cli"
+)
+
+// Directives printed by the completion functions to let the shell complete
+// file names or directories.
+const (
+	CompleteFiles = ":files"
+	CompleteDirs  = ":dirs"
+)
+
+var placeholderRegexp = regexp.MustCompile(`<.*?>`)
+
+// completeCommand returns the function used to complete the arguments of a
+// command with the given flags and subcommands. The shell scripts generated by
+// **step completion** pass the word being completed as the last argument
+// before --generate-bash-completion, even if it's empty.
+func completeCommand(flags []cli.Flag, subcommands []cli.Command) cli.BashCompleteFunc {
+	return func(ctx *cli.Context) {
+		complete(ctx, ctx.App.Writer, os.Args, flags, subcommands)
+	}
+}
+
+func complete(ctx *cli.Context, w io.Writer, args []string, flags []cli.Flag, subcommands []cli.Command) {
+	// Remove --generate-bash-completion
+	if len(args) < 2 {
+		return
+	}
+	args = args[:len(args)-1]
+	cur := args[len(args)-1]
+	var prev string
+	if len(args) > 2 {
+		prev = args[len(args)-2]
+	}
+
+	// Complete the flag names.
+	if strings.HasPrefix(cur, "-") {
+		for _, f := range flags {
+			if isHiddenFlag(f) {
+				continue
+			}
+			for _, name := range getFlagNames(f) {
+				if len(name) == 1 {
+					name = "-" + name
+				} else {
+					name = "--" + name
+				}
+				if strings.HasPrefix(name, cur) {
+					fmt.Fprintln(w, name)
+				}
+			}
+		}
+		return
+	}
+
+	// Complete the value of a flag.
+	if strings.HasPrefix(prev, "-") && !strings.Contains(prev, "=") {
+		if f := findFlag(flags, strings.TrimLeft(prev, "-")); f != nil && !isBoolFlag(f) {
+			names := getFlagNames(f)
+			switch {
+			case contains(names, "issuer"), contains(names, "provisioner"):
+				for _, name := range provisionerNames(ctx) {
+					fmt.Fprintln(w, name)
+				}
+			default:
+				if directive := placeholderDirective(f); directive != "" {
+					fmt.Fprintln(w, directive)
+				}
+			}
+			return
+		}
+	}
+
+	// Complete the subcommands, or the positional arguments as files.
+	if len(subcommands) > 0 {
+		for _, c := range subcommands {
+			if !c.Hidden {
+				fmt.Fprintln(w, c.Name)
+			}
+		}
+		return
+	}
+	fmt.Fprintln(w, CompleteFiles)
+}
+
+// findFlag returns the flag with the given name.
+func findFlag(flags []cli.Flag, name string) cli.Flag {
+	for _, f := range flags {
+		if contains(getFlagNames(f), name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func isBoolFlag(f cli.Flag) bool {
+	switch f := f.(type) {
+	case cli.BoolFlag, cli.BoolTFlag:
+		return true
+	case cli.GenericFlag:
+		// Generic flags like --password-gen can be used without a value.
+		v, ok := f.Value.(interface{ IsBoolFlag() bool })
+		return ok && v.IsBoolFlag()
+	default:
+		return false
+	}
+}
+
+func isHiddenFlag(f cli.Flag) bool {
+	v := getFlagField(f, "Hidden")
+	return v.IsValid() && v.Kind() == reflect.Bool && v.Bool()
+}
+
+// placeholderDirective returns the completion directive for a flag using the
+// placeholder in its usage, e.g. <file> or <directory>.
+func placeholderDirective(f cli.Flag) string {
+	usage := getFlagField(f, "Usage")
+	if !usage.IsValid() || usage.Kind() != reflect.String {
+		return ""
+	}
+	placeholder := strings.ToLower(placeholderRegexp.FindString(usage.String()))
+	switch {
+	case strings.Contains(placeholder, "file"):
+		return CompleteFiles
+	case strings.Contains(placeholder, "dir"):
+		return CompleteDirs
+	default:
+		return ""
+	}
+}
+
+// provisionerNames returns the names of the provisioners known in the current
+// context: the provisioner in the defaults file, and the provisioners in the
+// configuration of the CA, if any.
+func provisionerNames(ctx *cli.Context) []string {
+	var names []string
+	add := func(name string) {
+		if name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	defaultsFile := ctx.GlobalString("config")
+	if defaultsFile == "" {
+		defaultsFile = filepath.Join(config.StepPath(), "config", "defaults.json")
+	}
+	if b, err := ioutil.ReadFile(defaultsFile); err == nil {
+		var defaults map[string]interface{}
+		if json.Unmarshal(b, &defaults) == nil {
+			for _, key := range []string{"provisioner", "issuer"} {
+				if s, ok := defaults[key].(string); ok {
+					add(s)
+				}
+			}
+		}
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(config.StepPath(), "config", "ca.json")); err == nil {
+		var ca struct {
+			Authority struct {
+				Provisioners []struct {
+					Name string `json:"name"`
+				} `json:"provisioners"`
+			} `json:"authority"`
+		}
+		if json.Unmarshal(b, &ca) == nil {
+			for _, p := range ca.Authority.Provisioners {
+				add(p.Name)
+			}
+		}
+	}
+	return names
+}
+
+func contains(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
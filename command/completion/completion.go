@@ -0,0 +1,213 @@
+package completion
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	cmd := cli.Command{
+		Name:   "completion",
+		Action: command.ActionFunc(completionAction),
+		BashComplete: func(ctx *cli.Context) {
+			for _, shell := range shells {
+				fmt.Fprintln(ctx.App.Writer, shell)
+			}
+		},
+		Usage:     "print the shell completion script",
+		UsageText: "**step completion** <shell>",
+		Description: `**step completion** command prints the script used to complete the commands,
+flags and arguments of **step** in the given shell.
+
+The completion scripts call **step** to get the completions, so they complete
+the subcommands and flags of the installed version, the names of the
+provisioners in the current context, using the defaults file and the CA
+configuration, and files and directories in flags that expect them.
+
+## POSITIONAL ARGUMENTS
+
+<shell>
+:  The shell to generate the script for. The options are:
+
+    **bash**
+    :  Bourne-again shell.
+
+    **zsh**
+    :  Z shell.
+
+    **fish**
+    :  Friendly interactive shell.
+
+    **powershell**
+    :  Windows PowerShell or PowerShell Core.
+
+## EXAMPLES
+
+Load the completions in the current bash session:
+'''
+$ source <(step completion bash)
+'''
+
+Load the completions for every bash session, in Linux:
+'''
+$ step completion bash > /etc/bash_completion.d/step
+'''
+
+Load the completions for every zsh session, using a directory in the $fpath:
+'''
+$ step completion zsh > "${fpath[1]}/_step"
+'''
+
+Load the completions for every fish session:
+'''
+$ step completion fish > ~/.config/fish/completions/step.fish
+'''
+
+Load the completions in the current PowerShell session:
+'''
+PS> step completion powershell | Out-String | Invoke-Expression
+'''`,
+	}
+
+	command.Register(cmd)
+}
+
+var shells = []string{"bash", "zsh", "fish", "powershell"}
+
+var scripts = map[string]string{
+	"bash":       bashScript,
+	"zsh":        zshScript,
+	"fish":       fishScript,
+	"powershell": powershellScript,
+}
+
+var invalidFuncChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func completionAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	shell := ctx.Args().Get(0)
+	script, ok := scripts[shell]
+	if !ok {
+		return errors.Errorf("unsupported shell '%s'; options are bash, zsh, fish or powershell", shell)
+	}
+
+	name := filepath.Base(os.Args[0])
+	tmpl, err := template.New(shell).Parse(script)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing %s script", shell)
+	}
+	return tmpl.Execute(os.Stdout, map[string]string{
+		"Name": name,
+		"Func": "_" + invalidFuncChars.ReplaceAllString(name, "_"),
+	})
+}
+
+// The scripts call the program with the words before the cursor, the word
+// being completed, even if it's empty, and --generate-bash-completion. The
+// program prints the candidates one per line, or the directives :files and
+// :dirs to complete file names or directories.
+
+const bashScript = `# bash completion for {{.Name}}
+
+{{.Func}}_completion() {
+	local cur opts
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	opts=$("${COMP_WORDS[@]:0:$COMP_CWORD}" "$cur" --generate-bash-completion 2>/dev/null)
+	case "$opts" in
+	:files)
+		compopt -o filenames 2>/dev/null
+		COMPREPLY=($(compgen -f -- "$cur"))
+		;;
+	:dirs)
+		compopt -o filenames 2>/dev/null
+		COMPREPLY=($(compgen -d -- "$cur"))
+		;;
+	*)
+		local IFS=$'\n'
+		COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+		;;
+	esac
+	return 0
+}
+
+complete -F {{.Func}}_completion {{.Name}}
+`
+
+const zshScript = `#compdef {{.Name}}
+
+{{.Func}}() {
+	local -a opts
+	local cur="${words[CURRENT]}"
+	opts=(${(f)"$(${words[1,CURRENT-1]} "$cur" --generate-bash-completion 2>/dev/null)"})
+	case "${opts[1]}" in
+	:files) _files ;;
+	:dirs) _files -/ ;;
+	*) compadd -a opts ;;
+	esac
+}
+
+if [ "$funcstack[1]" = "{{.Func}}" ]; then
+	{{.Func}} "$@"
+else
+	compdef {{.Func}} {{.Name}}
+fi
+`
+
+const fishScript = `# fish completion for {{.Name}}
+
+function _{{.Func}}_complete
+	set -l cur (commandline -ct)
+	set -l opts (command (commandline -opc) "$cur" --generate-bash-completion 2>/dev/null)
+	switch "$opts[1]"
+		case :files
+			__fish_complete_path "$cur"
+		case :dirs
+			__fish_complete_directories "$cur"
+		case '*'
+			printf '%s\n' $opts
+	end
+end
+
+complete -c {{.Name}} -f -a '(_{{.Func}}_complete)'
+`
+
+const powershellScript = `# powershell completion for {{.Name}}
+
+Register-ArgumentCompleter -Native -CommandName '{{.Name}}' -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+
+	$words = @($commandAst.CommandElements |
+		Where-Object { $_.Extent.EndOffset -le $cursorPosition } |
+		ForEach-Object { $_.ToString() })
+	if ($wordToComplete -ne '') {
+		$words = @($words | Select-Object -SkipLast 1)
+	}
+	$arguments = @($words | Select-Object -Skip 1)
+
+	# Empty arguments are not passed to native commands before 7.3.
+	$cur = $wordToComplete
+	if ($cur -eq '' -and $PSVersionTable.PSVersion -lt [version]'7.3') {
+		$cur = '""'
+	}
+
+	$opts = @(& $words[0] @arguments $cur --generate-bash-completion 2>$null)
+	if ($opts.Count -gt 0 -and $opts[0] -in ':files', ':dirs') {
+		# Returning nothing completes the paths.
+		return
+	}
+	$opts | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`
@@ -0,0 +1,271 @@
+package context
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	cmd := cli.Command{
+		Name:      "context",
+		Usage:     "manage certificate authority contexts",
+		UsageText: "step context <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step context** command group provides facilities to manage multiple
+certificate authority contexts on the same machine.
+
+A context is a directory under <$STEPPATH/authorities/> with its own
+configuration, certificates and secrets. When a context is in use, all the
+commands resolve the default flags, like the ca-url, root or fingerprint, from
+<$STEPPATH/authorities/\<name\>/config/defaults.json>, and the default root from
+<$STEPPATH/authorities/\<name\>/certs/root_ca.crt>.
+
+The current context is stored in <$STEPPATH/current-context>, and it can be
+overwritten using the STEPCONTEXT environment variable.
+
+## EXAMPLES
+
+Create contexts for the production and staging CAs:
+'''
+$ step context create prod --ca-url https://ca.example.com --root prod_root_ca.crt
+$ step context create staging --ca-url https://ca.staging.example.com --root staging_root_ca.crt
+'''
+
+Select the production context:
+'''
+$ step context use prod
+'''
+
+List the available contexts:
+'''
+$ step context list
+* prod
+  staging
+'''
+
+Get a token using the staging CA without changing the current context:
+'''
+$ STEPCONTEXT=staging step ca token internal.example.com
+'''
+
+Create an empty context and bootstrap it:
+'''
+$ step context create lab --use
+$ step ca bootstrap --ca-url https://ca.lab.example.com \
+  --fingerprint 0d7d3834cf187726cf331c40a31aa7ef6b29ba4df601416c9788f6ee01058cf3
+'''`,
+		Subcommands: cli.Commands{
+			createCommand(),
+			useCommand(),
+			listCommand(),
+		},
+	}
+
+	command.Register(cmd)
+}
+
+func createCommand() cli.Command {
+	return cli.Command{
+		Name:   "create",
+		Action: cli.ActionFunc(createAction),
+		Usage:  "create a new context",
+		UsageText: `**step context create** <name>
+		[**--ca-url**=<uri>] [**--root**=<file>] [**--fingerprint**=<fingerprint>] [**--use**]`,
+		Description: `**step context create** creates a new context with the given name. If the
+**--ca-url** or **--root** flags are given, the context will be initialized with
+a <defaults.json> file and a copy of the root certificate.
+
+## POSITIONAL ARGUMENTS
+
+<name>
+:  The name of the new context.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "ca-url",
+				Usage:  "<URI> of the targeted Step Certificate Authority.",
+				EnvVar: command.IgnoreEnvVar,
+			},
+			cli.StringFlag{
+				Name:   "root",
+				Usage:  "The path to the PEM <file> used as the root certificate authority.",
+				EnvVar: command.IgnoreEnvVar,
+			},
+			cli.StringFlag{
+				Name: "fingerprint",
+				Usage: `The <fingerprint> of the targeted root certificate. If **--root** is used, the
+fingerprint will be calculated from the root certificate.`,
+				EnvVar: command.IgnoreEnvVar,
+			},
+			cli.BoolFlag{
+				Name:  "use",
+				Usage: "Set the new context as the current context.",
+			},
+		},
+	}
+}
+
+func useCommand() cli.Command {
+	return cli.Command{
+		Name:      "use",
+		Action:    cli.ActionFunc(useAction),
+		Usage:     "select the current context",
+		UsageText: `**step context use** <name> [**--none**]`,
+		Description: `**step context use** sets the current context. Use **--none** to stop using
+contexts and go back to use the configuration in <$STEPPATH>.
+
+## POSITIONAL ARGUMENTS
+
+<name>
+:  The name of the context to use.`,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "none",
+				Usage: "Do not use any context.",
+			},
+		},
+	}
+}
+
+func listCommand() cli.Command {
+	return cli.Command{
+		Name:      "list",
+		Action:    cli.ActionFunc(listAction),
+		Usage:     "list the available contexts",
+		UsageText: `**step context list**`,
+		Description: `**step context list** prints the list of available contexts, the current
+context is marked with an asterisk.`,
+	}
+}
+
+type contextDefaults struct {
+	CA          string `json:"ca-url,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Root        string `json:"root,omitempty"`
+}
+
+func createAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	name := ctx.Args().Get(0)
+	if err := config.ValidateContextName(name); err != nil {
+		return err
+	}
+	if config.ContextExists(name) {
+		return errors.Errorf("context '%s' already exists", name)
+	}
+
+	defaults := contextDefaults{
+		CA:          ctx.String("ca-url"),
+		Fingerprint: ctx.String("fingerprint"),
+	}
+
+	var root []byte
+	if rootFile := ctx.String("root"); rootFile != "" {
+		crt, err := pemutil.ReadCertificate(rootFile)
+		if err != nil {
+			return err
+		}
+		fp := x509util.Fingerprint(crt)
+		if defaults.Fingerprint != "" && defaults.Fingerprint != fp {
+			return errors.Errorf("flag '--fingerprint' does not match the fingerprint of %s", rootFile)
+		}
+		block, err := pemutil.Serialize(crt)
+		if err != nil {
+			return err
+		}
+		root = pem.EncodeToMemory(block)
+		defaults.Fingerprint = fp
+	}
+
+	dir := config.ContextPath(name)
+	for _, d := range []string{"config", "certs", "secrets"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			return errs.FileError(err, filepath.Join(dir, d))
+		}
+	}
+
+	if root != nil {
+		defaults.Root = filepath.Join(dir, "certs", "root_ca.crt")
+		if err := utils.WriteFile(defaults.Root, root, 0600); err != nil {
+			return err
+		}
+	}
+
+	if defaults != (contextDefaults{}) {
+		b, err := json.MarshalIndent(defaults, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "error marshaling defaults.json")
+		}
+		configFile := filepath.Join(dir, "config", "defaults.json")
+		if err := utils.WriteFile(configFile, b, 0644); err != nil {
+			return err
+		}
+	}
+
+	ui.Printf("The context '%s' has been created in %s.\n", name, dir)
+
+	if ctx.Bool("use") {
+		if err := config.SetCurrentContext(name); err != nil {
+			return err
+		}
+		ui.Printf("The current context is now '%s'.\n", name)
+	}
+	return nil
+}
+
+func useAction(ctx *cli.Context) error {
+	if ctx.Bool("none") {
+		if err := errs.NumberOfArguments(ctx, 0); err != nil {
+			return err
+		}
+		if err := config.SetCurrentContext(""); err != nil {
+			return err
+		}
+		ui.Printf("No context is being used, the configuration in %s will be used.\n", config.BasePath())
+		return nil
+	}
+
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+	name := ctx.Args().Get(0)
+	if err := config.SetCurrentContext(name); err != nil {
+		return err
+	}
+	ui.Printf("The current context is now '%s'.\n", name)
+	return nil
+}
+
+func listAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+
+	names, err := config.Contexts()
+	if err != nil {
+		return err
+	}
+	current := config.Context()
+	for _, name := range names {
+		if name == current {
+			fmt.Println("* " + name)
+		} else {
+			fmt.Println("  " + name)
+		}
+	}
+	return nil
+}
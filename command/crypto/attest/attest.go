@@ -0,0 +1,44 @@
+package attest
+
+import (
+	"github.com/smallstep/cli/command"
+	"github.com/urfave/cli"
+)
+
+// Command returns the cli.Command for attest and related subcommands.
+func Command() cli.Command {
+	return cli.Command{
+		Name:      "attest",
+		Usage:     "verify the attestation of hardware keys",
+		UsageText: "step crypto attest <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step crypto attest** command group provides facilities to verify the
+attestation of keys stored in hardware, like the keys generated in a YubiKey
+PIV slot or the keys created in a TPM 2.0.
+
+An attestation proves that a key was generated in a device and that it cannot
+be exported, it's signed by a key of the device that is certified by the
+vendor. Attestations must be verified before trusting a certificate signing
+request for a hardware-bound key.
+
+## EXAMPLES
+
+Verify the attestation of a key in the slot 9a of a YubiKey:
+'''
+$ yubico-piv-tool --action attest --slot 9a > attestation.crt
+
+$ yubico-piv-tool --action read-certificate --slot f9 > intermediate.crt
+
+$ step crypto attest verify --intermediate intermediate.crt attestation.crt
+'''
+
+Verify the attestation of a TPM key using the roots of the TPM manufacturer and
+the roots of the AK certificate:
+'''
+$ step crypto attest verify --roots manufacturer-roots.crt --ak-roots ak-ca.crt \
+  attestation.json
+'''`,
+		Subcommands: cli.Commands{
+			command.StructuredOutput(verifyCommand()),
+		},
+	}
+}
@@ -0,0 +1,330 @@
+package attest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/attestation"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/tpm"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+func verifyCommand() cli.Command {
+	return cli.Command{
+		Name:   "verify",
+		Action: cli.ActionFunc(verifyAction),
+		Usage:  "verify the attestation of a hardware key",
+		UsageText: `**step crypto attest verify** <file>
+[**--intermediate**=<file>] [**--roots**=<file>] [**--ak-roots**=<file>]
+[**--nonce**=<string>] [**--format**=<format>]`,
+		Description: `**step crypto attest verify** verifies the attestation of a key stored in
+hardware against the roots of the vendor, and prints the attested properties
+of the key and the public key in PEM format.
+
+The type of attestation is detected from the <file>:
+
+**YubiKey PIV**
+:  The <file> is the attestation certificate of a key generated in a PIV slot,
+followed by the YubiKey attestation certificate stored in the slot f9. The
+latter can also be passed using **--intermediate**. The chain is verified
+using the Yubico roots, unless other roots are given with **--roots**. The
+serial number, firmware version, form factor, slot, and PIN and touch policies
+of the key are printed.
+
+**TPM 2.0**
+:  The <file> is an attestation in JSON format, created with **step crypto tpm
+attest**, or a certificate signing request (CSR) with the attestation
+extension. In the latter, the public key of the CSR must be the attested key.
+The EK certificate is verified using the roots of the TPM manufacturer in
+**--roots**, and the AK certificate using the roots in **--ak-roots**. The AK
+certificate links the attestation key to the TPM, so both flags are required,
+and it must identify the EK with the extension 1.3.6.1.4.1.37476.9000.64.3,
+an OCTET STRING with the SHA-256 hash of the EK public key. The manufacturer,
+model and version of the TPM are printed. TPM attestations
+require step to be compiled with the tpm build tag.
+
+## POSITIONAL ARGUMENTS
+
+<file>
+:  The path to the attestation certificates, the TPM attestation or the CSR
+to verify.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Verify the attestation of a key in a YubiKey:
+'''
+$ step crypto attest verify --intermediate intermediate.crt attestation.crt
+'''
+
+Verify the attestation of a key in a YubiKey and print the properties in JSON:
+'''
+$ cat attestation.crt intermediate.crt > chain.crt
+
+$ step crypto attest verify --format json chain.crt
+'''
+
+Verify the attestation of a TPM key with a nonce:
+'''
+$ step crypto attest verify --roots manufacturer-roots.crt --ak-roots ak-ca.crt \
+  --nonce 8f2ac4e1 attestation.json
+'''
+
+Verify the attestation of a TPM key in a CSR:
+'''
+$ step crypto attest verify --roots manufacturer-roots.crt --ak-roots ak-ca.crt device.csr
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "intermediate",
+				Usage: `The <file> with the YubiKey attestation certificate, stored in the slot f9,
+that issued the attestation certificate.`,
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `The <file> with the root certificates of the vendor. It's required for TPM
+attestations, and by default the Yubico roots are used for YubiKey
+attestations.`,
+			},
+			cli.StringFlag{
+				Name: "ak-roots",
+				Usage: `The <file> with the root certificates used to verify the TPM AK certificate.
+It's required for TPM attestations.`,
+			},
+			cli.StringFlag{
+				Name:  "nonce",
+				Usage: `The <nonce> that must be in the TPM attestation.`,
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "text",
+				Usage: `The output format for printing the attested properties.
+
+: <format> is a string and must be one of:
+
+    **text**
+    :  Print output in unstructured text suitable for a human to read.
+
+    **json**
+    :  Print output in JSON format.`,
+			},
+		},
+	}
+}
+
+// property is an attested property of a key.
+type property struct {
+	name  string
+	key   string
+	value string
+}
+
+func verifyAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	format := ctx.String("format")
+	if format != "text" && format != "json" {
+		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	}
+
+	filename := ctx.Args().Get(0)
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errs.FileError(err, filename)
+	}
+
+	var roots *x509.CertPool
+	if rootsFile := ctx.String("roots"); rootsFile != "" {
+		if roots, err = readRoots(rootsFile); err != nil {
+			return err
+		}
+	}
+
+	var props []property
+	var pub crypto.PublicKey
+	if block, _ := pem.Decode(b); block != nil && block.Type == "CERTIFICATE" {
+		for _, flag := range []string{"ak-roots", "nonce"} {
+			if ctx.IsSet(flag) {
+				return errs.IncompatibleFlag(ctx, flag, "YubiKey attestations")
+			}
+		}
+		if props, pub, err = verifyYubiKey(ctx, filename, roots); err != nil {
+			return err
+		}
+	} else {
+		if ctx.IsSet("intermediate") {
+			return errs.IncompatibleFlag(ctx, "intermediate", "TPM attestations")
+		}
+		if roots == nil {
+			return errs.RequiredFlag(ctx, "roots")
+		}
+		if ctx.String("ak-roots") == "" {
+			return errs.RequiredFlag(ctx, "ak-roots")
+		}
+		if props, pub, err = verifyTPM(ctx, filename, b, roots); err != nil {
+			return err
+		}
+	}
+
+	block, err := pemutil.Serialize(pub)
+	if err != nil {
+		return err
+	}
+	props = append(props, property{"Public key", "publicKeyType", publicKeyType(pub)})
+
+	switch format {
+	case "json":
+		m := map[string]string{
+			"publicKey": string(pem.EncodeToMemory(block)),
+		}
+		for _, p := range props {
+			if p.value != "" {
+				m[p.key] = p.value
+			}
+		}
+		b, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "error marshaling properties")
+		}
+		fmt.Println(string(b))
+	default:
+		for _, p := range props {
+			if p.value != "" {
+				fmt.Printf("%s: %s\n", p.name, p.value)
+			}
+		}
+		return pem.Encode(os.Stdout, block)
+	}
+	return nil
+}
+
+func verifyYubiKey(ctx *cli.Context, filename string, roots *x509.CertPool) ([]property, crypto.PublicKey, error) {
+	chain, err := pemutil.ReadCertificateBundle(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if intermediate := ctx.String("intermediate"); intermediate != "" {
+		crt, err := pemutil.ReadCertificate(intermediate)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, crt)
+	}
+
+	yk, err := attestation.VerifyYubiKey(chain, roots)
+	if err != nil {
+		return nil, nil, err
+	}
+	var serial string
+	if yk.Serial != 0 {
+		serial = strconv.FormatUint(uint64(yk.Serial), 10)
+	}
+	return []property{
+		{"Attestation", "type", "YubiKey PIV"},
+		{"Serial number", "serial", serial},
+		{"Firmware", "firmware", yk.Firmware},
+		{"Form factor", "formFactor", yk.FormFactor},
+		{"Slot", "slot", yk.Slot},
+		{"PIN policy", "pinPolicy", yk.PINPolicy},
+		{"Touch policy", "touchPolicy", yk.TouchPolicy},
+	}, yk.PublicKey, nil
+}
+
+func verifyTPM(ctx *cli.Context, filename string, b []byte, roots *x509.CertPool) ([]property, crypto.PublicKey, error) {
+	var att *tpm.Attestation
+	var csrKey crypto.PublicKey
+	if block, _ := pem.Decode(b); block != nil && block.Type == "CERTIFICATE REQUEST" {
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "error parsing %s", filename)
+		}
+		if err := csr.CheckSignature(); err != nil {
+			return nil, nil, errors.Wrapf(err, "error verifying %s", filename)
+		}
+		if att, err = tpm.AttestationFromCSR(csr); err != nil {
+			return nil, nil, err
+		}
+		csrKey = csr.PublicKey
+	} else {
+		var err error
+		if att, err = tpm.ParseAttestation(b); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	akRoots, err := readRoots(ctx.String("ak-roots"))
+	if err != nil {
+		return nil, nil, err
+	}
+	var nonce []byte
+	if ctx.IsSet("nonce") {
+		nonce = []byte(ctx.String("nonce"))
+	}
+
+	t, err := attestation.VerifyTPM(att, nonce, roots, akRoots)
+	if err != nil {
+		return nil, nil, err
+	}
+	if csrKey != nil {
+		b1, err1 := x509.MarshalPKIXPublicKey(t.PublicKey)
+		b2, err2 := x509.MarshalPKIXPublicKey(csrKey)
+		if err1 != nil || err2 != nil || !bytes.Equal(b1, b2) {
+			return nil, nil, errors.New("error verifying attestation: the CSR public key is not the attested key")
+		}
+	}
+
+	manufacturer := t.Manufacturer
+	if id := t.ManufacturerID(); id != "" {
+		manufacturer = fmt.Sprintf("%s (%s)", id, t.Manufacturer)
+	}
+	return []property{
+		{"Attestation", "type", "TPM 2.0"},
+		{"Manufacturer", "manufacturer", manufacturer},
+		{"Model", "model", t.Model},
+		{"Version", "version", t.Version},
+		{"EK issuer", "ekIssuer", t.EKCertificate.Issuer.String()},
+		{"AK subject", "akSubject", t.AKCertificate.Subject.String()},
+	}, t.PublicKey, nil
+}
+
+// publicKeyType returns a description of the type of the given key.
+func publicKeyType(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return "EC " + k.Curve.Params().Name
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
+
+// readRoots returns a pool with the certificates in the given file.
+func readRoots(filename string) (*x509.CertPool, error) {
+	certs, err := pemutil.ReadCertificateBundle(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, crt := range certs {
+		pool.AddCert(crt)
+	}
+	return pool, nil
+}
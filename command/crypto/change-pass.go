@@ -2,7 +2,10 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 
@@ -16,18 +19,27 @@ import (
 	"github.com/smallstep/cli/jose"
 	"github.com/smallstep/cli/ui"
 	"github.com/smallstep/cli/utils"
+	"golang.org/x/crypto/ed25519"
 )
 
 func changePassCommand() cli.Command {
 	return cli.Command{
-		Name:      "change-pass",
-		Action:    command.ActionFunc(changePassAction),
-		Usage:     "change password of an encrypted private key (PEM or JWK format)",
-		UsageText: `**step crypto change-pass** <key-file> [**--out**=<file>]`,
+		Name:   "change-pass",
+		Action: command.ActionFunc(changePassAction),
+		Usage:  "change password of an encrypted private key (PEM or JWK format)",
+		UsageText: `**step crypto change-pass** <key-file> [**--out**=<file>]
+[**--password-file**=<file>] [**--new-password-file**=<file>]
+[**--no-password**] [**--password-gen**[=<length>]] [**--insecure**] [**--force**]`,
 		Description: `**step crypto change-pass** extracts the private key from
 a file and encrypts disk using a new password by either overwriting the original
 encrypted key or writing a new file to disk.
 
+The key material and the format of the key are preserved: PKCS#1, SEC 1 and
+PKCS#8 PEM files, OpenSSH private keys and JWKs are written back using the same
+encoding. Use **--no-password** and **--insecure** to remove the encryption of
+the key. Use **--password-gen** to encrypt the key with a new random passphrase,
+written to the **--new-password-file** if it is set.
+
 ## POSITIONAL ARGUMENTS
 
 <key-file>
@@ -53,12 +65,34 @@ $ step crypto change-pass key.jwk
 Change password for JWK formatted key:
 '''
 $ step crypto change-pass key.jwk --out new-key.jwk
+'''
+
+Change password using the current and new passwords stored in files:
+'''
+$ step crypto change-pass key.pem \
+  --password-file old-pass.txt --new-password-file new-pass.txt
+'''
+
+Remove the password from an encrypted key:
+'''
+$ step crypto change-pass key.pem --out plain-key.pem --no-password --insecure
 '''`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "out,output-file",
 				Usage: "The <file> new encrypted key path. Default to overwriting the <key> positional argument",
 			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the private key.`,
+			},
+			cli.StringFlag{
+				Name:  "new-password-file",
+				Usage: `The path to the <file> containing the password to encrypt the private key.`,
+			},
+			flags.NoPassword,
+			flags.PasswordGen,
+			flags.Insecure,
 			flags.Force,
 		},
 	}
@@ -66,8 +100,8 @@ $ step crypto change-pass key.jwk --out new-key.jwk
 
 // changePassAction does the following:
 //   1. decrypts a private key (if necessary)
-//   2. encrypts the key using a new password
-//   3. writes the encrypted key to the original file
+//   2. encrypts the key using a new password, or leaves it unencrypted
+//   3. writes the key to the original file or to the one in --out
 func changePassAction(ctx *cli.Context) error {
 	if err := errs.NumberOfArguments(ctx, 1); err != nil {
 		return err
@@ -79,35 +113,96 @@ func changePassAction(ctx *cli.Context) error {
 		newKeyPath = keyPath
 	}
 
+	passwordFile := ctx.String("password-file")
+	newPasswordFile := ctx.String("new-password-file")
+	noPass := ctx.Bool("no-password")
+	if noPass && len(newPasswordFile) > 0 {
+		return errs.IncompatibleFlagWithFlag(ctx, "no-password", "new-password-file")
+	}
+	if noPass && ctx.IsSet("password-gen") {
+		return errs.IncompatibleFlagWithFlag(ctx, "no-password", "password-gen")
+	}
+	if noPass && !ctx.Bool("insecure") {
+		return errs.RequiredWithFlag(ctx, "insecure", "no-password")
+	}
+
+	// Read or generate the new password if necessary
+	var newPass []byte
+	if !noPass {
+		pass, err := utils.GetNewPasswordFromCLI(ctx, "new-password-file")
+		if err != nil {
+			return err
+		}
+		newPass = []byte(pass)
+	}
+
 	b, err := ioutil.ReadFile(keyPath)
 	if err != nil {
 		return errs.FileError(err, keyPath)
 	}
 
 	if bytes.HasPrefix(b, []byte("-----BEGIN ")) {
-		key, err := pemutil.Parse(b, pemutil.WithFilename(keyPath))
+		opts := []pemutil.Options{pemutil.WithFilename(keyPath)}
+		if len(passwordFile) > 0 {
+			opts = append(opts, pemutil.WithPasswordFile(passwordFile))
+		}
+		key, err := pemutil.Parse(b, opts...)
 		if err != nil {
 			return err
 		}
-		pass, err := ui.PromptPassword(fmt.Sprintf("Please enter the password to encrypt %s", newKeyPath))
-		if err != nil {
-			return errors.Wrap(err, "error reading password")
+		if !isPrivateKey(key) {
+			return errors.Errorf("file %s does not contain a private key", keyPath)
+		}
+
+		// Preserve the encoding of the original key
+		block, _ := pem.Decode(b)
+		opts = []pemutil.Options{
+			pemutil.WithPKCS8(block.Type == "PRIVATE KEY" || block.Type == "ENCRYPTED PRIVATE KEY"),
+			pemutil.WithOpenSSH(block.Type == "OPENSSH PRIVATE KEY"),
+			pemutil.ToFile(newKeyPath, 0600),
 		}
-		if _, err := pemutil.Serialize(key, pemutil.WithPassword(pass), pemutil.ToFile(newKeyPath, 0644)); err != nil {
+		if !noPass {
+			pass, err := ui.PromptPassword(fmt.Sprintf("Please enter the password to encrypt %s", newKeyPath), ui.WithValue(string(newPass)), ui.WithFlag("new-password-file"), ui.WithValidateEntropy())
+			if err != nil {
+				return errors.Wrap(err, "error reading password")
+			}
+			opts = append(opts, pemutil.WithPassword(pass))
+		}
+		if _, err := pemutil.Serialize(key, opts...); err != nil {
 			return err
 		}
 	} else {
-		jwk, err := jose.ParseKey(keyPath)
-		if err != nil {
-			return err
+		var opts []jose.Option
+		if len(passwordFile) > 0 {
+			opts = append(opts, jose.WithPasswordFile(passwordFile))
 		}
-		jwe, err := jose.EncryptJWK(jwk)
+		jwk, err := jose.ParseKey(keyPath, opts...)
 		if err != nil {
 			return err
 		}
+		if jwk.IsPublic() {
+			return errors.Errorf("file %s does not contain a private key", keyPath)
+		}
+
 		var out bytes.Buffer
-		if err := json.Indent(&out, []byte(jwe.FullSerialize()), "", "  "); err != nil {
-			return errors.Wrap(err, "error formatting JSON")
+		if noPass {
+			b, err := json.MarshalIndent(jwk, "", "  ")
+			if err != nil {
+				return errors.Wrap(err, "error marshaling JWK")
+			}
+			out.Write(b)
+		} else {
+			var encOpts []jose.Option
+			if len(newPass) > 0 {
+				encOpts = append(encOpts, jose.WithPassword(newPass))
+			}
+			jwe, err := jose.EncryptJWK(jwk, encOpts...)
+			if err != nil {
+				return err
+			}
+			if err := json.Indent(&out, []byte(jwe.FullSerialize()), "", "  "); err != nil {
+				return errors.Wrap(err, "error formatting JSON")
+			}
 		}
 		if err := utils.WriteFile(newKeyPath, out.Bytes(), 0600); err != nil {
 			return errs.FileError(err, newKeyPath)
@@ -117,3 +212,13 @@ func changePassAction(ctx *cli.Context) error {
 	ui.Printf("Your key has been saved in %s.\n", newKeyPath)
 	return nil
 }
+
+// isPrivateKey returns true if the given key is a supported private key.
+func isPrivateKey(key interface{}) bool {
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,131 @@
+package cms
+
+import (
+	"bytes"
+	"encoding/pem"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+// Command returns the cli.Command for cms and related subcommands.
+func Command() cli.Command {
+	return cli.Command{
+		Name:      "cms",
+		Usage:     "sign, verify, encrypt and decrypt data using the Cryptographic Message Syntax (CMS)",
+		UsageText: "step crypto cms <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step crypto cms** command group provides facilities to sign, verify, encrypt
+and decrypt data using the Cryptographic Message Syntax (CMS) defined in
+RFC 5652, the format used by S/MIME, code signing and many other protocols and
+also known as PKCS #7.
+
+Messages are signed and decrypted using X.509 certificates and private keys,
+like the ones created with **step certificate create** or issued by **step ca
+certificate**, and they are compatible with 'openssl cms'. By default messages
+are written using the PEM encoding, but both PEM and DER encoded messages can be
+read.
+
+## EXAMPLES
+
+Sign a file and include the content in the signed message:
+'''
+$ step crypto cms sign --cert signer.crt --key signer.key file.txt \> file.p7s
+'''
+
+Verify the previous message and extract the content:
+'''
+$ step crypto cms verify --roots root_ca.crt file.p7s
+'''
+
+Create a detached signature of a file and verify it:
+'''
+$ step crypto cms sign --detached --cert signer.crt --key signer.key file.txt \> file.sig
+
+$ step crypto cms verify --roots root_ca.crt --content file.txt file.sig
+'''
+
+Encrypt a file for two recipients:
+'''
+$ step crypto cms encrypt --recipient alice.crt --recipient bob.crt file.txt \> file.p7m
+'''
+
+Decrypt the previous message:
+'''
+$ step crypto cms decrypt --cert bob.crt --key bob.key file.p7m
+'''`,
+		Subcommands: cli.Commands{
+			signCommand(),
+			verifyCommand(),
+			encryptCommand(),
+			decryptCommand(),
+		},
+	}
+}
+
+var formatFlag = cli.StringFlag{
+	Name:  "format",
+	Value: "pem",
+	Usage: `The <format> of the output message.
+
+: <format> is a case-sensitive string and must be one of:
+
+    **pem** (default)
+    :  PEM-encoded CMS message
+
+    **der**
+    :  DER-encoded CMS message`,
+}
+
+var outFlag = cli.StringFlag{
+	Name:  "out",
+	Usage: "The <file> to write the output to. Defaults to STDOUT.",
+}
+
+// readMessage reads a PEM or DER encoded CMS message.
+func readMessage(filename string) ([]byte, error) {
+	b, err := utils.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN ")) {
+		return b, nil
+	}
+	for rest := b; len(rest) > 0; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		switch block.Type {
+		case "CMS", "PKCS7":
+			return block.Bytes, nil
+		}
+	}
+	return nil, errors.Errorf("error decoding %s: CMS PEM block not found", filename)
+}
+
+// writeMessage writes the CMS message with the format in the --format flag.
+func writeMessage(ctx *cli.Context, der []byte) error {
+	switch format := ctx.String("format"); format {
+	case "der":
+	case "pem":
+		der = pem.EncodeToMemory(&pem.Block{
+			Type:  "CMS",
+			Bytes: der,
+		})
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "pem, der")
+	}
+	return writeOutput(ctx, der, 0644)
+}
+
+// writeOutput writes the data to the file in the --out flag or to STDOUT.
+func writeOutput(ctx *cli.Context, b []byte, perm os.FileMode) error {
+	if out := ctx.String("out"); out != "" {
+		return utils.WriteFile(out, b, perm)
+	}
+	_, err := os.Stdout.Write(b)
+	return errors.Wrap(err, "error writing output")
+}
@@ -0,0 +1,103 @@
+package cms
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/cms"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/urfave/cli"
+)
+
+func decryptCommand() cli.Command {
+	return cli.Command{
+		Name:   "decrypt",
+		Action: command.ActionFunc(decryptAction),
+		Usage:  "decrypt a CMS encrypted message",
+		UsageText: `**step crypto cms decrypt** <file> **--cert**=<file> **--key**=<file>
+[**--password-file**=<file>] [**--out**=<file>]`,
+		Description: `**step crypto cms decrypt** decrypts a PEM or DER encoded CMS EnvelopedData
+message using the certificate and private key of one of its recipients, and
+prints the content to STDOUT or writes it to **--out**.
+
+## POSITIONAL ARGUMENTS
+
+<file>
+:  The path to the CMS message. Use '-' to read from STDIN.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Decrypt a message:
+'''
+$ step crypto cms decrypt --cert bob.crt --key bob.key file.p7m
+'''
+
+Decrypt a message using an encrypted key and write the content to a file:
+'''
+$ step crypto cms decrypt --cert bob.crt --key bob.key --password-file pass.txt \
+  --out file.txt file.p7m
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "cert",
+				Usage: "The <file> with the certificate of the recipient.",
+			},
+			cli.StringFlag{
+				Name:  "key",
+				Usage: "The <file> with the private key of the recipient.",
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: "The path to the <file> containing the password to decrypt the private key.",
+			},
+			cli.StringFlag{
+				Name:  "out",
+				Usage: "The <file> to write the decrypted content to. Defaults to STDOUT.",
+			},
+			flags.Force,
+		},
+	}
+}
+
+func decryptAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	filename := ctx.Args().First()
+	crtFile, keyFile := ctx.String("cert"), ctx.String("key")
+	switch {
+	case crtFile == "":
+		return errs.RequiredFlag(ctx, "cert")
+	case keyFile == "":
+		return errs.RequiredFlag(ctx, "key")
+	}
+
+	crt, err := pemutil.ReadCertificate(crtFile)
+	if err != nil {
+		return err
+	}
+	var opts []pemutil.Options
+	if passFile := ctx.String("password-file"); passFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(passFile))
+	}
+	key, err := pemutil.Read(keyFile, opts...)
+	if err != nil {
+		return err
+	}
+
+	der, err := readMessage(filename)
+	if err != nil {
+		return err
+	}
+	content, err := cms.Decrypt(der, crt, key)
+	if err != nil {
+		return errors.Wrapf(err, "error decrypting %s", filename)
+	}
+	return writeOutput(ctx, content, 0600)
+}
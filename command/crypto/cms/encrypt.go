@@ -0,0 +1,93 @@
+package cms
+
+import (
+	"crypto/x509"
+
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/cms"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func encryptCommand() cli.Command {
+	return cli.Command{
+		Name:   "encrypt",
+		Action: command.ActionFunc(encryptAction),
+		Usage:  "encrypt data using CMS",
+		UsageText: `**step crypto cms encrypt** <file> **--recipient**=<file>
+[**--format**=<format>] [**--out**=<file>]`,
+		Description: `**step crypto cms encrypt** encrypts the content of <file> for one or more
+recipients and prints a CMS EnvelopedData message.
+
+The content is encrypted using AES-256-CBC with a random key. The key is
+encrypted for each recipient using RSAES-OAEP with SHA-256 if the certificate
+has an RSA key, or using ephemeral-static ECDH and AES key wrap, as described in
+RFC 5753, if the certificate has an EC key.
+
+## POSITIONAL ARGUMENTS
+
+<file>
+:  The path to the file to encrypt. Use '-' to read from STDIN.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Encrypt a file:
+'''
+$ step crypto cms encrypt --recipient bob.crt file.txt \> file.p7m
+'''
+
+Encrypt a file for two recipients and write it in DER format:
+'''
+$ step crypto cms encrypt --recipient alice.crt --recipient bob.crt \
+  --format der --out file.p7m file.txt
+'''`,
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name: "recipient",
+				Usage: `The <file> with the certificate of a recipient. Use the flag multiple times
+to encrypt for multiple recipients.`,
+			},
+			formatFlag,
+			outFlag,
+			flags.Force,
+		},
+	}
+}
+
+func encryptAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	filename := ctx.Args().First()
+	recipients := ctx.StringSlice("recipient")
+	if len(recipients) == 0 {
+		return errs.RequiredFlag(ctx, "recipient")
+	}
+
+	var certs []*x509.Certificate
+	for _, r := range recipients {
+		crt, err := pemutil.ReadCertificate(r)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, crt)
+	}
+
+	content, err := utils.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	der, err := cms.Encrypt(content, certs, nil)
+	if err != nil {
+		return err
+	}
+	return writeMessage(ctx, der)
+}
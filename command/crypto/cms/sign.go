@@ -0,0 +1,117 @@
+package cms
+
+import (
+	"crypto"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/cms"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func signCommand() cli.Command {
+	return cli.Command{
+		Name:   "sign",
+		Action: command.ActionFunc(signAction),
+		Usage:  "sign data using CMS",
+		UsageText: `**step crypto cms sign** <file> **--cert**=<file> **--key**=<file>
+[**--detached**] [**--password-file**=<file>] [**--format**=<format>] [**--out**=<file>]`,
+		Description: `**step crypto cms sign** signs the content of <file> and prints a CMS
+SignedData message. The message includes the certificates in **--cert**, the
+signing time and, unless **--detached** is used, the signed content.
+
+RSA keys are signed using PKCS #1 v1.5 with SHA-256, EC keys using ECDSA with
+the hash that matches the curve, and Ed25519 keys as described in RFC 8419.
+
+## POSITIONAL ARGUMENTS
+
+<file>
+:  The path to the file to sign. Use '-' to read from STDIN.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Sign a file:
+'''
+$ step crypto cms sign --cert signer.crt --key signer.key file.txt \> file.p7s
+'''
+
+Create a DER-encoded detached signature using an encrypted key:
+'''
+$ step crypto cms sign --detached --format der --out file.sig \
+  --cert signer.crt --key signer.key --password-file pass.txt file.txt
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "cert",
+				Usage: `The <file> with the certificate of the signer. If the file contains more
+than one certificate, the rest of them, usually intermediates, are also added
+to the message.`,
+			},
+			cli.StringFlag{
+				Name:  "key",
+				Usage: "The <file> with the private key of the signer.",
+			},
+			cli.BoolFlag{
+				Name:  "detached",
+				Usage: "Do not include the signed content in the message.",
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: "The path to the <file> containing the password to decrypt the private key.",
+			},
+			formatFlag,
+			outFlag,
+			flags.Force,
+		},
+	}
+}
+
+func signAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	filename := ctx.Args().First()
+	crtFile, keyFile := ctx.String("cert"), ctx.String("key")
+	switch {
+	case crtFile == "":
+		return errs.RequiredFlag(ctx, "cert")
+	case keyFile == "":
+		return errs.RequiredFlag(ctx, "key")
+	}
+
+	certs, err := pemutil.ReadCertificateBundle(crtFile)
+	if err != nil {
+		return err
+	}
+	var opts []pemutil.Options
+	if passFile := ctx.String("password-file"); passFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(passFile))
+	}
+	key, err := pemutil.Read(keyFile, opts...)
+	if err != nil {
+		return err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return errors.Errorf("file %s does not contain a private key", keyFile)
+	}
+
+	content, err := utils.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	der, err := cms.Sign(content, certs, signer, &cms.SignOptions{Detached: ctx.Bool("detached")})
+	if err != nil {
+		return err
+	}
+	return writeMessage(ctx, der)
+}
@@ -0,0 +1,134 @@
+package cms
+
+import (
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/cms"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func verifyCommand() cli.Command {
+	return cli.Command{
+		Name:   "verify",
+		Action: command.ActionFunc(verifyAction),
+		Usage:  "verify a CMS signed message",
+		UsageText: `**step crypto cms verify** <file> [**--content**=<file>]
+[**--roots**=<root-bundle>] [**--insecure**] [**--out**=<file>]`,
+		Description: `**step crypto cms verify** verifies the signatures of a PEM or DER encoded CMS
+SignedData message and the certificate chain of each signer. If the message
+includes the signed content, it is printed to STDOUT or written to **--out**.
+
+If verification fails a non-zero failure code is returned. If verification
+succeeds the command returns 0.
+
+## POSITIONAL ARGUMENTS
+
+<file>
+:  The path to the CMS message. Use '-' to read from STDIN.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Verify a signed message and extract the content:
+'''
+$ step crypto cms verify --roots root_ca.crt --out file.txt file.p7s
+'''
+
+Verify a detached signature:
+'''
+$ step crypto cms verify --roots root_ca.crt --content file.txt file.sig
+'''
+
+Verify the signatures of a message without verifying the certificates:
+'''
+$ step crypto cms verify --insecure file.p7s
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "content",
+				Usage: "The <file> with the signed content of a detached signature.",
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) that will be used to verify the certificates of the
+signers. Defaults to the operating system's root certificate bundle.`,
+			},
+			cli.BoolFlag{
+				Name:  "insecure",
+				Usage: "Do not verify the certificate chain of the signers.",
+			},
+			cli.StringFlag{
+				Name:  "out",
+				Usage: "The <file> to write the signed content to. Defaults to STDOUT.",
+			},
+			flags.Force,
+		},
+	}
+}
+
+func verifyAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	filename := ctx.Args().First()
+	insecure := ctx.Bool("insecure")
+	if insecure && ctx.IsSet("roots") {
+		return errs.IncompatibleFlagWithFlag(ctx, "insecure", "roots")
+	}
+
+	der, err := readMessage(filename)
+	if err != nil {
+		return err
+	}
+	sd, err := cms.ParseSignedData(der)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing %s", filename)
+	}
+
+	var content []byte
+	if contentFile := ctx.String("content"); contentFile != "" {
+		if content, err = utils.ReadFile(contentFile); err != nil {
+			return err
+		}
+	}
+
+	var opts *x509.VerifyOptions
+	if !insecure {
+		var roots *x509.CertPool
+		if r := ctx.String("roots"); r != "" {
+			if roots, err = x509util.ReadCertPool(r); err != nil {
+				return errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", r)
+			}
+		} else if roots, err = x509.SystemCertPool(); err != nil {
+			return errors.Wrap(err, "error loading the system cert pool")
+		}
+		opts = &x509.VerifyOptions{
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}
+	}
+
+	signers, err := sd.Verify(content, opts)
+	if err != nil {
+		return err
+	}
+	for _, crt := range signers {
+		ui.Printf("Signed by %s\n", crt.Subject)
+	}
+
+	if content == nil {
+		return writeOutput(ctx, sd.Content, 0600)
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package crypto
 
 import (
 	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/command/crypto/attest"
+	"github.com/smallstep/cli/command/crypto/cms"
+	"github.com/smallstep/cli/command/crypto/ecdh"
 	"github.com/smallstep/cli/command/crypto/hash"
 	"github.com/smallstep/cli/command/crypto/jose"
 	"github.com/smallstep/cli/command/crypto/jwe"
@@ -10,8 +13,10 @@ import (
 	"github.com/smallstep/cli/command/crypto/jwt"
 	"github.com/smallstep/cli/command/crypto/kdf"
 	"github.com/smallstep/cli/command/crypto/key"
+	"github.com/smallstep/cli/command/crypto/keychain"
 	"github.com/smallstep/cli/command/crypto/nacl"
 	"github.com/smallstep/cli/command/crypto/otp"
+	"github.com/smallstep/cli/command/crypto/tpm"
 	"github.com/urfave/cli"
 )
 
@@ -156,6 +161,9 @@ risks. That said, many of these factors are beyond the scope of this tool.
 		Subcommands: cli.Commands{
 			changePassCommand(),
 			createKeyPairCommand(),
+			attest.Command(),
+			cms.Command(),
+			ecdh.Command(),
 			jwk.Command(),
 			jwt.Command(),
 			jwe.Command(),
@@ -164,8 +172,12 @@ risks. That said, many of these factors are beyond the scope of this tool.
 			hash.Command(),
 			kdf.Command(),
 			key.Command(),
+			keychain.Command(),
 			nacl.Command(),
 			otp.Command(),
+			randCommand(),
+			timestampCommand(),
+			tpm.Command(),
 		},
 	}
 
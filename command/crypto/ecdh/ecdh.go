@@ -0,0 +1,294 @@
+package ecdh
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Command returns the cli.Command for ecdh and related subcommands.
+func Command() cli.Command {
+	return cli.Command{
+		Name:      "ecdh",
+		Aliases:   []string{"x25519"},
+		Usage:     "derive shared keys using elliptic curve Diffie-Hellman",
+		UsageText: "step crypto ecdh <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step crypto ecdh** command group performs an elliptic curve Diffie-Hellman
+(ECDH) key agreement between a private key and the public key of a peer, and
+derives symmetric keys from the shared secret using HKDF (RFC 5869).
+
+Two hosts that already trust each other's public keys (e.g. because they were
+issued by the same certificate authority) can use these commands to agree on a
+symmetric key for an ad-hoc encrypted channel without exchanging any secret.
+
+Supported keys are EC keys (P-256, P-384, P-521) in PEM format, certificates
+or CSRs containing EC public keys, and raw 32-byte X25519 keys as generated by
+**step crypto ecdh keypair** or **step crypto nacl box keypair**.
+
+## EXAMPLES
+
+Create X25519 keypairs for two hosts:
+'''
+# Bob
+$ step crypto ecdh keypair bob.pub bob.priv
+
+# Alice
+$ step crypto ecdh keypair alice.pub alice.priv
+'''
+
+Both hosts derive the same 256-bit key:
+'''
+# Bob
+$ step crypto ecdh derive --info "backup channel" bob.priv alice.pub
+c9e7c4e1d5a4f9e0a33c3b5a0a9a5a1b37b5c0f1c2a98e2ef7e0c3f6c2d1fb30
+
+# Alice
+$ step crypto ecdh derive --info "backup channel" alice.priv bob.pub
+c9e7c4e1d5a4f9e0a33c3b5a0a9a5a1b37b5c0f1c2a98e2ef7e0c3f6c2d1fb30
+'''
+
+Derive a key using an EC private key and the peer's certificate:
+'''
+$ step crypto ecdh derive --salt $(cat salt.txt) host.key peer.crt
+'''`,
+		Subcommands: cli.Commands{
+			keypairCommand(),
+			deriveCommand(),
+		},
+	}
+}
+
+func keypairCommand() cli.Command {
+	return cli.Command{
+		Name:      "keypair",
+		Action:    command.ActionFunc(keypairAction),
+		Usage:     "generate an X25519 key pair",
+		UsageText: "**step crypto ecdh keypair** <pub-file> <priv-file>",
+		Description: `**step crypto ecdh keypair** generates a new X25519 public/private key pair
+and writes them as raw 32-byte files.
+
+For examples, see **step help crypto ecdh**.
+
+## POSITIONAL ARGUMENTS
+
+<pub-file>
+:  The path to write the public key.
+
+<priv-file>
+:  The path to write the private key.`,
+		Flags: []cli.Flag{flags.Force},
+	}
+}
+
+func deriveCommand() cli.Command {
+	return cli.Command{
+		Name:   "derive",
+		Action: command.ActionFunc(deriveAction),
+		Usage:  "derive a symmetric key from a private key and a peer's public key",
+		UsageText: `**step crypto ecdh derive** <priv-key> <pub-key>
+		[**--salt**=<salt>] [**--info**=<info>] [**--length**=<bytes>]
+		[**--hash**=<algorithm>] [**--format**=<format>] [**--password-file**=<file>]`,
+		Description: `**step crypto ecdh derive** computes the ECDH shared secret between
+<priv-key> and <pub-key> and uses HKDF to derive a symmetric key from it. The
+derived key is printed to STDOUT.
+
+Both keys must be of the same type: EC keys must use the same curve, and X25519
+keys must be raw 32-byte files.
+
+For examples, see **step help crypto ecdh**.
+
+## POSITIONAL ARGUMENTS
+
+<priv-key>
+:  The path to the private key. If the key is encrypted you will be prompted
+for the password.
+
+<pub-key>
+:  The path to the public key of the peer. It can be a public key, a
+certificate or a certificate signing request.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "salt",
+				Usage: "The HKDF <salt>. Both parties must use the same value.",
+			},
+			cli.StringFlag{
+				Name: "info",
+				Usage: `The HKDF context <info>. Use different values to derive independent keys
+from the same shared secret.`,
+			},
+			cli.IntFlag{
+				Name:  "length",
+				Usage: "The size in <bytes> of the derived key.",
+				Value: 32,
+			},
+			cli.StringFlag{
+				Name:  "hash",
+				Value: "sha256",
+				Usage: `The hash <algorithm> used by HKDF.
+
+: <algorithm> is a case-sensitive string and must be one of:
+
+    **sha256**
+    :  SHA-256 (default)
+
+    **sha384**
+    :  SHA-384
+
+    **sha512**
+    :  SHA-512`,
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "hex",
+				Usage: `The output <format> of the derived key.
+
+: <format> is a case-sensitive string and must be one of:
+
+    **hex**
+    :  Hexadecimal encoding (default).
+
+    **base64**
+    :  Standard base64 encoding.
+
+    **raw**
+    :  Raw bytes.`,
+			},
+			flags.PasswordFile,
+		},
+	}
+}
+
+func keypairAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	args := ctx.Args()
+	pubFile, privFile := args[0], args[1]
+	if pubFile == privFile {
+		return errs.EqualArguments(ctx, "<pub-file>", "<priv-file>")
+	}
+
+	var pub, priv [keys.X25519KeySize]byte
+	if _, err := rand.Read(priv[:]); err != nil {
+		return errors.Wrap(err, "error generating key")
+	}
+	curve25519.ScalarBaseMult(&pub, &priv)
+
+	if err := utils.WriteFile(pubFile, pub[:], 0600); err != nil {
+		return errs.FileError(err, pubFile)
+	}
+	if err := utils.WriteFile(privFile, priv[:], 0600); err != nil {
+		return errs.FileError(err, privFile)
+	}
+
+	ui.Printf("Your public key has been saved in %s.\n", pubFile)
+	ui.Printf("Your private key has been saved in %s.\n", privFile)
+	return nil
+}
+
+func deriveAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	args := ctx.Args()
+	privFile, pubFile := args[0], args[1]
+
+	length := ctx.Int("length")
+	if length <= 0 {
+		return errs.MinSizeFlag(ctx, "length", "1")
+	}
+
+	var h func() hash.Hash
+	switch alg := ctx.String("hash"); alg {
+	case "sha256", "":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return errs.InvalidFlagValue(ctx, "hash", alg, "sha256, sha384, sha512")
+	}
+
+	format := ctx.String("format")
+	switch format {
+	case "hex", "base64", "raw", "":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "hex, base64, raw")
+	}
+
+	var opts []pemutil.Options
+	if passFile := ctx.String("password-file"); passFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(passFile))
+	}
+
+	priv, err := readKey(privFile, opts...)
+	if err != nil {
+		return err
+	}
+	if _, ok := priv.(*ecdsa.PublicKey); ok {
+		return errors.Errorf("error reading %s: file is not a private key", privFile)
+	}
+	pub, err := readKey(pubFile)
+	if err != nil {
+		return err
+	}
+	if k, ok := pub.(*ecdsa.PrivateKey); ok {
+		pub = &k.PublicKey
+	}
+
+	secret, err := keys.SharedSecret(priv, pub)
+	if err != nil {
+		return err
+	}
+
+	key, err := keys.DeriveKey(h, secret, []byte(ctx.String("salt")), []byte(ctx.String("info")), length)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "base64":
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+	case "raw":
+		os.Stdout.Write(key)
+	default:
+		fmt.Println(hex.EncodeToString(key))
+	}
+	return nil
+}
+
+// readKey reads a raw X25519 key or a PEM encoded key, certificate or CSR
+// from the given file.
+func readKey(filename string, opts ...pemutil.Options) (interface{}, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+	if len(b) == keys.X25519KeySize {
+		return b, nil
+	}
+
+	opts = append(opts, pemutil.WithFilename(filename))
+	return pemutil.ParseKey(b, opts...)
+}
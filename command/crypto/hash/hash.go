@@ -1,6 +1,7 @@
 package hash
 
 import (
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
@@ -19,6 +20,9 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/errs"
 	"github.com/urfave/cli"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/sha3"
 )
 
 type hashConstructor func() hash.Hash
@@ -58,6 +62,21 @@ $ step crypto hash digest --alg md5 --insecure foo.crt
 a2c5dae8eae7d116019f0478e8b0a35a  foo.crt
 '''
 
+SHA3-256 digest of STDIN:
+'''
+$ cat foo.crt | step crypto hash digest --alg sha3-256
+'''
+
+HMAC-SHA256 digest and compare of a file using a key in a file:
+'''
+$ step crypto hash digest --hmac-key-file hmac.key foo.txt
+e306479813b3b6fb2a859ffa8f465f69bae4deed367b9112c20375bcfc361e72  foo.txt
+
+$ step crypto hash compare --hmac-key-file hmac.key \
+  e306479813b3b6fb2a859ffa8f465f69bae4deed367b9112c20375bcfc361e72 foo.txt
+ok
+'''
+
 SHA-512/256 of a list of files:
 '''
 $ find . -type f | xargs step crypto hash digest --alg sha512-256
@@ -76,28 +95,10 @@ $ cat checksums.txt | xargs -n 2 step crypto hash compare --alg sha512-256
 	}
 }
 
-func digestCommand() cli.Command {
-	return cli.Command{
-		Name:   "digest",
-		Action: cli.ActionFunc(digestAction),
-		Usage:  "generate a hash digest of a file or directory",
-		UsageText: `**step crypto hash digest** <file-or-directory>...
-		[**--alg**=<algorithm>]`,
-		Description: `**step crypto hash digest** generates a hash digest for a given file or
-directory. For a file, the output is the same as tools like 'shasum'. For
-directories, the tool computes a hash tree and outputs a single hash digest.
-
-For examples, see **step help crypto hash**.
-
-## POSITIONAL ARGUMENTS
-
-<file-or-directory>
-: The path to a file or directory to hash.`,
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:  "alg",
-				Value: "sha256",
-				Usage: `The hash algorithm to use.
+var algFlag = cli.StringFlag{
+	Name:  "alg",
+	Value: "sha256",
+	Usage: `The hash algorithm to use.
 
 : <algorithm> must be one of:
 
@@ -122,9 +123,65 @@ For examples, see **step help crypto hash**.
     **sha512-256**
     :  SHA-512/256 uses SHA-512 and truncates the output to 256 bits
 
+    **sha3-224**
+    :  SHA3-224 produces a 224-bit hash value
+
+    **sha3-256**
+    :  SHA3-256 produces a 256-bit hash value
+
+    **sha3-384**
+    :  SHA3-384 produces a 384-bit hash value
+
+    **sha3-512**
+    :  SHA3-512 produces a 512-bit hash value
+
+    **blake2b-256**
+    :  BLAKE2b-256 produces a 256-bit hash value
+
+    **blake2b-384**
+    :  BLAKE2b-384 produces a 384-bit hash value
+
+    **blake2b-512**
+    :  BLAKE2b-512 produces a 512-bit hash value
+
+    **blake2s-256**
+    :  BLAKE2s-256 produces a 256-bit hash value
+
     **md5** (requires --insecure)
     :  MD5 produces a 128-bit hash value`,
-			},
+}
+
+var hmacKeyFileFlag = cli.StringFlag{
+	Name: "hmac-key-file",
+	Usage: `The path to the <file> containing the key used to compute an HMAC using the
+hash algorithm in **--alg**. The content of the file is used as is.`,
+}
+
+func digestCommand() cli.Command {
+	return cli.Command{
+		Name:   "digest",
+		Action: cli.ActionFunc(digestAction),
+		Usage:  "generate a hash digest of a file or directory",
+		UsageText: `**step crypto hash digest** [<file-or-directory>...]
+		[**--alg**=<algorithm>] [**--hmac-key-file**=<file>]`,
+		Description: `**step crypto hash digest** generates a hash digest for a given file or
+directory. For a file, the output is the same as tools like 'shasum'. For
+directories, the tool computes a hash tree and outputs a single hash digest.
+
+Files and STDIN are read in a streaming fashion, so large files can be hashed
+without loading them in memory. If **--hmac-key-file** is used, the output is
+the HMAC of the data using the selected hash algorithm.
+
+For examples, see **step help crypto hash**.
+
+## POSITIONAL ARGUMENTS
+
+<file-or-directory>
+: The path to a file or directory to hash. Use '-' to read from STDIN.
+Defaults to STDIN.`,
+		Flags: []cli.Flag{
+			algFlag,
+			hmacKeyFileFlag,
 			cli.BoolFlag{
 				Name:   "insecure",
 				Hidden: true,
@@ -138,52 +195,26 @@ func compareCommand() cli.Command {
 		Name:   "compare",
 		Action: cli.ActionFunc(compareAction),
 		Usage:  "verify the hash digest for a file or directory matches an expected value",
-		UsageText: `**step crypto hash compare** <hash> <file-or-directory>
-		[--alg ALGORITHM]`,
+		UsageText: `**step crypto hash compare** <hash> [<file-or-directory>]
+		[**--alg**=<algorithm>] [**--hmac-key-file**=<file>]`,
 		Description: `**step crypto hash compare** verifies that the expected hash value matches the
-computed hash value for a file or directory.
+computed hash value for a file or directory. The comparison is done in
+constant time.
 
 For examples, see **step help crypto hash**.
 
 ## POSITIONAL ARGUMENTS
 
 <hash>
-: The expected hash digest
+: The expected hash digest, or HMAC if **--hmac-key-file** is used, encoded
+in hexadecimal.
 
 <file-or-directory>
-: The path to a file or directory to hash.`,
+: The path to a file or directory to hash. Use '-' to read from STDIN.
+Defaults to STDIN.`,
 		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:  "alg",
-				Value: "sha256",
-				Usage: `The hash algorithm to use.
-
-: <algorithm> must be one of:
-
-    **sha1** (or sha)
-    :  SHA-1 produces a 160-bit hash value
-
-    **sha224**
-    :  SHA-224 produces a 224-bit hash value
-
-    **sha256** (default)
-    :  SHA-256 produces a 256-bit hash value
-
-    **sha384**
-    :  SHA-384 produces a 384-bit hash value
-
-    **sha512**
-    :  SHA-512 produces a 512-bit hash value
-
-    **sha512-224**
-    :  SHA-512/224 produces a 224-bit hash value
-
-    **sha512-256**
-    :  SHA-512/256 produces a 256-bit hash value
-
-    **md5** (requires --insecure)
-    :  MD5 produces a 128-bit hash value`,
-			},
+			algFlag,
+			hmacKeyFileFlag,
 			cli.BoolFlag{
 				Name:   "insecure",
 				Hidden: true,
@@ -193,43 +224,37 @@ For examples, see **step help crypto hash**.
 }
 
 func digestAction(ctx *cli.Context) error {
-	if ctx.NArg() == 0 {
-		return errs.TooFewArguments(ctx)
-	}
-
-	hc, err := getHash(ctx, ctx.String("alg"), ctx.Bool("insecure"))
+	hc, err := getHashConstructor(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, filename := range ctx.Args() {
-		st, err := os.Stat(filename)
-		if err != nil {
-			return errs.FileError(err, filename)
-		}
+	filenames := []string(ctx.Args())
+	if len(filenames) == 0 {
+		filenames = []string{"-"}
+	}
 
-		var sum []byte
-		if st.IsDir() {
-			sum, err = hashDir(hc, filename)
-		} else {
-			sum, err = hashFile(hc(), filename)
-		}
+	for _, filename := range filenames {
+		sum, err := hashPath(hc, filename)
 		if err != nil {
 			return err
 		}
-
 		fmt.Printf("%x  %s\n", sum, filename)
 	}
 
-	return err
+	return nil
 }
 
 func compareAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 2); err != nil {
-		return err
+	switch ctx.NArg() {
+	case 0:
+		return errs.TooFewArguments(ctx)
+	case 1, 2:
+	default:
+		return errs.TooManyArguments(ctx)
 	}
 
-	hc, err := getHash(ctx, ctx.String("alg"), ctx.Bool("insecure"))
+	hc, err := getHashConstructor(ctx)
 	if err != nil {
 		return err
 	}
@@ -240,18 +265,12 @@ func compareAction(ctx *cli.Context) error {
 		return errs.Wrap(err, "error decoding %s", hashStr)
 	}
 
-	filename := ctx.Args().Get(1)
-	st, err := os.Stat(filename)
-	if err != nil {
-		return errs.FileError(err, filename)
+	filename := "-"
+	if ctx.NArg() == 2 {
+		filename = ctx.Args().Get(1)
 	}
 
-	var sum []byte
-	if st.IsDir() {
-		sum, err = hashDir(hc, filename)
-	} else {
-		sum, err = hashFile(hc(), filename)
-	}
+	sum, err := hashPath(hc, filename)
 	if err != nil {
 		return err
 	}
@@ -266,6 +285,29 @@ func compareAction(ctx *cli.Context) error {
 	return errors.New("fail")
 }
 
+// getHashConstructor returns the hash constructor for the algorithm in the
+// flags. If an HMAC key file is passed the constructor will return an HMAC
+// using that algorithm.
+func getHashConstructor(ctx *cli.Context) (hashConstructor, error) {
+	hc, err := getHash(ctx, ctx.String("alg"), ctx.Bool("insecure"))
+	if err != nil {
+		return nil, err
+	}
+
+	keyFile := ctx.String("hmac-key-file")
+	if keyFile == "" {
+		return hc, nil
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, errs.FileError(err, keyFile)
+	}
+	if len(key) == 0 {
+		return nil, errors.Errorf("file %s is empty", keyFile)
+	}
+	return func() hash.Hash { return hmac.New(hc, key) }, nil
+}
+
 // getHash returns a new hash constructor for the given algorithm. MD5
 // algorithm can only be used if the insecure flag is passed.
 func getHash(ctx *cli.Context, alg string, insecure bool) (hashConstructor, error) {
@@ -284,6 +326,22 @@ func getHash(ctx *cli.Context, alg string, insecure bool) (hashConstructor, erro
 		return func() hash.Hash { return sha512.New512_224() }, nil
 	case "sha512-256":
 		return func() hash.Hash { return sha512.New512_256() }, nil
+	case "sha3-224":
+		return sha3.New224, nil
+	case "sha3-256":
+		return sha3.New256, nil
+	case "sha3-384":
+		return sha3.New384, nil
+	case "sha3-512":
+		return sha3.New512, nil
+	case "blake2b-256":
+		return func() hash.Hash { return mustHash(blake2b.New256(nil)) }, nil
+	case "blake2b-384":
+		return func() hash.Hash { return mustHash(blake2b.New384(nil)) }, nil
+	case "blake2b-512":
+		return func() hash.Hash { return mustHash(blake2b.New512(nil)) }, nil
+	case "blake2s-256":
+		return func() hash.Hash { return mustHash(blake2s.New256(nil)) }, nil
 	case "md5":
 		if insecure {
 			return func() hash.Hash { return md5.New() }, nil
@@ -294,12 +352,44 @@ func getHash(ctx *cli.Context, alg string, insecure bool) (hashConstructor, erro
 	}
 }
 
+// mustHash returns the given hash and panics if there is an error. It's used
+// with constructors that only fail with invalid keys.
+func mustHash(h hash.Hash, err error) hash.Hash {
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// hashPath returns the hash of the given file, directory or STDIN if the
+// filename is "-".
+func hashPath(hc hashConstructor, filename string) ([]byte, error) {
+	if filename == "-" {
+		h := hc()
+		if _, err := io.Copy(h, os.Stdin); err != nil {
+			return nil, errors.Wrap(err, "error reading from STDIN")
+		}
+		return h.Sum(nil), nil
+	}
+
+	st, err := os.Stat(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+	if st.IsDir() {
+		return hashDir(hc, filename)
+	}
+	return hashFile(hc(), filename)
+}
+
 // hashFile returns the hash of the given file using the given hash function.
+// The file is read in a streaming fashion.
 func hashFile(h hash.Hash, filename string) ([]byte, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, errs.FileError(err, filename)
 	}
+	defer f.Close()
 
 	if _, err := io.Copy(h, f); err != nil {
 		return nil, errs.FileError(err, filename)
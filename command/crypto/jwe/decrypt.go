@@ -1,7 +1,6 @@
 package jwe
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/smallstep/cli/errs"
@@ -18,11 +17,18 @@ func decryptCommand() cli.Command {
 		Name:   "decrypt",
 		Action: cli.ActionFunc(decryptAction),
 		Usage:  "verify a JWE and decrypt ciphertext",
-		UsageText: `**step crypto jwe decrypt**
-		[**--key**=<jwk>] [**--jwks**=<jwks>] [**--kid**=<kid>]`,
-		Description: `**step crypto jwe decrypt** verifies a JWE read from STDIN and decrypts the
-ciphertext printing it to STDOUT. If verification fails a non-zero failure
-code is returned. If verification succeeds the command returns 0.
+		UsageText: `**step crypto jwe decrypt** [<file>]
+		[**--key**=<jwk>] [**--jwks**=<jwks>] [**--kid**=<kid>]
+		[**--password-file**=<file>]`,
+		Description: `**step crypto jwe decrypt** verifies a JWE read from <file> or STDIN and
+decrypts the ciphertext printing it to STDOUT. If verification fails a non-zero
+failure code is returned. If verification succeeds the command returns 0.
+
+## POSITIONAL ARGUMENTS
+
+<file>
+:  The path to the file with the JWE. Use '-' to read from STDIN. Defaults to
+STDIN.
 
 For examples, see **step help crypto jwe**.`,
 		Flags: []cli.Flag{
@@ -47,16 +53,18 @@ used with **--key** the <kid> value must match the **"kid"** member of the JWK.
 used with **--jwks** (a JWK Set) the KID value must match the **"kid"** member of
 one of the JWKs in the JWK Set.`,
 			},
+			cli.StringFlag{
+				Name: "password-file",
+				Usage: `The path to the <file> containing the password used to decrypt the content
+encryption key if the JWE uses a PBES2 algorithm, or to decrypt the private key
+in **--key** or **--jwks** otherwise.`,
+			},
 		},
 	}
 }
 
 func decryptAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 0); err != nil {
-		return err
-	}
-
-	data, err := utils.ReadAll(os.Stdin)
+	data, err := readInput(ctx)
 	if err != nil {
 		return err
 	}
@@ -64,6 +72,7 @@ func decryptAction(ctx *cli.Context) error {
 	key := ctx.String("key")
 	jwks := ctx.String("jwks")
 	kid := ctx.String("kid")
+	passwordFile := ctx.String("password-file")
 
 	obj, err := jose.ParseEncrypted(string(data))
 	if err != nil {
@@ -84,7 +93,7 @@ func decryptAction(ctx *cli.Context) error {
 	case isPBES2 && jwks != "":
 		return errors.Errorf("flag '--jwks' cannot be used with JWE algorithm '%s'", alg)
 	case !isPBES2 && key == "" && jwks == "":
-		return errs.RequiredOrFlag(ctx, "key", "jwk")
+		return errs.RequiredOrFlag(ctx, "key", "jwks")
 	case key != "" && jwks != "":
 		return errs.MutuallyExclusiveFlags(ctx, "key", "jwks")
 	case jwks != "" && kid == "":
@@ -97,6 +106,9 @@ func decryptAction(ctx *cli.Context) error {
 	if len(kid) > 0 {
 		options = append(options, jose.WithKid(kid))
 	}
+	if passwordFile != "" && !isPBES2 {
+		options = append(options, jose.WithPasswordFile(passwordFile))
+	}
 
 	// Read key from --key or --jwks
 	var pbes2Key []byte
@@ -106,10 +118,12 @@ func decryptAction(ctx *cli.Context) error {
 		jwk, err = jose.ParseKey(key, options...)
 	case jwks != "":
 		jwk, err = jose.ParseKeySet(jwks, options...)
+	case isPBES2 && passwordFile != "":
+		pbes2Key, err = utils.ReadPasswordFromFile(passwordFile)
 	case isPBES2:
-		pbes2Key, err = ui.PromptPassword("Please enter the password to decrypt the content encryption key")
+		pbes2Key, err = ui.PromptPassword("Please enter the password to decrypt the content encryption key", ui.WithFlag("password-file"))
 	default:
-		return errs.RequiredOrFlag(ctx, "key", "jwk")
+		return errs.RequiredOrFlag(ctx, "key", "jwks")
 	}
 	if err != nil {
 		return err
@@ -141,7 +155,6 @@ func decryptAction(ctx *cli.Context) error {
 		return errors.Wrap(err, "error decrypting data")
 	}
 
-	fmt.Printf(string(decrypted))
-
+	os.Stdout.Write(decrypted)
 	return nil
 }
@@ -2,7 +2,6 @@ package jwe
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/errs"
@@ -17,13 +16,24 @@ func encryptCommand() cli.Command {
 		Name:   "encrypt",
 		Action: cli.ActionFunc(encryptAction),
 		Usage:  "encrypt a payload using JSON Web Encryption (JWE)",
-		UsageText: `**step crypto jwe encrypt**
+		UsageText: `**step crypto jwe encrypt** [<file>]
 		[**--alg**=<key-enc-algorithm>] [**--enc**=<content-enc-algorithm>]
-  		[**--key**=<jwk>] [**--jwks**=<jwks>] [**--kid**=<kid>]`,
+  		[**--key**=<jwk>] [**--jwks**=<jwks>] [**--kid**=<kid>]
+  		[**--password-file**=<file>]`,
 		Description: `**step crypto jwe encrypt** encrypts a payload using JSON Web Encryption
-(JWE). By default, the payload to encrypt is read from STDIN and the JWE data
+(JWE). The payload to encrypt is read from <file> or STDIN, and the JWE data
 structure will be written to STDOUT.
 
+The content encryption key can be wrapped using the public key of a recipient
+(RSA-OAEP, RSA-OAEP-256, ECDH-ES, ...), a shared symmetric key (A128KW,
+A256KW, A256GCMKW, ...) or a password (PBES2-HS256+A128KW, ...).
+
+## POSITIONAL ARGUMENTS
+
+<file>
+:  The path to the file to encrypt. Use '-' to read from STDIN. Defaults to
+STDIN.
+
 For examples, see **step help crypto jwe**.`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -120,7 +130,7 @@ the authentication tag.
 				Name: "key",
 				Usage: `The JWE recipient's public key. The <key> argument should be the name of a
 file. JWEs can be encrypted for a recipient using a public JWK or a PEM
-encoded public key.`,
+encoded public key, or using a symmetric JWK shared with the recipient.`,
 			},
 			cli.StringFlag{
 				Name: "jwks",
@@ -147,6 +157,11 @@ useful to applications, it is ignored by JWE implementations.`,
 applications where more than one JWE payload type may be present. This
 parameter is ignored by JWE implementations, but may be processed by
 applications that use JWE.`,
+			},
+			cli.StringFlag{
+				Name: "password-file",
+				Usage: `The path to the <file> containing the password used to encrypt the content
+encryption key. Requires a PBES2 **--alg**.`,
 			},
 			cli.BoolFlag{
 				Name:   "subtle",
@@ -157,11 +172,7 @@ applications that use JWE.`,
 }
 
 func encryptAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 0); err != nil {
-		return err
-	}
-
-	data, err := utils.ReadAll(os.Stdin)
+	data, err := readInput(ctx)
 	if err != nil {
 		return err
 	}
@@ -188,6 +199,7 @@ func encryptAction(ctx *cli.Context) error {
 	kid := ctx.String("kid")
 	typ := ctx.String("typ")
 	cty := ctx.String("cty")
+	passwordFile := ctx.String("password-file")
 	isSubtle := ctx.Bool("subtle")
 
 	switch {
@@ -195,8 +207,10 @@ func encryptAction(ctx *cli.Context) error {
 		return errs.MutuallyExclusiveFlags(ctx, "alg "+ctx.String("alg"), "key")
 	case isPBES2 && jwks != "":
 		return errs.MutuallyExclusiveFlags(ctx, "alg "+ctx.String("alg"), "jwks")
+	case !isPBES2 && passwordFile != "":
+		return errors.Errorf("flag '--password-file' requires a PBES2 '--alg'")
 	case !isPBES2 && key == "" && jwks == "":
-		return errs.RequiredOrFlag(ctx, "key", "jwk")
+		return errs.RequiredOrFlag(ctx, "key", "jwks")
 	case key != "" && jwks != "":
 		return errs.MutuallyExclusiveFlags(ctx, "key", "jwks")
 	case jwks != "" && kid == "":
@@ -224,8 +238,10 @@ func encryptAction(ctx *cli.Context) error {
 		jwk, err = jose.ParseKey(key, options...)
 	case jwks != "":
 		jwk, err = jose.ParseKeySet(jwks, options...)
+	case isPBES2 && passwordFile != "":
+		pbes2Key, err = utils.ReadPasswordFromFile(passwordFile)
 	case isPBES2:
-		pbes2Key, err = ui.PromptPassword("Please enter the password to encrypt the content encryption key")
+		pbes2Key, err = ui.PromptPassword("Please enter the password to encrypt the content encryption key", ui.WithFlag("password-file"))
 	default:
 		return errs.RequiredOrFlag(ctx, "key", "jwks")
 	}
@@ -241,9 +257,11 @@ func encryptAction(ctx *cli.Context) error {
 			KeyID:     kid,
 		}
 	} else {
-		// Public keys are used for encryption
-		jwkPub := jwk.Public()
-		jwk = &jwkPub
+		// Public keys are used for encryption, symmetric keys are shared
+		if !jose.IsSymmetric(jwk) {
+			jwkPub := jwk.Public()
+			jwk = &jwkPub
+		}
 
 		if jwk.Use == "sig" {
 			return errors.New("invalid jwk use: found 'sig' (signature), expecting 'enc' (encryption)")
@@ -1,6 +1,12 @@
 package jwe
 
-import "github.com/urfave/cli"
+import (
+	"os"
+
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
 
 // Command returns the jwe subcommand.
 func Command() cli.Command {
@@ -139,6 +145,20 @@ Decrypt a message protected with shared password:
 $ step crypto jwe decrypt \< message.json
 Please enter the password to decrypt the content encryption key: ********
 The message
+'''
+
+Encrypt a file using a symmetric key for use with AES Key Wrap:
+'''
+$ step crypto jwk create --kty oct --size 32 --use enc --alg A256KW kw.json kw.priv.json
+$ step crypto jwe encrypt --key kw.json secret.txt \> secret.txt.jwe
+$ step crypto jwe decrypt --key kw.json secret.txt.jwe
+'''
+
+Encrypt and decrypt a file using a password stored in a file:
+'''
+$ step crypto jwe encrypt --alg PBES2-HS256+A128KW --password-file pass.txt \
+  secret.txt \> secret.txt.jwe
+$ step crypto jwe decrypt --password-file pass.txt secret.txt.jwe
 '''`,
 		Subcommands: cli.Commands{
 			encryptCommand(),
@@ -146,3 +166,16 @@ The message
 		},
 	}
 }
+
+// readInput returns the content of the file in the first argument, or STDIN
+// if no argument is given.
+func readInput(ctx *cli.Context) ([]byte, error) {
+	switch ctx.NArg() {
+	case 0:
+		return utils.ReadAll(os.Stdin)
+	case 1:
+		return utils.ReadFile(ctx.Args().First())
+	default:
+		return nil, errs.TooManyArguments(ctx)
+	}
+}
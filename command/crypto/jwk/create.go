@@ -33,14 +33,16 @@ func createCommand() cli.Command {
 		UsageText: `**step crypto jwk create** <public-jwk-file> <private-jwk-file>
     [**--kty**=<type>] [**--alg**=<algorithm>] [**--use**=<use>]
     [**--size**=<size>] [**--crv**=<curve>] [**--kid**=<kid>]
-    [**--from-pem**=<pem-file>] [**--password-file**=<file>]`,
+    [**--from-pem**=<pem-file>] [**--password-file**=<file>]
+    [**--password-gen**[=<length>]]`,
 		Description: `**step crypto jwk create** generates a new JWK (JSON Web Key) or constructs a
 JWK from an existing key. The generated JWK conforms to RFC7517 and can be used
 to sign and encrypt data using JWT, JWS, and JWE.
 
 Files containing private keys are encrypted by default. You'll be prompted for
-a password. Keys are written with file mode **0600** (i.e., readable and
-writable only by the current user).
+a password, or a random passphrase is generated with **--password-gen**. Keys
+are written with file mode **0600** (i.e., readable and writable only by the
+current user).
 
 All flags are optional. Defaults are suitable for most use cases.
 
@@ -394,6 +396,7 @@ related.`,
 existing <pem-file> instead of creating a new key.`,
 			},
 			flags.PasswordFile,
+			flags.PasswordGen,
 			flags.NoPassword,
 			flags.Subtle,
 			flags.Insecure,
@@ -415,6 +418,9 @@ func createAction(ctx *cli.Context) (err error) {
 		if len(passwordFile) > 0 {
 			return errs.IncompatibleFlag(ctx, "no-password", "password-file")
 		}
+		if ctx.IsSet("password-gen") {
+			return errs.IncompatibleFlag(ctx, "no-password", "password-gen")
+		}
 		if ctx.Bool("insecure") {
 			usePassword = false
 		} else {
@@ -428,15 +434,6 @@ func createAction(ctx *cli.Context) (err error) {
 		return errs.EqualArguments(ctx, "public-jwk-file", "private-jwk-file")
 	}
 
-	// Read password if necessary
-	var password string
-	if len(passwordFile) > 0 {
-		password, err = utils.ReadStringPasswordFromFile(passwordFile)
-		if err != nil {
-			return err
-		}
-	}
-
 	kty := ctx.String("kty")
 	crv := ctx.String("crv")
 	alg := ctx.String("alg")
@@ -547,7 +544,11 @@ func createAction(ctx *cli.Context) (err error) {
 		var rcpt jose.Recipient
 		// Generate JWE encryption key.
 		if jose.SupportsPBKDF2 {
-			key, err := ui.PromptPassword("Please enter the password to encrypt the private JWK", ui.WithValue(password))
+			password, err := utils.GetNewPasswordFromCLI(ctx, "password-file")
+			if err != nil {
+				return err
+			}
+			key, err := ui.PromptPassword("Please enter the password to encrypt the private JWK", ui.WithValue(password), ui.WithFlag("password-file"), ui.WithValidateEntropy())
 			if err != nil {
 				return errors.Wrap(err, "error reading password")
 			}
@@ -52,6 +52,13 @@ $ step crypto jwk keyset list ks.json
 L38TOXsig8h6FeBOos03nFy6iXmwusFcIBBB0ZilahY
 '''
 
+Rotate a key, replacing a JWK in a JWKS with the public part of a new one:
+'''
+$ step crypto jwk create new.pub.json new.json
+$ step crypto jwk keyset add --public ks.json new.json \
+  --replace ZI9Ku2jJQL84ewxVn8C_67iDaTN_DFTXE9Gypo6-3YE
+'''
+
 Extract a JWK from a JWKS:
 '''
 $ step crypto jwk keyset find ks.json --kid L38TOXsig8h6FeBOos03nFy6iXmwusFcIBBB0ZilahY
@@ -11,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/jose"
+	"github.com/smallstep/cli/utils"
 	"github.com/urfave/cli"
 )
 
@@ -19,9 +20,9 @@ func keysetCommand() cli.Command {
 		Name:      "keyset",
 		Usage:     "add, remove, and find JWKs in JWK Sets",
 		UsageText: "**step crypto jwk keyset** <subcommand> [arguments] [global-flags] [subcommand-flags]",
-		Description: `**step crypto jwk set** command group provides facilities for managing and
-inspecting JWK Sets. A is a JSON object that represents a set of JWKs. They
-are defined in RFC7517.
+		Description: `**step crypto jwk keyset** command group provides facilities for managing and
+inspecting JWK Sets. A JWK Set is a JSON object that represents a set of JWKs.
+They are defined in RFC7517.
 
 A JWK Set is simply a JSON object with a "keys" member whose value is an array
 of JWKs. Additional members are allowed in the object. They will be preserved
@@ -39,18 +40,56 @@ For examples, see **step help crypto jwk**.`,
 
 func keysetAddCommand() cli.Command {
 	return cli.Command{
-		Name:      "add",
-		Action:    cli.ActionFunc(keysetAddAction),
-		Usage:     "a JWK to a JWK Set",
-		UsageText: "**step crypto jwk keyset add** <jwks-file>",
-		Description: `**step crypto jwk keyset add** reads a JWK from STDIN and adds it to the JWK
-Set in <jwks-file>. Modifications to <jwks-file> are in-place. The file is
-'flock'd while it's being read and modified.
+		Name:   "add",
+		Action: cli.ActionFunc(keysetAddAction),
+		Usage:  "a JWK to a JWK Set",
+		UsageText: `**step crypto jwk keyset add** <jwks-file> [<jwk-file>]
+[**--public**] [**--replace**=<kid>] [**--password-file**=<file>]`,
+		Description: `**step crypto jwk keyset add** reads a JWK from <jwk-file>, or STDIN, and adds
+it to the JWK Set in <jwks-file>. If <jwks-file> does not exist, a new JWK Set
+is created. Modifications to <jwks-file> are in-place. The file is 'flock'd
+while it's being read and modified.
+
+A JWK that is already in the JWK Set, with the same key ID and JWK Thumbprint,
+is not added again.
 
 ## POSITIONAL ARGUMENTS
 
 <jwks-file>
-: File containing a JWK Set`,
+: File containing a JWK Set
+
+<jwk-file>
+: File containing the JWK to add. Use '-' to read from STDIN. Defaults to STDIN.
+
+## EXAMPLES
+
+Add the public part of a private JWK to a JWK Set:
+'''
+$ step crypto jwk keyset add --public ks.json priv.json
+'''
+
+Rotate a key, adding a new public JWK and removing the old one:
+'''
+$ step crypto jwk keyset add ks.json new.pub.json \
+  --replace ZI9Ku2jJQL84ewxVn8C_67iDaTN_DFTXE9Gypo6-3YE
+'''`,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name: "public",
+				Usage: `Add only the public part of the JWK. Use this flag to add the public key of
+a private JWK to a JWK Set that is going to be published.`,
+			},
+			cli.StringFlag{
+				Name: "replace",
+				Usage: `Remove the JWKs with the key ID <kid> from the JWK Set after adding the new
+JWK. Use this flag to rotate keys in a single operation. <kid> is a
+case-sensitive string.`,
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the JWK.`,
+			},
+		},
 	}
 }
 
@@ -59,11 +98,13 @@ func keysetRemoveCommand() cli.Command {
 		Name:      "remove",
 		Action:    cli.ActionFunc(keysetRemoveAction),
 		Usage:     "a JWK from a JWK Set",
-		UsageText: "**step crypto jwk keyset remove** <jwks-file> [**--kid**=<kid>]",
-		Description: `**step crypto jwk keyset remove** removes the JWK with a key ID matching <kid>
+		UsageText: "**step crypto jwk keyset remove** <jwks-file> **--kid**=<kid>",
+		Description: `**step crypto jwk keyset remove** removes the JWKs with a key ID matching <kid>
 from the JWK Set stored in <jwks-file>. Modifications to <jwks-file> are
 in-place. The file is 'flock'd while it's being read and modified.
 
+If no JWK matches <kid> a non-zero failure code is returned.
+
 ## POSITIONAL ARGUMENTS
 
 <jwks-file>
@@ -99,11 +140,13 @@ func keysetFindCommand() cli.Command {
 		Name:      "find",
 		Action:    cli.ActionFunc(keysetFindAction),
 		Usage:     "a JWK in a JWK Set",
-		UsageText: "**step crypto jwk keyset find** <jwks-file> [**--kid**=<kid>]",
+		UsageText: "**step crypto jwk keyset find** <jwks-file> **--kid**=<kid>",
 		Description: `**step crypto jwk keyset find** command locates the JWK with a key ID matching
 <kid> from the JWK Set stored in <jwks-file>. The matching JWK is printed to
 STDOUT.
 
+If no JWK matches <kid> a non-zero failure code is returned.
+
 ## POSITIONAL ARGUMENTS
 
 <jwks-file>
@@ -119,17 +162,29 @@ string.`,
 }
 
 func keysetAddAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 1); err != nil {
-		return err
+	switch ctx.NArg() {
+	case 0:
+		return errs.TooFewArguments(ctx)
+	case 1, 2:
+	default:
+		return errs.TooManyArguments(ctx)
 	}
 
-	b, err := ioutil.ReadAll(os.Stdin)
+	filename := ctx.Args().Get(1)
+	if filename == "" {
+		filename = "-"
+	}
+	b, err := utils.ReadFile(filename)
 	if err != nil {
-		return errors.Wrap(err, "error reading STDIN")
+		return err
 	}
 
 	// Attempt to parse an encrypted file
-	if b, err = jose.Decrypt("Please enter the password to decrypt JWK", b); err != nil {
+	var opts []jose.Option
+	if passwordFile := ctx.String("password-file"); passwordFile != "" {
+		opts = append(opts, jose.WithPasswordFile(passwordFile))
+	}
+	if b, err = jose.Decrypt("Please enter the password to decrypt JWK", b, opts...); err != nil {
 		return err
 	}
 
@@ -138,9 +193,29 @@ func keysetAddAction(ctx *cli.Context) error {
 	if err := json.Unmarshal(b, &jwk); err != nil {
 		return errors.New("error reading JWK: unsupported format")
 	}
+	if ctx.Bool("public") {
+		if jose.IsSymmetric(&jwk) {
+			return errors.New("error reading JWK: a symmetric JWK does not have a public key")
+		}
+		jwk = jwk.Public()
+	}
+	thumbprint, err := jose.Thumbprint(&jwk)
+	if err != nil {
+		return err
+	}
+
+	replace := ctx.String("replace")
+	if ctx.IsSet("replace") {
+		switch replace {
+		case "":
+			return errs.InvalidFlagValue(ctx, "replace", "", "")
+		case jwk.KeyID:
+			return errors.New("flag '--replace' cannot be the key ID of the JWK to add")
+		}
+	}
 
 	jwksFile := ctx.Args().Get(0)
-	jwks, writeFunc, err := rwLockKeySet(jwksFile)
+	jwks, writeFunc, err := rwLockKeySet(jwksFile, true)
 	if err != nil {
 		return err
 	}
@@ -148,7 +223,24 @@ func keysetAddAction(ctx *cli.Context) error {
 	// According to RFC7517 there are cases where multiple keys can share the
 	// same "kid". One example is if they have different "kty" values but are
 	// considered to be equivalent alternatives by the application using them.
-	jwks.Keys = append(jwks.Keys, jwk)
+	// Only exact duplicates are skipped.
+	var found bool
+	for i := range jwks.Keys {
+		if jwks.Keys[i].KeyID == jwk.KeyID {
+			if tp, err := jose.Thumbprint(&jwks.Keys[i]); err == nil && tp == thumbprint {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	if ctx.IsSet("replace") {
+		removeKeys(jwks, replace)
+	}
+
 	return writeFunc(true)
 }
 
@@ -157,22 +249,21 @@ func keysetRemoveAction(ctx *cli.Context) error {
 		return err
 	}
 
+	if !ctx.IsSet("kid") {
+		return errs.RequiredFlag(ctx, "kid")
+	}
 	kid := ctx.String("kid")
 
 	jwksFile := ctx.Args().Get(0)
-	jwks, writeFunc, err := rwLockKeySet(jwksFile)
+	jwks, writeFunc, err := rwLockKeySet(jwksFile, false)
 	if err != nil {
 		return err
 	}
 
-	// Filtering without allocating
-	keys := jwks.Keys[:0]
-	for _, key := range jwks.Keys {
-		if key.KeyID != kid {
-			keys = append(keys, key)
-		}
+	if removeKeys(jwks, kid) == 0 {
+		writeFunc(false)
+		return errors.Errorf("error removing JWK: key ID '%s' not found in %s", kid, jwksFile)
 	}
-	jwks.Keys = keys
 	return writeFunc(true)
 }
 
@@ -182,7 +273,7 @@ func keysetListAction(ctx *cli.Context) error {
 	}
 
 	jwksFile := ctx.Args().Get(0)
-	jwks, writeFunc, err := rwLockKeySet(jwksFile)
+	jwks, writeFunc, err := rwLockKeySet(jwksFile, false)
 	if err != nil {
 		return err
 	}
@@ -199,14 +290,21 @@ func keysetFindAction(ctx *cli.Context) error {
 		return err
 	}
 
+	if !ctx.IsSet("kid") {
+		return errs.RequiredFlag(ctx, "kid")
+	}
 	kid := ctx.String("kid")
 
 	jwksFile := ctx.Args().Get(0)
-	jwks, writeFunc, err := rwLockKeySet(jwksFile)
+	jwks, writeFunc, err := rwLockKeySet(jwksFile, false)
 	if err != nil {
 		return err
 	}
+	if err := writeFunc(false); err != nil {
+		return err
+	}
 
+	var found bool
 	for _, key := range jwks.Keys {
 		if key.KeyID == kid {
 			b, err := json.MarshalIndent(key, "", "  ")
@@ -214,16 +312,42 @@ func keysetFindAction(ctx *cli.Context) error {
 				return errors.Wrap(err, "error marshaling JWK")
 			}
 			fmt.Println(string(b))
+			found = true
 		}
 	}
+	if !found {
+		return errors.Errorf("error finding JWK: key ID '%s' not found in %s", kid, jwksFile)
+	}
 
-	return writeFunc(false)
+	return nil
 }
 
-func rwLockKeySet(filename string) (jwks *jose.JSONWebKeySet, writeFunc func(bool) error, err error) {
+// removeKeys removes the keys with the given kid from the JWK Set and returns
+// the number of keys removed.
+func removeKeys(jwks *jose.JSONWebKeySet, kid string) int {
+	// Filtering without allocating
+	n := len(jwks.Keys)
+	keys := jwks.Keys[:0]
+	for _, key := range jwks.Keys {
+		if key.KeyID != kid {
+			keys = append(keys, key)
+		}
+	}
+	jwks.Keys = keys
+	return n - len(keys)
+}
+
+// rwLockKeySet opens and locks the JWK Set in the given file, creating it if
+// create is true. The returned function must be called to unlock the file,
+// writing the JWK Set to it if its argument is true.
+func rwLockKeySet(filename string, create bool) (jwks *jose.JSONWebKeySet, writeFunc func(bool) error, err error) {
 	var f *os.File
 
-	f, err = os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+	flag := os.O_RDWR
+	if create {
+		flag |= os.O_CREATE
+	}
+	f, err = os.OpenFile(filename, flag, 0600)
 	if err != nil {
 		err = errs.FileError(err, filename)
 		return
@@ -261,18 +385,23 @@ func rwLockKeySet(filename string) (jwks *jose.JSONWebKeySet, writeFunc func(boo
 		return
 	}
 
-	// Unmarshal the plain JWKSet
+	// Unmarshal the plain JWKSet, keeping any additional members
 	jwks = new(jose.JSONWebKeySet)
+	members := make(map[string]json.RawMessage)
 	if len(b) > 0 {
 		if err = json.Unmarshal(b, jwks); err != nil {
 			err = errors.Wrapf(err, "error reading %s", filename)
 			return
 		}
+		if err = json.Unmarshal(b, &members); err != nil {
+			err = errors.Wrapf(err, "error reading %s", filename)
+			return
+		}
 	}
 
 	writeFunc = func(write bool) (err error) {
 		if write {
-			if b, err1 := json.MarshalIndent(jwks, "", "  "); err1 != nil {
+			if b, err1 := marshalKeySet(jwks, members); err1 != nil {
 				err = errors.Wrapf(err1, "error marshaling %s", filename)
 			} else {
 				if err1 := f.Truncate(0); err1 != nil {
@@ -302,3 +431,18 @@ func rwLockKeySet(filename string) (jwks *jose.JSONWebKeySet, writeFunc func(boo
 
 	return
 }
+
+// marshalKeySet returns the JSON encoding of the JWK Set with the given
+// additional members.
+func marshalKeySet(jwks *jose.JSONWebKeySet, members map[string]json.RawMessage) ([]byte, error) {
+	keys := jwks.Keys
+	if keys == nil {
+		keys = []jose.JSONWebKey{}
+	}
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	members["keys"] = b
+	return json.MarshalIndent(members, "", "  ")
+}
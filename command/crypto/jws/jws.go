@@ -82,6 +82,18 @@ $ echo $TOKEN | step crypto jws verify --key p256.pub.json --json
   "payload": "eyJkbnMiOiJodHRwczovL2Rucy5leGFtcGxlLmNvbSJ9",
   "signature": "ZI8q75r3PCXeu-Tubw7bHiDGxloPpAHV2hNfEp9N4WM2r3Wsk5uFhAkBTVIqryPtxmAgfRHGnE3hj-3Dp9nZmA"
 }
+'''
+
+Create a JWS with a detached payload and verify it:
+'''
+$ step crypto jws sign --key p256.priv.json --detached payload.json \> payload.json.jws
+$ step crypto jws verify --key p256.pub.json --payload payload.json \< payload.json.jws
+'''
+
+Create a JWS with a detached and unencoded payload (RFC 7797):
+'''
+$ step crypto jws sign --key p256.priv.json --detached --b64=false payload.json
+eyJhbGciOiJFUzI1NiIsImI2NCI6ZmFsc2UsImNyaXQiOlsiYjY0Il0sImtpZCI6IlY5M0EtWWg3Qmh3MVcyRTBpZ0ZjaXZpSnpYNFBYUHN3b1ZncmllaG05Q28ifQ..5DtR0E7c1ZlA2GgW8oGtR5kH8ZtYvNx0z7O4hNq3tqB2nfqgN2bnM5kY7Od2PXXzqvkCtTjnp6i1C8fHQJz0Sw
 '''`,
 		Subcommands: cli.Commands{
 			signCommand(),
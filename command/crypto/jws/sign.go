@@ -21,13 +21,19 @@ func signCommand() cli.Command {
 		Usage:  "create a signed JWS data structure",
 		UsageText: `**step crypto jws sign** [- | <filename>]
 		[**--alg**=<algorithm>] [**--jku**=<jwk-url>] [**--jwk**] [**--typ**=<type>]
-		[**--cty=<content-type>] [**--key**=<jwk>] [**--jwks**=<jwks>] [**--kid**=<kid>]`,
+		[**--cty=<content-type>] [**--key**=<jwk>] [**--jwks**=<jwks>] [**--kid**=<kid>]
+		[**--detached**] [**--b64**=<bool>]`,
 		// others: x5u, x5c, x5t, x5t#S256, and crit
 		Description: `**step crypto jws sign** generates a signed JSON Web Signature (JWS) by
 computing a digital signature or message authentication code for an arbitrary
 payload. By default, the payload to sign is read from STDIN and the JWS will
 be written to STDOUT.
 
+With **--detached** the payload is not included in the JWS, and it must be
+provided separately to verify it. With **--b64=false** the payload is signed
+without being base64url encoded, as described in RFC 7797, this option
+requires **--detached**.
+
 For examples, see **step help crypto jws**.`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -146,6 +152,19 @@ flag to specify which key to use.`,
 string. When used with '--jwk' the <kid> value must match the **"kid"** member
 of the JWK. When used with **--jwks** (a JWK Set) the <kid> value must match
 the **"kid"** member of one of the JWKs in the JWK Set.`,
+			},
+			cli.BoolFlag{
+				Name: "detached",
+				Usage: `Creates a JWS with a detached payload. The payload part of the compact
+serialization will be empty, and the payload must be provided to verify the
+JWS using **step crypto jws verify --payload**.`,
+			},
+			cli.BoolTFlag{
+				Name: "b64",
+				Usage: `Sets the "b64" (base64url-encode payload) Header Parameter defined in RFC 7797.
+With **--b64=false** the payload is not base64url encoded before signing, and
+"b64" is added to the "crit" Header Parameter. Use of **--b64=false** requires
+the **--detached** flag. Defaults to true.`,
 			},
 			cli.BoolFlag{
 				Name:   "subtle",
@@ -179,8 +198,14 @@ func signAction(ctx *cli.Context) error {
 	}
 
 	isSubtle := ctx.Bool("subtle")
+	isDetached := ctx.Bool("detached")
+	isB64 := ctx.BoolT("b64")
 	alg := ctx.String("alg")
 
+	if !isB64 && !isDetached {
+		return errors.New("flag '--b64=false' requires the '--detached' flag")
+	}
+
 	// Validate key, jwks and kid
 	key := ctx.String("key")
 	jwks := ctx.String("jwks")
@@ -259,6 +284,9 @@ func signAction(ctx *cli.Context) error {
 	if ctx.Bool("jwk") {
 		so.WithHeader("jwk", jwk.Public())
 	}
+	if !isB64 {
+		so.WithBase64(false)
+	}
 
 	signer, err := jose.NewSigner(jose.SigningKey{
 		Algorithm: jose.SignatureAlgorithm(jwk.Algorithm),
@@ -273,7 +301,12 @@ func signAction(ctx *cli.Context) error {
 		return errors.Errorf("error signing payload: %s", strings.TrimPrefix(err.Error(), "square/go-jose: "))
 	}
 
-	raw, err := signed.CompactSerialize()
+	var raw string
+	if isDetached {
+		raw, err = signed.DetachedCompactSerialize()
+	} else {
+		raw, err = signed.CompactSerialize()
+	}
 	if err != nil {
 		return errors.Wrapf(err, "error serializing JWS")
 	}
@@ -17,7 +17,8 @@ func verifyCommand() cli.Command {
 		Action: cli.ActionFunc(verifyAction),
 		Usage:  "verify a signed JWS data structure and return the payload",
 		UsageText: `**step crypto jws verify**
-[**--alg**=<algorithm>] [**--key**=<key>] [**--jwks**=<jwks>] [**--kid**=<kid>]`,
+[**--alg**=<algorithm>] [**--key**=<key>] [**--jwks**=<jwks>] [**--kid**=<kid>]
+[**--payload**=<file>]`,
 		Description: `**step crypto jws verify** reads a JWS data structure from STDIN; checks that
 the algorithm are in agreement with expectations; verifies the digital
 signature or message authentication code as appropriate; and outputs the
@@ -32,6 +33,11 @@ For a JWS to be verified successfully:
     present) and must match the **"kid"** in the JWK or the **"kid"** of one of the
     JWKs in JWKS
   * The JWS signature must be successfully verified
+  * If the JWS has a detached payload, the payload in **--payload** must be the
+    one that was signed
+
+The "b64" Header Parameter defined in RFC 7797 is supported, any other
+critical header in "crit" will make the verification fail.
 
 For examples, see **step help crypto jws**.`,
 		Flags: []cli.Flag{
@@ -65,6 +71,11 @@ a "kid" member the '--kid' flag can be used.`,
 				Usage: `The ID of the key used to sign the JWK, used to select a JWK from a JWK Set.
 The KID argument is a case-sensitive string. If the input JWS has a "kid"
 member its value must match <kid> or verification will fail.`,
+			},
+			cli.StringFlag{
+				Name: "payload",
+				Usage: `The <file> with the payload of a JWS with a detached payload. The payload is
+not printed on success.`,
 			},
 			cli.BoolFlag{
 				Name: "json",
@@ -97,7 +108,20 @@ func verifyAction(ctx *cli.Context) error {
 		return errors.Wrap(err, "error reading token")
 	}
 
-	tok, err := jose.ParseJWS(token)
+	var tok *jose.JSONWebSignature
+	payloadFile := ctx.String("payload")
+	if payloadFile != "" {
+		var detached []byte
+		if detached, err = utils.ReadFile(payloadFile); err != nil {
+			return err
+		}
+		tok, err = jose.ParseDetachedJWS(token, detached)
+	} else {
+		if isDetached(token) {
+			return errors.New("flag '--payload' is required to verify a JWS with a detached payload")
+		}
+		tok, err = jose.ParseJWS(token)
+	}
 	if err != nil {
 		return errors.Errorf("error parsing token: %s", strings.TrimPrefix(err.Error(), "square/go-jose: "))
 	}
@@ -162,8 +186,8 @@ func verifyAction(ctx *cli.Context) error {
 		return err
 	}
 
-	// We don't support any critical headers
-	if _, ok := tok.Signatures[0].Header.ExtraHeaders["crit"]; ok {
+	// We only support the b64 critical header
+	if crit, ok := tok.Signatures[0].Header.ExtraHeaders["crit"]; ok && !isSupportedCritical(crit) {
 		return errors.New("validation failed: unrecognized critical headers (crit)")
 	}
 	if alg != "" && tok.Signatures[0].Header.Algorithm != "" && alg != tok.Signatures[0].Header.Algorithm {
@@ -179,6 +203,31 @@ func verifyAction(ctx *cli.Context) error {
 		return printToken(tok)
 	}
 
-	os.Stdout.Write(payload)
+	// The payload of a detached JWS is already known
+	if payloadFile == "" {
+		os.Stdout.Write(payload)
+	}
 	return nil
 }
+
+// isDetached returns true if the given token is a JWS in compact serialization
+// with an empty payload.
+func isDetached(token string) bool {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	return len(parts) == 3 && parts[1] == ""
+}
+
+// isSupportedCritical returns true if the "crit" header only contains the
+// headers that we understand, currently only "b64" from RFC 7797.
+func isSupportedCritical(crit interface{}) bool {
+	names, ok := crit.([]interface{})
+	if !ok || len(names) == 0 {
+		return false
+	}
+	for _, name := range names {
+		if name != "b64" {
+			return false
+		}
+	}
+	return true
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/jose"
+	"github.com/smallstep/cli/ui"
 	"github.com/smallstep/cli/utils"
 	"github.com/urfave/cli"
 )
@@ -22,8 +23,13 @@ func inspectCommand() cli.Command {
 		UsageText: `**step crypto jwt inspect**
 		**--insecure**`,
 		Description: `**step crypto jwt inspect** reads a JWT data structure from STDIN, decodes it,
-and outputs the header and payload on STDERR. Since this command does not
-verify the JWT you must pass **--insecure** as a misuse prevention mechanism.
+and outputs the header and payload on STDOUT. Since this command does not
+verify the JWT you must pass **--insecure** as a misuse prevention mechanism,
+and a warning is printed on STDERR: the contents of the token cannot be trusted
+until it is verified using **step crypto jwt verify**.
+
+To print the audience, subject, SANs, and validity of a provisioning token use
+**step ca token --inspect** instead.
 
 For examples, see **step help crypto jwt**.`,
 		Flags: []cli.Flag{
@@ -49,6 +55,7 @@ func inspectAction(ctx *cli.Context) error {
 		return err
 	}
 
+	ui.Println("WARNING: the token has not been verified, do not trust its contents.")
 	return printToken(token)
 }
 
@@ -80,6 +80,7 @@ $ echo $TOKEN | step crypto jwt verify --key p256.pub.json --iss "joe@example.co
 Read the information in the previous token without verifying it:
 '''
 $ echo $TOKEN | step crypto jwt inspect --insecure
+WARNING: the token has not been verified, do not trust its contents.
 {
   "header": {
     "alg": "ES256",
@@ -97,6 +98,20 @@ $ echo $TOKEN | step crypto jwt inspect --insecure
   },
   "signature": "DlSkxICjk2h1LarwJgXPbXQe7DwpLMOCvWp3I4GMcBP_5_QYPhVNBPQEeTKAUuQjYwlxZ5zVQnyp8ujvyf1Lqw"
 }
+'''
+
+Create a signed JWT valid for 5 minutes with custom claims using a PEM key:
+'''
+$ step crypto jwt sign --key priv.pem --alg ES256 --iss "joe@example.com" \
+      --aud "https://example.com" --sub auth --exp 5m \
+      --set role=admin --set 'groups=["dev","ops"]'
+'''
+
+Verify a token using the JWK Set of an OAuth provider, allowing one minute of
+clock skew:
+'''
+$ echo $TOKEN | step crypto jwt verify --jwks-uri https://www.googleapis.com/oauth2/v3/certs \
+      --iss https://accounts.google.com --aud $CLIENT_ID --leeway 1m
 '''`,
 		Subcommands: cli.Commands{
 			signCommand(),
@@ -7,11 +7,14 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/crypto/randutil"
 	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/jose"
 	"github.com/urfave/cli"
 )
@@ -24,7 +27,7 @@ func signCommand() cli.Command {
 		UsageText: `**step crypto jwt sign** [- | <filename>]
 		[**--alg**=<algorithm>] [**--aud**=<audience>] [**--iss**=<issuer>] [**--sub**=<sub>]
         [**--exp**=<expiration>] [**--iat**=<issued_at>] [**--nbf**=<not-before>] [**--key**=<jwk>]
-        [**--jwks**=<jwks>] [**--kid**=<kid>] [**--jti**=<jti>]`,
+        [**--jwks**=<jwks>] [**--kid**=<kid>] [**--jti**=<jti>] [**--set**=<name=value>]`,
 		Description: `**step crypto jwt sign** command generates a signed JSON Web Token (JWT) by
 computing a digital signature or message authentication code for a JSON
 payload. By default, the payload to sign is read from STDIN and the JWT will
@@ -42,6 +45,9 @@ A "claim" is a piece of information asserted about a subject, represented as a
 key/value pair. Logically a verified JWT should be interpreted as "<issuer> says
 to <audience> that <subject>'s <claim-name> is <claim-value>" for each claim.
 
+Custom claims can be added using a JSON payload, or using the **--set** flag.
+Claims in the payload take precedence over the ones set using flags.
+
 Some optional arguments introduce subtle security considerations if omitted.
 These considerations should be carefully analyzed. Therefore, omitting <subtle>
 arguments requires the use of the **--subtle** flag as a misuse prevention
@@ -137,22 +143,26 @@ application specific.
 
 : <subject> is a case-sensitive string.`,
 			},
-			cli.Int64Flag{
+			cli.StringFlag{
 				Name: "exp, expiration",
 				Usage: `The expiration time on or after which the JWT must not be accepted.
-<expiration> must be a numeric value representing a Unix timestamp.`,
+<expiration> can be a numeric value representing a Unix timestamp, a time in
+RFC 3339 format (e.g. "2019-06-24T21:00:00Z"), or a duration from the current
+time (e.g. "5m"). Valid time units are "ns", "us" (or "µs"), "ms", "s", "m",
+"h".`,
 			},
-			cli.Int64Flag{
+			cli.StringFlag{
 				Name: "nbf, not-before",
-				Usage: `The time before which the JWT must not be accepted. <not-before> must be a
-numeric value representing a Unix timestamp. If not provided, the current time
-is used.`,
+				Usage: `The time before which the JWT must not be accepted. <not-before> can be a
+numeric value representing a Unix timestamp, a time in RFC 3339 format, or a
+duration from the current time. If not provided, the current time is used.`,
 			},
-			cli.Int64Flag{
+			cli.StringFlag{
 				Name: "iat, issued-at",
 				Usage: `The time at which the JWT was issued, used to determine the age of the JWT.
-ISSUED_AT must be a numeric value representing a Unix timestamp. If not
-provided, the current time is used.`,
+<issued_at> can be a numeric value representing a Unix timestamp, a time in
+RFC 3339 format, or a duration from the current time. If not provided, the
+current time is used.`,
 			},
 			cli.StringFlag{
 				Name: "jti, jwt-id",
@@ -163,6 +173,15 @@ prevent a JWT from being replayed (i.e., recipient(s) can use <jti> to make a
 JWT one-time-use). The <jti> argument is a case-sensitive string. If the
 **--jti** flag is used without an argument a <jti> will be generated randomly
 with sufficient entropy to satisfy the collision-resistance criteria.`,
+			},
+			cli.StringSliceFlag{
+				Name: "set",
+				Usage: `A custom claim to add to the JWT, where <name=value> is the name of the
+claim and its value separated by an equals sign (e.g. "role=admin"). Values
+that are valid JSON, like numbers, booleans, arrays or objects, are added with
+their JSON type, any other value is added as a string. Custom claims take
+precedence over the ones in the payload. Use the flag multiple times to add
+multiple claims.`,
 			},
 			cli.StringFlag{
 				Name: "key",
@@ -289,19 +308,39 @@ func signAction(ctx *cli.Context) error {
 		return err
 	}
 
+	// Parse time claims
+	exp, err := parseNumericDate(ctx, "exp")
+	if err != nil {
+		return err
+	}
+	nbf, err := parseNumericDate(ctx, "nbf")
+	if err != nil {
+		return err
+	}
+	iat, err := parseNumericDate(ctx, "iat")
+	if err != nil {
+		return err
+	}
+
 	// Validate exp
-	if !isSubtle && ctx.IsSet("exp") && jose.NumericDate(ctx.Int64("exp")).Time().Before(time.Now()) {
+	if !isSubtle && exp != 0 && exp.Time().Before(time.Now()) {
 		return errors.New("flag '--exp' must be in the future unless the '--subtle' flag is provided")
 	}
 
+	// Parse custom claims
+	custom, err := parseCustomClaims(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Add claims
 	c := &jose.Claims{
 		Issuer:    ctx.String("iss"),
 		Subject:   ctx.String("sub"),
 		Audience:  ctx.StringSlice("aud"),
-		Expiry:    jose.NumericDate(ctx.Int64("exp")),
-		NotBefore: jose.NumericDate(ctx.Int64("nbf")),
-		IssuedAt:  jose.NumericDate(ctx.Int64("iat")),
+		Expiry:    exp,
+		NotBefore: nbf,
+		IssuedAt:  iat,
 		ID:        ctx.String("jti"),
 	}
 	now := time.Now()
@@ -355,7 +394,7 @@ func signAction(ctx *cli.Context) error {
 		aud["aud"] = c.Audience[0]
 	}
 
-	raw, err := jose.Signed(signer).Claims(c).Claims(aud).Claims(payload).CompactSerialize()
+	raw, err := jose.Signed(signer).Claims(c).Claims(aud).Claims(payload).Claims(custom).CompactSerialize()
 	if err != nil {
 		return errors.Wrapf(err, "error serializing JWT")
 	}
@@ -364,6 +403,40 @@ func signAction(ctx *cli.Context) error {
 	return nil
 }
 
+// parseNumericDate parses the value of a time flag, it can be a Unix timestamp,
+// a time in RFC 3339 format or a duration from the current time.
+func parseNumericDate(ctx *cli.Context, name string) (jose.NumericDate, error) {
+	s := ctx.String(name)
+	if s == "" {
+		return 0, nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return jose.NumericDate(i), nil
+	}
+	t, ok := flags.ParseTimeOrDuration(s)
+	if !ok {
+		return 0, errs.InvalidFlagValue(ctx, name, s, "")
+	}
+	return jose.NewNumericDate(t), nil
+}
+
+// parseCustomClaims returns the claims in the --set flag.
+func parseCustomClaims(ctx *cli.Context) (map[string]interface{}, error) {
+	claims := make(map[string]interface{})
+	for _, s := range ctx.StringSlice("set") {
+		i := strings.Index(s, "=")
+		if i < 1 {
+			return nil, errs.InvalidFlagValue(ctx, "set", s, "")
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(s[i+1:]), &v); err != nil {
+			v = s[i+1:]
+		}
+		claims[s[:i]] = v
+	}
+	return claims, nil
+}
+
 func readPayload(filename string) (interface{}, error) {
 	var r io.Reader
 	switch filename {
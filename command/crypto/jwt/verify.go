@@ -19,8 +19,9 @@ func verifyCommand() cli.Command {
 		Action: cli.ActionFunc(verifyAction),
 		Usage:  "verify a signed JWT data structure and return the payload",
 		UsageText: `**step crypto jwt verify**
-		[**--aud**=<audience>] [**--iss**=<issuer>] [**--alg**=<algorithm>]
-		[**--key**=<key>] [**--jwks**=<jwks>] [**--kid**=<kid>]`,
+		[**--aud**=<audience>] [**--iss**=<issuer>] [**--sub**=<subject>] [**--alg**=<algorithm>]
+		[**--key**=<key>] [**--jwks**=<jwks>] [**--jwks-uri**=<url>] [**--kid**=<kid>]
+		[**--leeway**=<duration>]`,
 		Description: `**step crypto jwt verify** reads a JWT data structure from STDIN; checks that
 the audience, issuer, and algorithm are in agreement with expectations;
 verifies the digital signature or message authentication code as appropriate;
@@ -34,6 +35,9 @@ For a JWT to be verified successfully:
   * The <algorithm> must match the **"alg"** member in the JWT header
   * The <issuer> and <audience> must match the **"iss"** and **"aud"** claims in the JWT,
     respectively
+  * The <subject>, if given, must match the **"sub"** claim in the JWT
+  * The current time must be before the **"exp"** claim and after the **"nbf"**
+    claim, if present, with the allowed <duration> of clock skew in **--leeway**
   * The <kid> must match the **"kid"** member in the JWT header (if both are
     present) and must match the **"kid"** in the JWK or the **"kid"** of one of the
     JWKs in JWKS
@@ -51,6 +55,16 @@ the JWT. <issuer> is a case-sensitive string.`,
 				Usage: `The identity of the principal running this command. The <audience> specified
 must match one of the values in the **"aud"** claim, indicating the intended
 recipient(s) of the JWT. <audience> is a case-sensitive string.`,
+			},
+			cli.StringFlag{
+				Name: "sub, subject",
+				Usage: `The subject of this JWT. If set, the <subject> must match the value of the
+**"sub"** claim in the JWT. <subject> is a case-sensitive string.`,
+			},
+			cli.StringFlag{
+				Name: "leeway",
+				Usage: `The <duration> of clock skew allowed when checking the **"exp"** and **"nbf"**
+claims, e.g. "30s" or "1m". Defaults to no leeway.`,
 			},
 			cli.StringFlag{
 				Name: "alg, algorithm",
@@ -72,10 +86,19 @@ in RFC 2898).`,
 			cli.StringFlag{
 				Name: "jwks",
 				Usage: `The JWK Set containing the key to use to verify the JWS. The <jwks> argument
-should be the name of a file. The file contents should be a JWK Set or a JWE
-with a JWK Set payload. The JWS being verified should have a "kid" member that
+should be the name of a file or an https URL, like the "jwks_uri" of an OAuth
+provider. The contents should be a JWK Set or a JWE with a JWK Set payload. The JWS being verified should have a "kid" member that
 matches the "kid" of one of the JWKs in the JWK Set. If the JWS does not have
 a "kid" member the '--kid' flag can be used.`,
+			},
+			cli.StringFlag{
+				Name: "jwks-uri",
+				Usage: `The https <url> of a JWK Set containing the key to use to verify the JWS,
+like the "jwks_uri" of an OpenID Connect provider. The key is selected using the
+"kid" member of the JWS or the '--kid' flag. The JWK Set is cached in
+'$STEPPATH/cache/jwks' for as long as the Cache-Control or Expires headers of
+the response allow it, and it is fetched again if the key is not found in the
+cached copy.`,
 			},
 			cli.StringFlag{
 				Name: "kid",
@@ -127,21 +150,31 @@ func verifyAction(ctx *cli.Context) error {
 		return errors.Errorf("error parsing token: %s", strings.TrimPrefix(err.Error(), "square/go-jose: "))
 	}
 
-	// Validate key, jwks and kid
+	// Validate key, jwks, jwks-uri and kid
 	key := ctx.String("key")
 	jwks := ctx.String("jwks")
+	jwksURI := ctx.String("jwks-uri")
 	kid := ctx.String("kid")
 	alg := ctx.String("alg")
 	switch {
-	case key == "" && jwks == "":
-		return errs.RequiredOrFlag(ctx, "key", "jwks")
+	case key == "" && jwks == "" && jwksURI == "":
+		return errs.RequiredOrFlag(ctx, "key", "jwks", "jwks-uri")
 	case key != "" && jwks != "":
 		return errs.MutuallyExclusiveFlags(ctx, "key", "jwks")
+	case key != "" && jwksURI != "":
+		return errs.MutuallyExclusiveFlags(ctx, "key", "jwks-uri")
+	case jwks != "" && jwksURI != "":
+		return errs.MutuallyExclusiveFlags(ctx, "jwks", "jwks-uri")
 	case jwks != "" && kid == "":
 		if tok.Headers[0].KeyID == "" {
 			return errs.RequiredWithFlag(ctx, "kid", "jwks")
 		}
 		kid = tok.Headers[0].KeyID
+	case jwksURI != "" && kid == "":
+		if tok.Headers[0].KeyID == "" {
+			return errs.RequiredWithFlag(ctx, "kid", "jwks-uri")
+		}
+		kid = tok.Headers[0].KeyID
 	}
 
 	// Validate subtled
@@ -157,6 +190,13 @@ func verifyAction(ctx *cli.Context) error {
 		}
 	}
 
+	var leeway time.Duration
+	if s := ctx.String("leeway"); s != "" {
+		if leeway, err = time.ParseDuration(s); err != nil || leeway < 0 {
+			return errs.InvalidFlagValue(ctx, "leeway", s, "")
+		}
+	}
+
 	// Validate no-exp-check with insecure
 	if ctx.Bool("no-exp-check") && !ctx.Bool("insecure") {
 		return errs.RequiredInsecureFlag(ctx, "no-exp-check")
@@ -181,15 +221,17 @@ func verifyAction(ctx *cli.Context) error {
 		options = append(options, jose.WithPasswordFile(passwordFile))
 	}
 
-	// Read key from --key or --jwks
+	// Read key from --key, --jwks or --jwks-uri
 	var jwk *jose.JSONWebKey
 	switch {
 	case key != "":
 		jwk, err = jose.ParseKey(key, options...)
 	case jwks != "":
 		jwk, err = jose.ParseKeySet(jwks, options...)
+	case jwksURI != "":
+		jwk, err = jose.ParseKeySetURL(jwksURI, options...)
 	default:
-		return errs.RequiredOrFlag(ctx, "key", "jwks")
+		return errs.RequiredOrFlag(ctx, "key", "jwks", "jwks-uri")
 	}
 	if err != nil {
 		return err
@@ -239,7 +281,7 @@ func verifyAction(ctx *cli.Context) error {
 		}
 	}
 
-	expected := jose.Expected{Issuer: iss}
+	expected := jose.Expected{Issuer: iss, Subject: ctx.String("sub")}
 	if aud != "" {
 		expected.Audience = jose.Audience{aud}
 	}
@@ -247,7 +289,7 @@ func verifyAction(ctx *cli.Context) error {
 		expected.Time = time.Now()
 	}
 
-	if err := validateClaimsWithLeeway(ctx, claims, expected, tClaims, 0); err != nil {
+	if err := validateClaimsWithLeeway(ctx, claims, expected, tClaims, leeway); err != nil {
 		return err
 	}
 
@@ -263,9 +305,8 @@ func validateClaimsWithLeeway(ctx *cli.Context, c jose.Claims, e jose.Expected,
 		errs = append(errs, "invalid issuer claim (iss)")
 	}
 
-	// we're not currently checking the subject
 	if e.Subject != "" && e.Subject != c.Subject {
-		errs = append(errs, "invalid subject subject (sub)")
+		errs = append(errs, "invalid subject claim (sub)")
 	}
 
 	// we're not currently checking the id
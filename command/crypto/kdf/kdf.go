@@ -56,6 +56,21 @@ Enter password to hash: ********
 $argon2id$v=19$m=65536,t=1,p=4$HDi5gI15NwJrKveh2AAa9Q$30haKRwwUe5I4WfkPZPGmhJKTRTO+98x+sVnHhOHdK8
 '''
 
+Derive a password using custom parameters:
+'''
+$ step crypto kdf hash --alg scrypt --cost 17 --parallelism 2
+Enter password to hash: ********
+$scrypt$ln=17,r=8,p=2$jO1gCis6DNotIq1YN7JI1g$da5BzlY8exEU5dL/OzGaj7SImyEwDRck0vFwZ2BK//k
+
+$ step crypto kdf hash --alg bcrypt --cost 12
+Enter password to hash: ********
+$2a$12$PgWT7CiKB1hPctDIhKdEOexG/e5gnOTK75skgVU0fAAxSUPpQ1Sr6
+
+$ step crypto kdf hash --alg argon2id --iterations 3 --memory 262144 --parallelism 2
+Enter password to hash: ********
+$argon2id$v=19$m=262144,t=3,p=2$3Q3Pw/I8rSEJqNoN7kdZ5A$zt+VEKM27zyvwvEsfqLZAxCkdq7tADy+eKYZ546QA74
+'''
+
 Validate a hash:
 '''
 $ step crypto kdf compare '$scrypt$ln=15,r=8,p=1$3TCG+xs8HWSIHonnqTp6Xg$UI8CYfz6koUaRMjDWEFgujIxM63fYnAcc0HhpUryFn8'
@@ -99,7 +114,9 @@ func hashCommand() cli.Command {
 		Action: cli.ActionFunc(hashAction),
 		Usage:  "derive a secret key from a secret value (e.g., a password)",
 		UsageText: `**step crypto kdf hash** [<input>]
-		[--alg ALGORITHM]`,
+		[**--alg**=<algorithm>] [**--cost**=<cost>] [**--block-size**=<size>]
+		[**--parallelism**=<threads>] [**--iterations**=<number>] [**--memory**=<kib>]
+		[**--salt-size**=<bytes>] [**--key-length**=<bytes>]`,
 		Description: `**step crypto kdf hash** uses a key derivation function (KDF) to produce a
 pseudorandom secret key based on some (presumably secret) input value. This is
 useful for password verification approaches based on password hashing. Key
@@ -116,9 +133,13 @@ This command will produce a string encoding of the KDF output along with the
 algorithm used, salt, and any parameters required for validation in PHC string
 format.
 
-The KDFs are run with parameters that are considered safe. The 'scrypt'
-parameters are currently fixed at N=32768, r=8 and p=1. The 'bcrypt' work
-factor is currently fixed at 10.
+By default, the KDFs are run with parameters that are considered safe. The
+'scrypt' parameters default to N=32768 (ln=15), r=8 and p=1. The 'bcrypt' work
+factor defaults to 10. The 'argon2i' parameters default to t=3, m=32768 and
+p=4, and the 'argon2id' parameters default to t=1, m=65536 and p=4. The
+parameters can be tuned using the flags below, the flags that do not apply to
+the selected algorithm are rejected. The salt is 16 bytes and the derived key
+is 32 bytes long unless **--salt-size** or **--key-length** are used.
 
 For examples, see **step help crypto kdf**.
 
@@ -149,6 +170,35 @@ appear in places you might not expect. If omitted input is read from STDIN.`,
     **argon2id**
     : A password-based KDF optimized to resist GPU and side-channel attacks.`,
 			},
+			cli.IntFlag{
+				Name: "cost",
+				Usage: `The <cost> parameter. For **scrypt** it is the base 2 logarithm of the
+CPU/memory cost N (ln), for **bcrypt** it is the work factor between 4 and 31.`,
+			},
+			cli.IntFlag{
+				Name:  "block-size",
+				Usage: `The block <size> parameter (r) used by **scrypt**.`,
+			},
+			cli.IntFlag{
+				Name:  "parallelism",
+				Usage: `The parallelism parameter (p) used by **scrypt** and argon2 as a number of <threads>.`,
+			},
+			cli.IntFlag{
+				Name:  "iterations",
+				Usage: `The <number> of iterations (t) used by **argon2i** and **argon2id**.`,
+			},
+			cli.IntFlag{
+				Name:  "memory",
+				Usage: `The amount of memory in <kib> (m) used by **argon2i** and **argon2id**.`,
+			},
+			cli.IntFlag{
+				Name:  "salt-size",
+				Usage: `The size in <bytes> of the random salt used by **scrypt** and argon2.`,
+			},
+			cli.IntFlag{
+				Name:  "key-length",
+				Usage: `The size in <bytes> of the key derived by **scrypt** and argon2.`,
+			},
 			cli.BoolFlag{
 				Name:   "insecure",
 				Hidden: true,
@@ -161,21 +211,32 @@ func hashAction(ctx *cli.Context) error {
 	var err error
 	var input []byte
 
-	// Get kdf method
+	// Get kdf method and the flags supported
 	var f kdf.KDF
-	switch alg := ctx.String("alg"); alg {
+	var supported []string
+	alg := ctx.String("alg")
+	switch alg {
 	case "scrypt":
 		f = kdf.Scrypt
+		supported = []string{"cost", "block-size", "parallelism", "salt-size", "key-length"}
 	case "bcrypt":
 		f = kdf.Bcrypt
+		supported = []string{"cost"}
 	case "argon2i":
 		f = kdf.Argon2i
+		supported = []string{"iterations", "memory", "parallelism", "salt-size", "key-length"}
 	case "argon2id":
 		f = kdf.Argon2id
+		supported = []string{"iterations", "memory", "parallelism", "salt-size", "key-length"}
 	default:
 		return errs.InvalidFlagValue(ctx, "alg", alg, "")
 	}
 
+	opts, err := kdfOptions(ctx, alg, supported)
+	if err != nil {
+		return err
+	}
+
 	// Grab input from terminal or arguments
 	switch ctx.NArg() {
 	case 0:
@@ -193,7 +254,7 @@ func hashAction(ctx *cli.Context) error {
 	}
 
 	// Hash input
-	hash, err := f(input)
+	hash, err := f(input, opts...)
 	if err != nil {
 		return err
 	}
@@ -202,6 +263,45 @@ func hashAction(ctx *cli.Context) error {
 	return nil
 }
 
+// kdfFlags are the flags used to customize the key derivation functions.
+var kdfFlags = []struct {
+	name   string
+	option func(int) kdf.Option
+}{
+	{"cost", kdf.WithCost},
+	{"block-size", kdf.WithBlockSize},
+	{"parallelism", kdf.WithParallelism},
+	{"iterations", kdf.WithIterations},
+	{"memory", kdf.WithMemory},
+	{"salt-size", kdf.WithSaltSize},
+	{"key-length", kdf.WithKeyLength},
+}
+
+// kdfOptions returns the kdf options for the flags set in the context. It
+// returns an error if a flag is not supported by the algorithm.
+func kdfOptions(ctx *cli.Context, alg string, supported []string) ([]kdf.Option, error) {
+	var opts []kdf.Option
+	for _, fl := range kdfFlags {
+		if !ctx.IsSet(fl.name) {
+			continue
+		}
+		if !contains(supported, fl.name) {
+			return nil, errs.IncompatibleFlagValue(ctx, fl.name, "alg", alg)
+		}
+		opts = append(opts, fl.option(ctx.Int(fl.name)))
+	}
+	return opts, nil
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func compareCommand() cli.Command {
 	return cli.Command{
 		Name:      "compare",
@@ -2,19 +2,21 @@ package key
 
 import (
 	"bytes"
-	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"io/ioutil"
 	"os"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
 	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/jose"
 	"github.com/smallstep/cli/ui"
 	"github.com/smallstep/cli/utils"
 	"github.com/urfave/cli"
@@ -23,20 +25,29 @@ import (
 
 func formatCommand() cli.Command {
 	return cli.Command{
-		Name:      "format",
-		Action:    command.ActionFunc(formatAction),
-		Usage:     `reformat a public or private key`,
-		UsageText: `**step crypto key format** <key-file> [**--out**=<path>]`,
+		Name:   "format",
+		Action: command.ActionFunc(formatAction),
+		Usage:  `reformat a public or private key`,
+		UsageText: `**step crypto key format** <key-file> [**--out**=<path>]
+[**--pem**|**--der**|**--jwk**|**--ssh**] [**--pkcs8**]
+[**--password-file**=<file>] [**--out-password-file**=<file>]
+[**--no-password** **--insecure**]`,
 		Description: `**step crypto key format** prints or writes the key in
 a different format.
 
-By default PEM formated keys will be converted to DER with the following rules:
+Supported input formats are PEM (PKCS#1, PKCS#8, RFC 5915 and OpenSSH private
+keys), DER, JWK (plain or encrypted) and OpenSSH public keys. The flags
+**--pem**, **--der**, **--jwk** and **--ssh** select the output format. If none
+of them is set, PEM formatted keys will be converted to DER, and any other
+format will be converted to PEM.
+
+DER formatted keys will use the following rules:
 
  * ECDSA, RSA, AND Ed25519 public keys will use the DER-encoded PKIX format.
  * ECDSA, AND RSA private keys will use the ASN.1, DER format.
  * Ed25519 private keys will use the DER-encoded PKCS8 encoded form.
 
-And DER encoded keys will be converted to PEM with the following rules:
+PEM formatted keys will use the following rules:
 
  * ECDSA, RSA, AND Ed25519 public keys will use the PEM-encoded PKIX format.
  * ECDSA private keys will use the PEM-encoded format defined in RFC 5915 and
@@ -44,15 +55,20 @@ And DER encoded keys will be converted to PEM with the following rules:
  * RSA private keys will use the PEM-encoded PKCS#1 format.
  * Ed25519 private keys will use the PEM-encoded PKCS#8 format.
 
-The flags **--pkcs8**, **--pem** and **--der** can be use to change the previous
-defaults. For example we can use **--pkcs8** to save a PKCS#1 RSA key to the
-PKCS#8 form. Or we can combine **--pem** and **--pkcs8** to convert to PKCS#8 a
-PEM file.
+The flag **--pkcs8** can be used to change the previous defaults. For example we
+can use **--pkcs8** to save a PKCS#1 RSA key to the PKCS#8 form. Or we can
+combine **--pem** and **--pkcs8** to convert to PKCS#8 a PEM file.
+
+JWK formatted keys use the JWK Thumbprint as the key ID, and private JWKs are
+encrypted using PBES2 unless **--no-password** is used. OpenSSH formatted
+private keys use the format of the OpenSSH PEM block, encrypted using bcrypt and
+AES-256-CTR unless **--no-password** is used, and public keys use the format of
+the authorized_keys file.
 
 ## POSITIONAL ARGUMENTS
 
-<crt_file>
-:  Path to a certificate file.
+<key-file>
+:  Path to a key file.
 
 ## EXIT CODES
 
@@ -93,6 +109,28 @@ $ step crypto key format --pkcs8 key.der --out key-pkcs8.der
 Convert an ASN.1 DER format to the DER-encoded PKCS#8 format:
 '''
 $ step crypto key format --der --pkcs8 key.der --out key-pkcs8.der
+'''
+
+Convert an encrypted PEM private key to an encrypted JWK, using different
+passwords:
+'''
+$ step crypto key format --jwk --password-file key.pass \
+  --out-password-file jwk.pass key.pem --out key.json
+'''
+
+Convert a JWK to PEM:
+'''
+$ step crypto key format key.json --out key.pem
+'''
+
+Convert a PEM private key to the OpenSSH format:
+'''
+$ step crypto key format --ssh key.pem --out id_ecdsa
+'''
+
+Convert an OpenSSH public key to PEM:
+'''
+$ step crypto key format id_ed25519.pub
 '''`,
 		Flags: []cli.Flag{
 			cli.BoolFlag{
@@ -100,28 +138,39 @@ $ step crypto key format --der --pkcs8 key.der --out key-pkcs8.der
 				Usage: "Convert RSA and ECDSA private keys to PKCS#8 PEM/DER format.",
 			},
 			cli.BoolFlag{
-				Name: "pem",
-				Usage: `Uses PEM as the result encoding format. If neither **--pem** nor **--der** are
-set it will always switch to the other format.`,
+				Name:  "pem",
+				Usage: `Uses PEM as the result encoding format.`,
+			},
+			cli.BoolFlag{
+				Name:  "der",
+				Usage: `Uses DER as the result encoding format.`,
 			},
 			cli.BoolFlag{
-				Name: "der",
-				Usage: `Uses DER as the result enconfig format. If neither **--pem** nor **--der** are
-set it will always switch to the other format.`,
+				Name:  "jwk",
+				Usage: `Uses JWK as the result encoding format.`,
+			},
+			cli.BoolFlag{
+				Name:  "ssh",
+				Usage: `Uses OpenSSH as the result encoding format.`,
 			},
 			cli.StringFlag{
 				Name:  "out",
 				Usage: "Path to write the reformatted result.",
 			},
 			cli.StringFlag{
-				Name:  "password-file",
-				Usage: "Location of file containing passphrase to decrypt private key.",
+				Name: "password-file",
+				Usage: `Location of file containing passphrase to decrypt private key. It is also
+used to encrypt the result if **--out-password-file** is not set.`,
+			},
+			cli.StringFlag{
+				Name:  "out-password-file",
+				Usage: "Location of file containing passphrase to encrypt the private key.",
 			},
 			cli.BoolFlag{
 				Name: "no-password",
-				Usage: `Do not ask for a password to encrypt a private key with PEM format. Sensitive
-key material will be written to disk unencrypted. This is not recommended.
-Requires **--insecure** flag.`,
+				Usage: `Do not ask for a password to encrypt a private key with PEM, JWK or OpenSSH
+format. Sensitive key material will be written to disk unencrypted. This is not
+recommended. Requires **--insecure** flag.`,
 			},
 			flags.Insecure,
 			flags.Force,
@@ -139,21 +188,31 @@ func formatAction(ctx *cli.Context) error {
 		out        = ctx.String("out")
 		toPEM      = ctx.Bool("pem")
 		toDER      = ctx.Bool("der")
+		toJWK      = ctx.Bool("jwk")
+		toSSH      = ctx.Bool("ssh")
 		noPassword = ctx.Bool("no-password")
 		insecure   = ctx.Bool("insecure")
 		key        interface{}
 		ob         []byte
 	)
 
-	// --pem and --der cannot be used at the same time
-	if toPEM && toDER {
-		return errs.IncompatibleFlagWithFlag(ctx, "pem", "der")
+	// --pem, --der, --jwk and --ssh cannot be used at the same time
+	formats := []string{"pem", "der", "jwk", "ssh"}
+	for i, f1 := range formats {
+		for _, f2 := range formats[i+1:] {
+			if ctx.Bool(f1) && ctx.Bool(f2) {
+				return errs.MutuallyExclusiveFlags(ctx, f1, f2)
+			}
+		}
 	}
 
 	// --no-password requires --insecure
 	if noPassword && !insecure {
 		return errs.RequiredInsecureFlag(ctx, "no-password")
 	}
+	if noPassword && ctx.IsSet("out-password-file") {
+		return errs.IncompatibleFlagWithFlag(ctx, "no-password", "out-password-file")
+	}
 
 	b, err := ioutil.ReadFile(keyFile)
 	if err != nil {
@@ -170,15 +229,40 @@ func formatAction(ctx *cli.Context) error {
 			return err
 		}
 		// convert to DER if not specified
-		if !toPEM && !toDER {
+		if !toPEM && !toJWK && !toSSH {
 			toDER = true
 		}
+	case isOpenSSHPublicKey(b): // OpenSSH public key
+		if key, err = pemutil.ParseOpenSSHPublicKey(b); err != nil {
+			return errors.Wrapf(err, "error parsing %s", keyFile)
+		}
+		// convert to PEM if not specified
+		if !toDER && !toJWK && !toSSH {
+			toPEM = true
+		}
+	case isJWK(b): // JWK format, encrypted or not
+		var opts []jose.Option
+		if passFile := ctx.String("password-file"); passFile != "" {
+			opts = append(opts, jose.WithPasswordFile(passFile))
+		}
+		jwk, err := jose.ParseKey(keyFile, opts...)
+		if err != nil {
+			return err
+		}
+		if jose.IsSymmetric(jwk) {
+			return errors.Errorf("error parsing %s: symmetric keys are not supported", keyFile)
+		}
+		key = jwk.Key
+		// convert to PEM if not specified
+		if !toDER && !toJWK && !toSSH {
+			toPEM = true
+		}
 	default: // assuming DER format
 		if key, err = pemutil.ParseDER(b); err != nil {
 			return err
 		}
 		// convert to PEM if not specified
-		if !toPEM && !toDER {
+		if !toDER && !toJWK && !toSSH {
 			toPEM = true
 		}
 	}
@@ -192,6 +276,14 @@ func formatAction(ctx *cli.Context) error {
 		if ob, err = convertToDER(ctx, key); err != nil {
 			return err
 		}
+	case toJWK:
+		if ob, err = convertToJWK(ctx, key); err != nil {
+			return err
+		}
+	case toSSH:
+		if ob, err = convertToSSH(ctx, key); err != nil {
+			return err
+		}
 	default:
 		return errors.New("error formating key: it should not get here")
 	}
@@ -212,13 +304,45 @@ func formatAction(ctx *cli.Context) error {
 	return nil
 }
 
+// isOpenSSHPublicKey returns true if the given data looks like a public key in
+// the OpenSSH authorized_keys format.
+func isOpenSSHPublicKey(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("ssh-")) || bytes.HasPrefix(b, []byte("ecdsa-sha2-"))
+}
+
+// isJWK returns true if the given data looks like a JSON object or a JWE in
+// the compact serialization.
+func isJWK(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return bytes.HasPrefix(b, []byte("{")) || bytes.HasPrefix(b, []byte("eyJ"))
+}
+
+// isPrivateKey returns true if the given key is a supported private key.
+func isPrivateKey(key interface{}) bool {
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return true
+	default:
+		return false
+	}
+}
+
+// outPasswordFile returns the file with the password used to encrypt the
+// result.
+func outPasswordFile(ctx *cli.Context) string {
+	if passFile := ctx.String("out-password-file"); passFile != "" {
+		return passFile
+	}
+	return ctx.String("password-file")
+}
+
 func convertToPEM(ctx *cli.Context, key interface{}) (b []byte, err error) {
 	opts := []pemutil.Options{
 		pemutil.WithPKCS8(ctx.Bool("pkcs8")),
 	}
 	// Add password if necessary
-	if _, ok := key.(crypto.PrivateKey); ok && !ctx.Bool("no-password") {
-		if passFile := ctx.String("password-file"); passFile != "" {
+	if isPrivateKey(key) && !ctx.Bool("no-password") {
+		if passFile := outPasswordFile(ctx); passFile != "" {
 			opts = append(opts, pemutil.WithPasswordFile(passFile))
 		} else {
 			opts = append(opts, pemutil.WithPasswordPrompt("Please enter the password to encrypt the private key"))
@@ -254,3 +378,58 @@ func convertToDER(ctx *cli.Context, key interface{}) (b []byte, err error) {
 	}
 	return
 }
+
+func convertToJWK(ctx *cli.Context, key interface{}) ([]byte, error) {
+	pub, err := keys.PublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	jwk, err := jose.PublicJWK(pub)
+	if err != nil {
+		return nil, err
+	}
+	if !isPrivateKey(key) {
+		return json.MarshalIndent(jwk, "", "  ")
+	}
+
+	jwk.Key = key
+	if ctx.Bool("no-password") {
+		return json.MarshalIndent(jwk, "", "  ")
+	}
+
+	var opts []jose.Option
+	if passFile := outPasswordFile(ctx); passFile != "" {
+		opts = append(opts, jose.WithPasswordFile(passFile))
+	}
+	jwe, err := jose.EncryptJWK(jwk, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(jwe.FullSerialize()), "", "  "); err != nil {
+		return nil, errors.Wrap(err, "error formatting JSON")
+	}
+	return out.Bytes(), nil
+}
+
+func convertToSSH(ctx *cli.Context, key interface{}) ([]byte, error) {
+	if !isPrivateKey(key) {
+		return pemutil.MarshalOpenSSHPublicKey(key)
+	}
+
+	opts := []pemutil.Options{
+		pemutil.WithOpenSSH(true),
+	}
+	if !ctx.Bool("no-password") {
+		if passFile := outPasswordFile(ctx); passFile != "" {
+			opts = append(opts, pemutil.WithPasswordFile(passFile))
+		} else {
+			opts = append(opts, pemutil.WithPasswordPrompt("Please enter the password to encrypt the private key"))
+		}
+	}
+	block, err := pemutil.Serialize(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
@@ -19,6 +19,16 @@ Convert PEM format to PKCS8.
 '''
 $ step crypto key format foo-key.pem
 '''
+
+Convert a PEM private key to an OpenSSH private key.
+'''
+$ step crypto key format --ssh foo-key.pem
+'''
+
+Convert a JWK to the PEM format.
+'''
+$ step crypto key format foo-key.json
+'''
 `,
 
 		Subcommands: cli.Commands{
@@ -0,0 +1,50 @@
+package keychain
+
+import (
+	"github.com/smallstep/cli/crypto/keychain"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+)
+
+func deleteCommand() cli.Command {
+	return cli.Command{
+		Name:      "delete",
+		Action:    cli.ActionFunc(deleteAction),
+		Usage:     "delete a certificate and its key from the Keychain",
+		UsageText: `**step crypto keychain delete** <uri>`,
+		Description: `**step crypto keychain delete** deletes the certificate and the private key
+with the label in the given URI from the macOS Keychain. Keys in the Secure
+Enclave cannot be recovered once deleted.
+
+## POSITIONAL ARGUMENTS
+
+<uri>
+:  The Keychain URI, e.g. 'keychain:label=internal.example.com'.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Delete a certificate and its key:
+'''
+$ step crypto keychain delete keychain:label=internal.example.com
+'''`,
+	}
+}
+
+func deleteAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	rawuri := ctx.Args().Get(0)
+	if err := keychain.Delete(rawuri); err != nil {
+		return err
+	}
+
+	ui.Printf("The certificate and key of %s have been deleted.\n", rawuri)
+	return nil
+}
@@ -0,0 +1,101 @@
+package keychain
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/keychain"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+)
+
+func importCommand() cli.Command {
+	return cli.Command{
+		Name:   "import",
+		Action: cli.ActionFunc(importAction),
+		Usage:  "import a certificate and its key into the Keychain",
+		UsageText: `**step crypto keychain import** <uri> <crt_file> [<key_file>]
+[**--password-file**=<file>]`,
+		Description: `**step crypto keychain import** imports a certificate, and optionally its
+private key, into the macOS Keychain with the label in the given URI. A
+previous certificate with the same label is replaced.
+
+## POSITIONAL ARGUMENTS
+
+<uri>
+:  The Keychain URI, e.g. 'keychain:label=internal.example.com'.
+
+<crt_file>
+:  The path to the certificate to import.
+
+<key_file>
+:  The path to the private key to import. If the key is already in the Keychain
+it must not be given.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Import a certificate and its key:
+'''
+$ step crypto keychain import keychain:label=internal.example.com internal.crt internal.key
+'''
+
+Import only the certificate, the key is already in the Keychain:
+'''
+$ step crypto keychain import keychain:label=internal.example.com internal.crt
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the private key.`,
+			},
+		},
+	}
+}
+
+func importAction(ctx *cli.Context) error {
+	switch ctx.NArg() {
+	case 0, 1:
+		return errs.TooFewArguments(ctx)
+	case 2, 3:
+	default:
+		return errs.TooManyArguments(ctx)
+	}
+
+	args := ctx.Args()
+	rawuri, crtFile, keyFile := args.Get(0), args.Get(1), args.Get(2)
+	if _, err := keychain.ParseURI(rawuri); err != nil {
+		return err
+	}
+	if keyFile == "" && ctx.IsSet("password-file") {
+		return errors.New("flag '--password-file' requires the <key_file> argument")
+	}
+
+	crt, err := pemutil.ReadCertificate(crtFile)
+	if err != nil {
+		return err
+	}
+
+	if keyFile != "" {
+		var opts []pemutil.Options
+		if passFile := ctx.String("password-file"); passFile != "" {
+			opts = append(opts, pemutil.WithPasswordFile(passFile))
+		}
+		key, err := pemutil.Read(keyFile, opts...)
+		if err != nil {
+			return err
+		}
+		if err := keychain.ImportKey(rawuri, key); err != nil {
+			return err
+		}
+	}
+	if err := keychain.ImportCertificate(rawuri, crt); err != nil {
+		return err
+	}
+
+	ui.Printf("Your certificate has been imported into %s.\n", rawuri)
+	return nil
+}
@@ -0,0 +1,45 @@
+package keychain
+
+import (
+	"github.com/urfave/cli"
+)
+
+// Command returns the cli.Command for keychain and related subcommands.
+func Command() cli.Command {
+	return cli.Command{
+		Name:      "keychain",
+		Usage:     "manage keys and certificates in the macOS Keychain",
+		UsageText: "step crypto keychain <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step crypto keychain** command group provides facilities to import and
+delete keys and certificates in the macOS Keychain.
+
+Keys and certificates in the Keychain are identified by a Keychain URI like
+'keychain:label=<label>'. A key and a certificate with the same label form an
+identity that can be used with **step ca renew**. Keys created in the Secure
+Enclave use the URI 'keychain:label=<label>;se=true', they can be created with
+**step ca certificate** but they cannot be imported.
+
+## EXAMPLES
+
+Import a certificate and its key into the Keychain:
+'''
+$ step crypto keychain import keychain:label=internal.example.com internal.crt internal.key
+'''
+
+Request a certificate with a key in the Secure Enclave, and renew it:
+'''
+$ step ca certificate internal.example.com internal.crt 'keychain:label=internal.example.com;se=true'
+
+$ step ca renew 'keychain:label=internal.example.com;se=true'
+'''
+
+Delete a certificate and its key from the Keychain:
+'''
+$ step crypto keychain delete keychain:label=internal.example.com
+'''`,
+		Subcommands: cli.Commands{
+			importCommand(),
+			deleteCommand(),
+		},
+	}
+}
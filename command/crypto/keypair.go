@@ -20,14 +20,20 @@ func createKeyPairCommand() cli.Command {
 		Usage:  "generate a public / private keypair in PEM format",
 		UsageText: `**step crypto keypair** <pub_file> <priv_file>
 [**--kty**=<key-type>] [**--curve**=<curve>] [**--size**=<size>]
-[**--password-file**=<file>] [**--no-password**]`,
+[**--password-file**=<file>] [**--password-gen**[=<length>]] [**--no-password**]
+[**--pkcs8**]`,
 		Description: `**step crypto keypair** generates a raw public /
 private keypair in PEM format. These keys can be used by other operations
 to sign and encrypt data, and the public key can be bound to an identity
 in a CSR and signed by a CA to produce a certificate.
 
 Private keys are encrypted using a password. You'll be prompted for this
-password automatically when the key is used.
+password automatically when the key is used. The password can also be read
+from a file using **--password-file**, or a random passphrase can be generated
+with **--password-gen**. By default, RSA and EC private keys are encrypted
+using the PEM encryption described in RFC 1423 with AES-256-CBC; use
+**--pkcs8** to encode and encrypt them using PKCS#8 and PBES2 instead, the
+format used by **openssl genpkey**.
 
 ## POSITIONAL ARGUMENTS
 
@@ -74,6 +80,22 @@ Create an Octet Key Pair with curve Ed25519:
 '''
 $ step crypto keypair foo.pub foo.key --kty OKP --curve Ed25519
 '''
+
+Create an RSA public / private key pair with the private key encoded as an
+encrypted PKCS#8, using a password stored in a file:
+
+'''
+$ step crypto keypair foo.pub foo.key --kty RSA --pkcs8 \
+--password-file password.txt
+'''
+
+Create a key pair encrypted with a random passphrase of 8 words, and write the
+passphrase to a file:
+
+'''
+$ step crypto keypair foo.pub foo.key --password-gen=8 \
+--password-file password.txt
+'''
 `,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -96,8 +118,8 @@ If unset, default is EC.
 			},
 			cli.IntFlag{
 				Name: "size",
-				Usage: `The <size> (in bits) of the key for RSA and oct key types. RSA keys require a
-minimum key size of 2048 bits. If unset, default is 2048 bits for RSA keys and 128 bits for oct keys.`,
+				Usage: `The <size> (in bits) of the key for RSA key types. RSA keys require a
+minimum key size of 2048 bits. If unset, default is 2048 bits.`,
 			},
 			cli.StringFlag{
 				Name: "crv, curve",
@@ -124,8 +146,15 @@ unset, default is P-256 for EC keys and Ed25519 for OKP keys.
 				Name: "from-jwk",
 				Usage: `Create a PEM representing the key encoded in an
 existing <jwk-file> instead of creating a new key.`,
+			},
+			cli.BoolFlag{
+				Name: "pkcs8",
+				Usage: `Encodes RSA and EC private keys using PKCS#8. If the private key is encrypted
+it will be encoded as a PKCS#8 **ENCRYPTED PRIVATE KEY** using PBES2. Ed25519
+private keys always use PKCS#8.`,
 			},
 			flags.PasswordFile,
+			flags.PasswordGen,
 			flags.NoPassword,
 			flags.Insecure,
 			flags.Force,
@@ -150,19 +179,13 @@ func createAction(ctx *cli.Context) (err error) {
 	if noPass && len(passwordFile) > 0 {
 		return errs.IncompatibleFlag(ctx, "no-password", "password-file")
 	}
+	if noPass && ctx.IsSet("password-gen") {
+		return errs.IncompatibleFlag(ctx, "no-password", "password-gen")
+	}
 	if noPass && !insecure {
 		return errs.RequiredWithFlag(ctx, "insecure", "no-password")
 	}
 
-	// Read password if necessary
-	var password string
-	if len(passwordFile) > 0 {
-		password, err = utils.ReadStringPasswordFromFile(passwordFile)
-		if err != nil {
-			return err
-		}
-	}
-
 	var pub, priv interface{}
 	fromJWK := ctx.String("from-jwk")
 	if len(fromJWK) > 0 {
@@ -199,7 +222,7 @@ func createAction(ctx *cli.Context) (err error) {
 		}
 	}
 
-	_, err = pemutil.Serialize(pub, pemutil.ToFile(pubFile, 0600))
+	_, err = pemutil.Serialize(pub, pemutil.ToFile(pubFile, 0644))
 	if err != nil {
 		return err
 	}
@@ -211,21 +234,23 @@ func createAction(ctx *cli.Context) (err error) {
 		return nil
 	}
 
-	if noPass {
-		_, err = pemutil.Serialize(priv, pemutil.ToFile(privFile, 0600))
+	opts := []pemutil.Options{
+		pemutil.WithPKCS8(ctx.Bool("pkcs8")),
+		pemutil.ToFile(privFile, 0600),
+	}
+	if !noPass {
+		password, err := utils.GetNewPasswordFromCLI(ctx, "password-file")
 		if err != nil {
 			return err
 		}
-	} else {
-		pass, err := ui.PromptPassword("Please enter the password to encrypt the private key", ui.WithValue(password))
+		pass, err := ui.PromptPassword("Please enter the password to encrypt the private key", ui.WithValue(password), ui.WithFlag("password-file"), ui.WithValidateEntropy())
 		if err != nil {
 			return errors.Wrap(err, "error reading password")
 		}
-		_, err = pemutil.Serialize(priv, pemutil.WithPassword(pass),
-			pemutil.ToFile(privFile, 0600))
-		if err != nil {
-			return err
-		}
+		opts = append(opts, pemutil.WithPassword(pass))
+	}
+	if _, err = pemutil.Serialize(priv, opts...); err != nil {
+		return err
 	}
 
 	ui.Printf("Your public key has been saved in %s.\n", pubFile)
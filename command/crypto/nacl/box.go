@@ -2,9 +2,7 @@ package nacl
 
 import (
 	"crypto/rand"
-	"fmt"
 	"io/ioutil"
-	"os"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
@@ -84,6 +82,26 @@ private key and validates the message from Bob using his public key:
 '''
 $ echo 0oM0A6xIezA6iMYssZECmbMRQh77mzDt | step crypto nacl box open nonce bob.box.pub alice.box.priv
 message
+'''
+
+Bob encrypts a message using a random nonce, the nonce is prepended to the
+output and Alice does not need it to open the box:
+'''
+$ echo message | step crypto nacl box seal alice.box.pub bob.box.priv
+5I8HutwpybWpAGD7QOFHmYNOBcL9PpbgvSV5kfwMJtXcp1QPyIXx6jBHdGpC0DA
+
+$ echo 5I8HutwpybWpAGD7QOFHmYNOBcL9PpbgvSV5kfwMJtXcp1QPyIXx6jBHdGpC0DA \
+     | step crypto nacl box open bob.box.pub alice.box.priv
+message
+'''
+
+Bob encrypts a large file for Alice in chunks of 64KiB:
+'''
+$ step crypto nacl box seal --raw --chunk-size 65536 alice.box.pub bob.box.priv \
+     < backup.tar > backup.tar.box
+
+$ step crypto nacl box open --raw --chunk-size 65536 bob.box.pub alice.box.priv \
+     < backup.tar.box > backup.tar
 '''`,
 		Subcommands: cli.Commands{
 			boxKeypairCommand(),
@@ -122,8 +140,8 @@ func boxOpenCommand() cli.Command {
 		Name:   "open",
 		Action: cli.ActionFunc(boxOpenAction),
 		Usage:  "authenticate and decrypt a box produced by seal",
-		UsageText: `**step crypto nacl box open** <nonce> <sender-pub-key> <priv-key>
-		[--raw]`,
+		UsageText: `**step crypto nacl box open** [<nonce>] <sender-pub-key> <priv-key>
+		[--raw] [--chunk-size=<bytes>]`,
 		Description: `Authenticate and decrypt a box produced by seal using the specified KEY. If
 PRIV_KEY is encrypted you will be prompted for the password. The sealed box is
 read from STDIN and the decrypted plaintext is written to STDOUT.
@@ -135,7 +153,8 @@ For examples, see **step help crypto nacl box**.
 ## POSITIONAL ARGUMENTS
 
 <nonce>
-:  The nonce provided when the box was sealed.
+:  The nonce provided when the box was sealed. If omitted, the nonce is read
+from the beginning of the input.
 
 <sender-pub-key>
 :  The path to the public key of the peer that produced the sealed box.
@@ -147,6 +166,7 @@ For examples, see **step help crypto nacl box**.
 				Name:  "raw",
 				Usage: "Indicates that input is not base64 encoded",
 			},
+			chunkSizeFlag,
 		},
 	}
 }
@@ -156,8 +176,8 @@ func boxSealCommand() cli.Command {
 		Name:   "seal",
 		Action: cli.ActionFunc(boxSealAction),
 		Usage:  "produce an authenticated and encrypted ciphertext",
-		UsageText: `**step crypto nacl box seal** <nonce> <recipient-pub-key> <priv-key>
-		[--raw]`,
+		UsageText: `**step crypto nacl box seal** [<nonce>] <recipient-pub-key> <priv-key>
+		[--raw] [--chunk-size=<bytes>]`,
 		Description: `Reads plaintext from STDIN and writes an encrypted and authenticated
 ciphertext to STDOUT. The "box" can be open by the a recipient who has access
 to the private key corresponding to <recipient-pub-key>.
@@ -169,7 +189,10 @@ For examples, see **step help crypto nacl box**.
 ## POSITIONAL ARGUMENTS
 
 <nonce>
-:  Must be unique for each distinct message for a given pair of keys.
+:  Must be unique for each distinct message for a given pair of keys. If
+omitted, a random nonce is generated and prepended to the output. With
+**--chunk-size** the nonce cannot be longer than 16 bytes, the remaining bytes
+are used to number the chunks.
 
 <recipient-pub-key>
 :  The path to the public key of the intended recipient of the sealed box.
@@ -181,6 +204,7 @@ For examples, see **step help crypto nacl box**.
 				Name:  "raw",
 				Usage: "Do not base64 encode output",
 			},
+			chunkSizeFlag,
 		},
 	}
 }
@@ -215,111 +239,67 @@ func boxKeypairAction(ctx *cli.Context) error {
 }
 
 func boxOpenAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 3); err != nil {
-		return err
-	}
-
-	args := ctx.Args()
-	nonce, pubFile, privFile := []byte(args[0]), args[1], args[2]
-
-	if len(nonce) > 24 {
-		return errors.New("nonce cannot be longer than 24 bytes")
-	}
-
-	pub, err := ioutil.ReadFile(pubFile)
+	nonce, sharedKey, err := boxArgs(ctx)
 	if err != nil {
-		return errs.FileError(err, pubFile)
-	} else if len(pub) != 32 {
-		return errors.New("invalid public key: key size is not 32 bytes")
+		return err
 	}
 
-	priv, err := ioutil.ReadFile(privFile)
-	if err != nil {
-		return errs.FileError(err, privFile)
-	} else if len(priv) != 32 {
-		return errors.New("invalid private key: key size is not 32 bytes")
-	}
+	return openInput(ctx, nonce, func(out, b []byte, nonce *[nonceSize]byte) ([]byte, bool) {
+		return box.OpenAfterPrecomputation(out, b, nonce, sharedKey)
+	})
+}
 
-	input, err := utils.ReadAll(os.Stdin)
+func boxSealAction(ctx *cli.Context) error {
+	nonce, sharedKey, err := boxArgs(ctx)
 	if err != nil {
-		return errs.Wrap(err, "error reading input")
-	}
-
-	var rawInput []byte
-	if ctx.Bool("raw") {
-		rawInput = input
-	} else {
-		// DecodeLen returns the maximum length,
-		// Decode will return the actual length.
-		rawInput = make([]byte, b64Encoder.DecodedLen(len(input)))
-		n, err := b64Encoder.Decode(rawInput, input)
-		if err != nil {
-			return errors.Wrap(err, "error decoding base64 input")
-		}
-		rawInput = rawInput[:n]
-	}
-
-	var n [24]byte
-	var pb, pv [32]byte
-	copy(n[:], nonce)
-	copy(pb[:], pub)
-	copy(pv[:], priv)
-
-	// Fixme: if we prepend the nonce in the seal we can use use rawInput[24:]
-	// as the message and rawInput[:24] as the nonce instead of requiring one.
-	raw, ok := box.Open(nil, rawInput, &n, &pb, &pv)
-	if !ok {
-		return errors.New("error authenticating or decrypting input")
+		return err
 	}
 
-	os.Stdout.Write(raw)
-	return nil
+	return sealInput(ctx, nonce, func(out, message []byte, nonce *[nonceSize]byte) []byte {
+		return box.SealAfterPrecomputation(out, message, nonce, sharedKey)
+	})
 }
 
-func boxSealAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 3); err != nil {
-		return err
-	}
+// boxArgs returns the nonce in the positional arguments and the shared key
+// computed from the peer's public key and the private key. The returned nonce
+// is nil if it is not present.
+func boxArgs(ctx *cli.Context) ([]byte, *[32]byte, error) {
+	var nonce []byte
+	var pubFile, privFile string
 
 	args := ctx.Args()
-	nonce, pubFile, privFile := []byte(args[0]), args[1], args[2]
-
-	if len(nonce) > 24 {
-		return errors.New("nonce cannot be longer than 24 bytes")
+	switch ctx.NArg() {
+	case 0, 1:
+		return nil, nil, errs.TooFewArguments(ctx)
+	case 2:
+		pubFile, privFile = args[0], args[1]
+	case 3:
+		var err error
+		if nonce, err = parseNonce(ctx, args[0]); err != nil {
+			return nil, nil, err
+		}
+		pubFile, privFile = args[1], args[2]
+	default:
+		return nil, nil, errs.TooManyArguments(ctx)
 	}
 
 	pub, err := ioutil.ReadFile(pubFile)
 	if err != nil {
-		return errs.FileError(err, pubFile)
+		return nil, nil, errs.FileError(err, pubFile)
 	} else if len(pub) != 32 {
-		return errors.New("invalid public key: key size is not 32 bytes")
+		return nil, nil, errors.New("invalid public key: key size is not 32 bytes")
 	}
 
 	priv, err := ioutil.ReadFile(privFile)
 	if err != nil {
-		return errs.FileError(err, privFile)
+		return nil, nil, errs.FileError(err, privFile)
 	} else if len(priv) != 32 {
-		return errors.New("invalid private key: key size is not 32 bytes")
-	}
-
-	input, err := utils.ReadInput("Please enter text to seal")
-	if err != nil {
-		return errors.Wrap(err, "error reading input")
+		return nil, nil, errors.New("invalid private key: key size is not 32 bytes")
 	}
 
-	var n [24]byte
-	var pb, pv [32]byte
-	copy(n[:], nonce)
+	var pb, pv, sharedKey [32]byte
 	copy(pb[:], pub)
 	copy(pv[:], priv)
-
-	// Fixme: we can prepend nonce[:] so it's not necessary in the open.
-	raw := box.Seal(nil, input, &n, &pb, &pv)
-	if ctx.Bool("raw") {
-		os.Stdout.Write(raw)
-	} else {
-		fmt.Println(b64Encoder.EncodeToString(raw))
-	}
-
-	return nil
+	box.Precompute(&sharedKey, &pb, &pv)
+	return nonce, &sharedKey, nil
 }
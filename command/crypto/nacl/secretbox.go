@@ -1,13 +1,10 @@
 package nacl
 
 import (
-	"fmt"
 	"io/ioutil"
-	"os"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/errs"
-	"github.com/smallstep/cli/utils"
 	"github.com/urfave/cli"
 	"golang.org/x/crypto/nacl/secretbox"
 )
@@ -56,6 +53,26 @@ Decrypt and authenticate the message:
 '''
 $ echo o2NJTsIJsk0dl4epiBwS1mM4xFED7iE | step crypto nacl secretbox open nonce secretbox.key
 message
+'''
+
+Encrypt a message using a random nonce, the nonce is prepended to the output
+and it is not required to open the box:
+'''
+$ cat message.txt | step crypto nacl secretbox seal secretbox.key
+QuyhM7mJB1J7j0pCK9eDCvSI0eH0eaEbs-2bVdw8RQfpacLoE8AIdaLCGYt6TO8
+
+$ echo QuyhM7mJB1J7j0pCK9eDCvSI0eH0eaEbs-2bVdw8RQfpacLoE8AIdaLCGYt6TO8 \
+     | step crypto nacl secretbox open secretbox.key
+message
+'''
+
+Encrypt and decrypt a large file in chunks of 64KiB:
+'''
+$ step crypto nacl secretbox seal --raw --chunk-size 65536 secretbox.key \
+     < backup.tar > backup.tar.box
+
+$ step crypto nacl secretbox open --raw --chunk-size 65536 secretbox.key \
+     < backup.tar.box > backup.tar
 '''`,
 		Subcommands: cli.Commands{
 			secretboxOpenCommand(),
@@ -69,19 +86,30 @@ func secretboxOpenCommand() cli.Command {
 		Name:   "open",
 		Action: cli.ActionFunc(secretboxOpenAction),
 		Usage:  "authenticate and decrypt a box produced by seal",
-		UsageText: `**step crypto nacl secretbox open** <nonce> <key-file>
-		[--raw]`,
+		UsageText: `**step crypto nacl secretbox open** [<nonce>] <key-file>
+		[--raw] [--chunk-size=<bytes>]`,
 		Description: `**step crypto nacl secretbox open** verifies and decrypts a ciphertext using a
-secret key and a nonce.
+secret key and a nonce. The ciphertext is read from STDIN and the plaintext is
+written to STDOUT.
 
 This command uses an implementation of NaCl's crypto_secretbox_open function.
 
-For examples, see **step help crypto nacl secretbox**.`,
+For examples, see **step help crypto nacl secretbox**.
+
+## POSITIONAL ARGUMENTS
+
+<nonce>
+:  The nonce provided when the box was sealed. If omitted, the nonce is read
+from the beginning of the input.
+
+<key-file>
+:  The path to the file with the 32 bytes secret key.`,
 		Flags: []cli.Flag{
 			cli.BoolFlag{
 				Name:  "raw",
 				Usage: "Indicates that input is not base64 encoded",
 			},
+			chunkSizeFlag,
 		},
 	}
 }
@@ -91,113 +119,87 @@ func secretboxSealCommand() cli.Command {
 		Name:   "seal",
 		Action: cli.ActionFunc(secretboxSealAction),
 		Usage:  "produce an encrypted ciphertext",
-		UsageText: `**step crypto nacl secretbox seal** <nonce> <key-file>
-		[--raw]`,
+		UsageText: `**step crypto nacl secretbox seal** [<nonce>] <key-file>
+		[--raw] [--chunk-size=<bytes>]`,
 		Description: `**step crypto nacl secretbox seal** encrypts and authenticates a message using
 a secret key and a nonce.
 
 This command uses an implementation of NaCl's crypto_secretbox function.
 
-For examples, see **step help crypto nacl secretbox**.`,
+For examples, see **step help crypto nacl secretbox**.
+
+## POSITIONAL ARGUMENTS
+
+<nonce>
+:  Must be unique for each distinct message for a given key. If omitted, a
+random nonce is generated and prepended to the output. With **--chunk-size** the
+nonce cannot be longer than 16 bytes, the remaining bytes are used to number
+the chunks.
+
+<key-file>
+:  The path to the file with the 32 bytes secret key.`,
 		Flags: []cli.Flag{
 			cli.BoolFlag{
 				Name:  "raw",
 				Usage: "Do not base64 encode output",
 			},
+			chunkSizeFlag,
 		},
 	}
 }
 
 func secretboxOpenAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 2); err != nil {
-		return err
-	}
-
-	args := ctx.Args()
-	nonce, keyFile := []byte(args[0]), args[1]
-
-	if len(nonce) > 24 {
-		return errors.New("nonce cannot be longer than 24 bytes")
-	}
-
-	key, err := ioutil.ReadFile(keyFile)
+	nonce, key, err := secretboxArgs(ctx)
 	if err != nil {
-		return errs.FileError(err, keyFile)
-	} else if len(key) != 32 {
-		return errors.New("invalid key file: key size is not 32 bytes")
-	}
-
-	input, err := utils.ReadAll(os.Stdin)
-	if err != nil {
-		return errors.Wrap(err, "error reading input")
-	}
-
-	var rawInput []byte
-	if ctx.Bool("raw") {
-		rawInput = input
-	} else {
-		// DecodeLen returns the maximum length,
-		// Decode will return the actual length.
-		rawInput = make([]byte, b64Encoder.DecodedLen(len(input)))
-		n, err := b64Encoder.Decode(rawInput, input)
-		if err != nil {
-			return errors.Wrap(err, "error decoding base64 input")
-		}
-		rawInput = rawInput[:n]
-	}
-
-	var n [24]byte
-	var k [32]byte
-	copy(n[:], nonce)
-	copy(k[:], key)
-
-	// Fixme: if we prepend the nonce in the seal we can use use rawInput[24:]
-	// as the message and rawInput[:24] as the nonce instead of requiring one.
-	raw, ok := secretbox.Open(nil, rawInput, &n, &k)
-	if !ok {
-		return errors.New("error authenticating or decrypting input")
+		return err
 	}
 
-	os.Stdout.Write(raw)
-	return nil
+	return openInput(ctx, nonce, func(out, box []byte, nonce *[nonceSize]byte) ([]byte, bool) {
+		return secretbox.Open(out, box, nonce, key)
+	})
 }
 
 func secretboxSealAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+	nonce, key, err := secretboxArgs(ctx)
+	if err != nil {
 		return err
 	}
 
-	args := ctx.Args()
-	nonce, keyFile := []byte(args[0]), args[1]
+	return sealInput(ctx, nonce, func(out, message []byte, nonce *[nonceSize]byte) []byte {
+		return secretbox.Seal(out, message, nonce, key)
+	})
+}
 
-	if len(nonce) > 24 {
-		return errors.New("nonce cannot be longer than 24 bytes")
-	}
+// secretboxArgs returns the nonce and the key in the positional arguments. The
+// returned nonce is nil if it is not present.
+func secretboxArgs(ctx *cli.Context) ([]byte, *[32]byte, error) {
+	var nonce []byte
+	var keyFile string
 
-	key, err := ioutil.ReadFile(keyFile)
-	if err != nil {
-		return errs.FileError(err, keyFile)
-	} else if len(key) != 32 {
-		return errors.New("invalid key: key size is not 32 bytes")
+	args := ctx.Args()
+	switch ctx.NArg() {
+	case 0:
+		return nil, nil, errs.TooFewArguments(ctx)
+	case 1:
+		keyFile = args[0]
+	case 2:
+		var err error
+		if nonce, err = parseNonce(ctx, args[0]); err != nil {
+			return nil, nil, err
+		}
+		keyFile = args[1]
+	default:
+		return nil, nil, errs.TooManyArguments(ctx)
 	}
 
-	input, err := utils.ReadInput("Please enter text to seal")
+	b, err := ioutil.ReadFile(keyFile)
 	if err != nil {
-		return errors.Wrap(err, "error reading input")
-	}
-
-	var n [24]byte
-	var k [32]byte
-	copy(n[:], nonce)
-	copy(k[:], key)
-
-	// Fixme: we can prepend nonce[:] so it's not necessary in the open.
-	raw := secretbox.Seal(nil, input, &n, &k)
-	if ctx.Bool("raw") {
-		os.Stdout.Write(raw)
-	} else {
-		fmt.Println(b64Encoder.EncodeToString(raw))
+		return nil, nil, errs.FileError(err, keyFile)
+	} else if len(b) != 32 {
+		return nil, nil, errors.New("invalid key file: key size is not 32 bytes")
 	}
 
-	return nil
+	var key [32]byte
+	copy(key[:], b)
+	return nonce, &key, nil
 }
@@ -0,0 +1,251 @@
+package nacl
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/randutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	// nonceSize is the size of the nonce used by crypto_box and
+	// crypto_secretbox.
+	nonceSize = 24
+	// noncePrefixSize is the size of the nonce prefix used when a message is
+	// sealed in chunks. The last 8 bytes of the nonce are used for the chunk
+	// counter and the final chunk flag.
+	noncePrefixSize = 16
+	// finalChunk is the flag set in the counter of the last chunk.
+	finalChunk = uint64(1) << 63
+	// overhead is the number of bytes added to each sealed message, it is the
+	// same in crypto_box and crypto_secretbox.
+	overhead = secretbox.Overhead
+)
+
+// sealFunc seals a message using the given nonce and appends the result to out.
+type sealFunc func(out, message []byte, nonce *[nonceSize]byte) []byte
+
+// openFunc authenticates and decrypts a box using the given nonce and appends
+// the result to out.
+type openFunc func(out, box []byte, nonce *[nonceSize]byte) ([]byte, bool)
+
+var chunkSizeFlag = cli.IntFlag{
+	Name: "chunk-size",
+	Usage: `Seal or open the input in chunks of <bytes>, so large files can be streamed
+without being read into memory. The same value must be used to seal and open a
+message. The input is read from STDIN. When a message is opened, each chunk is
+authenticated before it is written, if a chunk fails to authenticate the command
+fails but the previous chunks may have already been written.`,
+}
+
+// parseNonce validates the nonce in the positional arguments. The nonce is
+// limited to the prefix size if the message is sealed in chunks.
+func parseNonce(ctx *cli.Context, s string) ([]byte, error) {
+	nonce := []byte(s)
+	switch {
+	case ctx.Int("chunk-size") > 0 && len(nonce) > noncePrefixSize:
+		return nil, errors.Errorf("nonce cannot be longer than %d bytes with '--chunk-size'", noncePrefixSize)
+	case len(nonce) > nonceSize:
+		return nil, errors.Errorf("nonce cannot be longer than %d bytes", nonceSize)
+	}
+	return nonce, nil
+}
+
+// chunkNonce returns the nonce used to seal the chunk with the given counter.
+func chunkNonce(prefix []byte, counter uint64, final bool) *[nonceSize]byte {
+	var n [nonceSize]byte
+	copy(n[:], prefix)
+	if final {
+		counter |= finalChunk
+	}
+	binary.BigEndian.PutUint64(n[noncePrefixSize:], counter)
+	return &n
+}
+
+// sealInput seals the input using the given function and nonce. If the nonce
+// is nil a random one is generated and prepended to the output.
+func sealInput(ctx *cli.Context, nonce []byte, seal sealFunc) error {
+	chunkSize := ctx.Int("chunk-size")
+	if chunkSize < 0 {
+		return errs.InvalidFlagValue(ctx, "chunk-size", ctx.String("chunk-size"), "")
+	}
+
+	isRandom := (nonce == nil)
+	if isRandom {
+		size := nonceSize
+		if chunkSize > 0 {
+			size = noncePrefixSize
+		}
+		var err error
+		if nonce, err = randutil.Salt(size); err != nil {
+			return errors.Wrap(err, "error generating nonce")
+		}
+	}
+
+	if chunkSize > 0 {
+		var w io.Writer = os.Stdout
+		if !ctx.Bool("raw") {
+			enc := base64.NewEncoder(b64Encoder, os.Stdout)
+			defer fmt.Println()
+			defer enc.Close()
+			w = enc
+		}
+		if isRandom {
+			if _, err := w.Write(nonce); err != nil {
+				return errors.Wrap(err, "error writing output")
+			}
+		}
+		return sealStream(w, os.Stdin, nonce, chunkSize, seal)
+	}
+
+	input, err := utils.ReadInput("Please enter text to seal")
+	if err != nil {
+		return errors.Wrap(err, "error reading input")
+	}
+
+	var n [nonceSize]byte
+	copy(n[:], nonce)
+
+	var out []byte
+	if isRandom {
+		out = append(out, n[:]...)
+	}
+	raw := seal(out, input, &n)
+	if ctx.Bool("raw") {
+		os.Stdout.Write(raw)
+	} else {
+		fmt.Println(b64Encoder.EncodeToString(raw))
+	}
+
+	return nil
+}
+
+// openInput authenticates and decrypts the input using the given function and
+// nonce. If the nonce is nil it is read from the beginning of the input.
+func openInput(ctx *cli.Context, nonce []byte, open openFunc) error {
+	chunkSize := ctx.Int("chunk-size")
+	if chunkSize < 0 {
+		return errs.InvalidFlagValue(ctx, "chunk-size", ctx.String("chunk-size"), "")
+	}
+
+	if chunkSize > 0 {
+		var r io.Reader = os.Stdin
+		if !ctx.Bool("raw") {
+			r = base64.NewDecoder(b64Encoder, os.Stdin)
+		}
+		if nonce == nil {
+			nonce = make([]byte, noncePrefixSize)
+			if _, err := io.ReadFull(r, nonce); err != nil {
+				return errors.Wrap(err, "error reading nonce")
+			}
+		}
+		return openStream(os.Stdout, r, nonce, chunkSize, open)
+	}
+
+	input, err := utils.ReadAll(os.Stdin)
+	if err != nil {
+		return errors.Wrap(err, "error reading input")
+	}
+
+	var rawInput []byte
+	if ctx.Bool("raw") {
+		rawInput = input
+	} else {
+		// DecodeLen returns the maximum length,
+		// Decode will return the actual length.
+		rawInput = make([]byte, b64Encoder.DecodedLen(len(input)))
+		n, err := b64Encoder.Decode(rawInput, input)
+		if err != nil {
+			return errors.Wrap(err, "error decoding base64 input")
+		}
+		rawInput = rawInput[:n]
+	}
+
+	if nonce == nil {
+		if len(rawInput) < nonceSize {
+			return errors.New("error reading nonce: input is too short")
+		}
+		nonce, rawInput = rawInput[:nonceSize], rawInput[nonceSize:]
+	}
+
+	var n [nonceSize]byte
+	copy(n[:], nonce)
+
+	raw, ok := open(nil, rawInput, &n)
+	if !ok {
+		return errors.New("error authenticating or decrypting input")
+	}
+
+	os.Stdout.Write(raw)
+	return nil
+}
+
+// sealStream reads chunks of chunkSize bytes from r and writes them sealed to
+// w. Each chunk is sealed with a nonce composed by the prefix and the chunk
+// counter, the last one is marked as final so truncated streams are detected.
+func sealStream(w io.Writer, r io.Reader, prefix []byte, chunkSize int, seal sealFunc) error {
+	br := bufio.NewReader(r)
+	buf := make([]byte, chunkSize)
+	out := make([]byte, 0, chunkSize+overhead)
+	for counter := uint64(0); ; counter++ {
+		if counter == finalChunk {
+			return errors.New("error sealing input: too many chunks")
+		}
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Wrap(err, "error reading input")
+		}
+		final := (err != nil)
+		if !final {
+			if _, err := br.Peek(1); err == io.EOF {
+				final = true
+			}
+		}
+		if _, err := w.Write(seal(out, buf[:n], chunkNonce(prefix, counter, final))); err != nil {
+			return errors.Wrap(err, "error writing output")
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// openStream reads the chunks sealed by sealStream from r and writes the
+// plaintext to w. Each chunk is authenticated before it is written.
+func openStream(w io.Writer, r io.Reader, prefix []byte, chunkSize int, open openFunc) error {
+	br := bufio.NewReader(r)
+	buf := make([]byte, chunkSize+overhead)
+	out := make([]byte, 0, chunkSize)
+	for counter := uint64(0); counter < finalChunk; counter++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Wrap(err, "error reading input")
+		}
+		final := (err != nil)
+		if !final {
+			if _, err := br.Peek(1); err == io.EOF {
+				final = true
+			}
+		}
+		raw, ok := open(out, buf[:n], chunkNonce(prefix, counter, final))
+		if !ok {
+			return errors.New("error authenticating or decrypting input")
+		}
+		if _, err := w.Write(raw); err != nil {
+			return errors.Wrap(err, "error writing output")
+		}
+		if final {
+			return nil
+		}
+	}
+	return errors.New("error opening input: too many chunks")
+}
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"image/png"
+	"net/url"
+	"strconv"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
 	"github.com/pquerna/otp/totp"
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/errs"
@@ -17,11 +21,26 @@ import (
 
 func generateCommand() cli.Command {
 	return cli.Command{
-		Name:        "generate",
-		Action:      command.ActionFunc(generateAction),
-		Usage:       "generate a one-time password",
-		UsageText:   `**step crypto otp generate**`,
-		Description: `**step crypto otp generate** does TOTP and HTOP`,
+		Name:   "generate",
+		Action: command.ActionFunc(generateAction),
+		Usage:  "generate a one-time password",
+		UsageText: `**step crypto otp generate** **--issuer**=<name> **--account**=<name>
+[**--period**=<seconds>] [**--length**=<size>] [**--secret-size**=<bytes>]
+[**--alg**=<algorithm>] [**--hotp**] [**--counter**=<number>] [**--url**]
+[**--qr**=<file>] [**--force**]`,
+		Description: `**step crypto otp generate** generates a new secret for time-based one-time
+passwords (TOTP, RFC 6238) or, with **--hotp**, for HMAC-based one-time
+passwords (HOTP, RFC 4226).
+
+By default, the secret is printed to STDOUT encoded in base32. With **--url**
+the command prints an otpauth:// Key URI with the secret and all the
+parameters, and with **--qr** it writes a QR code with the same URI that can
+be scanned with an authenticator application.
+
+The secret must be kept secure, the QR code is written with restricted
+permissions.
+
+For examples, see **step help crypto otp**.`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "issuer, iss",
@@ -35,17 +54,18 @@ address)`,
 			cli.IntFlag{
 				Name: "period",
 				Usage: `Number of seconds a TOTP hash is valid. Defaults to 30
-seconds.`,
+seconds. It cannot be used with **--hotp**.`,
 				Value: 30,
 			},
 			cli.IntFlag{
 				Name:  "length, digits",
-				Usage: `Length of one-time passwords. Defaults to 6.`,
+				Usage: `Length of one-time passwords. Must be 6 or 8. Defaults to 6.`,
 				Value: 6,
 			},
 			cli.IntFlag{
-				Name:  "secret-size",
-				Usage: `Size of generated TOTP secret. Defaults to 20.`,
+				Name: "secret-size",
+				Usage: `Size in bytes of generated secret. Defaults to 20. Sizes smaller than 16
+bytes require **--insecure**.`,
 				Value: 20,
 			},
 			cli.StringFlag{
@@ -54,15 +74,28 @@ seconds.`,
 one of: SHA1, SHA256, SHA512`,
 				Value: "SHA1",
 			},
+			cli.BoolFlag{
+				Name:  "hotp",
+				Usage: `Generate a secret for HOTP instead of TOTP.`,
+			},
+			cli.IntFlag{
+				Name: "counter",
+				Usage: `The initial <number> of the HOTP counter added to the Key URI. Defaults
+to 0. Requires **--hotp**.`,
+			},
 			cli.BoolFlag{
 				Name: "url",
-				Usage: `Output a TOTP Key URI. See
+				Usage: `Output a TOTP or HOTP Key URI. See
 https://github.com/google/google-authenticator/wiki/Key-Uri-Format`,
 			},
 			cli.StringFlag{
 				Name:  "qr",
 				Usage: `Write a QR code to the specified path`,
 			},
+			cli.BoolFlag{
+				Name:   "insecure",
+				Hidden: true,
+			},
 			flags.Force,
 		},
 	}
@@ -74,6 +107,18 @@ func generateAction(ctx *cli.Context) error {
 		return errs.RequiredFlag(ctx, "issuer")
 	case len(ctx.String("account")) == 0:
 		return errs.RequiredFlag(ctx, "account")
+	case ctx.Bool("hotp") && ctx.IsSet("period"):
+		return errs.IncompatibleFlagWithFlag(ctx, "hotp", "period")
+	case !ctx.Bool("hotp") && ctx.IsSet("counter"):
+		return errs.RequiredWithFlag(ctx, "hotp", "counter")
+	case ctx.Int("period") <= 0:
+		return errs.InvalidFlagValue(ctx, "period", ctx.String("period"), "")
+	case ctx.Int("counter") < 0:
+		return errs.InvalidFlagValue(ctx, "counter", ctx.String("counter"), "")
+	case ctx.Int("secret-size") <= 0:
+		return errs.InvalidFlagValue(ctx, "secret-size", ctx.String("secret-size"), "")
+	case ctx.Int("secret-size") < 16 && !ctx.Bool("insecure"):
+		return errs.MinSizeInsecureFlag(ctx, "secret-size", "16")
 	}
 
 	key, err := generate(ctx)
@@ -84,14 +129,16 @@ func generateAction(ctx *cli.Context) error {
 	if ctx.IsSet("qr") {
 		filename := ctx.String("qr")
 
-		// Convert TOTP key into a PNG
+		// Convert OTP key into a PNG
 		var buf bytes.Buffer
 		img, err := key.Image(200, 200)
 		if err != nil {
 			return err
 		}
-		png.Encode(&buf, img)
-		if err := utils.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		if err := png.Encode(&buf, img); err != nil {
+			return errors.Wrap(err, "error encoding QR code")
+		}
+		if err := utils.WriteFile(filename, buf.Bytes(), 0600); err != nil {
 			return errs.FileError(err, filename)
 		}
 	}
@@ -118,17 +165,56 @@ func algFromString(ctx *cli.Context, alg string) (otp.Algorithm, error) {
 	}
 }
 
+func digitsFromInt(ctx *cli.Context, n int) (otp.Digits, error) {
+	switch n {
+	case 6:
+		return otp.DigitsSix, nil
+	case 8:
+		return otp.DigitsEight, nil
+	default:
+		return 0, errs.InvalidFlagValue(ctx, "length", strconv.Itoa(n), "6 or 8")
+	}
+}
+
 func generate(ctx *cli.Context) (*otp.Key, error) {
 	alg, err := algFromString(ctx, ctx.String("alg"))
 	if err != nil {
 		return nil, err
 	}
-	return totp.Generate(totp.GenerateOpts{
+	digits, err := digitsFromInt(ctx, ctx.Int("length"))
+	if err != nil {
+		return nil, err
+	}
+
+	if !ctx.Bool("hotp") {
+		return totp.Generate(totp.GenerateOpts{
+			Issuer:      ctx.String("issuer"),
+			AccountName: ctx.String("account"),
+			Period:      uint(ctx.Int("period")),
+			SecretSize:  uint(ctx.Int("secret-size")),
+			Digits:      digits,
+			Algorithm:   alg,
+		})
+	}
+
+	key, err := hotp.Generate(hotp.GenerateOpts{
 		Issuer:      ctx.String("issuer"),
 		AccountName: ctx.String("account"),
-		Period:      uint(ctx.Int("period")),
 		SecretSize:  uint(ctx.Int("secret-size")),
-		Digits:      otp.Digits(ctx.Int("length")),
+		Digits:      digits,
 		Algorithm:   alg,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The counter parameter is required in HOTP Key URIs
+	u, err := url.Parse(key.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing key URI")
+	}
+	q := u.Query()
+	q.Set("counter", strconv.Itoa(ctx.Int("counter")))
+	u.RawQuery = q.Encode()
+	return otp.NewKeyFromURL(u.String())
 }
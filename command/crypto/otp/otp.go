@@ -4,20 +4,20 @@ import (
 	"github.com/urfave/cli"
 )
 
-// Command returns the cli.Command for jwt and related subcommands.
+// Command returns the cli.Command for otp and related subcommands.
 func Command() cli.Command {
 	return cli.Command{
 		Name:      "otp",
 		Usage:     "generate and verify one-time passwords",
 		UsageText: "step crypto otp <subcommand> [arguments] [global-flags] [subcommand-flags]",
 		Description: `**step crypto otp** command group implements TOTP and HOTP one-time passwords
-(mention RFCs)
+as described in RFC 6238 and RFC 4226.
 
 ## EXAMPLES
 
 Generate a new TOTP token and it's QR Code to scan:
 '''
-$ step crypto otp generate --issuer smallstep.com --account name@smallstep.com -qr smallstep.png \> smallstep.totp
+$ step crypto otp generate --issuer smallstep.com --account name@smallstep.com --qr smallstep.png \> smallstep.totp
 
 $ cat smallstep.totp
 55RU6WTUISKKGEYVNSSI7H6FTJWJ4IPP
@@ -29,6 +29,28 @@ use it to verify the TOTP token:
 $ step crypto otp verify --secret smallstep.totp
 Enter Passcode: 614318
 ok
+'''
+
+Generate a TOTP Key URI with 8 digits, SHA256 and a 60 seconds period, and
+verify a code allowing one period of clock skew:
+'''
+$ step crypto otp generate --issuer smallstep.com --account name@smallstep.com \
+  --length 8 --alg SHA256 --period 60 --url \> smallstep.url
+
+$ cat smallstep.url
+otpauth://totp/smallstep.com:name@smallstep.com?algorithm=SHA256&digits=8&issuer=smallstep.com&period=60&secret=O3LTQGMZK6KCSZ5HBKHZXUPH6KFBNNKP
+
+$ step crypto otp verify --secret smallstep.url --skew 1 40261852
+ok
+'''
+
+Generate an HOTP Key URI and verify a code with the counter in use:
+'''
+$ step crypto otp generate --issuer smallstep.com --account name@smallstep.com \
+  --hotp --url \> smallstep.hotp
+
+$ step crypto otp verify --secret smallstep.hotp --counter 5 728303
+ok
 '''`,
 		Subcommands: cli.Commands{
 			generateCommand(),
@@ -1,25 +1,46 @@
 package otp
 
 import (
-	"bufio"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
 	"github.com/pquerna/otp/totp"
 	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
 	"github.com/urfave/cli"
 )
 
 func verifyCommand() cli.Command {
 	return cli.Command{
-		Name:        "verify",
-		Action:      cli.ActionFunc(verifyAction),
-		Usage:       "verify a one-time password",
-		UsageText:   `**step crypto otp verify**`,
-		Description: `**step crypto otp verify** does TOTP and HTOP`,
+		Name:   "verify",
+		Action: cli.ActionFunc(verifyAction),
+		Usage:  "verify a one-time password",
+		UsageText: `**step crypto otp verify** [<code>] **--secret**=<file>
+[**--period**=<seconds>] [**--skew**=<number>] [**--length**=<size>]
+[**--alg**=<algorithm>] [**--time**=<unix-time>] [**--hotp**] [**--counter**=<number>]`,
+		Description: `**step crypto otp verify** verifies a time-based one-time password (TOTP, RFC
+6238) or, with **--hotp**, an HMAC-based one-time password (HOTP, RFC 4226).
+
+The secret can be a base32 encoded secret or an otpauth:// Key URI. If it is a
+Key URI, the type, period, length, algorithm and counter in the URI are used
+unless the flags are explicitly set.
+
+If the code is valid the command prints "ok" and returns 0. If it is not valid
+a non-zero failure code is returned.
+
+For examples, see **step help crypto otp**.
+
+## POSITIONAL ARGUMENTS
+
+<code>
+:  The one-time password to verify. If omitted, you will be prompted for it.`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "secret",
@@ -33,64 +54,184 @@ seconds.`,
 			},
 			cli.IntFlag{
 				Name: "skew",
-				Usage: `Periods before or after current time to allow. Defaults
-to 0. Values greater than 1 require '--insecure'`,
+				Usage: `Periods before or after current time to allow. With **--hotp** it is the
+number of counter values after **--counter** to allow. Defaults to 0. Values
+greater than 1 require '--insecure'`,
 				Value: 0,
 			},
 			cli.IntFlag{
-				Name:  "length digits",
-				Usage: `Length of one-time passwords. Defaults to 6.`,
+				Name:  "length, digits",
+				Usage: `Length of one-time passwords. Must be 6 or 8. Defaults to 6.`,
 				Value: 6,
 			},
 			cli.StringFlag{
-				Name: "alg algorithm",
+				Name: "alg, algorithm",
 				Usage: `Algorithm to use for HMAC. Defaults to SHA1. Must be
 one of: SHA1, SHA256, SHA512`,
 				Value: "SHA1",
 			},
 			cli.IntFlag{
 				Name:  "time",
-				Usage: `Time to use for TOTP calculation. Defaults to now.`,
+				Usage: `Time to use for TOTP calculation in seconds since the Unix epoch. Defaults to now.`,
+			},
+			cli.BoolFlag{
+				Name:  "hotp",
+				Usage: `Verify an HOTP code instead of a TOTP code.`,
+			},
+			cli.IntFlag{
+				Name:  "counter",
+				Usage: `The current <number> of the HOTP counter. Defaults to 0.`,
+			},
+			cli.BoolFlag{
+				Name:   "insecure",
+				Hidden: true,
 			},
 		},
 	}
 }
 
-func promptForPasscode() string {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Enter Passcode: ")
-	text, _ := reader.ReadString('\n')
-	return text
+// otpParams are the parameters used to verify a code.
+type otpParams struct {
+	isHOTP  bool
+	secret  string
+	period  int
+	digits  int
+	alg     string
+	counter int
+}
+
+// readParams reads the secret from a file and returns the parameters to use,
+// if the secret is a Key URI the values in the URI are used unless the flag is
+// explicitly set.
+func readParams(ctx *cli.Context, filename string) (*otpParams, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+
+	p := &otpParams{
+		isHOTP:  ctx.Bool("hotp"),
+		secret:  strings.TrimSpace(string(b)),
+		period:  ctx.Int("period"),
+		digits:  ctx.Int("length"),
+		alg:     ctx.String("alg"),
+		counter: ctx.Int("counter"),
+	}
+	if !strings.HasPrefix(p.secret, "otpauth://") {
+		return p, nil
+	}
+
+	key, err := otp.NewKeyFromURL(p.secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing key URI")
+	}
+	u, err := url.Parse(key.URL())
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing key URI")
+	}
+	q := u.Query()
+
+	p.secret = key.Secret()
+	if !ctx.IsSet("hotp") {
+		p.isHOTP = (key.Type() == "hotp")
+	}
+	for _, v := range []struct {
+		flag  string
+		param string
+		value *int
+	}{
+		{"period", "period", &p.period},
+		{"length", "digits", &p.digits},
+		{"counter", "counter", &p.counter},
+	} {
+		if s := q.Get(v.param); s != "" && !ctx.IsSet(v.flag) {
+			if *v.value, err = strconv.Atoi(s); err != nil {
+				return nil, errors.Errorf("error parsing key URI: invalid %s '%s'", v.param, s)
+			}
+		}
+	}
+	if s := q.Get("algorithm"); s != "" && !ctx.IsSet("alg") {
+		p.alg = s
+	}
+	return p, nil
 }
 
 func verifyAction(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errs.TooManyArguments(ctx)
+	}
+
 	filename := ctx.String("secret")
 	if len(filename) == 0 {
 		return errs.RequiredFlag(ctx, "secret")
 	}
 
-	b, err := ioutil.ReadFile(filename)
+	skew := ctx.Int("skew")
+	switch {
+	case skew < 0:
+		return errs.InvalidFlagValue(ctx, "skew", ctx.String("skew"), "")
+	case skew > 1 && !ctx.Bool("insecure"):
+		return errors.New("flag '--skew' with a value greater than 1 requires the '--insecure' flag")
+	}
+
+	p, err := readParams(ctx, filename)
 	if err != nil {
-		return errs.FileError(err, filename)
+		return err
 	}
-	secret := string(b)
 
-	if strings.HasPrefix(secret, "otpauth://") {
-		url, err := otp.NewKeyFromURL(secret)
-		if err != nil {
+	alg, err := algFromString(ctx, p.alg)
+	if err != nil {
+		return err
+	}
+	digits, err := digitsFromInt(ctx, p.digits)
+	if err != nil {
+		return err
+	}
+	if p.period <= 0 {
+		return errs.InvalidFlagValue(ctx, "period", strconv.Itoa(p.period), "")
+	}
+	if p.counter < 0 {
+		return errs.InvalidFlagValue(ctx, "counter", strconv.Itoa(p.counter), "")
+	}
+
+	passcode := ctx.Args().First()
+	if passcode == "" {
+		if passcode, err = ui.Prompt("Enter Passcode", ui.WithValidateNotEmpty()); err != nil {
 			return err
 		}
-		secret = url.Secret()
+	}
+	passcode = strings.TrimSpace(passcode)
+
+	var valid bool
+	if p.isHOTP {
+		opts := hotp.ValidateOpts{
+			Digits:    digits,
+			Algorithm: alg,
+		}
+		for i := 0; i <= skew && !valid; i++ {
+			if valid, err = hotp.ValidateCustom(passcode, uint64(p.counter+i), p.secret, opts); err != nil && err != otp.ErrValidateInputInvalidLength {
+				return errors.Wrap(err, "error validating passcode")
+			}
+		}
+	} else {
+		t := time.Now()
+		if ctx.IsSet("time") {
+			t = time.Unix(int64(ctx.Int("time")), 0)
+		}
+		valid, err = totp.ValidateCustom(passcode, p.secret, t, totp.ValidateOpts{
+			Period:    uint(p.period),
+			Skew:      uint(skew),
+			Digits:    digits,
+			Algorithm: alg,
+		})
+		if err != nil && err != otp.ErrValidateInputInvalidLength {
+			return errors.Wrap(err, "error validating passcode")
+		}
 	}
 
-	passcode := promptForPasscode()
-	valid := totp.Validate(passcode, secret)
 	if valid {
 		fmt.Println("ok")
-		os.Exit(0)
-	} else {
-		fmt.Println("fail")
-		os.Exit(1)
+		return nil
 	}
-	return nil
+	return errors.New("fail")
 }
@@ -0,0 +1,175 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/randutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+const (
+	// defaultRandSize and minRandSize are the default and minimum number of
+	// random bytes generated.
+	defaultRandSize = 32
+	minRandSize     = 16
+	// defaultRandWords and minRandWords are the default and minimum number of
+	// words in a diceware passphrase.
+	defaultRandWords = 6
+	minRandWords     = 6
+)
+
+func randCommand() cli.Command {
+	return cli.Command{
+		Name:   "rand",
+		Action: cli.ActionFunc(randAction),
+		Usage:  "generate cryptographically secure random data",
+		UsageText: `**step crypto rand** [<size>]
+[**--format**=<format>] [**--separator**=<string>] [**--insecure**]`,
+		Description: `**step crypto rand** generates random data using the cryptographically secure
+random number generator of the operating system, and prints it to STDOUT using
+the given format. It can be used to generate passwords, tokens, salts or keys in
+provisioning scripts, without depending on the availability or the behavior of
+/dev/urandom on each platform.
+
+## POSITIONAL ARGUMENTS
+
+<size>
+:  The number of random bytes to generate, or the number of words if the format
+is 'diceware'. Defaults to 32 bytes or 6 words. Sizes smaller than 16 bytes or
+6 words require the **--insecure** flag.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Generate 32 random bytes encoded in hexadecimal:
+'''
+$ step crypto rand
+d9f6df7863cafb0d375739734f5104334a669e3b34f0668bc0ed7e55e9f9a574
+'''
+
+Generate a 16 bytes salt encoded in base64:
+'''
+$ step crypto rand --format base64 16
+d0JX5D76M9mlTKMBE/lMVg==
+'''
+
+Generate a token that can be used in URLs:
+'''
+$ step crypto rand --format base64url
+QP1mmYDqZXaH24hq6VehWWzk6M8CnGcFBXEY2IYamD8
+'''
+
+Generate a 256-bit key and write it to a file:
+'''
+$ step crypto rand --format raw 32 > secretbox.key
+'''
+
+Generate a passphrase with 8 words from the EFF's large wordlist:
+'''
+$ step crypto rand --format diceware 8
+vindicate-mangy-canyon-vastness-wasp-mumps-unneeded-twice
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "format",
+				Usage: `The <format> of the output. The default format is 'hex'.
+
+: <format> is a case-sensitive string and must be one of:
+
+    **hex**
+    :  Hexadecimal encoding in lower case
+
+    **base64**
+    :  Standard base64 encoding with padding, as defined in RFC 4648
+
+    **base64url**
+    :  URL and filename safe base64 encoding without padding, as defined in RFC 4648
+
+    **raw**
+    :  Raw bytes without any encoding
+
+    **diceware**
+    :  A passphrase with words randomly chosen from the EFF's large wordlist,
+    each word adds about 12.9 bits of entropy`,
+				Value: "hex",
+			},
+			cli.StringFlag{
+				Name:  "separator",
+				Usage: `The <string> used to join the words of a diceware passphrase.`,
+				Value: "-",
+			},
+			cli.BoolFlag{
+				Name: "insecure",
+				Usage: `Allows the generation of less than 16 bytes or less than 6 words.
+Use it at your own risk.`,
+			},
+		},
+	}
+}
+
+func randAction(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errs.TooManyArguments(ctx)
+	}
+
+	format := ctx.String("format")
+	switch format {
+	case "hex", "base64", "base64url", "raw", "diceware":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "hex, base64, base64url, raw, diceware")
+	}
+	isDiceware := (format == "diceware")
+
+	size, minSize := defaultRandSize, minRandSize
+	if isDiceware {
+		size, minSize = defaultRandWords, minRandWords
+	}
+	if ctx.NArg() == 1 {
+		arg := ctx.Args().First()
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return errors.Errorf("positional argument <size> has an invalid value '%s'", arg)
+		}
+		size = n
+	}
+	if size < minSize && !ctx.Bool("insecure") {
+		return errs.InsecureArgument(ctx, "size")
+	}
+
+	if isDiceware {
+		words, err := randutil.Diceware(size)
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.Join(words, ctx.String("separator")))
+		return nil
+	}
+
+	b, err := randutil.Salt(size)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "hex":
+		fmt.Println(hex.EncodeToString(b))
+	case "base64":
+		fmt.Println(base64.StdEncoding.EncodeToString(b))
+	case "base64url":
+		fmt.Println(base64.RawURLEncoding.EncodeToString(b))
+	case "raw":
+		os.Stdout.Write(b)
+	}
+
+	return nil
+}
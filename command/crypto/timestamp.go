@@ -0,0 +1,254 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/timestamp"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func timestampCommand() cli.Command {
+	return cli.Command{
+		Name:   "timestamp",
+		Action: command.ActionFunc(timestampAction),
+		Usage:  "request and verify RFC 3161 timestamps",
+		UsageText: `**step crypto timestamp** <file>
+[**--tsa**=<url>] [**--verify**=<token-file>] [**--alg**=<algorithm>]
+[**--out**=<file>] [**--roots**=<root-bundle>] [**--insecure**]`,
+		Description: `**step crypto timestamp** requests a signed timestamp token for the hash of a
+file to a Time Stamping Authority (TSA) using the protocol defined in RFC 3161,
+or verifies an existing token.
+
+When the **--tsa** flag is used, the hash of <file> is sent to the TSA and the
+response is verified and written to **--out**, or to '<file>.tsr' by default.
+The response can also be verified with 'openssl ts -verify'.
+
+When the **--verify** flag is used, the command checks that the given token,
+or time-stamp response, matches the hash of <file> and that it is signed by a
+TSA trusted by **--roots**.
+
+## POSITIONAL ARGUMENTS
+
+<file>
+:  The path to the file to timestamp or verify.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Request a timestamp for a file:
+'''
+$ step crypto timestamp --tsa https://freetsa.org/tsr --roots freetsa_ca.crt release.tar.gz
+Timestamp:     2019-06-04T21:20:52Z
+Serial Number: 296145193
+Policy:        1.2.3.4.1
+TSA:           O=Free TSA,OU=TSA,CN=www.freetsa.org,...
+Hash:          sha256 5d0f6c2c8a5e1d6c2c5e8a0b1f0e83fe46a4b7e1f5d8e3a4d2b8c1a3e7b6d9f0
+Your timestamp response has been saved in release.tar.gz.tsr.
+'''
+
+Verify the timestamp of a file:
+'''
+$ step crypto timestamp --verify release.tar.gz.tsr --roots freetsa_ca.crt release.tar.gz
+'''
+
+Request a timestamp using SHA-512 without verifying the certificate of the TSA:
+'''
+$ step crypto timestamp --tsa http://timestamp.example.com --alg sha512 --insecure \
+  --out release.tsr release.tar.gz
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "tsa",
+				Usage: "The <url> of the Time Stamping Authority.",
+			},
+			cli.StringFlag{
+				Name:  "verify",
+				Usage: "The <file> with the time-stamp token or response to verify.",
+			},
+			cli.StringFlag{
+				Name:  "alg",
+				Value: "sha256",
+				Usage: `The hash <algorithm> used in the time-stamp request.
+
+: <algorithm> is a case-sensitive string and must be one of:
+
+    **sha256** (default)
+    :  SHA-256 hash function
+
+    **sha384**
+    :  SHA-384 hash function
+
+    **sha512**
+    :  SHA-512 hash function
+
+    **sha1** (requires --insecure)
+    :  SHA-1 hash function`,
+			},
+			cli.StringFlag{
+				Name:  "out",
+				Usage: "The <file> to write the time-stamp response. Defaults to '<file>.tsr'.",
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) that will be used to verify the certificate of the TSA.
+Defaults to the operating system's root certificate bundle.`,
+			},
+			cli.BoolFlag{
+				Name:  "insecure",
+				Usage: "Do not verify the certificate chain of the TSA.",
+			},
+			flags.Force,
+		},
+	}
+}
+
+func timestampAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	filename := ctx.Args().First()
+	tsaURL := ctx.String("tsa")
+	verify := ctx.String("verify")
+	insecure := ctx.Bool("insecure")
+	switch {
+	case tsaURL == "" && verify == "":
+		return errs.RequiredOrFlag(ctx, "tsa", "verify")
+	case tsaURL != "" && verify != "":
+		return errs.MutuallyExclusiveFlags(ctx, "tsa", "verify")
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errs.FileError(err, filename)
+	}
+
+	var roots *x509.CertPool
+	if !insecure {
+		if r := ctx.String("roots"); r != "" {
+			if roots, err = x509util.ReadCertPool(r); err != nil {
+				return errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", r)
+			}
+		} else if roots, err = x509.SystemCertPool(); err != nil {
+			return errors.Wrap(err, "error loading the system cert pool")
+		}
+	}
+
+	// Verify an existing token
+	if verify != "" {
+		b, err := ioutil.ReadFile(verify)
+		if err != nil {
+			return errs.FileError(err, verify)
+		}
+		// The file can be a time-stamp response or just the token.
+		ts, err := timestamp.ParseResponse(b)
+		if err != nil {
+			var tokenErr error
+			if ts, tokenErr = timestamp.ParseToken(b); tokenErr != nil {
+				return errors.Wrapf(err, "error parsing %s", verify)
+			}
+		}
+		tsa, err := ts.Verify(bytes.NewReader(data), roots)
+		if err != nil {
+			return err
+		}
+		printTimestamp(ts, tsa)
+		return nil
+	}
+
+	var h crypto.Hash
+	switch alg := ctx.String("alg"); alg {
+	case "sha256":
+		h = crypto.SHA256
+	case "sha384":
+		h = crypto.SHA384
+	case "sha512":
+		h = crypto.SHA512
+	case "sha1":
+		if !insecure {
+			return errs.FlagValueInsecure(ctx, "alg", alg)
+		}
+		h = crypto.SHA1
+	default:
+		return errs.InvalidFlagValue(ctx, "alg", alg, "sha256, sha384, sha512, sha1")
+	}
+
+	req, err := timestamp.NewRequest(bytes.NewReader(data), h)
+	if err != nil {
+		return err
+	}
+	body, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(tsaURL, "application/timestamp-query", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "error requesting timestamp to %s", tsaURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.Errorf("error requesting timestamp to %s: %s", tsaURL, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "error reading response from %s", tsaURL)
+	}
+
+	ts, err := timestamp.ParseResponse(b)
+	if err != nil {
+		return err
+	}
+	if err := ts.Match(req); err != nil {
+		return err
+	}
+	tsa, err := ts.Verify(bytes.NewReader(data), roots)
+	if err != nil {
+		return err
+	}
+	printTimestamp(ts, tsa)
+
+	out := ctx.String("out")
+	if out == "" {
+		out = filename + ".tsr"
+	}
+	if err := utils.WriteFile(out, b, 0644); err != nil {
+		return err
+	}
+	ui.Printf("Your timestamp response has been saved in %s.\n", out)
+	return nil
+}
+
+func printTimestamp(ts *timestamp.Timestamp, tsa *x509.Certificate) {
+	name := ts.TSA
+	if name == "" {
+		name = tsa.Subject.String()
+	}
+	fmt.Printf("Timestamp:     %s\n", ts.Time.UTC().Format(time.RFC3339Nano))
+	if ts.Accuracy > 0 {
+		fmt.Printf("Accuracy:      %s\n", ts.Accuracy)
+	}
+	fmt.Printf("Serial Number: %s\n", ts.SerialNumber)
+	fmt.Printf("Policy:        %s\n", ts.Policy)
+	fmt.Printf("TSA:           %s\n", name)
+	fmt.Printf("Hash:          %s %s\n", strings.ToLower(strings.Replace(ts.HashAlgorithm.String(), "-", "", -1)), hex.EncodeToString(ts.HashedMessage))
+}
@@ -0,0 +1,117 @@
+package tpm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/tpm"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+func attestCommand() cli.Command {
+	return cli.Command{
+		Name:   "attest",
+		Action: cli.ActionFunc(attestAction),
+		Usage:  "attest a key created in the TPM",
+		UsageText: `**step crypto tpm attest** <key_file> **--ak**=<file>
+[**--ak-cert**=<file>] [**--nonce**=<string>] [**--device**=<device>]`,
+		Description: `**step crypto tpm attest** generates the attestation of a key created in the
+TPM and prints it in JSON format.
+
+The attestation contains the certification of the creation of the key signed
+by the attestation key (AK), and the endorsement key (EK) of the TPM with its
+certificate if the TPM has one. The attestation cannot be verified without the
+AK certificate, so it must be included using **--ak-cert**.
+
+## POSITIONAL ARGUMENTS
+
+<key_file>
+:  The path to the TPM key blob to attest.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Attest a key including the AK certificate:
+'''
+$ step crypto tpm attest --ak ak.tpm --ak-cert ak.crt key.tpm > attestation.json
+'''
+
+Attest a key using a nonce provided by the verifier:
+'''
+$ step crypto tpm attest --ak ak.tpm --ak-cert ak.crt --nonce 8f2ac4e1 key.tpm
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "ak",
+				Usage: `The TPM attestation key <file> used to attest the key.`,
+			},
+			cli.StringFlag{
+				Name: "ak-cert",
+				Usage: `The <file> with the certificate of the attestation key, and optionally its
+intermediates, to include in the attestation.`,
+			},
+			cli.StringFlag{
+				Name: "nonce",
+				Usage: `The <nonce> to include in the attestation. It's used by the verifier to
+prevent replay attacks.`,
+			},
+			deviceFlag,
+		},
+	}
+}
+
+func attestAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	akFile := ctx.String("ak")
+	if akFile == "" {
+		return errs.RequiredFlag(ctx, "ak")
+	}
+
+	key, err := tpm.ReadKey(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	ak, err := tpm.ReadKey(akFile)
+	if err != nil {
+		return err
+	}
+
+	var akCerts [][]byte
+	if filename := ctx.String("ak-cert"); filename != "" {
+		certs, err := pemutil.ReadCertificateBundle(filename)
+		if err != nil {
+			return err
+		}
+		for _, crt := range certs {
+			akCerts = append(akCerts, crt.Raw)
+		}
+	}
+
+	t, err := tpm.Open(ctx.String("device"))
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	att, err := t.Attest(key, ak, []byte(ctx.String("nonce")))
+	if err != nil {
+		return err
+	}
+	att.AKCertificates = akCerts
+
+	b, err := json.MarshalIndent(att, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error marshaling attestation")
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -0,0 +1,162 @@
+package tpm
+
+import (
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/tpm"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func createCommand() cli.Command {
+	return cli.Command{
+		Name:   "create",
+		Action: cli.ActionFunc(createAction),
+		Usage:  "create a key in the TPM",
+		UsageText: `**step crypto tpm create** <pub_file> <key_file>
+[**--kty**=<key-type>] [**--curve**=<curve>] [**--size**=<size>] [**--ak**]
+[**--device**=<device>] [**--force**]`,
+		Description: `**step crypto tpm create** creates a new signing key in the TPM. The public
+key is written in PEM format to <pub_file>, and the TPM key blob to <key_file>.
+
+The TPM key blob can only be loaded in the TPM that created it, it can be used
+with **step ca certificate** to request a certificate.
+
+## POSITIONAL ARGUMENTS
+
+<pub_file>
+:  The path to write the public key.
+
+<key_file>
+:  The path to write the TPM key blob.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Create an EC P-256 key in the TPM:
+'''
+$ step crypto tpm create key.pub key.tpm
+'''
+
+Create an RSA key in the TPM:
+'''
+$ step crypto tpm create --kty RSA --size 2048 key.pub key.tpm
+'''
+
+Create an attestation key:
+'''
+$ step crypto tpm create --ak ak.pub ak.tpm
+'''
+
+Create a key using a specific TPM device:
+'''
+$ step crypto tpm create --device /dev/tpmrm0 key.pub key.tpm
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "kty",
+				Value: "EC",
+				Usage: `The <kty> (key type) to create.
+If unset, default is EC.
+
+: <kty> is a case-sensitive string and must be one of:
+
+    **EC**
+    :  Create an **elliptic curve** key
+
+    **RSA**
+    :  Create an **RSA** key
+`,
+			},
+			cli.IntFlag{
+				Name: "size",
+				Usage: `The <size> (in bits) of the key for RSA key types. RSA keys require a
+minimum key size of 2048 bits. If unset, default is 2048 bits.`,
+			},
+			cli.StringFlag{
+				Name: "crv, curve",
+				Usage: `The elliptic <curve> to use for EC keys. If unset, default is P-256.
+
+: <curve> is a case-sensitive string and must be one of:
+
+    **P-256**
+    :  NIST P-256 Curve
+
+    **P-384**
+    :  NIST P-384 Curve
+`,
+			},
+			cli.BoolFlag{
+				Name: "ak",
+				Usage: `Create an attestation key (AK) instead of a signing key. An AK is a
+restricted key that can only be used to sign data generated by the TPM.`,
+			},
+			deviceFlag,
+			flags.Force,
+		},
+	}
+}
+
+func createAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	pubFile := ctx.Args().Get(0)
+	keyFile := ctx.Args().Get(1)
+	if pubFile == keyFile {
+		return errs.EqualArguments(ctx, "PUB_FILE", "KEY_FILE")
+	}
+
+	kty := ctx.String("kty")
+	isAK := ctx.Bool("ak")
+	if isAK {
+		switch {
+		case ctx.IsSet("curve"):
+			return errs.IncompatibleFlagWithFlag(ctx, "ak", "curve")
+		case ctx.IsSet("size"):
+			return errs.IncompatibleFlagWithFlag(ctx, "ak", "size")
+		}
+	}
+
+	t, err := tpm.Open(ctx.String("device"))
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	var key *tpm.Key
+	if isAK {
+		key, err = t.CreateAK(kty)
+	} else {
+		key, err = t.CreateKey(kty, ctx.String("curve"), ctx.Int("size"))
+	}
+	if err != nil {
+		return err
+	}
+
+	pub, err := key.PublicKey()
+	if err != nil {
+		return err
+	}
+	b, err := key.MarshalPEM()
+	if err != nil {
+		return err
+	}
+
+	if _, err := pemutil.Serialize(pub, pemutil.ToFile(pubFile, 0644)); err != nil {
+		return err
+	}
+	if err := utils.WriteFile(keyFile, b, 0600); err != nil {
+		return errs.FileError(err, keyFile)
+	}
+
+	ui.Printf("Your public key has been saved in %s.\n", pubFile)
+	ui.Printf("Your TPM key has been saved in %s.\n", keyFile)
+	return nil
+}
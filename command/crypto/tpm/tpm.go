@@ -0,0 +1,59 @@
+package tpm
+
+import (
+	"github.com/urfave/cli"
+)
+
+// Command returns the cli.Command for tpm and related subcommands.
+func Command() cli.Command {
+	return cli.Command{
+		Name:      "tpm",
+		Usage:     "create and attest keys stored in a TPM",
+		UsageText: "step crypto tpm <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step crypto tpm** command group provides facilities to create keys in a
+TPM 2.0, and to generate the attestation of those keys. The attestations are
+verified using **step crypto attest verify**.
+
+The private part of a TPM key never leaves the TPM, the key file only contains
+a blob encrypted by the TPM that can only be loaded by the TPM that created it.
+The attestation of a key proves that the key was created in the TPM, it's
+signed by an attestation key (AK) and it includes the endorsement key (EK)
+certificate that identifies the TPM. The AK is linked to the TPM by its
+certificate, issued by a CA after a credential activation with the EK.
+
+These commands require step to be compiled with the tpm build tag.
+
+## EXAMPLES
+
+Create an attestation key and a key in the TPM:
+'''
+$ step crypto tpm create --ak ak.pub ak.tpm
+
+$ step crypto tpm create key.pub key.tpm
+'''
+
+Attest the key with the AK certificate, and verify the attestation using the
+roots of the AK certificate and the EK roots of the TPM manufacturer:
+'''
+$ step crypto tpm attest --ak ak.tpm --ak-cert ak.crt key.tpm > attestation.json
+
+$ step crypto attest verify --roots manufacturer-roots.crt --ak-roots ak-ca.crt \
+  attestation.json
+'''
+
+Request a certificate to the CA using the TPM key, the attestation is included
+in the certificate signing request:
+'''
+$ step ca certificate --key key.tpm --ak ak.tpm --ak-cert ak.crt device.example.com device.crt
+'''`,
+		Subcommands: cli.Commands{
+			createCommand(),
+			attestCommand(),
+		},
+	}
+}
+
+var deviceFlag = cli.StringFlag{
+	Name:  "device",
+	Usage: `The TPM <device>, e.g. /dev/tpmrm0. If unset, the default device is used.`,
+}
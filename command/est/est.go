@@ -0,0 +1,566 @@
+package est
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/est"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	cmd := cli.Command{
+		Name:      "est",
+		Usage:     "request certificates from EST servers",
+		UsageText: "step est <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step est** command group implements the client side of the Enrollment over
+Secure Transport (EST) protocol, RFC 7030, to get the CA certificates and to
+request certificates from CAs that speak EST.
+
+The enrollment requests are authenticated with a username and password, with
+a client certificate, or with both. A device with a certificate issued by an
+EST CA can use it as the client certificate to enroll with another EST
+server, e.g. to migrate the identity of a fleet of devices to a new CA like
+step-ca.
+
+## EXAMPLES
+
+Get the CA certificates:
+'''
+$ step est cacerts --url https://est.example.com --root root_ca.crt
+'''
+
+Request a certificate:
+'''
+$ step est simpleenroll device01.example.com device01.crt device01.key \
+  --url https://est.example.com --root root_ca.crt --username device01
+'''
+
+Renew the certificate:
+'''
+$ step est simplereenroll device01.crt device01.key \
+  --url https://est.example.com --root root_ca.crt --force
+'''`,
+		Subcommands: cli.Commands{
+			cacertsCommand(),
+			simpleEnrollCommand(),
+			simpleReenrollCommand(),
+		},
+	}
+
+	command.Register(cmd)
+}
+
+var (
+	urlFlag = cli.StringFlag{
+		Name: "url",
+		Usage: `The <url> of the EST server, e.g. 'https://est.example.com'. The
+operations are requested under '/.well-known/est'.`,
+	}
+	labelFlag = cli.StringFlag{
+		Name:  "label",
+		Usage: `The <label> of the CA, used by servers with multiple CAs.`,
+	}
+	rootFlag = cli.StringFlag{
+		Name: "root",
+		Usage: `The path to the PEM <file> with the root certificates used to verify the TLS
+certificate of the EST server. If unset, the system roots are used.`,
+	}
+	usernameFlag = cli.StringFlag{
+		Name:  "username",
+		Usage: `The <username> used to authenticate the request with HTTP basic authentication.`,
+	}
+	passwordFileFlag = cli.StringFlag{
+		Name: "password-file",
+		Usage: `The path to the <file> containing the password used to authenticate the
+request with HTTP basic authentication. The password is prompted if
+**--username** is set and this flag is not.`,
+	}
+	waitFlag = cli.DurationFlag{
+		Name: "wait",
+		Usage: `The maximum <duration> to wait for the approval of a pending request. By
+default, the command fails if the request is not approved immediately.`,
+	}
+)
+
+func cacertsCommand() cli.Command {
+	return cli.Command{
+		Name:   "cacerts",
+		Action: command.ActionFunc(cacertsAction),
+		Usage:  "get the CA certificates from an EST server",
+		UsageText: `**step est cacerts** **--url**=<url> [**--label**=<label>]
+[**--root**=<file>] [**--fingerprint**=<fingerprint>] [**--out**=<file>] [**--force**]`,
+		Description: `**step est cacerts** gets the current CA certificates from an EST server and
+prints them in PEM format, or writes them to the **--out** file.
+
+To bootstrap the trust on a new device, use the **--fingerprint** flag instead
+of **--root**: the TLS certificate of the server is not verified, but one of
+the CA certificates must have the given fingerprint, and the rest of them must
+chain to it.
+
+## EXAMPLES
+
+Get the CA certificates:
+'''
+$ step est cacerts --url https://est.example.com --root root_ca.crt
+'''
+
+Get the CA certificates verifying them with the fingerprint of the root, and
+write them to a file:
+'''
+$ step est cacerts --url https://est.example.com --out est_ca.crt \
+  --fingerprint 9e5f81b2a1e50d1bf7b9e5a0f1e4d9e0a6e5c7e2b1f0d3a4c5b6a7980e1f2a3b
+'''`,
+		Flags: []cli.Flag{
+			urlFlag,
+			labelFlag,
+			rootFlag,
+			cli.StringFlag{
+				Name: "fingerprint",
+				Usage: `The SHA-256 <fingerprint> of the root CA certificate. The TLS certificate
+of the server is not verified if this flag is used, but all the CA certificates
+must chain to the root with this fingerprint.`,
+			},
+			cli.StringFlag{
+				Name:  "out,output-file",
+				Usage: `The <file> to write the CA certificates.`,
+			},
+			flags.Force,
+		},
+	}
+}
+
+func simpleEnrollCommand() cli.Command {
+	return cli.Command{
+		Name:   "simpleenroll",
+		Action: command.ActionFunc(simpleEnrollAction),
+		Usage:  "request a new certificate from an EST server",
+		UsageText: `**step est simpleenroll** <subject> <crt-file> <key-file>
+**--url**=<url> [**--label**=<label>] [**--root**=<file>] [**--san**=<SAN>]
+[**--username**=<username>] [**--password-file**=<file>]
+[**--cert**=<file>] [**--key**=<file>] [**--kty**=<type>] [**--curve**=<curve>]
+[**--size**=<size>] [**--wait**=<duration>] [**--force**]`,
+		Description: `**step est simpleenroll** generates a new key and requests a certificate for it
+from an EST server. The certificate is written with the rest of the
+certificates in the response, and the key is written unencrypted.
+
+The request is authenticated with HTTP basic authentication, with the client
+certificate in the **--cert** and **--key** flags, or with both. The client
+certificate can be the identity issued by another CA, e.g. the one of a device
+that is migrating to a new CA.
+
+## POSITIONAL ARGUMENTS
+
+<subject>
+:  The Common Name of the certificate.
+
+<crt-file>
+:  File to write the certificate (PEM format)
+
+<key-file>
+:  File to write the private key (PEM format)
+
+## EXAMPLES
+
+Request a certificate using a username and password:
+'''
+$ step est simpleenroll device01.example.com device01.crt device01.key \
+  --url https://est.example.com --root root_ca.crt \
+  --username device01 --password-file password.txt
+'''
+
+Request a certificate from a new CA using the current identity of the device:
+'''
+$ step est simpleenroll device01.example.com new.crt new.key \
+  --url https://ca.example.com --label devices --root new_root_ca.crt \
+  --cert device01.crt --key device01.key
+'''
+
+Request a certificate with an RSA key and wait up to one hour for a manual
+approval:
+'''
+$ step est simpleenroll device01.example.com device01.crt device01.key \
+  --url https://est.example.com --username device01 \
+  --kty RSA --size 3072 --wait 1h
+'''`,
+		Flags: []cli.Flag{
+			urlFlag,
+			labelFlag,
+			rootFlag,
+			cli.StringSliceFlag{
+				Name: "san",
+				Usage: `Add DNS or IP Address Subjective Alternative Names (SANs). Use the '--san'
+flag multiple times to configure multiple SANs.`,
+			},
+			usernameFlag,
+			passwordFileFlag,
+			cli.StringFlag{
+				Name:  "cert",
+				Usage: `The path to the <file> with the client certificate used to authenticate the request.`,
+			},
+			cli.StringFlag{
+				Name:  "key",
+				Usage: `The path to the <file> with the key of the client certificate.`,
+			},
+			cli.StringFlag{
+				Name: "kty",
+				Usage: `The <kty> of the private key to generate. If unset, default is EC.
+
+: <kty> is a case-sensitive string and must be one of:
+
+    **EC**
+    :  Create an **elliptic curve** keypair
+
+    **RSA**
+    :  Create an **RSA** keypair`,
+			},
+			cli.StringFlag{
+				Name: "crv,curve",
+				Usage: `The elliptic <curve> to use for EC key types, **P-256**, **P-384** or
+**P-521**. If unset, default is P-256.`,
+			},
+			cli.IntFlag{
+				Name: "size",
+				Usage: `The <size> (in bits) of the key for RSA key types. RSA keys require a minimum
+key size of 2048 bits. If unset, default is 2048 bits.`,
+			},
+			waitFlag,
+			flags.Force,
+		},
+	}
+}
+
+func simpleReenrollCommand() cli.Command {
+	return cli.Command{
+		Name:   "simplereenroll",
+		Action: command.ActionFunc(simpleReenrollAction),
+		Usage:  "renew a certificate using an EST server",
+		UsageText: `**step est simplereenroll** <crt-file> <key-file>
+**--url**=<url> [**--label**=<label>] [**--root**=<file>] [**--out**=<file>]
+[**--username**=<username>] [**--password-file**=<file>]
+[**--wait**=<duration>] [**--force**]`,
+		Description: `**step est simplereenroll** renews a certificate using an EST server. The
+request has the subject, the SANs and the key of the current certificate, and
+it's authenticated with the current certificate as the client certificate.
+
+## POSITIONAL ARGUMENTS
+
+<crt-file>
+:  The certificate in PEM format that we want to renew.
+
+<key-file>
+:  The key file of the certificate.
+
+## EXAMPLES
+
+Renew a certificate:
+'''
+$ step est simplereenroll device01.crt device01.key \
+  --url https://est.example.com --root root_ca.crt --force
+'''
+
+Renew a certificate and write it to a new file:
+'''
+$ step est simplereenroll device01.crt device01.key --out device01-new.crt \
+  --url https://est.example.com --root root_ca.crt
+'''`,
+		Flags: []cli.Flag{
+			urlFlag,
+			labelFlag,
+			rootFlag,
+			cli.StringFlag{
+				Name:  "out,output-file",
+				Usage: "The new certificate <file> path. Defaults to overwriting the <crt-file> positional argument",
+			},
+			usernameFlag,
+			passwordFileFlag,
+			waitFlag,
+			flags.Force,
+		},
+	}
+}
+
+func cacertsAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+	fingerprint := strings.ToLower(strings.Replace(ctx.String("fingerprint"), ":", "", -1))
+	if fingerprint != "" && ctx.String("root") != "" {
+		return errs.IncompatibleFlagWithFlag(ctx, "fingerprint", "root")
+	}
+
+	tlsConfig, err := newTLSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if fingerprint != "" {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	client, err := newClient(ctx, tlsConfig)
+	if err != nil {
+		return err
+	}
+	certs, err := client.CACerts()
+	if err != nil {
+		return err
+	}
+	if fingerprint != "" {
+		var root *x509.Certificate
+		for _, crt := range certs {
+			if x509util.Fingerprint(crt) == fingerprint {
+				root = crt
+				break
+			}
+		}
+		if root == nil {
+			return errs.WithCode(errors.Errorf("the CA certificates do not match the fingerprint %s", ctx.String("fingerprint")), errs.CodeValidation)
+		}
+		if err := verifyCACerts(certs, root); err != nil {
+			return err
+		}
+	}
+
+	data := encodeCertificates(certs)
+	if out := ctx.String("out"); out != "" {
+		if err := utils.WriteFile(out, data, 0644); err != nil {
+			return err
+		}
+		ui.PrintSelected("CA Certificates", out)
+		return nil
+	}
+	os.Stdout.Write(data)
+	return nil
+}
+
+// verifyCACerts verifies that all the certificates returned by the cacerts
+// operation chain to the given root. Without it, a server impersonating the
+// CA could add its own root next to the public certificate of the CA.
+func verifyCACerts(certs []*x509.Certificate, root *x509.Certificate) error {
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+	for _, c := range certs {
+		if _, err := c.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return errs.WithCode(errors.Wrapf(err, "error verifying the CA certificate '%s'", c.Subject.CommonName), errs.CodeValidation)
+		}
+	}
+	return nil
+}
+
+func simpleEnrollAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 3); err != nil {
+		return err
+	}
+	args := ctx.Args()
+	subject, crtFile, keyFile := args.Get(0), args.Get(1), args.Get(2)
+	if (ctx.String("cert") == "") != (ctx.String("key") == "") {
+		if ctx.String("cert") == "" {
+			return errs.RequiredWithFlag(ctx, "key", "cert")
+		}
+		return errs.RequiredWithFlag(ctx, "cert", "key")
+	}
+	kty, crv, size, err := utils.GetKeyDetailsFromCLI(ctx, false, "kty", "curve", "size")
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := newTLSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if ctx.String("cert") != "" {
+		crt, err := pemutil.LoadX509KeyPair(ctx.String("cert"), ctx.String("key"))
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{crt}
+	}
+	client, err := newClient(ctx, tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	pk, err := keys.GenerateKey(kty, crv, size)
+	if err != nil {
+		return err
+	}
+	dnsNames, ips := x509util.SplitSANs(ctx.StringSlice("san"))
+	csr, err := createCertificateRequest(&x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: subject},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, pk)
+	if err != nil {
+		return err
+	}
+
+	certs, err := enroll(ctx, client.SimpleEnroll, csr)
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFile(crtFile, encodeCertificates(certs), 0600); err != nil {
+		return err
+	}
+	if _, err := pemutil.Serialize(pk, pemutil.ToFile(keyFile, 0600)); err != nil {
+		return err
+	}
+
+	ui.PrintSelected("Certificate", crtFile)
+	ui.PrintSelected("Private Key", keyFile)
+	return nil
+}
+
+func simpleReenrollAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+	args := ctx.Args()
+	crtFile, keyFile := args.Get(0), args.Get(1)
+	outFile := ctx.String("out")
+	if outFile == "" {
+		outFile = crtFile
+	}
+
+	tlsConfig, err := newTLSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	identity, err := pemutil.LoadX509KeyPair(crtFile, keyFile)
+	if err != nil {
+		return err
+	}
+	tlsConfig.Certificates = []tls.Certificate{identity}
+	client, err := newClient(ctx, tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	crt := identity.Leaf
+	csr, err := createCertificateRequest(&x509.CertificateRequest{
+		Subject:        crt.Subject,
+		DNSNames:       crt.DNSNames,
+		IPAddresses:    crt.IPAddresses,
+		EmailAddresses: crt.EmailAddresses,
+		URIs:           crt.URIs,
+	}, identity.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	certs, err := enroll(ctx, client.SimpleReenroll, csr)
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFile(outFile, encodeCertificates(certs), 0600); err != nil {
+		return err
+	}
+
+	ui.Printf("Your certificate has been saved in %s.\n", outFile)
+	return nil
+}
+
+// enroll sends the enrollment request, and it retries it while it's pending
+// until the --wait duration is reached.
+func enroll(ctx *cli.Context, fn func(*x509.CertificateRequest) ([]*x509.Certificate, error), csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	deadline := time.Now().Add(ctx.Duration("wait"))
+	for {
+		certs, err := fn(csr)
+		retry, ok := err.(*est.RetryError)
+		if !ok {
+			return certs, err
+		}
+		if time.Now().Add(retry.RetryAfter).After(deadline) {
+			return nil, err
+		}
+		ui.Printf("The request is pending approval, retrying in %s.\n", retry.RetryAfter)
+		time.Sleep(retry.RetryAfter)
+	}
+}
+
+// newTLSConfig returns the TLS configuration with the roots in the --root
+// flag.
+func newTLSConfig(ctx *cli.Context) (*tls.Config, error) {
+	config := &tls.Config{}
+	if root := ctx.String("root"); root != "" {
+		pool, err := x509util.ReadCertPool(root)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// newClient returns the EST client with the given TLS configuration, and the
+// username and password in the flags.
+func newClient(ctx *cli.Context, tlsConfig *tls.Config) (*est.Client, error) {
+	if ctx.String("url") == "" {
+		return nil, errs.RequiredFlag(ctx, "url")
+	}
+	client := est.NewClient(ctx.String("url"), ctx.String("label"), &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: pki.WrapTransport(pki.NewTransport(tlsConfig)),
+	})
+
+	if ctx.IsSet("username") || ctx.IsSet("password-file") {
+		username := ctx.String("username")
+		var password []byte
+		var err error
+		if filename := ctx.String("password-file"); filename != "" {
+			password, err = utils.ReadPasswordFromFile(filename)
+		} else {
+			password, err = ui.PromptPassword("Please enter the EST password")
+		}
+		if err != nil {
+			return nil, err
+		}
+		client.SetBasicAuth(username, string(password))
+	}
+	return client, nil
+}
+
+// createCertificateRequest returns a certificate request signed with the
+// given key.
+func createCertificateRequest(template *x509.CertificateRequest, key crypto.PrivateKey) (*x509.CertificateRequest, error) {
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	return csr, errors.Wrap(err, "error parsing certificate request")
+}
+
+// encodeCertificates returns the given certificates in PEM format.
+func encodeCertificates(certs []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, c := range certs {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	return buf.Bytes()
+}
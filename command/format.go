@@ -0,0 +1,63 @@
+package command
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+)
+
+// StructuredOutput marks the given command as a command that supports the
+// global --format and --json flags, and returns it. Commands that are not
+// marked fail if a structured format is used, so their output is never mixed
+// with a JSON or YAML document.
+//
+// The command must print its results with ui.PrintSelected, or if it has its
+// own --format flag, the global format is used as the value of the flag if
+// it is not set, and the command is responsible of rendering it.
+func StructuredOutput(c cli.Command) cli.Command {
+	c.Before = func(ctx *cli.Context) error {
+		if err := setFormatFlag(ctx); err != nil {
+			return err
+		}
+		return getConfigVars(ctx)
+	}
+	return c
+}
+
+// textOutput is the Before function of the commands that are not marked with
+// StructuredOutput.
+func textOutput(ctx *cli.Context) error {
+	if ui.IsStructured() {
+		return errs.WithCode(errors.Errorf("'%s %s' does not support the flags '--format' and '--json'",
+			ctx.App.Name, ctx.Command.Name), errs.CodeUsage)
+	}
+	return getConfigVars(ctx)
+}
+
+// setFormatFlag sets the --format flag of a command using the global format,
+// if the command has the flag and it is not set. The global format is then
+// set back to text, as the output is rendered by the command.
+func setFormatFlag(ctx *cli.Context) error {
+	if !ui.IsStructured() || !hasFlag(ctx.Command.Flags, "format") {
+		return nil
+	}
+	if !ctx.IsSet("format") {
+		if err := ctx.Set("format", ui.Format()); err != nil {
+			return errors.Wrap(err, "error setting flag '--format'")
+		}
+	}
+	return ui.SetFormat(ui.FormatText)
+}
+
+// hasFlag returns true if one of the given flags has the given name.
+func hasFlag(flags []cli.Flag, name string) bool {
+	for _, f := range flags {
+		for _, n := range getFlagNames(f) {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
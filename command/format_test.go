@@ -0,0 +1,68 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+)
+
+func TestStructuredOutput(t *testing.T) {
+	defer ui.SetFormat(ui.FormatText)
+
+	var format string
+	var structured bool
+	action := func(ctx *cli.Context) error {
+		format = ctx.String("format")
+		structured = ui.IsStructured()
+		return nil
+	}
+	cmds := []cli.Command{
+		{Name: "text", Action: action},
+		StructuredOutput(cli.Command{Name: "selected", Action: action}),
+		StructuredOutput(cli.Command{Name: "render", Action: action, Flags: []cli.Flag{
+			cli.StringFlag{Name: "format", Value: "text"},
+		}}),
+	}
+	for i := range cmds {
+		setEnvVar(&cmds[i])
+	}
+
+	tests := map[string]struct {
+		format         string
+		args           []string
+		wantFormat     string
+		wantStructured bool
+		wantErr        bool
+	}{
+		"text":                 {ui.FormatText, []string{"text"}, "", false, false},
+		"text-selected":        {ui.FormatText, []string{"selected"}, "", false, false},
+		"text-render":          {ui.FormatText, []string{"render"}, "text", false, false},
+		"json-selected":        {ui.FormatJSON, []string{"selected"}, "", true, false},
+		"yaml-selected":        {ui.FormatYAML, []string{"selected"}, "", true, false},
+		"json-render":          {ui.FormatJSON, []string{"render"}, "json", false, false},
+		"json-render-flag":     {ui.FormatJSON, []string{"render", "--format", "pem"}, "pem", false, false},
+		"fail-json-text":       {ui.FormatJSON, []string{"text"}, "", false, true},
+		"fail-yaml-text":       {ui.FormatYAML, []string{"text"}, "", false, true},
+		"text-render-override": {ui.FormatText, []string{"render", "--format", "json"}, "json", false, false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			format, structured = "", false
+			assert.FatalError(t, ui.SetFormat(tc.format))
+
+			app := cli.NewApp()
+			app.Name = "step"
+			app.Commands = cmds
+			err := app.Run(append([]string{"step"}, tc.args...))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, tc.wantFormat, format)
+			assert.Equals(t, tc.wantStructured, structured)
+		})
+	}
+}
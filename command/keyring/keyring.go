@@ -0,0 +1,150 @@
+package keyring
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/keyring"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	cmd := cli.Command{
+		Name:      "keyring",
+		Usage:     "manage passwords in the keyring of the operating system",
+		UsageText: "step keyring <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step keyring** command group provides facilities to store provisioner
+passwords and key passphrases in the credential store of the operating system,
+so they don't need to be kept in plaintext files.
+
+The passwords are stored in the Secret Service (libsecret) on Linux, in the
+Keychain on macOS, and in the Credential Manager on Windows, using the service
+name 'step'.
+
+A password stored in the keyring can be used in any flag that expects a
+password file, like **--password-file**, using the URI <keyring:\<name\>>.
+
+The released binaries and packages of step do not include the keyring: these
+commands and the <keyring:\<name\>> URIs require a custom build of step with the
+keyring build tag, e.g. 'make build TAGS=keyring'. The go-keyring package used
+by the tag is not managed by dep, the build is tested with
+github.com/zalando/go-keyring v0.2.6 in the GOPATH.
+
+## EXAMPLES
+
+Store the password of a provisioner:
+'''
+$ step keyring set admin@example.com
+Please enter the password to store: ********
+'''
+
+Get a token using the password stored in the keyring:
+'''
+$ step ca token internal.example.com \
+  --provisioner admin@example.com --password-file keyring:admin@example.com
+'''
+
+Store the password of a key from a file, and remove the file:
+'''
+$ step keyring set intermediate-ca --password-file intermediate-pass.txt
+$ rm intermediate-pass.txt
+'''
+
+Remove a password from the keyring:
+'''
+$ step keyring delete admin@example.com
+'''`,
+		Subcommands: cli.Commands{
+			setCommand(),
+			deleteCommand(),
+		},
+	}
+
+	command.Register(cmd)
+}
+
+func setCommand() cli.Command {
+	return cli.Command{
+		Name:   "set",
+		Action: cli.ActionFunc(setAction),
+		Usage:  "store a password in the keyring",
+		UsageText: `**step keyring set** <name>
+[**--password-file**=<file>]`,
+		Description: `**step keyring set** stores a password in the keyring with the given name,
+replacing the previous one if it exists. The password is prompted unless the
+**--password-file** flag is used.
+
+## POSITIONAL ARGUMENTS
+
+<name>
+:  The name of the password. Use <keyring:\<name\>> as a password file to use it.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to store.`,
+			},
+		},
+	}
+}
+
+func deleteCommand() cli.Command {
+	return cli.Command{
+		Name:      "delete",
+		Action:    cli.ActionFunc(deleteAction),
+		Usage:     "remove a password from the keyring",
+		UsageText: `**step keyring delete** <name>`,
+		Description: `**step keyring delete** removes the password with the given name from the
+keyring.
+
+## POSITIONAL ARGUMENTS
+
+<name>
+:  The name of the password.`,
+	}
+}
+
+func setAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	name := ctx.Args().Get(0)
+	var (
+		err      error
+		password []byte
+	)
+	if passwordFile := ctx.String("password-file"); passwordFile != "" {
+		if keyring.IsURI(passwordFile) {
+			return errs.InvalidFlagValue(ctx, "password-file", passwordFile, "")
+		}
+		if password, err = utils.ReadPasswordFromFile(passwordFile); err != nil {
+			return err
+		}
+	} else {
+		password, err = ui.PromptPassword("Please enter the password to store", ui.WithValidateNotEmpty(), ui.WithFlag("password-file"))
+		if err != nil {
+			return errors.Wrap(err, "error reading password")
+		}
+	}
+
+	if err := keyring.Set(name, password); err != nil {
+		return err
+	}
+	ui.Printf("The password '%s' has been stored in the keyring, use %s:%s to use it.\n", name, keyring.Scheme, name)
+	return nil
+}
+
+func deleteAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	name := ctx.Args().Get(0)
+	if err := keyring.Delete(name); err != nil {
+		return err
+	}
+	ui.Printf("The password '%s' has been removed from the keyring.\n", name)
+	return nil
+}
@@ -0,0 +1,240 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/crypto/randutil"
+	"github.com/smallstep/cli/jose"
+	"github.com/smallstep/cli/keyring"
+)
+
+// tokenExpirationMargin is the time before the expiration of a token when it
+// is no longer used from the cache.
+const tokenExpirationMargin = time.Minute
+
+// cacheKeyName is the name of the key used to encrypt the cache in the
+// keyring.
+const cacheKeyName = "oauth-cache"
+
+// errInvalidCacheKey is the error returned by readCacheKey if the key stored
+// in the keyring is not a valid key.
+var errInvalidCacheKey = errors.New("invalid cache key")
+
+// cachedToken is the representation of a token in the cache.
+type cachedToken struct {
+	Token     *token    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// tokenCache stores the tokens returned by a provider encrypted in the
+// $STEPPATH/cache/oauth directory. Tokens are encrypted using a random key
+// stored in the keyring of the operating system. The key is never written to
+// disk, so the cache requires step to be compiled with the keyring build tag.
+type tokenCache struct {
+	filename string
+}
+
+// tokenCacheDir returns the directory where tokens are cached.
+func tokenCacheDir() string {
+	return filepath.Join(config.StepPath(), "cache", "oauth")
+}
+
+// newTokenCache returns the cache for the tokens identified by the given
+// parameters, e.g. the token endpoint, the client id and the scopes.
+func newTokenCache(params ...string) *tokenCache {
+	sum := sha256.Sum256([]byte(strings.Join(params, "\n")))
+	return &tokenCache{
+		filename: filepath.Join(tokenCacheDir(), fmt.Sprintf("%x.jwe", sum)),
+	}
+}
+
+// Get returns the cached token if it is still valid. If the token has expired
+// and it has a refresh token, a new token is requested to the provider and
+// cached. It returns nil if there is no usable token.
+func (c *tokenCache) Get(o *oauth, oidc bool) *token {
+	ct, err := c.read()
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if ct.isValid(now, oidc) {
+		ct.Token.ExpiresIn = int(ct.ExpiresAt.Sub(now).Seconds())
+		return ct.Token
+	}
+
+	if ct.Token.RefreshToken == "" {
+		return nil
+	}
+	tok, err := o.Refresh(ct.Token.RefreshToken)
+	if err != nil {
+		return nil
+	}
+	// The refresh token is not always rotated
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = ct.Token.RefreshToken
+	}
+	if oidc && tok.IDToken == "" {
+		return nil
+	}
+
+	c.Set(tok)
+	return tok
+}
+
+// Set stores the given token in the cache. Errors writing the cache are
+// ignored, the next call will just not find the token.
+func (c *tokenCache) Set(tok *token) {
+	if tok.ExpiresIn <= 0 && tok.RefreshToken == "" {
+		return
+	}
+
+	key, err := c.key()
+	if err != nil {
+		return
+	}
+	b, err := json.Marshal(cachedToken{
+		Token:     tok,
+		ExpiresAt: time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second),
+	})
+	if err != nil {
+		return
+	}
+
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{
+		Algorithm: jose.DIRECT,
+		Key:       key,
+	}, nil)
+	if err != nil {
+		return
+	}
+	jwe, err := encrypter.Encrypt(b)
+	if err != nil {
+		return
+	}
+	data, err := jwe.CompactSerialize()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.filename), 0700); err == nil {
+		ioutil.WriteFile(c.filename, []byte(data), 0600)
+	}
+}
+
+// read reads and decrypts the cached token.
+func (c *tokenCache) read() (*cachedToken, error) {
+	b, err := ioutil.ReadFile(c.filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := readCacheKey()
+	if err != nil {
+		return nil, err
+	}
+	jwe, err := jose.ParseEncrypted(string(b))
+	if err != nil {
+		return nil, err
+	}
+	data, err := jwe.Decrypt(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ct := new(cachedToken)
+	if err := json.Unmarshal(data, ct); err != nil {
+		return nil, err
+	}
+	if ct.Token == nil {
+		return nil, errors.New("invalid cached token")
+	}
+	return ct, nil
+}
+
+// key returns the key used to encrypt the cache, it creates a new one if it
+// does not exist or it is not valid. It fails if the keyring is not available,
+// e.g. if it is locked, so the cache is only removed if the key has to be
+// replaced.
+func (c *tokenCache) key() ([]byte, error) {
+	key, err := readCacheKey()
+	if err == nil {
+		return key, nil
+	}
+	if err != errInvalidCacheKey && !keyring.IsNotFound(err) {
+		return nil, err
+	}
+	key, err = randutil.Salt(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := keyring.Set(cacheKeyName, []byte(base64.RawURLEncoding.EncodeToString(key))); err != nil {
+		return nil, err
+	}
+	// Tokens encrypted with a previous key cannot be decrypted anymore
+	os.RemoveAll(tokenCacheDir())
+	return key, nil
+}
+
+// readCacheKey returns the key used to encrypt the cache from the keyring.
+func readCacheKey() ([]byte, error) {
+	b, err := keyring.Get(cacheKeyName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.RawURLEncoding.DecodeString(string(b))
+	if err != nil || len(key) != 32 {
+		return nil, errInvalidCacheKey
+	}
+	return key, nil
+}
+
+// isValid returns if the cached token can be used at the given time. If oidc
+// is true, the token must contain a valid id token.
+func (ct *cachedToken) isValid(now time.Time, oidc bool) bool {
+	now = now.Add(tokenExpirationMargin)
+	if !now.Before(ct.ExpiresAt) {
+		return false
+	}
+	if !oidc {
+		return true
+	}
+	if ct.Token.IDToken == "" {
+		return false
+	}
+
+	tok, err := jose.ParseSigned(ct.Token.IDToken)
+	if err != nil {
+		return false
+	}
+	var claims struct {
+		Expiry int64 `json:"exp"`
+	}
+	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return false
+	}
+	return now.Before(time.Unix(claims.Expiry, 0))
+}
+
+// Refresh requests a new token using the given refresh token.
+func (o *oauth) Refresh(refreshToken string) (*token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	data.Set("client_id", o.clientID)
+	if o.clientSecret != "" {
+		data.Set("client_secret", o.clientSecret)
+	}
+
+	return o.postToken(data)
+}
@@ -8,11 +8,11 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
-	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +23,7 @@ import (
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/exec"
 	"github.com/smallstep/cli/jose"
+	"github.com/smallstep/cli/keyring"
 	"github.com/smallstep/cli/pkg/x509"
 	"github.com/urfave/cli"
 )
@@ -47,8 +48,24 @@ const (
 	oobCallbackUrn = "urn:ietf:wg:oauth:2.0:oob"
 	// The URN for token request grant type jwt-bearer
 	jwtBearerUrn = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	// The URN for token request grant type device_code
+	deviceCodeUrn = "urn:ietf:params:oauth:grant-type:device_code"
+	// The URN for client assertion type jwt-bearer
+	jwtBearerClientAssertionUrn = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
 )
 
+type deviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURL         string `json:"verification_url"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+	Err                     string `json:"error,omitempty"`
+	ErrDesc                 string `json:"error_description,omitempty"`
+}
+
 type token struct {
 	AccessToken  string `json:"access_token"`
 	IDToken      string `json:"id_token"`
@@ -64,23 +81,43 @@ func init() {
 		Name:  "oauth",
 		Usage: "authorization and single sign-on using OAuth & OIDC",
 		UsageText: `
-**step oauth** [**--provider**=<provider>] [**--client-id**=<client-id> **--client-secret**=<client-secret>]
+**step oauth** [**--provider**=<provider> [**--tenant**=<tenant>]] [**--client-id**=<client-id> [**--client-secret**=<client-secret>]]
   [**--scope**=<scope> ...] [**--bare** [**--oidc**]] [**--header** [**--oidc**]]
+  [**--listen**=<address> [**--redirect-url**=<url>]] [**--cache** [**--force-login**]]
 
 **step oauth** **--authorization-endpoint**=<authorization-endpoint> **--token-endpoint**=<token-endpoint>
-  **--client-id**=<client-id> **--client-secret**=<client-secret> [**--scope**=<scope> ...] [**--bare** [**--oidc**]] [**--header** [**--oidc**]]
+  **--client-id**=<client-id> [**--client-secret**=<client-secret>] [**--scope**=<scope> ...] [**--bare** [**--oidc**]] [**--header** [**--oidc**]]
 
 **step oauth** [**--account**=<account>] [**--authorization-endpoint**=<authorization-endpoint> **--token-endpoint**=<token-endpoint>]
   [**--scope**=<scope> ...] [**--bare** [**--oidc**]] [**--header** [**--oidc**]]
 
 **step oauth** **--account**=<account> **--jwt** [**--scope**=<scope> ...] [**--header**] [**-bare**]
+
+**step oauth** **--client-credentials** **--client-id**=<client-id> [**--client-secret**=<client-secret> | **--key**=<file>]
+  [**--provider**=<provider> | **--token-endpoint**=<token-endpoint>] [**--scope**=<scope> ...] [**--bare**] [**--header**]
+
+**step oauth** **--jwt-bearer** **--client-id**=<client-id> **--key**=<file> [**--subject**=<subject>]
+  [**--provider**=<provider> | **--token-endpoint**=<token-endpoint>] [**--scope**=<scope> ...] [**--bare** [**--oidc**]] [**--header** [**--oidc**]]
+
+**step oauth** **--device** [**--provider**=<provider>] [**--client-id**=<client-id> [**--client-secret**=<client-secret>]]
+  [**--device-authorization-endpoint**=<device-authorization-endpoint> **--token-endpoint**=<token-endpoint>]
+  [**--scope**=<scope> ...] [**--bare** [**--oidc**]] [**--header** [**--oidc**]]
 `,
 		Flags: []cli.Flag{
 			cli.StringFlag{
-				Name:  "provider, idp",
-				Usage: "OAuth provider for authentication",
+				Name: "provider, idp",
+				Usage: `OAuth provider for authentication. It can be one of the presets 'google',
+'github', 'okta', 'auth0' or 'azure', or the https URL of an OpenID Connect or
+OAuth 2.0 issuer, its endpoints are retrieved using discovery.`,
 				Value: "google",
 			},
+			cli.StringFlag{
+				Name: "tenant",
+				Usage: `The <tenant> used with the providers 'okta', 'auth0' and 'azure'. For Okta it
+is the Okta domain (e.g. 'dev-123456.okta.com'), for Auth0 the tenant name or
+domain (e.g. 'example' or 'login.example.com'), and for Azure the tenant id or
+domain. Defaults to 'common' for Azure.`,
+			},
 			cli.StringFlag{
 				Name:  "email, e",
 				Usage: "Email to authenticate",
@@ -89,13 +126,33 @@ func init() {
 				Name:  "console, c",
 				Usage: "Complete the flow while remaining only inside the terminal",
 			},
+			cli.StringFlag{
+				Name: "listen",
+				Usage: `The callback server listens on <address>, e.g. ':10000' or '127.0.0.1:10000',
+instead of on a random port in the loopback interface. Useful when the OAuth
+client registration only allows specific redirect URIs.`,
+			},
+			cli.StringFlag{
+				Name: "redirect-url",
+				Usage: `The <url> sent to the provider as the redirect URI, e.g.
+'http://localhost:10000/callback'. It must point to the address used in
+**--listen**, its path is used as the callback path. Useful inside containers
+with port mapping. Requires **--listen**.`,
+			},
+			cli.BoolFlag{
+				Name: "device",
+				Usage: `Uses the device authorization grant (RFC 8628) to authenticate the user. The
+user code and verification URL are printed, so the flow can be completed using a
+browser on a different device. Useful in headless servers and SSH sessions.`,
+			},
 			cli.StringFlag{
 				Name:  "client-id",
 				Usage: "OAuth Client ID",
 			},
 			cli.StringFlag{
-				Name:  "client-secret",
-				Usage: "OAuth Client Secret",
+				Name: "client-secret",
+				Usage: `OAuth Client Secret. Public clients can omit it, the authorization code flow
+always uses PKCE (RFC 7636) with the S256 code challenge method.`,
 			},
 			cli.StringFlag{
 				Name:  "account",
@@ -109,6 +166,10 @@ func init() {
 				Name:  "token-endpoint",
 				Usage: "OAuth Token Endpoint",
 			},
+			cli.StringFlag{
+				Name:  "device-authorization-endpoint",
+				Usage: "OAuth Device Authorization Endpoint",
+			},
 			cli.BoolFlag{
 				Name:  "header",
 				Usage: "Output HTTP Authorization Header (suitable for use with curl)",
@@ -129,6 +190,43 @@ func init() {
 				Name:  "jwt",
 				Usage: "Generate a JWT Auth token instead of an OAuth Token (only works with service accounts)",
 			},
+			cli.BoolFlag{
+				Name: "cache",
+				Usage: `Caches the tokens encrypted in $STEPPATH/cache/oauth. Cached tokens are used
+until they expire, and expired tokens are refreshed using the refresh token if
+the provider returned one, so the browser is only opened when it is necessary.
+The encryption key is stored in the keyring of the operating system, so this
+flag requires step to be compiled with the keyring build tag.`,
+			},
+			cli.BoolFlag{
+				Name:  "force-login",
+				Usage: `Ignores the cached tokens and requests new ones. Requires **--cache**.`,
+			},
+			cli.BoolFlag{
+				Name: "client-credentials",
+				Usage: `Uses the client credentials grant (RFC 6749) to get a token for the client
+itself. The client authenticates using **--client-secret**, or using a JWT
+assertion signed with **--key** (RFC 7523).`,
+			},
+			cli.BoolFlag{
+				Name: "jwt-bearer",
+				Usage: `Uses the JWT bearer grant (RFC 7523) to get a token using a JWT assertion
+signed with **--key**.`,
+			},
+			cli.StringFlag{
+				Name: "key",
+				Usage: `The private key <file> used to sign the JWT assertion, it can be a JWK or a PEM
+encoded key. Requires **--client-credentials** or **--jwt-bearer**.`,
+			},
+			cli.StringFlag{
+				Name: "subject",
+				Usage: `The <subject> of the JWT assertion used in the JWT bearer grant. Defaults to the
+**--client-id**.`,
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the **--key**.`,
+			},
 			cli.BoolFlag{
 				Name:   "implicit",
 				Usage:  "Uses the implicit flow to authenticate the user. Requires **--insecure** and **--client-id** flags.",
@@ -148,14 +246,86 @@ func init() {
 
 func oauthCmd(c *cli.Context) error {
 	opts := &options{
-		Provider: c.String("provider"),
-		Email:    c.String("email"),
-		Console:  c.Bool("console"),
-		Implicit: c.Bool("implicit"),
+		Provider:    c.String("provider"),
+		Email:       c.String("email"),
+		Console:     c.Bool("console"),
+		Implicit:    c.Bool("implicit"),
+		Device:      c.Bool("device"),
+		Listen:      c.String("listen"),
+		RedirectURL: c.String("redirect-url"),
+		Tenant:      c.String("tenant"),
 	}
 	if err := opts.Validate(); err != nil {
 		return err
 	}
+	if opts.Listen != "" {
+		switch {
+		case opts.Console:
+			return errs.IncompatibleFlagWithFlag(c, "listen", "console")
+		case opts.Device:
+			return errs.IncompatibleFlagWithFlag(c, "listen", "device")
+		}
+	}
+	if opts.RedirectURL != "" && opts.Listen == "" {
+		return errs.RequiredWithFlag(c, "redirect-url", "listen")
+	}
+	if opts.Device {
+		switch {
+		case opts.Console:
+			return errs.IncompatibleFlagWithFlag(c, "device", "console")
+		case opts.Implicit:
+			return errs.IncompatibleFlagWithFlag(c, "device", "implicit")
+		case c.Bool("jwt"):
+			return errs.IncompatibleFlagWithFlag(c, "device", "jwt")
+		}
+	}
+
+	isClientCredentials := c.Bool("client-credentials")
+	isJWTBearer := c.Bool("jwt-bearer")
+	if isClientCredentials || isJWTBearer {
+		grant := "client-credentials"
+		if isJWTBearer {
+			grant = "jwt-bearer"
+		}
+		switch {
+		case isClientCredentials && isJWTBearer:
+			return errs.MutuallyExclusiveFlags(c, "client-credentials", "jwt-bearer")
+		case opts.Console:
+			return errs.IncompatibleFlagWithFlag(c, grant, "console")
+		case opts.Device:
+			return errs.IncompatibleFlagWithFlag(c, grant, "device")
+		case opts.Implicit:
+			return errs.IncompatibleFlagWithFlag(c, grant, "implicit")
+		case opts.Listen != "":
+			return errs.IncompatibleFlagWithFlag(c, grant, "listen")
+		case c.IsSet("account"):
+			return errs.IncompatibleFlagWithFlag(c, grant, "account")
+		case !c.IsSet("client-id"):
+			return errs.RequiredWithFlag(c, grant, "client-id")
+		case isJWTBearer && !c.IsSet("key"):
+			return errs.RequiredWithFlag(c, grant, "key")
+		case isClientCredentials && !c.IsSet("client-secret") && !c.IsSet("key"):
+			return errors.New("flag '--client-credentials' requires the '--client-secret' or '--key' flag")
+		}
+	} else {
+		switch {
+		case c.IsSet("key"):
+			return errors.New("flag '--key' requires the '--client-credentials' or '--jwt-bearer' flag")
+		case c.IsSet("subject"):
+			return errs.RequiredWithFlag(c, "subject", "jwt-bearer")
+		}
+	}
+	if isClientCredentials && c.IsSet("client-secret") && c.IsSet("key") {
+		return errs.MutuallyExclusiveFlags(c, "client-secret", "key")
+	}
+
+	if c.Bool("force-login") && !c.Bool("cache") {
+		return errs.RequiredWithFlag(c, "force-login", "cache")
+	}
+	if c.Bool("cache") && !keyring.Supported() {
+		return errs.WithCode(errors.New("flag '--cache' requires the keyring of the operating system: step was compiled without the keyring build tag"), errs.CodeUsage)
+	}
+
 	if (opts.Provider != "google" || c.IsSet("authorization-endpoint")) && !c.IsSet("client-id") {
 		return errors.New("flag '--client-id' required with '--provider'")
 	}
@@ -187,6 +357,29 @@ func oauthCmd(c *cli.Context) error {
 		authzEp = c.String("authorization-endpoint")
 		tokenEp = c.String("token-endpoint")
 	}
+	if c.IsSet("device-authorization-endpoint") {
+		if !opts.Device {
+			return errs.RequiredWithFlag(c, "device-authorization-endpoint", "device")
+		}
+		if !c.IsSet("token-endpoint") {
+			return errors.New("flag '--device-authorization-endpoint' requires flag '--token-endpoint'")
+		}
+		opts.Provider = ""
+		tokenEp = c.String("token-endpoint")
+	}
+	if (isClientCredentials || isJWTBearer) && c.IsSet("token-endpoint") {
+		opts.Provider = ""
+		tokenEp = c.String("token-endpoint")
+	}
+
+	// Key used to sign the JWT assertions
+	var jwk *jose.JSONWebKey
+	if c.IsSet("key") {
+		var err error
+		if jwk, err = parseAssertionKey(c.String("key"), c.String("password-file")); err != nil {
+			return err
+		}
+	}
 
 	do2lo := false
 	issuer := ""
@@ -208,7 +401,8 @@ func oauthCmd(c *cli.Context) error {
 			authzEp = details["auth_uri"].(string)
 			tokenEp = details["token_uri"].(string)
 			clientID = details["client_id"].(string)
-			clientSecret = details["client_secret"].(string)
+			// Public clients using PKCE might not have a client secret
+			clientSecret, _ = details["client_secret"].(string)
 		} else if accountType, ok := account["type"]; ok && "service_account" == accountType {
 			authzEp = account["auth_uri"].(string)
 			tokenEp = account["token_uri"].(string)
@@ -221,7 +415,20 @@ func oauthCmd(c *cli.Context) error {
 		}
 	}
 
+	if do2lo && opts.Device {
+		return errors.New("flag '--device' cannot be used with a service account")
+	}
+
 	scope := "openid email"
+	if p, ok := providers[opts.Provider]; ok {
+		scope = p.scope
+		if c.Bool("oidc") && !p.oidc {
+			return errors.Errorf("flag '--oidc' cannot be used with provider '%s'", opts.Provider)
+		}
+	}
+	if isClientCredentials || isJWTBearer {
+		scope = ""
+	}
 	if c.IsSet("scope") {
 		scope = strings.Join(c.StringSlice("scope"), " ")
 	}
@@ -230,22 +437,63 @@ func oauthCmd(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if c.IsSet("device-authorization-endpoint") {
+		o.deviceAuthzEndpoint = c.String("device-authorization-endpoint")
+	}
+
+	subject := c.String("subject")
+	if subject == "" {
+		subject = clientID
+	}
+
+	var grant string
+	switch {
+	case do2lo && c.Bool("jwt"):
+		grant = "jwt"
+	case do2lo:
+		grant = jwtBearerUrn + " " + issuer
+	case isClientCredentials:
+		grant = "client_credentials"
+	case isJWTBearer:
+		grant = jwtBearerUrn + " " + subject
+	default:
+		grant = "authorization_code"
+	}
 
 	var tok *token
-	if do2lo {
-		if c.Bool("jwt") {
-			tok, err = o.DoJWTAuthorization(issuer, scope)
-		} else {
-			tok, err = o.DoTwoLeggedAuthorization(issuer)
+	var cache *tokenCache
+	if c.Bool("cache") {
+		cache = newTokenCache(grant, o.tokenEndpoint, clientID, scope, opts.Email)
+		if !c.Bool("force-login") {
+			tok = cache.Get(o, c.Bool("oidc"))
 		}
-	} else if opts.Console {
-		tok, err = o.DoManualAuthorization()
-	} else {
-		tok, err = o.DoLoopbackAuthorization()
 	}
 
-	if err != nil {
-		return err
+	if tok == nil {
+		if do2lo {
+			if c.Bool("jwt") {
+				tok, err = o.DoJWTAuthorization(issuer, scope)
+			} else {
+				tok, err = o.DoTwoLeggedAuthorization(issuer)
+			}
+		} else if isClientCredentials {
+			tok, err = o.DoClientCredentialsAuthorization(jwk)
+		} else if isJWTBearer {
+			tok, err = o.DoJWTBearerAuthorization(jwk, subject)
+		} else if opts.Device {
+			tok, err = o.DoDeviceAuthorization()
+		} else if opts.Console {
+			tok, err = o.DoManualAuthorization()
+		} else {
+			tok, err = o.DoLoopbackAuthorization()
+		}
+
+		if err != nil {
+			return err
+		}
+		if cache != nil {
+			cache.Set(tok)
+		}
 	}
 
 	if c.Bool("header") {
@@ -274,36 +522,58 @@ func oauthCmd(c *cli.Context) error {
 }
 
 type options struct {
-	Provider string
-	Email    string
-	Console  bool
-	Implicit bool
+	Provider    string
+	Email       string
+	Console     bool
+	Implicit    bool
+	Device      bool
+	Listen      string
+	RedirectURL string
+	Tenant      string
 }
 
 // Validate validates the options.
 func (o *options) Validate() error {
-	if o.Provider != "google" && !strings.HasPrefix(o.Provider, "https://") {
-		return errors.New("Use a valid provider: google")
+	p, ok := providers[o.Provider]
+	if !ok && !strings.HasPrefix(o.Provider, "https://") {
+		return errors.Errorf("Use a valid provider: %s, or an https URL", strings.Join(providerNames(), ", "))
+	}
+	if o.Tenant != "" && (!ok || p.issuer == "") {
+		return errors.Errorf("flag '--tenant' cannot be used with provider '%s'", o.Provider)
+	}
+	if o.Listen != "" {
+		if _, _, err := net.SplitHostPort(o.Listen); err != nil {
+			return errors.Errorf("invalid value '%s' for flag '--listen': %v", o.Listen, err)
+		}
+	}
+	if o.RedirectURL != "" {
+		u, err := url.Parse(o.RedirectURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("invalid value '%s' for flag '--redirect-url'", o.RedirectURL)
+		}
 	}
 	return nil
 }
 
 type oauth struct {
-	provider         string
-	clientID         string
-	clientSecret     string
-	scope            string
-	loginHint        string
-	redirectURI      string
-	tokenEndpoint    string
-	authzEndpoint    string
-	userInfoEndpoint string // For testing
-	state            string
-	codeChallenge    string
-	nonce            string
-	implicit         bool
-	errCh            chan error
-	tokCh            chan *token
+	provider            string
+	clientID            string
+	clientSecret        string
+	scope               string
+	loginHint           string
+	redirectURI         string
+	listen              string
+	callbackPath        string
+	tokenEndpoint       string
+	authzEndpoint       string
+	deviceAuthzEndpoint string
+	userInfoEndpoint    string // For testing
+	state               string
+	codeVerifier        string
+	nonce               string
+	implicit            bool
+	errCh               chan error
+	tokCh               chan *token
 }
 
 func newOauth(provider, clientID, clientSecret, authzEp, tokenEp, scope string, opts *options) (*oauth, error) {
@@ -312,7 +582,7 @@ func newOauth(provider, clientID, clientSecret, authzEp, tokenEp, scope string,
 		return nil, err
 	}
 
-	challenge, err := randutil.Alphanumeric(64)
+	verifier, err := newCodeVerifier()
 	if err != nil {
 		return nil, err
 	}
@@ -322,94 +592,83 @@ func newOauth(provider, clientID, clientSecret, authzEp, tokenEp, scope string,
 		return nil, err
 	}
 
-	switch provider {
-	case "google":
-		return &oauth{
-			provider:         provider,
-			clientID:         clientID,
-			clientSecret:     clientSecret,
-			scope:            scope,
-			authzEndpoint:    "https://accounts.google.com/o/oauth2/v2/auth",
-			tokenEndpoint:    "https://www.googleapis.com/oauth2/v4/token",
-			userInfoEndpoint: "https://www.googleapis.com/oauth2/v3/userinfo",
-			loginHint:        opts.Email,
-			state:            state,
-			codeChallenge:    challenge,
-			nonce:            nonce,
-			implicit:         opts.Implicit,
-			errCh:            make(chan error),
-			tokCh:            make(chan *token),
-		}, nil
-	default:
-		userinfoEp := ""
-		if authzEp == "" && tokenEp == "" {
-			d, err := disco(provider)
-			if err != nil {
-				return nil, err
+	var userinfoEp, deviceAuthzEp string
+	if p, ok := providers[provider]; ok && p.issuer == "" {
+		authzEp = p.authzEndpoint
+		tokenEp = p.tokenEndpoint
+		deviceAuthzEp = p.deviceAuthzEndpoint
+		userinfoEp = p.userInfoEndpoint
+	} else if provider != "" && authzEp == "" && tokenEp == "" {
+		issuer := provider
+		if ok {
+			if issuer, err = p.issuerURL(opts.Tenant); err != nil {
+				return nil, errors.Errorf("flag '--tenant' is required with provider '%s'", provider)
 			}
+		}
 
-			if _, ok := d["authorization_endpoint"]; !ok {
-				return nil, errors.New("missing 'authorization_endpoint' in provider metadata")
-			}
-			if _, ok := d["token_endpoint"]; !ok {
-				return nil, errors.New("missing 'token_endpoint' in provider metadata")
-			}
-			authzEp = d["authorization_endpoint"].(string)
-			tokenEp = d["token_endpoint"].(string)
-			userinfoEp = d["token_endpoint"].(string)
-		}
-		return &oauth{
-			provider:         provider,
-			clientID:         clientID,
-			clientSecret:     clientSecret,
-			scope:            scope,
-			authzEndpoint:    authzEp,
-			tokenEndpoint:    tokenEp,
-			userInfoEndpoint: userinfoEp,
-			loginHint:        opts.Email,
-			state:            state,
-			codeChallenge:    challenge,
-			nonce:            nonce,
-			implicit:         opts.Implicit,
-			errCh:            make(chan error),
-			tokCh:            make(chan *token),
-		}, nil
+		d, err := disco(issuer)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := d["authorization_endpoint"]; !ok {
+			return nil, errors.New("missing 'authorization_endpoint' in provider metadata")
+		}
+		if _, ok := d["token_endpoint"]; !ok {
+			return nil, errors.New("missing 'token_endpoint' in provider metadata")
+		}
+		authzEp = d["authorization_endpoint"].(string)
+		tokenEp = d["token_endpoint"].(string)
+		if ep, ok := d["userinfo_endpoint"].(string); ok {
+			userinfoEp = ep
+		}
+		if ep, ok := d["device_authorization_endpoint"].(string); ok {
+			deviceAuthzEp = ep
+		}
 	}
+
+	return &oauth{
+		provider:            provider,
+		clientID:            clientID,
+		clientSecret:        clientSecret,
+		scope:               scope,
+		authzEndpoint:       authzEp,
+		tokenEndpoint:       tokenEp,
+		deviceAuthzEndpoint: deviceAuthzEp,
+		userInfoEndpoint:    userinfoEp,
+		loginHint:           opts.Email,
+		state:               state,
+		codeVerifier:        verifier,
+		nonce:               nonce,
+		implicit:            opts.Implicit,
+		listen:              opts.Listen,
+		redirectURI:         opts.RedirectURL,
+		errCh:               make(chan error),
+		tokCh:               make(chan *token),
+	}, nil
 }
 
-func disco(provider string) (map[string]interface{}, error) {
-	url, err := url.Parse(provider)
-	if err != nil {
-		return nil, err
-	}
-	// TODO: OIDC and OAuth specify two different ways of constructing this
-	// URL. This is the OIDC way. Probably want to try both. See
-	// https://tools.ietf.org/html/rfc8414#section-5
-	if strings.Index(url.Path, "/.well-known/openid-configuration") == -1 {
-		url.Path = path.Join(url.Path, "/.well-known/openid-configuration")
-	}
-	resp, err := http.Get(url.String())
-	if err != nil {
-		return nil, errors.Wrapf(err, "error retrieving %s", url.String())
-	}
-	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error retrieving %s", url.String())
-	}
-	details := make(map[string]interface{})
-	if err := json.Unmarshal(b, &details); err != nil {
-		return nil, errors.Wrapf(err, "error reading %s: unsupported format", url.String())
-	}
-	return details, err
+// newCodeVerifier returns a new PKCE code verifier. RFC 7636 defines the code
+// verifier as a random string of 43 to 128 unreserved characters.
+func newCodeVerifier() (string, error) {
+	return randutil.String(64, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~")
+}
+
+// codeChallenge returns the PKCE code challenge for the given code verifier
+// using the S256 method: BASE64URL-ENCODE(SHA256(ASCII(code_verifier))).
+func codeChallenge(verifier string) string {
+	s256 := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(s256[:])
 }
 
 // DoLoopbackAuthorization performs the log in into the identity provider
 // opening a browser and using a redirect_uri in a loopback IP address
 // (http://127.0.0.1:port or http://[::1]:port).
 func (o *oauth) DoLoopbackAuthorization() (*token, error) {
-	srv := httptest.NewServer(o)
-	o.redirectURI = srv.URL
+	srv, err := o.NewServer()
+	if err != nil {
+		return nil, err
+	}
 	defer srv.Close()
 
 	// Get auth url and open it in a browser
@@ -443,6 +702,50 @@ func (o *oauth) DoLoopbackAuthorization() (*token, error) {
 	}
 }
 
+// NewServer starts the server that handles the redirect from the identity
+// provider and sets the redirect URI. By default the server listens on a
+// random port in the loopback interface, the address can be set using
+// --listen and the redirect URI using --redirect-url.
+func (o *oauth) NewServer() (*httptest.Server, error) {
+	if o.listen == "" {
+		srv := httptest.NewServer(o)
+		o.redirectURI = srv.URL
+		o.callbackPath = "/"
+		return srv, nil
+	}
+
+	l, err := net.Listen("tcp", o.listen)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listening on %s", o.listen)
+	}
+	srv := &httptest.Server{
+		Listener: l,
+		Config:   &http.Server{Handler: o},
+	}
+	srv.Start()
+
+	if o.redirectURI == "" {
+		// Use the loopback address if listening on all interfaces
+		host, port, _ := net.SplitHostPort(l.Addr().String())
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			host = "127.0.0.1"
+		}
+		o.redirectURI = "http://" + net.JoinHostPort(host, port)
+	}
+
+	u, err := url.Parse(o.redirectURI)
+	if err != nil {
+		srv.Close()
+		return nil, errors.Wrapf(err, "error parsing %s", o.redirectURI)
+	}
+	o.callbackPath = u.Path
+	if o.callbackPath == "" {
+		o.callbackPath = "/"
+	}
+
+	return srv, nil
+}
+
 // DoManualAuthorization performs the log in into the identity provider
 // allowing the user to open a browser on a different system and then entering
 // the authorization code on the Step CLI.
@@ -465,6 +768,7 @@ func (o *oauth) DoManualAuthorization() (*token, error) {
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	code = strings.TrimSpace(code)
 
 	tok, err := o.Exchange(o.tokenEndpoint, code)
 	if err != nil {
@@ -476,6 +780,241 @@ func (o *oauth) DoManualAuthorization() (*token, error) {
 	return tok, nil
 }
 
+// DoDeviceAuthorization performs the log in into the identity provider using
+// the device authorization grant described in RFC 8628. The user opens the
+// verification URL in a browser on any device and enters the user code while
+// the Step CLI polls the token endpoint.
+func (o *oauth) DoDeviceAuthorization() (*token, error) {
+	if o.deviceAuthzEndpoint == "" {
+		return nil, errors.New("the provider does not support the device authorization grant, use the flag '--device-authorization-endpoint'")
+	}
+
+	data := url.Values{}
+	data.Set("client_id", o.clientID)
+	data.Set("scope", o.scope)
+
+	resp, err := postForm(o.deviceAuthzEndpoint, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error from device authorization endpoint")
+	}
+	defer resp.Body.Close()
+
+	var dc deviceCode
+	if err := json.NewDecoder(resp.Body).Decode(&dc); err != nil {
+		return nil, errors.Wrap(err, "error reading device authorization response")
+	}
+	if dc.Err != "" || dc.ErrDesc != "" {
+		return nil, errors.Errorf("Error requesting device code: %s. %s", dc.Err, dc.ErrDesc)
+	}
+	// Google uses verification_url instead of verification_uri
+	if dc.VerificationURI == "" {
+		dc.VerificationURI = dc.VerificationURL
+	}
+	if dc.DeviceCode == "" || dc.UserCode == "" || dc.VerificationURI == "" {
+		return nil, errors.New("error reading device authorization response: missing device code, user code or verification uri")
+	}
+
+	fmt.Fprintln(os.Stderr, "Open a web browser on any device and visit:")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, dc.VerificationURI)
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "And enter the code:", dc.UserCode)
+	fmt.Fprintln(os.Stderr)
+	if dc.VerificationURIComplete != "" {
+		fmt.Fprintln(os.Stderr, "Or visit the following URL to skip entering the code:")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, dc.VerificationURIComplete)
+		fmt.Fprintln(os.Stderr)
+	}
+
+	// Defaults defined in RFC 8628
+	interval := 5 * time.Second
+	if dc.Interval > 0 {
+		interval = time.Duration(dc.Interval) * time.Second
+	}
+	expiresIn := 5 * time.Minute
+	if dc.ExpiresIn > 0 {
+		expiresIn = time.Duration(dc.ExpiresIn) * time.Second
+	}
+
+	deadline := time.Now().Add(expiresIn)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		tok, err := o.ExchangeDeviceCode(o.tokenEndpoint, dc.DeviceCode)
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok.Err {
+		case "":
+			return tok, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, errors.Errorf("Error exchanging device code: %s. %s", tok.Err, tok.ErrDesc)
+		}
+	}
+
+	return nil, errors.New("oauth command timed out, please try again")
+}
+
+// ExchangeDeviceCode exchanges the device code for refresh and access tokens.
+// If the user has not completed the authorization yet the error in the token
+// will be authorization_pending.
+func (o *oauth) ExchangeDeviceCode(tokenEndpoint, code string) (*token, error) {
+	data := url.Values{}
+	data.Set("device_code", code)
+	data.Set("client_id", o.clientID)
+	if o.clientSecret != "" {
+		data.Set("client_secret", o.clientSecret)
+	}
+	data.Set("grant_type", deviceCodeUrn)
+
+	resp, err := postForm(tokenEndpoint, data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	var tok token
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &tok, nil
+}
+
+// DoClientCredentialsAuthorization performs the client credentials grant
+// described in RFC 6749. If a key is given the client authenticates using a
+// JWT assertion as described in RFC 7523, if not it uses the client secret.
+func (o *oauth) DoClientCredentialsAuthorization(jwk *jose.JSONWebKey) (*token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	data.Set("client_id", o.clientID)
+	if o.scope != "" {
+		data.Set("scope", o.scope)
+	}
+	if jwk != nil {
+		assertion, err := o.signAssertion(jwk, o.clientID)
+		if err != nil {
+			return nil, err
+		}
+		data.Set("client_assertion_type", jwtBearerClientAssertionUrn)
+		data.Set("client_assertion", assertion)
+	} else {
+		data.Set("client_secret", o.clientSecret)
+	}
+
+	return o.postToken(data)
+}
+
+// DoJWTBearerAuthorization performs the JWT bearer grant described in RFC
+// 7523 using an assertion for the given subject signed with the given key.
+func (o *oauth) DoJWTBearerAuthorization(jwk *jose.JSONWebKey, subject string) (*token, error) {
+	assertion, err := o.signAssertion(jwk, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", jwtBearerUrn)
+	data.Set("assertion", assertion)
+	data.Set("client_id", o.clientID)
+	if o.clientSecret != "" {
+		data.Set("client_secret", o.clientSecret)
+	}
+	if o.scope != "" {
+		data.Set("scope", o.scope)
+	}
+
+	return o.postToken(data)
+}
+
+// signAssertion returns a JWT assertion for the token endpoint signed with the
+// given key, as described in RFC 7523. The issuer is the client id.
+func (o *oauth) signAssertion(jwk *jose.JSONWebKey, subject string) (string, error) {
+	jti, err := randutil.Hex(64)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	c := map[string]interface{}{
+		"iss": o.clientID,
+		"sub": subject,
+		"aud": o.tokenEndpoint,
+		"iat": now,
+		"nbf": now,
+		"exp": now + 300,
+		"jti": jti,
+	}
+
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	if jwk.KeyID != "" {
+		so.WithHeader("kid", jwk.KeyID)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.SignatureAlgorithm(jwk.Algorithm),
+		Key:       jwk.Key,
+	}, so)
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating JWT signer")
+	}
+
+	raw, err := jose.Signed(signer).Claims(c).CompactSerialize()
+	if err != nil {
+		return "", errors.Wrapf(err, "error serializing JWT")
+	}
+	return raw, nil
+}
+
+// postToken sends the given parameters to the token endpoint and returns the
+// token in the response.
+func (o *oauth) postToken(data url.Values) (*token, error) {
+	resp, err := postForm(o.tokenEndpoint, data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error from token endpoint")
+	}
+	defer resp.Body.Close()
+
+	var tok token
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if tok.Err != "" || tok.ErrDesc != "" {
+		return nil, errors.Errorf("Error requesting token: %s. %s", tok.Err, tok.ErrDesc)
+	}
+
+	return &tok, nil
+}
+
+// parseAssertionKey reads the private key used to sign JWT assertions.
+func parseAssertionKey(filename, passwordFile string) (*jose.JSONWebKey, error) {
+	opts := []jose.Option{jose.WithUse("sig")}
+	if passwordFile != "" {
+		opts = append(opts, jose.WithPasswordFile(passwordFile))
+	}
+
+	jwk, err := jose.ParseKey(filename, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if jwk.IsPublic() {
+		return nil, errors.New("cannot use a public key for signing")
+	}
+	if jwk.Algorithm == "" {
+		return nil, errors.Errorf("error reading %s: cannot determine the signature algorithm", filename)
+	}
+	if err := jose.ValidateJWK(jwk); err != nil {
+		return nil, err
+	}
+	return jwk, nil
+}
+
 // DoTwoLeggedAuthorization performs two-legged OAuth using the jwt-bearer
 // grant type.
 func (o *oauth) DoTwoLeggedAuthorization(issuer string) (*token, error) {
@@ -525,7 +1064,7 @@ func (o *oauth) DoTwoLeggedAuthorization(issuer string) (*token, error) {
 	}
 
 	// Send the POST request and return token.
-	resp, err := http.PostForm(o.tokenEndpoint, params)
+	resp, err := postForm(o.tokenEndpoint, params)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error from token endpoint")
 	}
@@ -588,7 +1127,7 @@ func (o *oauth) DoJWTAuthorization(issuer, aud string) (*token, error) {
 // ServeHTTP is the handler that performs the OAuth 2.0 dance and returns the
 // tokens using channels.
 func (o *oauth) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if req.URL.Path != "/" {
+	if req.URL.Path != o.callbackPath {
 		http.NotFound(w, req)
 		return
 	}
@@ -704,8 +1243,7 @@ func (o *oauth) Auth() (string, error) {
 	} else {
 		q.Add("response_type", "code")
 		q.Add("code_challenge_method", "S256")
-		s256 := sha256.Sum256([]byte(o.codeChallenge))
-		q.Add("code_challenge", base64.RawURLEncoding.EncodeToString(s256[:]))
+		q.Add("code_challenge", codeChallenge(o.codeVerifier))
 	}
 	q.Add("scope", o.scope)
 	q.Add("state", o.state)
@@ -722,12 +1260,16 @@ func (o *oauth) Exchange(tokenEndpoint, code string) (*token, error) {
 	data := url.Values{}
 	data.Set("code", code)
 	data.Set("client_id", o.clientID)
-	data.Set("client_secret", o.clientSecret)
+	// Public clients authenticate using only the PKCE code verifier, and some
+	// providers reject requests with an empty client_secret.
+	if o.clientSecret != "" {
+		data.Set("client_secret", o.clientSecret)
+	}
 	data.Set("redirect_uri", o.redirectURI)
 	data.Set("grant_type", "authorization_code")
-	data.Set("code_verifier", o.codeChallenge)
+	data.Set("code_verifier", o.codeVerifier)
 
-	resp, err := http.PostForm(tokenEndpoint, data)
+	resp, err := postForm(tokenEndpoint, data)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
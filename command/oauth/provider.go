@@ -0,0 +1,156 @@
+package oauth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// provider is the configuration of a well-known identity provider. Providers
+// define either fixed endpoints or an issuer used for discovery.
+type provider struct {
+	// issuer is the issuer URL used for discovery, {tenant} is replaced by
+	// the value of --tenant or defaultTenant.
+	issuer        string
+	defaultTenant string
+	tenantSuffix  string
+	// Fixed endpoints, used if issuer is empty.
+	authzEndpoint       string
+	tokenEndpoint       string
+	deviceAuthzEndpoint string
+	userInfoEndpoint    string
+	// scope is the default scope for the provider.
+	scope string
+	// oidc indicates that the provider returns id tokens.
+	oidc bool
+}
+
+// providers are the well-known identity providers supported by --provider.
+var providers = map[string]provider{
+	"google": {
+		authzEndpoint:       "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenEndpoint:       "https://www.googleapis.com/oauth2/v4/token",
+		deviceAuthzEndpoint: "https://oauth2.googleapis.com/device/code",
+		userInfoEndpoint:    "https://www.googleapis.com/oauth2/v3/userinfo",
+		scope:               "openid email",
+		oidc:                true,
+	},
+	"github": {
+		authzEndpoint:       "https://github.com/login/oauth/authorize",
+		tokenEndpoint:       "https://github.com/login/oauth/access_token",
+		deviceAuthzEndpoint: "https://github.com/login/device/code",
+		userInfoEndpoint:    "https://api.github.com/user",
+		scope:               "read:user user:email",
+	},
+	"okta": {
+		issuer: "https://{tenant}/oauth2/default",
+		scope:  "openid email profile",
+		oidc:   true,
+	},
+	"auth0": {
+		issuer:       "https://{tenant}/",
+		tenantSuffix: ".auth0.com",
+		scope:        "openid email profile",
+		oidc:         true,
+	},
+	"azure": {
+		issuer:        "https://login.microsoftonline.com/{tenant}/v2.0",
+		defaultTenant: "common",
+		scope:         "openid email profile offline_access",
+		oidc:          true,
+	},
+}
+
+// providerNames returns the sorted list of provider presets.
+func providerNames() []string {
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// issuerURL returns the issuer of the provider for the given tenant. If the
+// tenant does not contain a domain, the provider suffix is added.
+func (p provider) issuerURL(tenant string) (string, error) {
+	if tenant == "" {
+		tenant = p.defaultTenant
+	}
+	if tenant == "" {
+		return "", errors.New("missing tenant")
+	}
+	if p.tenantSuffix != "" && !strings.Contains(tenant, ".") {
+		tenant += p.tenantSuffix
+	}
+	return strings.Replace(p.issuer, "{tenant}", tenant, -1), nil
+}
+
+// disco returns the metadata of the given issuer. It tries first the OpenID
+// Connect discovery document, and then the OAuth 2.0 authorization server
+// metadata defined in RFC 8414.
+func disco(issuer string) (map[string]interface{}, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", issuer)
+	}
+
+	var urls []string
+	if strings.Contains(u.Path, "/.well-known/") {
+		urls = append(urls, u.String())
+	} else {
+		// OpenID Connect Discovery 1.0 appends the well-known path.
+		oidc := *u
+		oidc.Path = path.Join(u.Path, "/.well-known/openid-configuration")
+		// RFC 8414 inserts the well-known path between the host and the path.
+		oauth := *u
+		oauth.Path = path.Join("/.well-known/oauth-authorization-server", u.Path)
+		urls = append(urls, oidc.String(), oauth.String())
+	}
+
+	for i, u := range urls {
+		details, err := getMetadata(u)
+		if err == nil || i == len(urls)-1 {
+			return details, err
+		}
+	}
+	return nil, errors.Errorf("error retrieving %s", issuer)
+}
+
+func getMetadata(u string) (map[string]interface{}, error) {
+	resp, err := http.Get(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error retrieving %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error retrieving %s: %s", u, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error retrieving %s", u)
+	}
+	details := make(map[string]interface{})
+	if err := json.Unmarshal(b, &details); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s: unsupported format", u)
+	}
+	return details, nil
+}
+
+// postForm sends the given form to the url, asking for a JSON response. Some
+// providers, like GitHub, respond with a form encoded body by default.
+func postForm(u string, data url.Values) (*http.Response, error) {
+	req, err := http.NewRequest("POST", u, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return http.DefaultClient.Do(req)
+}
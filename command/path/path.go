@@ -2,23 +2,164 @@ package path
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
 	"github.com/urfave/cli"
 )
 
 func init() {
 	cmd := cli.Command{
-		Name:        "path",
-		Usage:       "print the configured step path and exit",
-		UsageText:   "step path",
-		Description: "**step ca** command prints the configured step path and exit",
-		Action: cli.ActionFunc(func(ctx *cli.Context) error {
-			fmt.Println(config.StepPath())
-			return nil
-		}),
+		Name:      "path",
+		Usage:     "print the configured step path and exit",
+		UsageText: "**step path** [**--context**=<name>]",
+		Description: `**step path** command prints the configured step path and exit. The step path
+is the directory where the configuration, certificates and secrets are stored.
+
+The step path is resolved in the following order:
+
+1. The environment variable STEPPATH.
+
+2. The base path set with **step path base --set**, stored per user in
+<$XDG_CONFIG_HOME/step/path> or <$HOME/.config/step/path>.
+
+3. The default <$HOME/.step>.
+
+If a context is in use, see **step context**, the step path is the directory
+of that context under the base path.
+
+## EXAMPLES
+
+Print the step path:
+'''
+$ step path
+/home/user/.step
+'''
+
+Print the directory of a context:
+'''
+$ step path --context prod
+/home/user/.step/authorities/prod
+'''
+
+Use a different step path for a single agent:
+'''
+$ STEPPATH=/var/lib/agent/step step ca bootstrap --ca-url https://ca.example.com \
+  --fingerprint 0d7d3834cf187726cf331c40a31aa7ef6b29ba4df601416c9788f6ee01058cf3
+'''`,
+		Action: cli.ActionFunc(pathAction),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "context",
+				Usage: "Print the directory of the context with the given <name>.",
+			},
+		},
+		Subcommands: cli.Commands{
+			baseCommand(),
+		},
 	}
 
 	command.Register(cmd)
 }
+
+func baseCommand() cli.Command {
+	return cli.Command{
+		Name:      "base",
+		Action:    cli.ActionFunc(baseAction),
+		Usage:     "print or set the base step path",
+		UsageText: `**step path base** [**--set**=<dir>] [**--unset**]`,
+		Description: `**step path base** prints the base step path. The base path is the step path
+without taking into account the current context, and it's the directory
+where the contexts are stored.
+
+With **--set** the given directory becomes the base step path of the current
+user, it will be created if it does not exist. The environment variable
+STEPPATH always takes precedence over it.
+
+## EXAMPLES
+
+Print the base step path:
+'''
+$ step path base
+/home/user/.step
+'''
+
+Use a different directory as the base step path:
+'''
+$ step path base --set /srv/step
+'''
+
+Go back to use <$HOME/.step>:
+'''
+$ step path base --unset
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "set",
+				Usage: "Set the base step path to the given <dir>.",
+			},
+			cli.BoolFlag{
+				Name:  "unset",
+				Usage: "Remove the base step path set with **--set**.",
+			},
+		},
+	}
+}
+
+func pathAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+
+	if name := ctx.String("context"); name != "" {
+		if !config.ContextExists(name) {
+			return errors.Errorf("context '%s' does not exist", name)
+		}
+		fmt.Println(config.ContextPath(name))
+		return nil
+	}
+
+	fmt.Println(config.StepPath())
+	return nil
+}
+
+func baseAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+
+	dir, unset := ctx.String("set"), ctx.Bool("unset")
+	switch {
+	case dir != "" && unset:
+		return errs.IncompatibleFlagWithFlag(ctx, "set", "unset")
+	case ctx.IsSet("set") && dir == "":
+		return errs.InvalidFlagValue(ctx, "set", dir, "")
+	case dir == "" && !unset:
+		fmt.Println(config.BasePath())
+		return nil
+	}
+
+	if dir != "" {
+		var err error
+		if dir, err = filepath.Abs(dir); err != nil {
+			return errors.Wrapf(err, "error getting absolute path of %s", dir)
+		}
+	}
+	if err := config.SetBasePath(dir); err != nil {
+		return err
+	}
+	if unset {
+		ui.Printf("The base step path has been removed from %s.\n", config.BasePathFile())
+	} else {
+		ui.Printf("The base step path has been set to %s in %s.\n", dir, config.BasePathFile())
+	}
+	if os.Getenv(config.StepPathEnv) != "" {
+		ui.Printf("The environment variable %s is defined and it will be used instead.\n", config.StepPathEnv)
+	}
+	return nil
+}
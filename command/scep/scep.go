@@ -0,0 +1,440 @@
+package scep
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/crypto/scep"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	cmd := cli.Command{
+		Name:      "scep",
+		Usage:     "request certificates from SCEP servers",
+		UsageText: "step scep <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step scep** command group implements the client side of the Simple
+Certificate Enrollment Protocol (SCEP), RFC 8894, to request certificates from
+existing enterprise CAs like Microsoft NDES.
+
+The messages are signed and encrypted with RSA keys, so the certificates
+requested with SCEP always have RSA keys. The certificates of the CA returned
+by the server are verified with the **--root** or **--fingerprint** flags
+before they are used.
+
+## EXAMPLES
+
+Request a certificate from NDES using a challenge password:
+'''
+$ step scep enroll device01.example.com device01.crt device01.key \
+  --url https://ndes.example.com/certsrv/mscep/mscep.dll \
+  --challenge-file challenge.txt --root enterprise_root.crt
+'''
+
+Renew the certificate before it expires:
+'''
+$ step scep renew device01.crt device01.key \
+  --url https://ndes.example.com/certsrv/mscep/mscep.dll --force
+'''`,
+		Subcommands: cli.Commands{
+			enrollCommand(),
+			renewCommand(),
+		},
+	}
+
+	command.Register(cmd)
+}
+
+var (
+	urlFlag = cli.StringFlag{
+		Name:  "url",
+		Usage: `The <url> of the SCEP server, e.g. 'https://ndes.example.com/certsrv/mscep/mscep.dll'.`,
+	}
+	rootFlag = cli.StringFlag{
+		Name: "root",
+		Usage: `The path to the PEM <file> with the root certificate used to verify the
+certificates returned by the SCEP server.`,
+	}
+	fingerprintFlag = cli.StringFlag{
+		Name: "fingerprint",
+		Usage: `The SHA-256 <fingerprint> of the CA certificate returned by the SCEP server,
+used to verify the certificates returned by it.`,
+	}
+	caIdentifierFlag = cli.StringFlag{
+		Name:  "ca-identifier",
+		Usage: `The <identifier> of the CA, required by servers with multiple CAs.`,
+	}
+	pollIntervalFlag = cli.DurationFlag{
+		Name:  "poll-interval",
+		Usage: `The <duration> between requests while the request is pending approval.`,
+		Value: 30 * time.Second,
+	}
+	waitFlag = cli.DurationFlag{
+		Name: "wait",
+		Usage: `The maximum <duration> to wait for the approval of a pending request. By
+default, the command fails if the request is not approved immediately.`,
+	}
+)
+
+func enrollCommand() cli.Command {
+	return cli.Command{
+		Name:   "enroll",
+		Action: command.ActionFunc(enrollAction),
+		Usage:  "request a new certificate from a SCEP server",
+		UsageText: `**step scep enroll** <subject> <crt-file> <key-file>
+**--url**=<url> [**--challenge-file**=<file>] [**--san**=<SAN>]
+[**--size**=<size>] [**--root**=<file>] [**--fingerprint**=<fingerprint>]
+[**--ca-identifier**=<identifier>] [**--poll-interval**=<duration>]
+[**--wait**=<duration>] [**--force**]`,
+		Description: `**step scep enroll** generates a new RSA key and requests a certificate for it
+from a SCEP server using a PKCSReq message. The certificate is written with the
+rest of the certificates in the response, and the key is written unencrypted.
+
+Most servers authorize the requests with a one-time challenge password, e.g.
+the one in the NDES admin page, set with the **--challenge-file** flag. If the
+request is pending approval, use the **--wait** flag to wait for it.
+
+## POSITIONAL ARGUMENTS
+
+<subject>
+:  The Common Name of the certificate.
+
+<crt-file>
+:  File to write the certificate (PEM format)
+
+<key-file>
+:  File to write the private key (PEM format)
+
+## EXAMPLES
+
+Request a certificate using a challenge password:
+'''
+$ step scep enroll device01.example.com device01.crt device01.key \
+  --url https://ndes.example.com/certsrv/mscep/mscep.dll \
+  --challenge-file challenge.txt --root enterprise_root.crt
+'''
+
+Request a certificate with SANs, verifying the CA with its fingerprint, and
+wait up to one hour for a manual approval:
+'''
+$ step scep enroll device01.example.com device01.crt device01.key \
+  --url http://scep.example.com/scep --san device01.example.com --san 10.0.0.10 \
+  --fingerprint 6c1d0b2ed2e0a2e0f9c4a4e4b3c2bd1b9e7ad33e8d3c4b1ad4c6e0a2e2b7f1d2 \
+  --wait 1h
+'''`,
+		Flags: []cli.Flag{
+			urlFlag,
+			cli.StringFlag{
+				Name:  "challenge-file",
+				Usage: `The path to the <file> containing the challenge password of the request.`,
+			},
+			cli.StringSliceFlag{
+				Name: "san",
+				Usage: `Add DNS or IP Address Subjective Alternative Names (SANs). Use the '--san'
+flag multiple times to configure multiple SANs.`,
+			},
+			cli.IntFlag{
+				Name:  "size",
+				Usage: `The <size> (in bits) of the RSA key. The minimum size is 2048 bits.`,
+				Value: 2048,
+			},
+			rootFlag,
+			fingerprintFlag,
+			caIdentifierFlag,
+			pollIntervalFlag,
+			waitFlag,
+			flags.Force,
+		},
+	}
+}
+
+func renewCommand() cli.Command {
+	return cli.Command{
+		Name:   "renew",
+		Action: command.ActionFunc(renewAction),
+		Usage:  "renew a certificate using a SCEP server",
+		UsageText: `**step scep renew** <crt-file> <key-file>
+**--url**=<url> [**--out**=<file>] [**--root**=<file>]
+[**--fingerprint**=<fingerprint>] [**--ca-identifier**=<identifier>]
+[**--poll-interval**=<duration>] [**--wait**=<duration>] [**--force**]`,
+		Description: `**step scep renew** requests a new certificate with the subject and the key of
+an existing one, signing the request with the current certificate. It uses a
+RenewalReq message if the server supports it, or a PKCSReq otherwise.
+
+Without the **--root** and **--fingerprint** flags, the certificates returned by
+the server are trusted if they include the issuer of the current certificate.
+
+## POSITIONAL ARGUMENTS
+
+<crt-file>
+:  The certificate in PEM format that we want to renew.
+
+<key-file>
+:  The key file of the certificate.
+
+## EXAMPLES
+
+Renew a certificate:
+'''
+$ step scep renew device01.crt device01.key \
+  --url https://ndes.example.com/certsrv/mscep/mscep.dll --force
+'''
+
+Renew a certificate and write it to a new file:
+'''
+$ step scep renew device01.crt device01.key --out device01-new.crt \
+  --url https://ndes.example.com/certsrv/mscep/mscep.dll
+'''`,
+		Flags: []cli.Flag{
+			urlFlag,
+			cli.StringFlag{
+				Name:  "out,output-file",
+				Usage: "The new certificate <file> path. Defaults to overwriting the <crt-file> positional argument",
+			},
+			rootFlag,
+			fingerprintFlag,
+			caIdentifierFlag,
+			pollIntervalFlag,
+			waitFlag,
+			flags.Force,
+		},
+	}
+}
+
+func enrollAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 3); err != nil {
+		return err
+	}
+	args := ctx.Args()
+	subject, crtFile, keyFile := args.Get(0), args.Get(1), args.Get(2)
+	if ctx.String("url") == "" {
+		return errs.RequiredFlag(ctx, "url")
+	}
+	if ctx.String("root") == "" && ctx.String("fingerprint") == "" {
+		return errs.RequiredOrFlag(ctx, "root", "fingerprint")
+	}
+	size := ctx.Int("size")
+	if size < 2048 {
+		return errs.MinSizeFlag(ctx, "size", "2048")
+	}
+	var challenge string
+	if filename := ctx.String("challenge-file"); filename != "" {
+		var err error
+		if challenge, err = utils.ReadStringPasswordFromFile(filename); err != nil {
+			return err
+		}
+	}
+
+	client := newClient(ctx)
+	caCerts, err := getCACerts(ctx, client, nil)
+	if err != nil {
+		return err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, size)
+	if err != nil {
+		return errors.Wrap(err, "error generating RSA key")
+	}
+	dnsNames, ips := x509util.SplitSANs(ctx.StringSlice("san"))
+	csr, err := scep.NewCertificateRequest(&x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: subject},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, key, challenge)
+	if err != nil {
+		return err
+	}
+	signer, err := scep.NewSignerCertificate(csr, key)
+	if err != nil {
+		return err
+	}
+
+	certs, err := client.Enroll(&scep.EnrollRequest{
+		CSR:          csr,
+		SignerCert:   signer,
+		SignerKey:    key,
+		CACerts:      caCerts,
+		PollInterval: ctx.Duration("poll-interval"),
+		Timeout:      ctx.Duration("wait"),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeCertificates(crtFile, certs); err != nil {
+		return err
+	}
+	if _, err := pemutil.Serialize(key, pemutil.ToFile(keyFile, 0600)); err != nil {
+		return err
+	}
+
+	ui.PrintSelected("Certificate", crtFile)
+	ui.PrintSelected("Private Key", keyFile)
+	return nil
+}
+
+func renewAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+	args := ctx.Args()
+	crtFile, keyFile := args.Get(0), args.Get(1)
+	if ctx.String("url") == "" {
+		return errs.RequiredFlag(ctx, "url")
+	}
+	outFile := ctx.String("out")
+	if outFile == "" {
+		outFile = crtFile
+	}
+
+	crt, err := pemutil.ReadCertificate(crtFile)
+	if err != nil {
+		return err
+	}
+	v, err := pemutil.ReadPrivateKey(keyFile)
+	if err != nil {
+		return err
+	}
+	key, ok := v.(*rsa.PrivateKey)
+	if !ok {
+		return errors.Errorf("key %s is not an RSA key: SCEP only supports RSA keys", keyFile)
+	}
+	pub, ok := crt.PublicKey.(*rsa.PublicKey)
+	if !ok || pub.N.Cmp(key.N) != 0 || pub.E != key.E {
+		return errors.Errorf("key %s does not match the certificate %s", keyFile, crtFile)
+	}
+
+	client := newClient(ctx)
+	caCerts, err := getCACerts(ctx, client, crt)
+	if err != nil {
+		return err
+	}
+
+	csr, err := scep.NewCertificateRequest(&x509.CertificateRequest{
+		Subject:        crt.Subject,
+		DNSNames:       crt.DNSNames,
+		IPAddresses:    crt.IPAddresses,
+		EmailAddresses: crt.EmailAddresses,
+		URIs:           crt.URIs,
+	}, key, "")
+	if err != nil {
+		return err
+	}
+
+	certs, err := client.Enroll(&scep.EnrollRequest{
+		CSR:          csr,
+		SignerCert:   crt,
+		SignerKey:    key,
+		CACerts:      caCerts,
+		Renewal:      true,
+		PollInterval: ctx.Duration("poll-interval"),
+		Timeout:      ctx.Duration("wait"),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeCertificates(outFile, certs); err != nil {
+		return err
+	}
+
+	ui.Printf("Your certificate has been saved in %s.\n", outFile)
+	return nil
+}
+
+func newClient(ctx *cli.Context) *scep.Client {
+	return scep.NewClient(ctx.String("url"), &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: pki.WrapTransport(pki.NewTransport(nil)),
+	})
+}
+
+// getCACerts returns the certificates of the CA, verified with the --root or
+// --fingerprint flags, or with the issuer of the given certificate.
+func getCACerts(ctx *cli.Context, client *scep.Client, crt *x509.Certificate) ([]*x509.Certificate, error) {
+	caCerts, err := client.GetCACert(ctx.String("ca-identifier"))
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []*x509.Certificate
+	switch {
+	case ctx.String("root") != "":
+		if roots, err = pemutil.ReadCertificateBundle(ctx.String("root")); err != nil {
+			return nil, err
+		}
+	case ctx.String("fingerprint") != "":
+		fp := strings.ToLower(strings.Replace(ctx.String("fingerprint"), ":", "", -1))
+		for _, c := range caCerts {
+			if x509util.Fingerprint(c) == fp {
+				roots = append(roots, c)
+			}
+		}
+		if len(roots) == 0 {
+			return nil, errs.WithCode(errors.Errorf("the certificates of the SCEP server do not match the fingerprint %s", ctx.String("fingerprint")), errs.CodeValidation)
+		}
+	case crt != nil:
+		for _, c := range caCerts {
+			if crt.CheckSignatureFrom(c) == nil {
+				roots = append(roots, c)
+			}
+		}
+		if len(roots) == 0 {
+			return nil, errs.WithCode(errors.New("the certificates of the SCEP server do not include the issuer of the certificate; use the '--root' or '--fingerprint' flags"), errs.CodeValidation)
+		}
+	}
+
+	if err := verifyCACerts(caCerts, roots); err != nil {
+		return nil, err
+	}
+	return caCerts, nil
+}
+
+// verifyCACerts verifies that all the certificates returned by GetCACert
+// chain to one of the given roots.
+func verifyCACerts(caCerts, roots []*x509.Certificate) error {
+	rootPool := x509.NewCertPool()
+	for _, c := range roots {
+		rootPool.AddCert(c)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range caCerts {
+		intermediates.AddCert(c)
+	}
+	for _, c := range caCerts {
+		if _, err := c.Verify(x509.VerifyOptions{
+			Roots:         rootPool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return errs.WithCode(errors.Wrapf(err, "error verifying the SCEP server certificate '%s'", c.Subject.CommonName), errs.CodeValidation)
+		}
+	}
+	return nil
+}
+
+// writeCertificates writes the issued certificate, followed by the rest of
+// the certificates in the response, in PEM format.
+func writeCertificates(filename string, certs []*x509.Certificate) error {
+	var buf bytes.Buffer
+	for _, c := range certs {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}); err != nil {
+			return errors.Wrap(err, "error encoding certificate")
+		}
+	}
+	return utils.WriteFile(filename, buf.Bytes(), 0600)
+}
@@ -0,0 +1,62 @@
+package ssh
+
+import (
+	"crypto"
+	"net"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentClient is a client of the ssh-agent listening in SSH_AUTH_SOCK.
+type agentClient struct {
+	agent.ExtendedAgent
+	conn net.Conn
+}
+
+// dialAgent connects with the ssh-agent listening in SSH_AUTH_SOCK.
+func dialAgent() (*agentClient, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("error connecting with the ssh-agent: SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, errors.Wrap(err, "error connecting with the ssh-agent")
+	}
+	return &agentClient{
+		ExtendedAgent: agent.NewClient(conn),
+		conn:          conn,
+	}, nil
+}
+
+// AddCertificate adds the private key and certificate to the agent. The key
+// expires in the agent with the certificate.
+func (c *agentClient) AddCertificate(priv crypto.PrivateKey, cert *ssh.Certificate, comment string) error {
+	var lifetime uint32
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		d := time.Until(time.Unix(int64(cert.ValidBefore), 0))
+		if d <= 0 {
+			return errors.New("error adding key to the ssh-agent: certificate has expired")
+		}
+		lifetime = uint32(d.Seconds())
+	}
+
+	if err := c.Add(agent.AddedKey{
+		PrivateKey:   priv,
+		Certificate:  cert,
+		Comment:      comment,
+		LifetimeSecs: lifetime,
+	}); err != nil {
+		return errors.Wrap(err, "error adding key to the ssh-agent")
+	}
+	return nil
+}
+
+// Close closes the connection with the agent.
+func (c *agentClient) Close() error {
+	return c.conn.Close()
+}
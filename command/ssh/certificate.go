@@ -0,0 +1,344 @@
+package ssh
+
+import (
+	"crypto"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func certificateCommand() cli.Command {
+	return cli.Command{
+		Name:   "certificate",
+		Action: command.ActionFunc(certificateAction),
+		Usage:  "sign a SSH certificate using the SSH CA",
+		UsageText: `**step ssh certificate** <key-id> <key-file>
+[**--principal**=<string>] [**--token**=<token>] [**--issuer**=<name>]
+[**--kid**=<kid>] [**--password-file**=<file>] [**--ca-url**=<uri>]
+[**--root**=<file>] [**--not-before**=<time|duration>]
+[**--not-after**=<time|duration>] [**--no-password**]
+[**--password-gen**[=<length>]] [**--insecure**]
+[**--host**] [**--sign**] [**--add-to-agent**]`,
+		Description: `**step ssh certificate** command generates a new SSH key pair and requests a
+user or host certificate for it to the SSH certificate authority of step-ca.
+
+The private key is written in the OpenSSH format to <key-file>, the public key
+to <key-file>.pub and the certificate to <key-file>-cert.pub, the names used by
+**ssh** to load the identities and certificates, e.g. <id_ecdsa>,
+<id_ecdsa.pub> and <id_ecdsa-cert.pub>. With the **--sign** flag an existing
+public key is signed instead, for example the host keys generated by **sshd**.
+
+The certificate is authorized using a one-time token. If **--token** is not
+given, a token is generated using a JWK provisioner, or an ID token is
+requested to the identity provider of an OIDC provisioner.
+
+## POSITIONAL ARGUMENTS
+
+<key-id>
+:  The certificate identity. If no principals are passed we will use
+the key-id as a principal, if it has the format abc@def and it is a user
+certificate then the principal will be abc.
+
+<key-file>
+:  The private key name. The public key and the certificate will be written
+to <key-file>.pub and <key-file>-cert.pub. With **--sign** it is the public key
+to sign, and the certificate will be written to the same name with the .pub
+extension replaced by -cert.pub.
+
+## EXAMPLES
+
+Generate a new SSH key pair and user certificate:
+'''
+$ step ssh certificate mariano@work id_ecdsa
+'''
+
+Generate a new SSH key pair and user certificate with the given principals:
+'''
+$ step ssh certificate --principal max --principal mariano mariano@work id_ecdsa
+'''
+
+Generate a new SSH key pair and user certificate valid for 12 hours, and add
+them to the agent:
+'''
+$ step ssh certificate --not-after 12h --add-to-agent mariano@work id_ecdsa
+'''
+
+Generate a new SSH key pair and user certificate using an OIDC provisioner:
+'''
+$ step ssh certificate --provisioner Google mariano@smallstep.com id_ecdsa
+'''
+
+Sign the host key of a server, the host certificate is written to
+/etc/ssh/ssh_host_ecdsa_key-cert.pub:
+'''
+$ step ssh certificate --host --sign \
+  --principal internal.example.com --principal 10.0.0.1 \
+  internal.example.com /etc/ssh/ssh_host_ecdsa_key.pub
+'''
+
+Generate a new SSH key pair and user certificate using a token from another
+source:
+'''
+$ step ssh certificate --token $TOKEN mariano@work id_ecdsa
+'''`,
+		Flags: []cli.Flag{
+			principalFlag,
+			tokenFlag,
+			provisionerIssuerFlag,
+			provisionerKidFlag,
+			passwordFileFlag,
+			caURLFlag,
+			rootFlag,
+			notBeforeFlag,
+			notAfterFlag,
+			flags.NoPassword,
+			flags.PasswordGen,
+			flags.Insecure,
+			cli.BoolFlag{
+				Name:  "host",
+				Usage: `Create a host certificate instead of a user certificate.`,
+			},
+			cli.BoolFlag{
+				Name:  "sign",
+				Usage: `Sign the public key passed as an argument instead of creating one.`,
+			},
+			cli.BoolFlag{
+				Name: "add-to-agent",
+				Usage: `Add the private key and the certificate to the ssh-agent listening in
+$SSH_AUTH_SOCK. The key is removed from the agent when the certificate expires.`,
+			},
+			flags.Force,
+		},
+	}
+}
+
+func certificateAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	args := ctx.Args()
+	keyID, keyFile := args.Get(0), args.Get(1)
+	pubFile, crtFile := keyFile+".pub", keyFile+"-cert.pub"
+	tok := ctx.String("token")
+	isSign := ctx.Bool("sign")
+	if isSign {
+		pubFile = keyFile
+		crtFile = strings.TrimSuffix(keyFile, ".pub") + "-cert.pub"
+	}
+
+	certType := userCertType
+	if ctx.Bool("host") {
+		certType = hostCertType
+	}
+	principals := ctx.StringSlice("principal")
+	if len(principals) == 0 {
+		principals = []string{defaultPrincipal(certType, keyID)}
+	}
+
+	if ctx.Bool("no-password") && !ctx.Bool("insecure") {
+		return errs.RequiredWithFlag(ctx, "insecure", "no-password")
+	}
+	if ctx.Bool("no-password") && ctx.IsSet("password-gen") {
+		return errs.IncompatibleFlagWithFlag(ctx, "no-password", "password-gen")
+	}
+	if isSign {
+		switch {
+		case ctx.Bool("no-password"):
+			return errs.IncompatibleFlagWithFlag(ctx, "sign", "no-password")
+		case ctx.IsSet("password-gen"):
+			return errs.IncompatibleFlagWithFlag(ctx, "sign", "password-gen")
+		case ctx.Bool("add-to-agent"):
+			return errs.IncompatibleFlagWithFlag(ctx, "sign", "add-to-agent")
+		}
+	}
+	if tok != "" {
+		switch {
+		case ctx.IsSet("kid"):
+			return errs.IncompatibleFlagWithFlag(ctx, "token", "kid")
+		case ctx.IsSet("issuer"):
+			return errs.IncompatibleFlagWithFlag(ctx, "token", "issuer")
+		}
+	}
+
+	caURL := ctx.String("ca-url")
+	if caURL == "" {
+		return errs.RequiredFlag(ctx, "ca-url")
+	}
+	root := ctx.String("root")
+	if root == "" {
+		root = pki.GetRootCAPath()
+		if _, err := os.Stat(root); err != nil {
+			return errs.RequiredFlag(ctx, "root")
+		}
+	}
+
+	// parse times or durations
+	validAfter, err := parseValidity(ctx, "not-before")
+	if err != nil {
+		return err
+	}
+	validBefore, err := parseValidity(ctx, "not-after")
+	if err != nil {
+		return err
+	}
+
+	// Connect with the agent before requesting the certificate
+	var sshAgent *agentClient
+	if ctx.Bool("add-to-agent") {
+		if sshAgent, err = dialAgent(); err != nil {
+			return err
+		}
+		defer sshAgent.Close()
+	}
+
+	if tok == "" {
+		if tok, err = newTokenFlow(ctx, caURL, root, &sshClaims{
+			CertType:    certType,
+			KeyID:       keyID,
+			Principals:  principals,
+			ValidAfter:  validAfter,
+			ValidBefore: validBefore,
+		}); err != nil {
+			return err
+		}
+	}
+
+	var sshPub ssh.PublicKey
+	var priv interface{}
+	if isSign {
+		b, err := ioutil.ReadFile(pubFile)
+		if err != nil {
+			return errs.FileError(err, pubFile)
+		}
+		if sshPub, _, _, _, err = ssh.ParseAuthorizedKey(b); err != nil {
+			return errors.Wrapf(err, "error parsing %s", pubFile)
+		}
+	} else {
+		var pub interface{}
+		if pub, priv, err = keys.GenerateDefaultKeyPair(); err != nil {
+			return err
+		}
+		if sshPub, err = ssh.NewPublicKey(pub); err != nil {
+			return errors.Wrap(err, "error creating public key")
+		}
+	}
+
+	client, err := newClient(caURL, root)
+	if err != nil {
+		return err
+	}
+	cert, err := client.SignSSH(&signRequest{
+		PublicKey:   sshPub.Marshal(),
+		OTT:         tok,
+		CertType:    certType,
+		Principals:  principals,
+		ValidAfter:  validAfter,
+		ValidBefore: validBefore,
+	})
+	if err != nil {
+		return err
+	}
+
+	if isSign {
+		if err := utils.WriteFile(crtFile, marshalPublicKey(cert, keyID), 0644); err != nil {
+			return err
+		}
+		ui.PrintSelected("Certificate", crtFile)
+		return nil
+	}
+
+	if err := writeKey(ctx, keyFile, priv); err != nil {
+		return err
+	}
+	if err := utils.WriteFile(pubFile, marshalPublicKey(sshPub, keyID), 0644); err != nil {
+		return err
+	}
+	if err := utils.WriteFile(crtFile, marshalPublicKey(cert, keyID), 0644); err != nil {
+		return err
+	}
+
+	ui.PrintSelected("Private Key", keyFile)
+	ui.PrintSelected("Public Key", pubFile)
+	ui.PrintSelected("Certificate", crtFile)
+
+	if sshAgent != nil {
+		if err := sshAgent.AddCertificate(priv, cert, keyID); err != nil {
+			return err
+		}
+		ui.PrintSelected("SSH Agent", "yes")
+	}
+
+	return nil
+}
+
+// defaultPrincipal returns the principal used if none is given. In user
+// certificates it is the local part of the key id if it is an email, in any
+// other case the key id.
+func defaultPrincipal(certType, keyID string) string {
+	if certType == userCertType {
+		if i := strings.LastIndex(keyID, "@"); i > 0 {
+			return keyID[:i]
+		}
+	}
+	return keyID
+}
+
+// writeKey writes the private key in the OpenSSH format, encrypted with a
+// password unless the --no-password flag is used. The password is generated
+// with the --password-gen flag.
+func writeKey(ctx *cli.Context, filename string, priv crypto.PrivateKey) error {
+	opts := []pemutil.Options{
+		pemutil.WithOpenSSH(true),
+		pemutil.ToFile(filename, 0600),
+	}
+	if !ctx.Bool("no-password") {
+		password, err := utils.GetNewPasswordFromCLI(ctx, "")
+		if err != nil {
+			return err
+		}
+		pass, err := ui.PromptPassword("Please enter the password to encrypt the private key", ui.WithValue(password), ui.WithValidateEntropy())
+		if err != nil {
+			return errors.Wrap(err, "error reading password")
+		}
+		opts = append(opts, pemutil.WithPassword(pass))
+	}
+	_, err := pemutil.Serialize(priv, opts...)
+	return err
+}
+
+// parseValidity parses the given time or duration flag and returns it in
+// RFC 3339 format.
+func parseValidity(ctx *cli.Context, name string) (string, error) {
+	t, ok := flags.ParseTimeOrDuration(ctx.String(name))
+	if !ok {
+		return "", errs.InvalidFlagValue(ctx, name, ctx.String(name), "")
+	}
+	if t.IsZero() {
+		return "", nil
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// marshalPublicKey returns the public key or certificate in the format used
+// in the authorized_keys and .pub files.
+func marshalPublicKey(key ssh.PublicKey, comment string) []byte {
+	b := ssh.MarshalAuthorizedKey(key)
+	if comment != "" {
+		b = append(b[:len(b)-1], []byte(" "+comment+"\n")...)
+	}
+	return b
+}
@@ -0,0 +1,234 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"golang.org/x/crypto/ssh"
+)
+
+// Certificate types supported by the CA.
+const (
+	userCertType = "user"
+	hostCertType = "host"
+)
+
+// signRequest is the request body sent to the ssh sign endpoint of the CA.
+type signRequest struct {
+	PublicKey   []byte   `json:"publicKey"`
+	OTT         string   `json:"ott"`
+	CertType    string   `json:"certType,omitempty"`
+	Principals  []string `json:"principals,omitempty"`
+	ValidAfter  string   `json:"validAfter,omitempty"`
+	ValidBefore string   `json:"validBefore,omitempty"`
+}
+
+// renewRequest is the request body sent to the ssh renew endpoint of the CA.
+// The token is signed by the key of the certificate to renew.
+type renewRequest struct {
+	OTT string `json:"ott"`
+}
+
+// rekeyRequest is the request body sent to the ssh rekey endpoint of the CA.
+// The token is signed by the key of the certificate to renew, the new
+// certificate will use the given public key.
+type rekeyRequest struct {
+	OTT       string `json:"ott"`
+	PublicKey []byte `json:"publicKey"`
+}
+
+// revokeRequest is the request body sent to the ssh revoke endpoint of the
+// CA. The token is signed by a provisioner or by the key of the certificate
+// to revoke.
+type revokeRequest struct {
+	Serial     string `json:"serial"`
+	OTT        string `json:"ott"`
+	ReasonCode int    `json:"reasonCode"`
+	Reason     string `json:"reason,omitempty"`
+	Passive    bool   `json:"passive"`
+}
+
+// revokeResponse is the response of the ssh revoke endpoint of the CA.
+type revokeResponse struct {
+	Status string `json:"status"`
+}
+
+// certificateResponse is the response of the ssh sign, renew and rekey
+// endpoints of the CA, the certificate is base64 encoded in the SSH wire
+// format.
+type certificateResponse struct {
+	Certificate string `json:"crt"`
+}
+
+// rootsResponse is the response of the ssh roots endpoint of the CA, it
+// contains the public keys used to sign user and host certificates, base64
+// encoded in the SSH wire format.
+type rootsResponse struct {
+	UserKeys []string `json:"userKey"`
+	HostKeys []string `json:"hostKey"`
+}
+
+// caError is the body of the responses of the CA on errors.
+type caError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// client is a minimal client of the ssh endpoints of the CA.
+type client struct {
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// newClient creates a new client for the CA in caURL trusting the root
+// certificates in the given file.
+func newClient(caURL, root string) (*client, error) {
+	u, err := url.Parse(caURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", caURL)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+	case "":
+		u, err = url.Parse("https://" + caURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", caURL)
+		}
+	default:
+		return nil, errors.Errorf("error parsing %s: unsupported scheme '%s'", caURL, u.Scheme)
+	}
+
+	b, err := ioutil.ReadFile(root)
+	if err != nil {
+		return nil, errs.FileError(err, root)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.Errorf("error reading %s: no certificates found", root)
+	}
+
+	return &client{
+		endpoint: u,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: pki.WrapTransport(pki.NewTransport(&tls.Config{
+				RootCAs:                  pool,
+				MinVersion:               tls.VersionTLS12,
+				PreferServerCipherSuites: true,
+			})),
+		},
+	}, nil
+}
+
+// SignSSH sends the given request to the CA and returns the signed
+// certificate.
+func (c *client) SignSSH(req *signRequest) (*ssh.Certificate, error) {
+	return c.postCertificate("/1.0/ssh/sign", req)
+}
+
+// RenewSSH sends the given request to the CA and returns the renewed
+// certificate.
+func (c *client) RenewSSH(req *renewRequest) (*ssh.Certificate, error) {
+	return c.postCertificate("/1.0/ssh/renew", req)
+}
+
+// RekeySSH sends the given request to the CA and returns a new certificate
+// for the new public key.
+func (c *client) RekeySSH(req *rekeyRequest) (*ssh.Certificate, error) {
+	return c.postCertificate("/1.0/ssh/rekey", req)
+}
+
+// RevokeSSH sends the given revocation request to the CA.
+func (c *client) RevokeSSH(req *revokeRequest) (*revokeResponse, error) {
+	var rr revokeResponse
+	if err := c.do("POST", "/1.0/ssh/revoke", req, &rr); err != nil {
+		return nil, err
+	}
+	return &rr, nil
+}
+
+// SSHRoots returns the public keys of the SSH certificate authority.
+func (c *client) SSHRoots() (*rootsResponse, error) {
+	var roots rootsResponse
+	if err := c.do("GET", "/1.0/ssh/roots", nil, &roots); err != nil {
+		return nil, err
+	}
+	return &roots, nil
+}
+
+// postCertificate sends the given request to the CA endpoint in path and
+// parses the certificate in the response.
+func (c *client) postCertificate(path string, req interface{}) (*ssh.Certificate, error) {
+	var cr certificateResponse
+	if err := c.do("POST", path, req, &cr); err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(cr.Certificate)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding certificate")
+	}
+	pub, err := ssh.ParsePublicKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.Errorf("error parsing certificate: unexpected type %s", pub.Type())
+	}
+	return cert, nil
+}
+
+// do sends a request to the CA endpoint in path, with the given body encoded
+// as JSON if it is not nil, and decodes the JSON response in v.
+func (c *client) do(method, path string, body, v interface{}) error {
+	u := c.endpoint.ResolveReference(&url.URL{Path: path})
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling request")
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return errors.Wrapf(err, "client %s %s failed", method, u)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "client %s %s failed", method, u)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "client %s %s failed", method, u)
+	}
+	if resp.StatusCode >= 400 {
+		var e caError
+		code := errs.StatusCode(resp.StatusCode)
+		if err := json.Unmarshal(b, &e); err == nil && e.Message != "" {
+			return errs.WithCode(errors.Errorf("client %s %s failed: %s", method, u, e.Message), code)
+		}
+		return errs.WithCode(errors.Errorf("client %s %s failed: %s", method, u, resp.Status), code)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.Wrapf(err, "error parsing response from %s", u)
+	}
+	return nil
+}
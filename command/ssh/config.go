@@ -0,0 +1,294 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func configCommand() cli.Command {
+	return cli.Command{
+		Name:   "config",
+		Action: command.ActionFunc(configAction),
+		Usage:  "configure ssh to trust the SSH CA",
+		UsageText: `**step ssh config**
+[**--host-pattern**=<pattern>] [**--known-hosts**=<file>]
+[**--ssh-config**=<file>] [**--certificate-file**=<file>]
+[**--proxy-command**=<command>] [**--roots**] [**--dry-run**]
+[**--ca-url**=<uri>] [**--root**=<file>] [**--force**]`,
+		Description: `**step ssh config** command fetches the public keys of the SSH certificate
+authority of step-ca and configures the ssh client to trust them.
+
+The host public keys are added to <known_hosts> as **@cert-authority** lines, so
+ssh will trust the hosts with a certificate signed by the CA. Existing lines for
+the same keys are replaced.
+
+An ssh_config snippet is also written to <$STEPPATH/ssh/config>, it can be
+included at the top of <~/.ssh/config> with an **Include** directive. The
+snippet applies to the hosts matching **--host-pattern** and it can define the
+**CertificateFile** and **ProxyCommand** options.
+
+## EXAMPLES
+
+Configure ssh to trust the host certificates signed by the CA:
+'''
+$ step ssh config
+✔ Known Hosts: /home/mariano/.ssh/known_hosts
+✔ SSH Config: /home/mariano/.step/ssh/config
+Add the following line at the top of /home/mariano/.ssh/config:
+  Include /home/mariano/.step/ssh/config
+'''
+
+Configure the hosts in a domain to use the certificate of **step ssh
+certificate** and a bastion:
+'''
+$ step ssh config --host-pattern "*.internal.example.com" \
+  --certificate-file ~/.ssh/id_ecdsa-cert.pub \
+  --proxy-command "ssh -W %h:%p bastion.example.com"
+'''
+
+Print the changes without writing any file:
+'''
+$ step ssh config --dry-run
+'''
+
+Print the public keys of the CA:
+'''
+$ step ssh config --roots
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "host-pattern",
+				Usage: `The host <pattern> used in the ssh_config snippet and in known_hosts.`,
+				Value: "*",
+			},
+			cli.StringFlag{
+				Name:  "known-hosts",
+				Usage: `The known_hosts <file> to update. Defaults to ~/.ssh/known_hosts.`,
+			},
+			cli.StringFlag{
+				Name:  "ssh-config",
+				Usage: `The ssh_config <file> to write. Defaults to $STEPPATH/ssh/config.`,
+			},
+			cli.StringFlag{
+				Name:  "certificate-file",
+				Usage: `The SSH certificate <file> to use in the matching hosts.`,
+			},
+			cli.StringFlag{
+				Name:  "proxy-command",
+				Usage: `The <command> used to connect to the matching hosts.`,
+			},
+			cli.BoolFlag{
+				Name:  "roots",
+				Usage: `Print the public keys of the SSH CA instead of configuring ssh.`,
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: `Print the files and their contents without writing them.`,
+			},
+			caURLFlag,
+			rootFlag,
+			flags.Force,
+		},
+	}
+}
+
+func configAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+
+	caURL := ctx.String("ca-url")
+	if caURL == "" {
+		return errs.RequiredFlag(ctx, "ca-url")
+	}
+	root := ctx.String("root")
+	if root == "" {
+		root = pki.GetRootCAPath()
+		if _, err := os.Stat(root); err != nil {
+			return errs.RequiredFlag(ctx, "root")
+		}
+	}
+	pattern := ctx.String("host-pattern")
+	if pattern == "" {
+		return errs.InvalidFlagValue(ctx, "host-pattern", "", "")
+	}
+
+	client, err := newClient(caURL, root)
+	if err != nil {
+		return err
+	}
+	roots, err := client.SSHRoots()
+	if err != nil {
+		return err
+	}
+	userKeys, err := parseKeys(roots.UserKeys)
+	if err != nil {
+		return err
+	}
+	hostKeys, err := parseKeys(roots.HostKeys)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Bool("roots") {
+		for _, k := range userKeys {
+			fmt.Printf("# User CA\n%s", ssh.MarshalAuthorizedKey(k))
+		}
+		for _, k := range hostKeys {
+			fmt.Printf("# Host CA\n%s", ssh.MarshalAuthorizedKey(k))
+		}
+		return nil
+	}
+	if len(hostKeys) == 0 {
+		return errors.New("the CA does not have any SSH host key configured")
+	}
+
+	home, err := homeDir()
+	if err != nil {
+		return err
+	}
+	knownHosts := ctx.String("known-hosts")
+	if knownHosts == "" {
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	sshConfig := ctx.String("ssh-config")
+	if sshConfig == "" {
+		sshConfig = filepath.Join(config.StepPath(), "ssh", "config")
+	}
+
+	knownHostsData, err := updateKnownHosts(knownHosts, pattern, hostKeys)
+	if err != nil {
+		return err
+	}
+	// ssh uses ~/.ssh/known_hosts by default
+	var userKnownHosts string
+	if ctx.IsSet("known-hosts") {
+		userKnownHosts = knownHosts
+	}
+	sshConfigData := sshConfigSnippet(pattern, userKnownHosts, ctx.String("certificate-file"), ctx.String("proxy-command"))
+
+	if ctx.Bool("dry-run") {
+		fmt.Printf("# %s\n%s\n# %s\n%s", knownHosts, knownHostsData, sshConfig, sshConfigData)
+		return nil
+	}
+
+	for _, dir := range []string{filepath.Dir(knownHosts), filepath.Dir(sshConfig)} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return errs.FileError(err, dir)
+		}
+	}
+	if err := utils.WriteFile(knownHosts, knownHostsData, 0644); err != nil {
+		return err
+	}
+	if err := utils.WriteFile(sshConfig, sshConfigData, 0644); err != nil {
+		return err
+	}
+
+	ui.PrintSelected("Known Hosts", knownHosts)
+	ui.PrintSelected("SSH Config", sshConfig)
+	ui.Printf("Add the following line at the top of %s:\n  Include %s\n", filepath.Join(home, ".ssh", "config"), sshConfig)
+	return nil
+}
+
+// parseKeys parses the public keys in the response of the CA.
+func parseKeys(keys []string) ([]ssh.PublicKey, error) {
+	var pubs []ssh.PublicKey
+	for _, s := range keys {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding SSH CA key")
+		}
+		pub, err := ssh.ParsePublicKey(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing SSH CA key")
+		}
+		pubs = append(pubs, pub)
+	}
+	return pubs, nil
+}
+
+// updateKnownHosts returns the content of the known_hosts file with an
+// @cert-authority line for each key. Previous @cert-authority lines with the
+// same keys are removed.
+func updateKnownHosts(filename, pattern string, keys []ssh.PublicKey) ([]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errs.FileError(err, filename)
+	}
+
+	isCAKey := func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "@cert-authority" {
+			return false
+		}
+		for _, k := range keys {
+			if fields[2] == k.Type() && fields[3] == base64.StdEncoding.EncodeToString(k.Marshal()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if line := scanner.Text(); !isCAKey(line) {
+			buf.WriteString(line + "\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "@cert-authority %s %s", pattern, ssh.MarshalAuthorizedKey(k))
+	}
+	return buf.Bytes(), nil
+}
+
+// sshConfigSnippet returns the ssh_config snippet for the hosts matching the
+// given pattern. Empty options are not added.
+func sshConfigSnippet(pattern, knownHosts, certificateFile, proxyCommand string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by step ssh config, include it at the top of ~/.ssh/config\n")
+	fmt.Fprintf(&buf, "Host %s\n", pattern)
+	if knownHosts != "" {
+		fmt.Fprintf(&buf, "\tUserKnownHostsFile %s\n", knownHosts)
+	}
+	if certificateFile != "" {
+		fmt.Fprintf(&buf, "\tCertificateFile %s\n", certificateFile)
+		fmt.Fprintf(&buf, "\tIdentityFile %s\n", strings.TrimSuffix(certificateFile, "-cert.pub"))
+	}
+	if proxyCommand != "" {
+		fmt.Fprintf(&buf, "\tProxyCommand %s\n", proxyCommand)
+	}
+	return buf.Bytes()
+}
+
+// homeDir returns the home directory of the current user.
+func homeDir() (string, error) {
+	if usr, err := user.Current(); err == nil && usr.HomeDir != "" {
+		return usr.HomeDir, nil
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return home, nil
+	}
+	return "", errors.New("error obtaining home directory")
+}
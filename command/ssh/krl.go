@@ -0,0 +1,173 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/sshutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func krlCommand() cli.Command {
+	return cli.Command{
+		Name:   "krl",
+		Action: command.ActionFunc(krlAction),
+		Usage:  "generate an OpenSSH key revocation list",
+		UsageText: `**step ssh krl** <krl-file> [<ssh-cert>...]
+[**--serial**=<number>] [**--key-id**=<id>] [**--ca-key**=<file>]
+[**--comment**=<string>] [**--update**] [**--force**]`,
+		Description: `**step ssh krl** command generates an OpenSSH Key Revocation List (KRL) with
+the given certificates, serial numbers and key ids. The KRL can be configured in
+sshd using the **RevokedKeys** option, and checked with **ssh-keygen -Q**.
+
+Serial numbers are revoked for the CA key in **--ca-key**, key ids are revoked
+for the CA key in **--ca-key** or for any CA if the flag is not used. The
+certificates are revoked by serial number for the CA that signed them, or by
+key id if they do not have a serial number.
+
+With the **--update** flag the new revocations are added to an existing KRL
+generated by this command, and the version of the KRL is increased.
+
+## POSITIONAL ARGUMENTS
+
+<krl-file>
+:  The path to write the KRL.
+
+<ssh-cert>
+:  The SSH certificates to revoke.
+
+## EXAMPLES
+
+Generate a KRL with a revoked certificate:
+'''
+$ step ssh krl --force /etc/ssh/revoked_keys id_ecdsa-cert.pub
+'''
+
+Add two serial numbers of the user CA to an existing KRL:
+'''
+$ step ssh krl --update --force --ca-key ssh_user_ca_key.pub \
+  --serial 3203851962452063478 --serial 7816326184939173456 \
+  /etc/ssh/revoked_keys
+'''
+
+Revoke a key id for any CA:
+'''
+$ step ssh krl --update --force --key-id mariano@smallstep.com /etc/ssh/revoked_keys
+'''
+
+Check if a certificate is revoked:
+'''
+$ ssh-keygen -Q -f /etc/ssh/revoked_keys id_ecdsa-cert.pub
+'''`,
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name: "serial",
+				Usage: `The serial <number> of a certificate to revoke. Use the flag multiple times to
+revoke multiple serial numbers. Requires the **--ca-key** flag.`,
+			},
+			cli.StringSliceFlag{
+				Name: "key-id",
+				Usage: `The key <id> of a certificate to revoke. Use the flag multiple times to revoke
+multiple key ids.`,
+			},
+			cli.StringFlag{
+				Name:  "ca-key",
+				Usage: `The public key <file> of the CA that signed the revoked serial numbers or key ids.`,
+			},
+			cli.StringFlag{
+				Name:  "comment",
+				Usage: `The comment <string> of the KRL.`,
+			},
+			cli.BoolFlag{
+				Name:  "update",
+				Usage: `Add the revocations to the existing <krl-file> instead of creating a new one.`,
+			},
+			flags.Force,
+		},
+	}
+}
+
+func krlAction(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errs.TooFewArguments(ctx)
+	}
+
+	args := ctx.Args()
+	krlFile := args.First()
+	serials := ctx.StringSlice("serial")
+	keyIDs := ctx.StringSlice("key-id")
+	if len(serials) > 0 && !ctx.IsSet("ca-key") {
+		return errs.RequiredWithFlag(ctx, "serial", "ca-key")
+	}
+	if len(args) == 1 && len(serials) == 0 && len(keyIDs) == 0 && !ctx.Bool("update") {
+		return errs.TooFewArguments(ctx)
+	}
+
+	var caKey ssh.PublicKey
+	if filename := ctx.String("ca-key"); filename != "" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return errs.FileError(err, filename)
+		}
+		if caKey, _, _, _, err = ssh.ParseAuthorizedKey(b); err != nil {
+			return errors.Wrapf(err, "error parsing %s", filename)
+		}
+	}
+
+	krl := new(sshutil.KRL)
+	if ctx.Bool("update") {
+		b, err := ioutil.ReadFile(krlFile)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return errs.FileError(err, krlFile)
+		default:
+			if krl, err = sshutil.ParseKRL(b); err != nil {
+				return errors.Wrapf(err, "error reading %s", krlFile)
+			}
+			krl.Version++
+		}
+	}
+	krl.GeneratedDate = time.Now()
+	if ctx.IsSet("comment") {
+		krl.Comment = ctx.String("comment")
+	}
+
+	for _, filename := range args[1:] {
+		cert, _, err := readCertificate(filename)
+		if err != nil {
+			return err
+		}
+		krl.RevokeCertificate(cert)
+	}
+	for _, s := range serials {
+		serial, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || serial == 0 {
+			return errs.InvalidFlagValue(ctx, "serial", s, "")
+		}
+		krl.RevokeSerial(caKey, serial)
+	}
+	for _, keyID := range keyIDs {
+		krl.RevokeKeyID(caKey, keyID)
+	}
+
+	b, err := krl.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFile(krlFile, b, 0644); err != nil {
+		return err
+	}
+
+	ui.PrintSelected("KRL", krlFile)
+	return nil
+}
@@ -0,0 +1,195 @@
+package ssh
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/jose"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func loginCommand() cli.Command {
+	return cli.Command{
+		Name:   "login",
+		Action: command.ActionFunc(loginAction),
+		Usage:  "add a SSH certificate to the ssh-agent using single sign-on",
+		UsageText: `**step ssh login** [<identity>]
+[**--principal**=<string>] [**--token**=<token>] [**--provisioner**=<name>]
+[**--password-file**=<file>] [**--not-before**=<time|duration>]
+[**--not-after**=<time|duration>] [**--ca-url**=<uri>] [**--root**=<file>]`,
+		Description: `**step ssh login** command authenticates the user with the identity provider
+of an OIDC provisioner, generates a new SSH key pair and requests a short-lived
+user certificate for it to the SSH certificate authority of step-ca. The private
+key and the certificate are only added to the ssh-agent listening in
+$SSH_AUTH_SOCK, they are never written to disk, and they are removed from the
+agent when the certificate expires.
+
+## POSITIONAL ARGUMENTS
+
+<identity>
+:  The certificate identity, usually the email of the user. It must match the
+email in the ID token returned by the identity provider. If not set the email
+in the ID token is used. A JWK provisioner can also be used to log in if the
+identity is given.
+
+## EXAMPLES
+
+Log in using the email of the identity provider:
+'''
+$ step ssh login
+$ ssh-add -L
+ecdsa-sha2-nistp256-cert-v01@openssh.com AAAAKGVjZHNhLXNoYTItbmlzdHAyNTYtY2VydC12MDFAb3BlbnNzaC5jb20AAAAg... mariano@smallstep.com
+'''
+
+Log in with a given identity and provisioner:
+'''
+$ step ssh login --provisioner Google mariano@smallstep.com
+'''
+
+Log in requesting a certificate valid for 8 hours:
+'''
+$ step ssh login --not-after 8h mariano@smallstep.com
+'''`,
+		Flags: []cli.Flag{
+			principalFlag,
+			tokenFlag,
+			provisionerIssuerFlag,
+			passwordFileFlag,
+			notBeforeFlag,
+			notAfterFlag,
+			caURLFlag,
+			rootFlag,
+		},
+	}
+}
+
+func loginAction(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errs.TooManyArguments(ctx)
+	}
+
+	identity := ctx.Args().First()
+	principals := ctx.StringSlice("principal")
+	if identity != "" && len(principals) == 0 {
+		principals = []string{defaultPrincipal(userCertType, identity)}
+	}
+	tok := ctx.String("token")
+	if tok != "" && ctx.IsSet("issuer") {
+		return errs.IncompatibleFlagWithFlag(ctx, "token", "issuer")
+	}
+
+	caURL := ctx.String("ca-url")
+	if caURL == "" {
+		return errs.RequiredFlag(ctx, "ca-url")
+	}
+	root := ctx.String("root")
+	if root == "" {
+		root = pki.GetRootCAPath()
+		if _, err := os.Stat(root); err != nil {
+			return errs.RequiredFlag(ctx, "root")
+		}
+	}
+
+	// parse times or durations
+	validAfter, err := parseValidity(ctx, "not-before")
+	if err != nil {
+		return err
+	}
+	validBefore, err := parseValidity(ctx, "not-after")
+	if err != nil {
+		return err
+	}
+
+	// Connect with the agent before starting the login flow
+	sshAgent, err := dialAgent()
+	if err != nil {
+		return err
+	}
+	defer sshAgent.Close()
+
+	if tok == "" {
+		if tok, err = newTokenFlow(ctx, caURL, root, &sshClaims{
+			CertType:    userCertType,
+			KeyID:       identity,
+			Principals:  principals,
+			ValidAfter:  validAfter,
+			ValidBefore: validBefore,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// The identity must match the email of OIDC tokens
+	if email := tokenEmail(tok); email != "" {
+		switch {
+		case identity == "":
+			identity = email
+		case !strings.EqualFold(identity, email):
+			return errors.Errorf("token email '%s' and argument '%s' do not match", email, identity)
+		}
+	}
+	if identity == "" {
+		return errs.TooFewArguments(ctx)
+	}
+	if len(principals) == 0 {
+		principals = []string{defaultPrincipal(userCertType, identity)}
+	}
+
+	pub, priv, err := keys.GenerateDefaultKeyPair()
+	if err != nil {
+		return err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return errors.Wrap(err, "error creating public key")
+	}
+
+	client, err := newClient(caURL, root)
+	if err != nil {
+		return err
+	}
+	cert, err := client.SignSSH(&signRequest{
+		PublicKey:   sshPub.Marshal(),
+		OTT:         tok,
+		CertType:    userCertType,
+		Principals:  principals,
+		ValidAfter:  validAfter,
+		ValidBefore: validBefore,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := sshAgent.AddCertificate(priv, cert, identity); err != nil {
+		return err
+	}
+
+	ui.PrintSelected("SSH Agent", "yes")
+	ui.PrintSelected("Identity", identity)
+	ui.PrintSelected("Principals", strings.Join(cert.ValidPrincipals, ", "))
+	ui.PrintSelected("Valid Before", certTime(cert.ValidBefore).Local().Format("2006-01-02 15:04:05 MST"))
+	return nil
+}
+
+// tokenEmail returns the email claim of the given token, it returns an empty
+// string if the token does not have one.
+func tokenEmail(tok string) string {
+	jwt, err := jose.ParseSigned(tok)
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return ""
+	}
+	return claims.Email
+}
@@ -0,0 +1,166 @@
+package ssh
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func rekeyCommand() cli.Command {
+	return cli.Command{
+		Name:   "rekey",
+		Action: command.ActionFunc(rekeyAction),
+		Usage:  "rekey a SSH certificate using the SSH CA",
+		UsageText: `**step ssh rekey** <ssh-cert> <ssh-key>
+[**--out**=<file>] [**--password-file**=<file>] [**--no-password**]
+[**--password-gen**[=<length>]] [**--insecure**] [**--ca-url**=<uri>]
+[**--root**=<file>] [**--force**]`,
+		Description: `**step ssh rekey** command generates a new SSH key pair and requests a new
+certificate for it with the same properties of the given SSH certificate. The
+request is authorized with a token signed by <ssh-key>, so the certificate must
+not be expired.
+
+The new private key, public key and certificate overwrite <ssh-key>,
+<ssh-key>.pub and <ssh-cert>, or are written to <file>, <file>.pub and
+<file>-cert.pub if the **--out**=<file> flag is used.
+
+## POSITIONAL ARGUMENTS
+
+<ssh-cert>
+:  The SSH certificate to rekey.
+
+<ssh-key>
+:  The SSH private key of the certificate.
+
+## EXAMPLES
+
+Rekey the host certificate of a server, overwriting the host keys:
+'''
+$ step ssh rekey --no-password --insecure \
+  /etc/ssh/ssh_host_ecdsa_key-cert.pub /etc/ssh/ssh_host_ecdsa_key
+'''
+
+Rekey a user certificate and write the new key pair and certificate to
+id_ecdsa2, id_ecdsa2.pub and id_ecdsa2-cert.pub:
+'''
+$ step ssh rekey --out id_ecdsa2 id_ecdsa-cert.pub id_ecdsa
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "out,output-file",
+				Usage: `The new private key <file> path. Defaults to overwriting the <ssh-key> and
+<ssh-cert> positional arguments.`,
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: "The path to the <file> containing the password to decrypt the private key.",
+			},
+			flags.NoPassword,
+			flags.PasswordGen,
+			flags.Insecure,
+			caURLFlag,
+			rootFlag,
+			flags.Force,
+		},
+	}
+}
+
+func rekeyAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	args := ctx.Args()
+	crtFile, keyFile := args.Get(0), args.Get(1)
+	outKey, outCrt := keyFile, crtFile
+	if out := ctx.String("out"); out != "" {
+		outKey, outCrt = out, out+"-cert.pub"
+	}
+	outPub := outKey + ".pub"
+
+	if ctx.Bool("no-password") && !ctx.Bool("insecure") {
+		return errs.RequiredWithFlag(ctx, "insecure", "no-password")
+	}
+	if ctx.Bool("no-password") && ctx.IsSet("password-gen") {
+		return errs.IncompatibleFlagWithFlag(ctx, "no-password", "password-gen")
+	}
+
+	caURL := ctx.String("ca-url")
+	if caURL == "" {
+		return errs.RequiredFlag(ctx, "ca-url")
+	}
+	root := ctx.String("root")
+	if root == "" {
+		root = pki.GetRootCAPath()
+		if _, err := os.Stat(root); err != nil {
+			return errs.RequiredFlag(ctx, "root")
+		}
+	}
+
+	cert, comment, err := readCertificate(crtFile)
+	if err != nil {
+		return err
+	}
+	key, err := readKey(keyFile, ctx.String("password-file"), cert)
+	if err != nil {
+		return err
+	}
+	if time.Now().After(certTime(cert.ValidBefore)) {
+		return errors.New("cannot rekey an expired certificate")
+	}
+
+	audience, err := caAudience(ctx, caURL, "/1.0/ssh/rekey")
+	if err != nil {
+		return err
+	}
+	tok, err := sshpopToken(cert, key, audience)
+	if err != nil {
+		return err
+	}
+
+	pub, priv, err := keys.GenerateDefaultKeyPair()
+	if err != nil {
+		return err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return errors.Wrap(err, "error creating public key")
+	}
+
+	client, err := newClient(caURL, root)
+	if err != nil {
+		return err
+	}
+	newCert, err := client.RekeySSH(&rekeyRequest{
+		OTT:       tok,
+		PublicKey: sshPub.Marshal(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error rekeying certificate")
+	}
+
+	if err := writeKey(ctx, outKey, priv); err != nil {
+		return err
+	}
+	if err := utils.WriteFile(outPub, marshalPublicKey(sshPub, comment), 0644); err != nil {
+		return err
+	}
+	if err := utils.WriteFile(outCrt, marshalPublicKey(newCert, comment), 0644); err != nil {
+		return err
+	}
+
+	ui.PrintSelected("Private Key", outKey)
+	ui.PrintSelected("Public Key", outPub)
+	ui.PrintSelected("Certificate", outCrt)
+	return nil
+}
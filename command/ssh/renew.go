@@ -0,0 +1,359 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func renewCommand() cli.Command {
+	return cli.Command{
+		Name:   "renew",
+		Action: command.ActionFunc(renewAction),
+		Usage:  "renew a SSH certificate using the SSH CA",
+		UsageText: `**step ssh renew** <ssh-cert> <ssh-key>
+[**--out**=<file>] [**--password-file**=<file>] [**--expires-in**=<duration>]
+[**--daemon**] [**--exec**=<command>] [**--ca-url**=<uri>] [**--root**=<file>]
+[**--force**]`,
+		Description: `**step ssh renew** command renews the given SSH certificate (with a request to
+the SSH certificate authority) and writes the new certificate to disk - either
+overwriting <ssh-cert> or using a new file when the **--out**=<file> flag is
+used. The request is authorized with a token signed by <ssh-key>, so the
+certificate must not be expired.
+
+With the **--daemon** flag the command will periodically renew the given
+certificate. By default, it will renew the certificate before 2/3 of the validity
+period of the certificate has elapsed. A random jitter is used to avoid multiple
+instances running at the same time. The amount of time between renewal and
+certificate expiration can be configured using the **--expires-in** flag. The
+daemon can be combined with **--exec** to reload the services using the
+certificate, e.g. **sshd**.
+
+## POSITIONAL ARGUMENTS
+
+<ssh-cert>
+:  The SSH certificate to renew.
+
+<ssh-key>
+:  The SSH private key of the certificate.
+
+## EXAMPLES
+
+Renew the host certificate of a server:
+'''
+$ step ssh renew /etc/ssh/ssh_host_ecdsa_key-cert.pub /etc/ssh/ssh_host_ecdsa_key
+'''
+
+Renew a user certificate and write it to a new file:
+'''
+$ step ssh renew --out id_ecdsa-renewed-cert.pub id_ecdsa-cert.pub id_ecdsa
+'''
+
+Renew the host certificate from cron only if it expires in less than 4 hours:
+'''
+$ step ssh renew --force --expires-in 4h \
+  /etc/ssh/ssh_host_ecdsa_key-cert.pub /etc/ssh/ssh_host_ecdsa_key
+'''
+
+Renew the host certificate periodically and reload sshd after each renewal:
+'''
+$ step ssh renew --daemon --exec "systemctl reload sshd" \
+  /etc/ssh/ssh_host_ecdsa_key-cert.pub /etc/ssh/ssh_host_ecdsa_key
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "out,output-file",
+				Usage: "The new certificate <file> path. Defaults to overwriting the <ssh-cert> positional argument",
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: "The path to the <file> containing the password to decrypt the private key.",
+			},
+			cli.StringFlag{
+				Name: "expires-in",
+				Usage: `The amount of time remaining before certificate expiration,
+at which point a renewal should be attempted. The certificate renewal will not
+be performed if the time to expiration is greater than the **--expires-in** value.
+A random jitter (duration/20) will be added to avoid multiple services hitting the
+renew endpoint at the same time. The <duration> is a sequence of decimal numbers,
+each with optional fraction and a unit suffix, such as "300ms", "-1.5h" or "2h45m".
+Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".`,
+			},
+			cli.BoolFlag{
+				Name: "daemon",
+				Usage: `Run the renew command as a daemon, renewing and overwriting the certificate
+periodically. By default the daemon will renew a certificate before 2/3 of the
+time to expiration has elapsed. The period can be configured using the
+**--expires-in** flag.`,
+			},
+			cli.StringFlag{
+				Name:  "exec",
+				Usage: "The <command> to run after the certificate has been renewed.",
+			},
+			caURLFlag,
+			rootFlag,
+			flags.Force,
+		},
+	}
+}
+
+func renewAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	args := ctx.Args()
+	crtFile, keyFile := args.Get(0), args.Get(1)
+	outFile := ctx.String("out")
+	if outFile == "" {
+		outFile = crtFile
+	}
+
+	var err error
+	var expiresIn time.Duration
+	if s := ctx.String("expires-in"); s != "" {
+		if expiresIn, err = time.ParseDuration(s); err != nil {
+			return errs.InvalidFlagValue(ctx, "expires-in", s, "")
+		}
+	}
+
+	caURL := ctx.String("ca-url")
+	if caURL == "" {
+		return errs.RequiredFlag(ctx, "ca-url")
+	}
+	root := ctx.String("root")
+	if root == "" {
+		root = pki.GetRootCAPath()
+		if _, err := os.Stat(root); err != nil {
+			return errs.RequiredFlag(ctx, "root")
+		}
+	}
+
+	cert, comment, err := readCertificate(crtFile)
+	if err != nil {
+		return err
+	}
+	key, err := readKey(keyFile, ctx.String("password-file"), cert)
+	if err != nil {
+		return err
+	}
+	if time.Now().After(certTime(cert.ValidBefore)) {
+		return errors.New("cannot renew an expired certificate")
+	}
+
+	audience, err := caAudience(ctx, caURL, "/1.0/ssh/renew")
+	if err != nil {
+		return err
+	}
+	client, err := newClient(caURL, root)
+	if err != nil {
+		return err
+	}
+
+	r := &renewer{
+		client:   client,
+		audience: audience,
+		cert:     cert,
+		key:      key,
+		comment:  comment,
+	}
+	afterRenew := func() error {
+		return runExecCmd(ctx.String("exec"))
+	}
+
+	if ctx.Bool("daemon") {
+		// Force is always enabled when daemon mode is used
+		ctx.Set("force", "true")
+		return r.Daemon(outFile, nextRenewDuration(cert, expiresIn), expiresIn, afterRenew)
+	}
+
+	// Do not renew if (cert.ValidBefore - now) > (expiresIn + jitter)
+	if expiresIn > 0 {
+		jitter := rand.Int63n(int64(expiresIn/20) + 1)
+		if d := time.Until(certTime(cert.ValidBefore)); d > expiresIn+time.Duration(jitter) {
+			ui.Printf("certificate not renewed: expires in %s\n", d.Round(time.Second))
+			return nil
+		}
+	}
+
+	if err := r.Renew(outFile); err != nil {
+		return err
+	}
+
+	ui.Printf("Your certificate has been saved in %s.\n", outFile)
+	return afterRenew()
+}
+
+// renewer renews a SSH certificate using its key to authorize the request.
+type renewer struct {
+	client   *client
+	audience string
+	cert     *ssh.Certificate
+	key      crypto.PrivateKey
+	comment  string
+}
+
+// Renew renews the certificate and writes the new one in outFile.
+func (r *renewer) Renew(outFile string) error {
+	tok, err := sshpopToken(r.cert, r.key, r.audience)
+	if err != nil {
+		return err
+	}
+	cert, err := r.client.RenewSSH(&renewRequest{OTT: tok})
+	if err != nil {
+		return errors.Wrap(err, "error renewing certificate")
+	}
+	if err := utils.WriteFile(outFile, marshalPublicKey(cert, r.comment), 0644); err != nil {
+		return errs.FileError(err, outFile)
+	}
+	r.cert = cert
+	return nil
+}
+
+// Daemon renews the certificate periodically until the process receives an
+// interrupt or termination signal. A SIGHUP forces the renewal.
+func (r *renewer) Daemon(outFile string, next, expiresIn time.Duration, afterRenew func() error) error {
+	const durationOnErrors = 1 * time.Minute
+
+	// Loggers
+	Info := log.New(os.Stdout, "INFO: ", log.LstdFlags)
+	Error := log.New(os.Stderr, "ERROR: ", log.LstdFlags)
+
+	renew := func() {
+		if err := r.Renew(outFile); err != nil {
+			next = durationOnErrors
+			Error.Println(err)
+			return
+		}
+		next = nextRenewDuration(r.cert, expiresIn)
+		Info.Printf("certificate renewed, next in %s", next.Round(time.Second))
+		if err := afterRenew(); err != nil {
+			Error.Println(err)
+		}
+	}
+
+	// Abort the requests in progress on an interrupt or termination signal
+	cancel := pki.CancelOnSignal()
+	defer cancel()
+
+	// Daemon loop
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	Info.Printf("first renewal in %s", next.Round(time.Second))
+	for {
+		select {
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGHUP:
+				renew()
+			case syscall.SIGINT, syscall.SIGTERM:
+				return nil
+			}
+		case <-time.After(next):
+			renew()
+		}
+	}
+}
+
+// nextRenewDuration returns the time to wait before the next renewal. By
+// default certificates are renewed after 2/3 of the validity period.
+func nextRenewDuration(cert *ssh.Certificate, expiresIn time.Duration) time.Duration {
+	validAfter, validBefore := certTime(cert.ValidAfter), certTime(cert.ValidBefore)
+	period := validBefore.Sub(validAfter)
+	if expiresIn == 0 {
+		expiresIn = period / 3
+	}
+
+	d := time.Until(validBefore) - expiresIn
+	d -= time.Duration(rand.Int63n(int64(period/20) + 1))
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// certTime converts the ValidAfter and ValidBefore fields of a certificate to
+// a time.
+func certTime(t uint64) time.Time {
+	if t >= uint64(1<<63) {
+		return time.Unix(1<<63-1, 0)
+	}
+	return time.Unix(int64(t), 0)
+}
+
+// readCertificate reads a SSH certificate in the authorized keys format, it
+// returns the certificate and its comment.
+func readCertificate(filename string) (*ssh.Certificate, string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, "", errs.FileError(err, filename)
+	}
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "error parsing %s", filename)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, "", errors.Errorf("error parsing %s: file is not a SSH certificate", filename)
+	}
+	return cert, comment, nil
+}
+
+// readKey reads the private key of the given certificate.
+func readKey(filename, passwordFile string, cert *ssh.Certificate) (crypto.PrivateKey, error) {
+	var opts []pemutil.Options
+	if passwordFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(passwordFile))
+	}
+	key, err := pemutil.Read(filename, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := keys.PublicKey(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+	if !bytes.Equal(sshPub.Marshal(), cert.Key.Marshal()) {
+		return nil, errors.Errorf("error reading %s: private key does not match the certificate", filename)
+	}
+	return key, nil
+}
+
+func runExecCmd(execCmd string) error {
+	execCmd = strings.TrimSpace(execCmd)
+	if execCmd == "" {
+		return nil
+	}
+	parts := strings.Split(execCmd, " ")
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
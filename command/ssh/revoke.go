@@ -0,0 +1,193 @@
+package ssh
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func revokeCommand() cli.Command {
+	return cli.Command{
+		Name:   "revoke",
+		Action: command.ActionFunc(revokeAction),
+		Usage:  "revoke a SSH certificate using the SSH CA",
+		UsageText: `**step ssh revoke** [<serial-number>]
+[**--cert**=<file>] [**--key**=<file>] [**--reason**=<string>]
+[**--reasonCode**=<code>] [**--token**=<token>] [**--issuer**=<name>]
+[**--kid**=<kid>] [**--password-file**=<file>] [**--ca-url**=<uri>]
+[**--root**=<file>] [**--force**]`,
+		Description: `**step ssh revoke** command revokes a SSH certificate using the SSH
+certificate authority of step-ca. Revoked certificates cannot be renewed or
+rekeyed, and they are included in the KRL files generated by **step ssh krl**,
+so sshd can reject them before they expire.
+
+The certificate can be revoked by serial number, with a token signed by a JWK
+provisioner, or using the **--cert** and **--key** flags, with a token signed
+by the key of the certificate.
+
+Before revoking the certificate, the command prints its serial number, and its
+key id and principals if **--cert** is used, and asks for confirmation. Use
+**--force**, or its alias **--yes**, to revoke it without asking.
+
+## POSITIONAL ARGUMENTS
+
+<serial-number>
+:  The serial number of the SSH certificate to revoke. It is not required if
+the **--cert** flag is used.
+
+## EXAMPLES
+
+Revoke a certificate using a JWK provisioner:
+'''
+$ step ssh revoke 3203851962452063478
+'''
+
+Revoke a certificate using the certificate and its private key:
+'''
+$ step ssh revoke --cert id_ecdsa-cert.pub --key id_ecdsa
+'''
+
+Revoke a certificate specifying the reason:
+'''
+$ step ssh revoke --reason "laptop stolen" --reasonCode 1 3203851962452063478
+'''
+
+Revoke a certificate from a script, without asking for confirmation:
+'''
+$ step ssh revoke --yes --token $TOKEN 3203851962452063478
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "cert",
+				Usage: `The SSH certificate <file> to revoke. Requires the **--key** flag.`,
+			},
+			cli.StringFlag{
+				Name:  "key",
+				Usage: `The private key <file> of the certificate in **--cert**.`,
+			},
+			cli.StringFlag{
+				Name:  "reason",
+				Usage: `The <string> representing the reason for which the certificate is being revoked.`,
+			},
+			cli.IntFlag{
+				Name: "reasonCode",
+				Usage: `The <code> representing the reason for which the certificate is being revoked.
+The codes are the ones defined for X.509 certificates in RFC 5280, e.g. 1 for
+keyCompromise.`,
+			},
+			tokenFlag,
+			provisionerIssuerFlag,
+			provisionerKidFlag,
+			cli.StringFlag{
+				Name: "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the one-time token
+generating key, or the private key in **--key**.`,
+			},
+			caURLFlag,
+			rootFlag,
+			flags.Force,
+		},
+	}
+}
+
+func revokeAction(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errs.TooManyArguments(ctx)
+	}
+
+	serial := ctx.Args().First()
+	crtFile, keyFile := ctx.String("cert"), ctx.String("key")
+	tok := ctx.String("token")
+	switch {
+	case crtFile != "" && keyFile == "":
+		return errs.RequiredWithFlag(ctx, "cert", "key")
+	case keyFile != "" && crtFile == "":
+		return errs.RequiredWithFlag(ctx, "key", "cert")
+	case crtFile != "" && tok != "":
+		return errs.IncompatibleFlagWithFlag(ctx, "cert", "token")
+	case crtFile == "" && serial == "":
+		return errs.TooFewArguments(ctx)
+	case tok != "" && ctx.IsSet("issuer"):
+		return errs.IncompatibleFlagWithFlag(ctx, "token", "issuer")
+	}
+
+	caURL := ctx.String("ca-url")
+	if caURL == "" {
+		return errs.RequiredFlag(ctx, "ca-url")
+	}
+	root := ctx.String("root")
+	if root == "" {
+		root = pki.GetRootCAPath()
+		if _, err := os.Stat(root); err != nil {
+			return errs.RequiredFlag(ctx, "root")
+		}
+	}
+
+	var summary []ui.Option
+	if crtFile != "" {
+		cert, _, err := readCertificate(crtFile)
+		if err != nil {
+			return err
+		}
+		summary = append(summary,
+			ui.WithSummary("Key ID", cert.KeyId),
+			ui.WithSummary("Principals", strings.Join(cert.ValidPrincipals, ", ")))
+		certSerial := strconv.FormatUint(cert.Serial, 10)
+		if serial != "" && serial != certSerial {
+			return errors.Errorf("serial number '%s' does not match the serial number of %s", serial, crtFile)
+		}
+		serial = certSerial
+		key, err := readKey(keyFile, ctx.String("password-file"), cert)
+		if err != nil {
+			return err
+		}
+		audience, err := caAudience(ctx, caURL, "/1.0/ssh/revoke")
+		if err != nil {
+			return err
+		}
+		if tok, err = sshpopToken(cert, key, audience); err != nil {
+			return err
+		}
+	}
+
+	if _, err := strconv.ParseUint(serial, 10, 64); err != nil {
+		return errors.Errorf("invalid serial number '%s'", serial)
+	}
+	summary = append(summary, ui.WithSummary("Serial Number", serial))
+	if err := utils.Confirm("Would you like to revoke this certificate", summary...); err != nil {
+		return err
+	}
+
+	if tok == "" {
+		var err error
+		if tok, err = newRevokeTokenFlow(ctx, caURL, root, serial); err != nil {
+			return err
+		}
+	}
+
+	client, err := newClient(caURL, root)
+	if err != nil {
+		return err
+	}
+	if _, err := client.RevokeSSH(&revokeRequest{
+		Serial:     serial,
+		OTT:        tok,
+		ReasonCode: ctx.Int("reasonCode"),
+		Reason:     ctx.String("reason"),
+		Passive:    true,
+	}); err != nil {
+		return errors.Wrap(err, "error revoking certificate")
+	}
+
+	ui.Printf("Certificate with Serial Number %s has been revoked.\n", serial)
+	return nil
+}
@@ -0,0 +1,133 @@
+package ssh
+
+import (
+	"github.com/smallstep/cli/command"
+	"github.com/urfave/cli"
+)
+
+// init creates and registers the ssh command
+func init() {
+	cmd := cli.Command{
+		Name:      "ssh",
+		Usage:     "create and manage ssh certificates",
+		UsageText: "step ssh <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step ssh** command group provides facilities to sign, renew, rekey and
+revoke SSH user and host certificates using the SSH certificate authority of
+step-ca.
+
+The flags **--ca-url**, **--root** and **--provisioner** can be defined in
+<$STEPPATH/config/defaults.json>, as in the **step ca** subcommands.
+
+## EXAMPLES
+
+Configure ssh to trust the host certificates signed by the CA:
+'''
+$ step ssh config
+'''
+
+Log in with the identity provider and add a short-lived user certificate to the
+ssh-agent:
+'''
+$ step ssh login
+'''
+
+Generate a new SSH key pair and user certificate:
+'''
+$ step ssh certificate mariano@work id_ecdsa
+'''
+
+Generate a new SSH key pair and user certificate, and add them to the agent:
+'''
+$ step ssh certificate --add-to-agent mariano@work id_ecdsa
+'''
+
+Sign the host key of a server:
+'''
+$ step ssh certificate --host --sign internal.example.com /etc/ssh/ssh_host_ecdsa_key.pub
+'''
+
+Renew the host certificate of a server periodically:
+'''
+$ step ssh renew --daemon --exec "systemctl reload sshd" \
+  /etc/ssh/ssh_host_ecdsa_key-cert.pub /etc/ssh/ssh_host_ecdsa_key
+'''
+
+Revoke a certificate and add it to the KRL used by sshd:
+'''
+$ step ssh revoke --cert id_ecdsa-cert.pub --key id_ecdsa
+$ step ssh krl --update --force /etc/ssh/revoked_keys id_ecdsa-cert.pub
+'''`,
+		Subcommands: cli.Commands{
+			command.StructuredOutput(certificateCommand()),
+			configCommand(),
+			command.StructuredOutput(krlCommand()),
+			command.StructuredOutput(loginCommand()),
+			renewCommand(),
+			command.StructuredOutput(rekeyCommand()),
+			revokeCommand(),
+		},
+	}
+
+	command.Register(cmd)
+}
+
+// common flags used in several commands
+var (
+	caURLFlag = cli.StringFlag{
+		Name:  "ca-url",
+		Usage: "<URI> of the targeted Step Certificate Authority.",
+	}
+
+	rootFlag = cli.StringFlag{
+		Name:  "root",
+		Usage: "The path to the PEM <file> used as the root certificate authority.",
+	}
+
+	tokenFlag = cli.StringFlag{
+		Name: "token",
+		Usage: `The one-time <token> used to authenticate with the CA in order to create the
+certificate.`,
+	}
+
+	provisionerKidFlag = cli.StringFlag{
+		Name:  "kid",
+		Usage: "The provisioner <kid> to use.",
+	}
+
+	provisionerIssuerFlag = cli.StringFlag{
+		Name:  "issuer,provisioner",
+		Usage: "The provisioner <name> to use.",
+	}
+
+	passwordFileFlag = cli.StringFlag{
+		Name: "password-file",
+		Usage: `The path to the <file> containing the password to decrypt the one-time token
+generating key.`,
+	}
+
+	principalFlag = cli.StringSliceFlag{
+		Name: "principal,n",
+		Usage: `Add a <principal> (user or host name) to the certificate. Use the '--principal'
+flag multiple times to configure multiple principals. If not set, the key id,
+or the local part of the key id if it is an email, is used as the only
+principal.`,
+	}
+
+	notBeforeFlag = cli.StringFlag{
+		Name: "not-before",
+		Usage: `The <time|duration> when the certificate validity period starts. If a <time> is
+used it is expected to be in RFC 3339 format. If a <duration> is used, it is a
+sequence of decimal numbers, each with optional fraction and a unit suffix, such
+as "300ms", "-1.5h" or "2h45m". Valid time units are "ns", "us" (or "µs"),
+"ms", "s", "m", "h".`,
+	}
+
+	notAfterFlag = cli.StringFlag{
+		Name: "not-after",
+		Usage: `The <time|duration> when the certificate validity period ends. If a <time> is
+used it is expected to be in RFC 3339 format. If a <duration> is used, it is a
+sequence of decimal numbers, each with optional fraction and a unit suffix, such
+as "300ms", "-1.5h" or "2h45m". Valid time units are "ns", "us" (or "µs"),
+"ms", "s", "m", "h".`,
+	}
+)
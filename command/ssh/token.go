@@ -0,0 +1,254 @@
+package ssh
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/crypto/randutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/exec"
+	"github.com/smallstep/cli/jose"
+	"github.com/smallstep/cli/token"
+	"github.com/smallstep/cli/token/provision"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshpopHeader is the header of the tokens signed by the key of a SSH
+// certificate, it contains the certificate in the base64 encoded wire format.
+const sshpopHeader = "sshpop"
+
+// sshClaims are the SSH options added to the "step" claim of the token.
+type sshClaims struct {
+	CertType    string   `json:"certType"`
+	KeyID       string   `json:"keyID"`
+	Principals  []string `json:"principals"`
+	ValidAfter  string   `json:"validAfter,omitempty"`
+	ValidBefore string   `json:"validBefore,omitempty"`
+}
+
+type provisionersSelect struct {
+	Name        string
+	Provisioner provisioner.Interface
+}
+
+// caAudience returns the audience of the tokens used in the CA endpoint with
+// the given path, e.g. /1.0/ssh/sign.
+func caAudience(ctx *cli.Context, caURL, path string) (string, error) {
+	u, err := url.Parse(caURL)
+	if err != nil {
+		return "", errs.InvalidFlagValue(ctx, "ca-url", caURL, "")
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https", "":
+		u.Scheme = "https"
+		return u.ResolveReference(&url.URL{Path: path}).String(), nil
+	default:
+		return "", errs.InvalidFlagValue(ctx, "ca-url", caURL, "")
+	}
+}
+
+// newTokenFlow generates a token to sign an SSH certificate. It uses a JWK
+// provisioner to sign the token, or it runs the OAuth flow of an OIDC
+// provisioner. If the claims do not have a key id only OIDC provisioners can
+// be used, the identity will be the email in the ID token.
+func newTokenFlow(ctx *cli.Context, caURL, root string, claims *sshClaims) (string, error) {
+	audience, err := caAudience(ctx, caURL, "/1.0/ssh/sign")
+	if err != nil {
+		return "", err
+	}
+
+	prov, err := selectProvisioner(ctx, caURL, root, claims.KeyID != "", true)
+	if err != nil {
+		return "", err
+	}
+
+	switch p := prov.(type) {
+	case *provisioner.OIDC:
+		out, err := exec.Step("oauth", "--oidc", "--bare",
+			"--provider", p.ConfigurationEndpoint,
+			"--client-id", p.ClientID, "--client-secret", p.ClientSecret)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(out)), nil
+	case *provisioner.JWK:
+		jwk, err := provisionerKey(ctx, caURL, root, p.Key.KeyID)
+		if err != nil {
+			return "", err
+		}
+		return generateToken(claims.KeyID, p.Key.KeyID, p.Name, audience, jwk,
+			token.WithClaim("step", map[string]interface{}{"ssh": claims}))
+	default:
+		return "", errors.Errorf("unsupported provisioner type %T", p)
+	}
+}
+
+// newRevokeTokenFlow generates a token to revoke the SSH certificate with the
+// given serial number, signed by the key of a JWK provisioner.
+func newRevokeTokenFlow(ctx *cli.Context, caURL, root, serial string) (string, error) {
+	audience, err := caAudience(ctx, caURL, "/1.0/ssh/revoke")
+	if err != nil {
+		return "", err
+	}
+
+	prov, err := selectProvisioner(ctx, caURL, root, true, false)
+	if err != nil {
+		return "", err
+	}
+
+	p, ok := prov.(*provisioner.JWK)
+	if !ok {
+		return "", errors.Errorf("unsupported provisioner type %T", prov)
+	}
+	jwk, err := provisionerKey(ctx, caURL, root, p.Key.KeyID)
+	if err != nil {
+		return "", err
+	}
+	return generateToken(serial, p.Key.KeyID, p.Name, audience, jwk)
+}
+
+// selectProvisioner returns the provisioner to use, filtered by the --kid and
+// --issuer flags. The user is asked to select one if there are several
+// options.
+func selectProvisioner(ctx *cli.Context, caURL, root string, allowJWK, allowOIDC bool) (provisioner.Interface, error) {
+	provisioners, err := pki.GetProvisioners(caURL, root)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*provisionersSelect
+	kid, issuer := ctx.String("kid"), ctx.String("issuer")
+	for _, prov := range provisioners {
+		if issuer != "" && prov.GetName() != issuer {
+			continue
+		}
+		switch p := prov.(type) {
+		case *provisioner.JWK:
+			if !allowJWK || (kid != "" && p.Key.KeyID != kid) {
+				continue
+			}
+			items = append(items, &provisionersSelect{
+				Name:        p.Key.KeyID + " (" + p.Name + ")",
+				Provisioner: p,
+			})
+		case *provisioner.OIDC:
+			if !allowOIDC || kid != "" {
+				continue
+			}
+			items = append(items, &provisionersSelect{
+				Name:        p.ClientID + " (" + p.Name + ")",
+				Provisioner: p,
+			})
+		}
+	}
+
+	var i int
+	switch {
+	case len(items) == 0 && kid != "":
+		return nil, errs.InvalidFlagValue(ctx, "kid", kid, "")
+	case len(items) == 0 && issuer != "":
+		return nil, errs.InvalidFlagValue(ctx, "issuer", issuer, "")
+	case len(items) == 0 && !allowJWK:
+		return nil, errors.New("cannot create a new token: the CA does not have any OIDC provisioner configured")
+	case len(items) == 0 && !allowOIDC:
+		return nil, errors.New("cannot create a new token: the CA does not have any JWK provisioner configured")
+	case len(items) == 0:
+		return nil, errors.New("cannot create a new token: the CA does not have any provisioner configured")
+	case len(items) == 1:
+		if err := ui.PrintSelected("Provisioner", items[0].Name); err != nil {
+			return nil, err
+		}
+	default:
+		if i, _, err = ui.Select("What provisioner key do you want to use?", items, ui.WithSelectTemplates(ui.NamedSelectTemplates("Provisioner")), ui.WithFlag("issuer")); err != nil {
+			return nil, err
+		}
+	}
+	return items[i].Provisioner, nil
+}
+
+// provisionerKey downloads and decrypts the key of the provisioner with the
+// given kid.
+func provisionerKey(ctx *cli.Context, caURL, root, kid string) (*jose.JSONWebKey, error) {
+	encrypted, err := pki.GetProvisionerKey(caURL, root, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []jose.Option{
+		jose.WithUIOptions(ui.WithPromptTemplates(ui.PromptTemplates()), ui.WithFlag("password-file")),
+	}
+	if passwordFile := ctx.String("password-file"); passwordFile != "" {
+		opts = append(opts, jose.WithPasswordFile(passwordFile))
+	}
+	decrypted, err := jose.Decrypt("Please enter the password to decrypt the provisioner key", []byte(encrypted), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk := new(jose.JSONWebKey)
+	if err := json.Unmarshal(decrypted, jwk); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling provisioning key")
+	}
+	return jwk, nil
+}
+
+// generateToken generates a token for the given subject signed by the
+// provisioner key.
+func generateToken(subject, kid, issuer, audience string, jwk *jose.JSONWebKey, opts ...token.Options) (string, error) {
+	// A random jwt id will be used to identify duplicated tokens
+	jwtID, err := randutil.Hex(64) // 256 bits
+	if err != nil {
+		return "", err
+	}
+
+	opts = append([]token.Options{
+		token.WithJWTID(jwtID),
+		token.WithKid(kid),
+		token.WithIssuer(issuer),
+		token.WithAudience(audience),
+	}, opts...)
+	tok, err := provision.New(subject, opts...)
+	if err != nil {
+		return "", err
+	}
+	return tok.SignedString(jwk.Algorithm, jwk.Key)
+}
+
+// sshpopToken generates a token signed by the key of the given certificate,
+// proving the possession of the key. These tokens are used to renew or rekey
+// a certificate.
+func sshpopToken(cert *ssh.Certificate, key crypto.PrivateKey, audience string) (string, error) {
+	pub, err := keys.PublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	jwk, err := jose.PublicJWK(pub)
+	if err != nil {
+		return "", err
+	}
+	jwtID, err := randutil.Hex(64) // 256 bits
+	if err != nil {
+		return "", err
+	}
+
+	c, err := token.NewClaims(
+		token.WithSubject(cert.KeyId),
+		token.WithIssuer("step-cli"),
+		token.WithJWTID(jwtID),
+		token.WithAudience(audience),
+	)
+	if err != nil {
+		return "", err
+	}
+	c.SetHeader(sshpopHeader, []string{base64.StdEncoding.EncodeToString(cert.Marshal())})
+	return c.Sign(jose.SignatureAlgorithm(jwk.Algorithm), key)
+}
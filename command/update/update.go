@@ -0,0 +1,127 @@
+package update
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/update"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	cmd := cli.Command{
+		Name:      "update",
+		Action:    cli.ActionFunc(updateAction),
+		Usage:     "install the latest release of step",
+		UsageText: `**step update** [**--check**] [**--force**]`,
+		Description: `**step update** downloads the latest release of step for the current platform
+from GitHub, verifies the signature of the checksums file published with the
+release using the release signing key embedded in the binary, verifies the
+SHA256 checksum of the download, and replaces the running binary with it.
+Binaries built without the release signing key cannot be updated.
+
+The binary is only replaced if the latest release is newer than the current
+version, use **--force** to install it anyway. The user running the command
+must be able to write in the directory of the binary.
+
+## EXAMPLES
+
+Check if there is a new release:
+'''
+$ step update --check
+'''
+
+Install the latest release:
+'''
+$ step update
+'''
+
+Install the latest release in a system directory:
+'''
+$ sudo step update
+'''`,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "check",
+				Usage: "Print the latest release and exit without installing it.",
+			},
+			cli.BoolFlag{
+				Name:  "force",
+				Usage: "Install the latest release even if the current version is the same or newer.",
+			},
+			cli.StringFlag{
+				Name:   "url",
+				Value:  update.DefaultURL,
+				Hidden: true,
+			},
+		},
+	}
+
+	command.Register(cmd)
+}
+
+// newHTTPClient returns the client used to download the releases. It uses the
+// proxy, timeout and logs configured with the global flags.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: pki.WrapTransport(pki.NewTransport(nil)),
+	}
+}
+
+func updateAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+	if ctx.Bool("check") && ctx.Bool("force") {
+		return errs.IncompatibleFlagWithFlag(ctx, "check", "force")
+	}
+
+	client := newHTTPClient()
+	release, err := update.Latest(client, ctx.String("url"))
+	if err != nil {
+		return err
+	}
+
+	current := config.ReleaseVersion()
+	newer := release.IsNewer(current)
+	if ctx.Bool("check") {
+		if newer {
+			ui.Printf("A new release is available: %s, the current version is %s.\n", release.Version(), current)
+		} else {
+			ui.Printf("The current version %s is up to date.\n", current)
+		}
+		return nil
+	}
+	if !newer && !ctx.Bool("force") {
+		ui.Printf("The current version %s is up to date.\n", current)
+		return nil
+	}
+
+	filename, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "error getting the path of the step binary")
+	}
+	if filename, err = filepath.EvalSymlinks(filename); err != nil {
+		return errors.Wrap(err, "error getting the path of the step binary")
+	}
+
+	ui.Printf("Downloading step %s for %s/%s...\n", release.Version(), runtime.GOOS, runtime.GOARCH)
+	binary, err := update.Download(client, release, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	if err := update.Install(filename, binary); err != nil {
+		return err
+	}
+
+	ui.Printf("Your step binary %s has been updated to %s.\n", filename, release.Version())
+	return nil
+}
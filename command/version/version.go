@@ -2,26 +2,93 @@ package version
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/urfave/cli"
 
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/crypto/pki"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/update"
 )
 
 func init() {
 	cmd := cli.Command{
-		Name:   "version",
-		Usage:  "display the current version of the cli",
+		Name:      "version",
+		Usage:     "display the current version of the cli",
+		UsageText: `**step version** [**--check**]`,
+		Description: `**step version** prints the version and the release date of the cli. With
+**--check** it also gets the latest release from GitHub and reports if a newer
+version is available, see **step update**. The version can be printed as JSON
+or YAML using the global flags **--json** or **--format**.
+
+## EXAMPLES
+
+Print the version:
+'''
+$ step version
+Smallstep CLI/0.13.3 (linux/amd64)
+Release Date: 2019-10-17 01:30 UTC
+'''
+
+Print the version and check the latest release as JSON:
+'''
+$ step --json version --check
+{
+  "version": "0.13.3",
+  "release_date": "2019-10-17 01:30 UTC",
+  "latest_version": "0.14.0",
+  "update_available": true
+}
+'''`,
 		Action: Command,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "check",
+				Usage: "Check if a newer release is available.",
+			},
+			cli.StringFlag{
+				Name:   "url",
+				Value:  update.DefaultURL,
+				Hidden: true,
+			},
+		},
 	}
 
-	command.Register(cmd)
+	command.Register(command.StructuredOutput(cmd))
 }
 
 // Command prints out the current version of the tool
 func Command(c *cli.Context) error {
+	var release *update.Release
+	if c.Bool("check") {
+		var err error
+		client := &http.Client{
+			Transport: pki.WrapTransport(pki.NewTransport(nil)),
+		}
+		if release, err = update.Latest(client, c.String("url")); err != nil {
+			return err
+		}
+	}
+
+	if ui.IsStructured() {
+		ui.PrintSelected("Version", config.ReleaseVersion())
+		ui.PrintSelected("Release Date", config.ReleaseDate())
+		if release != nil {
+			ui.PrintSelected("Latest Version", release.Version())
+			ui.PrintSelectedValue("Update Available", release.IsNewer(config.ReleaseVersion()))
+		}
+		return nil
+	}
+
 	fmt.Printf("%s\n", config.Version())
 	fmt.Printf("Release Date: %s\n", config.ReleaseDate())
+	if release != nil {
+		fmt.Printf("Latest Version: %s\n", release.Version())
+		if release.IsNewer(config.ReleaseVersion()) {
+			fmt.Println("A new release is available, run 'step update' to install it.")
+		}
+	}
 	return nil
 }
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/user"
 	"path"
 	"runtime"
 	"time"
@@ -20,12 +19,17 @@ var (
 // the default configuration path.
 const StepPathEnv = "STEPPATH"
 
-// stepPath will be populated in init() with the proper STEPPATH.
+// basePath will be populated in init() with the proper STEPPATH.
+var basePath string
+
+// stepPath will be populated in init() with the proper STEPPATH or the path
+// of the current context.
 var stepPath string
 
 // StepPath returns the path for the step configuration directory, this is
 // defined by the environment variable STEPPATH or if this is not set it will
-// default to '$HOME/.step'.
+// default to '$HOME/.step'. If a context is in use, it returns the directory
+// of that context.
 func StepPath() string {
 	return stepPath
 }
@@ -33,13 +37,14 @@ func StepPath() string {
 func init() {
 	l := log.New(os.Stderr, "", 0)
 
-	// Get step path from environment or user's home directory
+	// Get step path from environment, the base path file or user's home
+	// directory
 	stepPath = os.Getenv(StepPathEnv)
 	if stepPath == "" {
-		usr, err := user.Current()
-		if err == nil && usr.HomeDir != "" {
-			stepPath = path.Join(usr.HomeDir, ".step")
-		} else if home := os.Getenv("HOME"); home != "" {
+		stepPath = readBasePathFile()
+	}
+	if stepPath == "" {
+		if home := homeDir(); home != "" {
 			stepPath = path.Join(home, ".step")
 		} else {
 			l.Fatalf("Error obtaining home directory, please define environment variable %s.", StepPathEnv)
@@ -59,6 +64,19 @@ func init() {
 	}
 	// cleanup
 	stepPath = path.Clean(stepPath)
+	basePath = stepPath
+
+	// Use the context directory if a context is set
+	if name := readCurrentContext(); name != "" {
+		if err := ValidateContextName(name); err != nil {
+			l.Printf("Ignoring context: %s; using %s.", err, basePath)
+		} else if ContextExists(name) {
+			context = name
+			stepPath = ContextPath(name)
+		} else {
+			l.Printf("Context '%s' does not exist, using %s.", name, basePath)
+		}
+	}
 }
 
 // Set updates the Version and ReleaseDate
@@ -69,13 +87,17 @@ func Set(v, t string) {
 
 // Version returns the current version of the binary
 func Version() string {
-	out := commit
+	return fmt.Sprintf("Smallstep CLI/%s (%s/%s)",
+		ReleaseVersion(), runtime.GOOS, runtime.GOARCH)
+}
+
+// ReleaseVersion returns the version number of the binary, e.g. 0.13.3, or
+// 0000000-dev if it was not set during the build.
+func ReleaseVersion() string {
 	if commit == "N/A" {
-		out = "0000000-dev"
+		return "0000000-dev"
 	}
-
-	return fmt.Sprintf("Smallstep CLI/%s (%s/%s)",
-		out, runtime.GOOS, runtime.GOARCH)
+	return commit
 }
 
 // ReleaseDate returns the time of when the binary was built
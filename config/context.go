@@ -0,0 +1,119 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StepContextEnv defines the name of the environment variable that can
+// overwrite the current context.
+const StepContextEnv = "STEPCONTEXT"
+
+// contextsDir is the directory name under the base step path where the
+// contexts are stored.
+const contextsDir = "authorities"
+
+// currentContextFile is the file name under the base step path that stores
+// the name of the current context.
+const currentContextFile = "current-context"
+
+// context will be populated in init() with the current context name.
+var context string
+
+var contextNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// BasePath returns the base step path, defined by the environment variable
+// STEPPATH or '$HOME/.step'. It does not take into account the current
+// context.
+func BasePath() string {
+	return basePath
+}
+
+// Context returns the name of the current context, or an empty string if no
+// context is being used.
+func Context() string {
+	return context
+}
+
+// ContextPath returns the path of the directory used by the given context.
+func ContextPath(name string) string {
+	return filepath.Join(basePath, contextsDir, name)
+}
+
+// ValidateContextName returns an error if the given name cannot be used as a
+// context name.
+func ValidateContextName(name string) error {
+	if !contextNameRegexp.MatchString(name) {
+		return errors.Errorf("invalid context name '%s': names must start with a letter or a number, "+
+			"and contain only letters, numbers, '.', '_' or '-'", name)
+	}
+	return nil
+}
+
+// ContextExists returns true if the given context has been created. It
+// returns false if the name is not a valid context name, so a name like
+// '../foo' cannot point outside of the contexts directory.
+func ContextExists(name string) bool {
+	if ValidateContextName(name) != nil {
+		return false
+	}
+	fi, err := os.Stat(ContextPath(name))
+	return err == nil && fi.IsDir()
+}
+
+// Contexts returns the sorted list of the available contexts.
+func Contexts() ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(basePath, contextsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error reading contexts")
+	}
+	var names []string
+	for _, fi := range infos {
+		if fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SetCurrentContext stores the given context as the current one. An empty
+// name removes the current context and the base step path will be used.
+func SetCurrentContext(name string) error {
+	filename := filepath.Join(basePath, currentContextFile)
+	if name == "" {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "error removing %s", filename)
+		}
+		return nil
+	}
+	if !ContextExists(name) {
+		return errors.Errorf("context '%s' does not exist", name)
+	}
+	if err := ioutil.WriteFile(filename, []byte(name+"\n"), 0600); err != nil {
+		return errors.Wrapf(err, "error writing %s", filename)
+	}
+	return nil
+}
+
+// readCurrentContext returns the context from the environment or from the
+// current context file.
+func readCurrentContext() string {
+	if name := os.Getenv(StepContextEnv); name != "" {
+		return name
+	}
+	b, err := ioutil.ReadFile(filepath.Join(basePath, currentContextFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// homeDir returns the home directory of the current user, or an empty string
+// if it cannot be found.
+func homeDir() string {
+	if usr, err := user.Current(); err == nil && usr.HomeDir != "" {
+		return usr.HomeDir
+	}
+	return os.Getenv("HOME")
+}
+
+// BasePathFile returns the file that stores the base step path set with
+// 'step path base --set'. The file is <$XDG_CONFIG_HOME/step/path>, or
+// <$HOME/.config/step/path> if XDG_CONFIG_HOME is not defined. It returns an
+// empty string if the home directory cannot be found.
+func BasePathFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := homeDir()
+		if home == "" {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "step", "path")
+}
+
+// SetBasePath stores the given directory as the base step path of the current
+// user, creating the directory if necessary. An empty directory removes the
+// stored path and '$HOME/.step' will be used. The environment variable STEPPATH
+// always takes precedence over the stored path.
+func SetBasePath(dir string) error {
+	filename := BasePathFile()
+	if filename == "" {
+		return errors.Errorf("error obtaining home directory, please define environment variable %s", StepPathEnv)
+	}
+
+	if dir == "" {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "error removing %s", filename)
+		}
+		return nil
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrapf(err, "error getting absolute path of %s", dir)
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return errors.Wrapf(err, "error creating %s", dir)
+		}
+	} else if !fi.IsDir() {
+		return errors.Errorf("'%s' is not a directory", dir)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return errors.Wrapf(err, "error creating %s", filepath.Dir(filename))
+	}
+	if err := ioutil.WriteFile(filename, []byte(dir+"\n"), 0600); err != nil {
+		return errors.Wrapf(err, "error writing %s", filename)
+	}
+	return nil
+}
+
+// readBasePathFile returns the base step path stored with SetBasePath, or an
+// empty string if there is none.
+func readBasePathFile() string {
+	filename := BasePathFile()
+	if filename == "" {
+		return ""
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
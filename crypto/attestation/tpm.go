@@ -0,0 +1,135 @@
+package attestation
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/tpm"
+)
+
+// Object identifiers of the TPM attributes in the subject alternative name of
+// the EK certificates, defined in the TCG EK Credential Profile.
+var (
+	oidSubjectAltName  = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidTPMManufacturer = asn1.ObjectIdentifier{2, 23, 133, 2, 1}
+	oidTPMModel        = asn1.ObjectIdentifier{2, 23, 133, 2, 2}
+	oidTPMVersion      = asn1.ObjectIdentifier{2, 23, 133, 2, 3}
+)
+
+// TPM contains the properties of a key created in a TPM 2.0.
+type TPM struct {
+	// Manufacturer is the manufacturer of the TPM in the EK certificate,
+	// e.g. "id:49465800".
+	Manufacturer string
+	// Model is the model of the TPM in the EK certificate.
+	Model string
+	// Version is the firmware version of the TPM in the EK certificate,
+	// e.g. "id:00070002".
+	Version string
+	// EKCertificate is the verified EK certificate of the TPM.
+	EKCertificate *x509.Certificate
+	// AKCertificate is the verified certificate of the attestation key.
+	AKCertificate *x509.Certificate
+	// PublicKey is the attested key.
+	PublicKey crypto.PublicKey
+}
+
+// ManufacturerID returns the vendor id of the manufacturer, e.g. "IFX" for
+// "id:49465800". It returns an empty string if the manufacturer is not in
+// the "id:<hex>" format.
+func (t *TPM) ManufacturerID() string {
+	b, err := hex.DecodeString(strings.TrimPrefix(t.Manufacturer, "id:"))
+	if err != nil || !strings.HasPrefix(t.Manufacturer, "id:") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+}
+
+// VerifyTPM verifies the attestation of a key created in a TPM and returns
+// the attested properties of the key. The EK certificate in the attestation
+// is verified using the manufacturer roots in ekRoots, and the AK certificate
+// using the roots in akRoots. The AK certificate must identify the EK, this
+// links the attestation key to the TPM described by the EK certificate. If a
+// nonce is given it must match the one in the attestation.
+func VerifyTPM(a *tpm.Attestation, nonce []byte, ekRoots, akRoots *x509.CertPool) (*TPM, error) {
+	if ekRoots == nil {
+		return nil, errors.New("error verifying TPM attestation: the EK roots are required")
+	}
+	if akRoots == nil {
+		return nil, errors.New("error verifying TPM attestation: the AK roots are required")
+	}
+	pub, err := a.Verify(nonce, akRoots)
+	if err != nil {
+		return nil, err
+	}
+	ak, err := a.VerifyAK(akRoots)
+	if err != nil {
+		return nil, err
+	}
+	ek, err := a.VerifyEK(ekRoots)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.VerifyEKBinding(ak); err != nil {
+		return nil, err
+	}
+	t := &TPM{
+		EKCertificate: ek,
+		AKCertificate: ak,
+		PublicKey:     pub,
+	}
+	if err := parseTPMInfo(ek, t); err != nil {
+		return nil, errors.Wrap(err, "error parsing EK certificate")
+	}
+	return t, nil
+}
+
+// parseTPMInfo sets the manufacturer, model and version of the TPM from the
+// directory name in the subject alternative name of the EK certificate.
+func parseTPMInfo(crt *x509.Certificate, t *TPM) error {
+	for _, ext := range crt.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var seq asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &seq); err != nil || len(rest) > 0 {
+			return errors.New("invalid subject alternative name extension")
+		}
+		rest := seq.Bytes
+		for len(rest) > 0 {
+			var v asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &v); err != nil {
+				return errors.New("invalid subject alternative name extension")
+			}
+			// directoryName [4] Name
+			if v.Class != asn1.ClassContextSpecific || v.Tag != 4 {
+				continue
+			}
+			var name pkix.RDNSequence
+			if _, err := asn1.Unmarshal(v.Bytes, &name); err != nil {
+				return errors.New("invalid directory name in subject alternative name extension")
+			}
+			for _, rdn := range name {
+				for _, atv := range rdn {
+					value := fmt.Sprint(atv.Value)
+					switch {
+					case atv.Type.Equal(oidTPMManufacturer):
+						t.Manufacturer = value
+					case atv.Type.Equal(oidTPMModel):
+						t.Model = value
+					case atv.Type.Equal(oidTPMVersion):
+						t.Version = value
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package attestation
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/tpm"
+)
+
+func mustEKCertificate(t *testing.T, names ...asn1.RawValue) *x509.Certificate {
+	san, err := asn1.Marshal(names)
+	assert.FatalError(t, err)
+	return &x509.Certificate{
+		Extensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{2, 5, 29, 15}, Value: []byte{3, 2, 5, 32}},
+			{Id: oidSubjectAltName, Critical: true, Value: san},
+		},
+	}
+}
+
+func mustDirectoryName(t *testing.T, name pkix.RDNSequence) asn1.RawValue {
+	b, err := asn1.Marshal(name)
+	assert.FatalError(t, err)
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: b}
+}
+
+func TestParseTPMInfo(t *testing.T) {
+	dirName := mustDirectoryName(t, pkix.RDNSequence{
+		{{Type: oidTPMManufacturer, Value: "id:49465800"}},
+		{{Type: oidTPMModel, Value: "SLB9670"}},
+		{{Type: oidTPMVersion, Value: "id:00070055"}},
+	})
+	dnsName := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("tpm.example.com")}
+
+	var got TPM
+	assert.FatalError(t, parseTPMInfo(mustEKCertificate(t, dnsName, dirName), &got))
+	assert.Equals(t, TPM{Manufacturer: "id:49465800", Model: "SLB9670", Version: "id:00070055"}, got)
+	assert.Equals(t, "IFX", got.ManufacturerID())
+
+	got = TPM{}
+	assert.FatalError(t, parseTPMInfo(&x509.Certificate{}, &got))
+	assert.Equals(t, TPM{}, got)
+
+	crt := &x509.Certificate{Extensions: []pkix.Extension{{Id: oidSubjectAltName, Value: []byte("foo")}}}
+	assert.Error(t, parseTPMInfo(crt, &got))
+	invalid := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: []byte{1, 2}}
+	assert.Error(t, parseTPMInfo(mustEKCertificate(t, invalid), &got))
+}
+
+func TestTPM_ManufacturerID(t *testing.T) {
+	tests := map[string]string{
+		"id:49465800": "IFX",
+		"id:4E544300": "NTC",
+		"id:494E5443": "INTC",
+		"id:53544D20": "STM",
+		"Infineon":    "",
+		"id:zz":       "",
+		"":            "",
+	}
+	for manufacturer, want := range tests {
+		tp := &TPM{Manufacturer: manufacturer}
+		assert.Equals(t, want, tp.ManufacturerID())
+	}
+}
+
+func TestVerifyTPM_roots(t *testing.T) {
+	_, err := VerifyTPM(&tpm.Attestation{}, nil, nil, x509.NewCertPool())
+	if assert.Error(t, err) {
+		assert.Equals(t, "error verifying TPM attestation: the EK roots are required", err.Error())
+	}
+	_, err = VerifyTPM(&tpm.Attestation{}, nil, x509.NewCertPool(), nil)
+	if assert.Error(t, err) {
+		assert.Equals(t, "error verifying TPM attestation: the AK roots are required", err.Error())
+	}
+}
@@ -0,0 +1,151 @@
+package attestation
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Object identifiers of the extensions in the YubiKey attestation
+// certificates.
+var (
+	oidYubicoFirmwareVersion = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 3}
+	oidYubicoSerialNumber    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 7}
+	oidYubicoPolicy          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 8}
+	oidYubicoFormFactor      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 9}
+)
+
+// yubiKeySubjectPrefix is the prefix of the common name of the attestation
+// certificates, it's followed by the slot, e.g. "YubiKey PIV Attestation 9a".
+const yubiKeySubjectPrefix = "YubiKey PIV Attestation "
+
+var yubiKeyPINPolicies = map[byte]string{
+	1: "never",
+	2: "once",
+	3: "always",
+}
+
+var yubiKeyTouchPolicies = map[byte]string{
+	1: "never",
+	2: "always",
+	3: "cached",
+}
+
+var yubiKeyFormFactors = map[byte]string{
+	0x01: "USB-A Keychain",
+	0x02: "USB-A Nano",
+	0x03: "USB-C Keychain",
+	0x04: "USB-C Nano",
+	0x05: "USB-C/Lightning Keychain",
+	0x81: "USB-A Keychain FIPS",
+	0x82: "USB-A Nano FIPS",
+	0x83: "USB-C Keychain FIPS",
+	0x84: "USB-C Nano FIPS",
+	0x85: "USB-C/Lightning Keychain FIPS",
+}
+
+// YubiKey contains the properties of a key generated in a YubiKey PIV slot.
+// Older YubiKeys do not include the serial number or the form factor in the
+// attestation, in that case those fields are empty.
+type YubiKey struct {
+	// Serial is the serial number of the YubiKey.
+	Serial uint32
+	// Firmware is the firmware version of the YubiKey, e.g. "5.2.4".
+	Firmware string
+	// FormFactor is the form factor of the YubiKey, e.g. "USB-A Keychain".
+	FormFactor string
+	// Slot is the PIV slot of the key, e.g. "9a".
+	Slot string
+	// PINPolicy is the PIN policy of the key: never, once or always.
+	PINPolicy string
+	// TouchPolicy is the touch policy of the key: never, always or cached.
+	TouchPolicy string
+	// PublicKey is the attested key.
+	PublicKey crypto.PublicKey
+}
+
+// VerifyYubiKey verifies the attestation certificate of a key generated in a
+// YubiKey and returns the attested properties of the key. The chain must
+// contain the attestation certificate of the key followed by the attestation
+// certificate of the YubiKey, stored in the slot f9. If roots is nil the
+// Yubico roots are used.
+func VerifyYubiKey(chain []*x509.Certificate, roots *x509.CertPool) (*YubiKey, error) {
+	if len(chain) != 2 {
+		return nil, errors.New("error verifying YubiKey attestation: the chain must contain the attestation certificate and the YubiKey attestation certificate")
+	}
+	if roots == nil {
+		roots = YubicoRoots()
+	}
+
+	leaf, device := chain[0], chain[1]
+	// The YubiKey attestation certificate of some YubiKey 4 does not have the
+	// basic constraints extension.
+	if !device.BasicConstraintsValid {
+		device.BasicConstraintsValid = true
+		device.IsCA = true
+	}
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(device)
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, errors.Wrap(err, "error verifying YubiKey attestation")
+	}
+
+	yk, err := parseYubiKey(leaf)
+	if err != nil {
+		return nil, errors.Wrap(err, "error verifying YubiKey attestation")
+	}
+	return yk, nil
+}
+
+// parseYubiKey returns the properties in the given attestation certificate.
+func parseYubiKey(crt *x509.Certificate) (*YubiKey, error) {
+	if !strings.HasPrefix(crt.Subject.CommonName, yubiKeySubjectPrefix) {
+		return nil, errors.Errorf("'%s' is not a key attestation certificate", crt.Subject.CommonName)
+	}
+	yk := &YubiKey{
+		Slot:      strings.TrimPrefix(crt.Subject.CommonName, yubiKeySubjectPrefix),
+		PublicKey: crt.PublicKey,
+	}
+	for _, ext := range crt.Extensions {
+		switch {
+		case ext.Id.Equal(oidYubicoFirmwareVersion):
+			if len(ext.Value) != 3 {
+				return nil, errors.New("invalid firmware version extension")
+			}
+			yk.Firmware = fmt.Sprintf("%d.%d.%d", ext.Value[0], ext.Value[1], ext.Value[2])
+		case ext.Id.Equal(oidYubicoSerialNumber):
+			var serial int64
+			if rest, err := asn1.Unmarshal(ext.Value, &serial); err != nil || len(rest) > 0 || serial < 0 || serial > 0xffffffff {
+				return nil, errors.New("invalid serial number extension")
+			}
+			yk.Serial = uint32(serial)
+		case ext.Id.Equal(oidYubicoPolicy):
+			if len(ext.Value) != 2 {
+				return nil, errors.New("invalid policy extension")
+			}
+			var ok1, ok2 bool
+			yk.PINPolicy, ok1 = yubiKeyPINPolicies[ext.Value[0]]
+			yk.TouchPolicy, ok2 = yubiKeyTouchPolicies[ext.Value[1]]
+			if !ok1 || !ok2 {
+				return nil, errors.New("invalid policy extension")
+			}
+		case ext.Id.Equal(oidYubicoFormFactor):
+			if len(ext.Value) != 1 {
+				return nil, errors.New("invalid form factor extension")
+			}
+			var ok bool
+			if yk.FormFactor, ok = yubiKeyFormFactors[ext.Value[0]]; !ok && ext.Value[0] != 0 {
+				yk.FormFactor = fmt.Sprintf("unknown (0x%02x)", ext.Value[0])
+			}
+		}
+	}
+	return yk, nil
+}
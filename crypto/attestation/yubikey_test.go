@@ -0,0 +1,172 @@
+package attestation
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+// Attestation certificates of keys generated in the slot 9a of two YubiKeys,
+// the first one is issued by the PIV root and the second one by the U2F root.
+const (
+	yubiKeyAttestation = `-----BEGIN CERTIFICATE-----
+MIICVTCCAT2gAwIBAgIQAU4Yg7Qnw9FZgMBEaJ7ZMzANBgkqhkiG9w0BAQsFADAh
+MR8wHQYDVQQDDBZZdWJpY28gUElWIEF0dGVzdGF0aW9uMCAXDTE2MDMxNDAwMDAw
+MFoYDzIwNTIwNDE3MDAwMDAwWjAlMSMwIQYDVQQDDBpZdWJpS2V5IFBJViBBdHRl
+c3RhdGlvbiA5YTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABATzM3sJuwemL2Ha
+HkGIzmCVjUMreNIVrRLOvnbZjoVflk1eab/iLUlKzk/2jXTu9TISRg2dhyXcutct
+vnqr66yjTjBMMBEGCisGAQQBgsQKAwMEAwUEAzAUBgorBgEEAYLECgMHBAYCBADw
+DxQwEAYKKwYBBAGCxAoDCAQCAgEwDwYKKwYBBAGCxAoDCQQBBDANBgkqhkiG9w0B
+AQsFAAOCAQEAFX0hL5gi/g4ZM7vCH5kDAtma7eBp0LpbCzR313GGyBR7pJFtuj2l
+bWU+V3SFRihXBTDb8q+uvyCBqgz1szdZzrpfjqNkhEPfPNabxjxJxVoe6Gdcn115
+aduxfqqT2u+YIsERzaIIIisehLQkc/5zLkpocA6jbKBZnZWUBJIxuz4QmYTIf0O4
+HPE2o4JbAyGx/hRaqVvDgNeAz94ZFjb4Mp3RNbbdRUZB0ehrT/IGRJoHRu2HKFGM
+ylRJL2kjKPoEc4XHbCu+MfmAIrQ4Xseg85zyI7ThhYvAzktdLHhQyfYr4wrrLCN3
+oeTzmiqIHe9AataJXQ+mEQEEc9TNY23RFg==
+-----END CERTIFICATE-----`
+
+	yubiKeyDevice = `-----BEGIN CERTIFICATE-----
+MIIC+jCCAeKgAwIBAgIJAKs/UIpBjg1uMA0GCSqGSIb3DQEBCwUAMCsxKTAnBgNV
+BAMMIFl1YmljbyBQSVYgUm9vdCBDQSBTZXJpYWwgMjYzNzUxMCAXDTE2MDMxNDAw
+MDAwMFoYDzIwNTIwNDE3MDAwMDAwWjAhMR8wHQYDVQQDDBZZdWJpY28gUElWIEF0
+dGVzdGF0aW9uMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA0zdJWGnk
+aLE8Rb+TP7iSffhJV9SJEp2Me4QcfVidgHqyIdo0lruBk69RF1nrmS3i+G1yyUh/
+ymAPZkcQCpms0E23Dmhue1VRpBedcsVtO/xSrfu0qAWTslp/k57ry6vkidrQU1cx
+l2KodH3KTmnZmaskQD8eGtxXwcmLOmhKem6GSqhN/3QznaDhZmVUAvUKSOaIzOxn
+2u1mDHhGwaHhR7dklsDwN7oni4WWX1GJXtzpB8j6JhoqyqXwSbq+ck54PfzUoOFd
+/2yKyFRDXnQvzbNL7+afbxBQQMxxo1e24DNE/cp+K09eT7Gh1Urao6meaSssN4aV
+FfmkhC2NapGKMQIDAQABoykwJzARBgorBgEEAYLECgMDBAMFBAMwEgYDVR0TAQH/
+BAgwBgEB/wIBADANBgkqhkiG9w0BAQsFAAOCAQEAJfOLOQYGyIMQ5y+sDkYz+e6G
+H8BqqiYL9VOC3U3KQX9mrtZnaIexqJOCQyCFOSvaTFJvOfNiCCKQuLbmS+Qn4znd
+nSitCsdJSFKskQP7hbXqUK01epb6iTuuko4w3V57YVudnniZBD2s4XoNcJ6BFizZ
+3iXQqRMaLVfFHS9Qx0iLZLcR2s29nIl6NI/qFdIgkyo07J5cPnBiD6wxQft8FdfR
+bgx9yrrjY0mvj/k5LRN6lab8lTolgI5luJtKNueq96LVkTkAzcCaJPQ9YQ4cxeU9
+OapsEeOk6xf5bRPtdf0WhEKthXywt9D0pSHhAI+fpLNe/VtlZpt3hn9aTbqSug==
+-----END CERTIFICATE-----`
+
+	yubiKey2018Attestation = `-----BEGIN CERTIFICATE-----
+MIICLzCCARegAwIBAgIRAIxiihk4fSKK6keqJYujvnkwDQYJKoZIhvcNAQELBQAw
+ITEfMB0GA1UEAwwWWXViaWNvIFBJViBBdHRlc3RhdGlvbjAgFw0xNDA4MDEwMDAw
+MDBaGA8yMDUwMDkwNDAwMDAwMFowJTEjMCEGA1UEAwwaWXViaUtleSBQSVYgQXR0
+ZXN0YXRpb24gOWEwWTATBgcqhkjOPQIBBggqhkjOPQMBBwNCAATHEzJsrhTHuvsx
+685AiWsAuT8Poe/zQfDRZNfpUSzJ31v6MZ9nz70pNrdd/sbG7O1UA6ceWhq1jHTU
+96Dnp99voycwJTARBgorBgEEAYLECgMDBAMEAwcwEAYKKwYBBAGCxAoDCAQCAgEw
+DQYJKoZIhvcNAQELBQADggEBADoswZ1LJ5GYVNgtRE0+zMQkAzam8YqeKmIDHtir
+volIpGtJHzgCG2SdJlR/KnjRWF/1i8TRMhQ0O/KgkIEh+IyhJtD7DojgWvIBsCnX
+JXF7EPQMy17l7/9940QSOnQRIDb+z0eq9ACAjC3FWzqeR5VgN4C1QpCw7gKgqLTs
+pmmDHHg4HsKl0PsPwim0bYIqEHttrLjPQiPnoa3qixzNKbwJjXb4/f/dvCTx9dRP
+0FVABj5Yh8f728xzrzw2nLZ9X/c0GoXfKu9s7lGNLcZ5OO+zys1ATei2h/PFJLDH
+Adrenw31WOYRtdjcNBKyAk80ajryjTAX3GXfbKpkdVB9hEo=
+-----END CERTIFICATE-----`
+
+	yubiKey2018Device = `-----BEGIN CERTIFICATE-----
+MIIC6TCCAdGgAwIBAgIJALvwZFDESwMlMA0GCSqGSIb3DQEBCwUAMC4xLDAqBgNV
+BAMTI1l1YmljbyBVMkYgUm9vdCBDQSBTZXJpYWwgNDU3MjAwNjMxMCAXDTE0MDgw
+MTAwMDAwMFoYDzIwNTAwOTA0MDAwMDAwWjAhMR8wHQYDVQQDDBZZdWJpY28gUElW
+IEF0dGVzdGF0aW9uMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAqXnZ
++lxX0nNzy3jn+lrZ+1cHTVUNYVKPqGTjvRw/7XOEnInWC1VCPJqwHYtnnoH4EIXN
+7kDGXwInfs9pwyjpgQw/V23yywFtUhaR8Xgw8zqC/YfJpeK4PetJ9/k+xFbICuX7
+WDv/k5Wth3VZSaVjm/tunWajtt3OLOQQaMSoLqP41XAHHuCyzfCwJ2Vsa2FyCINF
+yG6XobokeICDRnH44POqudcLVIDvZLQqu2LF+mZd+OO5nqmTa68kkwRf/m93eOJP
+o7GvYtQSp7CPJC7ks2gl8U7wuT9DQT5/0wqkoEyLZg/KLUlzgXjMa+7GtCLTC1Ku
+Oh9vw02f4K44RW4nWwIDAQABoxUwEzARBgorBgEEAYLECgMDBAMEAwcwDQYJKoZI
+hvcNAQELBQADggEBAHD/uXqNgCYywj2ee7s7kix2TT4XN9OIn0fTNh5LEiUN+q7U
+zJc9q7b5WD7PfaG6UNyuaSnLaq+dLOCJ4bX4h+/MwQSndQg0epMra1ThVQZkMkGa
+ktAJ5JT6j9qxNxD1RWMl91e4JwtGzFyDwFyyUGnSwhMsqMdwfBsmTpvgxmAD/NMs
+kWB/m91FV9D+UBqsZRoLoc44kEFYBZ09ypTsR699oJRsBfG0AqVYyK7rnG6663fF
+GUSWk7noVdUPXedlwXCqCymCsVheoss9qF1cffaFIl9RxGvVvCFybx0LGiYDxfgv
+80yGZIY/mAqZVDWyHZSs4f6kWK9GeLKU2Y9yby4=
+-----END CERTIFICATE-----`
+)
+
+func mustParseCertificate(t *testing.T, s string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		t.Fatal("error decoding PEM")
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func TestVerifyYubiKey(t *testing.T) {
+	tests := map[string]struct {
+		chain []string
+		want  *YubiKey
+		err   bool
+	}{
+		"ok": {[]string{yubiKeyAttestation, yubiKeyDevice}, &YubiKey{
+			Serial: 15732500, Firmware: "5.4.3", FormFactor: "USB-C Nano", Slot: "9a", PINPolicy: "once", TouchPolicy: "never",
+		}, false},
+		"ok 2018": {[]string{yubiKey2018Attestation, yubiKey2018Device}, &YubiKey{
+			Firmware: "4.3.7", Slot: "9a", PINPolicy: "once", TouchPolicy: "never",
+		}, false},
+		"fail mixed":   {[]string{yubiKey2018Attestation, yubiKeyDevice}, nil, true},
+		"fail mixed 2": {[]string{yubiKeyAttestation, yubiKey2018Device}, nil, true},
+		"fail order":   {[]string{yubiKeyDevice, yubiKeyAttestation}, nil, true},
+		"fail length":  {[]string{yubiKeyAttestation}, nil, true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var chain []*x509.Certificate
+			for _, s := range tc.chain {
+				chain = append(chain, mustParseCertificate(t, s))
+			}
+			got, err := VerifyYubiKey(chain, nil)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			tc.want.PublicKey = chain[0].PublicKey
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
+func TestVerifyYubiKey_roots(t *testing.T) {
+	chain := []*x509.Certificate{
+		mustParseCertificate(t, yubiKeyAttestation),
+		mustParseCertificate(t, yubiKeyDevice),
+	}
+	// The U2F root does not issue the device certificate
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(yubicoU2FRootCA))
+	_, err := VerifyYubiKey(chain, roots)
+	assert.Error(t, err)
+
+	roots.AppendCertsFromPEM([]byte(yubicoPIVRootCA))
+	_, err = VerifyYubiKey(chain, roots)
+	assert.NoError(t, err)
+}
+
+func TestParseYubiKey_fail(t *testing.T) {
+	crt := mustParseCertificate(t, yubiKeyAttestation)
+	crt.Subject.CommonName = "Yubico PIV Attestation"
+	_, err := parseYubiKey(crt)
+	assert.Error(t, err)
+
+	for _, oid := range []string{"firmware", "serial", "policy", "form factor"} {
+		crt := mustParseCertificate(t, yubiKeyAttestation)
+		for i, ext := range crt.Extensions {
+			var match bool
+			switch oid {
+			case "firmware":
+				match = ext.Id.Equal(oidYubicoFirmwareVersion)
+			case "serial":
+				match = ext.Id.Equal(oidYubicoSerialNumber)
+			case "policy":
+				match = ext.Id.Equal(oidYubicoPolicy)
+			case "form factor":
+				match = ext.Id.Equal(oidYubicoFormFactor)
+			}
+			if match {
+				crt.Extensions[i].Value = []byte{0xff, 0xff, 0xff, 0xff}
+			}
+		}
+		_, err := parseYubiKey(crt)
+		assert.Error(t, err, oid)
+	}
+}
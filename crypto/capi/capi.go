@@ -0,0 +1,375 @@
+// Package capi implements the storage of keys and certificates in the Windows
+// certificate stores. Keys are created using the Cryptography API: Next
+// Generation (CNG) and the Microsoft Software Key Storage Provider.
+//
+// Keys and certificates are identified by a friendly name using URIs like:
+//
+//	capi:friendly-name=internal.example.com
+//	capi:friendly-name=internal.example.com;store-location=machine;store=My
+//
+// The key container has the same name as the friendly name of the
+// certificate, and the certificate is linked to it, so applications like IIS
+// or other Windows services can use it.
+package capi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Scheme is the scheme of the certificate store URIs.
+const Scheme = "capi"
+
+// URI identifies a key and a certificate in a Windows certificate store.
+type URI struct {
+	// FriendlyName is the friendly name of the certificate and the name of the
+	// key container.
+	FriendlyName string
+	// StoreLocation is the location of the store, "user" or "machine".
+	StoreLocation string
+	// Store is the name of the certificate store, defaults to "My".
+	Store string
+}
+
+// IsURI returns true if the given name is a certificate store URI.
+func IsURI(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), Scheme+":")
+}
+
+// ParseURI parses the given certificate store URI.
+func ParseURI(rawuri string) (*URI, error) {
+	if !IsURI(rawuri) {
+		return nil, errors.Errorf("error parsing %s: not a capi URI", rawuri)
+	}
+
+	u := &URI{StoreLocation: "user", Store: "My"}
+	for _, attr := range strings.Split(rawuri[len(Scheme)+1:], ";") {
+		if attr == "" {
+			continue
+		}
+		i := strings.Index(attr, "=")
+		if i < 1 {
+			return nil, errors.Errorf("error parsing %s: invalid attribute '%s'", rawuri, attr)
+		}
+		value, err := url.PathUnescape(attr[i+1:])
+		if err != nil {
+			return nil, errors.Errorf("error parsing %s: invalid attribute '%s'", rawuri, attr)
+		}
+		switch strings.ToLower(attr[:i]) {
+		case "friendly-name":
+			u.FriendlyName = value
+		case "store-location":
+			switch strings.ToLower(value) {
+			case "user", "machine":
+				u.StoreLocation = strings.ToLower(value)
+			default:
+				return nil, errors.Errorf("error parsing %s: invalid store-location '%s'", rawuri, value)
+			}
+		case "store":
+			u.Store = value
+		default:
+			return nil, errors.Errorf("error parsing %s: unsupported attribute '%s'", rawuri, attr[:i])
+		}
+	}
+	switch {
+	case u.FriendlyName == "":
+		return nil, errors.Errorf("error parsing %s: friendly-name is required", rawuri)
+	case u.Store == "":
+		return nil, errors.Errorf("error parsing %s: store cannot be empty", rawuri)
+	}
+	return u, nil
+}
+
+// String returns the string representation of the URI.
+func (u *URI) String() string {
+	return Scheme + ":friendly-name=" + url.PathEscape(u.FriendlyName) +
+		";store-location=" + u.StoreLocation + ";store=" + url.PathEscape(u.Store)
+}
+
+// IsMachine returns true if the URI uses the local machine store.
+func (u *URI) IsMachine() bool {
+	return u.StoreLocation == "machine"
+}
+
+// CreateKey creates a new key with the given key type, curve and size, and
+// returns a crypto.Signer that uses it. A previous key with the same name is
+// replaced.
+func CreateKey(rawuri, kty, crv string, size int) (crypto.Signer, error) {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+	alg, bits, err := keyAlgorithm(kty, crv, size)
+	if err != nil {
+		return nil, err
+	}
+	return createKey(u, alg, bits)
+}
+
+// NewSigner returns a crypto.Signer that uses the key in the given URI.
+func NewSigner(rawuri string) (crypto.Signer, error) {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(u)
+}
+
+// ImportKey imports the given private key with the name in the given URI. A
+// previous key with the same name is replaced.
+func ImportKey(rawuri string, key crypto.PrivateKey) error {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return err
+	}
+	blobType, blob, err := marshalPrivateBlob(key)
+	if err != nil {
+		return err
+	}
+	return importKey(u, blobType, blob)
+}
+
+// ImportCertificate adds the given certificate to the store and links it to
+// the key with the same name. A previous certificate with the same friendly
+// name is archived and marked as renewed by the new one.
+func ImportCertificate(rawuri string, crt *x509.Certificate) error {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return err
+	}
+	return importCertificate(u, crt.Raw)
+}
+
+// LoadCertificate returns the certificate in the given URI. If there are
+// multiple certificates with the same friendly name, the one that expires
+// later is returned.
+func LoadCertificate(rawuri string) (*x509.Certificate, error) {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+	der, err := loadCertificate(u)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing certificate in %s", rawuri)
+	}
+	return crt, nil
+}
+
+// LoadIdentity returns the certificate and the key in the given URI as a
+// tls.Certificate.
+func LoadIdentity(rawuri string) (tls.Certificate, error) {
+	var cert tls.Certificate
+	crt, err := LoadCertificate(rawuri)
+	if err != nil {
+		return cert, err
+	}
+	signer, err := NewSigner(rawuri)
+	if err != nil {
+		return cert, err
+	}
+	if !publicKeyEqual(crt.PublicKey, signer.Public()) {
+		return cert, errors.Errorf("error loading %s: the certificate does not match the key", rawuri)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{crt.Raw},
+		PrivateKey:  signer,
+		Leaf:        crt,
+	}, nil
+}
+
+// Delete removes the certificates and the key in the given URI.
+func Delete(rawuri string) error {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return err
+	}
+	return deleteItems(u)
+}
+
+// keyAlgorithm validates the key type, curve and size and returns the CNG
+// algorithm and the size in bits of the key.
+func keyAlgorithm(kty, crv string, size int) (string, int, error) {
+	switch kty {
+	case "EC":
+		switch crv {
+		case "", "P-256":
+			return "ECDSA_P256", 256, nil
+		case "P-384":
+			return "ECDSA_P384", 384, nil
+		case "P-521":
+			return "ECDSA_P521", 521, nil
+		default:
+			return "", 0, errors.Errorf("unsupported curve '%s'", crv)
+		}
+	case "RSA":
+		if size < 2048 {
+			return "", 0, errors.Errorf("invalid RSA key size %d, the minimum size is 2048", size)
+		}
+		return "RSA", size, nil
+	default:
+		return "", 0, errors.Errorf("unsupported key type '%s'", kty)
+	}
+}
+
+// Magic numbers of the BCRYPT_ECCKEY_BLOB and BCRYPT_RSAKEY_BLOB structures.
+const (
+	ecdsaPublicP256Magic  = 0x31534345 // ECS1
+	ecdsaPrivateP256Magic = 0x32534345 // ECS2
+	ecdsaPublicP384Magic  = 0x33534345 // ECS3
+	ecdsaPrivateP384Magic = 0x34534345 // ECS4
+	ecdsaPublicP521Magic  = 0x35534345 // ECS5
+	ecdsaPrivateP521Magic = 0x36534345 // ECS6
+	rsaPublicMagic        = 0x31415352 // RSA1
+	rsaFullPrivateMagic   = 0x33415352 // RSA3
+)
+
+// parsePublicBlob parses a BCRYPT_PUBLIC_KEY_BLOB exported by CNG.
+func parsePublicBlob(b []byte) (crypto.PublicKey, error) {
+	if len(b) < 8 {
+		return nil, errors.New("error parsing public key: blob is too short")
+	}
+	le := binary.LittleEndian
+	switch magic := le.Uint32(b); magic {
+	case ecdsaPublicP256Magic, ecdsaPublicP384Magic, ecdsaPublicP521Magic:
+		var curve elliptic.Curve
+		switch magic {
+		case ecdsaPublicP256Magic:
+			curve = elliptic.P256()
+		case ecdsaPublicP384Magic:
+			curve = elliptic.P384()
+		default:
+			curve = elliptic.P521()
+		}
+		size := int(le.Uint32(b[4:]))
+		if size != (curve.Params().BitSize+7)/8 || len(b) != 8+2*size {
+			return nil, errors.New("error parsing public key: invalid EC blob")
+		}
+		x := new(big.Int).SetBytes(b[8 : 8+size])
+		y := new(big.Int).SetBytes(b[8+size:])
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("error parsing public key: invalid point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case rsaPublicMagic:
+		if len(b) < 24 {
+			return nil, errors.New("error parsing public key: invalid RSA blob")
+		}
+		expSize, modSize := int(le.Uint32(b[8:])), int(le.Uint32(b[12:]))
+		if expSize > 4 || len(b) != 24+expSize+modSize {
+			return nil, errors.New("error parsing public key: invalid RSA blob")
+		}
+		e := new(big.Int).SetBytes(b[24 : 24+expSize])
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(b[24+expSize:]),
+			E: int(e.Int64()),
+		}, nil
+	default:
+		return nil, errors.Errorf("error parsing public key: unsupported blob 0x%08x", magic)
+	}
+}
+
+// marshalPrivateBlob returns the CNG blob type and the blob of the given key.
+func marshalPrivateBlob(key crypto.PrivateKey) (string, []byte, error) {
+	le := binary.LittleEndian
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		var magic uint32
+		switch k.Curve {
+		case elliptic.P256():
+			magic = ecdsaPrivateP256Magic
+		case elliptic.P384():
+			magic = ecdsaPrivateP384Magic
+		case elliptic.P521():
+			magic = ecdsaPrivateP521Magic
+		default:
+			return "", nil, errors.Errorf("unsupported curve %s", k.Curve.Params().Name)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		b := make([]byte, 8, 8+3*size)
+		le.PutUint32(b, magic)
+		le.PutUint32(b[4:], uint32(size))
+		b = append(b, padBytes(k.X, size)...)
+		b = append(b, padBytes(k.Y, size)...)
+		b = append(b, padBytes(k.D, size)...)
+		return "ECCPRIVATEBLOB", b, nil
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return "", nil, errors.New("unsupported multi-prime RSA key")
+		}
+		k.Precompute()
+		exp := big.NewInt(int64(k.E)).Bytes()
+		modSize := (k.N.BitLen() + 7) / 8
+		primeSize := (k.Primes[0].BitLen() + 7) / 8
+		if s := (k.Primes[1].BitLen() + 7) / 8; s > primeSize {
+			primeSize = s
+		}
+		b := make([]byte, 24)
+		le.PutUint32(b, rsaFullPrivateMagic)
+		le.PutUint32(b[4:], uint32(k.N.BitLen()))
+		le.PutUint32(b[8:], uint32(len(exp)))
+		le.PutUint32(b[12:], uint32(modSize))
+		le.PutUint32(b[16:], uint32(primeSize))
+		le.PutUint32(b[20:], uint32(primeSize))
+		b = append(b, exp...)
+		b = append(b, padBytes(k.N, modSize)...)
+		b = append(b, padBytes(k.Primes[0], primeSize)...)
+		b = append(b, padBytes(k.Primes[1], primeSize)...)
+		b = append(b, padBytes(k.Precomputed.Dp, primeSize)...)
+		b = append(b, padBytes(k.Precomputed.Dq, primeSize)...)
+		b = append(b, padBytes(k.Precomputed.Qinv, primeSize)...)
+		b = append(b, padBytes(k.D, modSize)...)
+		return "RSAFULLPRIVATEBLOB", b, nil
+	default:
+		return "", nil, errors.Errorf("unsupported key type %T", key)
+	}
+}
+
+// ecdsaSignature converts the signature returned by CNG, the concatenation of
+// r and s, to its ASN.1 encoding.
+func ecdsaSignature(sig []byte) ([]byte, error) {
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, errors.New("error signing: invalid ECDSA signature")
+	}
+	n := len(sig) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:])})
+}
+
+// padBytes returns the big-endian representation of n padded to size bytes.
+func padBytes(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// publicKeyEqual returns true if both public keys are equal.
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	switch ka := a.(type) {
+	case *ecdsa.PublicKey:
+		kb, ok := b.(*ecdsa.PublicKey)
+		return ok && ka.Curve == kb.Curve && ka.X.Cmp(kb.X) == 0 && ka.Y.Cmp(kb.Y) == 0
+	case *rsa.PublicKey:
+		kb, ok := b.(*rsa.PublicKey)
+		return ok && ka.E == kb.E && ka.N.Cmp(kb.N) == 0
+	default:
+		return false
+	}
+}
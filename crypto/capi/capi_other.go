@@ -0,0 +1,35 @@
+// +build !windows
+
+package capi
+
+import (
+	"crypto"
+
+	"github.com/pkg/errors"
+)
+
+var errNotSupported = errors.New("capi is not supported: step was compiled for a platform other than Windows")
+
+func createKey(u *URI, alg string, bits int) (crypto.Signer, error) {
+	return nil, errNotSupported
+}
+
+func newSigner(u *URI) (crypto.Signer, error) {
+	return nil, errNotSupported
+}
+
+func importKey(u *URI, blobType string, blob []byte) error {
+	return errNotSupported
+}
+
+func importCertificate(u *URI, der []byte) error {
+	return errNotSupported
+}
+
+func loadCertificate(u *URI) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func deleteItems(u *URI) error {
+	return errNotSupported
+}
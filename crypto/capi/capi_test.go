@@ -0,0 +1,203 @@
+package capi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/keys"
+)
+
+func TestIsURI(t *testing.T) {
+	assert.True(t, IsURI("capi:friendly-name=foo"))
+	assert.True(t, IsURI("CAPI:friendly-name=foo"))
+	assert.False(t, IsURI("foo.key"))
+	assert.False(t, IsURI("keychain:label=foo"))
+}
+
+func TestParseURI(t *testing.T) {
+	tests := map[string]struct {
+		uri  string
+		want *URI
+		err  string
+	}{
+		"ok":               {"capi:friendly-name=internal.example.com", &URI{FriendlyName: "internal.example.com", StoreLocation: "user", Store: "My"}, ""},
+		"ok machine":       {"capi:friendly-name=My%20Cert;store-location=Machine;store=WebHosting", &URI{FriendlyName: "My Cert", StoreLocation: "machine", Store: "WebHosting"}, ""},
+		"ok empty":         {"capi:;friendly-name=foo;;", &URI{FriendlyName: "foo", StoreLocation: "user", Store: "My"}, ""},
+		"fail scheme":      {"keychain:label=foo", nil, "error parsing keychain:label=foo: not a capi URI"},
+		"fail name":        {"capi:store=My", nil, "error parsing capi:store=My: friendly-name is required"},
+		"fail store":       {"capi:friendly-name=foo;store=", nil, "error parsing capi:friendly-name=foo;store=: store cannot be empty"},
+		"fail attribute":   {"capi:friendly-name", nil, "error parsing capi:friendly-name: invalid attribute 'friendly-name'"},
+		"fail escape":      {"capi:friendly-name=%zz", nil, "error parsing capi:friendly-name=%zz: invalid attribute 'friendly-name=%zz'"},
+		"fail location":    {"capi:friendly-name=foo;store-location=system", nil, "error parsing capi:friendly-name=foo;store-location=system: invalid store-location 'system'"},
+		"fail unsupported": {"capi:friendly-name=foo;key-id=bar", nil, "error parsing capi:friendly-name=foo;key-id=bar: unsupported attribute 'key-id'"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseURI(tc.uri)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Equals(t, tc.err, err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equals(t, tc.want, got)
+				// Round trip
+				got, err = ParseURI(got.String())
+				assert.NoError(t, err)
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestKeyAlgorithm(t *testing.T) {
+	tests := map[string]struct {
+		kty, crv string
+		size     int
+		wantAlg  string
+		wantBits int
+		err      string
+	}{
+		"ok EC":         {"EC", "", 0, "ECDSA_P256", 256, ""},
+		"ok P-384":      {"EC", "P-384", 0, "ECDSA_P384", 384, ""},
+		"ok P-521":      {"EC", "P-521", 0, "ECDSA_P521", 521, ""},
+		"ok RSA":        {"RSA", "", 2048, "RSA", 2048, ""},
+		"fail curve":    {"EC", "Ed25519", 0, "", 0, "unsupported curve 'Ed25519'"},
+		"fail RSA size": {"RSA", "", 1024, "", 0, "invalid RSA key size 1024, the minimum size is 2048"},
+		"fail kty":      {"OKP", "Ed25519", 0, "", 0, "unsupported key type 'OKP'"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			alg, bits, err := keyAlgorithm(tc.kty, tc.crv, tc.size)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Equals(t, tc.err, err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equals(t, tc.wantAlg, alg)
+				assert.Equals(t, tc.wantBits, bits)
+			}
+		})
+	}
+}
+
+func TestMarshalPrivateBlob_EC(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		assert.FatalError(t, err)
+		blobType, b, err := marshalPrivateBlob(key)
+		assert.FatalError(t, err)
+		assert.Equals(t, "ECCPRIVATEBLOB", blobType)
+		size := (curve.Params().BitSize + 7) / 8
+		assert.Equals(t, 8+3*size, len(b))
+		assert.Equals(t, 0, key.D.Cmp(new(big.Int).SetBytes(b[8+2*size:])))
+
+		// The public blob uses the previous magic number
+		pub := append([]byte{}, b[:8+2*size]...)
+		binary.LittleEndian.PutUint32(pub, binary.LittleEndian.Uint32(b)-0x01000000)
+		got, err := parsePublicBlob(pub)
+		assert.FatalError(t, err)
+		assert.Equals(t, &key.PublicKey, got)
+		assert.True(t, publicKeyEqual(&key.PublicKey, got))
+	}
+}
+
+func TestMarshalPrivateBlob_RSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	blobType, b, err := marshalPrivateBlob(key)
+	assert.FatalError(t, err)
+	assert.Equals(t, "RSAFULLPRIVATEBLOB", blobType)
+	le := binary.LittleEndian
+	assert.Equals(t, uint32(rsaFullPrivateMagic), le.Uint32(b))
+	assert.Equals(t, uint32(2048), le.Uint32(b[4:]))
+	expSize, modSize, primeSize := int(le.Uint32(b[8:])), int(le.Uint32(b[12:])), int(le.Uint32(b[16:]))
+	assert.Equals(t, 24+expSize+2*modSize+5*primeSize, len(b))
+	assert.Equals(t, 0, key.D.Cmp(new(big.Int).SetBytes(b[len(b)-modSize:])))
+
+	// Public blob
+	pub := append([]byte{}, b[:24+expSize+modSize]...)
+	le.PutUint32(pub, rsaPublicMagic)
+	le.PutUint32(pub[16:], 0)
+	le.PutUint32(pub[20:], 0)
+	got, err := parsePublicBlob(pub)
+	assert.FatalError(t, err)
+	assert.Equals(t, &key.PublicKey, got)
+	assert.True(t, publicKeyEqual(&key.PublicKey, got))
+
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	assert.False(t, publicKeyEqual(&key.PublicKey, &ec.PublicKey))
+	assert.False(t, publicKeyEqual(&ec.PublicKey, &key.PublicKey))
+}
+
+func TestMarshalPrivateBlob_fail(t *testing.T) {
+	key, err := keys.GenerateKey("OKP", "Ed25519", 0)
+	assert.FatalError(t, err)
+	_, _, err = marshalPrivateBlob(key)
+	assert.Error(t, err)
+
+	multi, err := rsa.GenerateMultiPrimeKey(rand.Reader, 3, 2048)
+	assert.FatalError(t, err)
+	_, _, err = marshalPrivateBlob(multi)
+	if assert.Error(t, err) {
+		assert.Equals(t, "unsupported multi-prime RSA key", err.Error())
+	}
+}
+
+func TestParsePublicBlob_fail(t *testing.T) {
+	tests := map[string]struct {
+		blob []byte
+		err  string
+	}{
+		"short":   {[]byte{1, 2, 3}, "error parsing public key: blob is too short"},
+		"magic":   {[]byte{1, 2, 3, 4, 0, 0, 0, 0}, "error parsing public key: unsupported blob 0x04030201"},
+		"ec size": {[]byte{0x45, 0x43, 0x53, 0x31, 32, 0, 0, 0, 1}, "error parsing public key: invalid EC blob"},
+		"ec point": {append([]byte{0x45, 0x43, 0x53, 0x31, 32, 0, 0, 0}, make([]byte, 64)...),
+			"error parsing public key: invalid point"},
+		"rsa short": {[]byte{0x52, 0x53, 0x41, 0x31, 0, 8, 0, 0}, "error parsing public key: invalid RSA blob"},
+		"rsa size": {[]byte{0x52, 0x53, 0x41, 0x31, 0, 8, 0, 0, 3, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+			"error parsing public key: invalid RSA blob"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parsePublicBlob(tc.blob)
+			if assert.Error(t, err) {
+				assert.Equals(t, tc.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestECDSASignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+	digest := sha256.Sum256([]byte("message"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	assert.FatalError(t, err)
+
+	raw := append(padBytes(r, 48), padBytes(s, 48)...)
+	sig, err := ecdsaSignature(raw)
+	assert.FatalError(t, err)
+
+	var got struct {
+		R, S *big.Int
+	}
+	_, err = asn1.Unmarshal(sig, &got)
+	assert.FatalError(t, err)
+	assert.True(t, ecdsa.Verify(&key.PublicKey, digest[:], got.R, got.S))
+
+	_, err = ecdsaSignature([]byte{1, 2, 3})
+	assert.Error(t, err)
+	_, err = ecdsaSignature(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,527 @@
+package capi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"io"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	msKeyStorageProvider = "Microsoft Software Key Storage Provider"
+	ncryptLengthProperty = "Length"
+	bcryptPublicKeyBlob  = "PUBLICBLOB"
+
+	encodingX509ASNPKCS7 = windows.X509_ASN_ENCODING | windows.PKCS_7_ASN_ENCODING
+
+	certStoreProvSystem         = 10
+	certSystemStoreCurrentUser  = 1 << 16
+	certSystemStoreLocalMachine = 2 << 16
+	certStoreAddReplaceExisting = 3
+	certKeyProvInfoPropID       = 2
+	certFriendlyNamePropID      = 11
+	certArchivedPropID          = 19
+	certRenewalPropID           = 64
+	cryptMachineKeyset          = 0x20
+	ncryptMachineKeyFlag        = 0x20
+	ncryptOverwriteKeyFlag      = 0x80
+	ncryptDoNotFinalizeFlag     = 0x400
+	ncryptBufferPKCSKeyName     = 45
+	bcryptPadPKCS1              = 0x2
+	bcryptPadPSS                = 0x8
+	nteBadKeyset                = 0x80090016
+	cryptENotFound              = 0x80092004
+)
+
+var (
+	crypt32 = windows.NewLazySystemDLL("crypt32.dll")
+	ncrypt  = windows.NewLazySystemDLL("ncrypt.dll")
+
+	procCertDeleteCertificateFromStore    = crypt32.NewProc("CertDeleteCertificateFromStore")
+	procCertDuplicateCertificateContext   = crypt32.NewProc("CertDuplicateCertificateContext")
+	procCertGetCertificateContextProperty = crypt32.NewProc("CertGetCertificateContextProperty")
+	procCertSetCertificateContextProperty = crypt32.NewProc("CertSetCertificateContextProperty")
+
+	procNCryptOpenStorageProvider = ncrypt.NewProc("NCryptOpenStorageProvider")
+	procNCryptCreatePersistedKey  = ncrypt.NewProc("NCryptCreatePersistedKey")
+	procNCryptOpenKey             = ncrypt.NewProc("NCryptOpenKey")
+	procNCryptSetProperty         = ncrypt.NewProc("NCryptSetProperty")
+	procNCryptFinalizeKey         = ncrypt.NewProc("NCryptFinalizeKey")
+	procNCryptImportKey           = ncrypt.NewProc("NCryptImportKey")
+	procNCryptExportKey           = ncrypt.NewProc("NCryptExportKey")
+	procNCryptSignHash            = ncrypt.NewProc("NCryptSignHash")
+	procNCryptDeleteKey           = ncrypt.NewProc("NCryptDeleteKey")
+	procNCryptFreeObject          = ncrypt.NewProc("NCryptFreeObject")
+)
+
+// cryptKeyProvInfo is the CRYPT_KEY_PROV_INFO structure.
+type cryptKeyProvInfo struct {
+	ContainerName  *uint16
+	ProvName       *uint16
+	ProvType       uint32
+	Flags          uint32
+	ProvParamCount uint32
+	ProvParam      uintptr
+	KeySpec        uint32
+}
+
+// cryptDataBlob is the CRYPT_DATA_BLOB structure.
+type cryptDataBlob struct {
+	Size uint32
+	Data *byte
+}
+
+// ncryptBuffer is the NCryptBuffer structure.
+type ncryptBuffer struct {
+	Size uint32
+	Type uint32
+	Data uintptr
+}
+
+// ncryptBufferDesc is the NCryptBufferDesc structure.
+type ncryptBufferDesc struct {
+	Version uint32
+	Count   uint32
+	Buffers *ncryptBuffer
+}
+
+// bcryptPKCS1PaddingInfo is the BCRYPT_PKCS1_PADDING_INFO structure.
+type bcryptPKCS1PaddingInfo struct {
+	AlgID *uint16
+}
+
+// bcryptPSSPaddingInfo is the BCRYPT_PSS_PADDING_INFO structure.
+type bcryptPSSPaddingInfo struct {
+	AlgID *uint16
+	Salt  uint32
+}
+
+// ncryptCall calls a CNG function, they return a SECURITY_STATUS instead of
+// setting the last error.
+func ncryptCall(proc *windows.LazyProc, args ...uintptr) error {
+	if r, _, _ := proc.Call(args...); r != 0 {
+		return errors.Wrapf(syscall.Errno(r), "%s failed", proc.Name)
+	}
+	return nil
+}
+
+// crypt32Call calls a crypt32 function that returns a BOOL.
+func crypt32Call(proc *windows.LazyProc, args ...uintptr) error {
+	if r, _, err := proc.Call(args...); r == 0 {
+		return errors.Wrapf(err, "%s failed", proc.Name)
+	}
+	return nil
+}
+
+func utf16Ptr(s string) *uint16 {
+	p, err := windows.UTF16PtrFromString(s)
+	if err != nil {
+		// Strings with NUL characters are not valid names.
+		p, _ = windows.UTF16PtrFromString("")
+	}
+	return p
+}
+
+func keyFlags(u *URI) uintptr {
+	if u.IsMachine() {
+		return ncryptMachineKeyFlag
+	}
+	return 0
+}
+
+func openProvider() (uintptr, error) {
+	var prov uintptr
+	if err := ncryptCall(procNCryptOpenStorageProvider, uintptr(unsafe.Pointer(&prov)), uintptr(unsafe.Pointer(utf16Ptr(msKeyStorageProvider))), 0); err != nil {
+		return 0, errors.Wrap(err, "error opening key storage provider")
+	}
+	return prov, nil
+}
+
+func freeObject(h uintptr) {
+	procNCryptFreeObject.Call(h)
+}
+
+func createKey(u *URI, alg string, bits int) (crypto.Signer, error) {
+	prov, err := openProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer freeObject(prov)
+
+	var key uintptr
+	if err := ncryptCall(procNCryptCreatePersistedKey, prov, uintptr(unsafe.Pointer(&key)),
+		uintptr(unsafe.Pointer(utf16Ptr(alg))), uintptr(unsafe.Pointer(utf16Ptr(u.FriendlyName))),
+		0, keyFlags(u)|ncryptOverwriteKeyFlag); err != nil {
+		return nil, errors.Wrap(err, "error creating key")
+	}
+	if alg == "RSA" {
+		length := uint32(bits)
+		if err := ncryptCall(procNCryptSetProperty, key, uintptr(unsafe.Pointer(utf16Ptr(ncryptLengthProperty))),
+			uintptr(unsafe.Pointer(&length)), unsafe.Sizeof(length), 0); err != nil {
+			freeObject(key)
+			return nil, errors.Wrap(err, "error creating key")
+		}
+	}
+	if err := ncryptCall(procNCryptFinalizeKey, key, 0); err != nil {
+		freeObject(key)
+		return nil, errors.Wrap(err, "error creating key")
+	}
+	return newKeySigner(key)
+}
+
+func newSigner(u *URI) (crypto.Signer, error) {
+	prov, err := openProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer freeObject(prov)
+
+	var key uintptr
+	if err := ncryptCall(procNCryptOpenKey, prov, uintptr(unsafe.Pointer(&key)),
+		uintptr(unsafe.Pointer(utf16Ptr(u.FriendlyName))), 0, keyFlags(u)); err != nil {
+		return nil, errors.Wrapf(err, "error opening key %s", u.FriendlyName)
+	}
+	return newKeySigner(key)
+}
+
+func importKey(u *URI, blobType string, blob []byte) error {
+	prov, err := openProvider()
+	if err != nil {
+		return err
+	}
+	defer freeObject(prov)
+
+	// The key name is passed as a parameter to persist the key.
+	name, err := windows.UTF16FromString(u.FriendlyName)
+	if err != nil {
+		return errors.Wrapf(err, "error importing key %s", u.FriendlyName)
+	}
+	buffer := ncryptBuffer{
+		Size: uint32(len(name) * 2),
+		Type: ncryptBufferPKCSKeyName,
+		Data: uintptr(unsafe.Pointer(&name[0])),
+	}
+	params := ncryptBufferDesc{Count: 1, Buffers: &buffer}
+
+	var key uintptr
+	if err := ncryptCall(procNCryptImportKey, prov, 0, uintptr(unsafe.Pointer(utf16Ptr(blobType))),
+		uintptr(unsafe.Pointer(&params)), uintptr(unsafe.Pointer(&key)),
+		uintptr(unsafe.Pointer(&blob[0])), uintptr(len(blob)),
+		keyFlags(u)|ncryptOverwriteKeyFlag|ncryptDoNotFinalizeFlag); err != nil {
+		return errors.Wrapf(err, "error importing key %s", u.FriendlyName)
+	}
+	defer freeObject(key)
+	runtime.KeepAlive(name)
+
+	if err := ncryptCall(procNCryptFinalizeKey, key, 0); err != nil {
+		return errors.Wrapf(err, "error importing key %s", u.FriendlyName)
+	}
+	return nil
+}
+
+func openStore(u *URI) (windows.Handle, error) {
+	flags := uint32(certSystemStoreCurrentUser)
+	if u.IsMachine() {
+		flags = certSystemStoreLocalMachine
+	}
+	store, err := windows.CertOpenStore(certStoreProvSystem, 0, 0, flags, uintptr(unsafe.Pointer(utf16Ptr(u.Store))))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error opening certificate store %s", u.Store)
+	}
+	return store, nil
+}
+
+// findCertificates returns a copy of the certificates in the store with the
+// friendly name in the URI. The certificates must be freed with
+// windows.CertFreeCertificateContext.
+func findCertificates(store windows.Handle, u *URI) ([]*windows.CertContext, error) {
+	var certs []*windows.CertContext
+	var prev *windows.CertContext
+	for {
+		ctx, err := windows.CertEnumCertificatesInStore(store, prev)
+		if err != nil {
+			if errno, ok := err.(syscall.Errno); ok && errno == cryptENotFound {
+				return certs, nil
+			}
+			for _, c := range certs {
+				windows.CertFreeCertificateContext(c)
+			}
+			return nil, errors.Wrap(err, "error enumerating certificates")
+		}
+		if friendlyName(ctx) == u.FriendlyName {
+			dup, _, _ := procCertDuplicateCertificateContext.Call(uintptr(unsafe.Pointer(ctx)))
+			certs = append(certs, *(**windows.CertContext)(unsafe.Pointer(&dup)))
+		}
+		prev = ctx
+	}
+}
+
+// friendlyName returns the friendly name of the given certificate.
+func friendlyName(ctx *windows.CertContext) string {
+	var size uint32
+	if crypt32Call(procCertGetCertificateContextProperty, uintptr(unsafe.Pointer(ctx)), certFriendlyNamePropID, 0, uintptr(unsafe.Pointer(&size))) != nil || size < 2 {
+		return ""
+	}
+	buf := make([]uint16, size/2)
+	if crypt32Call(procCertGetCertificateContextProperty, uintptr(unsafe.Pointer(ctx)), certFriendlyNamePropID, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size))) != nil {
+		return ""
+	}
+	return windows.UTF16ToString(buf)
+}
+
+// certificateBytes returns a copy of the DER encoding of the given
+// certificate.
+func certificateBytes(ctx *windows.CertContext) []byte {
+	src := (*[1 << 20]byte)(unsafe.Pointer(ctx.EncodedCert))[:ctx.Length:ctx.Length]
+	der := make([]byte, len(src))
+	copy(der, src)
+	return der
+}
+
+// latestCertificate returns the certificate that expires later.
+func latestCertificate(certs []*windows.CertContext) (*windows.CertContext, *x509.Certificate) {
+	var latest *windows.CertContext
+	var latestCrt *x509.Certificate
+	for _, ctx := range certs {
+		crt, err := x509.ParseCertificate(certificateBytes(ctx))
+		if err != nil {
+			continue
+		}
+		if latestCrt == nil || crt.NotAfter.After(latestCrt.NotAfter) {
+			latest, latestCrt = ctx, crt
+		}
+	}
+	return latest, latestCrt
+}
+
+func setProperty(ctx *windows.CertContext, id uint32, data unsafe.Pointer) error {
+	return crypt32Call(procCertSetCertificateContextProperty, uintptr(unsafe.Pointer(ctx)), uintptr(id), 0, uintptr(data))
+}
+
+func importCertificate(u *URI, der []byte) error {
+	store, err := openStore(u)
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	previous, err := findCertificates(store, u)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, c := range previous {
+			windows.CertFreeCertificateContext(c)
+		}
+	}()
+
+	ctx, err := windows.CertCreateCertificateContext(encodingX509ASNPKCS7, &der[0], uint32(len(der)))
+	if err != nil {
+		return errors.Wrap(err, "error importing certificate")
+	}
+	defer windows.CertFreeCertificateContext(ctx)
+
+	var stored *windows.CertContext
+	if err := windows.CertAddCertificateContextToStore(store, ctx, certStoreAddReplaceExisting, &stored); err != nil {
+		return errors.Wrap(err, "error importing certificate")
+	}
+	defer windows.CertFreeCertificateContext(stored)
+
+	name, err := windows.UTF16FromString(u.FriendlyName)
+	if err != nil {
+		return errors.Wrap(err, "error importing certificate")
+	}
+	nameBlob := cryptDataBlob{Size: uint32(len(name) * 2), Data: (*byte)(unsafe.Pointer(&name[0]))}
+	if err := setProperty(stored, certFriendlyNamePropID, unsafe.Pointer(&nameBlob)); err != nil {
+		return errors.Wrap(err, "error setting certificate friendly name")
+	}
+
+	// Link the certificate to the key with the same name.
+	provInfo := cryptKeyProvInfo{
+		ContainerName: &name[0],
+		ProvName:      utf16Ptr(msKeyStorageProvider),
+	}
+	if u.IsMachine() {
+		provInfo.Flags = cryptMachineKeyset
+	}
+	if err := setProperty(stored, certKeyProvInfoPropID, unsafe.Pointer(&provInfo)); err != nil {
+		return errors.Wrap(err, "error linking certificate to key")
+	}
+
+	// Archive the previous certificates and mark them as renewed, so
+	// applications watching them can find the new one.
+	hash := sha1.Sum(der)
+	hashBlob := cryptDataBlob{Size: uint32(len(hash)), Data: &hash[0]}
+	for _, c := range previous {
+		if h := sha1.Sum(certificateBytes(c)); h == hash {
+			continue
+		}
+		if err := setProperty(c, certRenewalPropID, unsafe.Pointer(&hashBlob)); err != nil {
+			return errors.Wrap(err, "error setting certificate renewal")
+		}
+		if err := setProperty(c, certArchivedPropID, unsafe.Pointer(&cryptDataBlob{})); err != nil {
+			return errors.Wrap(err, "error archiving certificate")
+		}
+	}
+	runtime.KeepAlive(name)
+	return nil
+}
+
+func loadCertificate(u *URI) ([]byte, error) {
+	store, err := openStore(u)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	certs, err := findCertificates(store, u)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, c := range certs {
+			windows.CertFreeCertificateContext(c)
+		}
+	}()
+
+	_, crt := latestCertificate(certs)
+	if crt == nil {
+		return nil, errors.Errorf("certificate with friendly name %s not found in %s", u.FriendlyName, u.Store)
+	}
+	return crt.Raw, nil
+}
+
+func deleteItems(u *URI) error {
+	store, err := openStore(u)
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	certs, err := findCertificates(store, u)
+	if err != nil {
+		return err
+	}
+	// CertDeleteCertificateFromStore always frees the context.
+	for i, c := range certs {
+		if err := crypt32Call(procCertDeleteCertificateFromStore, uintptr(unsafe.Pointer(c))); err != nil {
+			for _, c := range certs[i+1:] {
+				windows.CertFreeCertificateContext(c)
+			}
+			return errors.Wrap(err, "error deleting certificate")
+		}
+	}
+
+	prov, err := openProvider()
+	if err != nil {
+		return err
+	}
+	defer freeObject(prov)
+
+	var key uintptr
+	if r, _, _ := procNCryptOpenKey.Call(prov, uintptr(unsafe.Pointer(&key)),
+		uintptr(unsafe.Pointer(utf16Ptr(u.FriendlyName))), 0, keyFlags(u)); r != 0 {
+		if r == nteBadKeyset {
+			return nil
+		}
+		return errors.Wrapf(syscall.Errno(r), "error opening key %s", u.FriendlyName)
+	}
+	// NCryptDeleteKey frees the handle on success.
+	if err := ncryptCall(procNCryptDeleteKey, key, 0); err != nil {
+		freeObject(key)
+		return errors.Wrapf(err, "error deleting key %s", u.FriendlyName)
+	}
+	return nil
+}
+
+// keySigner implements a crypto.Signer using a CNG key.
+type keySigner struct {
+	key uintptr
+	pub crypto.PublicKey
+}
+
+func newKeySigner(key uintptr) (*keySigner, error) {
+	var size uint32
+	blobType := uintptr(unsafe.Pointer(utf16Ptr(bcryptPublicKeyBlob)))
+	if err := ncryptCall(procNCryptExportKey, key, 0, blobType, 0, 0, 0, uintptr(unsafe.Pointer(&size)), 0); err != nil {
+		freeObject(key)
+		return nil, errors.Wrap(err, "error exporting public key")
+	}
+	blob := make([]byte, size)
+	if err := ncryptCall(procNCryptExportKey, key, 0, blobType, 0, uintptr(unsafe.Pointer(&blob[0])), uintptr(size), uintptr(unsafe.Pointer(&size)), 0); err != nil {
+		freeObject(key)
+		return nil, errors.Wrap(err, "error exporting public key")
+	}
+	pub, err := parsePublicBlob(blob[:size])
+	if err != nil {
+		freeObject(key)
+		return nil, err
+	}
+
+	s := &keySigner{key: key, pub: pub}
+	runtime.SetFinalizer(s, func(s *keySigner) {
+		freeObject(s.key)
+	})
+	return s, nil
+}
+
+// Public returns the public key of the signer.
+func (s *keySigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs the given digest. ECDSA signatures are ASN.1 encoded.
+func (s *keySigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var padding unsafe.Pointer
+	var flags uintptr
+	if _, ok := s.pub.(*rsa.PublicKey); ok {
+		h := opts.HashFunc()
+		var alg string
+		switch h {
+		case crypto.SHA256:
+			alg = "SHA256"
+		case crypto.SHA384:
+			alg = "SHA384"
+		case crypto.SHA512:
+			alg = "SHA512"
+		default:
+			return nil, errors.Errorf("unsupported hash function %v", h)
+		}
+		if o, ok := opts.(*rsa.PSSOptions); ok {
+			salt := o.SaltLength
+			if salt == rsa.PSSSaltLengthAuto || salt == rsa.PSSSaltLengthEqualsHash {
+				salt = h.Size()
+			}
+			padding = unsafe.Pointer(&bcryptPSSPaddingInfo{AlgID: utf16Ptr(alg), Salt: uint32(salt)})
+			flags = bcryptPadPSS
+		} else {
+			padding = unsafe.Pointer(&bcryptPKCS1PaddingInfo{AlgID: utf16Ptr(alg)})
+			flags = bcryptPadPKCS1
+		}
+	}
+
+	var size uint32
+	if err := ncryptCall(procNCryptSignHash, s.key, uintptr(padding), uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)),
+		0, 0, uintptr(unsafe.Pointer(&size)), flags); err != nil {
+		return nil, errors.Wrap(err, "error signing")
+	}
+	sig := make([]byte, size)
+	if err := ncryptCall(procNCryptSignHash, s.key, uintptr(padding), uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)),
+		uintptr(unsafe.Pointer(&sig[0])), uintptr(size), uintptr(unsafe.Pointer(&size)), flags); err != nil {
+		return nil, errors.Wrap(err, "error signing")
+	}
+	runtime.KeepAlive(s)
+
+	if _, ok := s.pub.(*ecdsa.PublicKey); ok {
+		return ecdsaSignature(sig[:size])
+	}
+	return sig[:size], nil
+}
@@ -0,0 +1,356 @@
+// Package cms implements a subset of the Cryptographic Message Syntax (CMS)
+// defined in RFC 5652.
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSignatureRSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+)
+
+var digestAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, crypto.SHA1},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 4}, crypto.SHA224},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512},
+}
+
+// DigestAlgorithm returns the hash function identified by the given
+// algorithm identifier.
+func DigestAlgorithm(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for _, d := range digestAlgorithms {
+		if d.oid.Equal(oid) {
+			return d.hash, nil
+		}
+	}
+	return 0, errors.Errorf("unsupported digest algorithm %s", oid)
+}
+
+// DigestAlgorithmIdentifier returns the algorithm identifier of the given hash
+// function.
+func DigestAlgorithmIdentifier(h crypto.Hash) (pkix.AlgorithmIdentifier, error) {
+	for _, d := range digestAlgorithms {
+		if d.hash == h {
+			return pkix.AlgorithmIdentifier{
+				Algorithm:  d.oid,
+				Parameters: asn1.NullRawValue,
+			}, nil
+		}
+	}
+	return pkix.AlgorithmIdentifier{}, errors.Errorf("unsupported hash function %s", h)
+}
+
+// contentInfo reflects an ASN.1 CMS ContentInfo. See RFC 5652, section 3.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// encapsulatedContentInfo reflects an ASN.1 CMS EncapsulatedContentInfo. See
+// RFC 5652, section 5.2.
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+// signedData reflects an ASN.1 CMS SignedData. See RFC 5652, section 5.1.
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// signerInfo reflects an ASN.1 CMS SignerInfo. See RFC 5652, section 5.3.
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// SignedData is a CMS SignedData structure.
+type SignedData struct {
+	// ContentType is the type of the encapsulated content.
+	ContentType asn1.ObjectIdentifier
+	// Content is the encapsulated content, it is nil if the signature is
+	// detached.
+	Content []byte
+	// Certificates are the certificates included in the SignedData.
+	Certificates []*x509.Certificate
+	signerInfos  []signerInfo
+}
+
+// ParseSignedData parses a DER-encoded ContentInfo with a SignedData.
+func ParseSignedData(der []byte) (*SignedData, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, errors.Wrap(err, "error parsing CMS content info")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error parsing CMS content info: trailing data")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.Errorf("error parsing CMS: unsupported content type %s", ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, errors.Wrap(err, "error parsing CMS signed data")
+	}
+
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		var err error
+		if certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, errors.Wrap(err, "error parsing CMS certificates")
+		}
+	}
+
+	return &SignedData{
+		ContentType:  sd.EncapContentInfo.EContentType,
+		Content:      sd.EncapContentInfo.EContent,
+		Certificates: certs,
+		signerInfos:  sd.SignerInfos,
+	}, nil
+}
+
+// Verify verifies the signatures of the SignedData and returns the
+// certificates of the signers. The content is used for detached signatures,
+// if it is nil the encapsulated content will be verified. If opts is not nil,
+// the certificate chain of each signer is also verified; the certificates in
+// the SignedData are used as intermediates if opts.Intermediates is not set.
+func (s *SignedData) Verify(content []byte, opts *x509.VerifyOptions) ([]*x509.Certificate, error) {
+	if content == nil {
+		if s.Content == nil {
+			return nil, errors.New("error verifying CMS: content is detached")
+		}
+		content = s.Content
+	}
+	if len(s.signerInfos) == 0 {
+		return nil, errors.New("error verifying CMS: there are no signers")
+	}
+
+	if opts != nil && opts.Intermediates == nil {
+		o := *opts
+		o.Intermediates = x509.NewCertPool()
+		for _, crt := range s.Certificates {
+			o.Intermediates.AddCert(crt)
+		}
+		opts = &o
+	}
+
+	var signers []*x509.Certificate
+	for i := range s.signerInfos {
+		si := &s.signerInfos[i]
+		crt, err := s.findCertificate(si.SID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.verifySignature(si, crt, content); err != nil {
+			return nil, err
+		}
+		if opts != nil {
+			if _, err := crt.Verify(*opts); err != nil {
+				return nil, errors.Wrap(err, "error verifying CMS signer certificate")
+			}
+		}
+		signers = append(signers, crt)
+	}
+	return signers, nil
+}
+
+// SignedAttribute parses into v the value of the signed attribute of the first
+// signer with the given type, it returns false if the signer does not have
+// the attribute. The value must only be trusted after verifying the
+// SignedData.
+func (s *SignedData) SignedAttribute(oid asn1.ObjectIdentifier, v interface{}) (bool, error) {
+	if len(s.signerInfos) == 0 {
+		return false, nil
+	}
+	for rest := s.signerInfos[0].SignedAttrs.Bytes; len(rest) > 0; {
+		var attr attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return false, errors.Wrap(err, "error parsing CMS signed attributes")
+		}
+		if attr.Type.Equal(oid) {
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, v); err != nil {
+				return false, errors.Wrapf(err, "error parsing CMS signed attribute %s", oid)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findCertificate returns the certificate identified by the given
+// SignerIdentifier.
+func (s *SignedData) findCertificate(sid asn1.RawValue) (*x509.Certificate, error) {
+	// subjectKeyIdentifier [0] IMPLICIT SubjectKeyIdentifier
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, crt := range s.Certificates {
+			if bytes.Equal(crt.SubjectKeyId, sid.Bytes) {
+				return crt, nil
+			}
+		}
+		return nil, errors.New("error verifying CMS: signer certificate not found")
+	}
+
+	var ias issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, errors.Wrap(err, "error parsing CMS signer identifier")
+	}
+	for _, crt := range s.Certificates {
+		if crt.SerialNumber.Cmp(ias.SerialNumber) == 0 && bytes.Equal(crt.RawIssuer, ias.Issuer.FullBytes) {
+			return crt, nil
+		}
+	}
+	return nil, errors.New("error verifying CMS: signer certificate not found")
+}
+
+func (s *SignedData) verifySignature(si *signerInfo, crt *x509.Certificate, content []byte) error {
+	h, err := DigestAlgorithm(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	// Without signed attributes the signature is over the content.
+	signed := content
+	if len(si.SignedAttrs.Bytes) > 0 {
+		var contentType asn1.ObjectIdentifier
+		var digest []byte
+		for rest := si.SignedAttrs.Bytes; len(rest) > 0; {
+			var attr attribute
+			if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+				return errors.Wrap(err, "error parsing CMS signed attributes")
+			}
+			switch {
+			case attr.Type.Equal(oidAttributeContentType):
+				_, err = asn1.Unmarshal(attr.Values.Bytes, &contentType)
+			case attr.Type.Equal(oidAttributeMessageDigest):
+				_, err = asn1.Unmarshal(attr.Values.Bytes, &digest)
+			}
+			if err != nil {
+				return errors.Wrap(err, "error parsing CMS signed attributes")
+			}
+		}
+		if !contentType.Equal(s.ContentType) {
+			return errors.New("error verifying CMS: content type attribute does not match")
+		}
+		hh := h.New()
+		hh.Write(content)
+		if !bytes.Equal(digest, hh.Sum(nil)) {
+			return errors.New("error verifying CMS: message digest does not match")
+		}
+		// The signature is over the DER encoding of the SET OF attributes.
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	}
+
+	// Ed25519 keys are parsed from the certificate, as crypto/x509 might not
+	// support them.
+	if si.SignatureAlgorithm.Algorithm.Equal(oidSignatureEd25519) {
+		pub, err := pemutil.ParsePKIXPublicKey(crt.RawSubjectPublicKeyInfo)
+		if err != nil {
+			return errors.Wrap(err, "error parsing certificate public key")
+		}
+		edPub, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return errors.Errorf("error verifying CMS: unexpected public key type %T", pub)
+		}
+		if !ed25519.Verify(edPub, signed, si.Signature) {
+			return errors.New("error verifying CMS signature: ed25519 verification failure")
+		}
+		return nil
+	}
+
+	algo, err := signatureAlgorithm(crt.PublicKey, h, si.SignatureAlgorithm.Algorithm.Equal(oidSignatureRSAPSS))
+	if err != nil {
+		return err
+	}
+	if err := crt.CheckSignature(algo, signed, si.Signature); err != nil {
+		return errors.Wrap(err, "error verifying CMS signature")
+	}
+	return nil
+}
+
+// signatureAlgorithm returns the x509.SignatureAlgorithm for the given public
+// key and hash function.
+func signatureAlgorithm(pub crypto.PublicKey, h crypto.Hash, pss bool) (x509.SignatureAlgorithm, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		if pss {
+			switch h {
+			case crypto.SHA256:
+				return x509.SHA256WithRSAPSS, nil
+			case crypto.SHA384:
+				return x509.SHA384WithRSAPSS, nil
+			case crypto.SHA512:
+				return x509.SHA512WithRSAPSS, nil
+			}
+			break
+		}
+		switch h {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case *ecdsa.PublicKey:
+		switch h {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	default:
+		return x509.UnknownSignatureAlgorithm, errors.Errorf("unsupported public key type %T", pub)
+	}
+	return x509.UnknownSignatureAlgorithm, errors.Errorf("unsupported signature algorithm with %s", h)
+}
@@ -0,0 +1,340 @@
+package cms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestParseSignedData(t *testing.T) {
+	tst, err := ioutil.ReadFile("../timestamp/testdata/data.tst")
+	assert.FatalError(t, err)
+	p7b, err := ioutil.ReadFile("../pemutil/testdata/bundle.p7b")
+	assert.FatalError(t, err)
+
+	sd, err := ParseSignedData(tst)
+	assert.FatalError(t, err)
+	assert.Len(t, 2, sd.Certificates)
+	assert.NotNil(t, sd.Content)
+
+	signers, err := sd.Verify(nil, nil)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, signers)
+	assert.Equals(t, "Timestamp Authority", signers[0].Subject.CommonName)
+
+	_, err = sd.Verify([]byte("foo"), nil)
+	assert.Error(t, err)
+
+	// certs-only SignedData without signers
+	sd, err = ParseSignedData(p7b)
+	assert.FatalError(t, err)
+	_, err = sd.Verify(nil, nil)
+	assert.Error(t, err)
+
+	_, err = ParseSignedData(append(tst, 0))
+	assert.Error(t, err)
+	_, err = ParseSignedData([]byte{})
+	assert.Error(t, err)
+}
+
+func TestDigestAlgorithm(t *testing.T) {
+	for _, h := range []crypto.Hash{crypto.SHA1, crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		alg, err := DigestAlgorithmIdentifier(h)
+		assert.FatalError(t, err)
+		got, err := DigestAlgorithm(alg.Algorithm)
+		assert.FatalError(t, err)
+		assert.Equals(t, h, got)
+	}
+	_, err := DigestAlgorithmIdentifier(crypto.MD5)
+	assert.Error(t, err)
+}
+
+func generateCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.FatalError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	var der []byte
+	if edKey, ok := key.(ed25519.PrivateKey); ok {
+		der = createEd25519Certificate(t, tmpl, edKey)
+	} else {
+		der, err = x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+		assert.FatalError(t, err)
+	}
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt
+}
+
+// createEd25519Certificate creates a self-signed certificate with an Ed25519
+// key. It does not use x509.CreateCertificate, as crypto/x509 might not
+// support Ed25519 keys.
+func createEd25519Certificate(t *testing.T, tmpl *x509.Certificate, key ed25519.PrivateKey) []byte {
+	t.Helper()
+	sigAlg := pkix.AlgorithmIdentifier{Algorithm: oidSignatureEd25519}
+	name, err := asn1.Marshal(tmpl.Subject.ToRDNSequence())
+	assert.FatalError(t, err)
+	pub, err := pemutil.MarshalPKIXPublicKey(key.Public())
+	assert.FatalError(t, err)
+	tbs, err := asn1.Marshal(struct {
+		Version   int `asn1:"explicit,tag:0"`
+		Serial    *big.Int
+		SigAlg    pkix.AlgorithmIdentifier
+		Issuer    asn1.RawValue
+		Validity  struct{ NotBefore, NotAfter time.Time }
+		Subject   asn1.RawValue
+		PublicKey asn1.RawValue
+	}{
+		Version:   2,
+		Serial:    tmpl.SerialNumber,
+		SigAlg:    sigAlg,
+		Issuer:    asn1.RawValue{FullBytes: name},
+		Validity:  struct{ NotBefore, NotAfter time.Time }{tmpl.NotBefore.UTC(), tmpl.NotAfter.UTC()},
+		Subject:   asn1.RawValue{FullBytes: name},
+		PublicKey: asn1.RawValue{FullBytes: pub},
+	})
+	assert.FatalError(t, err)
+	der, err := asn1.Marshal(struct {
+		TBS       asn1.RawValue
+		SigAlg    pkix.AlgorithmIdentifier
+		Signature asn1.BitString
+	}{
+		TBS:       asn1.RawValue{FullBytes: tbs},
+		SigAlg:    sigAlg,
+		Signature: asn1.BitString{Bytes: ed25519.Sign(key, tbs), BitLength: 8 * ed25519.SignatureSize},
+	})
+	assert.FatalError(t, err)
+	return der
+}
+
+func TestSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	content := []byte("the content")
+	for _, key := range []crypto.Signer{rsaKey, p256Key, p384Key, edKey} {
+		crt := generateCertificate(t, key)
+		roots := x509.NewCertPool()
+		roots.AddCert(crt)
+		opts := &x509.VerifyOptions{Roots: roots}
+
+		// Attached
+		der, err := Sign(content, []*x509.Certificate{crt}, key, nil)
+		assert.FatalError(t, err)
+		sd, err := ParseSignedData(der)
+		assert.FatalError(t, err)
+		assert.Equals(t, content, sd.Content)
+		assert.True(t, sd.ContentType.Equal(oidData))
+		signers, err := sd.Verify(nil, opts)
+		assert.FatalError(t, err)
+		assert.Equals(t, []*x509.Certificate{crt}, signers)
+		_, err = sd.Verify([]byte("other content"), nil)
+		assert.Error(t, err)
+
+		// Detached
+		der, err = Sign(content, []*x509.Certificate{crt}, key, &SignOptions{Detached: true})
+		assert.FatalError(t, err)
+		sd, err = ParseSignedData(der)
+		assert.FatalError(t, err)
+		assert.Nil(t, sd.Content)
+		_, err = sd.Verify(nil, nil)
+		assert.Error(t, err)
+		signers, err = sd.Verify(content, opts)
+		assert.FatalError(t, err)
+		assert.Equals(t, []*x509.Certificate{crt}, signers)
+		_, err = sd.Verify([]byte("other content"), nil)
+		assert.Error(t, err)
+	}
+
+	// Key does not match the certificate
+	crt := generateCertificate(t, p256Key)
+	_, err = Sign(content, []*x509.Certificate{crt}, p384Key, nil)
+	assert.Error(t, err)
+	_, err = Sign(content, nil, p256Key, nil)
+	assert.Error(t, err)
+}
+
+func TestSign_options(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	crt := generateCertificate(t, key)
+	oid := asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+
+	der, err := Sign([]byte("the content"), []*x509.Certificate{crt}, key, &SignOptions{
+		Hash:       crypto.SHA1,
+		Attributes: []Attribute{{oid, "the-transaction-id"}},
+	})
+	assert.FatalError(t, err)
+	sd, err := ParseSignedData(der)
+	assert.FatalError(t, err)
+	signers, err := sd.Verify(nil, nil)
+	assert.FatalError(t, err)
+	assert.Equals(t, []*x509.Certificate{crt}, signers)
+	h, err := DigestAlgorithm(sd.signerInfos[0].DigestAlgorithm.Algorithm)
+	assert.FatalError(t, err)
+	assert.Equals(t, crypto.SHA1, h)
+
+	var s string
+	ok, err := sd.SignedAttribute(oid, &s)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	assert.Equals(t, "the-transaction-id", s)
+
+	ok, err = sd.SignedAttribute(asn1.ObjectIdentifier{1, 2, 3, 4}, &s)
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+	_, err = sd.SignedAttribute(oid, new([]int))
+	assert.Error(t, err)
+}
+
+func TestSignedData_Verify_openssl(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/data.txt")
+	assert.FatalError(t, err)
+
+	for _, name := range []string{"ec", "rsa"} {
+		crt, err := pemutil.ReadCertificate("testdata/" + name + ".crt")
+		assert.FatalError(t, err)
+		roots := x509.NewCertPool()
+		roots.AddCert(crt)
+
+		der, err := ioutil.ReadFile("testdata/" + name + ".p7s")
+		assert.FatalError(t, err)
+		sd, err := ParseSignedData(der)
+		assert.FatalError(t, err)
+
+		var signers []*x509.Certificate
+		if name == "ec" {
+			signers, err = sd.Verify(nil, &x509.VerifyOptions{Roots: roots})
+		} else {
+			signers, err = sd.Verify(content, &x509.VerifyOptions{Roots: roots})
+		}
+		assert.FatalError(t, err)
+		assert.Equals(t, []*x509.Certificate{crt}, signers)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	keys := []crypto.Signer{rsaKey, p256Key, p521Key}
+	var certs []*x509.Certificate
+	for _, key := range keys {
+		certs = append(certs, generateCertificate(t, key))
+	}
+
+	for _, content := range [][]byte{{}, []byte("0123456789abcdef"), []byte("the content")} {
+		der, err := Encrypt(content, certs, nil)
+		assert.FatalError(t, err)
+		for i, key := range keys {
+			got, err := Decrypt(der, certs[i], key)
+			assert.FatalError(t, err)
+			assert.Equals(t, content, got)
+		}
+	}
+
+	// Not a recipient
+	der, err := Encrypt([]byte("the content"), certs[:1], nil)
+	assert.FatalError(t, err)
+	_, err = Decrypt(der, certs[1], p256Key)
+	assert.Error(t, err)
+	// Wrong key
+	_, err = Decrypt(der, certs[0], p256Key)
+	assert.Error(t, err)
+
+	_, err = Encrypt([]byte("the content"), nil, nil)
+	assert.Error(t, err)
+	_, err = Encrypt([]byte("the content"), []*x509.Certificate{generateCertificate(t, edKey)}, nil)
+	assert.Error(t, err)
+}
+
+func TestEncrypt_options(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	crt := generateCertificate(t, key)
+
+	content := []byte("the content")
+	for _, opts := range []*EncryptOptions{
+		{ContentEncryptionAlgorithm: AES128CBC},
+		{ContentEncryptionAlgorithm: DESEDE3CBC, PKCS1v15: true},
+		{ContentEncryptionAlgorithm: AES256CBC, PKCS1v15: true},
+	} {
+		der, err := Encrypt(content, []*x509.Certificate{crt}, opts)
+		assert.FatalError(t, err)
+		got, err := Decrypt(der, crt, key)
+		assert.FatalError(t, err)
+		assert.Equals(t, content, got)
+	}
+
+	_, err = Encrypt(content, []*x509.Certificate{crt}, &EncryptOptions{ContentEncryptionAlgorithm: 100})
+	assert.Error(t, err)
+}
+
+func TestDecrypt_openssl(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/data.txt")
+	assert.FatalError(t, err)
+
+	for _, name := range []string{"ec", "rsa"} {
+		crt, err := pemutil.ReadCertificate("testdata/" + name + ".crt")
+		assert.FatalError(t, err)
+		key, err := pemutil.Read("testdata/" + name + ".key")
+		assert.FatalError(t, err)
+		der, err := ioutil.ReadFile("testdata/" + name + ".p7m")
+		assert.FatalError(t, err)
+
+		got, err := Decrypt(der, crt, key)
+		assert.FatalError(t, err)
+		assert.Equals(t, content, got)
+	}
+}
+
+func TestAESKeyWrap(t *testing.T) {
+	// Test vector from RFC 3394, section 4.6.
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F")
+	key, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F")
+	want, _ := hex.DecodeString("28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21")
+
+	wrapped, err := aesKeyWrap(kek, key)
+	assert.FatalError(t, err)
+	assert.Equals(t, want, wrapped)
+	unwrapped, err := aesKeyUnwrap(kek, wrapped)
+	assert.FatalError(t, err)
+	assert.Equals(t, key, unwrapped)
+
+	wrapped[0] ^= 1
+	_, err = aesKeyUnwrap(kek, wrapped)
+	assert.Error(t, err)
+	_, err = aesKeyWrap(kek, key[:15])
+	assert.Error(t, err)
+}
@@ -0,0 +1,657 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/keys"
+)
+
+var (
+	oidEncryptionAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidEncryptionAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidEncryptionAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidEncryptionDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+
+	oidKeyWrapAES128 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 5}
+	oidKeyWrapAES192 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 25}
+	oidKeyWrapAES256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 45}
+
+	oidKeyEncryptionRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidKeyEncryptionRSAOAEP = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidMGF1                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+
+	oidECPublicKey           = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidDHSinglePassSHA1KDF   = asn1.ObjectIdentifier{1, 3, 133, 16, 840, 63, 0, 2}
+	oidDHSinglePassSHA224KDF = asn1.ObjectIdentifier{1, 3, 132, 1, 11, 0}
+	oidDHSinglePassSHA256KDF = asn1.ObjectIdentifier{1, 3, 132, 1, 11, 1}
+	oidDHSinglePassSHA384KDF = asn1.ObjectIdentifier{1, 3, 132, 1, 11, 2}
+	oidDHSinglePassSHA512KDF = asn1.ObjectIdentifier{1, 3, 132, 1, 11, 3}
+)
+
+// aesKeyWrapIV is the default initial value defined in RFC 3394, section 2.2.3.
+var aesKeyWrapIV = []byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+
+// envelopedData reflects an ASN.1 CMS EnvelopedData. See RFC 5652, section
+// 6.1.
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// keyTransRecipientInfo reflects an ASN.1 CMS KeyTransRecipientInfo. See RFC
+// 5652, section 6.2.1.
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+// keyAgreeRecipientInfo reflects an ASN.1 CMS KeyAgreeRecipientInfo. See RFC
+// 5652, section 6.2.2.
+type keyAgreeRecipientInfo struct {
+	Version                int
+	Originator             asn1.RawValue `asn1:"explicit,tag:0"`
+	UKM                    []byte        `asn1:"explicit,optional,tag:1"`
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	RecipientEncryptedKeys []recipientEncryptedKey
+}
+
+type recipientEncryptedKey struct {
+	RID          asn1.RawValue
+	EncryptedKey []byte
+}
+
+type originatorPublicKey struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// eccCMSSharedInfo is the input of the key derivation function defined in RFC
+// 5753, section 7.2.
+type eccCMSSharedInfo struct {
+	KeyInfo     pkix.AlgorithmIdentifier
+	EntityUInfo []byte `asn1:"explicit,optional,tag:0"`
+	SuppPubInfo []byte `asn1:"explicit,tag:2"`
+}
+
+// rsaOAEPParameters reflects the RSAES-OAEP-params defined in RFC 4055.
+type rsaOAEPParameters struct {
+	HashFunc    pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:0"`
+	MaskGenFunc pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:1"`
+	PSourceFunc pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:2"`
+}
+
+// ContentEncryptionAlgorithm is the algorithm used to encrypt the content of
+// an EnvelopedData.
+type ContentEncryptionAlgorithm int
+
+const (
+	// AES256CBC is AES-256 in CBC mode.
+	AES256CBC ContentEncryptionAlgorithm = iota
+	// AES128CBC is AES-128 in CBC mode.
+	AES128CBC
+	// DESEDE3CBC is triple DES in CBC mode, it should only be used with
+	// legacy systems.
+	DESEDE3CBC
+)
+
+// EncryptOptions are the options used to encrypt a CMS message.
+type EncryptOptions struct {
+	// ContentEncryptionAlgorithm is the algorithm used to encrypt the content,
+	// by default AES-256-CBC.
+	ContentEncryptionAlgorithm ContentEncryptionAlgorithm
+	// PKCS1v15 encrypts the content-encryption key of RSA recipients using
+	// RSAES-PKCS1-v1_5 instead of RSAES-OAEP, as required by legacy systems
+	// like most SCEP servers.
+	PKCS1v15 bool
+}
+
+// Encrypt returns the DER-encoded ContentInfo with an EnvelopedData with the
+// content encrypted for the given recipients. By default, the content is
+// encrypted using AES-256-CBC, and the content-encryption key is encrypted
+// using RSAES-OAEP for RSA certificates, or using ephemeral-static ECDH and
+// AES key wrap for EC certificates. If opts is nil the default options are
+// used.
+func Encrypt(content []byte, recipients []*x509.Certificate, opts *EncryptOptions) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("error encrypting CMS: recipients cannot be empty")
+	}
+	if opts == nil {
+		opts = &EncryptOptions{}
+	}
+
+	var key []byte
+	var alg asn1.ObjectIdentifier
+	switch opts.ContentEncryptionAlgorithm {
+	case AES256CBC:
+		key, alg = make([]byte, 32), oidEncryptionAES256CBC
+	case AES128CBC:
+		key, alg = make([]byte, 16), oidEncryptionAES128CBC
+	case DESEDE3CBC:
+		key, alg = make([]byte, 24), oidEncryptionDESEDE3CBC
+	default:
+		return nil, errors.Errorf("error encrypting CMS: unsupported content encryption algorithm %d", opts.ContentEncryptionAlgorithm)
+	}
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Wrap(err, "error generating key")
+	}
+	block, err := newCipher(alg, key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, block.BlockSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, errors.Wrap(err, "error generating iv")
+	}
+	ciphertext := pkcs7Pad(content, block.BlockSize())
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+
+	version := 0
+	var infos []asn1.RawValue
+	for _, crt := range recipients {
+		var ri []byte
+		switch pub := crt.PublicKey.(type) {
+		case *rsa.PublicKey:
+			ri, err = keyTransRecipient(crt, pub, key, opts.PKCS1v15)
+		case *ecdsa.PublicKey:
+			ri, err = keyAgreeRecipient(crt, pub, key)
+			version = 2
+		default:
+			return nil, errors.Errorf("error encrypting CMS: unsupported key type %T", pub)
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, asn1.RawValue{FullBytes: ri})
+	}
+
+	params, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return marshalContentInfo(oidEnvelopedData, envelopedData{
+		Version:        version,
+		RecipientInfos: infos,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType: oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  alg,
+				Parameters: asn1.RawValue{FullBytes: params},
+			},
+			EncryptedContent: asn1.RawValue{
+				Class: asn1.ClassContextSpecific,
+				Tag:   0,
+				Bytes: ciphertext,
+			},
+		},
+	})
+}
+
+// Decrypt decrypts the content of the given DER-encoded ContentInfo with an
+// EnvelopedData using the certificate and private key of a recipient.
+func Decrypt(der []byte, crt *x509.Certificate, priv crypto.PrivateKey) ([]byte, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, errors.Wrap(err, "error parsing CMS content info")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error parsing CMS content info: trailing data")
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, errors.Errorf("error parsing CMS: unsupported content type %s", ci.ContentType)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, errors.Wrap(err, "error parsing CMS enveloped data")
+	}
+
+	var key []byte
+	var err error
+	for _, ri := range ed.RecipientInfos {
+		switch {
+		case ri.Class == asn1.ClassUniversal && ri.Tag == asn1.TagSequence:
+			key, err = decryptKeyTrans(ri, crt, priv)
+		case ri.Class == asn1.ClassContextSpecific && ri.Tag == 1:
+			key, err = decryptKeyAgree(ri, crt, priv)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			break
+		}
+	}
+	if key == nil {
+		return nil, errors.New("error decrypting CMS: certificate is not a recipient")
+	}
+
+	eci := ed.EncryptedContentInfo
+	block, err := newCipher(eci.ContentEncryptionAlgorithm.Algorithm, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decrypting CMS")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.Wrap(err, "error parsing CMS content encryption parameters")
+	}
+	ciphertext, err := octetString(eci.EncryptedContent)
+	if err != nil {
+		return nil, err
+	}
+	size := block.BlockSize()
+	if len(iv) != size || len(ciphertext) == 0 || len(ciphertext)%size != 0 {
+		return nil, errors.New("error decrypting CMS: invalid ciphertext")
+	}
+	content := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(content, ciphertext)
+	return pkcs7Unpad(content, size)
+}
+
+// newCipher returns the block cipher for the given content encryption
+// algorithm.
+func newCipher(alg asn1.ObjectIdentifier, key []byte) (cipher.Block, error) {
+	var block cipher.Block
+	var err error
+	switch {
+	case alg.Equal(oidEncryptionAES128CBC), alg.Equal(oidEncryptionAES192CBC), alg.Equal(oidEncryptionAES256CBC):
+		block, err = aes.NewCipher(key)
+	case alg.Equal(oidEncryptionDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(key)
+	default:
+		return nil, errors.Errorf("unsupported content encryption algorithm %s", alg)
+	}
+	return block, errors.WithStack(err)
+}
+
+func keyTransRecipient(crt *x509.Certificate, pub *rsa.PublicKey, key []byte, pkcs1v15 bool) ([]byte, error) {
+	rid, err := marshalIssuerAndSerialNumber(crt)
+	if err != nil {
+		return nil, err
+	}
+	if pkcs1v15 {
+		encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "error encrypting key")
+		}
+		b, err := asn1.Marshal(keyTransRecipientInfo{
+			Version:                0,
+			RID:                    asn1.RawValue{FullBytes: rid},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidKeyEncryptionRSA, Parameters: asn1.NullRawValue},
+			EncryptedKey:           encryptedKey,
+		})
+		return b, errors.Wrap(err, "error marshaling CMS recipient info")
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(crypto.SHA256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encrypting key")
+	}
+	sha256, _ := DigestAlgorithmIdentifier(crypto.SHA256)
+	mgf1Params, err := asn1.Marshal(sha256)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	params, err := asn1.Marshal(rsaOAEPParameters{
+		HashFunc: sha256,
+		MaskGenFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidMGF1,
+			Parameters: asn1.RawValue{FullBytes: mgf1Params},
+		},
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	b, err := asn1.Marshal(keyTransRecipientInfo{
+		Version: 0,
+		RID:     asn1.RawValue{FullBytes: rid},
+		KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidKeyEncryptionRSAOAEP,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		EncryptedKey: encryptedKey,
+	})
+	return b, errors.Wrap(err, "error marshaling CMS recipient info")
+}
+
+func keyAgreeRecipient(crt *x509.Certificate, pub *ecdsa.PublicKey, key []byte) ([]byte, error) {
+	kdfAlg, h := oidDHSinglePassSHA256KDF, crypto.SHA256
+	switch pub.Curve {
+	case elliptic.P384():
+		kdfAlg, h = oidDHSinglePassSHA384KDF, crypto.SHA384
+	case elliptic.P521():
+		kdfAlg, h = oidDHSinglePassSHA512KDF, crypto.SHA512
+	}
+
+	ephemeral, err := ecdsa.GenerateKey(pub.Curve, rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating key")
+	}
+	kek, err := deriveKeyEncryptionKey(ephemeral, pub, h, oidKeyWrapAES256)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := aesKeyWrap(kek, key)
+	if err != nil {
+		return nil, err
+	}
+
+	rid, err := marshalIssuerAndSerialNumber(crt)
+	if err != nil {
+		return nil, err
+	}
+	point := elliptic.Marshal(pub.Curve, ephemeral.X, ephemeral.Y)
+	originator, err := asn1.MarshalWithParams(originatorPublicKey{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidECPublicKey},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	}, "tag:1")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	wrapAlg, err := asn1.Marshal(pkix.AlgorithmIdentifier{Algorithm: oidKeyWrapAES256})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	b, err := asn1.MarshalWithParams(keyAgreeRecipientInfo{
+		Version: 3,
+		Originator: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      originator,
+		},
+		KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  kdfAlg,
+			Parameters: asn1.RawValue{FullBytes: wrapAlg},
+		},
+		RecipientEncryptedKeys: []recipientEncryptedKey{{
+			RID:          asn1.RawValue{FullBytes: rid},
+			EncryptedKey: encryptedKey,
+		}},
+	}, "tag:1")
+	return b, errors.Wrap(err, "error marshaling CMS recipient info")
+}
+
+func decryptKeyTrans(ri asn1.RawValue, crt *x509.Certificate, priv crypto.PrivateKey) ([]byte, error) {
+	var ktri keyTransRecipientInfo
+	if _, err := asn1.Unmarshal(ri.FullBytes, &ktri); err != nil {
+		return nil, errors.Wrap(err, "error parsing CMS recipient info")
+	}
+	if !matchRecipient(ktri.RID, crt) {
+		return nil, nil
+	}
+	key, ok := priv.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("error decrypting CMS: an RSA key is required, got %T", priv)
+	}
+
+	alg := ktri.KeyEncryptionAlgorithm
+	switch {
+	case alg.Algorithm.Equal(oidKeyEncryptionRSA):
+		b, err := rsa.DecryptPKCS1v15(rand.Reader, key, ktri.EncryptedKey)
+		return b, errors.Wrap(err, "error decrypting CMS key")
+	case alg.Algorithm.Equal(oidKeyEncryptionRSAOAEP):
+		h := crypto.SHA1
+		if len(alg.Parameters.FullBytes) > 0 {
+			var params rsaOAEPParameters
+			if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+				return nil, errors.Wrap(err, "error parsing CMS key encryption parameters")
+			}
+			if params.HashFunc.Algorithm != nil {
+				var err error
+				if h, err = DigestAlgorithm(params.HashFunc.Algorithm); err != nil {
+					return nil, err
+				}
+			}
+		}
+		b, err := rsa.DecryptOAEP(h.New(), rand.Reader, key, ktri.EncryptedKey, nil)
+		return b, errors.Wrap(err, "error decrypting CMS key")
+	default:
+		return nil, errors.Errorf("error decrypting CMS: unsupported key encryption algorithm %s", alg.Algorithm)
+	}
+}
+
+func decryptKeyAgree(ri asn1.RawValue, crt *x509.Certificate, priv crypto.PrivateKey) ([]byte, error) {
+	var kari keyAgreeRecipientInfo
+	if _, err := asn1.UnmarshalWithParams(ri.FullBytes, &kari, "tag:1"); err != nil {
+		return nil, errors.Wrap(err, "error parsing CMS recipient info")
+	}
+	var encryptedKey []byte
+	for _, rek := range kari.RecipientEncryptedKeys {
+		if matchRecipient(rek.RID, crt) {
+			encryptedKey = rek.EncryptedKey
+			break
+		}
+	}
+	if encryptedKey == nil {
+		return nil, nil
+	}
+	key, ok := priv.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("error decrypting CMS: an EC key is required, got %T", priv)
+	}
+
+	var h crypto.Hash
+	switch alg := kari.KeyEncryptionAlgorithm.Algorithm; {
+	case alg.Equal(oidDHSinglePassSHA1KDF):
+		h = crypto.SHA1
+	case alg.Equal(oidDHSinglePassSHA224KDF):
+		h = crypto.SHA224
+	case alg.Equal(oidDHSinglePassSHA256KDF):
+		h = crypto.SHA256
+	case alg.Equal(oidDHSinglePassSHA384KDF):
+		h = crypto.SHA384
+	case alg.Equal(oidDHSinglePassSHA512KDF):
+		h = crypto.SHA512
+	default:
+		return nil, errors.Errorf("error decrypting CMS: unsupported key agreement algorithm %s", alg)
+	}
+	var wrapAlg pkix.AlgorithmIdentifier
+	if _, err := asn1.Unmarshal(kari.KeyEncryptionAlgorithm.Parameters.FullBytes, &wrapAlg); err != nil {
+		return nil, errors.Wrap(err, "error parsing CMS key wrap algorithm")
+	}
+
+	var opk originatorPublicKey
+	if _, err := asn1.UnmarshalWithParams(kari.Originator.Bytes, &opk, "tag:1"); err != nil {
+		return nil, errors.New("error parsing CMS originator: only originator public keys are supported")
+	}
+	x, y := elliptic.Unmarshal(key.Curve, opk.PublicKey.Bytes)
+	if x == nil {
+		return nil, errors.New("error parsing CMS originator: invalid public key")
+	}
+
+	kek, err := deriveKeyEncryptionKey(key, &ecdsa.PublicKey{Curve: key.Curve, X: x, Y: y}, h, wrapAlg.Algorithm, kari.UKM...)
+	if err != nil {
+		return nil, err
+	}
+	return aesKeyUnwrap(kek, encryptedKey)
+}
+
+// deriveKeyEncryptionKey derives the key-encryption key using the ANSI-X9.63
+// key derivation function as described in RFC 5753, section 7.2.
+func deriveKeyEncryptionKey(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey, h crypto.Hash, wrapAlg asn1.ObjectIdentifier, ukm ...byte) ([]byte, error) {
+	var size int
+	switch {
+	case wrapAlg.Equal(oidKeyWrapAES128):
+		size = 16
+	case wrapAlg.Equal(oidKeyWrapAES192):
+		size = 24
+	case wrapAlg.Equal(oidKeyWrapAES256):
+		size = 32
+	default:
+		return nil, errors.Errorf("unsupported key wrap algorithm %s", wrapAlg)
+	}
+
+	z, err := keys.SharedSecret(priv, pub)
+	if err != nil {
+		return nil, err
+	}
+	suppPubInfo := make([]byte, 4)
+	binary.BigEndian.PutUint32(suppPubInfo, uint32(size*8))
+	sharedInfo, err := asn1.Marshal(eccCMSSharedInfo{
+		KeyInfo:     pkix.AlgorithmIdentifier{Algorithm: wrapAlg},
+		EntityUInfo: ukm,
+		SuppPubInfo: suppPubInfo,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var kek []byte
+	counter := make([]byte, 4)
+	for i := uint32(1); len(kek) < size; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		hh := h.New()
+		hh.Write(z)
+		hh.Write(counter)
+		hh.Write(sharedInfo)
+		kek = hh.Sum(kek)
+	}
+	return kek[:size], nil
+}
+
+// aesKeyWrap wraps a key using the algorithm defined in RFC 3394.
+func aesKeyWrap(kek, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, errors.New("error wrapping key: invalid key length")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, errors.Wrap(err, "error wrapping key")
+	}
+
+	n := len(key) / 8
+	a := append([]byte{}, aesKeyWrapIV...)
+	r := append([]byte{}, key...)
+	buf := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(buf, a)
+			copy(buf[8:], r[i*8:])
+			block.Encrypt(buf, buf)
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf)^t)
+			copy(r[i*8:], buf[8:])
+		}
+	}
+	return append(a, r...), nil
+}
+
+// aesKeyUnwrap unwraps a key using the algorithm defined in RFC 3394.
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, errors.New("error unwrapping key: invalid key length")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unwrapping key")
+	}
+
+	n := len(wrapped)/8 - 1
+	a := append([]byte{}, wrapped[:8]...)
+	r := append([]byte{}, wrapped[8:]...)
+	buf := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n - 1; i >= 0; i-- {
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(buf, binary.BigEndian.Uint64(a)^t)
+			copy(buf[8:], r[i*8:])
+			block.Decrypt(buf, buf)
+			copy(a, buf[:8])
+			copy(r[i*8:], buf[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a, aesKeyWrapIV) != 1 {
+		return nil, errors.New("error unwrapping key: integrity check failed")
+	}
+	return r, nil
+}
+
+// matchRecipient returns true if the given RecipientIdentifier or
+// KeyAgreeRecipientIdentifier identifies the certificate.
+func matchRecipient(rid asn1.RawValue, crt *x509.Certificate) bool {
+	if rid.Class == asn1.ClassContextSpecific && rid.Tag == 0 {
+		ski := rid.Bytes
+		// rKeyId [0] IMPLICIT RecipientKeyIdentifier
+		if rid.IsCompound {
+			if _, err := asn1.Unmarshal(rid.Bytes, &ski); err != nil {
+				return false
+			}
+		}
+		return len(crt.SubjectKeyId) > 0 && bytes.Equal(ski, crt.SubjectKeyId)
+	}
+	var ias issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(rid.FullBytes, &ias); err != nil {
+		return false
+	}
+	return crt.SerialNumber.Cmp(ias.SerialNumber) == 0 && bytes.Equal(crt.RawIssuer, ias.Issuer.FullBytes)
+}
+
+func marshalIssuerAndSerialNumber(crt *x509.Certificate) ([]byte, error) {
+	b, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: crt.RawIssuer},
+		SerialNumber: crt.SerialNumber,
+	})
+	return b, errors.Wrap(err, "error marshaling CMS issuer and serial number")
+}
+
+// octetString returns the content of an implicitly tagged OCTET STRING that
+// can use the constructed form.
+func octetString(raw asn1.RawValue) ([]byte, error) {
+	if !raw.IsCompound {
+		return raw.Bytes, nil
+	}
+	var b []byte
+	for rest := raw.Bytes; len(rest) > 0; {
+		var part []byte
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &part); err != nil {
+			return nil, errors.Wrap(err, "error parsing CMS encrypted content")
+		}
+		b = append(b, part...)
+	}
+	return b, nil
+}
+
+func pkcs7Pad(b []byte, size int) []byte {
+	n := size - len(b)%size
+	return append(append([]byte{}, b...), bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func pkcs7Unpad(b []byte, size int) ([]byte, error) {
+	n := int(b[len(b)-1])
+	if n == 0 || n > size || n > len(b) {
+		return nil, errors.New("error decrypting CMS: invalid padding")
+	}
+	for _, c := range b[len(b)-n:] {
+		if int(c) != n {
+			return nil, errors.New("error decrypting CMS: invalid padding")
+		}
+	}
+	return b[:len(b)-n], nil
+}
@@ -0,0 +1,217 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	oidAttributeSigningTime = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidSignatureRSA             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSignatureEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// SignOptions are the options used to sign a CMS message.
+type SignOptions struct {
+	// Detached does not include the content in the SignedData.
+	Detached bool
+	// Hash is the hash function used with RSA keys, by default SHA-256. The
+	// hash of EC keys depends on the curve, and Ed25519 keys always use
+	// SHA-512.
+	Hash crypto.Hash
+	// Attributes are added to the signed attributes of the signer.
+	Attributes []Attribute
+}
+
+// Attribute is a CMS attribute with a single value, the value is encoded
+// using encoding/asn1.
+type Attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+// Sign returns the DER-encoded ContentInfo with a SignedData of the given
+// content. The first certificate must be the certificate of the signer, and
+// the rest of them, usually intermediates, are also added to the SignedData.
+// If opts is nil the default options are used.
+func Sign(content []byte, certs []*x509.Certificate, key crypto.Signer, opts *SignOptions) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("error signing CMS: certificate cannot be empty")
+	}
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	crt := certs[0]
+
+	var h crypto.Hash
+	var sigAlg pkix.AlgorithmIdentifier
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		h = crypto.SHA256
+		if opts.Hash != 0 {
+			h = opts.Hash
+		}
+		sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidSignatureRSA, Parameters: asn1.NullRawValue}
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P384():
+			h, sigAlg.Algorithm = crypto.SHA384, oidSignatureECDSAWithSHA384
+		case elliptic.P521():
+			h, sigAlg.Algorithm = crypto.SHA512, oidSignatureECDSAWithSHA512
+		default:
+			h, sigAlg.Algorithm = crypto.SHA256, oidSignatureECDSAWithSHA256
+		}
+	case ed25519.PublicKey:
+		// RFC 8419 requires SHA-512 with Ed25519.
+		h, sigAlg.Algorithm = crypto.SHA512, oidSignatureEd25519
+	default:
+		return nil, errors.Errorf("error signing CMS: unsupported key type %T", pub)
+	}
+
+	pub, err := pemutil.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling public key")
+	}
+	if !bytes.Equal(pub, crt.RawSubjectPublicKeyInfo) {
+		return nil, errors.New("error signing CMS: the key does not match the certificate")
+	}
+
+	digestAlg, err := DigestAlgorithmIdentifier(h)
+	if err != nil {
+		return nil, err
+	}
+	hh := h.New()
+	hh.Write(content)
+
+	signedAttrs, err := marshalAttributes(append([]Attribute{
+		{oidAttributeContentType, oidData},
+		{oidAttributeSigningTime, time.Now().UTC()},
+		{oidAttributeMessageDigest, hh.Sum(nil)},
+	}, opts.Attributes...))
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is over the DER encoding of the SET OF attributes.
+	signed, err := asn1.Marshal(asn1.RawValue{
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      signedAttrs,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling CMS signed attributes")
+	}
+	var signature []byte
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		signature, err = key.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		hh = h.New()
+		hh.Write(signed)
+		signature, err = key.Sign(rand.Reader, hh.Sum(nil), h)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing CMS")
+	}
+
+	sid, err := marshalIssuerAndSerialNumber(crt)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawCerts []byte
+	for _, c := range certs {
+		rawCerts = append(rawCerts, c.Raw...)
+	}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidData},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      rawCerts,
+		},
+		SignerInfos: []signerInfo{{
+			Version:         1,
+			SID:             asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm: digestAlg,
+			SignedAttrs: asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        0,
+				IsCompound: true,
+				Bytes:      signedAttrs,
+			},
+			SignatureAlgorithm: sigAlg,
+			Signature:          signature,
+		}},
+	}
+	if !opts.Detached {
+		sd.EncapContentInfo.EContent = content
+	}
+
+	return marshalContentInfo(oidSignedData, sd)
+}
+
+// marshalAttributes returns the DER encoding of the content of a SET OF
+// attributes, sorted as required by DER.
+func marshalAttributes(attrs []Attribute) ([]byte, error) {
+	encoded := make([][]byte, len(attrs))
+	for i, a := range attrs {
+		value, err := asn1.Marshal(a.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling CMS attribute")
+		}
+		if encoded[i], err = asn1.Marshal(attribute{
+			Type: a.Type,
+			Values: asn1.RawValue{
+				Tag:        asn1.TagSet,
+				IsCompound: true,
+				Bytes:      value,
+			},
+		}); err != nil {
+			return nil, errors.Wrap(err, "error marshaling CMS attribute")
+		}
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+	return bytes.Join(encoded, nil), nil
+}
+
+// marshalContentInfo returns the DER encoding of a ContentInfo with the given
+// content.
+func marshalContentInfo(contentType asn1.ObjectIdentifier, content interface{}) ([]byte, error) {
+	b, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling CMS content")
+	}
+	b, err = asn1.Marshal(contentInfo{
+		ContentType: contentType,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      b,
+		},
+	})
+	return b, errors.Wrap(err, "error marshaling CMS content info")
+}
@@ -0,0 +1,21 @@
+#!/bin/sh
+
+set -e
+
+OPENSSL=${OPENSSL:-openssl}
+
+# Recipients and signers
+$OPENSSL req -x509 -newkey rsa:2048 -nodes -days 36500 -subj "/CN=RSA Recipient" \
+    -keyout rsa.key -out rsa.crt
+$OPENSSL req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes -days 36500 \
+    -subj "/CN=EC Recipient" -keyout ec.key -out ec.crt
+
+echo "The quick brown fox jumps over the lazy dog" > data.txt
+
+# Enveloped data, openssl uses the SHA-1 KDF for EC recipients by default
+$OPENSSL cms -encrypt -binary -aes256 -in data.txt -recip rsa.crt -outform DER -out rsa.p7m
+$OPENSSL cms -encrypt -binary -aes128 -in data.txt -recip ec.crt -outform DER -out ec.p7m
+
+# Attached and detached signed data
+$OPENSSL cms -sign -binary -nodetach -in data.txt -signer ec.crt -inkey ec.key -outform DER -out ec.p7s
+$OPENSSL cms -sign -binary -in data.txt -signer rsa.crt -inkey rsa.key -outform DER -out rsa.p7s
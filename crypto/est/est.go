@@ -0,0 +1,188 @@
+// Package est implements a client of the Enrollment over Secure Transport
+// (EST) protocol, RFC 7030.
+package est
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+)
+
+// wellKnownPath is the path prefix of the EST operations.
+const wellKnownPath = "/.well-known/est"
+
+// Client is an EST client.
+type Client struct {
+	baseURL  string
+	client   *http.Client
+	username string
+	password string
+}
+
+// NewClient returns a client for the EST server at the given URL, e.g.
+// 'https://est.example.com'. The label is optional, it's used by servers with
+// multiple CAs. If client is nil the http.DefaultClient is used. The client
+// certificate used to authenticate the requests is configured in the TLS
+// configuration of the client.
+func NewClient(u, label string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	base := strings.TrimSuffix(u, "/")
+	if !strings.HasSuffix(base, wellKnownPath) {
+		base += wellKnownPath
+	}
+	if label != "" {
+		base += "/" + label
+	}
+	return &Client{baseURL: base, client: client}
+}
+
+// SetBasicAuth sets the username and password used to authenticate the
+// enrollment requests.
+func (c *Client) SetBasicAuth(username, password string) {
+	c.username = username
+	c.password = password
+}
+
+// RetryError is the error returned when the server accepts the request but
+// the certificate is not available yet, e.g. waiting for manual approval.
+type RetryError struct {
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *RetryError) Error() string {
+	return "certificate request is pending approval, retry after " + e.RetryAfter.String()
+}
+
+// CACerts returns the current CA certificates.
+func (c *Client) CACerts() ([]*x509.Certificate, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/cacerts", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating EST request")
+	}
+	b, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return parseCertificates(b)
+}
+
+// SimpleEnroll requests a certificate for the given certificate request. It
+// returns the issued certificate first, followed by the rest of the
+// certificates in the response.
+func (c *Client) SimpleEnroll(csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	return c.enroll("simpleenroll", csr)
+}
+
+// SimpleReenroll renews a certificate. The client must authenticate with the
+// current certificate, and the certificate request must have the same subject
+// and subject alternative names.
+func (c *Client) SimpleReenroll(csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	return c.enroll("simplereenroll", csr)
+}
+
+func (c *Client) enroll(operation string, csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	body := base64.StdEncoding.EncodeToString(csr.Raw)
+	req, err := http.NewRequest("POST", c.baseURL+"/"+operation, strings.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating EST request")
+	}
+	req.Header.Set("Content-Type", "application/pkcs10")
+	req.Header.Set("Content-Transfer-Encoding", "base64")
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	b, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parseCertificates(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// The issued certificate is the one with the key of the request.
+	for i, crt := range certs {
+		if bytes.Equal(crt.RawSubjectPublicKeyInfo, csr.RawSubjectPublicKeyInfo) {
+			return append([]*x509.Certificate{crt}, append(certs[:i:i], certs[i+1:]...)...), nil
+		}
+	}
+	return nil, errors.New("error parsing EST response: issued certificate not found")
+}
+
+func (c *Client) do(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error requesting %s", req.URL)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading response from %s", req.URL)
+	}
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		return nil, &RetryError{RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	case resp.StatusCode >= 400:
+		msg := strings.TrimSpace(string(b))
+		if msg == "" || len(msg) > 256 {
+			msg = resp.Status
+		}
+		return nil, errs.WithCode(errors.Errorf("error requesting %s: %s", req.URL, msg), errs.StatusCode(resp.StatusCode))
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.Errorf("error requesting %s: unexpected status %s", req.URL, resp.Status)
+	}
+	return b, nil
+}
+
+// retryAfter parses the value of a Retry-After header, in seconds or as an
+// HTTP date. It defaults to one minute.
+func retryAfter(s string) time.Duration {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return time.Minute
+}
+
+// parseCertificates parses a base64-encoded "certs-only" PKCS#7, the format
+// of the responses of EST servers. Some servers send it in PEM format.
+func parseCertificates(b []byte) ([]*x509.Certificate, error) {
+	var der []byte
+	if block, _ := pem.Decode(b); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		s := strings.Map(func(r rune) rune {
+			switch r {
+			case ' ', '\t', '\r', '\n':
+				return -1
+			}
+			return r
+		}, string(b))
+		if der, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, errors.Wrap(err, "error decoding EST response")
+		}
+	}
+	certs, err := pemutil.ParsePKCS7Certificates(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing EST response")
+	}
+	return certs, nil
+}
@@ -0,0 +1,200 @@
+package est
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+)
+
+type testCA struct {
+	crt *x509.Certificate
+	key *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test EST CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return &testCA{crt: crt, key: key}
+}
+
+func (ca *testCA) sign(t *testing.T, csr *x509.CertificateRequest) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, ca.crt, csr.PublicKey, ca.key)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func writeCertificates(t *testing.T, w http.ResponseWriter, certs ...*x509.Certificate) {
+	b, err := pemutil.MarshalPKCS7Certificates(certs)
+	assert.FatalError(t, err)
+	w.Header().Set("Content-Type", "application/pkcs7-mime")
+	w.Header().Set("Content-Transfer-Encoding", "base64")
+	w.Write([]byte(base64.StdEncoding.EncodeToString(b)))
+}
+
+func newTestServer(t *testing.T, ca *testCA) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/est/cacerts":
+			writeCertificates(t, w, ca.crt)
+		case "/.well-known/est/pending/simpleenroll":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusAccepted)
+		case "/.well-known/est/simpleenroll", "/.well-known/est/simplereenroll":
+			if r.URL.Path == "/.well-known/est/simpleenroll" {
+				if user, pass, ok := r.BasicAuth(); !ok || user != "device" || pass != "secret" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			assert.FatalError(t, err)
+			der, err := base64.StdEncoding.DecodeString(string(body))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			csr, err := x509.ParseCertificateRequest(der)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// The issued certificate is not the first one.
+			writeCertificates(t, w, ca.crt, ca.sign(t, csr))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func newTestCSR(t *testing.T) *x509.CertificateRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "device.example.com"},
+		DNSNames: []string{"device.example.com"},
+	}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+	return csr
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		url, label, want string
+	}{
+		{"https://est.example.com", "", "https://est.example.com/.well-known/est"},
+		{"https://est.example.com/", "", "https://est.example.com/.well-known/est"},
+		{"https://est.example.com/.well-known/est", "", "https://est.example.com/.well-known/est"},
+		{"https://est.example.com", "devices", "https://est.example.com/.well-known/est/devices"},
+	}
+	for _, tt := range tests {
+		assert.Equals(t, tt.want, NewClient(tt.url, tt.label, nil).baseURL)
+	}
+}
+
+func TestClient_CACerts(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newTestServer(t, ca)
+	defer srv.Close()
+
+	certs, err := NewClient(srv.URL, "", srv.Client()).CACerts()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*x509.Certificate{ca.crt}, certs)
+
+	_, err = NewClient(srv.URL, "missing", srv.Client()).CACerts()
+	assert.Error(t, err)
+}
+
+func TestClient_SimpleEnroll(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newTestServer(t, ca)
+	defer srv.Close()
+
+	csr := newTestCSR(t)
+	client := NewClient(srv.URL, "", srv.Client())
+	_, err := client.SimpleEnroll(csr)
+	assert.Equals(t, errs.CodeAuth, errs.GetCode(err))
+
+	client.SetBasicAuth("device", "secret")
+	certs, err := client.SimpleEnroll(csr)
+	assert.FatalError(t, err)
+	assert.Len(t, 2, certs)
+	assert.Equals(t, csr.RawSubjectPublicKeyInfo, certs[0].RawSubjectPublicKeyInfo)
+	assert.Equals(t, ca.crt, certs[1])
+
+	certs, err = client.SimpleReenroll(csr)
+	assert.FatalError(t, err)
+	assert.Equals(t, "device.example.com", certs[0].Subject.CommonName)
+
+	_, err = NewClient(srv.URL, "pending", srv.Client()).SimpleEnroll(csr)
+	if assert.Error(t, err) {
+		assert.Equals(t, &RetryError{RetryAfter: 2 * time.Minute}, err)
+	}
+}
+
+func TestParseCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	b, err := pemutil.MarshalPKCS7Certificates([]*x509.Certificate{ca.crt})
+	assert.FatalError(t, err)
+	encoded := base64.StdEncoding.EncodeToString(b)
+
+	tests := []struct {
+		name    string
+		b       []byte
+		wantErr bool
+	}{
+		{"ok", []byte(encoded), false},
+		{"ok lines", []byte(encoded[:10] + "\r\n" + encoded[10:] + "\n"), false},
+		{"ok pem", pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: b}), false},
+		{"fail base64", []byte("%%%"), true},
+		{"fail pkcs7", []byte(base64.StdEncoding.EncodeToString(ca.crt.Raw)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCertificates(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCertificates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.Equals(t, []*x509.Certificate{ca.crt}, got)
+			}
+		})
+	}
+}
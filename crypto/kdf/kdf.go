@@ -5,7 +5,6 @@ import (
 	"strconv"
 
 	"github.com/pkg/errors"
-	"github.com/smallstep/cli/crypto/randutil"
 
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
@@ -13,20 +12,29 @@ import (
 )
 
 // KDF is the type that all the key derivation functions implements. The
-// current methods uses safe default values, but future improvements can add
-// functional options to be able to use custom settings.
-type KDF func(password []byte) (string, error)
-
-// Scrypt uses scrypt-32768 to derive the given password. Returns the hash
-// using the PHC string format.
-func Scrypt(password []byte) (string, error) {
-	salt, err := randutil.Salt(16)
+// methods use safe default values that can be customized using the functional
+// options.
+type KDF func(password []byte, opts ...Option) (string, error)
+
+// Scrypt uses scrypt-32768 to derive the given password by default. Returns
+// the hash using the PHC string format.
+func Scrypt(password []byte, opts ...Option) (string, error) {
+	ctx, err := new(context).apply(opts...)
 	if err != nil {
 		return "", err
 	}
 
 	// use scrypt-32768 by default
-	p := scryptParams[scryptHash32768]
+	p, err := ctx.scryptParams(scryptParams[scryptHash32768])
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := ctx.salt()
+	if err != nil {
+		return "", err
+	}
+
 	hash, err := scrypt.Key(password, salt, p.N, p.r, p.p, p.kl)
 	if err != nil {
 		return "", errors.Wrap(err, "error deriving password")
@@ -37,8 +45,18 @@ func Scrypt(password []byte) (string, error) {
 
 // Bcrypt uses bcrypt to derive the given password. Returns the hash
 // using the Modular Crypt Format standard for bcrypt implementations.
-func Bcrypt(password []byte) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+func Bcrypt(password []byte, opts ...Option) (string, error) {
+	ctx, err := new(context).apply(opts...)
+	if err != nil {
+		return "", err
+	}
+
+	cost, err := ctx.bcryptCost()
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword(password, cost)
 	if err != nil {
 		return "", errors.Wrap(err, "error deriving password")
 
@@ -50,13 +68,22 @@ func Bcrypt(password []byte) (string, error) {
 // using the PHC string format.
 //
 // Argon2i is optimized to resist side-channel attacks.
-func Argon2i(password []byte) (string, error) {
-	salt, err := randutil.Salt(16)
+func Argon2i(password []byte, opts ...Option) (string, error) {
+	ctx, err := new(context).apply(opts...)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := ctx.argon2Params(argon2Params[argon2iHash])
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := ctx.salt()
 	if err != nil {
 		return "", err
 	}
 
-	p := argon2Params[argon2iHash]
 	hash := argon2.Key(password, salt, p.t, p.m, p.p, p.kl)
 	identifier := "argon2i$v=" + strconv.Itoa(argon2.Version)
 	return phcEncode(identifier, p.getParams(), salt, hash), nil
@@ -69,13 +96,22 @@ func Argon2i(password []byte) (string, error) {
 // attacks and Argon2i that is optimized to resist side-channel attacks. The
 // Internet draft (https://tools.ietf.org/html/draft-irtf-cfrg-argon2-03)
 // recommends using Argon2id.
-func Argon2id(password []byte) (string, error) {
-	salt, err := randutil.Salt(16)
+func Argon2id(password []byte, opts ...Option) (string, error) {
+	ctx, err := new(context).apply(opts...)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := ctx.argon2Params(argon2Params[argon2idHash])
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := ctx.salt()
 	if err != nil {
 		return "", err
 	}
 
-	p := argon2Params[argon2idHash]
 	hash := argon2.IDKey(password, salt, p.t, p.m, p.p, p.kl)
 	identifier := "argon2id$v=" + strconv.Itoa(argon2.Version)
 	return phcEncode(identifier, p.getParams(), salt, hash), nil
@@ -92,7 +128,7 @@ func Compare(password, phc []byte) (bool, error) {
 
 	var hashedPass []byte
 	switch id {
-	case bcryptHash:
+	case bcryptHash, bcryptHash2b, bcryptHash2y:
 		return (bcrypt.CompareHashAndPassword(hash, password) == nil), nil
 	case scryptHash:
 		p, err := newScryptParams(params)
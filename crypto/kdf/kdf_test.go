@@ -47,6 +47,44 @@ func TestKDF(t *testing.T) {
 	}
 }
 
+func TestKDFOptions(t *testing.T) {
+	tests := []struct {
+		kdf    KDF
+		opts   []Option
+		prefix string
+		err    string
+	}{
+		{Scrypt, []Option{WithCost(10), WithBlockSize(4), WithParallelism(2)}, "$scrypt$ln=10,r=4,p=2$", ""},
+		{Scrypt, []Option{WithCost(12), WithSaltSize(32), WithKeyLength(64)}, "$scrypt$ln=12,r=8,p=1$", ""},
+		{Bcrypt, []Option{WithCost(4)}, "$2a$04$", ""},
+		{Argon2i, []Option{WithIterations(2), WithMemory(1024), WithParallelism(1)}, "$argon2i$v=19$m=1024,t=2,p=1$", ""},
+		{Argon2id, []Option{WithIterations(1), WithMemory(4096), WithKeyLength(16)}, "$argon2id$v=19$m=4096,t=1,p=4$", ""},
+		{Scrypt, []Option{WithCost(21)}, "", "invalid scrypt cost 21"},
+		{Scrypt, []Option{WithBlockSize(33)}, "", "invalid block size 33"},
+		{Scrypt, []Option{WithSaltSize(4)}, "", "invalid salt size 4: minimum size is 8 bytes"},
+		{Scrypt, []Option{WithKeyLength(8)}, "", "invalid key length 8: size must be between 16 and 128 bytes"},
+		{Bcrypt, []Option{WithCost(32)}, "", "invalid bcrypt cost 32: cost must be between 4 and 31"},
+		{Argon2i, []Option{WithIterations(0)}, "", "invalid number of iterations 0"},
+		{Argon2id, []Option{WithMemory(16), WithParallelism(4)}, "", "invalid argon2 memory 16: minimum memory with parallelism 4 is 32"},
+	}
+
+	for i, tc := range tests {
+		phc, err := tc.kdf([]byte("password"), tc.opts...)
+		if tc.err != "" {
+			if assert.Error(t, err, i) {
+				assert.Equals(t, tc.err, err.Error(), i)
+			}
+			continue
+		}
+		assert.FatalError(t, err, i)
+		assert.HasPrefix(t, phc, tc.prefix, i)
+
+		ok, err := CompareString("password", phc)
+		assert.True(t, ok, phc)
+		assert.NoError(t, err)
+	}
+}
+
 func TestCompare(t *testing.T) {
 	tests := []struct {
 		phc string
@@ -142,6 +180,8 @@ func TestVectors(t *testing.T) {
 		{"~!@#$%^&*()      ~!@#$%^&*()PNBFRD", "$2a$08$Eq2r4G/76Wv39MzSX262huzPz612MZiYHVUJe/OcOql2jo4.9UxTW"},
 		{"~!@#$%^&*()      ~!@#$%^&*()PNBFRD", "$2a$10$LgfYWkbzEvQ4JakH7rOvHe0y8pHKF9OaFgwUZ2q7W2FFZmZzJYlfS"},
 		{"~!@#$%^&*()      ~!@#$%^&*()PNBFRD", "$2a$12$WApznUOJfkEGSmYRfnkrPOr466oFDCaj4b6HY3EXGvfxm43seyhgC"},
+		{"abc", "$2b$06$If6bvum7DFjUnE9p2uDeDu0YHzrHM6tf.iqN8.yx.jNN1ILEf7h0i"},
+		{"abc", "$2y$06$If6bvum7DFjUnE9p2uDeDu0YHzrHM6tf.iqN8.yx.jNN1ILEf7h0i"},
 	}
 
 	for _, tc := range tests {
@@ -0,0 +1,190 @@
+package kdf
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/randutil"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// defaultSaltSize is the size of the salt used by default in scrypt and
+	// argon2.
+	defaultSaltSize = 16
+	// minSaltSize is the minimum size of the salt accepted by the options.
+	minSaltSize = 8
+	// minKeyLength and maxKeyLength are the minimum and maximum size of the
+	// derived key in scrypt and argon2.
+	minKeyLength = 16
+	maxKeyLength = 128
+)
+
+type context struct {
+	cost        int
+	blockSize   int
+	parallelism int
+	iterations  int
+	memory      int
+	saltSize    int
+	keyLength   int
+}
+
+// apply the options to the context and returns an error if one of the options
+// fails.
+func (ctx *context) apply(opts ...Option) (*context, error) {
+	for _, opt := range opts {
+		if err := opt(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return ctx, nil
+}
+
+// Option is the type used to customize the parameters of the key derivation
+// functions. Options that do not apply to a key derivation function are
+// ignored.
+type Option func(ctx *context) error
+
+// WithCost sets the cost parameter. For scrypt it is the base 2 logarithm of
+// the CPU/memory cost N (ln), for bcrypt it is the work factor.
+func WithCost(cost int) Option {
+	return func(ctx *context) error {
+		if cost < 1 {
+			return errors.Errorf("invalid cost %d", cost)
+		}
+		ctx.cost = cost
+		return nil
+	}
+}
+
+// WithBlockSize sets the block size r used by scrypt.
+func WithBlockSize(r int) Option {
+	return func(ctx *context) error {
+		if r < 1 || r > ScryptMaxBlockSize {
+			return errors.Errorf("invalid block size %d", r)
+		}
+		ctx.blockSize = r
+		return nil
+	}
+}
+
+// WithParallelism sets the parallelism parameter p used by scrypt and argon2.
+func WithParallelism(p int) Option {
+	return func(ctx *context) error {
+		if p < 1 || p > ScryptMaxParallelism || p > Argon2MaxParallelism {
+			return errors.Errorf("invalid parallelism %d", p)
+		}
+		ctx.parallelism = p
+		return nil
+	}
+}
+
+// WithIterations sets the number of iterations t used by argon2.
+func WithIterations(t int) Option {
+	return func(ctx *context) error {
+		if t < 1 || t > Argon2MaxIterations {
+			return errors.Errorf("invalid number of iterations %d", t)
+		}
+		ctx.iterations = t
+		return nil
+	}
+}
+
+// WithMemory sets the amount of memory m in KiB used by argon2.
+func WithMemory(m int) Option {
+	return func(ctx *context) error {
+		if m < 8 || m > Argon2MaxMemory {
+			return errors.Errorf("invalid memory %d", m)
+		}
+		ctx.memory = m
+		return nil
+	}
+}
+
+// WithSaltSize sets the size in bytes of the random salt used by scrypt and
+// argon2.
+func WithSaltSize(size int) Option {
+	return func(ctx *context) error {
+		if size < minSaltSize {
+			return errors.Errorf("invalid salt size %d: minimum size is %d bytes", size, minSaltSize)
+		}
+		ctx.saltSize = size
+		return nil
+	}
+}
+
+// WithKeyLength sets the size in bytes of the key derived by scrypt and
+// argon2.
+func WithKeyLength(size int) Option {
+	return func(ctx *context) error {
+		if size < minKeyLength || size > maxKeyLength {
+			return errors.Errorf("invalid key length %d: size must be between %d and %d bytes", size, minKeyLength, maxKeyLength)
+		}
+		ctx.keyLength = size
+		return nil
+	}
+}
+
+// scryptParams returns the scrypt parameters using the given defaults and the
+// values in the context.
+func (ctx *context) scryptParams(def scryptParam) (*scryptParam, error) {
+	p := def
+	if ctx.cost > 0 {
+		if ctx.cost > ScryptMaxCost {
+			return nil, errors.Errorf("invalid scrypt cost %d", ctx.cost)
+		}
+		p.N = 1 << uint(ctx.cost)
+	}
+	if ctx.blockSize > 0 {
+		p.r = ctx.blockSize
+	}
+	if ctx.parallelism > 0 {
+		p.p = ctx.parallelism
+	}
+	if ctx.keyLength > 0 {
+		p.kl = ctx.keyLength
+	}
+	return &p, nil
+}
+
+// argon2Params returns the argon2 parameters using the given defaults and the
+// values in the context.
+func (ctx *context) argon2Params(def argon2Param) (*argon2Param, error) {
+	p := def
+	if ctx.iterations > 0 {
+		p.t = uint32(ctx.iterations)
+	}
+	if ctx.memory > 0 {
+		p.m = uint32(ctx.memory)
+	}
+	if ctx.parallelism > 0 {
+		p.p = uint8(ctx.parallelism)
+	}
+	if ctx.keyLength > 0 {
+		p.kl = uint32(ctx.keyLength)
+	}
+	// Argon2 requires at least 8*p KiB of memory
+	if p.m < 8*uint32(p.p) {
+		return nil, errors.Errorf("invalid argon2 memory %d: minimum memory with parallelism %d is %d", p.m, p.p, 8*uint32(p.p))
+	}
+	return &p, nil
+}
+
+// bcryptCost returns the bcrypt work factor in the context or the default one.
+func (ctx *context) bcryptCost() (int, error) {
+	if ctx.cost == 0 {
+		return bcrypt.DefaultCost, nil
+	}
+	if ctx.cost < bcrypt.MinCost || ctx.cost > bcrypt.MaxCost {
+		return 0, errors.Errorf("invalid bcrypt cost %d: cost must be between %d and %d", ctx.cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return ctx.cost, nil
+}
+
+// salt returns a new random salt with the size in the context or the default
+// one.
+func (ctx *context) salt() ([]byte, error) {
+	if ctx.saltSize > 0 {
+		return randutil.Salt(ctx.saltSize)
+	}
+	return randutil.Salt(defaultSaltSize)
+}
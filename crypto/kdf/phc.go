@@ -56,14 +56,14 @@ func phcEncode(identifier, params string, salt, hash []byte) string {
 // phcDecode returns the different parts of a PHC encoded string.
 func phcDecode(s string) (id string, version int, params string, salt []byte, hash []byte, err error) {
 	subs := strings.SplitN(s, "$", 6)
-	if subs[0] != "" || len(subs) < 2 || (subs[1] == bcryptHash && len(subs) != 4) {
+	if subs[0] != "" || len(subs) < 2 || (isBcrypt(subs[1]) && len(subs) != 4) {
 		return "", 0, "", nil, nil, errors.New("cannot decode password hash")
 	}
 
 	// Special case for bcrypt
 	// return just the id and the full hash
-	if subs[1] == bcryptHash {
-		return bcryptHash, 0, "", nil, []byte(s), nil
+	if isBcrypt(subs[1]) {
+		return subs[1], 0, "", nil, []byte(s), nil
 	}
 
 	switch len(subs) {
@@ -106,3 +106,14 @@ func phcDecode(s string) (id string, version int, params string, salt []byte, ha
 
 	return
 }
+
+// isBcrypt returns true if the id is one of the bcrypt versions supported:
+// 2a, 2b or 2y.
+func isBcrypt(id string) bool {
+	switch id {
+	case bcryptHash, bcryptHash2b, bcryptHash2y:
+		return true
+	default:
+		return false
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 const (
 	bcryptHash      = "2a"
+	bcryptHash2b    = "2b"
+	bcryptHash2y    = "2y"
 	scryptHash      = "scrypt"
 	scryptHash16384 = "scrypt-16384"
 	scryptHash32768 = "scrypt-32768"
@@ -0,0 +1,285 @@
+// Package keychain implements the storage of keys and certificates in the
+// macOS Keychain. Keys can also be created in the Secure Enclave, in that case
+// the private key never leaves the device.
+//
+// Keys and certificates are identified by a label using URIs like:
+//
+//	keychain:label=internal.example.com
+//	keychain:label=internal.example.com;se=true
+//
+// A key and a certificate with the same label form an identity that can be
+// used in TLS connections.
+package keychain
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Scheme is the scheme of the Keychain URIs.
+const Scheme = "keychain"
+
+// URI identifies the items stored in the Keychain with a label.
+type URI struct {
+	// Label is the label of the key and the certificate.
+	Label string
+	// SecureEnclave indicates that the key is stored in the Secure Enclave.
+	SecureEnclave bool
+}
+
+// IsURI returns true if the given name is a Keychain URI.
+func IsURI(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), Scheme+":")
+}
+
+// ParseURI parses the given Keychain URI.
+func ParseURI(rawuri string) (*URI, error) {
+	if !IsURI(rawuri) {
+		return nil, errors.Errorf("error parsing %s: not a keychain URI", rawuri)
+	}
+
+	u := new(URI)
+	for _, attr := range strings.Split(rawuri[len(Scheme)+1:], ";") {
+		if attr == "" {
+			continue
+		}
+		i := strings.Index(attr, "=")
+		if i < 1 {
+			return nil, errors.Errorf("error parsing %s: invalid attribute '%s'", rawuri, attr)
+		}
+		value, err := url.PathUnescape(attr[i+1:])
+		if err != nil {
+			return nil, errors.Errorf("error parsing %s: invalid attribute '%s'", rawuri, attr)
+		}
+		switch strings.ToLower(attr[:i]) {
+		case "label":
+			u.Label = value
+		case "se":
+			if u.SecureEnclave, err = strconv.ParseBool(value); err != nil {
+				return nil, errors.Errorf("error parsing %s: invalid se '%s'", rawuri, value)
+			}
+		default:
+			return nil, errors.Errorf("error parsing %s: unsupported attribute '%s'", rawuri, attr[:i])
+		}
+	}
+	if u.Label == "" {
+		return nil, errors.Errorf("error parsing %s: label is required", rawuri)
+	}
+	return u, nil
+}
+
+// String returns the string representation of the URI.
+func (u *URI) String() string {
+	s := Scheme + ":label=" + url.PathEscape(u.Label)
+	if u.SecureEnclave {
+		s += ";se=true"
+	}
+	return s
+}
+
+// CreateKey creates a new key in the Keychain with the given key type, curve
+// and size, and returns a crypto.Signer that uses it. Keys in the Secure
+// Enclave must be EC P-256 keys.
+func CreateKey(rawuri, kty, crv string, size int) (crypto.Signer, error) {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+	isRSA, bits, err := keyParameters(u, kty, crv, size)
+	if err != nil {
+		return nil, err
+	}
+	return createKey(u, isRSA, bits)
+}
+
+// NewSigner returns a crypto.Signer that uses the key in the given URI.
+func NewSigner(rawuri string) (crypto.Signer, error) {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(u)
+}
+
+// ImportKey imports the given private key into the Keychain. Keys cannot be
+// imported into the Secure Enclave.
+func ImportKey(rawuri string, key crypto.PrivateKey) error {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return err
+	}
+	if u.SecureEnclave {
+		return errors.New("keys cannot be imported into the Secure Enclave")
+	}
+	data, isRSA, err := marshalPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return importKey(u, data, isRSA)
+}
+
+// ImportCertificate imports the given certificate into the Keychain. A
+// previous certificate with the same label is replaced.
+func ImportCertificate(rawuri string, crt *x509.Certificate) error {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return err
+	}
+	return importCertificate(u, crt.Raw)
+}
+
+// LoadCertificate returns the certificate in the given URI.
+func LoadCertificate(rawuri string) (*x509.Certificate, error) {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+	der, err := loadCertificate(u)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing certificate in %s", rawuri)
+	}
+	return crt, nil
+}
+
+// LoadIdentity returns the certificate and the key in the given URI as a
+// tls.Certificate.
+func LoadIdentity(rawuri string) (tls.Certificate, error) {
+	var cert tls.Certificate
+	crt, err := LoadCertificate(rawuri)
+	if err != nil {
+		return cert, err
+	}
+	signer, err := NewSigner(rawuri)
+	if err != nil {
+		return cert, err
+	}
+	if !publicKeyEqual(crt.PublicKey, signer.Public()) {
+		return cert, errors.Errorf("error loading %s: the certificate does not match the key", rawuri)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{crt.Raw},
+		PrivateKey:  signer,
+		Leaf:        crt,
+	}, nil
+}
+
+// Delete removes the key and the certificate in the given URI from the
+// Keychain.
+func Delete(rawuri string) error {
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return err
+	}
+	return deleteItems(u)
+}
+
+// keyParameters validates the key type, curve and size and returns if the key
+// is an RSA key and its size in bits.
+func keyParameters(u *URI, kty, crv string, size int) (bool, int, error) {
+	switch kty {
+	case "EC":
+		var bits int
+		switch crv {
+		case "", "P-256":
+			bits = 256
+		case "P-384":
+			bits = 384
+		case "P-521":
+			bits = 521
+		default:
+			return false, 0, errors.Errorf("unsupported curve '%s'", crv)
+		}
+		if u.SecureEnclave && bits != 256 {
+			return false, 0, errors.Errorf("unsupported curve '%s': the Secure Enclave only supports P-256", crv)
+		}
+		return false, bits, nil
+	case "RSA":
+		if u.SecureEnclave {
+			return false, 0, errors.New("unsupported key type 'RSA': the Secure Enclave only supports EC keys")
+		}
+		if size < 2048 {
+			return false, 0, errors.Errorf("invalid RSA key size %d, the minimum size is 2048", size)
+		}
+		return true, size, nil
+	default:
+		return false, 0, errors.Errorf("unsupported key type '%s'", kty)
+	}
+}
+
+// marshalPrivateKey returns the external representation of the key used by
+// the Security framework. For EC keys this is the uncompressed point followed
+// by the private scalar, for RSA keys is the PKCS #1 encoding.
+func marshalPrivateKey(key crypto.PrivateKey) ([]byte, bool, error) {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		b := elliptic.Marshal(k.Curve, k.X, k.Y)
+		d := k.D.Bytes()
+		b = append(b, make([]byte, size-len(d))...)
+		return append(b, d...), false, nil
+	case *rsa.PrivateKey:
+		return x509.MarshalPKCS1PrivateKey(k), true, nil
+	default:
+		return nil, false, errors.Errorf("unsupported key type %T", key)
+	}
+}
+
+// parsePublicKey parses the external representation of a public key used by
+// the Security framework.
+func parsePublicKey(b []byte) (crypto.PublicKey, error) {
+	if len(b) > 0 && b[0] == 4 {
+		var curve elliptic.Curve
+		switch len(b) {
+		case 65:
+			curve = elliptic.P256()
+		case 97:
+			curve = elliptic.P384()
+		case 133:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("error parsing public key: unsupported curve")
+		}
+		x, y := elliptic.Unmarshal(curve, b)
+		if x == nil {
+			return nil, errors.New("error parsing public key: invalid point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	pub, err := x509.ParsePKCS1PublicKey(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing public key")
+	}
+	return pub, nil
+}
+
+// publicKeyEqual returns true if both public keys are equal.
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	switch ka := a.(type) {
+	case *ecdsa.PublicKey:
+		kb, ok := b.(*ecdsa.PublicKey)
+		return ok && ka.Curve == kb.Curve && bigEqual(ka.X, kb.X) && bigEqual(ka.Y, kb.Y)
+	case *rsa.PublicKey:
+		kb, ok := b.(*rsa.PublicKey)
+		return ok && ka.E == kb.E && bigEqual(ka.N, kb.N)
+	default:
+		return false
+	}
+}
+
+func bigEqual(a, b *big.Int) bool {
+	return a.Cmp(b) == 0
+}
@@ -0,0 +1,390 @@
+// +build darwin,cgo
+
+package keychain
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+static CFMutableDictionaryRef newDictionary() {
+	return CFDictionaryCreateMutable(kCFAllocatorDefault, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+}
+
+static CFStringRef newString(const char *s) {
+	return CFStringCreateWithCString(kCFAllocatorDefault, s, kCFStringEncodingUTF8);
+}
+
+static OSStatus statusFromError(CFErrorRef error) {
+	OSStatus status = errSecParam;
+	if (error != NULL) {
+		status = (OSStatus)CFErrorGetCode(error);
+		CFRelease(error);
+	}
+	return status;
+}
+
+// errorMessage writes in buf the description of the given status.
+static void errorMessage(OSStatus status, char *buf, int size) {
+	CFStringRef msg = SecCopyErrorMessageString(status, NULL);
+	if (msg == NULL || !CFStringGetCString(msg, buf, size, kCFStringEncodingUTF8)) {
+		snprintf(buf, size, "OSStatus %d", (int)status);
+	}
+	if (msg != NULL) {
+		CFRelease(msg);
+	}
+}
+
+// createKey creates a new permanent private key with the given label.
+static OSStatus createKey(const char *label, int isRSA, int bits, int secureEnclave, SecKeyRef *key) {
+	CFStringRef cfLabel = newString(label);
+	CFNumberRef cfBits = CFNumberCreate(kCFAllocatorDefault, kCFNumberIntType, &bits);
+	CFMutableDictionaryRef privateAttrs = newDictionary();
+	CFMutableDictionaryRef attrs = newDictionary();
+	SecAccessControlRef access = NULL;
+
+	CFDictionarySetValue(privateAttrs, kSecAttrIsPermanent, kCFBooleanTrue);
+	CFDictionarySetValue(privateAttrs, kSecAttrLabel, cfLabel);
+	CFDictionarySetValue(attrs, kSecAttrKeyType, isRSA ? kSecAttrKeyTypeRSA : kSecAttrKeyTypeECSECPrimeRandom);
+	CFDictionarySetValue(attrs, kSecAttrKeySizeInBits, cfBits);
+	if (secureEnclave) {
+		access = SecAccessControlCreateWithFlags(kCFAllocatorDefault,
+			kSecAttrAccessibleWhenUnlockedThisDeviceOnly, kSecAccessControlPrivateKeyUsage, NULL);
+		CFDictionarySetValue(privateAttrs, kSecAttrAccessControl, access);
+		CFDictionarySetValue(attrs, kSecAttrTokenID, kSecAttrTokenIDSecureEnclave);
+	}
+	CFDictionarySetValue(attrs, kSecPrivateKeyAttrs, privateAttrs);
+
+	CFErrorRef error = NULL;
+	OSStatus status = errSecSuccess;
+	*key = SecKeyCreateRandomKey(attrs, &error);
+	if (*key == NULL) {
+		status = statusFromError(error);
+	}
+
+	if (access != NULL) {
+		CFRelease(access);
+	}
+	CFRelease(attrs);
+	CFRelease(privateAttrs);
+	CFRelease(cfBits);
+	CFRelease(cfLabel);
+	return status;
+}
+
+// findKey looks for the private key with the given label.
+static OSStatus findKey(const char *label, int secureEnclave, SecKeyRef *key) {
+	CFStringRef cfLabel = newString(label);
+	CFMutableDictionaryRef query = newDictionary();
+	CFDictionarySetValue(query, kSecClass, kSecClassKey);
+	CFDictionarySetValue(query, kSecAttrKeyClass, kSecAttrKeyClassPrivate);
+	CFDictionarySetValue(query, kSecAttrLabel, cfLabel);
+	CFDictionarySetValue(query, kSecReturnRef, kCFBooleanTrue);
+	CFDictionarySetValue(query, kSecMatchLimit, kSecMatchLimitOne);
+	if (secureEnclave) {
+		CFDictionarySetValue(query, kSecAttrTokenID, kSecAttrTokenIDSecureEnclave);
+	}
+	OSStatus status = SecItemCopyMatching(query, (CFTypeRef *)key);
+	CFRelease(query);
+	CFRelease(cfLabel);
+	return status;
+}
+
+// copyPublicKey returns the external representation of the public key of the
+// given private key.
+static OSStatus copyPublicKey(SecKeyRef key, CFDataRef *data) {
+	SecKeyRef pub = SecKeyCopyPublicKey(key);
+	if (pub == NULL) {
+		return errSecInvalidKeyRef;
+	}
+	CFErrorRef error = NULL;
+	*data = SecKeyCopyExternalRepresentation(pub, &error);
+	CFRelease(pub);
+	return *data == NULL ? statusFromError(error) : errSecSuccess;
+}
+
+// sign signs the given digest using the key and algorithm.
+static OSStatus sign(SecKeyRef key, SecKeyAlgorithm algorithm, const void *digest, int size, CFDataRef *signature) {
+	if (!SecKeyIsAlgorithmSupported(key, kSecKeyOperationTypeSign, algorithm)) {
+		return errSecUnimplemented;
+	}
+	CFDataRef data = CFDataCreate(kCFAllocatorDefault, digest, size);
+	CFErrorRef error = NULL;
+	*signature = SecKeyCreateSignature(key, algorithm, data, &error);
+	CFRelease(data);
+	return *signature == NULL ? statusFromError(error) : errSecSuccess;
+}
+
+// importKey adds to the keychain the private key in the given external
+// representation.
+static OSStatus importKey(const char *label, int isRSA, const void *der, int size) {
+	CFDataRef data = CFDataCreate(kCFAllocatorDefault, der, size);
+	CFMutableDictionaryRef attrs = newDictionary();
+	CFDictionarySetValue(attrs, kSecAttrKeyType, isRSA ? kSecAttrKeyTypeRSA : kSecAttrKeyTypeECSECPrimeRandom);
+	CFDictionarySetValue(attrs, kSecAttrKeyClass, kSecAttrKeyClassPrivate);
+	CFErrorRef error = NULL;
+	SecKeyRef key = SecKeyCreateWithData(data, attrs, &error);
+	CFRelease(attrs);
+	CFRelease(data);
+	if (key == NULL) {
+		return statusFromError(error);
+	}
+
+	CFStringRef cfLabel = newString(label);
+	CFMutableDictionaryRef item = newDictionary();
+	CFDictionarySetValue(item, kSecClass, kSecClassKey);
+	CFDictionarySetValue(item, kSecValueRef, key);
+	CFDictionarySetValue(item, kSecAttrLabel, cfLabel);
+	OSStatus status = SecItemAdd(item, NULL);
+	CFRelease(item);
+	CFRelease(cfLabel);
+	CFRelease(key);
+	return status;
+}
+
+// deleteItems removes the items of the given class with the given label.
+static OSStatus deleteItems(const char *label, CFTypeRef itemClass) {
+	CFStringRef cfLabel = newString(label);
+	CFMutableDictionaryRef query = newDictionary();
+	CFDictionarySetValue(query, kSecClass, itemClass);
+	CFDictionarySetValue(query, kSecAttrLabel, cfLabel);
+	if (itemClass == kSecClassKey) {
+		CFDictionarySetValue(query, kSecAttrKeyClass, kSecAttrKeyClassPrivate);
+	}
+	OSStatus status = SecItemDelete(query);
+	CFRelease(query);
+	CFRelease(cfLabel);
+	return status == errSecItemNotFound ? errSecSuccess : status;
+}
+
+// importCertificate adds the given certificate to the keychain, replacing the
+// previous certificate with the same label.
+static OSStatus importCertificate(const char *label, const void *der, int size) {
+	OSStatus status = deleteItems(label, kSecClassCertificate);
+	if (status != errSecSuccess) {
+		return status;
+	}
+
+	CFDataRef data = CFDataCreate(kCFAllocatorDefault, der, size);
+	SecCertificateRef cert = SecCertificateCreateWithData(kCFAllocatorDefault, data);
+	CFRelease(data);
+	if (cert == NULL) {
+		return errSecInvalidCertificateRef;
+	}
+
+	CFStringRef cfLabel = newString(label);
+	CFMutableDictionaryRef item = newDictionary();
+	CFDictionarySetValue(item, kSecClass, kSecClassCertificate);
+	CFDictionarySetValue(item, kSecValueRef, cert);
+	CFDictionarySetValue(item, kSecAttrLabel, cfLabel);
+	status = SecItemAdd(item, NULL);
+	CFRelease(item);
+	CFRelease(cfLabel);
+	CFRelease(cert);
+	return status;
+}
+
+// findCertificate returns the DER encoding of the certificate with the given
+// label.
+static OSStatus findCertificate(const char *label, CFDataRef *data) {
+	CFStringRef cfLabel = newString(label);
+	CFMutableDictionaryRef query = newDictionary();
+	CFDictionarySetValue(query, kSecClass, kSecClassCertificate);
+	CFDictionarySetValue(query, kSecAttrLabel, cfLabel);
+	CFDictionarySetValue(query, kSecReturnData, kCFBooleanTrue);
+	CFDictionarySetValue(query, kSecMatchLimit, kSecMatchLimitOne);
+	OSStatus status = SecItemCopyMatching(query, (CFTypeRef *)data);
+	CFRelease(query);
+	CFRelease(cfLabel);
+	return status;
+}
+*/
+import "C"
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"io"
+	"runtime"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// statusError returns an error with the description of the given status.
+func statusError(status C.OSStatus, msg string) error {
+	buf := make([]byte, 256)
+	C.errorMessage(status, (*C.char)(unsafe.Pointer(&buf[0])), C.int(len(buf)))
+	return errors.Errorf("%s: %s", msg, C.GoString((*C.char)(unsafe.Pointer(&buf[0]))))
+}
+
+// goBytes copies the contents of the given CFData and releases it.
+func goBytes(data C.CFDataRef) []byte {
+	defer C.CFRelease(C.CFTypeRef(data))
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(data)), C.int(C.CFDataGetLength(data)))
+}
+
+func boolToInt(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func createKey(u *URI, isRSA bool, bits int) (crypto.Signer, error) {
+	label := C.CString(u.Label)
+	defer C.free(unsafe.Pointer(label))
+
+	var key C.SecKeyRef
+	if status := C.createKey(label, boolToInt(isRSA), C.int(bits), boolToInt(u.SecureEnclave), &key); status != C.errSecSuccess {
+		return nil, statusError(status, "error creating key in the keychain")
+	}
+	return newKeySigner(key)
+}
+
+func newSigner(u *URI) (crypto.Signer, error) {
+	label := C.CString(u.Label)
+	defer C.free(unsafe.Pointer(label))
+
+	var key C.SecKeyRef
+	if status := C.findKey(label, boolToInt(u.SecureEnclave), &key); status != C.errSecSuccess {
+		return nil, statusError(status, "error loading key from the keychain")
+	}
+	return newKeySigner(key)
+}
+
+func importKey(u *URI, data []byte, isRSA bool) error {
+	label := C.CString(u.Label)
+	defer C.free(unsafe.Pointer(label))
+
+	if status := C.importKey(label, boolToInt(isRSA), unsafe.Pointer(&data[0]), C.int(len(data))); status != C.errSecSuccess {
+		return statusError(status, "error importing key into the keychain")
+	}
+	return nil
+}
+
+func importCertificate(u *URI, der []byte) error {
+	label := C.CString(u.Label)
+	defer C.free(unsafe.Pointer(label))
+
+	if status := C.importCertificate(label, unsafe.Pointer(&der[0]), C.int(len(der))); status != C.errSecSuccess {
+		return statusError(status, "error importing certificate into the keychain")
+	}
+	return nil
+}
+
+func loadCertificate(u *URI) ([]byte, error) {
+	label := C.CString(u.Label)
+	defer C.free(unsafe.Pointer(label))
+
+	var data C.CFDataRef
+	if status := C.findCertificate(label, &data); status != C.errSecSuccess {
+		return nil, statusError(status, "error loading certificate from the keychain")
+	}
+	return goBytes(data), nil
+}
+
+func deleteItems(u *URI) error {
+	label := C.CString(u.Label)
+	defer C.free(unsafe.Pointer(label))
+
+	if status := C.deleteItems(label, C.CFTypeRef(C.kSecClassCertificate)); status != C.errSecSuccess {
+		return statusError(status, "error deleting certificate from the keychain")
+	}
+	if status := C.deleteItems(label, C.CFTypeRef(C.kSecClassKey)); status != C.errSecSuccess {
+		return statusError(status, "error deleting key from the keychain")
+	}
+	return nil
+}
+
+// keySigner implements a crypto.Signer using a key in the keychain.
+type keySigner struct {
+	key C.SecKeyRef
+	pub crypto.PublicKey
+}
+
+func newKeySigner(key C.SecKeyRef) (*keySigner, error) {
+	var data C.CFDataRef
+	if status := C.copyPublicKey(key, &data); status != C.errSecSuccess {
+		C.CFRelease(C.CFTypeRef(key))
+		return nil, statusError(status, "error loading public key from the keychain")
+	}
+	pub, err := parsePublicKey(goBytes(data))
+	if err != nil {
+		C.CFRelease(C.CFTypeRef(key))
+		return nil, err
+	}
+
+	s := &keySigner{key: key, pub: pub}
+	runtime.SetFinalizer(s, func(s *keySigner) {
+		C.CFRelease(C.CFTypeRef(s.key))
+	})
+	return s, nil
+}
+
+// Public returns the public key of the signer.
+func (s *keySigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs the given digest. ECDSA signatures are ASN.1 encoded.
+func (s *keySigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, err := s.algorithm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature C.CFDataRef
+	status := C.sign(s.key, algorithm, unsafe.Pointer(&digest[0]), C.int(len(digest)), &signature)
+	runtime.KeepAlive(s)
+	if status != C.errSecSuccess {
+		return nil, statusError(status, "error signing with the keychain")
+	}
+	return goBytes(signature), nil
+}
+
+// algorithm returns the Security framework algorithm for the given options.
+func (s *keySigner) algorithm(opts crypto.SignerOpts) (C.SecKeyAlgorithm, error) {
+	h := opts.HashFunc()
+	switch s.pub.(type) {
+	case *ecdsa.PublicKey:
+		switch h {
+		case crypto.SHA256:
+			return C.kSecKeyAlgorithmECDSASignatureDigestX962SHA256, nil
+		case crypto.SHA384:
+			return C.kSecKeyAlgorithmECDSASignatureDigestX962SHA384, nil
+		case crypto.SHA512:
+			return C.kSecKeyAlgorithmECDSASignatureDigestX962SHA512, nil
+		}
+	case *rsa.PublicKey:
+		if o, ok := opts.(*rsa.PSSOptions); ok {
+			// The Security framework uses a salt with the length of the hash.
+			if o.SaltLength != rsa.PSSSaltLengthEqualsHash && o.SaltLength != h.Size() {
+				return 0, errors.New("unsupported RSA-PSS salt length")
+			}
+			switch h {
+			case crypto.SHA256:
+				return C.kSecKeyAlgorithmRSASignatureDigestPSSSHA256, nil
+			case crypto.SHA384:
+				return C.kSecKeyAlgorithmRSASignatureDigestPSSSHA384, nil
+			case crypto.SHA512:
+				return C.kSecKeyAlgorithmRSASignatureDigestPSSSHA512, nil
+			}
+		} else {
+			switch h {
+			case crypto.SHA256:
+				return C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA256, nil
+			case crypto.SHA384:
+				return C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA384, nil
+			case crypto.SHA512:
+				return C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA512, nil
+			}
+		}
+	}
+	return 0, errors.Errorf("unsupported hash function %v", h)
+}
@@ -0,0 +1,35 @@
+// +build !darwin !cgo
+
+package keychain
+
+import (
+	"crypto"
+
+	"github.com/pkg/errors"
+)
+
+var errNotSupported = errors.New("keychain is not supported: step was compiled without cgo or for a platform other than macOS")
+
+func createKey(u *URI, isRSA bool, bits int) (crypto.Signer, error) {
+	return nil, errNotSupported
+}
+
+func newSigner(u *URI) (crypto.Signer, error) {
+	return nil, errNotSupported
+}
+
+func importKey(u *URI, data []byte, isRSA bool) error {
+	return errNotSupported
+}
+
+func importCertificate(u *URI, der []byte) error {
+	return errNotSupported
+}
+
+func loadCertificate(u *URI) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func deleteItems(u *URI) error {
+	return errNotSupported
+}
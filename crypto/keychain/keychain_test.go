@@ -0,0 +1,153 @@
+package keychain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"math/big"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/keys"
+)
+
+func TestIsURI(t *testing.T) {
+	assert.True(t, IsURI("keychain:label=foo"))
+	assert.True(t, IsURI("KeyChain:label=foo"))
+	assert.False(t, IsURI("foo.key"))
+	assert.False(t, IsURI("pkcs11:object=foo"))
+}
+
+func TestParseURI(t *testing.T) {
+	tests := map[string]struct {
+		uri  string
+		want *URI
+		err  string
+	}{
+		"ok":               {"keychain:label=internal.example.com", &URI{Label: "internal.example.com"}, ""},
+		"ok secure":        {"keychain:label=My%20Key;se=true", &URI{Label: "My Key", SecureEnclave: true}, ""},
+		"ok empty":         {"keychain:;label=foo;;se=false", &URI{Label: "foo"}, ""},
+		"fail scheme":      {"pkcs11:object=foo", nil, "error parsing pkcs11:object=foo: not a keychain URI"},
+		"fail label":       {"keychain:se=true", nil, "error parsing keychain:se=true: label is required"},
+		"fail attribute":   {"keychain:label", nil, "error parsing keychain:label: invalid attribute 'label'"},
+		"fail escape":      {"keychain:label=%zz", nil, "error parsing keychain:label=%zz: invalid attribute 'label=%zz'"},
+		"fail se":          {"keychain:label=foo;se=maybe", nil, "error parsing keychain:label=foo;se=maybe: invalid se 'maybe'"},
+		"fail unsupported": {"keychain:label=foo;token=bar", nil, "error parsing keychain:label=foo;token=bar: unsupported attribute 'token'"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseURI(tc.uri)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Equals(t, tc.err, err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equals(t, tc.want, got)
+				// Round trip
+				got, err = ParseURI(got.String())
+				assert.NoError(t, err)
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestKeyParameters(t *testing.T) {
+	se := &URI{Label: "foo", SecureEnclave: true}
+	tests := map[string]struct {
+		u        *URI
+		kty, crv string
+		size     int
+		wantRSA  bool
+		wantBits int
+		err      string
+	}{
+		"ok EC":         {&URI{}, "EC", "", 0, false, 256, ""},
+		"ok P-384":      {&URI{}, "EC", "P-384", 0, false, 384, ""},
+		"ok P-521":      {&URI{}, "EC", "P-521", 0, false, 521, ""},
+		"ok RSA":        {&URI{}, "RSA", "", 3072, true, 3072, ""},
+		"ok SE":         {se, "EC", "P-256", 0, false, 256, ""},
+		"fail curve":    {&URI{}, "EC", "Ed25519", 0, false, 0, "unsupported curve 'Ed25519'"},
+		"fail RSA size": {&URI{}, "RSA", "", 1024, false, 0, "invalid RSA key size 1024, the minimum size is 2048"},
+		"fail kty":      {&URI{}, "OKP", "Ed25519", 0, false, 0, "unsupported key type 'OKP'"},
+		"fail SE curve": {se, "EC", "P-384", 0, false, 0, "unsupported curve 'P-384': the Secure Enclave only supports P-256"},
+		"fail SE RSA":   {se, "RSA", "", 2048, false, 0, "unsupported key type 'RSA': the Secure Enclave only supports EC keys"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			isRSA, bits, err := keyParameters(tc.u, tc.kty, tc.crv, tc.size)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Equals(t, tc.err, err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equals(t, tc.wantRSA, isRSA)
+				assert.Equals(t, tc.wantBits, bits)
+			}
+		})
+	}
+}
+
+func TestMarshalPrivateKey(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		assert.FatalError(t, err)
+		b, isRSA, err := marshalPrivateKey(key)
+		assert.FatalError(t, err)
+		assert.False(t, isRSA)
+		size := (curve.Params().BitSize + 7) / 8
+		assert.Equals(t, 1+3*size, len(b))
+		// The public key is the prefix of the private key
+		pub, err := parsePublicKey(b[:1+2*size])
+		assert.FatalError(t, err)
+		assert.Equals(t, &key.PublicKey, pub)
+		assert.True(t, publicKeyEqual(&key.PublicKey, pub))
+		assert.Equals(t, 0, key.D.Cmp(new(big.Int).SetBytes(b[1+2*size:])))
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	b, isRSA, err := marshalPrivateKey(key)
+	assert.FatalError(t, err)
+	assert.True(t, isRSA)
+	assert.Equals(t, b[0], byte(0x30))
+
+	pk, err := keys.GenerateKey("OKP", "Ed25519", 0)
+	assert.FatalError(t, err)
+	_, _, err = marshalPrivateKey(pk)
+	assert.Error(t, err)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	pub, err := parsePublicKey(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	assert.FatalError(t, err)
+	assert.Equals(t, &key.PublicKey, pub)
+	_, err = parsePublicKey([]byte("foo"))
+	assert.Error(t, err)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	assert.True(t, publicKeyEqual(&key.PublicKey, &rsa.PublicKey{N: key.N, E: key.E}))
+	assert.False(t, publicKeyEqual(&key.PublicKey, &other.PublicKey))
+	assert.False(t, publicKeyEqual(&key.PublicKey, &ec.PublicKey))
+	assert.False(t, publicKeyEqual(&ec.PublicKey, &key.PublicKey))
+
+	_, err = parsePublicKey([]byte{4, 1, 2, 3})
+	if assert.Error(t, err) {
+		assert.Equals(t, "error parsing public key: unsupported curve", err.Error())
+	}
+	invalid := make([]byte, 65)
+	invalid[0] = 4
+	_, err = parsePublicKey(invalid)
+	if assert.Error(t, err) {
+		assert.Equals(t, "error parsing public key: invalid point", err.Error())
+	}
+}
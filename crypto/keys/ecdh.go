@@ -0,0 +1,80 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/subtle"
+	"hash"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// X25519KeySize is the size in bytes of X25519 public and private keys.
+const X25519KeySize = 32
+
+// SharedSecret computes the Diffie-Hellman shared secret between the given
+// private key and the public key of the peer.
+//
+// Supported keys are EC keys (*ecdsa.PrivateKey and *ecdsa.PublicKey on the
+// same curve), and X25519 keys represented as 32-byte slices.
+func SharedSecret(priv, pub interface{}) ([]byte, error) {
+	switch k := priv.(type) {
+	case *ecdsa.PrivateKey:
+		p, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errors.Errorf("key type mismatch: cannot use %T with an EC private key", pub)
+		}
+		if k.Curve.Params().Name != p.Curve.Params().Name {
+			return nil, errors.Errorf("curve mismatch: cannot use a %s public key with a %s private key",
+				p.Curve.Params().Name, k.Curve.Params().Name)
+		}
+		if !p.Curve.IsOnCurve(p.X, p.Y) {
+			return nil, errors.New("invalid public key: point is not on the curve")
+		}
+		x, _ := p.Curve.ScalarMult(p.X, p.Y, k.D.Bytes())
+		// Left pad the x coordinate to the size of the curve.
+		size := (k.Curve.Params().BitSize + 7) / 8
+		secret := make([]byte, size)
+		xb := x.Bytes()
+		copy(secret[size-len(xb):], xb)
+		return secret, nil
+	case []byte:
+		p, ok := pub.([]byte)
+		if !ok {
+			return nil, errors.Errorf("key type mismatch: cannot use %T with an X25519 private key", pub)
+		}
+		if len(k) != X25519KeySize {
+			return nil, errors.New("invalid private key: key size is not 32 bytes")
+		}
+		if len(p) != X25519KeySize {
+			return nil, errors.New("invalid public key: key size is not 32 bytes")
+		}
+		var dst, scalar, point [X25519KeySize]byte
+		copy(scalar[:], k)
+		copy(point[:], p)
+		curve25519.ScalarMult(&dst, &scalar, &point)
+		// Reject low order points resulting in an all-zero shared secret.
+		var zero [X25519KeySize]byte
+		if subtle.ConstantTimeCompare(dst[:], zero[:]) == 1 {
+			return nil, errors.New("invalid public key: shared secret is zero")
+		}
+		return dst[:], nil
+	default:
+		return nil, errors.Errorf("unsupported key type '%T'", priv)
+	}
+}
+
+// DeriveKey uses HKDF (RFC 5869) to derive a key of the given size from the
+// input keying material, salt, and context info.
+func DeriveKey(h func() hash.Hash, secret, salt, info []byte, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, errors.Errorf("invalid key size %d", size)
+	}
+	key := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(h, secret, salt, info), key); err != nil {
+		return nil, errors.Wrap(err, "error deriving key")
+	}
+	return key, nil
+}
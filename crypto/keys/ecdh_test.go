@@ -0,0 +1,71 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/curve25519"
+)
+
+func TestSharedSecret(t *testing.T) {
+	// EC keys
+	alice, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	bob, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+
+	s1, err := SharedSecret(alice, &bob.PublicKey)
+	assert.FatalError(t, err)
+	s2, err := SharedSecret(bob, &alice.PublicKey)
+	assert.FatalError(t, err)
+	assert.Equals(t, s1, s2)
+	assert.Equals(t, 32, len(s1))
+
+	_, err = SharedSecret(alice, &other.PublicKey)
+	assert.Error(t, err)
+
+	// X25519 keys
+	var a, b, aPub, bPub [32]byte
+	_, err = rand.Read(a[:])
+	assert.FatalError(t, err)
+	_, err = rand.Read(b[:])
+	assert.FatalError(t, err)
+	curve25519.ScalarBaseMult(&aPub, &a)
+	curve25519.ScalarBaseMult(&bPub, &b)
+
+	s1, err = SharedSecret(a[:], bPub[:])
+	assert.FatalError(t, err)
+	s2, err = SharedSecret(b[:], aPub[:])
+	assert.FatalError(t, err)
+	assert.Equals(t, s1, s2)
+
+	_, err = SharedSecret(a[:], make([]byte, 32))
+	assert.Error(t, err)
+	_, err = SharedSecret(a[:16], bPub[:])
+	assert.Error(t, err)
+	_, err = SharedSecret(a[:], &bob.PublicKey)
+	assert.Error(t, err)
+	_, err = SharedSecret("foo", bPub[:])
+	assert.Error(t, err)
+}
+
+func TestDeriveKey(t *testing.T) {
+	secret := []byte("the shared secret")
+	k1, err := DeriveKey(sha256.New, secret, []byte("salt"), []byte("info"), 32)
+	assert.FatalError(t, err)
+	assert.Equals(t, 32, len(k1))
+
+	k2, err := DeriveKey(sha256.New, secret, []byte("salt"), []byte("other info"), 32)
+	assert.FatalError(t, err)
+	assert.False(t, bytes.Equal(k1, k2))
+
+	_, err = DeriveKey(sha256.New, secret, nil, nil, 0)
+	assert.Error(t, err)
+}
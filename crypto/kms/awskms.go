@@ -0,0 +1,133 @@
+// +build awskms
+
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	cloudSigners[AWSScheme] = newAWSSigner
+}
+
+// awsSigner implements a crypto.Signer using a key in AWS KMS.
+type awsSigner struct {
+	client *kms.Client
+	keyID  string
+	public crypto.PublicKey
+}
+
+func newAWSSigner(ctx context.Context, rawuri string) (crypto.Signer, error) {
+	u, err := parseAWSURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []func(*config.LoadOptions) error
+	if u.Region != "" {
+		opts = append(opts, config.WithRegion(u.Region))
+	}
+	if u.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(u.Profile))
+	}
+	if u.CredentialsFile != "" {
+		opts = append(opts, config.WithSharedCredentialsFiles([]string{u.CredentialsFile}))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading AWS configuration")
+	}
+
+	client := kms.NewFromConfig(cfg)
+	resp, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
+		KeyId: aws.String(u.KeyID),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting public key of %s", u.KeyID)
+	}
+	if resp.KeyUsage != types.KeyUsageTypeSignVerify {
+		return nil, errors.Errorf("error using %s: key usage %s is not SIGN_VERIFY", u.KeyID, resp.KeyUsage)
+	}
+	pub, err := x509.ParsePKIXPublicKey(resp.PublicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing public key of %s", u.KeyID)
+	}
+	return &awsSigner{
+		client: client,
+		keyID:  u.KeyID,
+		public: pub,
+	}, nil
+}
+
+// Public returns the public key of the signer.
+func (s *awsSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs the given digest using the key in AWS KMS. ECDSA signatures are
+// returned in ASN.1 format.
+func (s *awsSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	alg, err := awsSigningAlgorithm(s.public, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Sign(context.Background(), &kms.SignInput{
+		KeyId:            aws.String(s.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: alg,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error signing with %s", s.keyID)
+	}
+	return resp.Signature, nil
+}
+
+// awsSigningAlgorithm returns the AWS KMS signing algorithm for the given key
+// and signer options.
+func awsSigningAlgorithm(pub crypto.PublicKey, opts crypto.SignerOpts) (types.SigningAlgorithmSpec, error) {
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		switch opts.HashFunc() {
+		case crypto.SHA256:
+			return types.SigningAlgorithmSpecEcdsaSha256, nil
+		case crypto.SHA384:
+			return types.SigningAlgorithmSpecEcdsaSha384, nil
+		case crypto.SHA512:
+			return types.SigningAlgorithmSpecEcdsaSha512, nil
+		}
+	case *rsa.PublicKey:
+		pss := isPSS(opts)
+		switch opts.HashFunc() {
+		case crypto.SHA256:
+			if pss {
+				return types.SigningAlgorithmSpecRsassaPssSha256, nil
+			}
+			return types.SigningAlgorithmSpecRsassaPkcs1V15Sha256, nil
+		case crypto.SHA384:
+			if pss {
+				return types.SigningAlgorithmSpecRsassaPssSha384, nil
+			}
+			return types.SigningAlgorithmSpecRsassaPkcs1V15Sha384, nil
+		case crypto.SHA512:
+			if pss {
+				return types.SigningAlgorithmSpecRsassaPssSha512, nil
+			}
+			return types.SigningAlgorithmSpecRsassaPkcs1V15Sha512, nil
+		}
+	default:
+		return "", errors.Errorf("unsupported public key type %T", pub)
+	}
+	return "", errors.Errorf("unsupported hash function %v", opts.HashFunc())
+}
@@ -0,0 +1,49 @@
+// +build awskms
+
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/smallstep/assert"
+)
+
+func TestAWSSigningAlgorithm(t *testing.T) {
+	ec := &ecdsa.PublicKey{Curve: elliptic.P256()}
+	rsaKey := &rsa.PublicKey{}
+	pss := func(h crypto.Hash) crypto.SignerOpts {
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}
+	}
+	tests := map[string]struct {
+		pub  crypto.PublicKey
+		opts crypto.SignerOpts
+		want types.SigningAlgorithmSpec
+		err  bool
+	}{
+		"ES256":     {ec, crypto.SHA256, types.SigningAlgorithmSpecEcdsaSha256, false},
+		"ES384":     {ec, crypto.SHA384, types.SigningAlgorithmSpecEcdsaSha384, false},
+		"ES512":     {ec, crypto.SHA512, types.SigningAlgorithmSpecEcdsaSha512, false},
+		"RS256":     {rsaKey, crypto.SHA256, types.SigningAlgorithmSpecRsassaPkcs1V15Sha256, false},
+		"RS512":     {rsaKey, crypto.SHA512, types.SigningAlgorithmSpecRsassaPkcs1V15Sha512, false},
+		"PS256":     {rsaKey, pss(crypto.SHA256), types.SigningAlgorithmSpecRsassaPssSha256, false},
+		"PS384":     {rsaKey, pss(crypto.SHA384), types.SigningAlgorithmSpecRsassaPssSha384, false},
+		"fail hash": {ec, crypto.SHA1, "", true},
+		"fail key":  {[]byte("foo"), crypto.SHA256, "", true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := awsSigningAlgorithm(tc.pub, tc.opts)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// +build azurekms
+
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"io"
+	"math/big"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	cloudSigners[AzureScheme] = newAzureSigner
+}
+
+// azureSigner implements a crypto.Signer using a key in Azure Key Vault.
+type azureSigner struct {
+	client  *azkeys.Client
+	name    string
+	version string
+	public  crypto.PublicKey
+}
+
+func newAzureSigner(ctx context.Context, rawuri string) (crypto.Signer, error) {
+	u, err := parseAzureURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading Azure credentials")
+	}
+	client, err := azkeys.NewClient(u.VaultURL(), cred, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating Azure Key Vault client")
+	}
+
+	resp, err := client.GetKey(ctx, u.Name, u.Version, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting key %s", u.Name)
+	}
+	if resp.Key == nil {
+		return nil, errors.Errorf("error getting key %s: key is empty", u.Name)
+	}
+	pub, err := parseAzureKey(resp.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing public key of %s", u.Name)
+	}
+	// Pin the version, so the signatures always match the public key.
+	version := u.Version
+	if version == "" && resp.Key.KID != nil {
+		version = resp.Key.KID.Version()
+	}
+	return &azureSigner{
+		client:  client,
+		name:    u.Name,
+		version: version,
+		public:  pub,
+	}, nil
+}
+
+// Public returns the public key of the signer.
+func (s *azureSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs the given digest using the key in Azure Key Vault. ECDSA
+// signatures are returned in ASN.1 format.
+func (s *azureSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	alg, err := azureSignatureAlgorithm(s.public, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Sign(context.Background(), s.name, s.version, azkeys.SignParameters{
+		Algorithm: &alg,
+		Value:     digest,
+	}, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error signing with %s", s.name)
+	}
+	// Azure Key Vault returns the JWS format (r || s) for ECDSA
+	if _, ok := s.public.(*ecdsa.PublicKey); ok {
+		return ecdsaSignature(resp.Result)
+	}
+	return resp.Result, nil
+}
+
+// parseAzureKey returns the public key in the given JSON Web Key.
+func parseAzureKey(jwk *azkeys.JSONWebKey) (crypto.PublicKey, error) {
+	if jwk.Kty == nil {
+		return nil, errors.New("key type is missing")
+	}
+	switch *jwk.Kty {
+	case azkeys.KeyTypeEC, azkeys.KeyTypeECHSM:
+		var curve elliptic.Curve
+		switch {
+		case jwk.Crv == nil:
+			return nil, errors.New("curve is missing")
+		case *jwk.Crv == azkeys.CurveNameP256:
+			curve = elliptic.P256()
+		case *jwk.Crv == azkeys.CurveNameP384:
+			curve = elliptic.P384()
+		case *jwk.Crv == azkeys.CurveNameP521:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %s", *jwk.Crv)
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(jwk.X),
+			Y:     new(big.Int).SetBytes(jwk.Y),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("invalid point")
+		}
+		return pub, nil
+	case azkeys.KeyTypeRSA, azkeys.KeyTypeRSAHSM:
+		if len(jwk.N) == 0 || len(jwk.E) == 0 || len(jwk.E) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(jwk.N),
+			E: int(new(big.Int).SetBytes(jwk.E).Int64()),
+		}, nil
+	default:
+		return nil, errors.Errorf("unsupported key type %s", *jwk.Kty)
+	}
+}
+
+// azureSignatureAlgorithm returns the Azure Key Vault signature algorithm for
+// the given key and signer options.
+func azureSignatureAlgorithm(pub crypto.PublicKey, opts crypto.SignerOpts) (azkeys.SignatureAlgorithm, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		// Azure Key Vault requires the hash that matches the curve
+		var alg azkeys.SignatureAlgorithm
+		var hash crypto.Hash
+		switch k.Curve {
+		case elliptic.P256():
+			alg, hash = azkeys.SignatureAlgorithmES256, crypto.SHA256
+		case elliptic.P384():
+			alg, hash = azkeys.SignatureAlgorithmES384, crypto.SHA384
+		case elliptic.P521():
+			alg, hash = azkeys.SignatureAlgorithmES512, crypto.SHA512
+		default:
+			return "", errors.New("unsupported curve")
+		}
+		if opts.HashFunc() != hash {
+			return "", errors.Errorf("unsupported hash function %v for %s", opts.HashFunc(), alg)
+		}
+		return alg, nil
+	case *rsa.PublicKey:
+		pss := isPSS(opts)
+		switch opts.HashFunc() {
+		case crypto.SHA256:
+			if pss {
+				return azkeys.SignatureAlgorithmPS256, nil
+			}
+			return azkeys.SignatureAlgorithmRS256, nil
+		case crypto.SHA384:
+			if pss {
+				return azkeys.SignatureAlgorithmPS384, nil
+			}
+			return azkeys.SignatureAlgorithmRS384, nil
+		case crypto.SHA512:
+			if pss {
+				return azkeys.SignatureAlgorithmPS512, nil
+			}
+			return azkeys.SignatureAlgorithmRS512, nil
+		}
+		return "", errors.Errorf("unsupported hash function %v", opts.HashFunc())
+	default:
+		return "", errors.Errorf("unsupported public key type %T", pub)
+	}
+}
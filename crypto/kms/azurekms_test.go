@@ -0,0 +1,76 @@
+// +build azurekms
+
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+	"github.com/smallstep/assert"
+)
+
+func TestAzureSignatureAlgorithm(t *testing.T) {
+	rsaKey := &rsa.PublicKey{}
+	tests := map[string]struct {
+		pub  crypto.PublicKey
+		opts crypto.SignerOpts
+		want azkeys.SignatureAlgorithm
+		err  bool
+	}{
+		"ES256":      {&ecdsa.PublicKey{Curve: elliptic.P256()}, crypto.SHA256, azkeys.SignatureAlgorithmES256, false},
+		"ES384":      {&ecdsa.PublicKey{Curve: elliptic.P384()}, crypto.SHA384, azkeys.SignatureAlgorithmES384, false},
+		"ES512":      {&ecdsa.PublicKey{Curve: elliptic.P521()}, crypto.SHA512, azkeys.SignatureAlgorithmES512, false},
+		"RS384":      {rsaKey, crypto.SHA384, azkeys.SignatureAlgorithmRS384, false},
+		"PS256":      {rsaKey, &rsa.PSSOptions{Hash: crypto.SHA256}, azkeys.SignatureAlgorithmPS256, false},
+		"fail curve": {&ecdsa.PublicKey{Curve: elliptic.P224()}, crypto.SHA256, "", true},
+		"fail hash":  {&ecdsa.PublicKey{Curve: elliptic.P256()}, crypto.SHA384, "", true},
+		"fail rsa":   {rsaKey, crypto.SHA1, "", true},
+		"fail key":   {[]byte("foo"), crypto.SHA256, "", true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := azureSignatureAlgorithm(tc.pub, tc.opts)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseAzureKey(t *testing.T) {
+	ec, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+	kty, crv := azkeys.KeyTypeECHSM, azkeys.CurveNameP384
+	pub, err := parseAzureKey(&azkeys.JSONWebKey{Kty: &kty, Crv: &crv, X: ec.X.Bytes(), Y: ec.Y.Bytes()})
+	assert.FatalError(t, err)
+	assert.Equals(t, &ec.PublicKey, pub)
+
+	_, err = parseAzureKey(&azkeys.JSONWebKey{Kty: &kty, Crv: &crv, X: ec.Y.Bytes(), Y: ec.X.Bytes()})
+	assert.Error(t, err)
+	_, err = parseAzureKey(&azkeys.JSONWebKey{Kty: &kty})
+	assert.Error(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	kty = azkeys.KeyTypeRSA
+	pub, err = parseAzureKey(&azkeys.JSONWebKey{Kty: &kty, N: key.N.Bytes(), E: big.NewInt(int64(key.E)).Bytes()})
+	assert.FatalError(t, err)
+	assert.Equals(t, &key.PublicKey, pub)
+
+	_, err = parseAzureKey(&azkeys.JSONWebKey{Kty: &kty})
+	assert.Error(t, err)
+	kty = azkeys.KeyTypeOct
+	_, err = parseAzureKey(&azkeys.JSONWebKey{Kty: &kty})
+	assert.Error(t, err)
+	_, err = parseAzureKey(&azkeys.JSONWebKey{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,212 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// cloudSigners are the functions that create a signer for the URIs of each
+// supported cloud KMS, indexed by scheme. The SDKs of the cloud providers are
+// only included with the build tag of each KMS, awskms, cloudkms or azurekms,
+// and they replace the default functions on init.
+var cloudSigners = map[string]func(ctx context.Context, rawuri string) (crypto.Signer, error){
+	AWSScheme:      unsupportedCloudSigner("AWS KMS", AWSScheme),
+	CloudKMSScheme: unsupportedCloudSigner("Google Cloud KMS", CloudKMSScheme),
+	AzureScheme:    unsupportedCloudSigner("Azure Key Vault", AzureScheme),
+}
+
+// unsupportedCloudSigner returns a function that fails because step was
+// compiled without the given build tag.
+func unsupportedCloudSigner(name, tag string) func(ctx context.Context, rawuri string) (crypto.Signer, error) {
+	return func(ctx context.Context, rawuri string) (crypto.Signer, error) {
+		return nil, errors.Errorf("%s is not supported: step was compiled without the %s build tag", name, tag)
+	}
+}
+
+// cloudScheme returns the scheme of the given cloud KMS URI, it returns an
+// empty string if the name is not the URI of a supported cloud KMS.
+func cloudScheme(name string) string {
+	for scheme := range cloudSigners {
+		if hasScheme(name, scheme) {
+			return scheme
+		}
+	}
+	return ""
+}
+
+// newCloudSigner returns a crypto.Signer using the key in the given cloud KMS
+// URI.
+func newCloudSigner(scheme, rawuri string) (crypto.Signer, error) {
+	return cloudSigners[scheme](context.Background(), rawuri)
+}
+
+// parseCloudURI returns the attributes of the given cloud KMS URI, e.g:
+//
+//	awskms:key-id=alias/step;region=us-east-1
+//
+// Attributes are separated by semicolons and their values are
+// percent-encoded. Only the given attribute names are allowed.
+func parseCloudURI(rawuri, scheme string, names ...string) (map[string]string, error) {
+	if !hasScheme(rawuri, scheme) {
+		return nil, errors.Errorf("error parsing %s: scheme is not %s", rawuri, scheme)
+	}
+	attrs := make(map[string]string)
+	for _, attr := range splitAttributes(rawuri[len(scheme)+1:], ";") {
+		name, value, err := parseAttribute(attr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", rawuri)
+		}
+		if !contains(names, name) {
+			return nil, errors.Errorf("error parsing %s: unsupported attribute '%s'", rawuri, name)
+		}
+		attrs[name] = value
+	}
+	return attrs, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isPSS returns true if the given options are RSA-PSS options.
+func isPSS(opts crypto.SignerOpts) bool {
+	_, ok := opts.(*rsa.PSSOptions)
+	return ok
+}
+
+// addCloser registers a client that will be closed with Close.
+func addCloser(c io.Closer) {
+	managersMu.Lock()
+	closers = append(closers, c)
+	managersMu.Unlock()
+}
+
+// AWSScheme is the scheme of the URIs of the keys in AWS KMS.
+const AWSScheme = "awskms"
+
+// awsURI identifies a key in AWS KMS, e.g:
+//
+//	awskms:key-id=arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab
+//	awskms:key-id=alias/step;region=us-east-1;profile=step
+//
+// The region, profile and credentials-file attributes are optional, by default
+// they are loaded from the environment and the shared AWS configuration.
+type awsURI struct {
+	KeyID           string
+	Region          string
+	Profile         string
+	CredentialsFile string
+}
+
+func parseAWSURI(rawuri string) (*awsURI, error) {
+	attrs, err := parseCloudURI(rawuri, AWSScheme, "key-id", "region", "profile", "credentials-file")
+	if err != nil {
+		return nil, err
+	}
+	u := &awsURI{
+		KeyID:           attrs["key-id"],
+		Region:          attrs["region"],
+		Profile:         attrs["profile"],
+		CredentialsFile: attrs["credentials-file"],
+	}
+	if u.KeyID == "" {
+		return nil, errors.Errorf("error parsing %s: key-id is required", rawuri)
+	}
+	return u, nil
+}
+
+// CloudKMSScheme is the scheme of the URIs of the keys in Google Cloud KMS.
+const CloudKMSScheme = "cloudkms"
+
+// cloudKMSURI identifies a key version in Google Cloud KMS, e.g:
+//
+//	cloudkms:name=projects/my-project/locations/global/keyRings/step/cryptoKeys/intermediate/cryptoKeyVersions/1
+//
+// The credentials-file attribute is optional, by default the application
+// default credentials are used.
+type cloudKMSURI struct {
+	Name            string
+	CredentialsFile string
+}
+
+func parseCloudKMSURI(rawuri string) (*cloudKMSURI, error) {
+	attrs, err := parseCloudURI(rawuri, CloudKMSScheme, "name", "credentials-file")
+	if err != nil {
+		return nil, err
+	}
+	u := &cloudKMSURI{
+		Name:            attrs["name"],
+		CredentialsFile: attrs["credentials-file"],
+	}
+	if u.Name == "" {
+		return nil, errors.Errorf("error parsing %s: name is required", rawuri)
+	}
+	return u, nil
+}
+
+// AzureScheme is the scheme of the URIs of the keys in Azure Key Vault.
+const AzureScheme = "azurekms"
+
+// azureURI identifies a key in Azure Key Vault, e.g:
+//
+//	azurekms:vault=my-vault;name=intermediate-key
+//	azurekms:vault=my-vault.vault.azure.net;name=intermediate-key;version=0123456789abcdef
+//
+// The vault is the name or the host of the key vault, if the version is not
+// set the current version of the key is used. The credentials are loaded from
+// the environment, a managed identity or the Azure CLI.
+type azureURI struct {
+	Vault   string
+	Name    string
+	Version string
+}
+
+func parseAzureURI(rawuri string) (*azureURI, error) {
+	attrs, err := parseCloudURI(rawuri, AzureScheme, "vault", "name", "version")
+	if err != nil {
+		return nil, err
+	}
+	u := &azureURI{
+		Vault:   attrs["vault"],
+		Name:    attrs["name"],
+		Version: attrs["version"],
+	}
+	switch {
+	case u.Vault == "":
+		return nil, errors.Errorf("error parsing %s: vault is required", rawuri)
+	case u.Name == "":
+		return nil, errors.Errorf("error parsing %s: name is required", rawuri)
+	}
+	return u, nil
+}
+
+// VaultURL returns the URL of the key vault.
+func (u *azureURI) VaultURL() string {
+	if strings.Contains(u.Vault, ".") {
+		return "https://" + u.Vault + "/"
+	}
+	return "https://" + u.Vault + ".vault.azure.net/"
+}
+
+// ecdsaSignature converts a signature in JWS format (r || s) to ASN.1.
+func ecdsaSignature(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, errors.New("error parsing ECDSA signature: invalid length")
+	}
+	n := len(raw) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{new(big.Int).SetBytes(raw[:n]), new(big.Int).SetBytes(raw[n:])})
+}
@@ -0,0 +1,106 @@
+package kms
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestParseCloudURI(t *testing.T) {
+	tests := map[string]struct {
+		uri  string
+		want interface{}
+		err  string
+	}{
+		"ok aws": {
+			uri:  "awskms:key-id=arn:aws:kms:us-east-1:123456789012:key/1234abcd",
+			want: &awsURI{KeyID: "arn:aws:kms:us-east-1:123456789012:key/1234abcd"},
+		},
+		"ok aws all": {
+			uri:  "AWSKMS:key-id=alias/step;region=us-west-2;profile=step;credentials-file=/home/step/.aws/credentials",
+			want: &awsURI{KeyID: "alias/step", Region: "us-west-2", Profile: "step", CredentialsFile: "/home/step/.aws/credentials"},
+		},
+		"ok cloudkms": {
+			uri:  "cloudkms:name=projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1;credentials-file=sa.json",
+			want: &cloudKMSURI{Name: "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", CredentialsFile: "sa.json"},
+		},
+		"ok azure": {
+			uri:  "azurekms:;vault=my-vault;name=My%20Key;;version=0123",
+			want: &azureURI{Vault: "my-vault", Name: "My Key", Version: "0123"},
+		},
+		"fail aws key-id":     {uri: "awskms:region=us-east-1", err: "error parsing awskms:region=us-east-1: key-id is required"},
+		"fail aws attribute":  {uri: "awskms:key-id=foo;name=bar", err: "error parsing awskms:key-id=foo;name=bar: unsupported attribute 'name'"},
+		"fail aws escape":     {uri: "awskms:key-id=%zz", err: "error parsing awskms:key-id=%zz: invalid attribute 'key-id=%zz'"},
+		"fail cloudkms name":  {uri: "cloudkms:credentials-file=sa.json", err: "error parsing cloudkms:credentials-file=sa.json: name is required"},
+		"fail cloudkms value": {uri: "cloudkms:name", err: "error parsing cloudkms:name: invalid attribute 'name'"},
+		"fail azure vault":    {uri: "azurekms:name=key", err: "error parsing azurekms:name=key: vault is required"},
+		"fail azure name":     {uri: "azurekms:vault=my-vault", err: "error parsing azurekms:vault=my-vault: name is required"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got interface{}
+			var err error
+			switch cloudScheme(tc.uri) {
+			case AWSScheme:
+				got, err = parseAWSURI(tc.uri)
+			case CloudKMSScheme:
+				got, err = parseCloudKMSURI(tc.uri)
+			case AzureScheme:
+				got, err = parseAzureURI(tc.uri)
+			default:
+				t.Fatalf("unexpected scheme in %s", tc.uri)
+			}
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Equals(t, tc.err, err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+
+	_, err := parseAWSURI("azurekms:vault=v;name=k")
+	if assert.Error(t, err) {
+		assert.Equals(t, "error parsing azurekms:vault=v;name=k: scheme is not awskms", err.Error())
+	}
+}
+
+func TestAzureURI_VaultURL(t *testing.T) {
+	assert.Equals(t, "https://my-vault.vault.azure.net/", (&azureURI{Vault: "my-vault"}).VaultURL())
+	assert.Equals(t, "https://my-vault.vault.azure.cn/", (&azureURI{Vault: "my-vault.vault.azure.cn"}).VaultURL())
+}
+
+func TestECDSASignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	digest := sha256.Sum256([]byte("message"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	assert.FatalError(t, err)
+
+	raw := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(raw[32-len(rb):32], rb)
+	copy(raw[64-len(sb):], sb)
+	sig, err := ecdsaSignature(raw)
+	assert.FatalError(t, err)
+
+	var got struct {
+		R, S *big.Int
+	}
+	_, err = asn1.Unmarshal(sig, &got)
+	assert.FatalError(t, err)
+	assert.True(t, ecdsa.Verify(&key.PublicKey, digest[:], got.R, got.S))
+
+	_, err = ecdsaSignature([]byte{1, 2, 3})
+	assert.Error(t, err)
+	_, err = ecdsaSignature(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+// +build cloudkms
+
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+
+	cloudkms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+)
+
+func init() {
+	cloudSigners[CloudKMSScheme] = newCloudKMSSigner
+}
+
+// cloudKMSAlgorithm is the hash and padding used by an asymmetric signing
+// algorithm in Google Cloud KMS.
+type cloudKMSAlgorithm struct {
+	hash crypto.Hash
+	pss  bool
+}
+
+var cloudKMSAlgorithms = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]cloudKMSAlgorithm{
+	kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256:        {crypto.SHA256, false},
+	kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384:        {crypto.SHA384, false},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256: {crypto.SHA256, false},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256: {crypto.SHA256, false},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256: {crypto.SHA256, false},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512: {crypto.SHA512, false},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256:   {crypto.SHA256, true},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256:   {crypto.SHA256, true},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256:   {crypto.SHA256, true},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512:   {crypto.SHA512, true},
+}
+
+// cloudKMSSigner implements a crypto.Signer using a key version in Google
+// Cloud KMS.
+type cloudKMSSigner struct {
+	client    *cloudkms.KeyManagementClient
+	name      string
+	algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+	public    crypto.PublicKey
+}
+
+func newCloudKMSSigner(ctx context.Context, rawuri string) (crypto.Signer, error) {
+	u, err := parseCloudKMSURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []option.ClientOption
+	if u.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(u.CredentialsFile))
+	}
+	client, err := cloudkms.NewKeyManagementClient(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating Google Cloud KMS client")
+	}
+	addCloser(client)
+
+	resp, err := client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{
+		Name: u.Name,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting public key of %s", u.Name)
+	}
+	if _, ok := cloudKMSAlgorithms[resp.GetAlgorithm()]; !ok {
+		return nil, errors.Errorf("error using %s: unsupported algorithm %s", u.Name, resp.GetAlgorithm())
+	}
+	block, _ := pem.Decode([]byte(resp.GetPem()))
+	if block == nil {
+		return nil, errors.Errorf("error parsing public key of %s: invalid PEM", u.Name)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing public key of %s", u.Name)
+	}
+	return &cloudKMSSigner{
+		client:    client,
+		name:      u.Name,
+		algorithm: resp.GetAlgorithm(),
+		public:    pub,
+	}, nil
+}
+
+// Public returns the public key of the signer.
+func (s *cloudKMSSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs the given digest using the key version in Google Cloud KMS. The
+// hash and padding in the options must match the algorithm of the key.
+// ECDSA signatures are returned in ASN.1 format.
+func (s *cloudKMSSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	d, err := cloudKMSDigest(s.algorithm, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.AsymmetricSign(context.Background(), &kmspb.AsymmetricSignRequest{
+		Name:   s.name,
+		Digest: d,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error signing with %s", s.name)
+	}
+	return resp.GetSignature(), nil
+}
+
+// cloudKMSDigest returns the digest of a sign request using the given
+// algorithm. It fails if the options do not match the algorithm.
+func cloudKMSDigest(alg kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm, digest []byte, opts crypto.SignerOpts) (*kmspb.Digest, error) {
+	a, ok := cloudKMSAlgorithms[alg]
+	if !ok {
+		return nil, errors.Errorf("unsupported algorithm %s", alg)
+	}
+	if a.hash != opts.HashFunc() || a.pss != isPSS(opts) {
+		return nil, errors.Errorf("the signing options do not match the algorithm %s", alg)
+	}
+	switch a.hash {
+	case crypto.SHA256:
+		return &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest}}, nil
+	case crypto.SHA384:
+		return &kmspb.Digest{Digest: &kmspb.Digest_Sha384{Sha384: digest}}, nil
+	default:
+		return &kmspb.Digest{Digest: &kmspb.Digest_Sha512{Sha512: digest}}, nil
+	}
+}
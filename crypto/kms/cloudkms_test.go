@@ -0,0 +1,30 @@
+// +build cloudkms
+
+package kms
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"testing"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/smallstep/assert"
+)
+
+func TestCloudKMSDigest(t *testing.T) {
+	digest := []byte("digest")
+	d, err := cloudKMSDigest(kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384, digest, crypto.SHA384)
+	assert.FatalError(t, err)
+	assert.Equals(t, digest, d.GetSha384())
+
+	d, err = cloudKMSDigest(kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512, digest, &rsa.PSSOptions{Hash: crypto.SHA512})
+	assert.FatalError(t, err)
+	assert.Equals(t, digest, d.GetSha512())
+
+	_, err = cloudKMSDigest(kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256, digest, crypto.SHA256)
+	assert.Error(t, err)
+	_, err = cloudKMSDigest(kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, digest, crypto.SHA384)
+	assert.Error(t, err)
+	_, err = cloudKMSDigest(kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION, digest, crypto.SHA256)
+	assert.Error(t, err)
+}
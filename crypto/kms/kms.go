@@ -0,0 +1,105 @@
+// Package kms implements the access to private keys stored in key management
+// systems, like HSMs using PKCS #11 URIs, or AWS KMS, Google Cloud KMS and
+// Azure Key Vault. The private keys never leave the key management system,
+// they are used through a crypto.Signer.
+//
+// PKCS #11 requires cgo and the pkcs11 build tag, and each cloud KMS requires
+// its own build tag, awskms, cloudkms or azurekms.
+package kms
+
+import (
+	"crypto"
+	"io"
+	"sync"
+)
+
+// KeyManager is the interface implemented by the key management systems.
+type KeyManager interface {
+	// GetPublicKey returns the public key of the key in the given URI.
+	GetPublicKey(u *URI) (crypto.PublicKey, error)
+	// CreateSigner returns a signer using the key in the given URI.
+	CreateSigner(u *URI) (crypto.Signer, error)
+	// Close releases the resources of the key manager.
+	Close() error
+}
+
+var (
+	managersMu sync.Mutex
+	managers   = make(map[string]KeyManager)
+	closers    []io.Closer
+)
+
+// New returns the key manager for the module of the given URI. Key managers
+// are shared, so the module is only initialized once.
+func New(u *URI) (KeyManager, error) {
+	managersMu.Lock()
+	defer managersMu.Unlock()
+	if km, ok := managers[u.ModulePath]; ok {
+		return km, nil
+	}
+	km, err := newPKCS11(u.ModulePath)
+	if err != nil {
+		return nil, err
+	}
+	managers[u.ModulePath] = km
+	return km, nil
+}
+
+// NewSigner returns a crypto.Signer using the key in the given PKCS #11 or
+// cloud KMS URI. PKCS #11 modules are kept loaded until the key managers are
+// closed with Close.
+func NewSigner(rawuri string) (crypto.Signer, error) {
+	if scheme := cloudScheme(rawuri); scheme != "" {
+		return newCloudSigner(scheme, rawuri)
+	}
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+	km, err := New(u)
+	if err != nil {
+		return nil, err
+	}
+	return km.CreateSigner(u)
+}
+
+// GetPublicKey returns the public key of the key in the given PKCS #11 or
+// cloud KMS URI.
+func GetPublicKey(rawuri string) (crypto.PublicKey, error) {
+	if scheme := cloudScheme(rawuri); scheme != "" {
+		signer, err := newCloudSigner(scheme, rawuri)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Public(), nil
+	}
+	u, err := ParseURI(rawuri)
+	if err != nil {
+		return nil, err
+	}
+	km, err := New(u)
+	if err != nil {
+		return nil, err
+	}
+	return km.GetPublicKey(u)
+}
+
+// Close closes all the key managers and cloud KMS clients in use.
+func Close() error {
+	managersMu.Lock()
+	defer managersMu.Unlock()
+	var err error
+	for path, km := range managers {
+		if e := km.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(managers, path)
+	}
+	for _, c := range closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	closers = nil
+	return err
+}
@@ -0,0 +1,353 @@
+// +build cgo,pkcs11
+
+package kms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+	"github.com/pkg/errors"
+)
+
+// PKCS11 is a KeyManager that uses the keys stored in the tokens of a PKCS #11
+// module.
+type PKCS11 struct {
+	mu       sync.Mutex
+	ctx      *pkcs11.Ctx
+	sessions map[uint]pkcs11.SessionHandle
+}
+
+func newPKCS11(modulePath string) (KeyManager, error) {
+	ctx := pkcs11.New(modulePath)
+	if ctx == nil {
+		return nil, errors.Errorf("error loading PKCS #11 module %s", modulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, errors.Wrapf(err, "error initializing PKCS #11 module %s", modulePath)
+	}
+	return &PKCS11{
+		ctx:      ctx,
+		sessions: make(map[uint]pkcs11.SessionHandle),
+	}, nil
+}
+
+// GetPublicKey returns the public key of the private key in the given URI.
+func (k *PKCS11) GetPublicKey(u *URI) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	session, err := k.session(u)
+	if err != nil {
+		return nil, err
+	}
+	key, err := k.findObject(session, pkcs11.CKO_PRIVATE_KEY, u)
+	if err != nil {
+		return nil, err
+	}
+	return k.publicKey(session, key, u)
+}
+
+// CreateSigner returns a crypto.Signer that uses the private key in the given
+// URI.
+func (k *PKCS11) CreateSigner(u *URI) (crypto.Signer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	session, err := k.session(u)
+	if err != nil {
+		return nil, err
+	}
+	key, err := k.findObject(session, pkcs11.CKO_PRIVATE_KEY, u)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := k.publicKey(session, key, u)
+	if err != nil {
+		return nil, err
+	}
+	return &pkcs11Signer{
+		km:      k,
+		session: session,
+		key:     key,
+		pub:     pub,
+	}, nil
+}
+
+// Close closes the sessions and finalizes the module.
+func (k *PKCS11) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for slot, session := range k.sessions {
+		k.ctx.Logout(session)
+		k.ctx.CloseSession(session)
+		delete(k.sessions, slot)
+	}
+	err := k.ctx.Finalize()
+	k.ctx.Destroy()
+	return errors.Wrap(err, "error finalizing PKCS #11 module")
+}
+
+// session returns a logged in session for the token in the given URI.
+func (k *PKCS11) session(u *URI) (pkcs11.SessionHandle, error) {
+	slot, err := k.findSlot(u)
+	if err != nil {
+		return 0, err
+	}
+	if session, ok := k.sessions[slot]; ok {
+		return session, nil
+	}
+
+	session, err := k.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return 0, errors.Wrap(err, "error opening PKCS #11 session")
+	}
+	pin, err := u.Pin()
+	if err != nil {
+		k.ctx.CloseSession(session)
+		return 0, err
+	}
+	if pin != "" {
+		if err := k.ctx.Login(session, pkcs11.CKU_USER, pin); err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			k.ctx.CloseSession(session)
+			return 0, errors.Wrap(err, "error logging in into the PKCS #11 token")
+		}
+	}
+	k.sessions[slot] = session
+	return session, nil
+}
+
+// findSlot returns the slot with the token in the given URI.
+func (k *PKCS11) findSlot(u *URI) (uint, error) {
+	slots, err := k.ctx.GetSlotList(true)
+	if err != nil {
+		return 0, errors.Wrap(err, "error listing PKCS #11 slots")
+	}
+	for _, slot := range slots {
+		if u.SlotID >= 0 && slot != uint(u.SlotID) {
+			continue
+		}
+		info, err := k.ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, errors.Wrap(err, "error getting PKCS #11 token info")
+		}
+		if u.Token != "" && strings.TrimRight(info.Label, " \x00") != u.Token {
+			continue
+		}
+		if u.Serial != "" && strings.TrimRight(info.SerialNumber, " \x00") != u.Serial {
+			continue
+		}
+		return slot, nil
+	}
+	return 0, errors.New("error finding PKCS #11 token: token not found")
+}
+
+// findObject returns the object of the given class with the label and id in
+// the URI.
+func (k *PKCS11) findObject(session pkcs11.SessionHandle, class uint, u *URI) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+	}
+	if u.Object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, u.Object))
+	}
+	if len(u.ID) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, u.ID))
+	}
+
+	if err := k.ctx.FindObjectsInit(session, template); err != nil {
+		return 0, errors.Wrap(err, "error finding PKCS #11 objects")
+	}
+	objects, _, err := k.ctx.FindObjects(session, 2)
+	if e := k.ctx.FindObjectsFinal(session); err == nil {
+		err = e
+	}
+	switch {
+	case err != nil:
+		return 0, errors.Wrap(err, "error finding PKCS #11 objects")
+	case len(objects) == 0:
+		return 0, errors.New("error finding PKCS #11 objects: object not found")
+	case len(objects) > 1:
+		return 0, errors.New("error finding PKCS #11 objects: multiple objects found")
+	default:
+		return objects[0], nil
+	}
+}
+
+// publicKey returns the public key of the given private key. It uses the
+// public key object or the certificate with the same label and id.
+func (k *PKCS11) publicKey(session pkcs11.SessionHandle, key pkcs11.ObjectHandle, u *URI) (crypto.PublicKey, error) {
+	attrs, err := k.ctx.GetAttributeValue(session, key, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting PKCS #11 key type")
+	}
+
+	keyType := attrs[0].Value
+	switch {
+	case isKeyType(keyType, pkcs11.CKK_RSA):
+		attrs, err := k.ctx.GetAttributeValue(session, key, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting PKCS #11 RSA public key")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}, nil
+	case isKeyType(keyType, pkcs11.CKK_EC):
+		if pub, err := k.findObject(session, pkcs11.CKO_PUBLIC_KEY, u); err == nil {
+			attrs, err := k.ctx.GetAttributeValue(session, pub, []*pkcs11.Attribute{
+				pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+				pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, "error getting PKCS #11 EC public key")
+			}
+			return parseECPublicKey(attrs[0].Value, attrs[1].Value)
+		}
+		if crt, err := k.findObject(session, pkcs11.CKO_CERTIFICATE, u); err == nil {
+			attrs, err := k.ctx.GetAttributeValue(session, crt, []*pkcs11.Attribute{
+				pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil),
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, "error getting PKCS #11 certificate")
+			}
+			cert, err := x509.ParseCertificate(attrs[0].Value)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing PKCS #11 certificate")
+			}
+			return cert.PublicKey, nil
+		}
+		return nil, errors.New("error getting PKCS #11 EC public key: public key or certificate not found")
+	default:
+		return nil, errors.New("error getting PKCS #11 public key: unsupported key type")
+	}
+}
+
+var (
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidNamedCurveP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// pkcs11Signer implements a crypto.Signer using a PKCS #11 private key.
+type pkcs11Signer struct {
+	km      *PKCS11
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	pub     crypto.PublicKey
+}
+
+// Public returns the public key of the signer.
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs the digest with the private key in the PKCS #11 token. ECDSA
+// signatures are returned ASN.1 encoded as in crypto/ecdsa.
+func (s *pkcs11Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mechanism *pkcs11.Mechanism
+	switch s.pub.(type) {
+	case *ecdsa.PublicKey:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	case *rsa.PublicKey:
+		h, ok := rsaHashes[opts.HashFunc()]
+		if !ok {
+			return nil, errors.Errorf("unsupported hash function %v", opts.HashFunc())
+		}
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			saltLength := pss.SaltLength
+			if saltLength == rsa.PSSSaltLengthAuto || saltLength == rsa.PSSSaltLengthEqualsHash {
+				saltLength = opts.HashFunc().Size()
+			}
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, pkcs11.NewPSSParams(h.mechanism, h.mgf, uint(saltLength)))
+		} else {
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+			digest = append(append([]byte{}, h.prefix...), digest...)
+		}
+	default:
+		return nil, errors.Errorf("unsupported public key type %T", s.pub)
+	}
+
+	s.km.mu.Lock()
+	defer s.km.mu.Unlock()
+	if err := s.km.ctx.SignInit(s.session, []*pkcs11.Mechanism{mechanism}, s.key); err != nil {
+		return nil, errors.Wrap(err, "error signing with PKCS #11 key")
+	}
+	sig, err := s.km.ctx.Sign(s.session, digest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing with PKCS #11 key")
+	}
+
+	if _, ok := s.pub.(*ecdsa.PublicKey); ok {
+		// PKCS #11 returns r || s
+		n := len(sig) / 2
+		return asn1.Marshal(struct {
+			R, S *big.Int
+		}{new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:])})
+	}
+	return sig, nil
+}
+
+// rsaHashes contains the PKCS #11 parameters and the DigestInfo prefixes of
+// the supported hash functions.
+var rsaHashes = map[crypto.Hash]struct {
+	mechanism, mgf uint
+	prefix         []byte
+}{
+	crypto.SHA1:   {pkcs11.CKM_SHA_1, pkcs11.CKG_MGF1_SHA1, []byte{0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14}},
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384, []byte{0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30}},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512, []byte{0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40}},
+}
+
+// parseECPublicKey parses the CKA_EC_PARAMS and CKA_EC_POINT attributes of a
+// PKCS #11 EC public key.
+func parseECPublicKey(params, point []byte) (*ecdsa.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		return nil, errors.Wrap(err, "error parsing PKCS #11 EC parameters")
+	}
+	var curve elliptic.Curve
+	switch {
+	case oid.Equal(oidNamedCurveP256):
+		curve = elliptic.P256()
+	case oid.Equal(oidNamedCurveP384):
+		curve = elliptic.P384()
+	case oid.Equal(oidNamedCurveP521):
+		curve = elliptic.P521()
+	default:
+		return nil, errors.Errorf("unsupported PKCS #11 EC curve %s", oid)
+	}
+
+	// The point should be DER encoded, but some modules use the raw value
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err != nil || len(rest) > 0 {
+		raw = point
+	}
+	x, y := elliptic.Unmarshal(curve, raw)
+	if x == nil {
+		return nil, errors.New("error parsing PKCS #11 EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// isKeyType returns true if the value of a CKA_KEY_TYPE attribute is the given
+// key type. Attributes are encoded in the native byte order.
+func isKeyType(value []byte, keyType uint) bool {
+	return bytes.Equal(value, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, keyType).Value)
+}
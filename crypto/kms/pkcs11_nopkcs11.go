@@ -0,0 +1,9 @@
+// +build !cgo !pkcs11
+
+package kms
+
+import "github.com/pkg/errors"
+
+func newPKCS11(modulePath string) (KeyManager, error) {
+	return nil, errors.New("PKCS #11 is not supported: step was compiled without cgo or without the pkcs11 build tag")
+}
@@ -0,0 +1,162 @@
+package kms
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Scheme is the scheme of the PKCS #11 URIs.
+const Scheme = "pkcs11"
+
+// URI is a PKCS #11 URI as defined in RFC 7512, it identifies a key stored in
+// a token of a PKCS #11 module, e.g:
+//
+//	pkcs11:token=step;object=intermediate-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/run/pin.txt
+type URI struct {
+	// Token is the label of the token.
+	Token string
+	// Serial is the serial number of the token.
+	Serial string
+	// SlotID is the id of the slot, it is -1 if it is not set.
+	SlotID int
+	// Object is the label of the key.
+	Object string
+	// ID is the id of the key.
+	ID []byte
+	// ModulePath is the path of the PKCS #11 module.
+	ModulePath string
+	// PinValue is the PIN used to log in into the token.
+	PinValue string
+	// PinSource is the path of the file with the PIN used to log in into the
+	// token.
+	PinSource string
+}
+
+// IsURI returns true if the given name is a PKCS #11 URI or the URI of a key
+// in one of the supported cloud KMS.
+func IsURI(name string) bool {
+	return isPKCS11URI(name) || cloudScheme(name) != ""
+}
+
+// isPKCS11URI returns true if the given name is a PKCS #11 URI.
+func isPKCS11URI(name string) bool {
+	return hasScheme(name, Scheme)
+}
+
+// hasScheme returns true if the given name starts with the given scheme
+// followed by a colon, the comparison is case-insensitive.
+func hasScheme(name, scheme string) bool {
+	return strings.HasPrefix(strings.ToLower(name), scheme+":")
+}
+
+// ParseURI parses the given PKCS #11 URI.
+func ParseURI(rawuri string) (*URI, error) {
+	if !isPKCS11URI(rawuri) {
+		return nil, errors.Errorf("error parsing %s: not a PKCS #11 URI", rawuri)
+	}
+
+	opaque := rawuri[len(Scheme)+1:]
+	var query string
+	if i := strings.Index(opaque, "?"); i >= 0 {
+		opaque, query = opaque[:i], opaque[i+1:]
+	}
+	// pkcs11://token=... is a common mistake, be lenient
+	opaque = strings.TrimPrefix(opaque, "//")
+
+	u := &URI{SlotID: -1}
+	for _, attr := range splitAttributes(opaque, ";") {
+		name, value, err := parseAttribute(attr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", rawuri)
+		}
+		switch name {
+		case "token":
+			u.Token = value
+		case "serial":
+			u.Serial = value
+		case "slot-id":
+			if u.SlotID, err = strconv.Atoi(value); err != nil || u.SlotID < 0 {
+				return nil, errors.Errorf("error parsing %s: invalid slot-id '%s'", rawuri, value)
+			}
+		case "object":
+			u.Object = value
+		case "id":
+			u.ID = []byte(value)
+		case "type":
+			if value != "private" {
+				return nil, errors.Errorf("error parsing %s: unsupported type '%s'", rawuri, value)
+			}
+		default:
+			// Other attributes, like manufacturer or model, are not used to
+			// select the key.
+		}
+	}
+
+	for _, attr := range splitAttributes(query, "&") {
+		name, value, err := parseAttribute(attr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", rawuri)
+		}
+		switch name {
+		case "module-path":
+			u.ModulePath = value
+		case "pin-value":
+			u.PinValue = value
+		case "pin-source":
+			u.PinSource = strings.TrimPrefix(value, "file://")
+		}
+	}
+
+	switch {
+	case u.Object == "" && len(u.ID) == 0:
+		return nil, errors.Errorf("error parsing %s: object or id are required", rawuri)
+	case u.ModulePath == "":
+		return nil, errors.Errorf("error parsing %s: module-path is required", rawuri)
+	case u.PinValue != "" && u.PinSource != "":
+		return nil, errors.Errorf("error parsing %s: pin-value and pin-source are mutually exclusive", rawuri)
+	}
+	return u, nil
+}
+
+// Pin returns the PIN in the pin-value or pin-source attributes, it returns
+// an empty string if none of them are set.
+func (u *URI) Pin() (string, error) {
+	if u.PinSource != "" {
+		b, err := ioutil.ReadFile(u.PinSource)
+		if err != nil {
+			return "", errors.Wrapf(err, "error reading %s", u.PinSource)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return u.PinValue, nil
+}
+
+// splitAttributes splits s using the given separator, empty attributes are
+// ignored.
+func splitAttributes(s, sep string) []string {
+	var attrs []string
+	for _, attr := range strings.Split(s, sep) {
+		if attr != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// parseAttribute returns the name and the percent-decoded value of the given
+// attribute.
+func parseAttribute(attr string) (string, string, error) {
+	i := strings.Index(attr, "=")
+	if i < 1 {
+		return "", "", errors.Errorf("invalid attribute '%s'", attr)
+	}
+	value, err := url.PathUnescape(attr[i+1:])
+	if err != nil {
+		return "", "", errors.Errorf("invalid attribute '%s'", attr)
+	}
+	return strings.ToLower(attr[:i]), value, nil
+}
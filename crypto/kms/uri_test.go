@@ -0,0 +1,86 @@
+package kms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestIsURI(t *testing.T) {
+	assert.True(t, IsURI("pkcs11:token=step;object=key?module-path=/lib/p11.so"))
+	assert.True(t, IsURI("PKCS11:object=key"))
+	assert.False(t, IsURI("key.pem"))
+	assert.False(t, IsURI("/tmp/pkcs11:key"))
+	assert.True(t, IsURI("awskms:key-id=alias/step"))
+	assert.True(t, IsURI("cloudkms:name=projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"))
+	assert.True(t, IsURI("AzureKMS:vault=v;name=k"))
+	assert.False(t, IsURI("keychain:label=foo"))
+}
+
+func TestParseURI(t *testing.T) {
+	tests := map[string]struct {
+		uri  string
+		want *URI
+		err  string
+	}{
+		"ok": {
+			uri:  "pkcs11:token=My%20Token;object=key;id=%01%02?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234",
+			want: &URI{Token: "My Token", SlotID: -1, Object: "key", ID: []byte{1, 2}, ModulePath: "/usr/lib/softhsm/libsofthsm2.so", PinValue: "1234"},
+		},
+		"ok slot and serial": {
+			uri:  "pkcs11:slot-id=2;serial=0123;model=SoftHSM%20v2;type=private;id=%ff?module-path=p11.so&pin-source=file:///run/pin",
+			want: &URI{Serial: "0123", SlotID: 2, ID: []byte{0xff}, ModulePath: "p11.so", PinSource: "/run/pin"},
+		},
+		"ok double slash": {
+			uri:  "pkcs11://object=key?module-path=p11.so",
+			want: &URI{SlotID: -1, Object: "key", ModulePath: "p11.so"},
+		},
+		"fail scheme":      {uri: "file:key.pem", err: "error parsing file:key.pem: not a PKCS #11 URI"},
+		"fail attribute":   {uri: "pkcs11:object?module-path=p11.so", err: "error parsing pkcs11:object?module-path=p11.so: invalid attribute 'object'"},
+		"fail escape":      {uri: "pkcs11:object=%zz?module-path=p11.so", err: "error parsing pkcs11:object=%zz?module-path=p11.so: invalid attribute 'object=%zz'"},
+		"fail slot-id":     {uri: "pkcs11:slot-id=a;object=key?module-path=p11.so", err: "error parsing pkcs11:slot-id=a;object=key?module-path=p11.so: invalid slot-id 'a'"},
+		"fail type":        {uri: "pkcs11:object=key;type=cert?module-path=p11.so", err: "error parsing pkcs11:object=key;type=cert?module-path=p11.so: unsupported type 'cert'"},
+		"fail object":      {uri: "pkcs11:token=step?module-path=p11.so", err: "error parsing pkcs11:token=step?module-path=p11.so: object or id are required"},
+		"fail module-path": {uri: "pkcs11:object=key", err: "error parsing pkcs11:object=key: module-path is required"},
+		"fail pin":         {uri: "pkcs11:object=key?module-path=p11.so&pin-value=1&pin-source=pin", err: "error parsing pkcs11:object=key?module-path=p11.so&pin-value=1&pin-source=pin: pin-value and pin-source are mutually exclusive"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseURI(tc.uri)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Equals(t, tc.err, err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
+func TestURI_Pin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kms")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	pinFile := filepath.Join(dir, "pin.txt")
+	assert.FatalError(t, ioutil.WriteFile(pinFile, []byte("1234\n"), 0600))
+
+	pin, err := (&URI{PinValue: "5678"}).Pin()
+	assert.FatalError(t, err)
+	assert.Equals(t, "5678", pin)
+
+	pin, err = (&URI{PinSource: pinFile}).Pin()
+	assert.FatalError(t, err)
+	assert.Equals(t, "1234", pin)
+
+	pin, err = (&URI{}).Pin()
+	assert.FatalError(t, err)
+	assert.Equals(t, "", pin)
+
+	_, err = (&URI{PinSource: filepath.Join(dir, "missing")}).Pin()
+	assert.Error(t, err)
+}
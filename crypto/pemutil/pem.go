@@ -6,11 +6,13 @@ import (
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/crypto/keys"
@@ -31,6 +33,7 @@ type context struct {
 	perm       os.FileMode
 	password   []byte
 	pkcs8      bool
+	openSSH    bool
 	stepCrypto bool
 	firstBlock bool
 }
@@ -120,6 +123,16 @@ func WithPKCS8(v bool) Options {
 	}
 }
 
+// WithOpenSSH with v set to true returns an option used in the Serialize
+// method to use the OpenSSH format on the private keys. The key will be
+// encrypted if a password is also set.
+func WithOpenSSH(v bool) Options {
+	return func(ctx *context) error {
+		ctx.openSSH = v
+		return nil
+	}
+}
+
 // WithStepCrypto returns cryptographic primitives of the modified step Crypto
 // library.
 func WithStepCrypto() Options {
@@ -166,8 +179,8 @@ func ReadCertificate(filename string) (*x509.Certificate, error) {
 }
 
 // ReadCertificateBundle returns a list of *x509.Certificate from the given
-// filename. It supports certificates formats PEM and DER. If a DER-formatted
-// file is given only one certificate will be returned.
+// filename. It supports certificates formats PEM and DER, and PKCS#7 bundles
+// encoded in PEM or DER.
 func ReadCertificateBundle(filename string) ([]*x509.Certificate, error) {
 	b, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -183,14 +196,22 @@ func ReadCertificateBundle(filename string) ([]*x509.Certificate, error) {
 			if block == nil {
 				break
 			}
-			if block.Type != "CERTIFICATE" {
+			switch block.Type {
+			case "CERTIFICATE":
+				crt, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, errors.Wrapf(err, "error parsing %s", filename)
+				}
+				bundle = append(bundle, crt)
+			case "PKCS7":
+				certs, err := ParsePKCS7Certificates(block.Bytes)
+				if err != nil {
+					return nil, errors.Wrapf(err, "error parsing %s", filename)
+				}
+				bundle = append(bundle, certs...)
+			default:
 				return nil, errors.Errorf("error decoding PEM: file '%s' is not a certificate bundle", filename)
 			}
-			crt, err := x509.ParseCertificate(block.Bytes)
-			if err != nil {
-				return nil, errors.Wrapf(err, "error parsing %s", filename)
-			}
-			bundle = append(bundle, crt)
 		}
 		if len(b) > 0 {
 			return nil, errors.Errorf("error decoding PEM: file '%s' contains unexpected data", filename)
@@ -198,9 +219,12 @@ func ReadCertificateBundle(filename string) ([]*x509.Certificate, error) {
 		return bundle, nil
 	}
 
-	// DER format (binary)
+	// DER format (binary), a certificate or a PKCS#7 bundle
 	crt, err := x509.ParseCertificate(b)
 	if err != nil {
+		if certs, err7 := ParsePKCS7Certificates(b); err7 == nil {
+			return certs, nil
+		}
 		return nil, errors.Wrapf(err, "error parsing %s", filename)
 	}
 	return []*x509.Certificate{crt}, nil
@@ -279,9 +303,12 @@ func Parse(b []byte, opts ...Options) (interface{}, error) {
 	case "EC PRIVATE KEY":
 		priv, err := x509.ParseECPrivateKey(block.Bytes)
 		return priv, errors.Wrapf(err, "error parsing %s", ctx.filename)
-	case "PRIVATE KEY", "OPENSSH PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+	case "PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
 		priv, err := ParsePKCS8PrivateKey(block.Bytes)
 		return priv, errors.Wrapf(err, "error parsing %s", ctx.filename)
+	case "OPENSSH PRIVATE KEY":
+		priv, err := parseOpenSSHPrivateKey(block.Bytes, ctx)
+		return priv, errors.Wrapf(err, "error parsing %s", ctx.filename)
 	case "CERTIFICATE":
 		if ctx.stepCrypto {
 			crt, err := stepx509.ParseCertificate(block.Bytes)
@@ -329,6 +356,84 @@ func Read(filename string, opts ...Options) (interface{}, error) {
 	return Parse(b, opts...)
 }
 
+// ReadPrivateKey returns the private key in the given PEM file. Unlike Read,
+// the file can contain other blocks, like the certificate or the EC
+// parameters written by OpenSSL, and only the first private key is used. If
+// the key is encrypted, the password in the options is used, or it is
+// prompted.
+func ReadPrivateKey(filename string, opts ...Options) (crypto.PrivateKey, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+
+	// force given filename
+	opts = append(opts, WithFilename(filename))
+	var block *pem.Block
+	for len(b) > 0 {
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			return Parse(pem.EncodeToMemory(block), opts...)
+		}
+	}
+	return nil, errors.Errorf("error decoding %s: does not contain a private key", filename)
+}
+
+// LoadX509KeyPair returns the TLS certificate with the certificate chain in
+// crtFile and the private key in keyFile. Both can be the same file. Contrary
+// to tls.LoadX509KeyPair, the key can be encrypted, and the password in the
+// options is used, or it is prompted.
+func LoadX509KeyPair(crtFile, keyFile string, opts ...Options) (tls.Certificate, error) {
+	var certs []*x509.Certificate
+	b, err := ioutil.ReadFile(crtFile)
+	if err != nil {
+		return tls.Certificate{}, errs.FileError(err, crtFile)
+	}
+	if crtFile == keyFile {
+		var block *pem.Block
+		for len(b) > 0 {
+			if block, b = pem.Decode(b); block == nil {
+				break
+			}
+			if block.Type == "CERTIFICATE" {
+				crt, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return tls.Certificate{}, errors.Wrapf(err, "error parsing %s", crtFile)
+				}
+				certs = append(certs, crt)
+			}
+		}
+	} else if certs, err = ReadCertificateBundle(crtFile); err != nil {
+		return tls.Certificate{}, err
+	}
+	if len(certs) == 0 {
+		return tls.Certificate{}, errors.Errorf("error decoding %s: does not contain a certificate", crtFile)
+	}
+
+	key, err := ReadPrivateKey(keyFile, opts...)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, errors.Errorf("error decoding %s: does not contain a valid private key", keyFile)
+	}
+	if pub, err := MarshalPKIXPublicKey(signer.Public()); err != nil || !bytes.Equal(pub, certs[0].RawSubjectPublicKeyInfo) {
+		return tls.Certificate{}, errors.Errorf("error loading %s: private key does not match the certificate %s", keyFile, crtFile)
+	}
+
+	crt := tls.Certificate{
+		PrivateKey: key,
+		Leaf:       certs[0],
+	}
+	for _, c := range certs {
+		crt.Certificate = append(crt.Certificate, c.Raw)
+	}
+	return crt, nil
+}
+
 // Serialize will serialize the input to a PEM formatted block and apply
 // modifiers.
 func Serialize(in interface{}, opts ...Options) (p *pem.Block, err error) {
@@ -337,6 +442,22 @@ func Serialize(in interface{}, opts ...Options) (p *pem.Block, err error) {
 		return nil, err
 	}
 
+	// OpenSSH private keys use their own encryption.
+	if ctx.openSSH {
+		switch in.(type) {
+		case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+			if p, err = serializeOpenSSHPrivateKey(in, ctx); err != nil {
+				return nil, err
+			}
+			if ctx.filename != "" {
+				if err := utils.WriteFile(ctx.filename, pem.EncodeToMemory(p), ctx.perm); err != nil {
+					return nil, errs.FileError(err, ctx.filename)
+				}
+			}
+			return p, nil
+		}
+	}
+
 	switch k := in.(type) {
 	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
 		b, err := MarshalPKIXPublicKey(k)
@@ -3,16 +3,21 @@ package pemutil
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/pem"
 	"io/ioutil"
+	"math/big"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
@@ -189,6 +194,8 @@ func TestReadCertificateBundle(t *testing.T) {
 		{"testdata/ca.crt", 1, nil},
 		{"testdata/ca.der", 1, nil},
 		{"testdata/bundle.crt", 2, nil},
+		{"testdata/bundle.p7b", 2, nil},
+		{"testdata/bundle.p7c", 2, nil},
 		{"testdata/notexists.crt", 0, errors.New("open testdata/notexists.crt failed: no such file or directory")},
 		{"testdata/badca.crt", 0, errors.New("error parsing testdata/badca.crt")},
 		{"testdata/badpem.crt", 0, errors.New("error decoding PEM: file 'testdata/badpem.crt' contains unexpected data")},
@@ -239,6 +246,103 @@ func TestReadStepCertificate(t *testing.T) {
 	}
 }
 
+func TestReadPrivateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pemutil")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	// OpenSSL writes the EC parameters before the key.
+	params, err := ioutil.ReadFile("testdata/openssl.p256.enc.pem")
+	assert.FatalError(t, err)
+	params = append(pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}}), params...)
+	withParams := filepath.Join(dir, "params.pem")
+	assert.FatalError(t, ioutil.WriteFile(withParams, params, 0600))
+
+	tests := []struct {
+		fn   string
+		opts []Options
+		want string
+		err  error
+	}{
+		{"testdata/openssl.p256.pem", nil, "testdata/openssl.p256.pem", nil},
+		{"testdata/openssl.p256.enc.pem", []Options{WithPassword([]byte("mypassword"))}, "testdata/openssl.p256.pem", nil},
+		{"testdata/openssl.rsa2048.enc.pem", []Options{WithPassword([]byte("mypassword"))}, "testdata/openssl.rsa2048.pem", nil},
+		{"testdata/pkcs8/openssl.p256.enc.pem", []Options{WithPassword([]byte("mypassword"))}, "testdata/pkcs8/openssl.p256.pem", nil},
+		{"testdata/openssh.p256.enc.pem", []Options{WithPassword([]byte("mypassword"))}, "testdata/openssh.p256.pem", nil},
+		{withParams, []Options{WithPassword([]byte("mypassword"))}, "testdata/openssl.p256.pem", nil},
+		{"testdata/openssl.p256.enc.pem", []Options{WithPassword([]byte("badpassword"))}, "", errors.New("error decrypting testdata/openssl.p256.enc.pem")},
+		{"testdata/openssl.p256.pub.pem", nil, "", errors.New("error decoding testdata/openssl.p256.pub.pem: does not contain a private key")},
+		{"testdata/ca.crt", nil, "", errors.New("error decoding testdata/ca.crt: does not contain a private key")},
+		{"testdata/notexists.pem", nil, "", errors.New("open testdata/notexists.pem failed: no such file or directory")},
+	}
+
+	for _, tc := range tests {
+		key, err := ReadPrivateKey(tc.fn, tc.opts...)
+		if tc.err != nil {
+			if assert.Error(t, err, tc.fn) {
+				assert.HasPrefix(t, err.Error(), tc.err.Error())
+			}
+		} else {
+			assert.NoError(t, err, tc.fn)
+			want, err := Read(tc.want)
+			assert.FatalError(t, err)
+			assert.Equals(t, want, key, tc.fn)
+		}
+	}
+}
+
+func TestLoadX509KeyPair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pemutil")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.FatalError(t, err)
+
+	crtFile := filepath.Join(dir, "test.crt")
+	keyFile := filepath.Join(dir, "test.key")
+	pemFile := filepath.Join(dir, "test.pem")
+	crtPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	assert.FatalError(t, ioutil.WriteFile(crtFile, crtPEM, 0600))
+	p, err := Serialize(key, WithPassword([]byte("mypassword")), ToFile(keyFile, 0600))
+	assert.FatalError(t, err)
+	assert.FatalError(t, ioutil.WriteFile(pemFile, append(crtPEM, pem.EncodeToMemory(p)...), 0600))
+
+	tests := []struct {
+		crtFile, keyFile string
+		err              error
+	}{
+		{crtFile, keyFile, nil},
+		{pemFile, pemFile, nil},
+		{crtFile, pemFile, nil},
+		{crtFile, "testdata/openssl.p256.pem", errors.New("error loading testdata/openssl.p256.pem: private key does not match the certificate")},
+		{keyFile, keyFile, errors.New("error decoding " + keyFile + ": does not contain a certificate")},
+		{"testdata/notexists.crt", keyFile, errors.New("open testdata/notexists.crt failed: no such file or directory")},
+	}
+
+	for _, tc := range tests {
+		crt, err := LoadX509KeyPair(tc.crtFile, tc.keyFile, WithPassword([]byte("mypassword")))
+		if tc.err != nil {
+			if assert.Error(t, err, tc.crtFile) {
+				assert.HasPrefix(t, err.Error(), tc.err.Error())
+			}
+		} else {
+			assert.NoError(t, err, tc.crtFile)
+			assert.Equals(t, [][]byte{der}, crt.Certificate)
+			assert.Equals(t, key, crt.PrivateKey)
+			assert.Equals(t, der, crt.Leaf.Raw)
+		}
+	}
+}
+
 func TestParsePEM(t *testing.T) {
 	type ParseTest struct {
 		in      []byte
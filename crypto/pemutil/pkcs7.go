@@ -0,0 +1,98 @@
+package pemutil
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	oidPKCS7Data       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// pkcs7ContentInfo reflects an ASN.1 PKCS#7 ContentInfo. See RFC 2315,
+// section 7.
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// pkcs7SignedData reflects an ASN.1 PKCS#7 SignedData. See RFC 2315,
+// section 9.1. CRLs and signer infos are not parsed.
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             []asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// ParsePKCS7Certificates returns the certificates in the given DER-encoded
+// PKCS#7 SignedData, usually a "certs-only" degenerate PKCS#7 like the ones
+// in .p7b or .p7c files.
+func ParsePKCS7Certificates(der []byte) ([]*x509.Certificate, error) {
+	var ci pkcs7ContentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, errors.Wrap(err, "error parsing PKCS#7")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error parsing PKCS#7: trailing data")
+	}
+	if !ci.ContentType.Equal(oidPKCS7SignedData) {
+		return nil, errors.Errorf("error parsing PKCS#7: unsupported content type %s", ci.ContentType)
+	}
+
+	var sd pkcs7SignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, errors.Wrap(err, "error parsing PKCS#7 signed data")
+	}
+	if len(sd.Certificates.Bytes) == 0 {
+		return nil, errors.New("error parsing PKCS#7: it does not contain certificates")
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing PKCS#7 certificates")
+	}
+	return certs, nil
+}
+
+// MarshalPKCS7Certificates returns the DER-encoded "certs-only" degenerate
+// PKCS#7 SignedData with the given certificates.
+func MarshalPKCS7Certificates(certs []*x509.Certificate) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("error marshaling PKCS#7: certificates cannot be empty")
+	}
+
+	var raw []byte
+	for _, crt := range certs {
+		raw = append(raw, crt.Raw...)
+	}
+
+	sd, err := asn1.Marshal(pkcs7SignedData{
+		Version:     1,
+		ContentInfo: pkcs7ContentInfo{ContentType: oidPKCS7Data},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      raw,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling PKCS#7 signed data")
+	}
+
+	b, err := asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidPKCS7SignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      sd,
+		},
+	})
+	return b, errors.Wrap(err, "error marshaling PKCS#7")
+}
@@ -0,0 +1,58 @@
+package pemutil
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestParsePKCS7Certificates(t *testing.T) {
+	bundle, err := ReadCertificateBundle("testdata/bundle.crt")
+	assert.FatalError(t, err)
+	p7b, err := ioutil.ReadFile("testdata/bundle.p7b")
+	assert.FatalError(t, err)
+	ca, err := ioutil.ReadFile("testdata/ca.der")
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		der     []byte
+		want    []*x509.Certificate
+		wantErr bool
+	}{
+		{"ok", p7b, bundle, false},
+		{"fail-certificate", ca, nil, true},
+		{"fail-trailing", append(p7b, 0), nil, true},
+		{"fail-empty", []byte{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePKCS7Certificates(tt.der)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePKCS7Certificates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestMarshalPKCS7Certificates(t *testing.T) {
+	bundle, err := ReadCertificateBundle("testdata/bundle.crt")
+	assert.FatalError(t, err)
+	p7b, err := ioutil.ReadFile("testdata/bundle.p7b")
+	assert.FatalError(t, err)
+
+	b, err := MarshalPKCS7Certificates(bundle)
+	assert.FatalError(t, err)
+	assert.Equals(t, p7b, b)
+
+	certs, err := ParsePKCS7Certificates(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, bundle, certs)
+
+	_, err = MarshalPKCS7Certificates(nil)
+	assert.Error(t, err)
+}
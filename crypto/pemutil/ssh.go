@@ -0,0 +1,395 @@
+package pemutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/randutil"
+	"github.com/smallstep/cli/ui"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshMagic             = "openssh-key-v1\x00"
+	sshDefaultCiphername = "aes256-ctr"
+	sshDefaultKdf        = "bcrypt"
+	sshDefaultRounds     = 16
+	sshSaltSize          = 16
+)
+
+// sshCipherKeySizes are the key sizes of the ciphers supported to encrypt
+// OpenSSH private keys.
+var sshCipherKeySizes = map[string]int{
+	"aes128-ctr": 16,
+	"aes192-ctr": 24,
+	"aes256-ctr": 32,
+	"aes128-cbc": 16,
+	"aes192-cbc": 24,
+	"aes256-cbc": 32,
+}
+
+// openSSHPrivateKey is the representation of the openssh-key-v1 format as
+// described in https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.key
+type openSSHPrivateKey struct {
+	CipherName   string
+	KdfName      string
+	KdfOpts      string
+	NumKeys      uint32
+	PubKey       []byte
+	PrivKeyBlock []byte
+}
+
+type openSSHPrivateKeyBlock struct {
+	Check1  uint32
+	Check2  uint32
+	Keytype string
+	Rest    []byte `ssh:"rest"`
+}
+
+type openSSHKdfOptions struct {
+	Salt   []byte
+	Rounds uint32
+}
+
+type openSSHRSAPrivateKey struct {
+	N       *big.Int
+	E       *big.Int
+	D       *big.Int
+	Iqmp    *big.Int
+	P       *big.Int
+	Q       *big.Int
+	Comment string
+	Pad     []byte `ssh:"rest"`
+}
+
+type openSSHECDSAPrivateKey struct {
+	Curve   string
+	Pub     []byte
+	D       *big.Int
+	Comment string
+	Pad     []byte `ssh:"rest"`
+}
+
+type openSSHEd25519PrivateKey struct {
+	Pub     []byte
+	Priv    []byte
+	Comment string
+	Pad     []byte `ssh:"rest"`
+}
+
+// ParseOpenSSHPublicKey parses a public key in the OpenSSH authorized_keys
+// format.
+func ParseOpenSSHPublicKey(b []byte) (crypto.PublicKey, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing OpenSSH public key")
+	}
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, errors.Errorf("error parsing OpenSSH public key: unsupported key type %s", pub.Type())
+	}
+	return cpk.CryptoPublicKey(), nil
+}
+
+// MarshalOpenSSHPublicKey returns the given public key in the OpenSSH
+// authorized_keys format.
+func MarshalOpenSSHPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "error converting public key to OpenSSH")
+	}
+	return ssh.MarshalAuthorizedKey(sshPub), nil
+}
+
+// parseOpenSSHPrivateKey parses the body of an OPENSSH PRIVATE KEY PEM block.
+// If the key is encrypted it uses the password in the context, or it asks for
+// one.
+func parseOpenSSHPrivateKey(key []byte, ctx *context) (crypto.PrivateKey, error) {
+	if !bytes.HasPrefix(key, []byte(sshMagic)) {
+		return nil, errors.New("invalid openssh private key format")
+	}
+
+	var w openSSHPrivateKey
+	if err := ssh.Unmarshal(key[len(sshMagic):], &w); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling private key")
+	}
+	if w.NumKeys != 1 {
+		return nil, errors.Errorf("error parsing private key: only one key is supported, found %d", w.NumKeys)
+	}
+
+	blockSize := 8
+	switch {
+	case w.KdfName == "none" && w.CipherName == "none":
+	case w.KdfName == sshDefaultKdf:
+		keySize, ok := sshCipherKeySizes[w.CipherName]
+		if !ok {
+			return nil, errors.Errorf("error parsing private key: unsupported cipher %s", w.CipherName)
+		}
+		var opts openSSHKdfOptions
+		if err := ssh.Unmarshal([]byte(w.KdfOpts), &opts); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling private key")
+		}
+
+		password := ctx.password
+		if len(password) == 0 {
+			var err error
+			password, err = ui.PromptPassword(fmt.Sprintf("Please enter the password to decrypt %s", ctx.filename))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		k, err := bcryptPBKDF(password, opts.Salt, int(opts.Rounds), keySize+aes.BlockSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "error deriving decryption key")
+		}
+		if err := sshCrypt(w.CipherName, k[:keySize], k[keySize:], w.PrivKeyBlock, false); err != nil {
+			return nil, err
+		}
+		blockSize = aes.BlockSize
+	default:
+		return nil, errors.Errorf("error parsing private key: unsupported kdf %s", w.KdfName)
+	}
+
+	var pk1 openSSHPrivateKeyBlock
+	if err := ssh.Unmarshal(w.PrivKeyBlock, &pk1); err != nil || pk1.Check1 != pk1.Check2 {
+		if w.CipherName != "none" {
+			return nil, errors.New("error decrypting private key: invalid password")
+		}
+		return nil, errors.New("error parsing private key: invalid format")
+	}
+	if len(w.PrivKeyBlock)%blockSize != 0 {
+		return nil, errors.New("error parsing private key: invalid padding")
+	}
+
+	switch pk1.Keytype {
+	case ssh.KeyAlgoRSA:
+		var k openSSHRSAPrivateKey
+		if err := ssh.Unmarshal(pk1.Rest, &k); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling private key")
+		}
+		if err := checkOpenSSHPadding(k.Pad); err != nil {
+			return nil, err
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{
+				N: k.N,
+				E: int(k.E.Int64()),
+			},
+			D:      k.D,
+			Primes: []*big.Int{k.P, k.Q},
+		}
+		if err := key.Validate(); err != nil {
+			return nil, errors.Wrap(err, "error parsing private key")
+		}
+		key.Precompute()
+		return key, nil
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		var k openSSHECDSAPrivateKey
+		if err := ssh.Unmarshal(pk1.Rest, &k); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling private key")
+		}
+		if err := checkOpenSSHPadding(k.Pad); err != nil {
+			return nil, err
+		}
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "nistp256":
+			curve = elliptic.P256()
+		case "nistp384":
+			curve = elliptic.P384()
+		case "nistp521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("error parsing private key: unsupported curve %s", k.Curve)
+		}
+		x, y := elliptic.Unmarshal(curve, k.Pub)
+		if x == nil {
+			return nil, errors.New("error parsing private key: invalid public key")
+		}
+		key := &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: curve,
+				X:     x,
+				Y:     y,
+			},
+			D: k.D,
+		}
+		if px, py := curve.ScalarBaseMult(k.D.Bytes()); px.Cmp(x) != 0 || py.Cmp(y) != 0 {
+			return nil, errors.New("error parsing private key: public key does not match private key")
+		}
+		return key, nil
+	case ssh.KeyAlgoED25519:
+		var k openSSHEd25519PrivateKey
+		if err := ssh.Unmarshal(pk1.Rest, &k); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling private key")
+		}
+		if err := checkOpenSSHPadding(k.Pad); err != nil {
+			return nil, err
+		}
+		if len(k.Priv) != ed25519.PrivateKeySize {
+			return nil, errors.New("error parsing private key: invalid Ed25519 key size")
+		}
+		key := make(ed25519.PrivateKey, ed25519.PrivateKeySize)
+		copy(key, k.Priv)
+		return key, nil
+	default:
+		return nil, errors.Errorf("error parsing private key: unsupported key type %s", pk1.Keytype)
+	}
+}
+
+// serializeOpenSSHPrivateKey returns a PEM block with the given private key in
+// the OpenSSH format. If the context has a password the key is encrypted using
+// bcrypt_pbkdf and AES-256-CTR.
+func serializeOpenSSHPrivateKey(key crypto.PrivateKey, ctx *context) (*pem.Block, error) {
+	var pub crypto.PublicKey
+	var pk1 openSSHPrivateKeyBlock
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, errors.New("error serializing private key: multi-prime RSA keys are not supported")
+		}
+		pub = &k.PublicKey
+		pk1.Keytype = ssh.KeyAlgoRSA
+		pk1.Rest = ssh.Marshal(openSSHRSAPrivateKey{
+			N:    k.N,
+			E:    big.NewInt(int64(k.E)),
+			D:    k.D,
+			Iqmp: new(big.Int).ModInverse(k.Primes[1], k.Primes[0]),
+			P:    k.Primes[0],
+			Q:    k.Primes[1],
+		})
+	case *ecdsa.PrivateKey:
+		var curve string
+		switch k.Curve {
+		case elliptic.P256():
+			curve = "nistp256"
+		case elliptic.P384():
+			curve = "nistp384"
+		case elliptic.P521():
+			curve = "nistp521"
+		default:
+			return nil, errors.Errorf("error serializing private key: unsupported curve %s", k.Curve.Params().Name)
+		}
+		pub = &k.PublicKey
+		pk1.Keytype = "ecdsa-sha2-" + curve
+		pk1.Rest = ssh.Marshal(openSSHECDSAPrivateKey{
+			Curve: curve,
+			Pub:   elliptic.Marshal(k.Curve, k.X, k.Y),
+			D:     k.D,
+		})
+	case ed25519.PrivateKey:
+		pub = ed25519.PublicKey(k[ed25519.SeedSize:])
+		pk1.Keytype = ssh.KeyAlgoED25519
+		pk1.Rest = ssh.Marshal(openSSHEd25519PrivateKey{
+			Pub:  k[ed25519.SeedSize:],
+			Priv: k,
+		})
+	default:
+		return nil, errors.Errorf("error serializing private key: unsupported key type %T", key)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing private key")
+	}
+
+	check := make([]byte, 4)
+	if _, err := rand.Read(check); err != nil {
+		return nil, errors.Wrap(err, "error generating random check")
+	}
+	pk1.Check1 = binary.BigEndian.Uint32(check)
+	pk1.Check2 = pk1.Check1
+
+	w := openSSHPrivateKey{
+		CipherName: "none",
+		KdfName:    "none",
+		NumKeys:    1,
+		PubKey:     sshPub.Marshal(),
+	}
+	blockSize := 8
+	var salt []byte
+	if len(ctx.password) > 0 {
+		if salt, err = randutil.Salt(sshSaltSize); err != nil {
+			return nil, err
+		}
+		w.CipherName = sshDefaultCiphername
+		w.KdfName = sshDefaultKdf
+		w.KdfOpts = string(ssh.Marshal(openSSHKdfOptions{
+			Salt:   salt,
+			Rounds: sshDefaultRounds,
+		}))
+		blockSize = aes.BlockSize
+	}
+
+	// Add the padding 1, 2, 3, ... up to the block size.
+	b := ssh.Marshal(pk1)
+	for i := 1; len(b)%blockSize != 0; i++ {
+		b = append(b, byte(i))
+	}
+
+	if w.CipherName != "none" {
+		keySize := sshCipherKeySizes[w.CipherName]
+		k, err := bcryptPBKDF(ctx.password, salt, sshDefaultRounds, keySize+aes.BlockSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "error deriving encryption key")
+		}
+		if err := sshCrypt(w.CipherName, k[:keySize], k[keySize:], b, true); err != nil {
+			return nil, err
+		}
+	}
+	w.PrivKeyBlock = b
+
+	return &pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: append([]byte(sshMagic), ssh.Marshal(w)...),
+	}, nil
+}
+
+// sshCrypt encrypts or decrypts in place the given data using the cipher with
+// the given name.
+func sshCrypt(name string, key, iv, data []byte, encrypt bool) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return errors.Wrap(err, "error creating cipher")
+	}
+	switch name {
+	case "aes128-ctr", "aes192-ctr", "aes256-ctr":
+		cipher.NewCTR(block, iv).XORKeyStream(data, data)
+	case "aes128-cbc", "aes192-cbc", "aes256-cbc":
+		if len(data)%aes.BlockSize != 0 {
+			return errors.New("error encrypting private key: invalid block size")
+		}
+		if encrypt {
+			cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+		} else {
+			cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+		}
+	default:
+		return errors.Errorf("unsupported cipher %s", name)
+	}
+	return nil
+}
+
+// checkOpenSSHPadding checks that the padding of a private key is 1, 2, 3, ...
+func checkOpenSSHPadding(pad []byte) error {
+	for i, b := range pad {
+		if int(b) != i+1 {
+			return errors.New("error parsing private key: invalid padding")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package pemutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestParseOpenSSHPrivateKey(t *testing.T) {
+	tests := map[string]keyType{
+		"rsa2048": rsaPrivateKey,
+		"p256":    ecdsaPrivateKey,
+		"p384":    ecdsaPrivateKey,
+		"p521":    ecdsaPrivateKey,
+		"ed25519": ed25519PrivateKey,
+	}
+	for name, typ := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := Read("testdata/openssh." + name + ".pem")
+			assert.FatalError(t, err)
+			encKey, err := Read("testdata/openssh."+name+".enc.pem", WithPassword([]byte("mypassword")))
+			assert.FatalError(t, err)
+			assert.Equals(t, key, encKey)
+
+			_, err = Read("testdata/openssh."+name+".enc.pem", WithPassword([]byte("badpassword")))
+			assert.Error(t, err)
+
+			b, err := ioutil.ReadFile("testdata/openssh." + name + ".pem.pub")
+			assert.FatalError(t, err)
+			pub, err := ParseOpenSSHPublicKey(b)
+			assert.FatalError(t, err)
+
+			switch typ {
+			case rsaPrivateKey:
+				assert.Type(t, &rsa.PrivateKey{}, key)
+				assert.Equals(t, &key.(*rsa.PrivateKey).PublicKey, pub)
+			case ecdsaPrivateKey:
+				assert.Type(t, &ecdsa.PrivateKey{}, key)
+				assert.Equals(t, &key.(*ecdsa.PrivateKey).PublicKey, pub)
+			case ed25519PrivateKey:
+				assert.Type(t, ed25519.PrivateKey{}, key)
+				assert.Equals(t, key.(ed25519.PrivateKey).Public(), pub)
+			}
+
+			sshPub, err := MarshalOpenSSHPublicKey(pub)
+			assert.FatalError(t, err)
+			assert.Equals(t, bytes.TrimSpace(b), bytes.TrimSpace(sshPub))
+		})
+	}
+}
+
+func TestSerializeOpenSSH(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := map[string]crypto.PrivateKey{
+		"rsa":     rsaKey,
+		"p256":    p256Key,
+		"p521":    p521Key,
+		"ed25519": edKey,
+	}
+	for name, key := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := Serialize(key, WithOpenSSH(true))
+			assert.FatalError(t, err)
+			assert.Equals(t, "OPENSSH PRIVATE KEY", p.Type)
+			k, err := Parse(pem.EncodeToMemory(p))
+			assert.FatalError(t, err)
+			if rk, ok := k.(*rsa.PrivateKey); ok {
+				assert.Equals(t, rsaKey.D, rk.D)
+				assert.Equals(t, rsaKey.Primes, rk.Primes)
+			} else {
+				assert.Equals(t, key, k)
+			}
+
+			p, err = Serialize(key, WithOpenSSH(true), WithPassword([]byte("mypassword")))
+			assert.FatalError(t, err)
+			k, err = Parse(pem.EncodeToMemory(p), WithPassword([]byte("mypassword")))
+			assert.FatalError(t, err)
+			if rk, ok := k.(*rsa.PrivateKey); ok {
+				assert.Equals(t, rsaKey.D, rk.D)
+			} else {
+				assert.Equals(t, key, k)
+			}
+			_, err = Parse(pem.EncodeToMemory(p), WithPassword([]byte("badpassword")))
+			assert.Error(t, err)
+		})
+	}
+}
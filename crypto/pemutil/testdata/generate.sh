@@ -65,4 +65,25 @@ $OPENSSL ec -outform PEM -in openssl.p521.pem -pubout -out openssl.p521.pub.pem
 
 $OPENSSL ec -outform PEM -in openssl.p256.pem -aes-256-cbc -passout pass:mypassword -out openssl.p256.enc.pem
 $OPENSSL ec -outform PEM -in openssl.p384.pem -des -passout pass:mypassword -out openssl.p384.enc.pem
-$OPENSSL ec -outform PEM -in openssl.p521.pem -des3 -passout pass:mypassword -out openssl.p521.enc.pem
\ No newline at end of file
+$OPENSSL ec -outform PEM -in openssl.p521.pem -des3 -passout pass:mypassword -out openssl.p521.enc.pem
+$OPENSSL crl2pkcs7 -nocrl -certfile bundle.crt -outform DER -out bundle.p7b
+$OPENSSL crl2pkcs7 -nocrl -certfile bundle.crt -outform PEM -out bundle.p7c
+
+#######################################
+# OpenSSH                             #
+#######################################
+
+ssh-keygen -q -t rsa -b 2048 -N "" -C "" -f openssh.rsa2048.pem
+ssh-keygen -q -t ecdsa -b 256 -N "" -C "" -f openssh.p256.pem
+ssh-keygen -q -t ecdsa -b 384 -N "" -C "" -f openssh.p384.pem
+ssh-keygen -q -t ecdsa -b 521 -N "" -C "" -f openssh.p521.pem
+ssh-keygen -q -t ed25519 -N "" -C "" -f openssh.ed25519.pem
+
+# Encrypted
+NAMES="rsa2048 p256 p384 p521 ed25519"
+for name in $NAMES
+do
+	cp "openssh.$name.pem" "openssh.$name.enc.pem"
+	ssh-keygen -q -p -N mypassword -f "openssh.$name.enc.pem"
+	rm "openssh.$name.enc.pem.pub" 2> /dev/null
+done
@@ -0,0 +1,51 @@
+// Package pkcs12util encodes and decodes PKCS#12 files, RFC 7292, keeping the
+// CA certificates in the file.
+//
+// The files are encrypted with pbeWithSHAAnd3-KeyTripleDES-CBC and protected
+// with an HMAC-SHA1 MAC, the algorithms supported by all the versions of
+// Windows, macOS and OpenSSL.
+package pkcs12util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Decode returns the private key, the certificate of the key, and the CA
+// certificates in the given PKCS#12 data.
+func Decode(data []byte, password string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
+	key, cert, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error decoding PKCS#12 data")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, errors.Errorf("error decoding PKCS#12 data: unsupported private key type %T", key)
+	}
+
+	// The certificate of the key is not always the first one.
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error marshaling public key")
+	}
+	certs := append([]*x509.Certificate{cert}, caCerts...)
+	for i, cert := range certs {
+		if b, err := x509.MarshalPKIXPublicKey(cert.PublicKey); err == nil && bytes.Equal(b, pub) {
+			caCerts := append(certs[:i:i], certs[i+1:]...)
+			return key, cert, caCerts, nil
+		}
+	}
+	return nil, nil, nil, errors.New("error decoding PKCS#12 data: certificate for the private key not found")
+}
+
+// Encode returns the PKCS#12 data with the given private key, certificate and
+// CA certificates, encrypted with the given password. The certificates are
+// encrypted too.
+func Encode(key crypto.PrivateKey, cert *x509.Certificate, caCerts []*x509.Certificate, password string) ([]byte, error) {
+	b, err := pkcs12.Legacy.Encode(key, cert, caCerts, password)
+	return b, errors.Wrap(err, "error encoding PKCS#12 data")
+}
@@ -0,0 +1,105 @@
+package pkcs12util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func newCertificate(t *testing.T, cn string, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	assert.FatalError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return cert
+}
+
+func TestEncodeDecode(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	ca := newCertificate(t, "Root CA", caKey, nil, nil)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name     string
+		key      crypto.Signer
+		caCerts  []*x509.Certificate
+		password string
+	}{
+		{"ec", ecKey, []*x509.Certificate{ca}, "password"},
+		{"rsa", rsaKey, []*x509.Certificate{ca}, "pässwörd"},
+		{"no chain", ecKey, nil, "password"},
+		{"empty password", ecKey, []*x509.Certificate{ca}, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cert := newCertificate(t, "leaf", tc.key, ca, caKey)
+			data, err := Encode(tc.key, cert, tc.caCerts, tc.password)
+			assert.FatalError(t, err)
+
+			key, leaf, caCerts, err := Decode(data, tc.password)
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.key, key)
+			assert.Equals(t, cert.Raw, leaf.Raw)
+			assert.Len(t, len(tc.caCerts), caCerts)
+			for i := range caCerts {
+				assert.Equals(t, tc.caCerts[i].Raw, caCerts[i].Raw)
+			}
+
+			// Files without a chain can be read by pkcs12.Decode.
+			if len(tc.caCerts) == 0 {
+				key, leaf, err := pkcs12.Decode(data, tc.password)
+				assert.FatalError(t, err)
+				assert.Equals(t, tc.key, key)
+				assert.Equals(t, cert.Raw, leaf.Raw)
+			}
+
+			_, _, _, err = Decode(data, "wrong password")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDecode_keyNotFirst(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	ca := newCertificate(t, "Root CA", caKey, nil, nil)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	cert := newCertificate(t, "leaf", key, ca, caKey)
+
+	// The CA certificate is encoded first.
+	data, err := pkcs12.Legacy.Encode(key, ca, []*x509.Certificate{cert}, "password")
+	assert.FatalError(t, err)
+	_, leaf, caCerts, err := Decode(data, "password")
+	assert.FatalError(t, err)
+	assert.Equals(t, cert.Raw, leaf.Raw)
+	assert.Len(t, 1, caCerts)
+	assert.Equals(t, ca.Raw, caCerts[0].Raw)
+}
@@ -0,0 +1,374 @@
+package pki
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/ca"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/debug"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/jose"
+	"golang.org/x/net/http2"
+)
+
+var (
+	resolveMu  sync.RWMutex
+	resolveMap map[string]string
+)
+
+var (
+	clientMu      sync.RWMutex
+	clientContext = context.Background()
+	clientTimeout time.Duration
+)
+
+var (
+	identityMu  sync.RWMutex
+	identityCrt *tls.Certificate
+)
+
+// The clients are cached, so all the requests to the same CA in one command
+// reuse the same connections.
+var (
+	cacheMu     sync.Mutex
+	clientCache = make(map[string]*ca.Client)
+)
+
+func init() {
+	// The remote JWK Sets are retrieved with the same transport used with the
+	// CA.
+	jose.SetTransport(WrapTransport(NewTransport(nil)))
+}
+
+// SetContext sets the context used in the requests to the CA. The requests in
+// progress are aborted when the context is canceled.
+func SetContext(ctx context.Context) {
+	clientMu.Lock()
+	clientContext = ctx
+	clientMu.Unlock()
+}
+
+// CancelOnSignal sets the context used in the requests to the CA to a context
+// that is canceled when the process receives an interrupt or termination
+// signal, so the requests in progress are aborted. The returned function stops
+// listening for the signals and cancels the context.
+func CancelOnSignal() context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	SetContext(ctx)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return func() {
+		signal.Stop(stop)
+		cancel()
+	}
+}
+
+// SetTimeout sets the maximum duration of each request to the CA, including
+// the time to read the response. A zero duration disables the timeout.
+func SetTimeout(d time.Duration) {
+	clientMu.Lock()
+	clientTimeout = d
+	clientMu.Unlock()
+}
+
+// SetClientCertificate sets the certificate and private key presented to the
+// CA in the TLS handshake, so a CA behind a proxy that requires mutual TLS can
+// be used. Empty file names remove the client certificate. If the key is
+// encrypted, the password in the options is used, or it is prompted.
+func SetClientCertificate(crtFile, keyFile string, opts ...pemutil.Options) error {
+	var crt *tls.Certificate
+	if crtFile != "" || keyFile != "" {
+		c, err := pemutil.LoadX509KeyPair(crtFile, keyFile, opts...)
+		if err != nil {
+			return errors.Wrapf(err, "error loading client certificate %s", crtFile)
+		}
+		crt = &c
+	}
+	identityMu.Lock()
+	identityCrt = crt
+	identityMu.Unlock()
+	resetClientCache()
+	return nil
+}
+
+// SetResolve sets the addresses used to connect to the given hosts and ports
+// instead of resolving the host names. Each entry has the format
+// host:port:address, e.g. 'ca.example.com:443:10.0.0.10' or
+// 'ca.example.com:443:[2001:db8::10]'.
+func SetResolve(entries []string) error {
+	m := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		host, port, addr, err := parseResolve(entry)
+		if err != nil {
+			return err
+		}
+		m[net.JoinHostPort(host, port)] = net.JoinHostPort(addr, port)
+	}
+	resolveMu.Lock()
+	resolveMap = m
+	resolveMu.Unlock()
+	resetClientCache()
+	return nil
+}
+
+// parseResolve parses an entry with the format host:port:address.
+func parseResolve(entry string) (host, port, addr string, err error) {
+	parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", errors.Errorf("invalid resolve entry '%s': format must be host:port:address", entry)
+	}
+	host, port = strings.ToLower(parts[0]), parts[1]
+	addr = strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return "", "", "", errors.Errorf("invalid resolve entry '%s': invalid port '%s'", entry, port)
+	}
+	if net.ParseIP(addr) == nil {
+		return "", "", "", errors.Errorf("invalid resolve entry '%s': invalid IP address '%s'", entry, addr)
+	}
+	return host, port, addr, nil
+}
+
+// resolveAddress returns the address set with SetResolve for the given
+// host:port, or the same address if there is none.
+func resolveAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	resolveMu.RLock()
+	defer resolveMu.RUnlock()
+	if addr, ok := resolveMap[net.JoinHostPort(strings.ToLower(host), port)]; ok {
+		debug.Log(debug.LevelVerbose, "resolve", "address", address, "resolved", addr)
+		return addr
+	}
+	return address
+}
+
+// NewTransport returns the transport used to connect to a CA with the given
+// TLS configuration. The transport uses the proxy set in the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables, and the addresses set with
+// SetResolve. If the config does not have certificates, the transport uses the
+// client certificate set with SetClientCertificate. A nil config is used for
+// other servers than the CA, and it does not use the client certificate.
+func NewTransport(config *tls.Config) *http.Transport {
+	if config != nil && len(config.Certificates) == 0 {
+		identityMu.RLock()
+		if identityCrt != nil {
+			config = config.Clone()
+			config.Certificates = []tls.Certificate{*identityCrt}
+		}
+		identityMu.RUnlock()
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, resolveAddress(address))
+		},
+		TLSClientConfig:       config,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// WrapTransport returns the http.RoundTripper used to send the requests to the
+// CA using the given one. The requests use the context set with SetContext,
+// and the timeout set with SetTimeout, and they are logged if the verbose or
+// debug logs are enabled. Authorization errors from a CA with a clock more than
+// MaxClockDrift apart from the local one are reported as a clock error.
+func WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return debug.Transport(&contextTransport{next: rt})
+}
+
+// contextTransport is an http.RoundTripper that adds the client context and
+// timeout to the requests.
+type contextTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	clientMu.RLock()
+	ctx, timeout := clientContext, clientTimeout
+	clientMu.RUnlock()
+
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		ctxErr := ctx.Err()
+		cancel()
+		switch ctxErr {
+		case context.DeadlineExceeded:
+			return nil, errs.WithCode(errors.Errorf("%s %s: request timed out after %s", req.Method, req.URL, timeout), errs.CodeNetwork)
+		case context.Canceled:
+			return nil, errs.WithCode(errors.Errorf("%s %s: request canceled", req.Method, req.URL), errs.CodeNetwork)
+		default:
+			return nil, err
+		}
+	}
+
+	// Authorization errors caused by a wrong clock are reported as such.
+	if err := checkClockDrift(req, resp, start, time.Now()); err != nil {
+		resp.Body.Close()
+		cancel()
+		return nil, err
+	}
+
+	// The context is canceled once the response is read.
+	resp.Body = &cancelReadCloser{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transport if it supports it.
+func (t *contextTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if tr, ok := t.next.(closeIdler); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// cancelReadCloser is an io.ReadCloser that cancels a context when it's
+// closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the underlying io.ReadCloser and cancels the context.
+func (r *cancelReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
+
+// NewClient returns a client for the CA at caURL that trusts the root
+// certificates in rootFile. The requests to the CA are logged if the verbose
+// or debug logs are enabled, see WrapTransport.
+//
+// Clients are reused while rootFile does not change, so the requests to the
+// same CA share the same HTTP/2 or keep-alive connections.
+func NewClient(caURL, rootFile string) (*ca.Client, error) {
+	st, err := os.Stat(rootFile)
+	if err != nil {
+		return nil, errs.FileError(err, rootFile)
+	}
+	key := strings.Join([]string{caURL, "root", rootFile, st.ModTime().String(), strconv.FormatInt(st.Size(), 10)}, "\x00")
+	return cachedClient(key, func() (*ca.Client, error) {
+		pool, err := x509util.ReadCertPool(rootFile)
+		if err != nil {
+			return nil, err
+		}
+		return newClient(caURL, pool)
+	})
+}
+
+// NewBootstrapClient returns a client for the CA at caURL that trusts the root
+// certificate with the given SHA256 fingerprint. The requests to the CA are
+// logged if the verbose or debug logs are enabled, see WrapTransport.
+//
+// Clients are reused, so the root certificate is only downloaded once.
+func NewBootstrapClient(caURL, fingerprint string) (*ca.Client, error) {
+	key := strings.Join([]string{caURL, "fingerprint", strings.ToLower(fingerprint)}, "\x00")
+	return cachedClient(key, func() (*ca.Client, error) {
+		pool, err := NewBootstrapPool(caURL, fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		return newClient(caURL, pool)
+	})
+}
+
+// NewBootstrapPool downloads the root certificate with the given SHA256
+// fingerprint from the CA at caURL, and returns a pool with it.
+func NewBootstrapPool(caURL, fingerprint string) (*x509.CertPool, error) {
+	tr := NewTransport(&tls.Config{InsecureSkipVerify: true})
+	client, err := ca.NewClient(caURL, ca.WithTransport(WrapTransport(tr)))
+	if err != nil {
+		return nil, err
+	}
+	// Root already validates the certificate
+	resp, err := client.Root(fingerprint)
+	if err != nil {
+		return nil, errors.Wrap(err, "error downloading root certificate")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(resp.RootPEM.Certificate)
+	return pool, nil
+}
+
+// cachedClient returns the client with the given key, and creates it with fn
+// if it's not in the cache. Clients that fail to be created are not cached.
+func cachedClient(key string, fn func() (*ca.Client, error)) (*ca.Client, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if client, ok := clientCache[key]; ok {
+		return client, nil
+	}
+	client, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	clientCache[key] = client
+	return client, nil
+}
+
+// resetClientCache removes the cached clients, it's called when the
+// configuration of the transports changes.
+func resetClientCache() {
+	cacheMu.Lock()
+	clientCache = make(map[string]*ca.Client)
+	cacheMu.Unlock()
+}
+
+func newClient(caURL string, roots *x509.CertPool) (*ca.Client, error) {
+	return ca.NewClient(caURL, ca.WithTransport(WrapTransport(newClientTransport(roots))))
+}
+
+// newClientTransport returns the transport of the clients that trust the
+// given roots. The transport uses HTTP/2 if the CA supports it.
+func newClientTransport(roots *x509.CertPool) *http.Transport {
+	tr := NewTransport(&tls.Config{
+		RootCAs:                  roots,
+		PreferServerCipherSuites: true,
+	})
+	if err := http2.ConfigureTransport(tr); err != nil {
+		debug.Log(debug.LevelVerbose, "http2", "error", err)
+	}
+	return tr
+}
@@ -0,0 +1,275 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+func TestSetResolve(t *testing.T) {
+	defer SetResolve(nil)
+
+	tests := []struct {
+		entries []string
+		want    map[string]string
+		err     string
+	}{
+		{nil, map[string]string{}, ""},
+		{[]string{"CA.example.com:443:10.0.0.10", "ca.example.com:8443:[2001:db8::10]"}, map[string]string{
+			"ca.example.com:443":  "10.0.0.10:443",
+			"ca.example.com:8443": "[2001:db8::10]:8443",
+		}, ""},
+		{[]string{"ca.example.com:443"}, nil, "invalid resolve entry 'ca.example.com:443': format must be host:port:address"},
+		{[]string{"ca.example.com::10.0.0.10"}, nil, "invalid resolve entry 'ca.example.com::10.0.0.10': format must be host:port:address"},
+		{[]string{"ca.example.com:https:10.0.0.10"}, nil, "invalid resolve entry 'ca.example.com:https:10.0.0.10': invalid port 'https'"},
+		{[]string{"ca.example.com:443:ca.internal"}, nil, "invalid resolve entry 'ca.example.com:443:ca.internal': invalid IP address 'ca.internal'"},
+	}
+	for _, tc := range tests {
+		err := SetResolve(tc.entries)
+		if tc.err != "" {
+			if assert.Error(t, err) {
+				assert.Equals(t, tc.err, err.Error())
+			}
+			continue
+		}
+		assert.FatalError(t, err)
+		assert.Equals(t, tc.want, resolveMap)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	defer SetResolve(nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer srv.Close()
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	assert.FatalError(t, err)
+	assert.FatalError(t, SetResolve([]string{"ca.example.com:" + port + ":127.0.0.1"}))
+
+	tr := NewTransport(nil)
+	assert.NotNil(t, tr.Proxy)
+	resp, err := (&http.Client{Transport: tr}).Get("http://ca.example.com:" + port + "/health")
+	assert.FatalError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.FatalError(t, err)
+	assert.Equals(t, "ca.example.com:"+port, string(b))
+
+	// Other addresses are not modified
+	assert.Equals(t, "ca.example.com:443", resolveAddress("ca.example.com:443"))
+	assert.Equals(t, "127.0.0.1:"+port, resolveAddress("CA.example.com:"+port))
+}
+
+func TestWrapTransport(t *testing.T) {
+	defer SetContext(context.Background())
+	defer SetTimeout(0)
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hang" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := &http.Client{Transport: WrapTransport(NewTransport(nil))}
+
+	// Response bodies can be read after the request.
+	SetTimeout(time.Minute)
+	resp, err := client.Get(srv.URL + "/health")
+	assert.FatalError(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.FatalError(t, err)
+	assert.FatalError(t, resp.Body.Close())
+	assert.Equals(t, "ok", string(b))
+
+	// Timeout
+	SetTimeout(50 * time.Millisecond)
+	_, err = client.Get(srv.URL + "/hang")
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "GET "+srv.URL+"/hang: request timed out after 50ms"))
+	}
+
+	// Cancellation
+	SetTimeout(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	SetContext(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = client.Get(srv.URL + "/hang")
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "GET "+srv.URL+"/hang: request canceled"))
+	}
+
+	// Other errors are not reported as canceled.
+	SetContext(context.Background())
+	_, err = client.Get("http://127.0.0.1:1/health")
+	if assert.Error(t, err) {
+		assert.False(t, strings.Contains(err.Error(), "request canceled"))
+	}
+}
+
+func TestSetClientCertificate(t *testing.T) {
+	defer SetClientCertificate("", "")
+
+	dir, err := ioutil.TempDir("", "pki")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client.example.com"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "client.example.com"}}, key.Public(), key)
+	assert.FatalError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.FatalError(t, err)
+	crtFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	assert.FatalError(t, ioutil.WriteFile(crtFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.FatalError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	// Errors
+	err = SetClientCertificate(crtFile, "")
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "error loading client certificate "+crtFile))
+	}
+	assert.Error(t, SetClientCertificate(filepath.Join(dir, "missing.crt"), keyFile))
+	assert.Error(t, SetClientCertificate(keyFile, crtFile))
+
+	// Without client certificate the handshake fails.
+	config := &tls.Config{RootCAs: pool}
+	_, err = (&http.Client{Transport: NewTransport(config)}).Get(srv.URL)
+	assert.Error(t, err)
+
+	// With client certificate
+	assert.FatalError(t, SetClientCertificate(crtFile, keyFile))
+	resp, err := (&http.Client{Transport: NewTransport(config)}).Get(srv.URL)
+	assert.FatalError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.FatalError(t, err)
+	assert.Equals(t, "client.example.com", string(b))
+
+	// With an encrypted key
+	encKeyFile := filepath.Join(dir, "client.enc.key")
+	_, err = pemutil.Serialize(key, pemutil.WithPassword([]byte("password")), pemutil.ToFile(encKeyFile, 0600))
+	assert.FatalError(t, err)
+	assert.Error(t, SetClientCertificate(crtFile, encKeyFile, pemutil.WithPassword([]byte("bad-password"))))
+	assert.FatalError(t, SetClientCertificate(crtFile, encKeyFile, pemutil.WithPassword([]byte("password"))))
+	resp, err = (&http.Client{Transport: NewTransport(config)}).Get(srv.URL)
+	assert.FatalError(t, err)
+	defer resp.Body.Close()
+	b, err = ioutil.ReadAll(resp.Body)
+	assert.FatalError(t, err)
+	assert.Equals(t, "client.example.com", string(b))
+
+	// The given config is not modified, and the nil config and the
+	// configs with certificates do not use the client certificate.
+	assert.Len(t, 0, config.Certificates)
+	assert.Nil(t, NewTransport(nil).TLSClientConfig)
+	crt := tls.Certificate{Certificate: [][]byte{[]byte("renew")}}
+	tr := NewTransport(&tls.Config{Certificates: []tls.Certificate{crt}})
+	assert.Equals(t, []tls.Certificate{crt}, tr.TLSClientConfig.Certificates)
+
+	// Empty files remove the client certificate.
+	assert.FatalError(t, SetClientCertificate("", ""))
+	assert.Len(t, 0, NewTransport(config).TLSClientConfig.Certificates)
+}
+
+func TestNewClientTransport(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	srv.StartTLS()
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	client := &http.Client{Transport: WrapTransport(newClientTransport(pool))}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL + "/health")
+		assert.FatalError(t, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		assert.FatalError(t, err)
+		assert.FatalError(t, resp.Body.Close())
+		assert.Equals(t, "HTTP/2.0", string(b))
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	defer resetClientCache()
+
+	dir, err := ioutil.TempDir("", "pki")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	rootFile := filepath.Join(dir, "root_ca.crt")
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	assert.FatalError(t, ioutil.WriteFile(rootFile, root, 0600))
+
+	_, err = NewClient(srv.URL, filepath.Join(dir, "missing.crt"))
+	assert.Error(t, err)
+
+	// Clients are reused while the root file does not change.
+	c1, err := NewClient(srv.URL, rootFile)
+	assert.FatalError(t, err)
+	c2, err := NewClient(srv.URL, rootFile)
+	assert.FatalError(t, err)
+	assert.True(t, c1 == c2)
+	c3, err := NewClient("https://ca.example.com", rootFile)
+	assert.FatalError(t, err)
+	assert.False(t, c1 == c3)
+
+	assert.FatalError(t, ioutil.WriteFile(rootFile, append(root, root...), 0600))
+	c4, err := NewClient(srv.URL, rootFile)
+	assert.FatalError(t, err)
+	assert.False(t, c1 == c4)
+
+	// The cache is reset when the transports change.
+	assert.FatalError(t, SetResolve(nil))
+	c5, err := NewClient(srv.URL, rootFile)
+	assert.FatalError(t, err)
+	assert.False(t, c4 == c5)
+}
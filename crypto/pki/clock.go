@@ -0,0 +1,70 @@
+package pki
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/debug"
+	"github.com/smallstep/cli/errs"
+)
+
+// MaxClockDrift is the maximum difference between the local clock and the
+// clock of the CA before it's reported. Tokens are usually valid for a few
+// minutes, so a larger difference makes the CA reject them.
+const MaxClockDrift = time.Minute
+
+// clockDrift returns the difference between the local clock and the clock of
+// the server that sent the response, using the Date header. The local time is
+// the middle of the request, start and end are the times before sending the
+// request and after receiving the response. It returns false if the response
+// does not have a valid Date header.
+func clockDrift(resp *http.Response, start, end time.Time) (time.Duration, bool) {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	local := start.Add(end.Sub(start) / 2)
+	return local.Sub(date).Round(time.Second), true
+}
+
+// checkClockDrift returns an error if the response is an authorization error
+// and the difference between the local clock and the clock of the CA is
+// larger than MaxClockDrift. In that case the most likely cause of the error
+// is a token that is not valid yet or already expired for the CA.
+func checkClockDrift(req *http.Request, resp *http.Response, start, end time.Time) error {
+	drift, ok := clockDrift(resp, start, end)
+	if !ok || (drift <= MaxClockDrift && drift >= -MaxClockDrift) {
+		return nil
+	}
+	debug.Log(debug.LevelVerbose, "clock", "url", req.URL, "drift", drift)
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return nil
+	}
+	hint := "fix the system clock"
+	if drift > 0 {
+		hint += " or use the --skew flag"
+	}
+	return errs.WithCode(errors.Errorf("%s %s: %s: your clock is %s; %s",
+		req.Method, req.URL, http.StatusText(resp.StatusCode), formatDrift(drift), hint), errs.StatusCode(resp.StatusCode))
+}
+
+// formatDrift returns a human readable description of a clock drift, e.g. "5
+// minutes off (ahead of the CA)".
+func formatDrift(drift time.Duration) string {
+	direction := "ahead of"
+	if drift < 0 {
+		direction, drift = "behind", -drift
+	}
+	var amount string
+	switch minutes := int(drift / time.Minute); minutes {
+	case 0:
+		amount = drift.String()
+	case 1:
+		amount = "1 minute"
+	default:
+		amount = fmt.Sprintf("%d minutes", minutes)
+	}
+	return fmt.Sprintf("%s off (%s the CA)", amount, direction)
+}
@@ -0,0 +1,82 @@
+package pki
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/errs"
+)
+
+func TestFormatDrift(t *testing.T) {
+	tests := []struct {
+		drift time.Duration
+		want  string
+	}{
+		{30 * time.Second, "30s off (ahead of the CA)"},
+		{-90 * time.Second, "1 minute off (behind the CA)"},
+		{7*time.Minute + 20*time.Second, "7 minutes off (ahead of the CA)"},
+		{-2 * time.Hour, "120 minutes off (behind the CA)"},
+	}
+	for _, tc := range tests {
+		assert.Equals(t, tc.want, formatDrift(tc.drift))
+	}
+}
+
+func TestWrapTransport_clockDrift(t *testing.T) {
+	var offset time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(offset).UTC().Format(http.TimeFormat))
+		if r.URL.Path == "/sign" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: WrapTransport(NewTransport(nil))}
+
+	// Authorization errors with the same clock are not modified.
+	resp, err := client.Post(srv.URL+"/sign", "application/json", nil)
+	assert.FatalError(t, err)
+	resp.Body.Close()
+	assert.Equals(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Other responses are not modified.
+	offset = -10 * time.Minute
+	resp, err = client.Get(srv.URL + "/health")
+	assert.FatalError(t, err)
+	resp.Body.Close()
+	assert.Equals(t, http.StatusOK, resp.StatusCode)
+
+	// Local clock ahead of the CA.
+	_, err = client.Post(srv.URL+"/sign", "application/json", nil)
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "POST "+srv.URL+"/sign: Unauthorized: your clock is 10 minutes off (ahead of the CA); fix the system clock or use the --skew flag"), err.Error())
+	}
+
+	// Local clock behind the CA.
+	offset = 5 * time.Minute
+	_, err = client.Post(srv.URL+"/sign", "application/json", nil)
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "your clock is 5 minutes off (behind the CA); fix the system clock"), err.Error())
+		assert.False(t, strings.Contains(err.Error(), "--skew"))
+	}
+
+	// The code of the error is the code of the status.
+	err = checkClockDrift(httptest.NewRequest("POST", "/sign", nil), &http.Response{
+		StatusCode: http.StatusUnauthorized,
+		Header:     http.Header{"Date": []string{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}},
+	}, time.Now(), time.Now())
+	assert.Equals(t, errs.CodeAuth, errs.GetCode(err))
+
+	// Responses without a valid Date header are not checked.
+	assert.NoError(t, checkClockDrift(httptest.NewRequest("POST", "/sign", nil), &http.Response{
+		StatusCode: http.StatusUnauthorized,
+		Header:     http.Header{"Date": []string{"yesterday"}},
+	}, time.Now(), time.Now()))
+}
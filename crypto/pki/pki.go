@@ -73,10 +73,24 @@ func GetProvisioners(caURL, rootFile string) (provisioner.List, error) {
 	if len(rootFile) == 0 {
 		rootFile = GetRootCAPath()
 	}
-	client, err := ca.NewClient(caURL, ca.WithRootFile(rootFile))
+	client, err := NewClient(caURL, rootFile)
 	if err != nil {
 		return nil, err
 	}
+	return getProvisioners(client)
+}
+
+// GetProvisionersWithFingerprint returns the provisioners on the given CA,
+// trusting the root certificate with the given SHA256 fingerprint.
+func GetProvisionersWithFingerprint(caURL, fingerprint string) (provisioner.List, error) {
+	client, err := NewBootstrapClient(caURL, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return getProvisioners(client)
+}
+
+func getProvisioners(client *ca.Client) (provisioner.List, error) {
 	cursor := ""
 	provisioners := provisioner.List{}
 	for {
@@ -98,10 +112,25 @@ func GetProvisionerKey(caURL, rootFile, kid string) (string, error) {
 	if len(rootFile) == 0 {
 		rootFile = GetRootCAPath()
 	}
-	client, err := ca.NewClient(caURL, ca.WithRootFile(rootFile))
+	client, err := NewClient(caURL, rootFile)
 	if err != nil {
 		return "", err
 	}
+	return getProvisionerKey(client, kid)
+}
+
+// GetProvisionerKeyWithFingerprint returns the encrypted provisioner key with
+// the given kid, trusting the root certificate with the given SHA256
+// fingerprint.
+func GetProvisionerKeyWithFingerprint(caURL, fingerprint, kid string) (string, error) {
+	client, err := NewBootstrapClient(caURL, fingerprint)
+	if err != nil {
+		return "", err
+	}
+	return getProvisionerKey(client, kid)
+}
+
+func getProvisionerKey(client *ca.Client, kid string) (string, error) {
 	resp, err := client.ProvisionerKey(kid)
 	if err != nil {
 		return "", err
@@ -252,9 +281,10 @@ func (p *PKI) WriteRootCertificate(rootCrt *stepX509.Certificate, rootKey interf
 }
 
 // GenerateIntermediateCertificate generates an intermediate certificate with
-// the given name.
-func (p *PKI) GenerateIntermediateCertificate(name string, rootCrt *stepX509.Certificate, rootKey interface{}, pass []byte) error {
-	interProfile, err := x509util.NewIntermediateProfile(name, rootCrt, rootKey)
+// the given name. The options can be used to customize the certificate, e.g.
+// to add name constraints.
+func (p *PKI) GenerateIntermediateCertificate(name string, rootCrt *stepX509.Certificate, rootKey interface{}, pass []byte, opts ...x509util.WithOption) error {
+	interProfile, err := x509util.NewIntermediateProfile(name, rootCrt, rootKey, opts...)
 	if err != nil {
 		return err
 	}
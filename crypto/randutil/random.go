@@ -65,3 +65,18 @@ func Alphanumeric(length int) (string, error) {
 func ASCII(length int) (string, error) {
 	return String(length, ascii)
 }
+
+// Diceware returns the given number of words randomly chosen from the EFF's
+// large wordlist. Each word adds about 12.9 bits of entropy.
+func Diceware(words int) ([]string, error) {
+	result := make([]string, words)
+	x := big.NewInt(int64(len(wordlist)))
+	for i := range result {
+		num, err := rand.Int(rand.Reader, x)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating random number")
+		}
+		result[i] = wordlist[num.Int64()]
+	}
+	return result, nil
+}
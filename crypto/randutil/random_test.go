@@ -35,6 +35,10 @@ func TestErrors(t *testing.T) {
 		str, err = ASCII(size)
 		assert.Error(t, err)
 		assert.Len(t, 0, str)
+
+		words, err := Diceware(size)
+		assert.Error(t, err)
+		assert.Len(t, 0, words)
 	}
 }
 
@@ -111,6 +115,33 @@ func TestASCII(t *testing.T) {
 	}
 }
 
+func TestDiceware(t *testing.T) {
+	re := regexp.MustCompilePOSIX(`^[a-z-]+$`)
+	lengths := []int{4, 6, 8, 16}
+	for _, l := range lengths {
+		a, err := Diceware(l)
+		assert.NoError(t, err)
+		assert.Len(t, l, a)
+		for _, w := range a {
+			assert.True(t, re.MatchString(w))
+		}
+		b, err := Diceware(l)
+		assert.NoError(t, err)
+		// Most of the time
+		assert.NotEquals(t, a, b)
+	}
+}
+
+func TestWordlist(t *testing.T) {
+	seen := make(map[string]bool, len(wordlist))
+	for _, w := range wordlist {
+		assert.False(t, seen[w], "duplicated word "+w)
+		seen[w] = true
+	}
+	assert.Equals(t, "abacus", wordlist[0])
+	assert.Equals(t, "zoom", wordlist[len(wordlist)-1])
+}
+
 type errorReader struct{}
 
 func (r *errorReader) Read(p []byte) (int, error) {
@@ -0,0 +1,57 @@
+package scep
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	stepx509 "github.com/smallstep/cli/pkg/x509"
+)
+
+// NewCertificateRequest creates a certificate request with the given template
+// and the challenge password used by the server to authorize the request. The
+// challenge is not added if it's empty. Only the subject, the extensions and
+// the subject alternative names of the template are used.
+func NewCertificateRequest(template *x509.CertificateRequest, key *rsa.PrivateKey, challenge string) (*x509.CertificateRequest, error) {
+	der, err := stepx509.CreateCertificateRequest(rand.Reader, &stepx509.CertificateRequest{
+		Subject:           template.Subject,
+		ExtraExtensions:   template.ExtraExtensions,
+		DNSNames:          template.DNSNames,
+		EmailAddresses:    template.EmailAddresses,
+		IPAddresses:       template.IPAddresses,
+		URIs:              template.URIs,
+		ChallengePassword: challenge,
+	}, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	return csr, errors.Wrap(err, "error parsing certificate request")
+}
+
+// NewSignerCertificate returns the self-signed certificate used to sign the
+// enrollment messages, it uses the subject and key of the certificate request.
+func NewSignerCertificate(csr *x509.CertificateRequest, key *rsa.PrivateKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating serial number")
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:       serial,
+		Subject:            csr.Subject,
+		NotBefore:          now.Add(-time.Minute),
+		NotAfter:           now.Add(24 * time.Hour),
+		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating signer certificate")
+	}
+	crt, err := x509.ParseCertificate(der)
+	return crt, errors.Wrap(err, "error parsing signer certificate")
+}
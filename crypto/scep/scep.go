@@ -0,0 +1,490 @@
+// Package scep implements a client of the Simple Certificate Enrollment
+// Protocol (SCEP), RFC 8894, used to request certificates from CAs like
+// Microsoft NDES.
+package scep
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/cms"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+)
+
+// SCEP attributes, see RFC 8894, section 3.2.1.
+var (
+	oidSCEPMessageType    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 2}
+	oidSCEPPKIStatus      = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 3}
+	oidSCEPFailInfo       = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 4}
+	oidSCEPSenderNonce    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 5}
+	oidSCEPRecipientNonce = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 6}
+	oidSCEPTransactionID  = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+)
+
+// Message types, see RFC 8894, section 3.2.1.2.
+const (
+	messageTypeCertRep    = "3"
+	messageTypeRenewalReq = "17"
+	messageTypePKCSReq    = "19"
+	messageTypeCertPoll   = "20"
+)
+
+// PKI statuses, see RFC 8894, section 3.2.1.3.
+const (
+	pkiStatusSuccess = "0"
+	pkiStatusFailure = "2"
+	pkiStatusPending = "3"
+)
+
+// failInfos are the descriptions of the failure reasons, see RFC 8894,
+// section 3.2.1.4.
+var failInfos = map[string]string{
+	"0": "unrecognized or unsupported algorithm",
+	"1": "integrity check failed",
+	"2": "transaction not permitted or supported",
+	"3": "the signing time is not close to the system time",
+	"4": "no certificate could be identified matching the provided criteria",
+}
+
+// Capabilities are the capabilities returned by GetCACaps.
+type Capabilities []string
+
+// Has returns true if the capabilities contain the given one. Capabilities
+// are case-insensitive.
+func (c Capabilities) Has(name string) bool {
+	for _, s := range c {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hash returns the hash used to sign the messages.
+func (c Capabilities) hash() crypto.Hash {
+	if c.Has("SHA-256") || c.Has("SCEPStandard") {
+		return crypto.SHA256
+	}
+	return crypto.SHA1
+}
+
+// encryption returns the algorithm used to encrypt the messages.
+func (c Capabilities) encryption() cms.ContentEncryptionAlgorithm {
+	if c.Has("AES") || c.Has("SCEPStandard") {
+		return cms.AES128CBC
+	}
+	return cms.DESEDE3CBC
+}
+
+// Client is a SCEP client.
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// NewClient returns a client for the SCEP server at the given URL, e.g.
+// 'https://ndes.example.com/certsrv/mscep/mscep.dll'. If client is nil the
+// http.DefaultClient is used.
+func NewClient(u string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{url: u, client: client}
+}
+
+// GetCACaps returns the capabilities of the server.
+func (c *Client) GetCACaps() (Capabilities, error) {
+	b, _, err := c.get("GetCACaps", "")
+	if err != nil {
+		return nil, err
+	}
+	var caps Capabilities
+	for _, s := range strings.Fields(string(b)) {
+		caps = append(caps, s)
+	}
+	return caps, nil
+}
+
+// GetCACert returns the certificates of the CA, and of the registration
+// authority (RA) if the server uses one. The identifier is optional, it's
+// used by servers with multiple CAs.
+func (c *Client) GetCACert(identifier string) ([]*x509.Certificate, error) {
+	b, _, err := c.get("GetCACert", identifier)
+	if err != nil {
+		return nil, err
+	}
+	if crt, err := x509.ParseCertificate(b); err == nil {
+		return []*x509.Certificate{crt}, nil
+	}
+	certs, err := pemutil.ParsePKCS7Certificates(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing GetCACert response")
+	}
+	return certs, nil
+}
+
+func (c *Client) get(operation, message string) ([]byte, string, error) {
+	q := url.Values{"operation": []string{operation}}
+	if message != "" {
+		q.Set("message", message)
+	}
+	u := c.url
+	if strings.Contains(u, "?") {
+		u += "&" + q.Encode()
+	} else {
+		u += "?" + q.Encode()
+	}
+	return c.do(http.NewRequest("GET", u, nil))
+}
+
+func (c *Client) post(operation string, body []byte) ([]byte, string, error) {
+	u := c.url
+	q := "operation=" + url.QueryEscape(operation)
+	if strings.Contains(u, "?") {
+		u += "&" + q
+	} else {
+		u += "?" + q
+	}
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/x-pki-message")
+	}
+	return c.do(req, err)
+}
+
+func (c *Client) do(req *http.Request, err error) ([]byte, string, error) {
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error creating SCEP request")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "error requesting %s", c.url)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "error reading response from %s", c.url)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, "", errs.WithCode(errors.Errorf("error requesting %s: %s", c.url, resp.Status), errs.StatusCode(resp.StatusCode))
+	}
+	return b, resp.Header.Get("Content-Type"), nil
+}
+
+// pkiOperation sends a PKIOperation message and returns the response.
+func (c *Client) pkiOperation(caps Capabilities, msg []byte) ([]byte, error) {
+	var b []byte
+	var err error
+	if caps.Has("POSTPKIOperation") || caps.Has("SCEPStandard") {
+		b, _, err = c.post("PKIOperation", msg)
+	} else {
+		b, _, err = c.get("PKIOperation", base64.StdEncoding.EncodeToString(msg))
+	}
+	return b, err
+}
+
+// EnrollRequest is the request of a new certificate.
+type EnrollRequest struct {
+	// CSR is the certificate request, it can have a challenge password, see
+	// NewCertificateRequest.
+	CSR *x509.CertificateRequest
+	// SignerCert and SignerKey are used to sign the request, and to decrypt
+	// the response. On enrollment, it's a self-signed certificate with the
+	// key of the CSR, see NewSignerCertificate. On renewal, it's the current
+	// certificate.
+	SignerCert *x509.Certificate
+	SignerKey  *rsa.PrivateKey
+	// CACerts are the certificates returned by GetCACert.
+	CACerts []*x509.Certificate
+	// Renewal sends a RenewalReq message instead of PKCSReq if the server
+	// supports it.
+	Renewal bool
+	// PollInterval is the time between requests when the request is
+	// pending, by default 30s.
+	PollInterval time.Duration
+	// Timeout is the maximum time to wait for a pending request, by default
+	// the request is not polled.
+	Timeout time.Duration
+}
+
+// PendingError is the error returned when the request is still pending after
+// the timeout, e.g. waiting for manual approval.
+type PendingError struct {
+	TransactionID string
+}
+
+// Error implements the error interface.
+func (e *PendingError) Error() string {
+	return "certificate request is pending approval, transaction ID " + e.TransactionID
+}
+
+// Enroll sends the certificate request and returns the issued certificate
+// and the other certificates in the response.
+func (c *Client) Enroll(req *EnrollRequest) ([]*x509.Certificate, error) {
+	caps, err := c.GetCACaps()
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := Recipient(req.CACerts)
+	if err != nil {
+		return nil, err
+	}
+
+	messageType := messageTypePKCSReq
+	if req.Renewal && (caps.Has("Renewal") || caps.Has("SCEPStandard")) {
+		messageType = messageTypeRenewalReq
+	}
+	transactionID := TransactionID(req.CSR.PublicKey)
+	msg, nonce, err := newPKIMessage(caps, messageType, transactionID, req.CSR.Raw, recipient, req.SignerCert, req.SignerKey)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := c.send(caps, msg, transactionID, nonce, req)
+	if _, ok := err.(*PendingError); !ok || req.Timeout <= 0 {
+		return certs, err
+	}
+
+	// Poll with CertPoll messages.
+	interval := req.PollInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	issuer := recipient
+	for _, crt := range req.CACerts {
+		if crt.IsCA {
+			issuer = crt
+			break
+		}
+	}
+	ias, err := asn1.Marshal(issuerAndSubject{
+		Issuer:  asn1.RawValue{FullBytes: issuer.RawSubject},
+		Subject: asn1.RawValue{FullBytes: req.CSR.RawSubject},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling CertPoll message")
+	}
+	deadline := time.Now().Add(req.Timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		msg, nonce, err := newPKIMessage(caps, messageTypeCertPoll, transactionID, ias, recipient, req.SignerCert, req.SignerKey)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := c.send(caps, msg, transactionID, nonce, req)
+		if _, ok := err.(*PendingError); !ok {
+			return certs, err
+		}
+	}
+	return nil, &PendingError{TransactionID: transactionID}
+}
+
+// send sends a message and parses the response.
+func (c *Client) send(caps Capabilities, msg []byte, transactionID string, nonce []byte, req *EnrollRequest) ([]*x509.Certificate, error) {
+	b, err := c.pkiOperation(caps, msg)
+	if err != nil {
+		return nil, err
+	}
+	return parseCertRep(b, transactionID, nonce, req)
+}
+
+type issuerAndSubject struct {
+	Issuer  asn1.RawValue
+	Subject asn1.RawValue
+}
+
+// newPKIMessage returns a signed pkiMessage with the given content encrypted
+// for the recipient, and the sender nonce.
+func newPKIMessage(caps Capabilities, messageType, transactionID string, content []byte, recipient, signer *x509.Certificate, key *rsa.PrivateKey) ([]byte, []byte, error) {
+	enveloped, err := cms.Encrypt(content, []*x509.Certificate{recipient}, &cms.EncryptOptions{
+		ContentEncryptionAlgorithm: caps.encryption(),
+		PKCS1v15:                   true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, errors.Wrap(err, "error generating nonce")
+	}
+	msg, err := cms.Sign(enveloped, []*x509.Certificate{signer}, key, &cms.SignOptions{
+		Hash:       caps.hash(),
+		Attributes: newAttributes(messageType, transactionID, nonce),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, nonce, nil
+}
+
+// newAttributes returns the SCEP attributes of a message. The strings are
+// encoded as PrintableString.
+func newAttributes(messageType, transactionID string, senderNonce []byte) []cms.Attribute {
+	return []cms.Attribute{
+		{Type: oidSCEPMessageType, Value: messageType},
+		{Type: oidSCEPTransactionID, Value: transactionID},
+		{Type: oidSCEPSenderNonce, Value: senderNonce},
+	}
+}
+
+// pkiMessage is a verified SCEP pkiMessage.
+type pkiMessage struct {
+	signedData *cms.SignedData
+	signer     *x509.Certificate
+}
+
+// parsePKIMessage parses the given pkiMessage and verifies its signature. The
+// signer must be one of the certificates in the message or one of the given
+// ones.
+func parsePKIMessage(b []byte, certs []*x509.Certificate) (*pkiMessage, error) {
+	sd, err := cms.ParseSignedData(b)
+	if err != nil {
+		return nil, err
+	}
+	sd.Certificates = append(sd.Certificates, certs...)
+	// The pending and failure responses do not have content.
+	content := sd.Content
+	if content == nil {
+		content = []byte{}
+	}
+	signers, err := sd.Verify(content, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(signers) != 1 {
+		return nil, errors.Errorf("error verifying CMS: found %d signers, expected one", len(signers))
+	}
+	return &pkiMessage{signedData: sd, signer: signers[0]}, nil
+}
+
+// string returns the string value of the attribute with the given oid.
+func (m *pkiMessage) string(oid asn1.ObjectIdentifier) string {
+	var s string
+	if _, err := m.signedData.SignedAttribute(oid, &s); err != nil {
+		return ""
+	}
+	return s
+}
+
+// bytes returns the OCTET STRING value of the attribute with the given oid.
+func (m *pkiMessage) bytes(oid asn1.ObjectIdentifier) []byte {
+	var b []byte
+	if _, err := m.signedData.SignedAttribute(oid, &b); err != nil {
+		return nil
+	}
+	return b
+}
+
+// parseCertRep verifies and parses a CertRep message.
+func parseCertRep(b []byte, transactionID string, nonce []byte, req *EnrollRequest) ([]*x509.Certificate, error) {
+	msg, err := parsePKIMessage(b, req.CACerts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing SCEP response")
+	}
+	if !isTrusted(msg.signer, req.CACerts) {
+		return nil, errors.New("error parsing SCEP response: the response is not signed by the CA")
+	}
+	switch {
+	case msg.string(oidSCEPMessageType) != messageTypeCertRep:
+		return nil, errors.Errorf("error parsing SCEP response: unexpected message type '%s'", msg.string(oidSCEPMessageType))
+	case msg.string(oidSCEPTransactionID) != transactionID:
+		return nil, errors.New("error parsing SCEP response: transaction ID does not match")
+	case !bytes.Equal(msg.bytes(oidSCEPRecipientNonce), nonce):
+		return nil, errors.New("error parsing SCEP response: recipient nonce does not match")
+	}
+
+	switch status := msg.string(oidSCEPPKIStatus); status {
+	case pkiStatusSuccess:
+	case pkiStatusPending:
+		return nil, &PendingError{TransactionID: transactionID}
+	case pkiStatusFailure:
+		info := msg.string(oidSCEPFailInfo)
+		if s, ok := failInfos[info]; ok {
+			info = s
+		}
+		return nil, errs.WithCode(errors.Errorf("certificate request rejected: %s", info), errs.CodePolicy)
+	default:
+		return nil, errors.Errorf("error parsing SCEP response: unexpected status '%s'", status)
+	}
+
+	content, err := cms.Decrypt(msg.signedData.Content, req.SignerCert, req.SignerKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing SCEP response")
+	}
+	certs, err := pemutil.ParsePKCS7Certificates(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing SCEP response")
+	}
+
+	// The issued certificate is the one with the key of the request.
+	pub, err := x509.MarshalPKIXPublicKey(req.CSR.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling public key")
+	}
+	for i, crt := range certs {
+		if bytes.Equal(crt.RawSubjectPublicKeyInfo, pub) {
+			return append([]*x509.Certificate{crt}, append(certs[:i:i], certs[i+1:]...)...), nil
+		}
+	}
+	return nil, errors.New("error parsing SCEP response: issued certificate not found")
+}
+
+// isTrusted returns true if the given certificate is one of the CA
+// certificates or it's signed by one of them.
+func isTrusted(crt *x509.Certificate, caCerts []*x509.Certificate) bool {
+	for _, ca := range caCerts {
+		if bytes.Equal(crt.Raw, ca.Raw) || crt.CheckSignatureFrom(ca) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Recipient returns the certificate used to encrypt the messages to the
+// server: the RA certificate for key encipherment if the server uses an RA,
+// or the CA certificate.
+func Recipient(certs []*x509.Certificate) (*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("CA certificates cannot be empty")
+	}
+	var ra *x509.Certificate
+	for _, crt := range certs {
+		if crt.IsCA {
+			continue
+		}
+		if crt.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+			return crt, nil
+		}
+		if ra == nil {
+			ra = crt
+		}
+	}
+	if ra != nil {
+		return ra, nil
+	}
+	return certs[0], nil
+}
+
+// TransactionID returns the transaction ID of a request with the given
+// public key, the hex-encoded SHA-256 hash of the key.
+func TransactionID(pub crypto.PublicKey) string {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,340 @@
+package scep
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/cms"
+	"github.com/smallstep/cli/crypto/pemutil"
+	stepx509 "github.com/smallstep/cli/pkg/x509"
+)
+
+// testServer is a minimal SCEP server that issues the requests with the
+// challenge "secret". The responses are signed by the CA unless signer is
+// set.
+type testServer struct {
+	caps      string
+	ca        *x509.Certificate
+	caKey     *rsa.PrivateKey
+	signer    *x509.Certificate
+	signerKey *rsa.PrivateKey
+	mu        sync.Mutex
+	pending   int
+}
+
+func newTestServer(t *testing.T, caps string) (*testServer, *httptest.Server) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test SCEP CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.FatalError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+
+	s := &testServer{caps: caps, ca: ca, caKey: key, signer: ca, signerKey: key}
+	return s, httptest.NewServer(s)
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("operation") {
+	case "GetCACaps":
+		w.Write([]byte(s.caps))
+	case "GetCACert":
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		w.Write(s.ca.Raw)
+	case "PKIOperation":
+		var msg []byte
+		var err error
+		if r.Method == "POST" {
+			msg, err = ioutil.ReadAll(r.Body)
+		} else {
+			msg, err = base64.StdEncoding.DecodeString(r.URL.Query().Get("message"))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := s.pkiOperation(msg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-pki-message")
+		w.Write(resp)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *testServer) pkiOperation(b []byte) ([]byte, error) {
+	msg, err := parsePKIMessage(b, nil)
+	if err != nil {
+		return nil, err
+	}
+	content, err := cms.Decrypt(msg.signedData.Content, s.ca, s.caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var csr *x509.CertificateRequest
+	switch msg.string(oidSCEPMessageType) {
+	case messageTypePKCSReq, messageTypeRenewalReq:
+		if csr, err = x509.ParseCertificateRequest(content); err != nil {
+			return nil, err
+		}
+		if challengePassword(csr) != "secret" && msg.string(oidSCEPMessageType) == messageTypePKCSReq {
+			return s.certRep(msg, pkiStatusFailure, nil)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.pending > 0 {
+			s.pending--
+			return s.certRep(msg, pkiStatusPending, nil)
+		}
+	case messageTypeCertPoll:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.pending > 0 {
+			s.pending--
+			return s.certRep(msg, pkiStatusPending, nil)
+		}
+		// The public key is the one of the signer.
+		csr = &x509.CertificateRequest{Subject: msg.signer.Subject, PublicKey: msg.signer.PublicKey}
+	default:
+		return s.certRep(msg, pkiStatusFailure, nil)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.ca, csr.PublicKey, s.caKey)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return s.certRep(msg, pkiStatusSuccess, []*x509.Certificate{s.ca, crt})
+}
+
+func (s *testServer) certRep(msg *pkiMessage, status string, certs []*x509.Certificate) ([]byte, error) {
+	var content []byte
+	if len(certs) > 0 {
+		p7, err := pemutil.MarshalPKCS7Certificates(certs)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = cms.Encrypt(p7, []*x509.Certificate{msg.signer}, &cms.EncryptOptions{
+			ContentEncryptionAlgorithm: cms.AES128CBC,
+			PKCS1v15:                   true,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	attrs := append(newAttributes(messageTypeCertRep, msg.string(oidSCEPTransactionID), []byte("server-nonce")),
+		cms.Attribute{Type: oidSCEPPKIStatus, Value: status},
+		cms.Attribute{Type: oidSCEPRecipientNonce, Value: msg.bytes(oidSCEPSenderNonce)},
+	)
+	if status == pkiStatusFailure {
+		attrs = append(attrs, cms.Attribute{Type: oidSCEPFailInfo, Value: "2"})
+	}
+	return cms.Sign(content, []*x509.Certificate{s.signer}, s.signerKey, &cms.SignOptions{
+		Hash:       Capabilities(strings.Fields(s.caps)).hash(),
+		Attributes: attrs,
+	})
+}
+
+func newTestRequest(t *testing.T, challenge string) (*x509.CertificateRequest, *x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	csr, err := NewCertificateRequest(&x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "device.example.com"},
+		DNSNames: []string{"device.example.com"},
+	}, key, challenge)
+	assert.FatalError(t, err)
+	signer, err := NewSignerCertificate(csr, key)
+	assert.FatalError(t, err)
+	return csr, signer, key
+}
+
+// challengePassword returns the challenge password in the given certificate
+// request.
+func challengePassword(csr *x509.CertificateRequest) string {
+	cr, err := stepx509.ParseCertificateRequest(csr.Raw)
+	if err != nil {
+		return ""
+	}
+	return cr.ChallengePassword
+}
+
+func TestNewCertificateRequest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "device.example.com"},
+		DNSNames: []string{"device.example.com"},
+	}
+
+	csr, err := NewCertificateRequest(template, key, "secret")
+	assert.FatalError(t, err)
+	assert.NoError(t, csr.CheckSignature())
+	assert.Equals(t, "device.example.com", csr.Subject.CommonName)
+	assert.Equals(t, []string{"device.example.com"}, csr.DNSNames)
+	assert.Equals(t, "secret", challengePassword(csr))
+
+	csr, err = NewCertificateRequest(template, key, "")
+	assert.FatalError(t, err)
+	assert.NoError(t, csr.CheckSignature())
+	assert.Equals(t, "", challengePassword(csr))
+
+	// Not printable characters are encoded as a UTF8String
+	csr, err = NewCertificateRequest(template, key, "s3cr3t_p@ss")
+	assert.FatalError(t, err)
+	assert.NoError(t, csr.CheckSignature())
+	assert.Equals(t, "s3cr3t_p@ss", challengePassword(csr))
+}
+
+func TestRecipient(t *testing.T) {
+	ca := &x509.Certificate{IsCA: true, Raw: []byte("ca")}
+	ra := &x509.Certificate{Raw: []byte("ra")}
+	raEnc := &x509.Certificate{Raw: []byte("ra-enc"), KeyUsage: x509.KeyUsageKeyEncipherment}
+
+	tests := []struct {
+		name    string
+		certs   []*x509.Certificate
+		want    *x509.Certificate
+		wantErr bool
+	}{
+		{"ok ca", []*x509.Certificate{ca}, ca, false},
+		{"ok ra", []*x509.Certificate{ca, ra}, ra, false},
+		{"ok ra encipherment", []*x509.Certificate{ra, ca, raEnc}, raEnc, false},
+		{"fail empty", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Recipient(tt.certs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Recipient() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestClient_Enroll(t *testing.T) {
+	tests := []struct {
+		name      string
+		caps      string
+		challenge string
+		pending   int
+		timeout   time.Duration
+		wantErr   bool
+	}{
+		{"ok", "POSTPKIOperation\nSHA-256\nAES\nRenewal", "secret", 0, 0, false},
+		{"ok standard", "SCEPStandard", "secret", 0, 0, false},
+		{"ok legacy", "", "secret", 0, 0, false},
+		{"ok pending", "POSTPKIOperation\nSHA-256\nAES", "secret", 2, time.Minute, false},
+		{"fail challenge", "POSTPKIOperation", "wrong", 0, 0, true},
+		{"fail pending", "POSTPKIOperation", "secret", 1, 0, true},
+		{"fail pending timeout", "POSTPKIOperation", "secret", 100, 50 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, srv := newTestServer(t, tt.caps)
+			defer srv.Close()
+			s.pending = tt.pending
+
+			client := NewClient(srv.URL, nil)
+			caCerts, err := client.GetCACert("")
+			assert.FatalError(t, err)
+			assert.Equals(t, []*x509.Certificate{s.ca}, caCerts)
+
+			csr, signer, key := newTestRequest(t, tt.challenge)
+			certs, err := client.Enroll(&EnrollRequest{
+				CSR:          csr,
+				SignerCert:   signer,
+				SignerKey:    key,
+				CACerts:      caCerts,
+				PollInterval: 10 * time.Millisecond,
+				Timeout:      tt.timeout,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.Enroll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			assert.Len(t, 2, certs)
+			assert.Equals(t, "device.example.com", certs[0].Subject.CommonName)
+			assert.Equals(t, csr.RawSubjectPublicKeyInfo, certs[0].RawSubjectPublicKeyInfo)
+			assert.Equals(t, s.ca, certs[1])
+		})
+	}
+}
+
+func TestClient_Enroll_renewal(t *testing.T) {
+	s, srv := newTestServer(t, "POSTPKIOperation\nSHA-256\nAES\nRenewal")
+	defer srv.Close()
+	client := NewClient(srv.URL, nil)
+	caCerts, err := client.GetCACert("")
+	assert.FatalError(t, err)
+
+	// Enroll and renew with the issued certificate.
+	csr, signer, key := newTestRequest(t, "secret")
+	certs, err := client.Enroll(&EnrollRequest{CSR: csr, SignerCert: signer, SignerKey: key, CACerts: caCerts})
+	assert.FatalError(t, err)
+
+	csr, err = NewCertificateRequest(&x509.CertificateRequest{Subject: certs[0].Subject}, key, "")
+	assert.FatalError(t, err)
+	renewed, err := client.Enroll(&EnrollRequest{CSR: csr, SignerCert: certs[0], SignerKey: key, CACerts: caCerts, Renewal: true})
+	assert.FatalError(t, err)
+	assert.Equals(t, certs[0].Subject, renewed[0].Subject)
+	assert.NotEquals(t, certs[0].SerialNumber, renewed[0].SerialNumber)
+	assert.Equals(t, s.ca, renewed[1])
+}
+
+func TestClient_Enroll_untrusted(t *testing.T) {
+	s, srv := newTestServer(t, "POSTPKIOperation")
+	defer srv.Close()
+	other, otherSrv := newTestServer(t, "")
+	otherSrv.Close()
+
+	// The responses are signed by another CA.
+	s.signer, s.signerKey = other.ca, other.caKey
+
+	client := NewClient(srv.URL, nil)
+	caCerts, err := client.GetCACert("")
+	assert.FatalError(t, err)
+	csr, signer, key := newTestRequest(t, "secret")
+	_, err = client.Enroll(&EnrollRequest{CSR: csr, SignerCert: signer, SignerKey: key, CACerts: caCerts})
+	if assert.Error(t, err) {
+		assert.HasSuffix(t, err.Error(), "the response is not signed by the CA")
+	}
+}
@@ -0,0 +1,147 @@
+// Package spiffe implements the validation of SPIFFE IDs and X.509 SVIDs, the
+// certificates used as identity documents by SPIFFE workloads.
+//
+// A SPIFFE ID is a URI like spiffe://example.org/ns/prod/sa/web, where
+// example.org is the trust domain. An X509-SVID has the SPIFFE ID as its only
+// URI subject alternative name.
+package spiffe
+
+import (
+	"crypto/x509"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Scheme is the scheme of the SPIFFE IDs.
+const Scheme = "spiffe"
+
+// Files of the SPIFFE Workload API disk layout, as written by the SPIFFE
+// helper: the X509-SVID with its intermediates, the private key in PKCS #8
+// format, and the trust bundle.
+const (
+	SVIDFile   = "svid.pem"
+	KeyFile    = "svid_key.pem"
+	BundleFile = "svid_bundle.pem"
+)
+
+// IsID returns true if the given string looks like a SPIFFE ID.
+func IsID(s string) bool {
+	return strings.HasPrefix(strings.ToLower(s), Scheme+"://")
+}
+
+// ParseID parses and validates the given SPIFFE ID. The trust domain can only
+// contain lowercase letters, numbers, dots, dashes and underscores, and the
+// segments of the path can also contain uppercase letters. Ports, user info,
+// queries and fragments are not allowed.
+func ParseID(rawid string) (*url.URL, error) {
+	if !IsID(rawid) {
+		return nil, errors.Errorf("invalid SPIFFE ID '%s': scheme is not spiffe", rawid)
+	}
+	u, err := url.Parse(rawid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid SPIFFE ID '%s'", rawid)
+	}
+	switch {
+	case !strings.HasPrefix(rawid, Scheme+"://"):
+		return nil, errors.Errorf("invalid SPIFFE ID '%s': scheme must be lowercase", rawid)
+	case u.Host == "":
+		return nil, errors.Errorf("invalid SPIFFE ID '%s': trust domain is missing", rawid)
+	case u.User != nil || u.Port() != "" || u.RawQuery != "" || u.Fragment != "" || u.ForceQuery:
+		return nil, errors.Errorf("invalid SPIFFE ID '%s': user info, port, query and fragment are not allowed", rawid)
+	}
+	for _, c := range u.Host {
+		if !isTrustDomainChar(c) {
+			return nil, errors.Errorf("invalid SPIFFE ID '%s': trust domain contains invalid characters", rawid)
+		}
+	}
+	if u.Path != "" {
+		if u.RawPath != "" {
+			return nil, errors.Errorf("invalid SPIFFE ID '%s': path contains invalid characters", rawid)
+		}
+		for _, segment := range strings.Split(u.Path[1:], "/") {
+			switch segment {
+			case "":
+				return nil, errors.Errorf("invalid SPIFFE ID '%s': path contains empty segments", rawid)
+			case ".", "..":
+				return nil, errors.Errorf("invalid SPIFFE ID '%s': path contains relative segments", rawid)
+			}
+			for _, c := range segment {
+				if !isPathChar(c) {
+					return nil, errors.Errorf("invalid SPIFFE ID '%s': path contains invalid characters", rawid)
+				}
+			}
+		}
+	}
+	return u, nil
+}
+
+func isTrustDomainChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '_'
+}
+
+func isPathChar(c rune) bool {
+	return isTrustDomainChar(c) || (c >= 'A' && c <= 'Z')
+}
+
+// VerifyTrustDomain verifies that the given CA certificates can issue SVIDs
+// in the trust domain td. A certificate with a SPIFFE ID must be in the same
+// trust domain, and the URI name constraints of a certificate must permit the
+// trust domain.
+func VerifyTrustDomain(td string, certs ...*x509.Certificate) error {
+	for _, crt := range certs {
+		for _, u := range crt.URIs {
+			if u.Scheme == Scheme && u.Host != td {
+				return errors.Errorf("trust domain %s does not match the trust domain %s of the CA certificate '%s'", td, u.Host, crt.Subject)
+			}
+		}
+		for _, domain := range crt.ExcludedURIDomains {
+			if matchDomain(td, domain) {
+				return errors.Errorf("trust domain %s is excluded by the name constraints of the CA certificate '%s'", td, crt.Subject)
+			}
+		}
+		if len(crt.PermittedURIDomains) > 0 {
+			var ok bool
+			for _, domain := range crt.PermittedURIDomains {
+				if ok = matchDomain(td, domain); ok {
+					break
+				}
+			}
+			if !ok {
+				return errors.Errorf("trust domain %s is not permitted by the name constraints of the CA certificate '%s'", td, crt.Subject)
+			}
+		}
+	}
+	return nil
+}
+
+// matchDomain returns true if the host matches the domain of an URI name
+// constraint. Constraints starting with a dot match any subdomain, and the
+// rest match the exact host.
+func matchDomain(host, domain string) bool {
+	host, domain = strings.ToLower(host), strings.ToLower(domain)
+	if strings.HasPrefix(domain, ".") {
+		return strings.HasSuffix(host, domain)
+	}
+	return host == domain
+}
+
+// VerifySVID verifies that the given certificate is a valid X509-SVID for the
+// given SPIFFE ID: the ID must be its only URI subject alternative name, it
+// must not be a CA, and it must have the digital signature key usage.
+func VerifySVID(crt *x509.Certificate, id *url.URL) error {
+	if len(crt.URIs) != 1 {
+		return errors.Errorf("certificate is not a valid SVID: it has %d URI SANs, and it must have exactly one", len(crt.URIs))
+	}
+	if got := crt.URIs[0].String(); got != id.String() {
+		return errors.Errorf("certificate is not a valid SVID: SPIFFE ID %s does not match %s", got, id)
+	}
+	if crt.IsCA || crt.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		return errors.New("certificate is not a valid SVID: it must not be a CA")
+	}
+	if crt.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return errors.New("certificate is not a valid SVID: it must have the digital signature key usage")
+	}
+	return nil
+}
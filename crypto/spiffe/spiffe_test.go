@@ -0,0 +1,128 @@
+package spiffe
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func mustURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	assert.FatalError(t, err)
+	return u
+}
+
+func TestIsID(t *testing.T) {
+	assert.True(t, IsID("spiffe://example.org/web"))
+	assert.True(t, IsID("SPIFFE://example.org"))
+	assert.False(t, IsID("https://example.org/web"))
+	assert.False(t, IsID("spiffe:example.org"))
+	assert.False(t, IsID("web.example.org"))
+}
+
+func TestParseID(t *testing.T) {
+	tests := map[string]string{
+		"spiffe://example.org":                    "",
+		"spiffe://example.org/ns/prod/sa/web":     "",
+		"spiffe://my_domain-1.example.org/A.b-c_": "",
+		"https://example.org/web":                 "invalid SPIFFE ID 'https://example.org/web': scheme is not spiffe",
+		"SPIFFE://example.org/web":                "invalid SPIFFE ID 'SPIFFE://example.org/web': scheme must be lowercase",
+		"spiffe:///web":                           "invalid SPIFFE ID 'spiffe:///web': trust domain is missing",
+		"spiffe://Example.org/web":                "invalid SPIFFE ID 'spiffe://Example.org/web': trust domain contains invalid characters",
+		"spiffe://example.org:8443/web":           "invalid SPIFFE ID 'spiffe://example.org:8443/web': user info, port, query and fragment are not allowed",
+		"spiffe://user@example.org/web":           "invalid SPIFFE ID 'spiffe://user@example.org/web': user info, port, query and fragment are not allowed",
+		"spiffe://example.org/web?x=1":            "invalid SPIFFE ID 'spiffe://example.org/web?x=1': user info, port, query and fragment are not allowed",
+		"spiffe://example.org/web#x":              "invalid SPIFFE ID 'spiffe://example.org/web#x': user info, port, query and fragment are not allowed",
+		"spiffe://example.org/":                   "invalid SPIFFE ID 'spiffe://example.org/': path contains empty segments",
+		"spiffe://example.org/ns//web":            "invalid SPIFFE ID 'spiffe://example.org/ns//web': path contains empty segments",
+		"spiffe://example.org/ns/../web":          "invalid SPIFFE ID 'spiffe://example.org/ns/../web': path contains relative segments",
+		"spiffe://example.org/w%65b":              "invalid SPIFFE ID 'spiffe://example.org/w%65b': path contains invalid characters",
+		"spiffe://example.org/we b":               "invalid SPIFFE ID 'spiffe://example.org/we b': path contains invalid characters",
+	}
+	for id, want := range tests {
+		t.Run(id, func(t *testing.T) {
+			u, err := ParseID(id)
+			if want != "" {
+				if assert.Error(t, err) {
+					assert.Equals(t, want, err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, id, u.String())
+		})
+	}
+}
+
+func TestVerifyTrustDomain(t *testing.T) {
+	tests := map[string]struct {
+		crt *x509.Certificate
+		err bool
+	}{
+		"ok no constraints":  {&x509.Certificate{}, false},
+		"ok id":              {&x509.Certificate{URIs: []*url.URL{mustURL(t, "spiffe://example.org")}}, false},
+		"ok other uri":       {&x509.Certificate{URIs: []*url.URL{mustURL(t, "https://ca.example.com")}}, false},
+		"ok permitted":       {&x509.Certificate{PermittedURIDomains: []string{"example.org"}}, false},
+		"ok permitted sub":   {&x509.Certificate{PermittedURIDomains: []string{"example.com", ".org"}}, false},
+		"ok excluded other":  {&x509.Certificate{ExcludedURIDomains: []string{"example.com"}}, false},
+		"fail id":            {&x509.Certificate{URIs: []*url.URL{mustURL(t, "spiffe://example.com")}}, true},
+		"fail not permitted": {&x509.Certificate{PermittedURIDomains: []string{"example.com", ".example.org"}}, true},
+		"fail excluded":      {&x509.Certificate{ExcludedURIDomains: []string{"EXAMPLE.ORG"}}, true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.crt.Subject = pkix.Name{CommonName: "Intermediate CA"}
+			err := VerifyTrustDomain("example.org", &x509.Certificate{}, tc.crt)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestVerifySVID(t *testing.T) {
+	id := mustURL(t, "spiffe://example.org/web")
+	tests := map[string]struct {
+		crt *x509.Certificate
+		err string
+	}{
+		"ok": {&x509.Certificate{
+			URIs:     []*url.URL{id},
+			KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		}, ""},
+		"fail no uris": {&x509.Certificate{
+			KeyUsage: x509.KeyUsageDigitalSignature,
+		}, "certificate is not a valid SVID: it has 0 URI SANs, and it must have exactly one"},
+		"fail two uris": {&x509.Certificate{
+			URIs:     []*url.URL{id, mustURL(t, "https://example.org")},
+			KeyUsage: x509.KeyUsageDigitalSignature,
+		}, "certificate is not a valid SVID: it has 2 URI SANs, and it must have exactly one"},
+		"fail other id": {&x509.Certificate{
+			URIs:     []*url.URL{mustURL(t, "spiffe://example.org/db")},
+			KeyUsage: x509.KeyUsageDigitalSignature,
+		}, "certificate is not a valid SVID: SPIFFE ID spiffe://example.org/db does not match spiffe://example.org/web"},
+		"fail ca": {&x509.Certificate{
+			URIs:     []*url.URL{id},
+			KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		}, "certificate is not a valid SVID: it must not be a CA"},
+		"fail key usage": {&x509.Certificate{
+			URIs:     []*url.URL{id},
+			KeyUsage: x509.KeyUsageKeyEncipherment,
+		}, "certificate is not a valid SVID: it must have the digital signature key usage"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := VerifySVID(tc.crt, id)
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Equals(t, tc.err, err.Error())
+			}
+		})
+	}
+}
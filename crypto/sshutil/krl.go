@@ -0,0 +1,348 @@
+package sshutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// KRL format constants, see PROTOCOL.krl in the OpenSSH sources.
+const (
+	krlMagic         = uint64(0x5353484b524c0a00)
+	krlFormatVersion = uint32(1)
+
+	krlSectionCertificates = byte(1)
+	krlSectionSignature    = byte(4)
+
+	krlSectionCertSerialList = byte(0x20)
+	krlSectionCertKeyID      = byte(0x23)
+)
+
+// KRL is an OpenSSH Key Revocation List. Only the revocation of certificates
+// by serial number and key id is supported.
+type KRL struct {
+	// Version is the version of the KRL, it should be increased every time
+	// the KRL is modified.
+	Version       uint64
+	GeneratedDate time.Time
+	Comment       string
+	Certificates  []*KRLCertificates
+}
+
+// KRLCertificates contains the certificates revoked for a CA key. If CAKey is
+// nil the revocations apply to the certificates of any CA.
+type KRLCertificates struct {
+	CAKey   ssh.PublicKey
+	Serials []uint64
+	KeyIDs  []string
+}
+
+// RevokeCertificate adds the serial number of the given certificate to the
+// KRL, certificates with a serial number 0 are revoked by key id.
+func (k *KRL) RevokeCertificate(cert *ssh.Certificate) {
+	if cert.Serial == 0 {
+		k.RevokeKeyID(cert.SignatureKey, cert.KeyId)
+	} else {
+		k.RevokeSerial(cert.SignatureKey, cert.Serial)
+	}
+}
+
+// RevokeSerial adds the serial number of a certificate signed by the given CA
+// key to the KRL.
+func (k *KRL) RevokeSerial(caKey ssh.PublicKey, serial uint64) {
+	s := k.section(caKey)
+	s.Serials = append(s.Serials, serial)
+}
+
+// RevokeKeyID adds the key id of a certificate signed by the given CA key to
+// the KRL.
+func (k *KRL) RevokeKeyID(caKey ssh.PublicKey, keyID string) {
+	s := k.section(caKey)
+	s.KeyIDs = append(s.KeyIDs, keyID)
+}
+
+// section returns the certificates section for the given CA key, it creates
+// a new one if it does not exist.
+func (k *KRL) section(caKey ssh.PublicKey) *KRLCertificates {
+	for _, s := range k.Certificates {
+		if equalKeys(s.CAKey, caKey) {
+			return s
+		}
+	}
+	s := &KRLCertificates{CAKey: caKey}
+	k.Certificates = append(k.Certificates, s)
+	return s
+}
+
+// IsRevoked returns true if the given certificate is revoked in the KRL.
+func (k *KRL) IsRevoked(cert *ssh.Certificate) bool {
+	for _, s := range k.Certificates {
+		if s.CAKey != nil && !equalKeys(s.CAKey, cert.SignatureKey) {
+			continue
+		}
+		for _, serial := range s.Serials {
+			if serial == cert.Serial {
+				return true
+			}
+		}
+		for _, keyID := range s.KeyIDs {
+			if keyID == cert.KeyId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Marshal returns the KRL in the binary format used by OpenSSH. Serial
+// numbers and key ids are sorted and deduplicated.
+func (k *KRL) Marshal() ([]byte, error) {
+	var w krlWriter
+	w.uint64(krlMagic)
+	w.uint32(krlFormatVersion)
+	w.uint64(k.Version)
+	w.uint64(uint64(k.GeneratedDate.Unix()))
+	w.uint64(0) // flags
+	w.string(nil)
+	w.string([]byte(k.Comment))
+
+	for _, s := range k.Certificates {
+		var sw krlWriter
+		if s.CAKey != nil {
+			sw.string(s.CAKey.Marshal())
+		} else {
+			sw.string(nil)
+		}
+		sw.string(nil)
+
+		if serials := uniqueSerials(s.Serials); len(serials) > 0 {
+			if s.CAKey == nil {
+				return nil, errors.New("error marshaling KRL: serial numbers require a CA key")
+			}
+			var cw krlWriter
+			for _, serial := range serials {
+				if serial == 0 {
+					return nil, errors.New("error marshaling KRL: serial number 0 cannot be revoked")
+				}
+				cw.uint64(serial)
+			}
+			sw.byte(krlSectionCertSerialList)
+			sw.string(cw.Bytes())
+		}
+		if keyIDs := uniqueKeyIDs(s.KeyIDs); len(keyIDs) > 0 {
+			var cw krlWriter
+			for _, keyID := range keyIDs {
+				cw.string([]byte(keyID))
+			}
+			sw.byte(krlSectionCertKeyID)
+			sw.string(cw.Bytes())
+		}
+
+		w.byte(krlSectionCertificates)
+		w.string(sw.Bytes())
+	}
+
+	return w.Bytes(), nil
+}
+
+// ParseKRL parses a KRL in the binary format used by OpenSSH. Only the
+// sections generated by Marshal are supported, signatures are ignored.
+func ParseKRL(b []byte) (*KRL, error) {
+	r := &krlReader{b: b}
+	if magic, ok := r.uint64(); !ok || magic != krlMagic {
+		return nil, errors.New("error parsing KRL: invalid magic")
+	}
+	if v, ok := r.uint32(); !ok || v != krlFormatVersion {
+		return nil, errors.New("error parsing KRL: unsupported format version")
+	}
+
+	k := new(KRL)
+	version, ok1 := r.uint64()
+	date, ok2 := r.uint64()
+	_, ok3 := r.uint64() // flags
+	_, ok4 := r.string() // reserved
+	comment, ok5 := r.string()
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 {
+		return nil, errors.New("error parsing KRL: invalid header")
+	}
+	k.Version = version
+	k.GeneratedDate = time.Unix(int64(date), 0)
+	k.Comment = string(comment)
+
+	for !r.empty() {
+		typ, ok1 := r.byte()
+		data, ok2 := r.string()
+		if !ok1 || !ok2 {
+			return nil, errors.New("error parsing KRL: invalid section")
+		}
+		switch typ {
+		case krlSectionCertificates:
+			s, err := parseKRLCertificates(data)
+			if err != nil {
+				return nil, err
+			}
+			k.Certificates = append(k.Certificates, s)
+		case krlSectionSignature:
+			// Signatures are the last sections
+			return k, nil
+		default:
+			return nil, errors.Errorf("error parsing KRL: unsupported section type %d", typ)
+		}
+	}
+	return k, nil
+}
+
+func parseKRLCertificates(b []byte) (*KRLCertificates, error) {
+	r := &krlReader{b: b}
+	caKey, ok1 := r.string()
+	_, ok2 := r.string() // reserved
+	if !ok1 || !ok2 {
+		return nil, errors.New("error parsing KRL: invalid certificates section")
+	}
+
+	s := new(KRLCertificates)
+	if len(caKey) > 0 {
+		pub, err := ssh.ParsePublicKey(caKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing KRL")
+		}
+		s.CAKey = pub
+	}
+
+	for !r.empty() {
+		typ, ok1 := r.byte()
+		data, ok2 := r.string()
+		if !ok1 || !ok2 {
+			return nil, errors.New("error parsing KRL: invalid certificates section")
+		}
+		cr := &krlReader{b: data}
+		switch typ {
+		case krlSectionCertSerialList:
+			for !cr.empty() {
+				serial, ok := cr.uint64()
+				if !ok {
+					return nil, errors.New("error parsing KRL: invalid serial list")
+				}
+				s.Serials = append(s.Serials, serial)
+			}
+		case krlSectionCertKeyID:
+			for !cr.empty() {
+				keyID, ok := cr.string()
+				if !ok {
+					return nil, errors.New("error parsing KRL: invalid key id list")
+				}
+				s.KeyIDs = append(s.KeyIDs, string(keyID))
+			}
+		default:
+			return nil, errors.Errorf("error parsing KRL: unsupported certificate section type %d", typ)
+		}
+	}
+	return s, nil
+}
+
+func equalKeys(a, b ssh.PublicKey) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
+
+func uniqueSerials(serials []uint64) []uint64 {
+	s := append([]uint64(nil), serials...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	var ret []uint64
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func uniqueKeyIDs(keyIDs []string) []string {
+	s := append([]string(nil), keyIDs...)
+	sort.Strings(s)
+	var ret []string
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// krlWriter writes the SSH wire types used in a KRL.
+type krlWriter struct {
+	bytes.Buffer
+}
+
+func (w *krlWriter) byte(v byte) {
+	w.WriteByte(v)
+}
+
+func (w *krlWriter) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.Write(b[:])
+}
+
+func (w *krlWriter) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.Write(b[:])
+}
+
+func (w *krlWriter) string(v []byte) {
+	w.uint32(uint32(len(v)))
+	w.Write(v)
+}
+
+// krlReader reads the SSH wire types used in a KRL.
+type krlReader struct {
+	b []byte
+}
+
+func (r *krlReader) empty() bool {
+	return len(r.b) == 0
+}
+
+func (r *krlReader) byte() (byte, bool) {
+	if len(r.b) < 1 {
+		return 0, false
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v, true
+}
+
+func (r *krlReader) uint32() (uint32, bool) {
+	if len(r.b) < 4 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v, true
+}
+
+func (r *krlReader) uint64() (uint64, bool) {
+	if len(r.b) < 8 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v, true
+}
+
+func (r *krlReader) string() ([]byte, bool) {
+	n, ok := r.uint32()
+	if !ok || uint64(len(r.b)) < uint64(n) {
+		return nil, false
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v, true
+}
@@ -0,0 +1,124 @@
+package sshutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func mustPublicKey(t *testing.T) ssh.PublicKey {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(&priv.PublicKey)
+	assert.FatalError(t, err)
+	return pub
+}
+
+func TestKRL_MarshalParse(t *testing.T) {
+	ca1, ca2 := mustPublicKey(t), mustPublicKey(t)
+	now := time.Unix(time.Now().Unix(), 0)
+
+	krl := &KRL{Version: 2, GeneratedDate: now, Comment: "test"}
+	krl.RevokeSerial(ca1, 10)
+	krl.RevokeSerial(ca1, 2)
+	krl.RevokeSerial(ca1, 10)
+	krl.RevokeKeyID(ca2, "mariano@smallstep.com")
+	krl.RevokeKeyID(nil, "compromised")
+	krl.RevokeCertificate(&ssh.Certificate{Serial: 0, KeyId: "foo", SignatureKey: ca1})
+	assert.Len(t, 3, krl.Certificates)
+
+	b, err := krl.Marshal()
+	assert.FatalError(t, err)
+
+	got, err := ParseKRL(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, uint64(2), got.Version)
+	assert.Equals(t, now, got.GeneratedDate)
+	assert.Equals(t, "test", got.Comment)
+	if assert.Len(t, 3, got.Certificates) {
+		assert.Equals(t, ca1.Marshal(), got.Certificates[0].CAKey.Marshal())
+		assert.Equals(t, []uint64{2, 10}, got.Certificates[0].Serials)
+		assert.Equals(t, []string{"foo"}, got.Certificates[0].KeyIDs)
+		assert.Equals(t, ca2.Marshal(), got.Certificates[1].CAKey.Marshal())
+		assert.Equals(t, []string{"mariano@smallstep.com"}, got.Certificates[1].KeyIDs)
+		assert.Nil(t, got.Certificates[2].CAKey)
+		assert.Equals(t, []string{"compromised"}, got.Certificates[2].KeyIDs)
+	}
+}
+
+func TestKRL_Marshal_fail(t *testing.T) {
+	ca := mustPublicKey(t)
+	tests := map[string]struct {
+		krl *KRL
+		err string
+	}{
+		"serial without CA": {
+			krl: &KRL{Certificates: []*KRLCertificates{{Serials: []uint64{1}}}},
+			err: "error marshaling KRL: serial numbers require a CA key",
+		},
+		"serial 0": {
+			krl: &KRL{Certificates: []*KRLCertificates{{CAKey: ca, Serials: []uint64{0, 1}}}},
+			err: "error marshaling KRL: serial number 0 cannot be revoked",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := tc.krl.Marshal()
+			if assert.Error(t, err) {
+				assert.Equals(t, tc.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestKRL_IsRevoked(t *testing.T) {
+	ca1, ca2 := mustPublicKey(t), mustPublicKey(t)
+	krl := new(KRL)
+	krl.RevokeSerial(ca1, 1)
+	krl.RevokeKeyID(ca2, "foo")
+	krl.RevokeKeyID(nil, "bar")
+
+	tests := []struct {
+		cert *ssh.Certificate
+		want bool
+	}{
+		{&ssh.Certificate{Serial: 1, KeyId: "foo", SignatureKey: ca1}, true},
+		{&ssh.Certificate{Serial: 1, KeyId: "foo", SignatureKey: ca2}, true},
+		{&ssh.Certificate{Serial: 1, KeyId: "zap", SignatureKey: ca2}, false},
+		{&ssh.Certificate{Serial: 2, KeyId: "foo", SignatureKey: ca1}, false},
+		{&ssh.Certificate{Serial: 2, KeyId: "bar", SignatureKey: ca1}, true},
+	}
+	for i, tc := range tests {
+		assert.Equals(t, tc.want, krl.IsRevoked(tc.cert), i)
+	}
+}
+
+func TestParseKRL_fail(t *testing.T) {
+	valid, err := (&KRL{Comment: "test"}).Marshal()
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		b   []byte
+		err string
+	}{
+		"empty":   {nil, "error parsing KRL: invalid magic"},
+		"magic":   {append([]byte{0}, valid[1:]...), "error parsing KRL: invalid magic"},
+		"version": {append(append([]byte{}, valid[:8]...), 0, 0, 0, 2), "error parsing KRL: unsupported format version"},
+		"header":  {valid[:20], "error parsing KRL: invalid header"},
+		"section": {append(append([]byte{}, valid...), 1, 0), "error parsing KRL: invalid section"},
+		"type":    {append(append([]byte{}, valid...), 9, 0, 0, 0, 0), "error parsing KRL: unsupported section type 9"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseKRL(tc.b)
+			if assert.Error(t, err) {
+				assert.Equals(t, tc.err, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+#!/bin/sh
+
+set -e
+
+OPENSSL=${OPENSSL:-openssl}
+
+# Time-stamping authority
+$OPENSSL req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes -days 36500 \
+    -subj "/CN=Timestamp Root CA" -keyout root_ca.key -out root_ca.crt \
+    -addext "basicConstraints=critical,CA:TRUE" -addext "keyUsage=critical,keyCertSign"
+$OPENSSL req -newkey rsa:2048 -nodes -subj "/CN=Timestamp Authority" -keyout tsa.key -out tsa.csr
+printf "basicConstraints=critical,CA:FALSE\nkeyUsage=critical,digitalSignature\nextendedKeyUsage=critical,timeStamping\n" > tsa.ext
+$OPENSSL x509 -req -in tsa.csr -CA root_ca.crt -CAkey root_ca.key -CAcreateserial \
+    -days 36500 -extfile tsa.ext -out tsa.crt
+
+cat > tsa.cnf <<CNF
+[ tsa ]
+default_tsa = tsa_config
+[ tsa_config ]
+serial = tsa.serial
+signer_cert = tsa.crt
+certs = root_ca.crt
+signer_key = tsa.key
+signer_digest = sha256
+default_policy = 1.2.3.4.1
+digests = sha1, sha256, sha384, sha512
+accuracy = secs:1, millisecs:500
+ess_cert_id_alg = sha256
+tsa_name = yes
+CNF
+echo 01 > tsa.serial
+
+# Request and response
+echo "The quick brown fox jumps over the lazy dog" > data.txt
+$OPENSSL ts -query -data data.txt -sha256 -cert -out data.tsq
+$OPENSSL ts -reply -config tsa.cnf -queryfile data.tsq -out data.tsr
+$OPENSSL ts -reply -config tsa.cnf -in data.tsr -token_out -out data.tst
+
+# Rejected request, sha224 is not accepted by the TSA
+$OPENSSL ts -query -data data.txt -sha224 -out rejected.tsq
+$OPENSSL ts -reply -config tsa.cnf -queryfile rejected.tsq -out rejected.tsr
+
+rm -f data.tsq rejected.tsq root_ca.key root_ca.srl tsa.csr tsa.ext tsa.cnf tsa.serial tsa.key
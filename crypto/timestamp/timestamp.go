@@ -0,0 +1,295 @@
+// Package timestamp implements the Time-Stamp Protocol (TSP) defined in
+// RFC 3161.
+package timestamp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/cms"
+)
+
+// oidTSTInfo is the content type of the encapsulated TSTInfo.
+var oidTSTInfo = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+
+// PKIStatus values, see RFC 3161, section 2.4.2.
+const (
+	statusGranted         = 0
+	statusGrantedWithMods = 1
+)
+
+var failureInfos = []string{
+	0:  "unrecognized or unsupported algorithm",
+	2:  "transaction not permitted or supported",
+	5:  "the data submitted has the wrong format",
+	14: "the TSA's time source is not available",
+	15: "the requested TSA policy is not supported by the TSA",
+	16: "the requested extension is not supported by the TSA",
+	17: "the additional information requested could not be understood or is not available",
+	25: "the request cannot be handled due to system failure",
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// timeStampReq reflects an ASN.1 TimeStampReq. See RFC 3161, section 2.4.1.
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+	Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+// timeStampResp reflects an ASN.1 TimeStampResp. See RFC 3161, section 2.4.2.
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// tstInfo reflects an ASN.1 TSTInfo. See RFC 3161, section 2.4.2.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time        `asn1:"generalized"`
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional,default:false"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+// Request is a time-stamp request.
+type Request struct {
+	HashAlgorithm crypto.Hash
+	HashedMessage []byte
+	Policy        asn1.ObjectIdentifier
+	Nonce         *big.Int
+	Certificates  bool
+}
+
+// NewRequest returns a time-stamp request for the data in the given reader,
+// hashed with the given hash function. The request includes a random nonce
+// and asks the TSA to include its certificate in the response.
+func NewRequest(r io.Reader, h crypto.Hash) (*Request, error) {
+	if !h.Available() {
+		return nil, errors.Errorf("unsupported hash function %s", h)
+	}
+	hh := h.New()
+	if _, err := io.Copy(hh, r); err != nil {
+		return nil, errors.Wrap(err, "error reading data")
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating nonce")
+	}
+	return &Request{
+		HashAlgorithm: h,
+		HashedMessage: hh.Sum(nil),
+		Nonce:         nonce,
+		Certificates:  true,
+	}, nil
+}
+
+// Marshal returns the DER encoding of the request.
+func (r *Request) Marshal() ([]byte, error) {
+	alg, err := cms.DigestAlgorithmIdentifier(r.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	b, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: alg,
+			HashedMessage: r.HashedMessage,
+		},
+		ReqPolicy: r.Policy,
+		Nonce:     r.Nonce,
+		CertReq:   r.Certificates,
+	})
+	return b, errors.Wrap(err, "error marshaling time-stamp request")
+}
+
+// Timestamp is a parsed time-stamp token.
+type Timestamp struct {
+	HashAlgorithm crypto.Hash
+	HashedMessage []byte
+	Time          time.Time
+	Accuracy      time.Duration
+	SerialNumber  *big.Int
+	Policy        asn1.ObjectIdentifier
+	Ordering      bool
+	Nonce         *big.Int
+	// TSA is the name of the TSA if present in the token.
+	TSA string
+	// Certificates are the certificates included in the token.
+	Certificates []*x509.Certificate
+	// RawToken is the DER encoding of the time-stamp token.
+	RawToken   []byte
+	signedData *cms.SignedData
+}
+
+// ParseResponse parses a DER-encoded time-stamp response and returns the
+// time-stamp token in it. It returns an error if the request was rejected.
+func ParseResponse(der []byte) (*Timestamp, error) {
+	var resp timeStampResp
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, errors.Wrap(err, "error parsing time-stamp response")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error parsing time-stamp response: trailing data")
+	}
+
+	switch resp.Status.Status {
+	case statusGranted, statusGrantedWithMods:
+	default:
+		reasons := resp.Status.StatusString
+		for i, s := range failureInfos {
+			if s != "" && resp.Status.FailInfo.At(i) == 1 {
+				reasons = append(reasons, s)
+			}
+		}
+		if len(reasons) == 0 {
+			return nil, errors.Errorf("time-stamp request rejected with status %d", resp.Status.Status)
+		}
+		return nil, errors.Errorf("time-stamp request rejected with status %d: %s",
+			resp.Status.Status, strings.Join(reasons, ", "))
+	}
+
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("error parsing time-stamp response: token not found")
+	}
+	return ParseToken(resp.TimeStampToken.FullBytes)
+}
+
+// ParseToken parses a DER-encoded time-stamp token.
+func ParseToken(der []byte) (*Timestamp, error) {
+	sd, err := cms.ParseSignedData(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing time-stamp token")
+	}
+	if !sd.ContentType.Equal(oidTSTInfo) {
+		return nil, errors.Errorf("error parsing time-stamp token: unsupported content type %s", sd.ContentType)
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.Content, &info); err != nil {
+		return nil, errors.Wrap(err, "error parsing time-stamp token info")
+	}
+	h, err := cms.DigestAlgorithm(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Timestamp{
+		HashAlgorithm: h,
+		HashedMessage: info.MessageImprint.HashedMessage,
+		Time:          info.GenTime,
+		Accuracy: time.Duration(info.Accuracy.Seconds)*time.Second +
+			time.Duration(info.Accuracy.Millis)*time.Millisecond +
+			time.Duration(info.Accuracy.Micros)*time.Microsecond,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy,
+		Ordering:     info.Ordering,
+		Nonce:        info.Nonce,
+		TSA:          parseGeneralName(info.TSA),
+		Certificates: sd.Certificates,
+		RawToken:     der,
+		signedData:   sd,
+	}, nil
+}
+
+// Match checks that the time-stamp token is the response to the given
+// request.
+func (t *Timestamp) Match(req *Request) error {
+	if t.HashAlgorithm != req.HashAlgorithm || !bytes.Equal(t.HashedMessage, req.HashedMessage) {
+		return errors.New("time-stamp token does not match the request: message imprint is different")
+	}
+	if req.Nonce != nil && (t.Nonce == nil || t.Nonce.Cmp(req.Nonce) != 0) {
+		return errors.New("time-stamp token does not match the request: nonce is different")
+	}
+	if req.Policy != nil && !req.Policy.Equal(t.Policy) {
+		return errors.New("time-stamp token does not match the request: policy is different")
+	}
+	return nil
+}
+
+// Verify checks that the time-stamp token is valid for the data in the given
+// reader and returns the certificate of the TSA. If roots is not nil the
+// certificate chain of the TSA is also verified at the time of the token.
+func (t *Timestamp) Verify(r io.Reader, roots *x509.CertPool) (*x509.Certificate, error) {
+	hh := t.HashAlgorithm.New()
+	if _, err := io.Copy(hh, r); err != nil {
+		return nil, errors.Wrap(err, "error reading data")
+	}
+	if !bytes.Equal(hh.Sum(nil), t.HashedMessage) {
+		return nil, errors.New("time-stamp token does not match the data")
+	}
+
+	var opts *x509.VerifyOptions
+	if roots != nil {
+		opts = &x509.VerifyOptions{
+			Roots:       roots,
+			CurrentTime: t.Time,
+			KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		}
+	}
+	signers, err := t.signedData.Verify(nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(signers) != 1 {
+		return nil, errors.New("time-stamp token must have exactly one signer")
+	}
+	return signers[0], nil
+}
+
+// parseGeneralName returns the string representation of an explicitly tagged
+// GeneralName if it is a directoryName, dNSName or uniformResourceIdentifier.
+func parseGeneralName(raw asn1.RawValue) string {
+	var name asn1.RawValue
+	if len(raw.Bytes) == 0 {
+		return ""
+	}
+	if _, err := asn1.Unmarshal(raw.Bytes, &name); err != nil || name.Class != asn1.ClassContextSpecific {
+		return ""
+	}
+	switch name.Tag {
+	case 2, 6: // dNSName, uniformResourceIdentifier
+		return string(name.Bytes)
+	case 4: // directoryName
+		var rdn pkix.RDNSequence
+		if _, err := asn1.Unmarshal(name.Bytes, &rdn); err != nil {
+			return ""
+		}
+		var n pkix.Name
+		n.FillFromRDNSequence(&rdn)
+		return n.String()
+	}
+	return ""
+}
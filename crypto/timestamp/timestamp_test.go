@@ -0,0 +1,117 @@
+package timestamp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+func mustReadFile(t *testing.T, filename string) []byte {
+	b, err := ioutil.ReadFile(filename)
+	assert.FatalError(t, err)
+	return b
+}
+
+func TestRequest_Marshal(t *testing.T) {
+	req, err := NewRequest(bytes.NewReader(mustReadFile(t, "testdata/data.txt")), crypto.SHA256)
+	assert.FatalError(t, err)
+	assert.True(t, req.Certificates)
+	assert.NotNil(t, req.Nonce)
+
+	b, err := req.Marshal()
+	assert.FatalError(t, err)
+	var got timeStampReq
+	rest, err := asn1.Unmarshal(b, &got)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, rest)
+	assert.Equals(t, 1, got.Version)
+	assert.Equals(t, req.HashedMessage, got.MessageImprint.HashedMessage)
+	assert.Equals(t, 0, req.Nonce.Cmp(got.Nonce))
+	assert.True(t, got.CertReq)
+
+	req.HashAlgorithm = crypto.MD5
+	_, err = req.Marshal()
+	assert.Error(t, err)
+}
+
+func TestParseResponse(t *testing.T) {
+	tsr := mustReadFile(t, "testdata/data.tsr")
+	tst := mustReadFile(t, "testdata/data.tst")
+
+	ts, err := ParseResponse(tsr)
+	assert.FatalError(t, err)
+	assert.Equals(t, tst, ts.RawToken)
+	assert.Equals(t, crypto.SHA256, ts.HashAlgorithm)
+	assert.Equals(t, asn1.ObjectIdentifier{1, 2, 3, 4, 1}, ts.Policy)
+	assert.Equals(t, int64(2), ts.SerialNumber.Int64())
+	assert.Equals(t, 1500*time.Millisecond, ts.Accuracy)
+	assert.Equals(t, "CN=Timestamp Authority", ts.TSA)
+	assert.Len(t, 2, ts.Certificates)
+	assert.NotNil(t, ts.Nonce)
+	assert.False(t, ts.Time.IsZero())
+
+	_, err = ParseResponse(mustReadFile(t, "testdata/rejected.tsr"))
+	assert.Error(t, err)
+	assert.HasPrefix(t, err.Error(), "time-stamp request rejected with status 2")
+
+	_, err = ParseResponse(append(tsr, 0))
+	assert.Error(t, err)
+	_, err = ParseResponse(tst)
+	assert.Error(t, err)
+}
+
+func TestTimestamp_Match(t *testing.T) {
+	data := mustReadFile(t, "testdata/data.txt")
+	ts, err := ParseToken(mustReadFile(t, "testdata/data.tst"))
+	assert.FatalError(t, err)
+
+	req, err := NewRequest(bytes.NewReader(data), crypto.SHA256)
+	assert.FatalError(t, err)
+	assert.Error(t, ts.Match(req))
+
+	req.Nonce = ts.Nonce
+	assert.NoError(t, ts.Match(req))
+
+	req.Policy = asn1.ObjectIdentifier{1, 2, 3, 4, 2}
+	assert.Error(t, ts.Match(req))
+
+	req, err = NewRequest(bytes.NewReader(data[1:]), crypto.SHA256)
+	assert.FatalError(t, err)
+	req.Nonce = ts.Nonce
+	assert.Error(t, ts.Match(req))
+}
+
+func TestTimestamp_Verify(t *testing.T) {
+	data := mustReadFile(t, "testdata/data.txt")
+	ts, err := ParseToken(mustReadFile(t, "testdata/data.tst"))
+	assert.FatalError(t, err)
+
+	root, err := pemutil.ReadCertificate("testdata/root_ca.crt")
+	assert.FatalError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	tsa, err := pemutil.ReadCertificate("testdata/tsa.crt")
+	assert.FatalError(t, err)
+
+	crt, err := ts.Verify(bytes.NewReader(data), roots)
+	assert.FatalError(t, err)
+	assert.Equals(t, tsa.Raw, crt.Raw)
+
+	crt, err = ts.Verify(bytes.NewReader(data), nil)
+	assert.FatalError(t, err)
+	assert.Equals(t, tsa.Raw, crt.Raw)
+
+	_, err = ts.Verify(bytes.NewReader(data[1:]), roots)
+	assert.Error(t, err)
+
+	_, err = ts.Verify(bytes.NewReader(data), x509.NewCertPool())
+	assert.Error(t, err)
+}
@@ -0,0 +1,190 @@
+package tpm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// OIDAttestation is the ASN.1 object identifier of the certificate request
+// extension with the attestation of the key.
+var OIDAttestation = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 2}
+
+// OIDEKPublicKeyHash is the ASN.1 object identifier of the AK certificate
+// extension that identifies the EK of the TPM. Its value is an OCTET STRING
+// with the SHA-256 hash of the DER encoded PKIX public key of the EK, and it
+// must be added by the CA that issues the AK certificate after the credential
+// activation with the EK.
+var OIDEKPublicKeyHash = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 3}
+
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// Attestation is the attestation of a key created in a TPM. It contains the
+// certification of the creation of the key signed by an attestation key (AK),
+// and the endorsement key (EK) certificates that identify the TPM.
+//
+// The attestation does not prove that the AK and the EK are in the same TPM,
+// this is done with the AK certificates, issued by a CA after a credential
+// activation with the EK, that identify the EK with the OIDEKPublicKeyHash
+// extension.
+type Attestation struct {
+	// EKCertificates are the DER encoded EK certificates stored in the TPM.
+	EKCertificates [][]byte `json:"ekCertificates,omitempty" asn1:"optional,omitempty,explicit,tag:0"`
+	// EKPublic is the DER encoded PKIX public key of the EK.
+	EKPublic []byte `json:"ekPublic"`
+	// AKPublic is the TPMT_PUBLIC structure of the AK.
+	AKPublic []byte `json:"akPublic"`
+	// AKCertificates are the DER encoded AK certificates, the first one is
+	// the AK certificate and the rest are intermediates.
+	AKCertificates [][]byte `json:"akCertificates,omitempty" asn1:"optional,omitempty,explicit,tag:1"`
+	// KeyPublic is the TPMT_PUBLIC structure of the attested key.
+	KeyPublic []byte `json:"keyPublic"`
+	// CreationData is the TPMS_ATTEST structure with the certification of
+	// the creation of the key.
+	CreationData []byte `json:"creationData"`
+	// CreationSignature is the TPMT_SIGNATURE of the CreationData made with
+	// the AK.
+	CreationSignature []byte `json:"creationSignature"`
+}
+
+// VerifyEK verifies the EK certificate using the given roots, and checks that
+// it certifies the EK in the attestation. It returns the EK certificate.
+func (a *Attestation) VerifyEK(roots *x509.CertPool) (*x509.Certificate, error) {
+	if len(a.EKCertificates) == 0 {
+		return nil, errors.New("error verifying EK: attestation does not contain an EK certificate")
+	}
+	crt, err := verifyChain(a.EKCertificates, roots, a.EKPublic, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "error verifying EK")
+	}
+	return crt, nil
+}
+
+// VerifyEKBinding checks that the given AK certificate identifies the EK in
+// the attestation using the OIDEKPublicKeyHash extension. Without it, the EK
+// certificate of any TPM, that is public, could be added to an attestation.
+func (a *Attestation) VerifyEKBinding(ak *x509.Certificate) error {
+	sum := sha256.Sum256(a.EKPublic)
+	for _, ext := range ak.Extensions {
+		if !ext.Id.Equal(OIDEKPublicKeyHash) {
+			continue
+		}
+		var hash []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &hash); err != nil || len(rest) > 0 {
+			return errors.New("error verifying EK: invalid EK public key hash extension in the AK certificate")
+		}
+		if !bytes.Equal(hash, sum[:]) {
+			return errors.New("error verifying EK: the AK certificate does not identify the EK")
+		}
+		return nil
+	}
+	return errors.New("error verifying EK: the AK certificate does not contain the EK public key hash extension")
+}
+
+// Extension returns the attestation as a certificate request extension.
+func (a *Attestation) Extension() (pkix.Extension, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling attestation")
+	}
+	return pkix.Extension{
+		Id:    OIDAttestation,
+		Value: b,
+	}, nil
+}
+
+// ParseAttestation parses a JSON encoded attestation.
+func ParseAttestation(b []byte) (*Attestation, error) {
+	var a Attestation
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, errors.Wrap(err, "error parsing attestation")
+	}
+	return &a, nil
+}
+
+// ReadAttestation reads a JSON encoded attestation from the given file.
+func ReadAttestation(filename string) (*Attestation, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	a, err := ParseAttestation(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	return a, nil
+}
+
+// AttestationFromCSR returns the attestation in the given certificate
+// request.
+func AttestationFromCSR(csr *x509.CertificateRequest) (*Attestation, error) {
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(OIDAttestation) {
+			continue
+		}
+		var a Attestation
+		rest, err := asn1.Unmarshal(ext.Value, &a)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing attestation")
+		}
+		if len(rest) > 0 {
+			return nil, errors.New("error parsing attestation: trailing data")
+		}
+		return &a, nil
+	}
+	return nil, errors.New("certificate request does not contain an attestation")
+}
+
+// verifyChain verifies the given chain of DER certificates using the roots,
+// and checks that the first certificate certifies the DER public key pub. If
+// isEK is true, a critical subject alternative name in the first certificate
+// is accepted.
+func verifyChain(chain [][]byte, roots *x509.CertPool, pub []byte, isEK bool) (*x509.Certificate, error) {
+	intermediates := x509.NewCertPool()
+	var leaf *x509.Certificate
+	for i, b := range chain {
+		crt, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing certificate")
+		}
+		if i == 0 && isEK {
+			// EK certificates usually have a critical subject alternative
+			// name extension with only a directory name, that is not
+			// supported.
+			crt.UnhandledCriticalExtensions = removeOID(crt.UnhandledCriticalExtensions, oidSubjectAltName)
+		}
+		if i == 0 {
+			leaf = crt
+		} else {
+			intermediates.AddCert(crt)
+		}
+	}
+	if b, err := x509.MarshalPKIXPublicKey(leaf.PublicKey); err != nil || !bytes.Equal(b, pub) {
+		return nil, errors.New("certificate public key does not match")
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, err
+	}
+	return leaf, nil
+}
+
+// removeOID returns the given object identifiers without oid.
+func removeOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) []asn1.ObjectIdentifier {
+	var ret []asn1.ObjectIdentifier
+	for _, o := range oids {
+		if !o.Equal(oid) {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,126 @@
+package tpm
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func mustCertificate(t *testing.T, pub interface{}, parent *x509.Certificate, signer interface{}) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent = tmpl
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func TestAttestation_VerifyEK(t *testing.T) {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	ekKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	root := mustCertificate(t, &rootKey.PublicKey, nil, rootKey)
+	ek := mustCertificate(t, &ekKey.PublicKey, root, rootKey)
+	ekPublic, err := x509.MarshalPKIXPublicKey(&ekKey.PublicKey)
+	assert.FatalError(t, err)
+	rootPublic, err := x509.MarshalPKIXPublicKey(&rootKey.PublicKey)
+	assert.FatalError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	att := &Attestation{EKCertificates: [][]byte{ek.Raw}, EKPublic: ekPublic}
+	crt, err := att.VerifyEK(roots)
+	assert.FatalError(t, err)
+	assert.Equals(t, ek.Raw, crt.Raw)
+
+	tests := map[string]struct {
+		att   *Attestation
+		roots *x509.CertPool
+		err   string
+	}{
+		"no certificate": {&Attestation{EKPublic: ekPublic}, roots, "error verifying EK: attestation does not contain an EK certificate"},
+		"bad public key": {&Attestation{EKCertificates: [][]byte{ek.Raw}, EKPublic: rootPublic}, roots, "error verifying EK: certificate public key does not match"},
+		"bad roots":      {att, x509.NewCertPool(), "error verifying EK: x509: certificate signed by unknown authority"},
+		"bad cert":       {&Attestation{EKCertificates: [][]byte{[]byte("foo")}, EKPublic: ekPublic}, roots, "error verifying EK: error parsing certificate"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := tt.att.VerifyEK(tt.roots)
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestAttestationFromCSR_fail(t *testing.T) {
+	_, err := AttestationFromCSR(&x509.CertificateRequest{})
+	if assert.Error(t, err) {
+		assert.Equals(t, "certificate request does not contain an attestation", err.Error())
+	}
+	_, err = AttestationFromCSR(&x509.CertificateRequest{Extensions: []pkix.Extension{{Id: OIDAttestation, Value: []byte("foo")}}})
+	if assert.Error(t, err) {
+		assert.HasPrefix(t, err.Error(), "error parsing attestation")
+	}
+}
+
+func TestAttestation_VerifyEKBinding(t *testing.T) {
+	ekPublic := []byte("ek public key")
+	sum := sha256.Sum256(ekPublic)
+	mustExtension := func(v interface{}) pkix.Extension {
+		b, err := asn1.Marshal(v)
+		assert.FatalError(t, err)
+		return pkix.Extension{Id: OIDEKPublicKeyHash, Value: b}
+	}
+
+	att := &Attestation{EKPublic: ekPublic}
+	ak := &x509.Certificate{Extensions: []pkix.Extension{mustExtension(sum[:])}}
+	assert.NoError(t, att.VerifyEKBinding(ak))
+
+	other := sha256.Sum256([]byte("other public key"))
+	tests := map[string]struct {
+		ak  *x509.Certificate
+		err string
+	}{
+		"no extension":  {&x509.Certificate{}, "error verifying EK: the AK certificate does not contain the EK public key hash extension"},
+		"other EK":      {&x509.Certificate{Extensions: []pkix.Extension{mustExtension(other[:])}}, "error verifying EK: the AK certificate does not identify the EK"},
+		"bad extension": {&x509.Certificate{Extensions: []pkix.Extension{{Id: OIDEKPublicKeyHash, Value: []byte("foo")}}}, "error verifying EK: invalid EK public key hash extension in the AK certificate"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := att.VerifyEKBinding(tt.ak)
+			if assert.Error(t, err) {
+				assert.Equals(t, tt.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestRemoveOID(t *testing.T) {
+	oidKeyUsage := asn1.ObjectIdentifier{2, 5, 29, 15}
+	oids := []asn1.ObjectIdentifier{oidKeyUsage, oidSubjectAltName}
+	assert.Equals(t, []asn1.ObjectIdentifier{oidKeyUsage}, removeOID(oids, oidSubjectAltName))
+	assert.Equals(t, oids, removeOID(oids, asn1.ObjectIdentifier{1, 2, 3}))
+	assert.Nil(t, removeOID(nil, oidSubjectAltName))
+}
@@ -0,0 +1,349 @@
+// +build tpm
+
+package tpm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"io"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"github.com/pkg/errors"
+)
+
+// ekCertIndexRSA is the NV index of the RSA EK certificate defined in the TCG
+// EK Credential Profile.
+const ekCertIndexRSA tpmutil.Handle = 0x01c00002
+
+const keyAttributes = tpm2.FlagSign | tpm2.FlagFixedTPM | tpm2.FlagFixedParent |
+	tpm2.FlagSensitiveDataOrigin | tpm2.FlagUserWithAuth
+
+// Open opens the TPM in the given device, e.g. /dev/tpmrm0. If no device is
+// given the default one is used.
+func Open(device string) (*TPM, error) {
+	var paths []string
+	if device != "" {
+		paths = append(paths, device)
+	}
+	rw, err := tpm2.OpenTPM(paths...)
+	if err != nil {
+		if device == "" {
+			return nil, errors.Wrap(err, "error opening TPM")
+		}
+		return nil, errors.Wrapf(err, "error opening TPM %s", device)
+	}
+	return &TPM{rw: rw}, nil
+}
+
+// srkTemplate is the template of the storage root key, it is the ECC SRK
+// template defined in the TCG TPM v2.0 Provisioning Guidance. The same key is
+// created every time with the same template.
+var srkTemplate = tpm2.Public{
+	Type:       tpm2.AlgECC,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagStorageDefault | tpm2.FlagNoDA,
+	ECCParameters: &tpm2.ECCParams{
+		Symmetric: &tpm2.SymScheme{
+			Alg:     tpm2.AlgAES,
+			KeyBits: 128,
+			Mode:    tpm2.AlgCFB,
+		},
+		CurveID: tpm2.CurveNISTP256,
+	},
+}
+
+// ekTemplate is the default RSA endorsement key template defined in the TCG
+// EK Credential Profile. The EK certificate, if present, certifies this key.
+var ekTemplate = tpm2.Public{
+	Type:    tpm2.AlgRSA,
+	NameAlg: tpm2.AlgSHA256,
+	Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin |
+		tpm2.FlagAdminWithPolicy | tpm2.FlagRestricted | tpm2.FlagDecrypt,
+	AuthPolicy: []byte{
+		0x83, 0x71, 0x97, 0x67, 0x44, 0x84, 0xB3, 0xF8, 0x1A, 0x90, 0xCC, 0x8D,
+		0x46, 0xA5, 0xD7, 0x24, 0xFD, 0x52, 0xD7, 0x6E, 0x06, 0x52, 0x0B, 0x64,
+		0xF2, 0xA1, 0xDA, 0x1B, 0x33, 0x14, 0x69, 0xAA,
+	},
+	RSAParameters: &tpm2.RSAParams{
+		Symmetric: &tpm2.SymScheme{
+			Alg:     tpm2.AlgAES,
+			KeyBits: 128,
+			Mode:    tpm2.AlgCFB,
+		},
+		KeyBits:    2048,
+		ModulusRaw: make([]byte, 256),
+	},
+}
+
+// withKeys loads the SRK and the given keys, and calls fn with the handles of
+// the keys. All the handles are flushed after fn returns.
+func (t *TPM) withKeys(fn func(handles []tpmutil.Handle) error, keys ...*Key) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	srk, _, err := tpm2.CreatePrimary(t.rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", srkTemplate)
+	if err != nil {
+		return errors.Wrap(err, "error creating SRK")
+	}
+	defer tpm2.FlushContext(t.rw, srk)
+
+	handles := make([]tpmutil.Handle, 0, len(keys))
+	defer func() {
+		for _, h := range handles {
+			tpm2.FlushContext(t.rw, h)
+		}
+	}()
+	for _, k := range keys {
+		h, _, err := tpm2.Load(t.rw, srk, "", k.Public, k.Private)
+		if err != nil {
+			return errors.Wrap(err, "error loading key in the TPM")
+		}
+		handles = append(handles, h)
+	}
+	return fn(handles)
+}
+
+// CreateKey creates a new signing key in the TPM. The key type kty can be EC
+// or RSA, the curve crv is only used with EC keys, and the size with RSA keys.
+// P-256 and 2048 bits are used by default.
+func (t *TPM) CreateKey(kty, crv string, size int) (*Key, error) {
+	tmpl, err := keyTemplate(kty, crv, size)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Attributes = keyAttributes
+	return t.createKey(tmpl)
+}
+
+// CreateAK creates a new attestation key (AK) in the TPM. The AK is a
+// restricted signing key, the TPM only signs with it the data generated by
+// the TPM, like the certification of the creation of a key. The key type kty
+// can be EC or RSA.
+func (t *TPM) CreateAK(kty string) (*Key, error) {
+	tmpl, err := keyTemplate(kty, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Attributes = tpm2.FlagSignerDefault
+	switch tmpl.Type {
+	case tpm2.AlgECC:
+		tmpl.ECCParameters.Sign = &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA256}
+	case tpm2.AlgRSA:
+		tmpl.RSAParameters.Sign = &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA256}
+	}
+	return t.createKey(tmpl)
+}
+
+func (t *TPM) createKey(tmpl tpm2.Public) (*Key, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	srk, _, err := tpm2.CreatePrimary(t.rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", srkTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating SRK")
+	}
+	defer tpm2.FlushContext(t.rw, srk)
+
+	private, public, _, creationHash, ticket, err := tpm2.CreateKey(t.rw, srk, tpm2.PCRSelection{}, "", "", tmpl)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating key in the TPM")
+	}
+	creationTicket, err := tpmutil.Pack(ticket)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding creation ticket")
+	}
+	return &Key{
+		Public:         public,
+		Private:        private,
+		CreationHash:   creationHash,
+		CreationTicket: creationTicket,
+	}, nil
+}
+
+// keyTemplate returns the template for a key with the given type, curve and
+// size.
+func keyTemplate(kty, crv string, size int) (tpm2.Public, error) {
+	switch kty {
+	case "", "EC":
+		var curve tpm2.EllipticCurve
+		switch crv {
+		case "", "P-256":
+			curve = tpm2.CurveNISTP256
+		case "P-384":
+			curve = tpm2.CurveNISTP384
+		default:
+			return tpm2.Public{}, errors.Errorf("unsupported curve '%s'", crv)
+		}
+		return tpm2.Public{
+			Type:    tpm2.AlgECC,
+			NameAlg: tpm2.AlgSHA256,
+			ECCParameters: &tpm2.ECCParams{
+				CurveID: curve,
+			},
+		}, nil
+	case "RSA":
+		switch {
+		case size == 0:
+			size = 2048
+		case size < 2048:
+			return tpm2.Public{}, errors.Errorf("invalid RSA key size %d, the minimum size is 2048", size)
+		}
+		return tpm2.Public{
+			Type:    tpm2.AlgRSA,
+			NameAlg: tpm2.AlgSHA256,
+			RSAParameters: &tpm2.RSAParams{
+				KeyBits: uint16(size),
+			},
+		}, nil
+	default:
+		return tpm2.Public{}, errors.Errorf("unsupported key type '%s'", kty)
+	}
+}
+
+// PublicKey returns the public key of the TPM key.
+func (k *Key) PublicKey() (crypto.PublicKey, error) {
+	pub, err := tpm2.DecodePublic(k.Public)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding TPM public key")
+	}
+	key, err := pub.Key()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding TPM public key")
+	}
+	return key, nil
+}
+
+// Signer returns a crypto.Signer that signs using the given TPM key.
+func (t *TPM) Signer(k *Key) (crypto.Signer, error) {
+	pub, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return &signer{tpm: t, key: k, pub: pub}, nil
+}
+
+// signer implements crypto.Signer using a key in the TPM.
+type signer struct {
+	tpm *TPM
+	key *Key
+	pub crypto.PublicKey
+}
+
+// Public returns the public key of the signer.
+func (s *signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs the given digest using the TPM. ECDSA signatures are returned in
+// ASN.1 format like in crypto/ecdsa.
+func (s *signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	alg, err := tpm2.HashToAlgorithm(opts.HashFunc())
+	if err != nil {
+		return nil, errors.Errorf("unsupported hash function %v", opts.HashFunc())
+	}
+	scheme := &tpm2.SigScheme{Hash: alg}
+	switch s.pub.(type) {
+	case *ecdsa.PublicKey:
+		scheme.Alg = tpm2.AlgECDSA
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			scheme.Alg = tpm2.AlgRSAPSS
+		} else {
+			scheme.Alg = tpm2.AlgRSASSA
+		}
+	default:
+		return nil, errors.Errorf("unsupported public key type %T", s.pub)
+	}
+
+	var sig *tpm2.Signature
+	if err := s.tpm.withKeys(func(handles []tpmutil.Handle) (err error) {
+		sig, err = tpm2.Sign(s.tpm.rw, handles[0], "", digest, nil, scheme)
+		return errors.Wrap(err, "error signing with the TPM")
+	}, s.key); err != nil {
+		return nil, err
+	}
+
+	if sig.ECC != nil {
+		return asn1.Marshal(struct {
+			R, S *big.Int
+		}{sig.ECC.R, sig.ECC.S})
+	}
+	return sig.RSA.Signature, nil
+}
+
+// Attest certifies the creation of the key k using the attestation key ak,
+// and returns the attestation with the EK of the TPM. The nonce is included
+// in the certification to prevent replay attacks, it can be empty.
+func (t *TPM) Attest(k, ak *Key, nonce []byte) (*Attestation, error) {
+	var ticket tpm2.Ticket
+	if _, err := tpmutil.Unpack(k.CreationTicket, &ticket); err != nil {
+		return nil, errors.Wrap(err, "error decoding creation ticket")
+	}
+	akPub, err := tpm2.DecodePublic(ak.Public)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding AK")
+	}
+	if akPub.Attributes&akAttributes != akAttributes {
+		return nil, errors.New("error attesting key: the attestation key is not an AK")
+	}
+
+	var scheme tpm2.SigScheme
+	switch {
+	case akPub.ECCParameters != nil && akPub.ECCParameters.Sign != nil:
+		scheme = *akPub.ECCParameters.Sign
+	case akPub.RSAParameters != nil && akPub.RSAParameters.Sign != nil:
+		scheme = *akPub.RSAParameters.Sign
+	default:
+		return nil, errors.New("error attesting key: the attestation key does not have a signing scheme")
+	}
+
+	att := &Attestation{
+		AKPublic:  ak.Public,
+		KeyPublic: k.Public,
+	}
+	if err := t.withKeys(func(handles []tpmutil.Handle) (err error) {
+		att.CreationData, att.CreationSignature, err = tpm2.CertifyCreation(t.rw, "", handles[0], handles[1], nonce, k.CreationHash, scheme, ticket)
+		return errors.Wrap(err, "error certifying key creation")
+	}, k, ak); err != nil {
+		return nil, err
+	}
+
+	if att.EKPublic, att.EKCertificates, err = t.endorsement(); err != nil {
+		return nil, err
+	}
+	return att, nil
+}
+
+// endorsement returns the DER encoded public key of the RSA EK, and its
+// certificate if present.
+func (t *TPM) endorsement() ([]byte, [][]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, pub, err := tpm2.CreatePrimary(t.rw, tpm2.HandleEndorsement, tpm2.PCRSelection{}, "", "", ekTemplate)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating EK")
+	}
+	defer tpm2.FlushContext(t.rw, h)
+	ekPublic, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error marshaling EK")
+	}
+
+	// Not all the TPMs have an EK certificate.
+	b, err := tpm2.NVReadEx(t.rw, ekCertIndexRSA, tpm2.HandleOwner, "", 0)
+	if err != nil {
+		return ekPublic, nil, nil
+	}
+	// The certificate in the NV index might be padded.
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &raw); err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing EK certificate")
+	}
+	return ekPublic, [][]byte{raw.FullBytes}, nil
+}
@@ -0,0 +1,50 @@
+// +build !tpm
+
+package tpm
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// Open returns an error, step was compiled without the tpm build tag.
+func Open(device string) (*TPM, error) {
+	return nil, errors.New("TPM is not supported: step was compiled without the tpm build tag")
+}
+
+// CreateKey returns an error, step was compiled without the tpm build tag.
+func (t *TPM) CreateKey(kty, crv string, size int) (*Key, error) {
+	return nil, errors.New("TPM is not supported: step was compiled without the tpm build tag")
+}
+
+// CreateAK returns an error, step was compiled without the tpm build tag.
+func (t *TPM) CreateAK(kty string) (*Key, error) {
+	return nil, errors.New("TPM is not supported: step was compiled without the tpm build tag")
+}
+
+// Signer returns an error, step was compiled without the tpm build tag.
+func (t *TPM) Signer(k *Key) (crypto.Signer, error) {
+	return nil, errors.New("TPM is not supported: step was compiled without the tpm build tag")
+}
+
+// Attest returns an error, step was compiled without the tpm build tag.
+func (t *TPM) Attest(k, ak *Key, nonce []byte) (*Attestation, error) {
+	return nil, errors.New("TPM is not supported: step was compiled without the tpm build tag")
+}
+
+// PublicKey returns an error, step was compiled without the tpm build tag.
+func (k *Key) PublicKey() (crypto.PublicKey, error) {
+	return nil, errors.New("TPM keys are not supported: step was compiled without the tpm build tag")
+}
+
+// Verify returns an error, step was compiled without the tpm build tag.
+func (a *Attestation) Verify(nonce []byte, akRoots *x509.CertPool) (crypto.PublicKey, error) {
+	return nil, errors.New("TPM attestations are not supported: step was compiled without the tpm build tag")
+}
+
+// VerifyAK returns an error, step was compiled without the tpm build tag.
+func (a *Attestation) VerifyAK(roots *x509.CertPool) (*x509.Certificate, error) {
+	return nil, errors.New("TPM attestations are not supported: step was compiled without the tpm build tag")
+}
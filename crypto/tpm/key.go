@@ -0,0 +1,78 @@
+package tpm
+
+import (
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// PEMBlockType is the type of the PEM blocks used to store TPM keys.
+const PEMBlockType = "TPM KEY"
+
+// Key is a key created in a TPM. The private part is encrypted by the TPM and
+// it can only be used by the TPM that created the key.
+type Key struct {
+	// Public is the TPMT_PUBLIC structure of the key.
+	Public []byte
+	// Private is the private part of the key encrypted by the TPM.
+	Private []byte
+	// CreationHash is the hash of the creation data of the key.
+	CreationHash []byte
+	// CreationTicket is the TPMT_TK_CREATION structure of the key, it's used
+	// to certify the creation of the key.
+	CreationTicket []byte
+}
+
+// MarshalPEM returns the PEM encoding of the key.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling TPM key")
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  PEMBlockType,
+		Bytes: b,
+	}), nil
+}
+
+// ParseKey parses a TPM key in PEM format.
+func ParseKey(b []byte) (*Key, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != PEMBlockType {
+		return nil, errors.New("error decoding TPM key: not a valid PEM encoded block")
+	}
+	var k Key
+	rest, err := asn1.Unmarshal(block.Bytes, &k)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing TPM key")
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("error parsing TPM key: trailing data")
+	}
+	return &k, nil
+}
+
+// ReadKey reads a TPM key from the given file.
+func ReadKey(filename string) (*Key, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	k, err := ParseKey(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	return k, nil
+}
+
+// IsKeyFile returns true if the given file contains a TPM key.
+func IsKeyFile(filename string) bool {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(b)
+	return block != nil && block.Type == PEMBlockType
+}
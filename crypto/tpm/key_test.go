@@ -0,0 +1,130 @@
+// +build tpm
+
+package tpm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"github.com/smallstep/assert"
+)
+
+// mustECCPublic returns a new ECDSA key and its TPM public area with the
+// given attributes.
+func mustECCPublic(t *testing.T, attrs tpm2.KeyProp, scheme *tpm2.SigScheme) (*ecdsa.PrivateKey, []byte) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	x, y := make([]byte, 32), make([]byte, 32)
+	xb, yb := priv.X.Bytes(), priv.Y.Bytes()
+	copy(x[32-len(xb):], xb)
+	copy(y[32-len(yb):], yb)
+	pub := tpm2.Public{
+		Type:       tpm2.AlgECC,
+		NameAlg:    tpm2.AlgSHA256,
+		Attributes: attrs,
+		ECCParameters: &tpm2.ECCParams{
+			Sign:    scheme,
+			CurveID: tpm2.CurveNISTP256,
+			Point:   tpm2.ECPoint{XRaw: x, YRaw: y},
+		},
+	}
+	b, err := pub.Encode()
+	assert.FatalError(t, err)
+	return priv, b
+}
+
+func TestKey_MarshalParse(t *testing.T) {
+	priv, public := mustECCPublic(t, keyAttributes, nil)
+	ticket, err := tpmutil.Pack(tpm2.Ticket{Type: 0x8021, Hierarchy: tpm2.HandleOwner, Digest: []byte{1, 2, 3}})
+	assert.FatalError(t, err)
+	k := &Key{
+		Public:         public,
+		Private:        []byte("private"),
+		CreationHash:   []byte("hash"),
+		CreationTicket: ticket,
+	}
+
+	b, err := k.MarshalPEM()
+	assert.FatalError(t, err)
+	got, err := ParseKey(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, k, got)
+
+	pub, err := got.PublicKey()
+	assert.FatalError(t, err)
+	assert.Equals(t, &priv.PublicKey, pub)
+
+	dir, err := ioutil.TempDir("", "tpm")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "key.tpm")
+	assert.FatalError(t, ioutil.WriteFile(filename, b, 0600))
+	assert.True(t, IsKeyFile(filename))
+	got, err = ReadKey(filename)
+	assert.FatalError(t, err)
+	assert.Equals(t, k, got)
+
+	assert.False(t, IsKeyFile(filepath.Join(dir, "missing.tpm")))
+	_, err = ReadKey(filepath.Join(dir, "missing.tpm"))
+	assert.Error(t, err)
+}
+
+func TestParseKey_fail(t *testing.T) {
+	tests := map[string]struct {
+		b   []byte
+		err string
+	}{
+		"not pem":    {[]byte("foo"), "error decoding TPM key: not a valid PEM encoded block"},
+		"wrong type": {[]byte("-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----\n"), "error decoding TPM key: not a valid PEM encoded block"},
+		"bad asn1":   {[]byte("-----BEGIN TPM KEY-----\nAAAA\n-----END TPM KEY-----\n"), "error parsing TPM key"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseKey(tt.b)
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestKeyTemplate(t *testing.T) {
+	tests := map[string]struct {
+		kty, crv string
+		size     int
+		alg      tpm2.Algorithm
+		err      string
+	}{
+		"default":    {"", "", 0, tpm2.AlgECC, ""},
+		"EC P-384":   {"EC", "P-384", 0, tpm2.AlgECC, ""},
+		"RSA":        {"RSA", "", 0, tpm2.AlgRSA, ""},
+		"RSA 3072":   {"RSA", "", 3072, tpm2.AlgRSA, ""},
+		"bad curve":  {"EC", "P-521", 0, 0, "unsupported curve 'P-521'"},
+		"small RSA":  {"RSA", "", 1024, 0, "invalid RSA key size 1024, the minimum size is 2048"},
+		"bad type":   {"OKP", "", 0, 0, "unsupported key type 'OKP'"},
+		"lower case": {"ec", "", 0, 0, "unsupported key type 'ec'"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := keyTemplate(tt.kty, tt.crv, tt.size)
+			if tt.err != "" {
+				if assert.Error(t, err) {
+					assert.Equals(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, tt.alg, tmpl.Type)
+			if tt.size != 0 {
+				assert.Equals(t, uint16(tt.size), tmpl.RSAParameters.KeyBits)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+// Package tpm implements the creation and use of keys stored in a TPM 2.0,
+// and the attestation of those keys using the endorsement key (EK) and an
+// attestation key (AK) of the TPM.
+//
+// Keys are created under a storage root key (SRK) derived from the owner
+// hierarchy, the private part of the keys is encrypted by the TPM and it can
+// only be loaded in the TPM that created it.
+//
+// The access to the TPM and the verification of the attestations use the
+// go-tpm package v0.3, that is only included with the tpm build tag. Without
+// it the keys and attestations can still be parsed, but Open and the
+// verification methods return an error.
+package tpm
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// TPM is a TPM 2.0 device.
+type TPM struct {
+	mu sync.Mutex
+	rw io.ReadWriteCloser
+}
+
+// Close closes the TPM device.
+func (t *TPM) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return errors.Wrap(t.rw.Close(), "error closing TPM")
+}
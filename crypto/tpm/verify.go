@@ -0,0 +1,164 @@
+// +build tpm
+
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/pkg/errors"
+)
+
+// akAttributes are the attributes required in an AK, the AK must be a
+// restricted signing key that cannot leave the TPM.
+const akAttributes = tpm2.FlagSign | tpm2.FlagRestricted | tpm2.FlagFixedTPM |
+	tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin
+
+// Verify verifies the attestation and returns the public key of the attested
+// key. It checks that the AK certificate is issued by the given roots, that
+// the creation of the key is certified by the AK, that the AK is a restricted
+// key, and that the key cannot leave the TPM. If a nonce is given it must
+// match the one in the attestation.
+//
+// The AK roots are required, without a verified AK certificate any software
+// key with the attributes of an AK could sign the attestation. Verify does not
+// validate the EK certificate, use VerifyEK for that.
+func (a *Attestation) Verify(nonce []byte, akRoots *x509.CertPool) (crypto.PublicKey, error) {
+	if akRoots == nil {
+		return nil, errors.New("error verifying attestation: the AK roots are required")
+	}
+	if _, err := a.VerifyAK(akRoots); err != nil {
+		return nil, err
+	}
+	return a.verifyCreation(nonce)
+}
+
+// verifyCreation verifies the certification of the creation of the key by the
+// AK, and returns the public key of the attested key.
+func (a *Attestation) verifyCreation(nonce []byte) (crypto.PublicKey, error) {
+	akPub, err := tpm2.DecodePublic(a.AKPublic)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding AK")
+	}
+	if akPub.Attributes&akAttributes != akAttributes {
+		return nil, errors.New("error verifying attestation: the attestation key is not a restricted key")
+	}
+	akKey, err := akPub.Key()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding AK")
+	}
+	sig, err := tpm2.DecodeSignature(bytes.NewBuffer(a.CreationSignature))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding creation signature")
+	}
+	if err := verifySignature(akKey, a.CreationData, sig); err != nil {
+		return nil, err
+	}
+
+	data, err := tpm2.DecodeAttestationData(a.CreationData)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding creation data")
+	}
+	if data.Type != tpm2.TagAttestCreation || data.AttestedCreationInfo == nil {
+		return nil, errors.New("error verifying attestation: creation data is not a certification of the creation of a key")
+	}
+	if nonce != nil && !bytes.Equal(data.ExtraData, nonce) {
+		return nil, errors.New("error verifying attestation: nonce does not match")
+	}
+
+	keyPub, err := tpm2.DecodePublic(a.KeyPublic)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding key")
+	}
+	if ok, err := data.AttestedCreationInfo.Name.MatchesPublic(keyPub); err != nil || !ok {
+		return nil, errors.New("error verifying attestation: the key does not match the creation data")
+	}
+	if keyPub.Attributes&keyAttributes != keyAttributes {
+		return nil, errors.New("error verifying attestation: the key is not a signing key fixed to the TPM")
+	}
+	key, err := keyPub.Key()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding key")
+	}
+	return key, nil
+}
+
+// VerifyAK verifies the AK certificate using the given roots, and checks that
+// it certifies the AK in the attestation. It returns the AK certificate.
+func (a *Attestation) VerifyAK(roots *x509.CertPool) (*x509.Certificate, error) {
+	if len(a.AKCertificates) == 0 {
+		return nil, errors.New("error verifying AK: attestation does not contain an AK certificate")
+	}
+	akPub, err := tpm2.DecodePublic(a.AKPublic)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding AK")
+	}
+	akKey, err := akPub.Key()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding AK")
+	}
+	b, err := x509.MarshalPKIXPublicKey(akKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling AK")
+	}
+	crt, err := verifyChain(a.AKCertificates, roots, b, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "error verifying AK")
+	}
+	return crt, nil
+}
+
+// verifySignature verifies a TPM signature of the data using the given public
+// key.
+func verifySignature(pub crypto.PublicKey, data []byte, sig *tpm2.Signature) error {
+	var alg tpm2.Algorithm
+	switch {
+	case sig.RSA != nil:
+		alg = sig.RSA.HashAlg
+	case sig.ECC != nil:
+		alg = sig.ECC.HashAlg
+	}
+	var hash crypto.Hash
+	switch alg {
+	case tpm2.AlgSHA1:
+		hash = crypto.SHA1
+	case tpm2.AlgSHA256:
+		hash = crypto.SHA256
+	case tpm2.AlgSHA384:
+		hash = crypto.SHA384
+	case tpm2.AlgSHA512:
+		hash = crypto.SHA512
+	default:
+		return errors.Errorf("error verifying signature: unsupported hash algorithm 0x%x", alg)
+	}
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if sig.Alg != tpm2.AlgECDSA || !ecdsa.Verify(key, digest, sig.ECC.R, sig.ECC.S) {
+			return errors.New("error verifying signature: signature is not valid")
+		}
+	case *rsa.PublicKey:
+		var err error
+		switch sig.Alg {
+		case tpm2.AlgRSASSA:
+			err = rsa.VerifyPKCS1v15(key, hash, digest, sig.RSA.Signature)
+		case tpm2.AlgRSAPSS:
+			err = rsa.VerifyPSS(key, hash, digest, sig.RSA.Signature, nil)
+		default:
+			err = errors.Errorf("unsupported signature algorithm 0x%x", sig.Alg)
+		}
+		if err != nil {
+			return errors.Wrap(err, "error verifying signature")
+		}
+	default:
+		return errors.Errorf("error verifying signature: unsupported public key type %T", pub)
+	}
+	return nil
+}
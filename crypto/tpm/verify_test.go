@@ -0,0 +1,158 @@
+// +build tpm
+
+package tpm
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/smallstep/assert"
+)
+
+// mustAttestation returns an attestation of a key certified by a software AK.
+func mustAttestation(t *testing.T, ak *ecdsa.PrivateKey, akPublic, keyPublic, nonce []byte) *Attestation {
+	pub, err := tpm2.DecodePublic(keyPublic)
+	assert.FatalError(t, err)
+	name, err := pub.Name()
+	assert.FatalError(t, err)
+	data, err := tpm2.AttestationData{
+		Magic:           0xff544347,
+		Type:            tpm2.TagAttestCreation,
+		QualifiedSigner: tpm2.Name{Digest: &tpm2.HashValue{Alg: tpm2.AlgSHA256, Value: make([]byte, 32)}},
+		ExtraData:       nonce,
+		AttestedCreationInfo: &tpm2.CreationInfo{
+			Name:         name,
+			OpaqueDigest: make([]byte, 32),
+		},
+	}.Encode()
+	assert.FatalError(t, err)
+
+	sum := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, ak, sum[:])
+	assert.FatalError(t, err)
+	sig, err := tpm2.Signature{
+		Alg: tpm2.AlgECDSA,
+		ECC: &tpm2.SignatureECC{HashAlg: tpm2.AlgSHA256, R: r, S: s},
+	}.Encode()
+	assert.FatalError(t, err)
+
+	return &Attestation{
+		AKPublic:          akPublic,
+		KeyPublic:         keyPublic,
+		CreationData:      data,
+		CreationSignature: sig,
+	}
+}
+
+func TestAttestation_Verify(t *testing.T) {
+	nonce := []byte("nonce")
+	ak, akPublic := mustECCPublic(t, tpm2.FlagSignerDefault, &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA256})
+	key, keyPublic := mustECCPublic(t, keyAttributes, nil)
+	_, otherPublic := mustECCPublic(t, keyAttributes, nil)
+	other, _ := mustECCPublic(t, tpm2.FlagSignerDefault, nil)
+	_, unrestricted := mustECCPublic(t, keyAttributes, nil)
+	_, exportable := mustECCPublic(t, tpm2.FlagSign|tpm2.FlagUserWithAuth, nil)
+
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	root := mustCertificate(t, &rootKey.PublicKey, nil, rootKey)
+	akRoots := x509.NewCertPool()
+	akRoots.AddCert(root)
+
+	att := mustAttestation(t, ak, akPublic, keyPublic, nonce)
+	att.AKCertificates = [][]byte{mustCertificate(t, &ak.PublicKey, root, rootKey).Raw}
+	pub, err := att.Verify(nonce, akRoots)
+	assert.FatalError(t, err)
+	assert.Equals(t, &key.PublicKey, pub)
+
+	// Without nonce
+	pub, err = att.Verify(nil, akRoots)
+	assert.FatalError(t, err)
+	assert.Equals(t, &key.PublicKey, pub)
+
+	// Without AK roots or AK certificate
+	_, err = att.Verify(nonce, nil)
+	if assert.Error(t, err) {
+		assert.Equals(t, "error verifying attestation: the AK roots are required", err.Error())
+	}
+	_, err = mustAttestation(t, ak, akPublic, keyPublic, nonce).Verify(nonce, akRoots)
+	if assert.Error(t, err) {
+		assert.Equals(t, "error verifying AK: attestation does not contain an AK certificate", err.Error())
+	}
+
+	// Through JSON and the CSR extension
+	att.EKCertificates = [][]byte{[]byte("ek certificate")}
+	att.EKPublic = []byte("ek public")
+	att.AKCertificates = [][]byte{[]byte("ak certificate"), []byte("intermediate")}
+	b, err := json.Marshal(att)
+	assert.FatalError(t, err)
+	got, err := ParseAttestation(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, att, got)
+
+	ext, err := att.Extension()
+	assert.FatalError(t, err)
+	csr := &x509.CertificateRequest{Extensions: []pkix.Extension{ext}}
+	got, err = AttestationFromCSR(csr)
+	assert.FatalError(t, err)
+	assert.Equals(t, att, got)
+
+	badSignature := mustAttestation(t, ak, akPublic, keyPublic, nonce)
+	badSignature.CreationData[len(badSignature.CreationData)-1] ^= 0xff
+	badKey := mustAttestation(t, ak, akPublic, keyPublic, nonce)
+	badKey.KeyPublic = otherPublic
+
+	tests := map[string]struct {
+		att   *Attestation
+		nonce []byte
+		err   string
+	}{
+		"bad nonce":      {att, []byte("other"), "error verifying attestation: nonce does not match"},
+		"bad key":        {badKey, nonce, "error verifying attestation: the key does not match the creation data"},
+		"bad signer":     {mustAttestation(t, other, akPublic, keyPublic, nonce), nonce, "error verifying signature: signature is not valid"},
+		"bad signature":  {badSignature, nonce, "error verifying signature: signature is not valid"},
+		"unrestricted":   {mustAttestation(t, ak, unrestricted, keyPublic, nonce), nonce, "error verifying attestation: the attestation key is not a restricted key"},
+		"exportable key": {mustAttestation(t, ak, akPublic, exportable, nonce), nonce, "error verifying attestation: the key is not a signing key fixed to the TPM"},
+		"empty":          {&Attestation{}, nil, "error decoding AK"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := tt.att.verifyCreation(tt.nonce)
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestAttestation_VerifyAK(t *testing.T) {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	root := mustCertificate(t, &rootKey.PublicKey, nil, rootKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	ak, akPublic := mustECCPublic(t, tpm2.FlagSignerDefault, &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA256})
+	other, _ := mustECCPublic(t, tpm2.FlagSignerDefault, nil)
+	akCert := mustCertificate(t, &ak.PublicKey, root, rootKey)
+	otherCert := mustCertificate(t, &other.PublicKey, root, rootKey)
+
+	att := &Attestation{AKPublic: akPublic, AKCertificates: [][]byte{akCert.Raw}}
+	crt, err := att.VerifyAK(roots)
+	assert.FatalError(t, err)
+	assert.Equals(t, akCert.Raw, crt.Raw)
+
+	_, err = (&Attestation{AKPublic: akPublic}).VerifyAK(roots)
+	assert.Error(t, err)
+	_, err = (&Attestation{AKPublic: akPublic, AKCertificates: [][]byte{otherCert.Raw}}).VerifyAK(roots)
+	if assert.Error(t, err) {
+		assert.Equals(t, "error verifying AK: certificate public key does not match", err.Error())
+	}
+}
@@ -0,0 +1,182 @@
+package trust
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the intermediate stores. Unlike the truststores, the certificates
+// in these stores are not trust anchors, they are only used to build the
+// chain of a certificate to a trusted root.
+const (
+	SystemIntermediate  = "system-intermediate"
+	FirefoxIntermediate = "firefox-intermediate"
+)
+
+// IntermediateStore returns the name of the intermediate store used instead
+// of the given truststore. It returns an error if the truststore does not
+// have an intermediate store in this system, like the system truststore on
+// Linux, that only contains trust anchors, or the Java key store.
+func IntermediateStore(store string) (string, error) {
+	switch store {
+	case System:
+		switch runtime.GOOS {
+		case "windows", "darwin":
+			return SystemIntermediate, nil
+		default:
+			return "", errors.Errorf("the system truststore of %s only contains trust anchors, intermediate certificates cannot be installed in it", runtime.GOOS)
+		}
+	case Firefox:
+		return FirefoxIntermediate, nil
+	default:
+		return "", errors.Errorf("the %s truststore only contains trust anchors, intermediate certificates cannot be installed in it", store)
+	}
+}
+
+// InstallIntermediate installs the intermediate certificate in filename in
+// the given intermediate stores, using name as its nickname.
+func InstallIntermediate(filename, name string, stores []string) error {
+	for _, store := range stores {
+		var err error
+		switch store {
+		case SystemIntermediate:
+			err = installSystemIntermediate(filename)
+		case FirefoxIntermediate:
+			err = forEachNSSDB(func(db string) error {
+				return run(certutilPath(), "-A", "-d", db, "-t", ",,", "-n", name, "-i", filename)
+			})
+		default:
+			err = errors.Errorf("unsupported intermediate store %s", store)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error installing %s", filename)
+		}
+	}
+	return nil
+}
+
+// UninstallIntermediate removes the intermediate certificate with the given
+// nickname from the given intermediate stores.
+func UninstallIntermediate(cert *x509.Certificate, name string, stores []string) error {
+	for _, store := range stores {
+		var err error
+		switch store {
+		case SystemIntermediate:
+			err = uninstallSystemIntermediate(cert)
+		case FirefoxIntermediate:
+			err = forEachNSSDB(func(db string) error {
+				return run(certutilPath(), "-D", "-d", db, "-n", name)
+			})
+		default:
+			err = errors.Errorf("unsupported intermediate store %s", store)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error uninstalling %s", cert.Subject.CommonName)
+		}
+	}
+	return nil
+}
+
+func installSystemIntermediate(filename string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return run("certutil", "-addstore", "-f", "CA", filename)
+	case "darwin":
+		return run("sudo", "security", "add-certificates", "-k", "/Library/Keychains/System.keychain", filename)
+	default:
+		_, err := IntermediateStore(System)
+		return err
+	}
+}
+
+func uninstallSystemIntermediate(cert *x509.Certificate) error {
+	switch runtime.GOOS {
+	case "windows":
+		return run("certutil", "-delstore", "CA", fmt.Sprintf("%x", cert.SerialNumber))
+	case "darwin":
+		return run("sudo", "security", "delete-certificate", "-Z", fmt.Sprintf("%X", sha1.Sum(cert.Raw)), "/Library/Keychains/System.keychain")
+	default:
+		_, err := IntermediateStore(System)
+		return err
+	}
+}
+
+// nssProfiles are the patterns of the NSS databases used by Firefox, and on
+// Linux, by Chrome.
+func nssProfiles() []string {
+	home := os.Getenv("HOME")
+	switch runtime.GOOS {
+	case "windows":
+		return []string{filepath.Join(os.Getenv("USERPROFILE"), "AppData", "Roaming", "Mozilla", "Firefox", "Profiles", "*")}
+	case "darwin":
+		return []string{filepath.Join(home, "Library", "Application Support", "Firefox", "Profiles", "*")}
+	default:
+		return []string{
+			filepath.Join(home, ".mozilla", "firefox", "*"),
+			filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox", "*"),
+			filepath.Join(home, ".pki", "nssdb"),
+		}
+	}
+}
+
+// forEachNSSDB calls fn with each NSS database found. It returns an error if
+// there are no databases.
+func forEachNSSDB(fn func(db string) error) error {
+	var found bool
+	for _, pattern := range nssProfiles() {
+		dirs, _ := filepath.Glob(pattern)
+		for _, dir := range dirs {
+			var db string
+			switch {
+			case fileExists(filepath.Join(dir, "cert9.db")):
+				db = "sql:" + dir
+			case fileExists(filepath.Join(dir, "cert8.db")):
+				db = "dbm:" + dir
+			default:
+				continue
+			}
+			found = true
+			if err := fn(db); err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return errors.New("no NSS security databases found")
+	}
+	return nil
+}
+
+// certutilPath returns the path of the NSS certutil command. On macOS it's
+// installed by Homebrew with the nss package, and it's not in the PATH.
+func certutilPath() string {
+	if runtime.GOOS == "darwin" {
+		if out, err := exec.Command("brew", "--prefix", "nss").Output(); err == nil {
+			return filepath.Join(strings.TrimSpace(string(out)), "bin", "certutil")
+		}
+	}
+	return "certutil"
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// run runs the given command, and returns an error with its output if it
+// fails.
+func run(name string, arg ...string) error {
+	cmd := exec.Command(name, arg...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Errorf("failed to execute \"%s\" failed with: %s", strings.Join(cmd.Args, " "), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
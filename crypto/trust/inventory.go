@@ -0,0 +1,159 @@
+// Package trust keeps the inventory of the certificates installed by step in
+// the system, Java and Firefox truststores.
+package trust
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/config"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+)
+
+// Names of the truststores.
+const (
+	System  = "system"
+	Java    = "java"
+	Firefox = "firefox"
+)
+
+// Entry is a certificate installed in one or more truststores.
+type Entry struct {
+	Fingerprint string    `json:"fingerprint"`
+	Subject     string    `json:"subject"`
+	Filename    string    `json:"filename"`
+	Prefix      string    `json:"prefix"`
+	Stores      []string  `json:"stores"`
+	InstalledAt time.Time `json:"installedAt"`
+}
+
+// Inventory is the list of certificates installed by step.
+type Inventory struct {
+	Entries []Entry `json:"entries"`
+}
+
+// InventoryPath returns the path of the inventory file,
+// $STEPPATH/config/truststore.json.
+func InventoryPath() string {
+	return filepath.Join(config.StepPath(), "config", "truststore.json")
+}
+
+// ReadInventory reads the inventory in the given file. It returns an empty
+// inventory if the file does not exist.
+func ReadInventory(filename string) (*Inventory, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Inventory{}, nil
+		}
+		return nil, errs.FileError(err, filename)
+	}
+	inv := new(Inventory)
+	if err := json.Unmarshal(b, inv); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+	return inv, nil
+}
+
+// Write writes the inventory in the given file.
+func (inv *Inventory) Write(filename string) error {
+	b, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error marshaling inventory")
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return errs.FileError(err, filename)
+	}
+	if err := ioutil.WriteFile(filename, append(b, '\n'), 0600); err != nil {
+		return errs.FileError(err, filename)
+	}
+	return nil
+}
+
+// Add records that the given certificate has been installed in the given
+// stores. If the certificate is already in the inventory, the stores are
+// added to the existing entry.
+func (inv *Inventory) Add(cert *x509.Certificate, filename, prefix string, stores []string) {
+	fp := x509util.Fingerprint(cert)
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	for i := range inv.Entries {
+		if e := &inv.Entries[i]; e.Fingerprint == fp {
+			e.Filename, e.Prefix = filename, prefix
+			e.Stores = mergeStores(e.Stores, stores)
+			e.InstalledAt = time.Now().UTC()
+			return
+		}
+	}
+	inv.Entries = append(inv.Entries, Entry{
+		Fingerprint: fp,
+		Subject:     cert.Subject.String(),
+		Filename:    filename,
+		Prefix:      prefix,
+		Stores:      mergeStores(nil, stores),
+		InstalledAt: time.Now().UTC(),
+	})
+}
+
+// Remove records that the given certificate has been uninstalled from the
+// given stores. The entry is removed once it's not in any store.
+func (inv *Inventory) Remove(cert *x509.Certificate, stores []string) {
+	fp := x509util.Fingerprint(cert)
+	entries := inv.Entries[:0]
+	for _, e := range inv.Entries {
+		if e.Fingerprint == fp {
+			var remaining []string
+			for _, s := range e.Stores {
+				if !contains(stores, s) {
+					remaining = append(remaining, s)
+				}
+			}
+			if len(remaining) == 0 {
+				continue
+			}
+			e.Stores = remaining
+		}
+		entries = append(entries, e)
+	}
+	inv.Entries = entries
+}
+
+// Stores returns the stores where the given certificate has been installed.
+func (inv *Inventory) Stores(cert *x509.Certificate) []string {
+	fp := x509util.Fingerprint(cert)
+	for _, e := range inv.Entries {
+		if e.Fingerprint == fp {
+			return e.Stores
+		}
+	}
+	return nil
+}
+
+// mergeStores returns the union of the given stores, sorted.
+func mergeStores(a, b []string) []string {
+	var stores []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !contains(stores, s) {
+			stores = append(stores, s)
+		}
+	}
+	sort.Strings(stores)
+	return stores
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package trust
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func mustCertificate(t *testing.T, cn string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestInventory(t *testing.T) {
+	root := mustCertificate(t, "Root CA")
+	intermediate := mustCertificate(t, "Intermediate CA")
+
+	inv := &Inventory{}
+	inv.Add(root, "root_ca.crt", "Root CA ", []string{System})
+	inv.Add(intermediate, "intermediate_ca.crt", "Intermediate CA ", []string{System, Java})
+	inv.Add(root, "root_ca.crt", "Root CA ", []string{Firefox, System})
+	if len(inv.Entries) != 2 {
+		t.Fatalf("Inventory.Add() entries = %d, want 2", len(inv.Entries))
+	}
+	if got := inv.Entries[0]; got.Subject != "CN=Root CA" || !filepath.IsAbs(got.Filename) ||
+		!reflect.DeepEqual(got.Stores, []string{Firefox, System}) {
+		t.Errorf("Inventory.Add() entry = %+v", got)
+	}
+
+	inv.Remove(root, []string{System})
+	inv.Remove(intermediate, []string{System, Java})
+	if len(inv.Entries) != 1 || !reflect.DeepEqual(inv.Entries[0].Stores, []string{Firefox}) {
+		t.Errorf("Inventory.Remove() entries = %+v", inv.Entries)
+	}
+	if got := inv.Stores(root); !reflect.DeepEqual(got, []string{Firefox}) {
+		t.Errorf("Inventory.Stores() = %v, want %v", got, []string{Firefox})
+	}
+	if got := inv.Stores(intermediate); got != nil {
+		t.Errorf("Inventory.Stores() = %v, want nil", got)
+	}
+
+	dir, err := ioutil.TempDir("", "trust")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config", "truststore.json")
+
+	empty, err := ReadInventory(filename)
+	if err != nil || len(empty.Entries) != 0 {
+		t.Fatalf("ReadInventory() = %+v, %v", empty, err)
+	}
+	if err := inv.Write(filename); err != nil {
+		t.Fatalf("Inventory.Write() error = %v", err)
+	}
+	got, err := ReadInventory(filename)
+	if err != nil {
+		t.Fatalf("ReadInventory() error = %v", err)
+	}
+	if len(got.Entries) != 1 || got.Entries[0].Fingerprint != inv.Entries[0].Fingerprint ||
+		!got.Entries[0].InstalledAt.Equal(inv.Entries[0].InstalledAt) {
+		t.Errorf("ReadInventory() = %+v, want %+v", got, inv)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadInventory(filename); err == nil {
+		t.Error("ReadInventory() error = nil")
+	}
+}
+
+func TestIntermediateStore(t *testing.T) {
+	system := SystemIntermediate
+	if runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+		system = ""
+	}
+	tests := []struct {
+		store   string
+		want    string
+		wantErr bool
+	}{
+		{System, system, system == ""},
+		{Firefox, FirefoxIntermediate, false},
+		{Java, "", true},
+	}
+	for _, tt := range tests {
+		got, err := IntermediateStore(tt.store)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("IntermediateStore(%s) error = %v, wantErr %v", tt.store, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("IntermediateStore(%s) = %s, want %s", tt.store, got, tt.want)
+		}
+	}
+}
@@ -1,18 +1,23 @@
 package x509util
 
 import (
+	"crypto"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/pem"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/errs"
+	"golang.org/x/net/idna"
 )
 
 // Fingerprint returns the SHA-256 fingerprint of the certificate.
@@ -21,6 +26,51 @@ func Fingerprint(cert *x509.Certificate) string {
 	return strings.ToLower(hex.EncodeToString(sum[:]))
 }
 
+// FingerprintEncoding represents the encoding used in a fingerprint.
+type FingerprintEncoding int
+
+const (
+	// HexFingerprint represents a lowercase hexadecimal fingerprint.
+	HexFingerprint FingerprintEncoding = iota
+	// Base64Fingerprint represents a standard base64 fingerprint.
+	Base64Fingerprint
+	// Base64URLFingerprint represents an URL-safe base64 fingerprint without
+	// padding.
+	Base64URLFingerprint
+	// EmojiFingerprint represents a fingerprint where each byte is mapped to
+	// an emoji, easier to compare when it is read out loud.
+	EmojiFingerprint
+)
+
+// EncodedFingerprint returns the fingerprint of the given data using the hash
+// function h and the given encoding.
+func EncodedFingerprint(data []byte, h crypto.Hash, encoding FingerprintEncoding) (string, error) {
+	if !h.Available() {
+		return "", errors.Errorf("hash function %v is not available", h)
+	}
+	hh := h.New()
+	hh.Write(data)
+	sum := hh.Sum(nil)
+
+	switch encoding {
+	case HexFingerprint:
+		return strings.ToLower(hex.EncodeToString(sum)), nil
+	case Base64Fingerprint:
+		return base64.StdEncoding.EncodeToString(sum), nil
+	case Base64URLFingerprint:
+		return base64.RawURLEncoding.EncodeToString(sum), nil
+	case EmojiFingerprint:
+		// U+1F400 to U+1F4FF are all assigned pictographs.
+		var sb strings.Builder
+		for _, b := range sum {
+			sb.WriteRune(0x1F400 + rune(b))
+		}
+		return sb.String(), nil
+	default:
+		return "", errors.Errorf("unsupported fingerprint encoding %d", encoding)
+	}
+}
+
 // SplitSANs splits a slice of Subject Alternative Names into slices of
 // IP Addresses and DNS Names. If an element is not an IP address, then it
 // is bucketed as a DNS Name.
@@ -30,7 +80,7 @@ func SplitSANs(sans []string) (dnsNames []string, ips []net.IP) {
 	if sans == nil {
 		return
 	}
-	for _, san := range sans {
+	for _, san := range NormalizeSANs(sans) {
 		if ip := net.ParseIP(san); ip != nil {
 			ips = append(ips, ip)
 		} else {
@@ -41,6 +91,194 @@ func SplitSANs(sans []string) (dnsNames []string, ips []net.IP) {
 	return
 }
 
+// NormalizeDNSName returns the ASCII form of the given DNS name, converting
+// the internationalized labels to punycode, e.g. 'bücher.example.com' becomes
+// 'xn--bcher-kva.example.com'. ASCII names are returned unchanged, so their
+// case is preserved.
+func NormalizeDNSName(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+	// The wildcard label is not valid in IDNA.
+	prefix := ""
+	if strings.HasPrefix(name, "*.") {
+		prefix, name = "*.", name[2:]
+	}
+	s, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		return "", errors.Wrapf(err, "error converting '%s' to punycode", prefix+name)
+	}
+	return prefix + s, nil
+}
+
+// NormalizeSANs returns the given Subject Alternative Names with the
+// internationalized DNS names converted to punycode. Email addresses, URIs,
+// and names that cannot be converted are returned unchanged.
+func NormalizeSANs(sans []string) []string {
+	normalized := make([]string, len(sans))
+	for i, san := range sans {
+		normalized[i] = san
+		if strings.Contains(san, "://") || strings.Contains(san, "@") {
+			continue
+		}
+		if s, err := NormalizeDNSName(san); err == nil {
+			normalized[i] = s
+		}
+	}
+	return normalized
+}
+
+// UniqueSANs returns the given Subject Alternative Names normalized, sorted,
+// and without duplicates, so the result does not depend on the order of the
+// names. IP addresses are written in their canonical form, and DNS names in
+// punycode. It returns an error if two DNS names differ only in case.
+func UniqueSANs(sans []string) ([]string, error) {
+	seen := make(map[string]string)
+	unique := make([]string, 0, len(sans))
+	for _, san := range NormalizeSANs(sans) {
+		key := san
+		if ip := net.ParseIP(san); ip != nil {
+			san = ip.String()
+			key = san
+		} else if !strings.Contains(san, "://") && !strings.Contains(san, "@") {
+			key = strings.ToLower(san)
+		}
+		if prev, ok := seen[key]; ok {
+			if prev != san {
+				return nil, errors.Errorf("SANs '%s' and '%s' differ only in case", prev, san)
+			}
+			continue
+		}
+		seen[key] = san
+		unique = append(unique, san)
+	}
+	sort.Strings(unique)
+	return unique, nil
+}
+
+// EqualNames returns true if the given names, like a subject and a common
+// name, are the same. DNS names are compared in their normalized form and
+// ignoring the case, IP addresses by value, and email addresses, URIs and
+// other names must match exactly.
+func EqualNames(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if strings.Contains(a, "://") || strings.Contains(a, "@") {
+		return false
+	}
+	if ipa, ipb := net.ParseIP(a), net.ParseIP(b); ipa != nil || ipb != nil {
+		return ipa.Equal(ipb)
+	}
+	na, erra := NormalizeDNSName(a)
+	nb, errb := NormalizeDNSName(b)
+	if erra != nil || errb != nil || !isDNSName(na) || !isDNSName(nb) {
+		return false
+	}
+	return strings.EqualFold(na, nb)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// isDNSName returns true if s looks like an ASCII DNS name.
+func isDNSName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '.', r == '*', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateSANs validates the wildcards in the given Subject Alternative
+// Names. Only DNS names can be wildcards, and the wildcard must be the
+// complete left-most label of a name with at least two more labels, e.g.
+// *.example.com. Valid wildcards are only accepted if allowWildcards is true,
+// so a typo does not result in a request the CA rejects.
+func ValidateSANs(sans []string, allowWildcards bool) error {
+	for _, san := range sans {
+		if !strings.Contains(san, "*") {
+			continue
+		}
+		if err := validateWildcard(san); err != nil {
+			return errors.Wrapf(err, "invalid name '%s'", san)
+		}
+		if !allowWildcards {
+			return errors.Errorf("'%s' is a wildcard name; use the '--wildcard' flag to confirm it", san)
+		}
+	}
+	return nil
+}
+
+// ReadSANsFile reads the Subject Alternative Names in the given file, one per
+// line. Empty lines and comments are ignored. Comments start with a '#' at the
+// beginning of a line or after a space, so URIs with fragments can be used.
+func ReadSANsFile(filename string) ([]string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+	var sans []string
+	for i, line := range strings.Split(string(b), "\n") {
+		var fields []string
+		for _, f := range strings.Fields(line) {
+			if strings.HasPrefix(f, "#") {
+				break
+			}
+			fields = append(fields, f)
+		}
+		switch len(fields) {
+		case 0:
+		case 1:
+			sans = append(sans, fields[0])
+		default:
+			return nil, errors.Errorf("error reading %s: line %d has more than one SAN", filename, i+1)
+		}
+	}
+	return sans, nil
+}
+
+func validateWildcard(san string) error {
+	switch {
+	case strings.Contains(san, "://"):
+		return errors.New("wildcards are not allowed in URIs")
+	case strings.Contains(san, "@"):
+		return errors.New("wildcards are not allowed in email addresses")
+	case net.ParseIP(strings.Replace(san, "*", "0", -1)) != nil:
+		return errors.New("wildcards are not allowed in IP addresses")
+	}
+
+	labels := strings.Split(san, ".")
+	if labels[0] != "*" {
+		return errors.New("the wildcard must be the complete left-most label")
+	}
+	for _, label := range labels[1:] {
+		switch {
+		case label == "":
+			return errors.New("empty labels are not allowed")
+		case strings.Contains(label, "*"):
+			return errors.New("only one wildcard is allowed")
+		}
+	}
+	if len(labels) < 3 {
+		return errors.New("the wildcard must be followed by at least two labels")
+	}
+	return nil
+}
+
 // ReadCertPool loads a certificate pool from disk.
 // *path*: a file, a directory, or a comma-separated list of files.
 func ReadCertPool(path string) (*x509.CertPool, error) {
@@ -1,9 +1,16 @@
 package x509util
 
 import (
+	"crypto"
+	_ "crypto/md5"
+	_ "crypto/sha1"
 	"crypto/x509"
 	"encoding/pem"
 	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -25,6 +32,175 @@ func TestFingerprint(t *testing.T) {
 	}
 }
 
+func TestEncodedFingerprint(t *testing.T) {
+	data := []byte("hello")
+	tests := []struct {
+		name     string
+		hash     crypto.Hash
+		encoding FingerprintEncoding
+		want     string
+		wantErr  bool
+	}{
+		{"sha256-hex", crypto.SHA256, HexFingerprint, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", false},
+		{"sha256-base64", crypto.SHA256, Base64Fingerprint, "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=", false},
+		{"sha256-base64url", crypto.SHA256, Base64URLFingerprint, "LPJNul-wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ", false},
+		{"sha1-hex", crypto.SHA1, HexFingerprint, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", false},
+		{"md5-hex", crypto.MD5, HexFingerprint, "5d41402abc4b2a76b9719d911017c592", false},
+		{"md5-emoji", crypto.MD5, EmojiFingerprint, "\U0001F45D\U0001F441\U0001F440\U0001F42A\U0001F4BC\U0001F44B\U0001F42A\U0001F476\U0001F4B9\U0001F471\U0001F49D\U0001F491\U0001F410\U0001F417\U0001F4C5\U0001F492", false},
+		{"fail-encoding", crypto.SHA256, FingerprintEncoding(100), "", true},
+		{"fail-hash", crypto.Hash(0), HexFingerprint, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodedFingerprint(data, tt.hash, tt.encoding)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EncodedFingerprint() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("EncodedFingerprint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDNSName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"example.com", "example.com", false},
+		{"Example.COM", "Example.COM", false},
+		{"bücher.example.com", "xn--bcher-kva.example.com", false},
+		{"Bücher.Example.com", "xn--bcher-kva.example.com", false},
+		{"*.bücher.example.com", "*.xn--bcher-kva.example.com", false},
+		{"例え.テスト", "xn--r8jz45g.xn--zckzah", false},
+		{"jane doe ü", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeDNSName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NormalizeDNSName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeDNSName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSANs(t *testing.T) {
+	dnsNames, ips := SplitSANs([]string{"bücher.example.com", "Example.com", "10.0.0.1", "jöe@example.com"})
+	if !reflect.DeepEqual(dnsNames, []string{"xn--bcher-kva.example.com", "Example.com", "jöe@example.com"}) {
+		t.Errorf("SplitSANs() dnsNames = %v", dnsNames)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("SplitSANs() ips = %v", ips)
+	}
+}
+
+func TestUniqueSANs(t *testing.T) {
+	tests := []struct {
+		name    string
+		sans    []string
+		want    []string
+		wantErr string
+	}{
+		{"ok", []string{"www.example.com", "example.com", "10.0.0.1"}, []string{"10.0.0.1", "example.com", "www.example.com"}, ""},
+		{"ok-order", []string{"10.0.0.1", "example.com", "www.example.com"}, []string{"10.0.0.1", "example.com", "www.example.com"}, ""},
+		{"ok-duplicates", []string{"example.com", "::1", "example.com", "0:0:0:0:0:0:0:1"}, []string{"::1", "example.com"}, ""},
+		{"ok-idn", []string{"bücher.example.com", "xn--bcher-kva.example.com"}, []string{"xn--bcher-kva.example.com"}, ""},
+		{"ok-uri", []string{"spiffe://example.com/Foo", "spiffe://example.com/foo"}, []string{"spiffe://example.com/Foo", "spiffe://example.com/foo"}, ""},
+		{"ok-email", []string{"jane@example.com", "Jane@example.com"}, []string{"Jane@example.com", "jane@example.com"}, ""},
+		{"ok-empty", nil, []string{}, ""},
+		{"fail-case", []string{"example.com", "Example.com"}, nil, "SANs 'example.com' and 'Example.com' differ only in case"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UniqueSANs(tt.sans)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("UniqueSANs() error = %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("UniqueSANs() error = %v, want %s", err, tt.wantErr)
+			case !reflect.DeepEqual(got, tt.want):
+				t.Errorf("UniqueSANs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEqualNames(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"example.com", "example.com", true},
+		{"Example.com", "example.COM", true},
+		{"bücher.example.com", "xn--bcher-kva.example.com", true},
+		{"Bücher.example.com", "bücher.example.com", true},
+		{"10.0.0.1", "10.0.0.1", true},
+		{"::1", "0:0:0:0:0:0:0:1", true},
+		{"jane@example.com", "jane@example.com", true},
+		{"spiffe://example.com/Foo", "spiffe://example.com/Foo", true},
+		{"Jane Doe", "Jane Doe", true},
+		{"example.com", "www.example.com", false},
+		{"bücher.example.com", "bucher.example.com", false},
+		{"10.0.0.1", "10.0.0.2", false},
+		{"10.0.0.1", "example.com", false},
+		{"Jane@example.com", "jane@example.com", false},
+		{"spiffe://example.com/Foo", "spiffe://example.com/foo", false},
+		{"Jane Doe", "jane doe", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := EqualNames(tt.a, tt.b); got != tt.want {
+				t.Errorf("EqualNames() = %v, want %v", got, tt.want)
+			}
+			if got := EqualNames(tt.b, tt.a); got != tt.want {
+				t.Errorf("EqualNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSANs(t *testing.T) {
+	tests := []struct {
+		name           string
+		sans           []string
+		allowWildcards bool
+		wantErr        string
+	}{
+		{"ok", []string{"example.com", "10.0.0.1", "::1", "jane@example.com", "spiffe://example.com/foo"}, false, ""},
+		{"ok-wildcard", []string{"example.com", "*.example.com", "*.dev.example.com"}, true, ""},
+		{"fail-not-allowed", []string{"example.com", "*.example.com"}, false, "'*.example.com' is a wildcard name; use the '--wildcard' flag to confirm it"},
+		{"fail-double", []string{"*.*.example.com"}, true, "invalid name '*.*.example.com': only one wildcard is allowed"},
+		{"fail-partial", []string{"foo*.example.com"}, true, "invalid name 'foo*.example.com': the wildcard must be the complete left-most label"},
+		{"fail-inner", []string{"foo.*.example.com"}, true, "invalid name 'foo.*.example.com': the wildcard must be the complete left-most label"},
+		{"fail-tld", []string{"*.com"}, true, "invalid name '*.com': the wildcard must be followed by at least two labels"},
+		{"fail-alone", []string{"*"}, true, "invalid name '*': the wildcard must be followed by at least two labels"},
+		{"fail-empty-label", []string{"*..com"}, true, "invalid name '*..com': empty labels are not allowed"},
+		{"fail-ipv4", []string{"10.0.0.*"}, true, "invalid name '10.0.0.*': wildcards are not allowed in IP addresses"},
+		{"fail-ipv6", []string{"2001:db8::*"}, true, "invalid name '2001:db8::*': wildcards are not allowed in IP addresses"},
+		{"fail-email", []string{"*@example.com"}, true, "invalid name '*@example.com': wildcards are not allowed in email addresses"},
+		{"fail-uri", []string{"https://*.example.com"}, true, "invalid name 'https://*.example.com': wildcards are not allowed in URIs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSANs(tt.sans, tt.allowWildcards)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("ValidateSANs() error = %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("ValidateSANs() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func mustParseCertificate(t *testing.T, filename string) *x509.Certificate {
 	pemData, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -40,3 +216,45 @@ func mustParseCertificate(t *testing.T, filename string) *x509.Certificate {
 	}
 	return cert
 }
+
+func TestReadSANsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "x509util-sans-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		want     []string
+		wantErr  string
+	}{
+		{"ok", write("ok.txt", "# Service aliases\nfoo.example.com\n  bar.example.com  # legacy name\n\n10.0.0.1\r\n\t# disabled\nspiffe://example.com/foo#bar\n"), []string{"foo.example.com", "bar.example.com", "10.0.0.1", "spiffe://example.com/foo#bar"}, ""},
+		{"ok-empty", write("empty.txt", "# nothing yet\n"), nil, ""},
+		{"fail-two-sans", write("two.txt", "foo.example.com\nbar.example.com baz.example.com\n"), nil, "error reading " + filepath.Join(dir, "two.txt") + ": line 2 has more than one SAN"},
+		{"fail-missing", filepath.Join(dir, "missing.txt"), nil, "open " + filepath.Join(dir, "missing.txt") + " failed: no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadSANsFile(tt.filename)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("ReadSANsFile() error = %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("ReadSANsFile() error = %v, want %s", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadSANsFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,538 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/pkg/x509"
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+var keyUsages = map[string]x509.KeyUsage{
+	"digital-signature":  x509.KeyUsageDigitalSignature,
+	"content-commitment": x509.KeyUsageContentCommitment,
+	"non-repudiation":    x509.KeyUsageContentCommitment,
+	"key-encipherment":   x509.KeyUsageKeyEncipherment,
+	"data-encipherment":  x509.KeyUsageDataEncipherment,
+	"key-agreement":      x509.KeyUsageKeyAgreement,
+	"cert-sign":          x509.KeyUsageCertSign,
+	"crl-sign":           x509.KeyUsageCRLSign,
+	"encipher-only":      x509.KeyUsageEncipherOnly,
+	"decipher-only":      x509.KeyUsageDecipherOnly,
+}
+
+var extKeyUsages = map[string]struct {
+	usage x509.ExtKeyUsage
+	oid   asn1.ObjectIdentifier
+}{
+	"any":              {x509.ExtKeyUsageAny, asn1.ObjectIdentifier{2, 5, 29, 37, 0}},
+	"server-auth":      {x509.ExtKeyUsageServerAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}},
+	"client-auth":      {x509.ExtKeyUsageClientAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}},
+	"code-signing":     {x509.ExtKeyUsageCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}},
+	"email-protection": {x509.ExtKeyUsageEmailProtection, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}},
+	"ipsec-end-system": {x509.ExtKeyUsageIPSECEndSystem, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 5}},
+	"ipsec-tunnel":     {x509.ExtKeyUsageIPSECTunnel, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 6}},
+	"ipsec-user":       {x509.ExtKeyUsageIPSECUser, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 7}},
+	"time-stamping":    {x509.ExtKeyUsageTimeStamping, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}},
+	"ocsp-signing":     {x509.ExtKeyUsageOCSPSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}},
+}
+
+// Extensions contains the key usages, name constraints and custom extensions
+// that can be added to a certificate or a certificate request. It can be
+// read from a JSON template file.
+type Extensions struct {
+	KeyUsage        []string         `json:"keyUsage,omitempty"`
+	ExtKeyUsage     []string         `json:"extKeyUsage,omitempty"`
+	NameConstraints *NameConstraints `json:"nameConstraints,omitempty"`
+	Extensions      []Extension      `json:"extensions,omitempty"`
+}
+
+// NameConstraints contains the permitted and excluded subtrees of the name
+// constraints extension. IP ranges are in CIDR notation.
+type NameConstraints struct {
+	Critical                bool     `json:"critical,omitempty"`
+	PermittedDNSDomains     []string `json:"permittedDNSDomains,omitempty"`
+	ExcludedDNSDomains      []string `json:"excludedDNSDomains,omitempty"`
+	PermittedIPRanges       []string `json:"permittedIPRanges,omitempty"`
+	ExcludedIPRanges        []string `json:"excludedIPRanges,omitempty"`
+	PermittedEmailAddresses []string `json:"permittedEmailAddresses,omitempty"`
+	ExcludedEmailAddresses  []string `json:"excludedEmailAddresses,omitempty"`
+	PermittedURIDomains     []string `json:"permittedURIDomains,omitempty"`
+	ExcludedURIDomains      []string `json:"excludedURIDomains,omitempty"`
+}
+
+// Extension is a custom extension. The value is the DER-encoded value of the
+// extension, encoded in base64, or in hexadecimal using the "hex:" prefix.
+type Extension struct {
+	ID       string `json:"id"`
+	Critical bool   `json:"critical,omitempty"`
+	Value    string `json:"value"`
+}
+
+// ReadExtensionsTemplate reads the extensions from the given JSON file.
+func ReadExtensionsTemplate(filename string) (*Extensions, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+	var e Extensions
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+	return &e, nil
+}
+
+// ParseExtension parses an extension in the format
+// "<oid>[,critical]=<value>", where value is the DER-encoded value of the
+// extension in base64, or in hexadecimal using the "hex:" prefix.
+func ParseExtension(s string) (Extension, error) {
+	i := strings.Index(s, "=")
+	if i == -1 {
+		return Extension{}, errors.Errorf("invalid extension '%s': expected <oid>[,critical]=<value>", s)
+	}
+	ext := Extension{ID: s[:i], Value: s[i+1:]}
+	if strings.HasSuffix(ext.ID, ",critical") {
+		ext.ID = strings.TrimSuffix(ext.ID, ",critical")
+		ext.Critical = true
+	}
+	if _, err := ext.pkixExtension(); err != nil {
+		return Extension{}, err
+	}
+	return ext, nil
+}
+
+func (e Extension) pkixExtension() (pkix.Extension, error) {
+	oid, err := parseOID(e.ID)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	var value []byte
+	switch {
+	case strings.HasPrefix(e.Value, "hex:"):
+		value, err = hex.DecodeString(strings.TrimPrefix(e.Value, "hex:"))
+	default:
+		value, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(e.Value, "base64:"))
+	}
+	if err != nil {
+		return pkix.Extension{}, errors.Wrapf(err, "invalid value for extension %s", e.ID)
+	}
+
+	return pkix.Extension{
+		Id:       oid,
+		Critical: e.Critical,
+		Value:    value,
+	}, nil
+}
+
+// ParseKeyUsage returns the key usage for the given names, e.g.
+// digital-signature or key-encipherment.
+func ParseKeyUsage(names []string) (x509.KeyUsage, error) {
+	var ku x509.KeyUsage
+	for _, name := range names {
+		v, ok := keyUsages[strings.ToLower(name)]
+		if !ok {
+			return 0, errors.Errorf("unsupported key usage '%s'", name)
+		}
+		ku |= v
+	}
+	return ku, nil
+}
+
+// ValidateKeyUsage returns an error if the key usages with the given names
+// cannot be used with the given public key, e.g. key-encipherment with an EC
+// key, or key-agreement with an RSA key.
+func ValidateKeyUsage(pub crypto.PublicKey, names []string) error {
+	ku, err := ParseKeyUsage(names)
+	if err != nil {
+		return err
+	}
+
+	var kty string
+	var invalid x509.KeyUsage
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		kty = "RSA"
+		invalid = x509.KeyUsageKeyAgreement | x509.KeyUsageEncipherOnly | x509.KeyUsageDecipherOnly
+	case *ecdsa.PublicKey:
+		kty = "EC"
+		invalid = x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment
+	case ed25519.PublicKey:
+		kty = "OKP"
+		invalid = x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment |
+			x509.KeyUsageKeyAgreement | x509.KeyUsageEncipherOnly | x509.KeyUsageDecipherOnly
+	}
+	for _, name := range names {
+		if keyUsages[strings.ToLower(name)]&invalid != 0 {
+			return errors.Errorf("key usage '%s' cannot be used with %s keys", name, kty)
+		}
+	}
+	// RFC 5280, section 4.2.1.3.
+	if ku&(x509.KeyUsageEncipherOnly|x509.KeyUsageDecipherOnly) != 0 && ku&x509.KeyUsageKeyAgreement == 0 {
+		return errors.New("key usages 'encipher-only' and 'decipher-only' require 'key-agreement'")
+	}
+	return nil
+}
+
+// ParseExtKeyUsage returns the extended key usages for the given names, e.g.
+// server-auth or code-signing. An object identifier in dotted notation can
+// be used for other extended key usages.
+func ParseExtKeyUsage(names []string) ([]x509.ExtKeyUsage, []asn1.ObjectIdentifier, error) {
+	var usages []x509.ExtKeyUsage
+	var unknown []asn1.ObjectIdentifier
+	for _, name := range names {
+		if v, ok := extKeyUsages[strings.ToLower(name)]; ok {
+			usages = append(usages, v.usage)
+			continue
+		}
+		oid, err := parseOID(name)
+		if err != nil {
+			return nil, nil, errors.Errorf("unsupported extended key usage '%s'", name)
+		}
+		unknown = append(unknown, oid)
+	}
+	return usages, unknown, nil
+}
+
+// ParseNameConstraints returns the name constraints with the given permitted
+// and excluded subtrees. Subtrees have the format "<type>:<value>", where the
+// type is one of "dns", "ip", "email" or "uri". If the type is not present,
+// IP ranges and email addresses are detected, and any other value is
+// considered a DNS domain. The returned name constraints are marked as
+// critical, as required by RFC 5280, section 4.2.1.10. It returns nil if
+// there are no subtrees.
+func ParseNameConstraints(permitted, excluded []string) (*NameConstraints, error) {
+	if len(permitted) == 0 && len(excluded) == 0 {
+		return nil, nil
+	}
+	nc := &NameConstraints{Critical: true}
+	for _, s := range permitted {
+		typ, value, err := parseSubtree(s)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "dns":
+			nc.PermittedDNSDomains = append(nc.PermittedDNSDomains, value)
+		case "ip":
+			nc.PermittedIPRanges = append(nc.PermittedIPRanges, value)
+		case "email":
+			nc.PermittedEmailAddresses = append(nc.PermittedEmailAddresses, value)
+		case "uri":
+			nc.PermittedURIDomains = append(nc.PermittedURIDomains, value)
+		}
+	}
+	for _, s := range excluded {
+		typ, value, err := parseSubtree(s)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "dns":
+			nc.ExcludedDNSDomains = append(nc.ExcludedDNSDomains, value)
+		case "ip":
+			nc.ExcludedIPRanges = append(nc.ExcludedIPRanges, value)
+		case "email":
+			nc.ExcludedEmailAddresses = append(nc.ExcludedEmailAddresses, value)
+		case "uri":
+			nc.ExcludedURIDomains = append(nc.ExcludedURIDomains, value)
+		}
+	}
+	return nc, nil
+}
+
+// parseSubtree returns the type and the value of a name constraints subtree.
+// IP addresses without a mask are converted to a single address range.
+func parseSubtree(s string) (string, string, error) {
+	typ, value := "", s
+	if i := strings.Index(s, ":"); i > 0 {
+		switch t := strings.ToLower(s[:i]); t {
+		case "dns", "ip", "email", "uri":
+			typ, value = t, s[i+1:]
+		}
+	}
+	if value == "" {
+		return "", "", errors.Errorf("invalid name constraint '%s': value cannot be empty", s)
+	}
+
+	if typ == "" {
+		switch {
+		case net.ParseIP(value) != nil:
+			typ = "ip"
+		case strings.Contains(value, "/"):
+			typ = "ip"
+		case strings.Contains(value, "@"):
+			typ = "email"
+		default:
+			typ = "dns"
+		}
+	}
+
+	if typ == "ip" {
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			value = (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String()
+		}
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return "", "", errors.Errorf("invalid name constraint '%s': expected an IP range in CIDR notation", s)
+		}
+	}
+	return typ, value, nil
+}
+
+// WithExtensions returns a Profile modifier that sets the key usages, name
+// constraints and custom extensions of the subject certificate. Key usages
+// replace the defaults of the profile.
+func WithExtensions(e *Extensions) WithOption {
+	return func(p Profile) error {
+		if e == nil {
+			return nil
+		}
+		crt := p.Subject()
+		if len(e.KeyUsage) > 0 {
+			ku, err := ParseKeyUsage(e.KeyUsage)
+			if err != nil {
+				return err
+			}
+			crt.KeyUsage = ku
+		}
+		if len(e.ExtKeyUsage) > 0 {
+			usages, unknown, err := ParseExtKeyUsage(e.ExtKeyUsage)
+			if err != nil {
+				return err
+			}
+			crt.ExtKeyUsage = usages
+			crt.UnknownExtKeyUsage = unknown
+		}
+		if nc := e.NameConstraints; nc != nil {
+			if err := nc.apply(crt); err != nil {
+				return err
+			}
+		}
+		for _, ext := range e.Extensions {
+			pe, err := ext.pkixExtension()
+			if err != nil {
+				return err
+			}
+			crt.ExtraExtensions = append(crt.ExtraExtensions, pe)
+		}
+		return nil
+	}
+}
+
+// CSRExtensions returns the extensions to add in a certificate request. Name
+// constraints are not supported in certificate requests.
+func (e *Extensions) CSRExtensions() ([]pkix.Extension, error) {
+	if e == nil {
+		return nil, nil
+	}
+	if e.NameConstraints != nil {
+		return nil, errors.New("name constraints are not supported in certificate requests")
+	}
+
+	var exts []pkix.Extension
+	if len(e.KeyUsage) > 0 {
+		ku, err := ParseKeyUsage(e.KeyUsage)
+		if err != nil {
+			return nil, err
+		}
+		ext, err := marshalKeyUsage(ku)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, ext)
+	}
+	if len(e.ExtKeyUsage) > 0 {
+		var oids []asn1.ObjectIdentifier
+		for _, name := range e.ExtKeyUsage {
+			if v, ok := extKeyUsages[strings.ToLower(name)]; ok {
+				oids = append(oids, v.oid)
+			} else if oid, err := parseOID(name); err == nil {
+				oids = append(oids, oid)
+			} else {
+				return nil, errors.Errorf("unsupported extended key usage '%s'", name)
+			}
+		}
+		value, err := asn1.Marshal(oids)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling extended key usage")
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtensionExtendedKeyUsage, Value: value})
+	}
+	for _, ext := range e.Extensions {
+		pe, err := ext.pkixExtension()
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pe)
+	}
+	return exts, nil
+}
+
+// Preset is a named set of defaults for a common use of a certificate, so the
+// key usages do not need to be set one by one.
+type Preset struct {
+	Name        string
+	KeyUsage    []string
+	ExtKeyUsage []string
+	// KeyEncipherment adds the key-encipherment key usage to RSA keys.
+	KeyEncipherment bool
+	// SubjectSAN is true if the subject is used as a SAN if none are given.
+	SubjectSAN bool
+}
+
+var presets = []Preset{
+	{"tls-server", []string{"digital-signature"}, []string{"server-auth"}, true, true},
+	{"tls-client", []string{"digital-signature"}, []string{"client-auth"}, false, true},
+	{"mtls-peer", []string{"digital-signature"}, []string{"server-auth", "client-auth"}, true, true},
+	{"code-signing", []string{"digital-signature"}, []string{"code-signing"}, false, false},
+}
+
+// GetPreset returns the preset with the given name, e.g. tls-server.
+func GetPreset(name string) (*Preset, bool) {
+	for i := range presets {
+		if presets[i].Name == name {
+			return &presets[i], true
+		}
+	}
+	return nil, false
+}
+
+// PresetNames returns the names of the presets separated by commas.
+func PresetNames() string {
+	names := make([]string, len(presets))
+	for i, p := range presets {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Apply sets the key usages and extended key usages of the preset for a key
+// of the given type, RSA, EC or OKP. The usages already set in e take
+// precedence over the ones in the preset.
+func (p *Preset) Apply(e *Extensions, kty string) *Extensions {
+	if e == nil {
+		e = new(Extensions)
+	}
+	if len(e.KeyUsage) == 0 {
+		e.KeyUsage = append([]string{}, p.KeyUsage...)
+		if p.KeyEncipherment && kty == "RSA" {
+			e.KeyUsage = append(e.KeyUsage, "key-encipherment")
+		}
+	}
+	if len(e.ExtKeyUsage) == 0 {
+		e.ExtKeyUsage = append([]string{}, p.ExtKeyUsage...)
+	}
+	return e
+}
+
+func (nc *NameConstraints) apply(crt *x509.Certificate) error {
+	permittedIPs, err := parseIPRanges(nc.PermittedIPRanges)
+	if err != nil {
+		return err
+	}
+	excludedIPs, err := parseIPRanges(nc.ExcludedIPRanges)
+	if err != nil {
+		return err
+	}
+	crt.PermittedDNSDomainsCritical = nc.Critical
+	crt.PermittedDNSDomains = append(crt.PermittedDNSDomains, nc.PermittedDNSDomains...)
+	crt.ExcludedDNSDomains = append(crt.ExcludedDNSDomains, nc.ExcludedDNSDomains...)
+	crt.PermittedIPRanges = append(crt.PermittedIPRanges, permittedIPs...)
+	crt.ExcludedIPRanges = append(crt.ExcludedIPRanges, excludedIPs...)
+	crt.PermittedEmailAddresses = append(crt.PermittedEmailAddresses, nc.PermittedEmailAddresses...)
+	crt.ExcludedEmailAddresses = append(crt.ExcludedEmailAddresses, nc.ExcludedEmailAddresses...)
+	crt.PermittedURIDomains = append(crt.PermittedURIDomains, nc.PermittedURIDomains...)
+	crt.ExcludedURIDomains = append(crt.ExcludedURIDomains, nc.ExcludedURIDomains...)
+	return nil
+}
+
+func parseIPRanges(ranges []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, r := range ranges {
+		_, n, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, errors.Errorf("invalid IP range '%s': expected CIDR notation", r)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// marshalKeyUsage returns the key usage extension. The bits are encoded in
+// the BIT STRING using the order defined in RFC 5280, section 4.2.1.3.
+func marshalKeyUsage(ku x509.KeyUsage) (pkix.Extension, error) {
+	var a [2]byte
+	a[0] = reverseBitsInAByte(byte(ku))
+	a[1] = reverseBitsInAByte(byte(ku >> 8))
+
+	l := 1
+	if a[1] != 0 {
+		l = 2
+	}
+	bitString := a[:l]
+	value, err := asn1.Marshal(asn1.BitString{Bytes: bitString, BitLength: asn1BitLength(bitString)})
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling key usage")
+	}
+	return pkix.Extension{Id: oidExtensionKeyUsage, Critical: true, Value: value}, nil
+}
+
+func reverseBitsInAByte(in byte) byte {
+	b1 := in>>4 | in<<4
+	b2 := b1>>2&0x33 | b1<<2&0xcc
+	b3 := b2>>1&0x55 | b2<<1&0xaa
+	return b3
+}
+
+// asn1BitLength returns the bit-length of bitString by considering the
+// most-significant bit in a byte to be the "first" bit.
+func asn1BitLength(bitString []byte) int {
+	bitLen := len(bitString) * 8
+	for i := range bitString {
+		b := bitString[len(bitString)-i-1]
+		for bit := uint(0); bit < 8; bit++ {
+			if (b>>bit)&1 == 1 {
+				return bitLen
+			}
+			bitLen--
+		}
+	}
+	return 0
+}
+
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errors.Errorf("invalid object identifier '%s'", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid object identifier '%s'", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
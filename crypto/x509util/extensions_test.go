@@ -0,0 +1,262 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	stdx509 "crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/cli/pkg/x509"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestParseExtension(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Extension
+		wantErr bool
+	}{
+		{"ok-base64", "1.2.3.4=BQA=", Extension{ID: "1.2.3.4", Value: "BQA="}, false},
+		{"ok-hex", "1.2.3.4=hex:0500", Extension{ID: "1.2.3.4", Value: "hex:0500"}, false},
+		{"ok-critical", "1.2.3.4,critical=base64:BQA=", Extension{ID: "1.2.3.4", Critical: true, Value: "base64:BQA="}, false},
+		{"fail-format", "1.2.3.4", Extension{}, true},
+		{"fail-oid", "foo=BQA=", Extension{}, true},
+		{"fail-value", "1.2.3.4=hex:zz", Extension{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExtension(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseExtension() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseExtension() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKeyUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		want    x509.KeyUsage
+		wantErr bool
+	}{
+		{"ok", []string{"digital-signature", "Key-Encipherment"}, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment, false},
+		{"ok-empty", nil, 0, false},
+		{"fail", []string{"foo"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKeyUsage(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseKeyUsage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseKeyUsage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateKeyUsage(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		pub     crypto.PublicKey
+		names   []string
+		wantErr bool
+	}{
+		{"ok-ec", ecKey.Public(), []string{"digital-signature", "key-agreement"}, false},
+		{"ok-rsa", rsaKey.Public(), []string{"digital-signature", "key-encipherment"}, false},
+		{"ok-ed25519", edPub, []string{"digital-signature"}, false},
+		{"ok-decipher-only", ecKey.Public(), []string{"key-agreement", "decipher-only"}, false},
+		{"ok-empty", ecKey.Public(), nil, false},
+		{"fail-ec", ecKey.Public(), []string{"digital-signature", "Key-Encipherment"}, true},
+		{"fail-rsa", rsaKey.Public(), []string{"key-agreement"}, true},
+		{"fail-ed25519", edPub, []string{"key-agreement"}, true},
+		{"fail-encipher-only", ecKey.Public(), []string{"encipher-only"}, true},
+		{"fail-unknown", ecKey.Public(), []string{"foo"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateKeyUsage(tt.pub, tt.names); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateKeyUsage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseExtKeyUsage(t *testing.T) {
+	tests := []struct {
+		name        string
+		names       []string
+		want        []x509.ExtKeyUsage
+		wantUnknown []asn1.ObjectIdentifier
+		wantErr     bool
+	}{
+		{"ok", []string{"code-signing", "1.3.6.1.5.5.7.3.17"}, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, []asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 17}}, false},
+		{"fail", []string{"foo"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, unknown, err := ParseExtKeyUsage(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseExtKeyUsage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseExtKeyUsage() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(unknown, tt.wantUnknown) {
+				t.Errorf("ParseExtKeyUsage() unknown = %v, want %v", unknown, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestExtensions_CSRExtensions(t *testing.T) {
+	// Compare the encoding with the one in the standard library
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &stdx509.Certificate{
+		SerialNumber: big.NewInt(1),
+		KeyUsage:     stdx509.KeyUsageDigitalSignature | stdx509.KeyUsageDecipherOnly,
+		ExtKeyUsage:  []stdx509.ExtKeyUsage{stdx509.ExtKeyUsageIPSECUser, stdx509.ExtKeyUsageTimeStamping},
+	}
+	der, err := stdx509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := stdx509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []pkix.Extension
+	for _, ext := range crt.Extensions {
+		if ext.Id.Equal(oidExtensionKeyUsage) || ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+			want = append(want, ext)
+		}
+	}
+	want = append(want, pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{5, 0}})
+
+	e := &Extensions{
+		KeyUsage:    []string{"digital-signature", "decipher-only"},
+		ExtKeyUsage: []string{"ipsec-user", "time-stamping"},
+		Extensions:  []Extension{{ID: "1.2.3.4", Value: "hex:0500"}},
+	}
+	got, err := e.CSRExtensions()
+	if err != nil {
+		t.Fatalf("Extensions.CSRExtensions() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extensions.CSRExtensions() = %v, want %v", got, want)
+	}
+
+	e.NameConstraints = &NameConstraints{PermittedDNSDomains: []string{"example.com"}}
+	if _, err := e.CSRExtensions(); err == nil {
+		t.Error("Extensions.CSRExtensions() error = nil, want error")
+	}
+}
+
+func TestPreset_Apply(t *testing.T) {
+	tests := []struct {
+		name string
+		e    *Extensions
+		kty  string
+		want *Extensions
+	}{
+		{"tls-server", nil, "EC", &Extensions{KeyUsage: []string{"digital-signature"}, ExtKeyUsage: []string{"server-auth"}}},
+		{"tls-server", nil, "RSA", &Extensions{KeyUsage: []string{"digital-signature", "key-encipherment"}, ExtKeyUsage: []string{"server-auth"}}},
+		{"tls-client", nil, "RSA", &Extensions{KeyUsage: []string{"digital-signature"}, ExtKeyUsage: []string{"client-auth"}}},
+		{"mtls-peer", nil, "OKP", &Extensions{KeyUsage: []string{"digital-signature"}, ExtKeyUsage: []string{"server-auth", "client-auth"}}},
+		{"code-signing", &Extensions{KeyUsage: []string{"content-commitment"}}, "EC", &Extensions{KeyUsage: []string{"content-commitment"}, ExtKeyUsage: []string{"code-signing"}}},
+		{"tls-server", &Extensions{ExtKeyUsage: []string{"1.2.3.4"}}, "EC", &Extensions{KeyUsage: []string{"digital-signature"}, ExtKeyUsage: []string{"1.2.3.4"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.kty, func(t *testing.T) {
+			p, ok := GetPreset(tt.name)
+			if !ok {
+				t.Fatalf("GetPreset() ok = false")
+			}
+			if got := p.Apply(tt.e, tt.kty); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Preset.Apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := GetPreset("leaf"); ok {
+		t.Error("GetPreset() ok = true, want false")
+	}
+	if got := PresetNames(); got != "tls-server, tls-client, mtls-peer, code-signing" {
+		t.Errorf("PresetNames() = %v", got)
+	}
+}
+
+func TestParseNameConstraints(t *testing.T) {
+	tests := []struct {
+		name      string
+		permitted []string
+		excluded  []string
+		want      *NameConstraints
+		wantErr   bool
+	}{
+		{"ok-empty", nil, nil, nil, false},
+		{"ok-types", []string{"dns:example.com", "ip:10.0.0.0/8", "email:example.com", "uri:.example.com"}, []string{"DNS:bad.example.com"},
+			&NameConstraints{
+				Critical:                true,
+				PermittedDNSDomains:     []string{"example.com"},
+				PermittedIPRanges:       []string{"10.0.0.0/8"},
+				PermittedEmailAddresses: []string{"example.com"},
+				PermittedURIDomains:     []string{".example.com"},
+				ExcludedDNSDomains:      []string{"bad.example.com"},
+			}, false},
+		{"ok-detect", []string{".example.com", "192.168.0.0/16", "jane@example.com"}, []string{"192.168.1.1", "2001:db8::1"},
+			&NameConstraints{
+				Critical:                true,
+				PermittedDNSDomains:     []string{".example.com"},
+				PermittedIPRanges:       []string{"192.168.0.0/16"},
+				PermittedEmailAddresses: []string{"jane@example.com"},
+				ExcludedIPRanges:        []string{"192.168.1.1/32", "2001:db8::1/128"},
+			}, false},
+		{"fail-ip", []string{"ip:example.com"}, nil, nil, true},
+		{"fail-cidr", nil, []string{"10.0.0.0/33"}, nil, true},
+		{"fail-empty", []string{"dns:"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNameConstraints(tt.permitted, tt.excluded)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseNameConstraints() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseNameConstraints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
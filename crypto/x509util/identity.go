@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/kms"
 	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/pkg/x509"
 )
@@ -23,13 +24,21 @@ func NewIdentity(c *x509.Certificate, k interface{}) *Identity {
 }
 
 // LoadIdentityFromDisk load a public certificate and private key (both in PEM
-// format) from disk.
+// format) from disk. The private key can also be a PKCS #11 URI.
 func LoadIdentityFromDisk(crtPath, keyPath string, pemOpts ...pemutil.Options) (*Identity, error) {
 	crt, err := pemutil.ReadStepCertificate(crtPath)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	if kms.IsURI(keyPath) {
+		signer, err := kms.NewSigner(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		return NewIdentity(crt, signer), nil
+	}
+
 	keyBytes, err := ioutil.ReadFile(keyPath)
 	if err != nil {
 		return nil, errors.WithStack(err)
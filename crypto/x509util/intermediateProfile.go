@@ -5,6 +5,7 @@ import (
 	"crypto/x509/pkix"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/smallstep/cli/pkg/x509"
 )
 
@@ -27,6 +28,27 @@ func NewIntermediateProfile(name string, iss *x509.Certificate, issPriv crypto.P
 	return newProfile(&Intermediate{}, sub, iss, issPriv, withOps...)
 }
 
+// NewIntermediateProfileWithCSR returns a new intermediate x509 Certificate
+// Profile with the subject and public key of the CSR.
+// A public/private keypair **WILL NOT** be generated for this profile because
+// the public key will be populated from the CSR.
+func NewIntermediateProfileWithCSR(csr *x509.CertificateRequest, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if csr.PublicKey == nil {
+		return nil, errors.Errorf("CSR must have PublicKey")
+	}
+
+	sub := defaultIntermediateTemplate(csr.Subject.CommonName)
+	sub.Subject = csr.Subject
+	sub.Issuer = iss.Subject
+	sub.DNSNames = csr.DNSNames
+	sub.EmailAddresses = csr.EmailAddresses
+	sub.IPAddresses = csr.IPAddresses
+	sub.URIs = csr.URIs
+
+	withOps = append(withOps, WithPublicKey(csr.PublicKey))
+	return newProfile(&Intermediate{}, sub, iss, issPriv, withOps...)
+}
+
 func defaultIntermediateTemplate(name string) *x509.Certificate {
 	notBefore := time.Now()
 	return &x509.Certificate{
@@ -0,0 +1,168 @@
+// Package debug implements the logs written with the --verbose and --debug
+// flags. The logs are written to the standard error as lines of key=value
+// pairs, and the tokens in them are always redacted.
+package debug
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Level is the type used to represent the verbosity of the logs.
+type Level int
+
+const (
+	// LevelOff disables the logs.
+	LevelOff Level = iota
+	// LevelVerbose logs the requests to the CA, the claims of the tokens, and
+	// the files read and written.
+	LevelVerbose
+	// LevelDebug logs also the headers and bodies of the requests and
+	// responses.
+	LevelDebug
+)
+
+// String implements the fmt.Stringer interface.
+func (l Level) String() string {
+	switch l {
+	case LevelOff:
+		return "off"
+	case LevelVerbose:
+		return "verbose"
+	case LevelDebug:
+		return "debug"
+	default:
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// RedactedValue is the value used instead of tokens and other secrets.
+const RedactedValue = "[REDACTED]"
+
+var (
+	mu     sync.Mutex
+	level            = LevelOff
+	output io.Writer = os.Stderr
+	now              = time.Now
+)
+
+// tokenRegexp matches JSON Web Tokens in its compact serialization. The
+// signature is optional to match also unsigned tokens.
+var tokenRegexp = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// SetLevel sets the verbosity of the logs.
+func SetLevel(l Level) {
+	mu.Lock()
+	level = l
+	mu.Unlock()
+}
+
+// Enabled returns true if the logs with the given level are written.
+func Enabled(l Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return l > LevelOff && l <= level
+}
+
+// Log writes a message with the given key-value pairs if the level is enabled.
+// Pairs with a nil value are skipped, and tokens in the values are redacted.
+func Log(l Level, msg string, keyvals ...interface{}) {
+	if !Enabled(l) {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("time=" + now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(" level=" + l.String())
+	buf.WriteString(" msg=" + quote(msg))
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			if value = keyvals[i+1]; value == nil {
+				continue
+			}
+		}
+		buf.WriteString(" " + fmt.Sprint(keyvals[i]) + "=" + quote(Redact(fmt.Sprint(value))))
+	}
+	buf.WriteByte('\n')
+
+	mu.Lock()
+	output.Write(buf.Bytes())
+	mu.Unlock()
+}
+
+// Token logs the header and the claims of the given token. The signature is
+// never logged.
+func Token(msg, token string) {
+	if !Enabled(LevelVerbose) {
+		return
+	}
+	header, claims, err := decodeToken(token)
+	if err != nil {
+		Log(LevelVerbose, msg, "error", err)
+		return
+	}
+	Log(LevelVerbose, msg, "header", header, "claims", claims)
+}
+
+// Redact replaces the tokens in the given string.
+func Redact(s string) string {
+	return tokenRegexp.ReplaceAllString(s, RedactedValue)
+}
+
+// decodeToken returns the header and the claims of a token in its compact
+// serialization.
+func decodeToken(token string) (string, string, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return "", "", errors.New("error decoding token: invalid format")
+	}
+	header, err := decodeSegment(parts[0])
+	if err != nil {
+		return "", "", errors.Wrap(err, "error decoding token header")
+	}
+	claims, err := decodeSegment(parts[1])
+	if err != nil {
+		return "", "", errors.Wrap(err, "error decoding token claims")
+	}
+	return header, claims, nil
+}
+
+// decodeSegment decodes a base64url segment of a token and returns it as a
+// compact JSON.
+func decodeSegment(s string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// quote quotes the value if it's empty or contains spaces, quotes, equal signs
+// or control characters.
+func quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '"' || r == '=' || r == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package debug
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+// testToken is an unsigned token with the header {"alg":"none"} and the claims
+// {"sub":"foo","aud":"https://ca"}.
+var testToken = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+	base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"foo", "aud":"https://ca"}`)) + ".c2lnbmF0dXJl"
+
+func setup(t *testing.T, l Level) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	SetLevel(l)
+	output = buf
+	now = func() time.Time {
+		return time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	}
+	return buf
+}
+
+func teardown() {
+	SetLevel(LevelOff)
+	output = nil
+	now = time.Now
+}
+
+func TestEnabled(t *testing.T) {
+	defer teardown()
+	tests := []struct {
+		level            Level
+		verbose, isDebug bool
+	}{
+		{LevelOff, false, false},
+		{LevelVerbose, true, false},
+		{LevelDebug, true, true},
+	}
+	for _, tc := range tests {
+		SetLevel(tc.level)
+		assert.False(t, Enabled(LevelOff))
+		assert.Equals(t, tc.verbose, Enabled(LevelVerbose))
+		assert.Equals(t, tc.isDebug, Enabled(LevelDebug))
+	}
+}
+
+func TestLog(t *testing.T) {
+	defer teardown()
+	buf := setup(t, LevelVerbose)
+
+	Log(LevelVerbose, "file read", "file", "root_ca.crt", "bytes", 512, "error", nil)
+	Log(LevelVerbose, "token", "value", testToken, "error", errors.New("token expired"), "odd")
+	Log(LevelDebug, "not logged")
+	assert.Equals(t, `time=2019-10-01T12:00:00Z level=verbose msg="file read" file=root_ca.crt bytes=512
+time=2019-10-01T12:00:00Z level=verbose msg=token value=[REDACTED] error="token expired" odd=(MISSING)
+`, buf.String())
+
+	SetLevel(LevelOff)
+	buf.Reset()
+	Log(LevelVerbose, "not logged")
+	assert.Equals(t, "", buf.String())
+}
+
+func TestToken(t *testing.T) {
+	defer teardown()
+	buf := setup(t, LevelVerbose)
+
+	Token("token", testToken)
+	Token("token", "not-a-token")
+	assert.Equals(t, `time=2019-10-01T12:00:00Z level=verbose msg=token header="{\"alg\":\"none\"}" claims="{\"sub\":\"foo\",\"aud\":\"https://ca\"}"
+time=2019-10-01T12:00:00Z level=verbose msg=token error="error decoding token: invalid format"
+`, buf.String())
+}
+
+func TestRedact(t *testing.T) {
+	tests := map[string]string{
+		"":                             "",
+		"no tokens":                    "no tokens",
+		testToken:                      RedactedValue,
+		`{"ott":"` + testToken + `"}`:  `{"ott":"` + RedactedValue + `"}`,
+		"Bearer " + testToken + " foo": "Bearer " + RedactedValue + " foo",
+	}
+	for s, want := range tests {
+		assert.Equals(t, want, Redact(s))
+	}
+}
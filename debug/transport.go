@@ -0,0 +1,122 @@
+package debug
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// redactedHeaders are the headers whose values are never logged.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// transport is an http.RoundTripper that logs the requests and responses.
+type transport struct {
+	next http.RoundTripper
+}
+
+// Transport returns an http.RoundTripper that logs the requests and responses
+// made with the given one. It logs the method, URL, status and duration with
+// the verbose level, and the headers and bodies with the debug level. If rt
+// is nil http.DefaultTransport is used.
+func Transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &transport{next: rt}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !Enabled(LevelVerbose) {
+		return t.next.RoundTrip(req)
+	}
+
+	Log(LevelVerbose, "http request", "method", req.Method, "url", req.URL)
+	if Enabled(LevelDebug) {
+		body, err := readBody(&req.Body)
+		if err != nil {
+			return nil, err
+		}
+		Log(LevelDebug, "http request headers", "headers", formatHeader(req.Header))
+		if len(body) > 0 {
+			Log(LevelDebug, "http request body", "body", string(body))
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start)
+	if err != nil {
+		Log(LevelVerbose, "http error", "method", req.Method, "url", req.URL, "duration", duration, "error", err)
+		return nil, err
+	}
+
+	Log(LevelVerbose, "http response", "method", req.Method, "url", req.URL, "status", resp.StatusCode, "duration", duration)
+	if Enabled(LevelDebug) {
+		body, err := readBody(&resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		Log(LevelDebug, "http response headers", "headers", formatHeader(resp.Header))
+		if len(body) > 0 {
+			Log(LevelDebug, "http response body", "body", string(body))
+		}
+	}
+
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transport if it supports it.
+func (t *transport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if tr, ok := t.next.(closeIdler); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// readBody reads the given body and replaces it with a copy, so it can be read
+// again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// formatHeader returns the header as a string with the sensitive values
+// redacted.
+func formatHeader(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		value := strings.Join(h[k], ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(k)] {
+			value = RedactedValue
+		}
+		parts = append(parts, k+": "+value)
+	}
+	return strings.Join(parts, "; ")
+}
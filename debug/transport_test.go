@@ -0,0 +1,62 @@
+package debug
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestTransport(t *testing.T) {
+	defer teardown()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.FatalError(t, err)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(append([]byte("echo "), b...))
+	}))
+	defer srv.Close()
+
+	do := func() string {
+		req, err := http.NewRequest("POST", srv.URL+"/1.0/sign", strings.NewReader(`{"ott":"`+testToken+`"}`))
+		assert.FatalError(t, err)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+		assert.FatalError(t, err)
+		defer resp.Body.Close()
+		assert.Equals(t, http.StatusCreated, resp.StatusCode)
+		b, err := ioutil.ReadAll(resp.Body)
+		assert.FatalError(t, err)
+		return string(b)
+	}
+
+	// Disabled
+	buf := setup(t, LevelOff)
+	assert.Equals(t, `echo {"ott":"`+testToken+`"}`, do())
+	assert.Equals(t, "", buf.String())
+
+	// Verbose
+	buf = setup(t, LevelVerbose)
+	assert.Equals(t, `echo {"ott":"`+testToken+`"}`, do())
+	logs := buf.String()
+	assert.True(t, strings.Contains(logs, `msg="http request" method=POST url=`+srv.URL+"/1.0/sign\n"))
+	assert.True(t, strings.Contains(logs, `msg="http response" method=POST url=`+srv.URL+"/1.0/sign status=201 duration="))
+	assert.False(t, strings.Contains(logs, "headers"))
+	assert.False(t, strings.Contains(logs, "body"))
+
+	// Debug
+	buf = setup(t, LevelDebug)
+	assert.Equals(t, `echo {"ott":"`+testToken+`"}`, do())
+	logs = buf.String()
+	assert.True(t, strings.Contains(logs, `msg="http request headers" headers="Authorization: [REDACTED]"`))
+	assert.True(t, strings.Contains(logs, `msg="http request body" body="{\"ott\":\"[REDACTED]\"}"`))
+	assert.True(t, strings.Contains(logs, `Set-Cookie: [REDACTED]`))
+	assert.True(t, strings.Contains(logs, `msg="http response body" body="echo {\"ott\":\"[REDACTED]\"}"`))
+	assert.False(t, strings.Contains(logs, testToken))
+	assert.False(t, strings.Contains(logs, "secret"))
+}
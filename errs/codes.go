@@ -0,0 +1,148 @@
+package errs
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Code is a stable identifier of a class of failures. Each code is also the
+// exit status of the commands that fail with it, so scripts can branch on the
+// type of the failure.
+type Code int
+
+// The codes of the failures. New codes must be added at the end, the values
+// must not change. Codes from 10 are reserved for the exit codes of the
+// commands that document their own, like step certificate verify.
+const (
+	// CodeUnknown is used for the failures that are not classified.
+	CodeUnknown Code = 1
+	// CodeUsage is used for invalid or missing arguments and flags.
+	CodeUsage Code = 2
+	// CodeValidation is used for invalid inputs, like malformed certificates,
+	// keys or tokens.
+	CodeValidation Code = 3
+	// CodeFile is used for errors reading or writing files.
+	CodeFile Code = 4
+	// CodeNetwork is used for connection errors and timeouts.
+	CodeNetwork Code = 5
+	// CodeAuth is used when the CA or another server fails to authenticate
+	// the request, e.g. an expired token or a wrong password.
+	CodeAuth Code = 6
+	// CodePolicy is used when the CA refuses a request because of its policy,
+	// e.g. a name or a validity that the provisioner does not allow.
+	CodePolicy Code = 7
+)
+
+// String returns the name of the code.
+func (c Code) String() string {
+	switch c {
+	case CodeUsage:
+		return "usage"
+	case CodeValidation:
+		return "validation"
+	case CodeFile:
+		return "file"
+	case CodeNetwork:
+		return "network"
+	case CodeAuth:
+		return "auth"
+	case CodePolicy:
+		return "policy"
+	default:
+		return "unknown"
+	}
+}
+
+// CodedError is an error with a code.
+type CodedError struct {
+	Code Code
+	Err  error
+}
+
+// Error implements the error interface, it returns the message of the
+// underlying error.
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the underlying error.
+func (e *CodedError) Cause() error {
+	return e.Err
+}
+
+// Format implements the fmt.Formatter interface, it formats the underlying
+// error, so the stack traces are printed with %+v.
+func (e *CodedError) Format(s fmt.State, verb rune) {
+	if f, ok := e.Err.(fmt.Formatter); ok {
+		f.Format(s, verb)
+		return
+	}
+	io.WriteString(s, e.Error())
+}
+
+// WithCode returns the given error with the given code. It returns nil if err
+// is nil.
+func WithCode(err error, code Code) error {
+	if err == nil {
+		return nil
+	}
+	return &CodedError{Code: code, Err: err}
+}
+
+// StatusCode returns the code for an HTTP status returned by the CA.
+func StatusCode(status int) Code {
+	switch {
+	case status == http.StatusUnauthorized:
+		return CodeAuth
+	case status == http.StatusForbidden:
+		return CodePolicy
+	case status >= 400 && status < 500:
+		return CodeValidation
+	case status >= 500:
+		return CodeNetwork
+	default:
+		return CodeUnknown
+	}
+}
+
+// GetCode returns the code of the given error. It looks for a CodedError in
+// the chain of causes, and it classifies the errors of the standard library
+// and the errors with an HTTP status.
+func GetCode(err error) Code {
+	type causer interface {
+		Cause() error
+	}
+	type statusCoder interface {
+		StatusCode() int
+	}
+	for err != nil {
+		switch e := err.(type) {
+		case *CodedError:
+			return e.Code
+		case *os.PathError, *os.LinkError:
+			return CodeFile
+		case net.Error:
+			return CodeNetwork
+		case statusCoder:
+			return StatusCode(e.StatusCode())
+		}
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return CodeUnknown
+}
+
+// ExitCode returns the exit status of a command that fails with the given
+// error, 0 if err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return int(GetCode(err))
+}
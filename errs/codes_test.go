@@ -0,0 +1,69 @@
+package errs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type statusError struct {
+	status int
+}
+
+func (e statusError) Error() string   { return "status error" }
+func (e statusError) StatusCode() int { return e.status }
+
+func TestGetCode(t *testing.T) {
+	_, fileErr := ioutil.ReadFile("im-fairly-certain-this-file-doesnt-exist")
+	require.Error(t, fileErr)
+	netErr := &url.Error{Op: "Get", URL: "https://ca.example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{"nil", nil, CodeUnknown},
+		{"unknown", errors.New("unknown"), CodeUnknown},
+		{"coded", WithCode(errors.New("policy"), CodePolicy), CodePolicy},
+		{"wrapped", errors.Wrap(WithCode(errors.New("auth"), CodeAuth), "error signing"), CodeAuth},
+		{"outer", WithCode(errors.Wrap(WithCode(errors.New("file"), CodeFile), "validation"), CodeValidation), CodeValidation},
+		{"file", fileErr, CodeFile},
+		{"file-wrapped", errors.Wrap(fileErr, "error reading"), CodeFile},
+		{"file-error", FileError(fileErr, "myfile"), CodeFile},
+		{"network", errors.Wrap(netErr, "error connecting"), CodeNetwork},
+		{"status-401", statusError{401}, CodeAuth},
+		{"status-403", errors.Wrap(statusError{403}, "error signing"), CodePolicy},
+		{"status-400", statusError{400}, CodeValidation},
+		{"status-500", statusError{503}, CodeNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, GetCode(tt.err))
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	require.Equal(t, 0, ExitCode(nil))
+	require.Equal(t, 1, ExitCode(errors.New("unknown")))
+	require.Equal(t, 2, ExitCode(WithCode(errors.New("usage"), CodeUsage)))
+	require.Equal(t, 7, ExitCode(WithCode(errors.New("policy"), CodePolicy)))
+}
+
+func TestCodedError(t *testing.T) {
+	err := errors.New("bad token")
+	coded := WithCode(err, CodeAuth)
+	require.Nil(t, WithCode(nil, CodeAuth))
+	require.Equal(t, "bad token", coded.Error())
+	require.Equal(t, err, errors.Cause(coded))
+	require.Equal(t, "auth", CodeAuth.String())
+	require.Equal(t, "unknown", Code(100).String())
+	require.Contains(t, fmt.Sprintf("%+v", coded), "TestCodedError")
+	require.Equal(t, "bad token", fmt.Sprintf("%v", coded))
+}
@@ -1,8 +1,10 @@
 package flags
 
 import (
+	"strconv"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 )
 
@@ -16,17 +18,20 @@ var Insecure = cli.BoolFlag{
 	Name: "insecure",
 }
 
-// Force is a cli.Flag used to overwrite files.
+// Force is a cli.Flag used to overwrite files and to confirm other destructive
+// actions, like a revocation, without asking.
 var Force = cli.BoolFlag{
-	Name:  "f,force",
-	Usage: "Force the overwrite of files without asking.",
+	Name:  "f,force,yes",
+	Usage: "Force the overwrite of files and confirm other destructive actions without asking.",
 }
 
 // PasswordFile is a cli.Flag used to pass a file to encrypt or decrypt a
 // private key.
 var PasswordFile = cli.StringFlag{
-	Name:  "password-file",
-	Usage: `The path to the <file> containing the password to encrypt or decrypt the private key.`,
+	Name: "password-file",
+	Usage: `The path to the <file> containing the password to encrypt or decrypt the private key.
+A <keyring:\<name\>> URI reads the password from the keyring of the operating
+system, it requires a build of step with the keyring build tag.`,
 }
 
 // NoPassword is a cli.Flag used to avoid using a password to encrypt private
@@ -37,6 +42,97 @@ var NoPassword = cli.BoolFlag{
 be written to disk unencrypted. This is not recommended. Requires **--insecure** flag.`,
 }
 
+// DefaultPasswordGenWords is the number of words of the passphrases generated
+// with the --password-gen flag if the length is not given.
+const DefaultPasswordGenWords = 6
+
+// passwordGenValue is the value of the --password-gen flag. It works as a
+// boolean flag, but it also accepts the length of the passphrase, e.g.
+// '--password-gen=8'.
+type passwordGenValue struct {
+	words int
+}
+
+func (v *passwordGenValue) String() string {
+	if v == nil || v.words == 0 {
+		return ""
+	}
+	return strconv.Itoa(v.words)
+}
+
+func (v *passwordGenValue) Set(s string) error {
+	switch s {
+	case "true":
+		v.words = DefaultPasswordGenWords
+	case "false":
+		v.words = 0
+	default:
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return errors.Errorf("'%s' is not a valid length", s)
+		}
+		v.words = n
+	}
+	return nil
+}
+
+// IsBoolFlag allows to use the flag without a value.
+func (v *passwordGenValue) IsBoolFlag() bool {
+	return true
+}
+
+// PasswordGen is a cli.Flag used to generate the password of a new private
+// key instead of asking for it.
+var PasswordGen = cli.GenericFlag{
+	Name: "password-gen",
+	Usage: `Generate a random passphrase to encrypt the private key instead of asking for a
+password. The passphrase has 6 random words, or <length> words with
+'--password-gen=<length>', each word adds about 12.9 bits of entropy. It is
+written to the **--password-file** if it is set, or printed otherwise.`,
+	Value: new(passwordGenValue),
+}
+
+// PasswordGenWords returns the number of words of the passphrase requested
+// with the --password-gen flag, or 0 if the flag is not set.
+func PasswordGenWords(ctx *cli.Context) int {
+	if v, ok := ctx.Generic("password-gen").(*passwordGenValue); ok {
+		return v.words
+	}
+	return 0
+}
+
+// NameConstraintPermit is a cli.Flag used to add a permitted subtree to the
+// name constraints of a CA certificate.
+var NameConstraintPermit = cli.StringSliceFlag{
+	Name: "name-constraint-permit",
+	Usage: `Add a permitted <subtree> to the name constraints of the CA certificate. Use the
+'--name-constraint-permit' flag multiple times to add multiple subtrees.
+
+: <subtree> has the format '<type>:<value>', where <type> is one of **dns**,
+**ip**, **email** or **uri**, e.g. 'dns:example.com', 'ip:10.0.0.0/8',
+'email:example.com' or 'uri:.example.com'. If the type is not given, IP ranges
+and email addresses are detected, and any other value is a DNS domain.`,
+}
+
+// NameConstraintExclude is a cli.Flag used to add an excluded subtree to the
+// name constraints of a CA certificate.
+var NameConstraintExclude = cli.StringSliceFlag{
+	Name: "name-constraint-exclude",
+	Usage: `Add an excluded <subtree> to the name constraints of the CA certificate. Use the
+'--name-constraint-exclude' flag multiple times to add multiple subtrees. The
+format of <subtree> is the same as in **--name-constraint-permit**.`,
+}
+
+// Wildcard is a cli.Flag used to confirm the use of wildcard names in the
+// subject alternative names of a certificate.
+var Wildcard = cli.BoolFlag{
+	Name: "wildcard",
+	Usage: `Confirm the use of wildcard names, like '*.example.com', in the subject or the
+subject alternative names. A wildcard is only valid as the complete left-most
+label of a DNS name with at least two more labels; wildcards in IP addresses,
+emails or URIs, or like '*.*.example.com', are always rejected.`,
+}
+
 // ParseTimeOrDuration is a helper that returns the time or the current time
 // with an extra duration. It's used in flags like --not-before, --not-after.
 func ParseTimeOrDuration(s string) (time.Time, bool) {
@@ -128,7 +128,9 @@ func (c CLICommand) fail(t *testing.T, name string, expected interface{}, msg ..
 	t.Run(name, func(t *testing.T) {
 		out, err := c.run()
 		if assert.NotNil(t, err) {
-			assert.Equals(t, err.Error(), "exit status 1")
+			// The exit status depends on the class of the failure, see
+			// errs.ExitCode.
+			assert.True(t, strings.HasPrefix(err.Error(), "exit status "), err.Error())
 		}
 		switch v := expected.(type) {
 		case string:
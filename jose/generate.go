@@ -143,6 +143,32 @@ func GenerateJWKFromPEM(filename string, subtle bool) (*JSONWebKey, error) {
 	}
 }
 
+// PublicJWK returns a JSONWebKey with the given public key, the default
+// algorithm for it, and the JWK thumbprint as the key id.
+func PublicJWK(pub crypto.PublicKey) (*JSONWebKey, error) {
+	var alg string
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		alg = DefaultRSASigAlgorithm
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		alg = algForKey(pub)
+	default:
+		return nil, errors.Errorf("unsupported public key type '%T'", pub)
+	}
+
+	jwk := &JSONWebKey{
+		Key:       pub,
+		Algorithm: alg,
+		Use:       jwksUsageSig,
+	}
+	kid, err := Thumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	jwk.KeyID = kid
+	return jwk, nil
+}
+
 func algForKey(key crypto.PublicKey) string {
 	switch key := key.(type) {
 	case *ecdsa.PrivateKey:
@@ -281,6 +307,8 @@ func generateOKPKey(crv, alg, use, kid string) (*JSONWebKey, error) {
 			Use:       use,
 			KeyID:     kid,
 		}, nil
+	case "X25519", "Ed448":
+		return nil, errors.Errorf("unsupported curve: %s keys are not supported", crv)
 	default:
 		return nil, errors.Errorf("missing or invalid value for flag '--crv'")
 	}
@@ -45,6 +45,9 @@ func TestGenerateJWK(t *testing.T) {
 		{"OKP", "", "", "", "", 0, "EdDSA", 64, ed25519.PrivateKey{}, true},
 		{"OKP", "", "", "", "sig", 0, "EdDSA", 64, ed25519.PrivateKey{}, true},
 		{"OKP", "", "", "EdDSA", "sig", 0, "EdDSA", 64, ed25519.PrivateKey{}, true},
+		{"OKP", "Ed25519", "", "enc", "", 0, "", 0, nil, false},
+		{"OKP", "X25519", "", "enc", "", 0, "", 0, nil, false},
+		{"OKP", "Ed448", "", "sig", "", 0, "", 0, nil, false},
 		{"oct", "", "", "", "", 0, "HS256", 32, []byte{}, true},
 		{"oct", "", "", "sig", "", 0, "HS256", 32, []byte{}, true},
 		{"oct", "", "HS384", "sig", "a-kid", 16, "HS384", 16, []byte{}, true},
@@ -0,0 +1,197 @@
+package jose
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/config"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// maxJWKSetSize is the maximum size of a remote JWK Set.
+const maxJWKSetSize = 1 << 20
+
+// jwkSetCache is the representation of a cached remote JWK Set.
+type jwkSetCache struct {
+	URL     string          `json:"url"`
+	Expires time.Time       `json:"expires"`
+	ETag    string          `json:"etag,omitempty"`
+	JWKSet  json.RawMessage `json:"jwks"`
+}
+
+// transport is the http.RoundTripper used to retrieve remote JWK Sets.
+var transport http.RoundTripper = http.DefaultTransport
+
+// SetTransport sets the http.RoundTripper used to retrieve remote JWK Sets.
+// The crypto/pki package sets it to the transport used to connect to the CA,
+// so the requests use the global timeout, the resolved addresses, the proxy
+// and the debug logs.
+func SetTransport(rt http.RoundTripper) {
+	transport = rt
+}
+
+// JWKSetCacheDir returns the directory where remote JWK Sets are cached.
+func JWKSetCacheDir() string {
+	return filepath.Join(config.StepPath(), "cache", "jwks")
+}
+
+// FetchJWKSet returns the JWK Set published in the given https URL. Responses
+// are cached in JWKSetCacheDir, and the cached JWK Set is used until it
+// expires as indicated by the Cache-Control or Expires headers of the
+// response. If refresh is true, a cached JWK Set is always revalidated with the
+// server.
+func FetchJWKSet(url string, refresh bool) ([]byte, error) {
+	client := &http.Client{Transport: transport}
+	return fetchJWKSet(client, JWKSetCacheDir(), url, refresh)
+}
+
+func fetchJWKSet(client *http.Client, cacheDir, url string, refresh bool) ([]byte, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, errors.Errorf("error retrieving %s: url must use https", url)
+	}
+
+	filename := filepath.Join(cacheDir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(url))))
+	cached := readJWKSetCache(filename, url)
+	if cached != nil && !refresh && time.Now().Before(cached.Expires) {
+		return cached.JWKSet, nil
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error retrieving %s", url)
+	}
+	req.Header.Set("Accept", "application/jwk-set+json, application/json")
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error retrieving %s", url)
+	}
+	defer resp.Body.Close()
+
+	now := time.Now()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			cached.ETag = etag
+		}
+	case resp.StatusCode == http.StatusOK:
+		b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxJWKSetSize))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error retrieving %s", url)
+		}
+		if !json.Valid(b) {
+			return nil, errors.Errorf("error reading %s: unsupported format", url)
+		}
+		cached = &jwkSetCache{
+			URL:    url,
+			ETag:   resp.Header.Get("ETag"),
+			JWKSet: b,
+		}
+	default:
+		return nil, errors.Errorf("error retrieving %s: %s", url, resp.Status)
+	}
+
+	// Errors writing the cache are ignored, the next call will fetch the
+	// JWK Set again.
+	if expires, ok := cacheExpiration(resp.Header, now); ok {
+		cached.Expires = expires
+		if b, err := json.Marshal(cached); err == nil {
+			if err := os.MkdirAll(filepath.Dir(filename), 0700); err == nil {
+				ioutil.WriteFile(filename, b, 0600)
+			}
+		}
+	} else {
+		os.Remove(filename)
+	}
+
+	return cached.JWKSet, nil
+}
+
+// ParseKeySetURL returns the JWK with the kid in the options from the JWK Set
+// published in the given https URL. If the key is not in the cached JWK Set,
+// the JWK Set is fetched again to support key rotation.
+func ParseKeySetURL(url string, opts ...Option) (*jose.JSONWebKey, error) {
+	ctx, err := new(context).apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := FetchJWKSet(url, false)
+	if err != nil {
+		return nil, err
+	}
+	jwkSet := new(jose.JSONWebKeySet)
+	if err := json.Unmarshal(b, jwkSet); err != nil {
+		return nil, errors.Errorf("error reading %s: unsupported format", url)
+	}
+	if len(jwkSet.Key(ctx.kid)) == 0 {
+		if b, err = FetchJWKSet(url, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return parseKeySetData(ctx, url, b)
+}
+
+// readJWKSetCache returns the cached JWK Set in the given file, or nil if it
+// does not exist or it is not valid.
+func readJWKSetCache(filename, url string) *jwkSetCache {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	var cached jwkSetCache
+	if err := json.Unmarshal(b, &cached); err != nil || cached.URL != url || len(cached.JWKSet) == 0 {
+		return nil
+	}
+	return &cached
+}
+
+// cacheExpiration returns the time until a response with the given headers
+// can be used without revalidation. It returns false if the response cannot
+// be stored.
+func cacheExpiration(h http.Header, now time.Time) (time.Time, bool) {
+	maxAge, noCache := -1, false
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store":
+			return time.Time{}, false
+		case directive == "no-cache":
+			noCache = true
+		case strings.HasPrefix(directive, "max-age="):
+			if n, err := strconv.Atoi(strings.Trim(directive[8:], `"`)); err == nil {
+				maxAge = n
+			}
+		}
+	}
+
+	switch {
+	case noCache:
+		return now, true
+	case maxAge >= 0:
+		if age, err := strconv.Atoi(h.Get("Age")); err == nil && age > 0 {
+			maxAge -= age
+		}
+		return now.Add(time.Duration(maxAge) * time.Second), true
+	default:
+		// Without explicit expiration the response is only stored to be
+		// revalidated.
+		if t, err := http.ParseTime(h.Get("Expires")); err == nil {
+			return t, true
+		}
+		return now, true
+	}
+}
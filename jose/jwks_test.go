@@ -0,0 +1,102 @@
+package jose
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestFetchJWKSet(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/jwks.json")
+	assert.FatalError(t, err)
+	// Cached JWK Sets are compacted
+	buf := new(bytes.Buffer)
+	assert.FatalError(t, json.Compact(buf, b))
+	jwks := buf.Bytes()
+
+	var requests, notModified int
+	cacheControl := "public, max-age=3600"
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(jwks)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "jwks")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Cached using max-age
+	b, err = fetchJWKSet(srv.Client(), dir, srv.URL, false)
+	assert.FatalError(t, err)
+	assert.Equals(t, jwks, b)
+	b, err = fetchJWKSet(srv.Client(), dir, srv.URL, false)
+	assert.FatalError(t, err)
+	assert.Equals(t, jwks, b)
+	assert.Equals(t, 1, requests)
+
+	// Revalidated with the ETag
+	b, err = fetchJWKSet(srv.Client(), dir, srv.URL, true)
+	assert.FatalError(t, err)
+	assert.Equals(t, jwks, b)
+	assert.Equals(t, 2, requests)
+	assert.Equals(t, 1, notModified)
+
+	// Not stored
+	cacheControl = "no-store"
+	_, err = fetchJWKSet(srv.Client(), dir, srv.URL, true)
+	assert.FatalError(t, err)
+	assert.Equals(t, 2, notModified)
+	b, err = fetchJWKSet(srv.Client(), dir, srv.URL, false)
+	assert.FatalError(t, err)
+	assert.Equals(t, jwks, b)
+	assert.Equals(t, 4, requests)
+	assert.Equals(t, 2, notModified)
+
+	_, err = fetchJWKSet(srv.Client(), dir, "http://example.com/jwks.json", false)
+	assert.Error(t, err)
+}
+
+func TestCacheExpiration(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(time.Hour).UTC().Truncate(time.Second)
+	tests := []struct {
+		headers map[string]string
+		want    time.Time
+		ok      bool
+	}{
+		{map[string]string{"Cache-Control": "public, max-age=600"}, now.Add(10 * time.Minute), true},
+		{map[string]string{"Cache-Control": "max-age=600", "Age": "100"}, now.Add(500 * time.Second), true},
+		{map[string]string{"Cache-Control": "max-age=600, no-cache"}, now, true},
+		{map[string]string{"Cache-Control": "private, no-store"}, time.Time{}, false},
+		{map[string]string{"Expires": expires.Format(http.TimeFormat)}, expires, true},
+		{map[string]string{"Cache-Control": "max-age=60", "Expires": expires.Format(http.TimeFormat)}, now.Add(time.Minute), true},
+		{map[string]string{}, now, true},
+	}
+	for i, tc := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tc.headers {
+				h.Set(k, v)
+			}
+			got, ok := cacheExpiration(h, now)
+			assert.Equals(t, tc.ok, ok)
+			assert.True(t, tc.want.Equal(got))
+		})
+	}
+}
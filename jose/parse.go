@@ -127,7 +127,8 @@ func ParseKey(filename string, opts ...Option) (*JSONWebKey, error) {
 // ReadJWKSet reads a JWK Set from a URL or filename. URLs must start with "https://".
 func ReadJWKSet(filename string) ([]byte, error) {
 	if strings.HasPrefix(filename, "https://") {
-		resp, err := http.Get(filename)
+		client := &http.Client{Transport: transport}
+		resp, err := client.Get(filename)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error retrieving %s", filename)
 		}
@@ -165,6 +166,12 @@ func ParseKeySet(filename string, opts ...Option) (*jose.JSONWebKey, error) {
 		return nil, err
 	}
 
+	return parseKeySetData(ctx, filename, b)
+}
+
+// parseKeySetData returns the JWK with the kid in the context from the given
+// JWK Set.
+func parseKeySetData(ctx *context, filename string, b []byte) (*jose.JSONWebKey, error) {
 	// Unmarshal the plain or decrypted JWKSet
 	jwkSet := new(jose.JSONWebKeySet)
 	if err := json.Unmarshal(b, jwkSet); err != nil {
@@ -0,0 +1,82 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// SignCompact signs the payload with the given crypto.Signer and returns the
+// JWS in compact serialization format. It is used with keys that cannot be
+// used directly by the jose signer, like the keys in a KMS. The "alg" header
+// is set to the given algorithm.
+func SignCompact(alg SignatureAlgorithm, signer crypto.Signer, header map[string]interface{}, payload []byte) (string, error) {
+	var hash crypto.Hash
+	var opts crypto.SignerOpts
+	switch alg {
+	case ES256, RS256, PS256:
+		hash = crypto.SHA256
+	case ES384, RS384, PS384:
+		hash = crypto.SHA384
+	case ES512, RS512, PS512:
+		hash = crypto.SHA512
+	default:
+		return "", errors.Errorf("unsupported signature algorithm %s", alg)
+	}
+	opts = hash
+	switch alg {
+	case ES256, ES384, ES512:
+		if _, ok := signer.Public().(*ecdsa.PublicKey); !ok {
+			return "", errors.Errorf("signature algorithm %s requires an EC key", alg)
+		}
+	case PS256, PS384, PS512:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+		fallthrough
+	default:
+		if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+			return "", errors.Errorf("signature algorithm %s requires an RSA key", alg)
+		}
+	}
+
+	h := map[string]interface{}{}
+	for k, v := range header {
+		h[k] = v
+	}
+	h["alg"] = string(alg)
+	b, err := json.Marshal(h)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling JWS header")
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hasher := hash.New()
+	hasher.Write([]byte(signingInput))
+	sig, err := signer.Sign(rand.Reader, hasher.Sum(nil), opts)
+	if err != nil {
+		return "", errors.Wrap(err, "error signing JWS")
+	}
+
+	// JWS uses r || s instead of the ASN.1 signature
+	if pub, ok := signer.Public().(*ecdsa.PublicKey); ok {
+		var es struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(sig, &es); err != nil {
+			return "", errors.Wrap(err, "error parsing ECDSA signature")
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		rb, sb := es.R.Bytes(), es.S.Bytes()
+		copy(sig[size-len(rb):size], rb)
+		copy(sig[2*size-len(sb):], sb)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
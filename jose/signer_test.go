@@ -0,0 +1,78 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+// opaqueSigner hides the type of the key, like a signer backed by a KMS.
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+func TestSignCompact(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		alg    SignatureAlgorithm
+		signer crypto.Signer
+		pub    crypto.PublicKey
+	}{
+		{ES256, opaqueSigner{p256}, &p256.PublicKey},
+		{ES512, opaqueSigner{p521}, &p521.PublicKey},
+		{RS256, opaqueSigner{rsaKey}, &rsaKey.PublicKey},
+		{RS384, opaqueSigner{rsaKey}, &rsaKey.PublicKey},
+		{PS512, opaqueSigner{rsaKey}, &rsaKey.PublicKey},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.alg), func(t *testing.T) {
+			raw, err := SignCompact(tc.alg, tc.signer, map[string]interface{}{"kid": "foo", "typ": "JWT"}, []byte(`{"sub":"bar"}`))
+			assert.FatalError(t, err)
+
+			tok, err := ParseSigned(raw)
+			assert.FatalError(t, err)
+			assert.Equals(t, string(tc.alg), tok.Headers[0].Algorithm)
+			assert.Equals(t, "foo", tok.Headers[0].KeyID)
+			var claims Claims
+			assert.FatalError(t, tok.Claims(tc.pub, &claims))
+			assert.Equals(t, "bar", claims.Subject)
+		})
+	}
+}
+
+func TestSignCompact_fail(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		alg    SignatureAlgorithm
+		signer crypto.Signer
+		err    string
+	}{
+		"HS256": {HS256, opaqueSigner{p256}, "unsupported signature algorithm HS256"},
+		"ES256": {ES256, opaqueSigner{rsaKey}, "signature algorithm ES256 requires an EC key"},
+		"RS256": {RS256, opaqueSigner{p256}, "signature algorithm RS256 requires an RSA key"},
+		"PS256": {PS256, opaqueSigner{p256}, "signature algorithm PS256 requires an RSA key"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := SignCompact(tc.alg, tc.signer, nil, []byte("{}"))
+			if assert.Error(t, err) {
+				assert.Equals(t, tc.err, err.Error())
+			}
+		})
+	}
+}
@@ -234,6 +234,12 @@ func ParseJWS(s string) (*JSONWebSignature, error) {
 	return jose.ParseSigned(s)
 }
 
+// ParseDetachedJWS parses a signed message in compact serialization format
+// with a detached payload.
+func ParseDetachedJWS(s string, payload []byte) (*JSONWebSignature, error) {
+	return jose.ParseDetached(s, payload)
+}
+
 // Determine whether a JSONWebKey is symmetric
 func IsSymmetric(k *JSONWebKey) bool {
 	switch k.Key.(type) {
@@ -0,0 +1,143 @@
+// Package keyring stores passwords in the credential store of the operating
+// system: the Secret Service (libsecret) on Linux, the Keychain on macOS, and
+// the Credential Manager on Windows.
+//
+// Passwords are identified by a name, and they can be used instead of password
+// files using URIs like:
+//
+//	keyring:root-ca
+//	keyring:provisioner/admin@example.com
+//
+// The credential stores are accessed using the go-keyring package, that is
+// only included with the keyring build tag. Without it Get, Set and Delete
+// return an error.
+package keyring
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Scheme is the scheme of the keyring URIs.
+const Scheme = "keyring"
+
+// Service is the service name used to store the passwords.
+const Service = "step"
+
+// errNotFound is the error returned by the providers if a password does not
+// exist.
+var errNotFound = errors.New("secret not found in keyring")
+
+// provider is the interface implemented by the credential stores.
+type provider interface {
+	Get(service, user string) (string, error)
+	Set(service, user, password string) error
+	Delete(service, user string) error
+}
+
+// backend is the credential store used, it's replaced on init with the one of
+// the operating system if step is compiled with the keyring build tag.
+var backend provider = unsupportedProvider{}
+
+// MockInit replaces the credential store with an in-memory one, it's meant to
+// be used in tests.
+func MockInit() {
+	backend = &mockProvider{}
+}
+
+// Supported returns true if step is compiled with the credential store of the
+// operating system.
+func Supported() bool {
+	_, ok := backend.(unsupportedProvider)
+	return !ok
+}
+
+// notFoundError is the error returned by Get if a password does not exist.
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return "password '" + string(e) + "' not found in the keyring"
+}
+
+// IsNotFound returns true if the given error is the error returned by Get if a
+// password does not exist.
+func IsNotFound(err error) bool {
+	_, ok := errors.Cause(err).(notFoundError)
+	return ok
+}
+
+// IsURI returns true if the given name is a keyring URI.
+func IsURI(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), Scheme+":")
+}
+
+// ParseURI returns the name of the password in the given keyring URI.
+func ParseURI(rawuri string) (string, error) {
+	if !IsURI(rawuri) {
+		return "", errors.Errorf("error parsing %s: not a keyring URI", rawuri)
+	}
+	name := rawuri[len(Scheme)+1:]
+	if err := validateName(name); err != nil {
+		return "", errors.Wrapf(err, "error parsing %s", rawuri)
+	}
+	return name, nil
+}
+
+// Get returns the password stored with the given name.
+func Get(name string) ([]byte, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	password, err := backend.Get(Service, name)
+	if err != nil {
+		if err == errNotFound {
+			return nil, notFoundError(name)
+		}
+		return nil, errors.Wrapf(err, "error reading password '%s' from the keyring", name)
+	}
+	return []byte(password), nil
+}
+
+// Set stores the password with the given name, replacing the previous one if
+// it exists.
+func Set(name string, password []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if len(password) == 0 {
+		return errors.Errorf("error storing password '%s' in the keyring: password cannot be empty", name)
+	}
+	if err := backend.Set(Service, name, string(password)); err != nil {
+		return errors.Wrapf(err, "error storing password '%s' in the keyring", name)
+	}
+	return nil
+}
+
+// Delete removes the password stored with the given name.
+func Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if err := backend.Delete(Service, name); err != nil {
+		if err == errNotFound {
+			return errors.Errorf("password '%s' not found in the keyring", name)
+		}
+		return errors.Wrapf(err, "error deleting password '%s' from the keyring", name)
+	}
+	return nil
+}
+
+// validateName checks that the name of a password is not empty and does not
+// contain whitespace.
+func validateName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("keyring name cannot be empty")
+	case strings.IndexFunc(name, unicode.IsSpace) >= 0:
+		return errors.Errorf("keyring name '%s' cannot contain whitespace", name)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package keyring
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		name string
+		err  string
+	}{
+		{"keyring:root-ca", "root-ca", ""},
+		{"KEYRING:provisioner/admin@example.com", "provisioner/admin@example.com", ""},
+		{"keyring:", "", "error parsing keyring:: keyring name cannot be empty"},
+		{"keyring:foo bar", "", "error parsing keyring:foo bar: keyring name 'foo bar' cannot contain whitespace"},
+		{"password.txt", "", "error parsing password.txt: not a keyring URI"},
+		{"keychain:label=foo", "", "error parsing keychain:label=foo: not a keyring URI"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.uri, func(t *testing.T) {
+			name, err := ParseURI(tc.uri)
+			if tc.err != "" {
+				assert.Error(t, err)
+				assert.Equals(t, tc.err, err.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, IsURI(tc.uri))
+			assert.Equals(t, tc.name, name)
+		})
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	defer func(p provider) { backend = p }(backend)
+	MockInit()
+
+	assert.True(t, Supported())
+	_, err := Get("root-ca")
+	assert.Equals(t, "password 'root-ca' not found in the keyring", err.Error())
+	assert.True(t, IsNotFound(err))
+	assert.Equals(t, "password 'root-ca' not found in the keyring", Delete("root-ca").Error())
+
+	assert.NoError(t, Set("root-ca", []byte("first")))
+	assert.NoError(t, Set("root-ca", []byte("second")))
+	b, err := Get("root-ca")
+	assert.NoError(t, err)
+	assert.Equals(t, []byte("second"), b)
+
+	_, err = backend.Get(Service, "root-ca")
+	assert.NoError(t, err)
+
+	assert.NoError(t, Delete("root-ca"))
+	_, err = Get("root-ca")
+	assert.Error(t, err)
+
+	assert.Equals(t, "error storing password 'root-ca' in the keyring: password cannot be empty", Set("root-ca", nil).Error())
+	assert.Equals(t, "keyring name cannot be empty", Set("", []byte("pass")).Error())
+	_, err = Get("foo bar")
+	assert.Equals(t, "keyring name 'foo bar' cannot contain whitespace", err.Error())
+}
+
+func TestKeyring_unsupported(t *testing.T) {
+	defer func(p provider) { backend = p }(backend)
+	backend = unsupportedProvider{}
+
+	assert.False(t, Supported())
+	_, err := Get("root-ca")
+	assert.Equals(t, "error reading password 'root-ca' from the keyring: keyring is not supported: step was compiled without the keyring build tag, use a build with 'make build TAGS=keyring'", err.Error())
+	assert.False(t, IsNotFound(err))
+}
@@ -0,0 +1,65 @@
+package keyring
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// errUnsupported is the error returned if step is compiled without the
+// keyring build tag, as the released binaries are.
+var errUnsupported = errors.New("keyring is not supported: step was compiled without the keyring build tag, use a build with 'make build TAGS=keyring'")
+
+// unsupportedProvider is the provider used if step is compiled without the
+// keyring build tag.
+type unsupportedProvider struct{}
+
+func (unsupportedProvider) Get(service, user string) (string, error) {
+	return "", errUnsupported
+}
+
+func (unsupportedProvider) Set(service, user, password string) error {
+	return errUnsupported
+}
+
+func (unsupportedProvider) Delete(service, user string) error {
+	return errUnsupported
+}
+
+// mockProvider is an in-memory provider used in tests.
+type mockProvider struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]string
+}
+
+func (p *mockProvider) Get(service, user string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if password, ok := p.secrets[service][user]; ok {
+		return password, nil
+	}
+	return "", errNotFound
+}
+
+func (p *mockProvider) Set(service, user, password string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.secrets == nil {
+		p.secrets = make(map[string]map[string]string)
+	}
+	if p.secrets[service] == nil {
+		p.secrets[service] = make(map[string]string)
+	}
+	p.secrets[service][user] = password
+	return nil
+}
+
+func (p *mockProvider) Delete(service, user string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.secrets[service][user]; !ok {
+		return errNotFound
+	}
+	delete(p.secrets[service], user)
+	return nil
+}
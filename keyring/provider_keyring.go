@@ -0,0 +1,35 @@
+// +build keyring
+
+package keyring
+
+import (
+	gokeyring "github.com/zalando/go-keyring"
+)
+
+func init() {
+	backend = osProvider{}
+}
+
+// osProvider is the provider that uses the credential store of the operating
+// system.
+type osProvider struct{}
+
+func (osProvider) Get(service, user string) (string, error) {
+	password, err := gokeyring.Get(service, user)
+	if err == gokeyring.ErrNotFound {
+		return "", errNotFound
+	}
+	return password, err
+}
+
+func (osProvider) Set(service, user, password string) error {
+	return gokeyring.Set(service, user, password)
+}
+
+func (osProvider) Delete(service, user string) error {
+	err := gokeyring.Delete(service, user)
+	if err == gokeyring.ErrNotFound {
+		return errNotFound
+	}
+	return err
+}
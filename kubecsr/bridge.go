@@ -0,0 +1,242 @@
+// +build kubernetes
+
+package kubecsr
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	certv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Bridge signs the approved CertificateSigningRequests of a signer name.
+type Bridge struct {
+	client     kubernetes.Interface
+	sign       SignFunc
+	signerName string
+	selector   labels.Selector
+	logger     *log.Logger
+}
+
+// New returns a new bridge that signs the requests using the given function.
+func New(client kubernetes.Interface, sign SignFunc, opts ...Option) (*Bridge, error) {
+	o := &options{
+		signerName: DefaultSignerName,
+		logger:     log.New(ioutil.Discard, "", 0),
+	}
+	for _, fn := range opts {
+		fn(o)
+	}
+	selector, err := labels.Parse(o.selector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing label selector '%s'", o.selector)
+	}
+	return &Bridge{
+		client:     client,
+		sign:       sign,
+		signerName: o.signerName,
+		selector:   selector,
+		logger:     o.logger,
+	}, nil
+}
+
+// NewClient returns a Kubernetes client configured using the given kubeconfig
+// file. If kubeconfig is empty, the service account of the pod is used when
+// running in a cluster, and the default kubeconfig files otherwise.
+func NewClient(kubeconfig string) (kubernetes.Interface, error) {
+	var config *rest.Config
+	var err error
+	if kubeconfig == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		config, err = rest.InClusterConfig()
+	} else {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = kubeconfig
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading Kubernetes configuration")
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating Kubernetes client")
+	}
+	return client, nil
+}
+
+// Run signs the requests approved and pending, and the ones approved after,
+// until the given context is canceled.
+func (b *Bridge) Run(ctx context.Context) error {
+	for {
+		rv, _, err := b.sync(ctx)
+		if err != nil {
+			return err
+		}
+		if err := b.watch(ctx, rv); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Sync signs the requests approved and pending, and returns the number of
+// requests signed.
+func (b *Bridge) Sync(ctx context.Context) (int, error) {
+	_, n, err := b.sync(ctx)
+	return n, err
+}
+
+// sync is like Sync, but it also returns the resource version of the list of
+// requests.
+func (b *Bridge) sync(ctx context.Context) (string, int, error) {
+	list, err := b.client.CertificatesV1().CertificateSigningRequests().List(ctx, metav1.ListOptions{
+		LabelSelector: b.selector.String(),
+	})
+	if err != nil {
+		return "", 0, errors.Wrap(err, "error listing certificate signing requests")
+	}
+	var n int
+	for i := range list.Items {
+		if b.handle(ctx, &list.Items[i]) {
+			n++
+		}
+	}
+	return list.ResourceVersion, n, nil
+}
+
+// watch handles the requests added or modified after the given resource
+// version. It returns without errors when the watch is closed by the server,
+// and the requests must be listed again.
+func (b *Bridge) watch(ctx context.Context, rv string) error {
+	w, err := b.client.CertificatesV1().CertificateSigningRequests().Watch(ctx, metav1.ListOptions{
+		LabelSelector:   b.selector.String(),
+		ResourceVersion: rv,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error watching certificate signing requests")
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			switch ev.Type {
+			case watch.Added, watch.Modified:
+				if csr, ok := ev.Object.(*certv1.CertificateSigningRequest); ok {
+					b.handle(ctx, csr)
+				}
+			case watch.Error:
+				return nil
+			}
+		}
+	}
+}
+
+// handle signs the given request if it's approved and pending. It returns
+// true if the request has been signed.
+func (b *Bridge) handle(ctx context.Context, csr *certv1.CertificateSigningRequest) bool {
+	if !b.isPending(csr) {
+		return false
+	}
+
+	csr = csr.DeepCopy()
+	cr, err := parseRequest(csr.Spec.Request)
+	if err != nil {
+		b.fail(ctx, csr, "InvalidRequest", err)
+		return false
+	}
+	var lifetime time.Duration
+	if csr.Spec.ExpirationSeconds != nil {
+		lifetime = time.Duration(*csr.Spec.ExpirationSeconds) * time.Second
+	}
+	chain, err := b.sign(cr, lifetime)
+	if err != nil {
+		b.fail(ctx, csr, "SigningError", err)
+		return false
+	}
+
+	for _, crt := range chain {
+		csr.Status.Certificate = append(csr.Status.Certificate, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+	if _, err := b.client.CertificatesV1().CertificateSigningRequests().UpdateStatus(ctx, csr, metav1.UpdateOptions{}); err != nil {
+		b.logger.Printf("error updating certificate signing request %s: %v", csr.Name, err)
+		return false
+	}
+	b.logger.Printf("certificate signing request %s signed", csr.Name)
+	return true
+}
+
+// isPending returns true if the request is for the signer name of the bridge
+// and it's approved, but not signed yet.
+func (b *Bridge) isPending(csr *certv1.CertificateSigningRequest) bool {
+	if csr.Spec.SignerName != b.signerName || len(csr.Status.Certificate) > 0 {
+		return false
+	}
+	if !b.selector.Matches(labels.Set(csr.Labels)) {
+		return false
+	}
+	var approved bool
+	for _, c := range csr.Status.Conditions {
+		switch c.Type {
+		case certv1.CertificateApproved:
+			approved = c.Status == corev1.ConditionTrue
+		case certv1.CertificateDenied, certv1.CertificateFailed:
+			if c.Status == corev1.ConditionTrue {
+				return false
+			}
+		}
+	}
+	return approved
+}
+
+// fail adds the Failed condition to the given request.
+func (b *Bridge) fail(ctx context.Context, csr *certv1.CertificateSigningRequest, reason string, err error) {
+	b.logger.Printf("error signing certificate signing request %s: %v", csr.Name, err)
+	csr.Status.Conditions = append(csr.Status.Conditions, certv1.CertificateSigningRequestCondition{
+		Type:           certv1.CertificateFailed,
+		Status:         corev1.ConditionTrue,
+		Reason:         reason,
+		Message:        err.Error(),
+		LastUpdateTime: metav1.Now(),
+	})
+	if _, err := b.client.CertificatesV1().CertificateSigningRequests().UpdateStatus(ctx, csr, metav1.UpdateOptions{}); err != nil {
+		b.logger.Printf("error updating certificate signing request %s: %v", csr.Name, err)
+	}
+}
+
+func parseRequest(b []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("error decoding request: not a PEM certificate request")
+	}
+	cr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing request")
+	}
+	if err := cr.CheckSignature(); err != nil {
+		return nil, errors.Wrap(err, "error validating request signature")
+	}
+	return cr, nil
+}
@@ -0,0 +1,34 @@
+// +build !kubernetes
+
+package kubecsr
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Bridge signs the approved CertificateSigningRequests of a signer name. The
+// Kubernetes client is only included with the kubernetes build tag.
+type Bridge struct{}
+
+// New returns an error, step was compiled without the kubernetes build tag.
+func New(client interface{}, sign SignFunc, opts ...Option) (*Bridge, error) {
+	return nil, errors.New("Kubernetes is not supported: step was compiled without the kubernetes build tag")
+}
+
+// NewClient returns an error, step was compiled without the kubernetes build
+// tag.
+func NewClient(kubeconfig string) (interface{}, error) {
+	return nil, errors.New("Kubernetes is not supported: step was compiled without the kubernetes build tag")
+}
+
+// Run returns an error, step was compiled without the kubernetes build tag.
+func (b *Bridge) Run(ctx context.Context) error {
+	return errors.New("Kubernetes is not supported: step was compiled without the kubernetes build tag")
+}
+
+// Sync returns an error, step was compiled without the kubernetes build tag.
+func (b *Bridge) Sync(ctx context.Context) (int, error) {
+	return 0, errors.New("Kubernetes is not supported: step was compiled without the kubernetes build tag")
+}
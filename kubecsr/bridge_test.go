@@ -0,0 +1,221 @@
+// +build kubernetes
+
+package kubecsr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	certv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testSigner signs requests with a self-signed certificate.
+type testSigner struct {
+	lifetime time.Duration
+	err      error
+}
+
+func (s *testSigner) Sign(cr *x509.CertificateRequest, lifetime time.Duration) ([]*x509.Certificate, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.lifetime = lifetime
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      cr.Subject,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, cr.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{crt}, nil
+}
+
+func mustRequest(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "web.example.com"},
+	}, key)
+	assert.FatalError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func newCSR(name, signerName string, request []byte, labels map[string]string, conditions ...certv1.RequestConditionType) *certv1.CertificateSigningRequest {
+	csr := &certv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec: certv1.CertificateSigningRequestSpec{
+			Request:    request,
+			SignerName: signerName,
+		},
+	}
+	for _, c := range conditions {
+		csr.Status.Conditions = append(csr.Status.Conditions, certv1.CertificateSigningRequestCondition{
+			Type:   c,
+			Status: corev1.ConditionTrue,
+		})
+	}
+	return csr
+}
+
+func getCSR(t *testing.T, client *fake.Clientset, name string) *certv1.CertificateSigningRequest {
+	csr, err := client.CertificatesV1().CertificateSigningRequests().Get(context.Background(), name, metav1.GetOptions{})
+	assert.FatalError(t, err)
+	return csr
+}
+
+func TestNew(t *testing.T) {
+	s := &testSigner{}
+	b, err := New(fake.NewSimpleClientset(), s.Sign)
+	assert.FatalError(t, err)
+	assert.Equals(t, DefaultSignerName, b.signerName)
+	assert.True(t, b.selector.Empty())
+
+	b, err = New(fake.NewSimpleClientset(), s.Sign, WithSignerName("example.com/foo"), WithLabelSelector("app=web"))
+	assert.FatalError(t, err)
+	assert.Equals(t, "example.com/foo", b.signerName)
+	assert.Equals(t, "app=web", b.selector.String())
+
+	_, err = New(fake.NewSimpleClientset(), s.Sign, WithLabelSelector("app=(web"))
+	assert.Error(t, err)
+}
+
+func TestBridge_Sync(t *testing.T) {
+	req := mustRequest(t)
+	web := map[string]string{"app": "web"}
+	expiring := newCSR("expiring", DefaultSignerName, req, web, certv1.CertificateApproved)
+	seconds := int32(3600)
+	expiring.Spec.ExpirationSeconds = &seconds
+	signed := newCSR("signed", DefaultSignerName, req, web, certv1.CertificateApproved)
+	signed.Status.Certificate = []byte("certificate")
+
+	client := fake.NewSimpleClientset(
+		newCSR("approved", DefaultSignerName, req, web, certv1.CertificateApproved),
+		expiring,
+		signed,
+		newCSR("pending", DefaultSignerName, req, web),
+		newCSR("denied", DefaultSignerName, req, web, certv1.CertificateApproved, certv1.CertificateDenied),
+		newCSR("other-signer", "kubernetes.io/kube-apiserver-client", req, web, certv1.CertificateApproved),
+		newCSR("other-labels", DefaultSignerName, req, map[string]string{"app": "db"}, certv1.CertificateApproved),
+		newCSR("invalid", DefaultSignerName, []byte("not a request"), web, certv1.CertificateApproved),
+	)
+	s := &testSigner{}
+	b, err := New(client, s.Sign, WithLabelSelector("app=web"))
+	assert.FatalError(t, err)
+
+	n, err := b.Sync(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 2, n)
+	assert.Equals(t, time.Hour, s.lifetime)
+
+	for _, name := range []string{"approved", "expiring"} {
+		block, _ := pem.Decode(getCSR(t, client, name).Status.Certificate)
+		if assert.NotNil(t, block) {
+			crt, err := x509.ParseCertificate(block.Bytes)
+			assert.FatalError(t, err)
+			assert.Equals(t, "web.example.com", crt.Subject.CommonName)
+		}
+	}
+	assert.Equals(t, []byte("certificate"), getCSR(t, client, "signed").Status.Certificate)
+	for _, name := range []string{"pending", "denied", "other-signer", "other-labels"} {
+		csr := getCSR(t, client, name)
+		assert.Len(t, 0, csr.Status.Certificate)
+	}
+
+	csr := getCSR(t, client, "invalid")
+	assert.Len(t, 0, csr.Status.Certificate)
+	last := csr.Status.Conditions[len(csr.Status.Conditions)-1]
+	assert.Equals(t, certv1.CertificateFailed, last.Type)
+	assert.Equals(t, "InvalidRequest", last.Reason)
+
+	// Failed requests are not signed again.
+	n, err = b.Sync(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, n)
+}
+
+func TestBridge_Sync_signingError(t *testing.T) {
+	client := fake.NewSimpleClientset(newCSR("approved", DefaultSignerName, mustRequest(t), nil, certv1.CertificateApproved))
+	s := &testSigner{err: errors.New("provisioner not found")}
+	b, err := New(client, s.Sign)
+	assert.FatalError(t, err)
+
+	n, err := b.Sync(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, n)
+
+	csr := getCSR(t, client, "approved")
+	last := csr.Status.Conditions[len(csr.Status.Conditions)-1]
+	assert.Equals(t, certv1.CertificateFailed, last.Type)
+	assert.Equals(t, "SigningError", last.Reason)
+	assert.Equals(t, "provisioner not found", last.Message)
+}
+
+func TestBridge_Run(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	s := &testSigner{}
+	b, err := New(client, s.Sign)
+	assert.FatalError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- b.Run(ctx)
+	}()
+
+	// Wait for the watch before creating the request.
+	deadline := time.Now().Add(10 * time.Second)
+	for !hasWatch(client) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	csrs := client.CertificatesV1().CertificateSigningRequests()
+	csr, err := csrs.Create(context.Background(), newCSR("web", DefaultSignerName, mustRequest(t), nil), metav1.CreateOptions{})
+	assert.FatalError(t, err)
+	csr.Status.Conditions = append(csr.Status.Conditions, certv1.CertificateSigningRequestCondition{
+		Type:   certv1.CertificateApproved,
+		Status: corev1.ConditionTrue,
+	})
+	_, err = csrs.UpdateApproval(context.Background(), "web", csr, metav1.UpdateOptions{})
+	assert.FatalError(t, err)
+
+	for len(getCSR(t, client, "web").Status.Certificate) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, len(getCSR(t, client, "web").Status.Certificate) > 0)
+
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+func hasWatch(client *fake.Clientset) bool {
+	for _, a := range client.Actions() {
+		if a.GetVerb() == "watch" {
+			return true
+		}
+	}
+	return false
+}
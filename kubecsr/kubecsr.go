@@ -0,0 +1,56 @@
+// Package kubecsr signs Kubernetes CertificateSigningRequests. It watches the
+// requests of a signer name, and once a request has been approved it is signed
+// and the certificate is added to its status.
+//
+// It's a lightweight alternative to running a controller in the cluster: the
+// approval of the requests is still done by Kubernetes, by an administrator or
+// by an approver controller.
+//
+// The Kubernetes client is only included with the kubernetes build tag.
+// Without it NewClient and New return an error.
+package kubecsr
+
+import (
+	"crypto/x509"
+	"log"
+	"time"
+)
+
+// DefaultSignerName is the signer name of the requests signed by default.
+const DefaultSignerName = "smallstep.com/step-ca"
+
+// SignFunc signs a certificate request, and returns the certificate followed
+// by its intermediates. If lifetime is zero the default of the CA is used.
+type SignFunc func(csr *x509.CertificateRequest, lifetime time.Duration) ([]*x509.Certificate, error)
+
+type options struct {
+	signerName string
+	selector   string
+	logger     *log.Logger
+}
+
+// Option is the type of the options passed to New.
+type Option func(o *options)
+
+// WithSignerName sets the signer name of the requests to sign, by default
+// DefaultSignerName is used.
+func WithSignerName(name string) Option {
+	return func(o *options) {
+		o.signerName = name
+	}
+}
+
+// WithLabelSelector only signs the requests matching the given label selector,
+// e.g. 'app=web,env!=dev'.
+func WithLabelSelector(selector string) Option {
+	return func(o *options) {
+		o.selector = selector
+	}
+}
+
+// WithLogger logs the requests signed and the errors to the given logger.
+func WithLogger(l *log.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
@@ -60,21 +60,34 @@ endif
 # Build
 #########################################
 
+# Base64 encoding of the DER public key used by 'step update' to verify the
+# signature of the checksums of the releases, see the checksums target. The
+# binaries built without it cannot be updated with 'step update'.
+RELEASE_PUBLIC_KEY ?=
+
 DATE    := $(shell date -u '+%Y-%m-%d %H:%M UTC')
-LDFLAGS := -ldflags='-w -X "main.Version=$(VERSION)" -X "main.BuildTime=$(DATE)"'
+LDFLAGS := -ldflags='-w -X "main.Version=$(VERSION)" -X "main.BuildTime=$(DATE)" -X "github.com/smallstep/cli/update.releasePublicKey=$(RELEASE_PUBLIC_KEY)"'
 GOFLAGS := CGO_ENABLED=0
 
+# Optional build tags, e.g. TAGS="awskms cloudkms azurekms". The packages used
+# by the tagged files are not managed by dep. The pkcs11 tag also requires cgo,
+# e.g. make build TAGS=pkcs11 GOFLAGS=CGO_ENABLED=1.
+TAGS ?=
+ifneq ($(TAGS),)
+BUILDTAGS := -tags '$(TAGS)'
+endif
+
 build: $(PREFIX)bin/$(BINNAME)
 	@echo "Build Complete!"
 
 $(PREFIX)bin/$(BINNAME): vendor $(call rwildcard,*.go)
 	$Q mkdir -p $(@D)
-	$Q $(GOOS_OVERRIDE) $(GOFLAGS) go build -v -o $(PREFIX)bin/$(BINNAME) $(LDFLAGS) $(PKG)
+	$Q $(GOOS_OVERRIDE) $(GOFLAGS) go build -v $(BUILDTAGS) -o $(PREFIX)bin/$(BINNAME) $(LDFLAGS) $(PKG)
 
 # Target for building without calling dep ensure
 simple:
 	$Q mkdir -p bin/
-	$Q $(GOOS_OVERRIDE) $(GOFLAGS) go build -v -o bin/$(BINNAME) $(LDFLAGS) $(PKG)
+	$Q $(GOOS_OVERRIDE) $(GOFLAGS) go build -v $(BUILDTAGS) -o bin/$(BINNAME) $(LDFLAGS) $(PKG)
 	@echo "Build Complete!"
 
 .PHONY: build simple
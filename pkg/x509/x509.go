@@ -2337,6 +2337,10 @@ type CertificateRequest struct {
 	EmailAddresses []string
 	IPAddresses    []net.IP
 	URIs           []*url.URL
+
+	// ChallengePassword is the PKCS #9 challengePassword attribute, used by
+	// some CAs to authorize the request. It is not added if it's empty.
+	ChallengePassword string
 }
 
 // These structures reflect the ASN.1 structure of X.509 certificate
@@ -2361,6 +2365,45 @@ type certificateRequest struct {
 // extensions in a CSR.
 var oidExtensionRequest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
 
+// oidChallengePassword is the PKCS#9 OBJECT IDENTIFIER of the challenge
+// password attribute in a CSR.
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+// challengePasswordAttribute reflects the ASN.1 structure of the challenge
+// password attribute. The value is a PrintableString, or a UTF8String if it
+// has characters that are not printable.
+type challengePasswordAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value []string `asn1:"set"`
+}
+
+// newChallengePasswordAttribute returns the raw challenge password attribute.
+func newChallengePasswordAttribute(password string) (asn1.RawValue, error) {
+	b, err := asn1.Marshal(challengePasswordAttribute{
+		Type:  oidChallengePassword,
+		Value: []string{password},
+	})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{FullBytes: b}, nil
+}
+
+// parseChallengePassword returns the challenge password in the given raw
+// attributes, or an empty string if there is none.
+func parseChallengePassword(rawAttributes []asn1.RawValue) string {
+	for _, rawAttr := range rawAttributes {
+		var attr challengePasswordAttribute
+		if rest, err := asn1.Unmarshal(rawAttr.FullBytes, &attr); err != nil || len(rest) != 0 {
+			continue
+		}
+		if attr.Type.Equal(oidChallengePassword) && len(attr.Value) > 0 {
+			return attr.Value[0]
+		}
+	}
+	return ""
+}
+
 // newRawAttributes converts AttributeTypeAndValueSETs from a template
 // CertificateRequest's Attributes into tbsCertificateRequest RawAttributes.
 func newRawAttributes(attributes []pkix.AttributeTypeAndValueSET) ([]asn1.RawValue, error) {
@@ -2540,6 +2583,13 @@ func CreateCertificateRequest(rand io.Reader, template *CertificateRequest, priv
 	if err != nil {
 		return
 	}
+	if template.ChallengePassword != "" {
+		attr, err := newChallengePasswordAttribute(template.ChallengePassword)
+		if err != nil {
+			return nil, err
+		}
+		rawAttributes = append(rawAttributes, attr)
+	}
 
 	tbsCSR := tbsCertificateRequest{
 		Version: 0, // PKCS #10, RFC 2986
@@ -2607,6 +2657,8 @@ func parseCertificateRequest(in *certificateRequest) (*CertificateRequest, error
 
 		Version:    in.TBSCSR.Version,
 		Attributes: parseRawAttributes(in.TBSCSR.RawAttributes),
+
+		ChallengePassword: parseChallengePassword(in.TBSCSR.RawAttributes),
 	}
 
 	var err error
@@ -1303,6 +1303,26 @@ func marshalAndParseCSR(t *testing.T, template *CertificateRequest) *Certificate
 	return csr
 }
 
+func TestCertificateRequestChallengePassword(t *testing.T) {
+	for _, password := range []string{"secret", "contraseña", ""} {
+		template := CertificateRequest{
+			Subject:           pkix.Name{CommonName: "test.example.com"},
+			DNSNames:          []string{"test.example.com"},
+			ChallengePassword: password,
+		}
+		csr := marshalAndParseCSR(t, &template)
+		if err := csr.CheckSignature(); err != nil {
+			t.Fatalf("request with challenge password %q has invalid signature: %s", password, err)
+		}
+		if csr.ChallengePassword != password {
+			t.Errorf("got challenge password %q, want %q", csr.ChallengePassword, password)
+		}
+		if !reflect.DeepEqual(csr.DNSNames, template.DNSNames) {
+			t.Errorf("got DNS names %v, want %v", csr.DNSNames, template.DNSNames)
+		}
+	}
+}
+
 func TestCertificateRequestOverrides(t *testing.T) {
 	sanContents, err := marshalSANs([]string{"foo.example.com"}, nil, nil, nil)
 	if err != nil {
@@ -0,0 +1,55 @@
+// Package sds implements a server of the Secret Discovery Service (SDS) API of
+// Envoy. The server serves a certificate with its private key, and the trust
+// bundle used to validate peers, and pushes them to the connected proxies each
+// time they are updated.
+//
+// The certificate is served with the name CertificateName, and the trust
+// bundle as a validation context with the name ValidationContextName. These
+// are the names that must be used in the SDS configuration of Envoy.
+//
+// The server uses gRPC and the Envoy API, that are only included with the sds
+// build tag. Without it NewServer returns an error.
+package sds
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// CertificateName is the name of the secret with the certificate and the
+	// private key.
+	CertificateName = "default"
+	// ValidationContextName is the name of the secret with the trust bundle.
+	ValidationContextName = "ROOTCA"
+)
+
+// Listen announces on the given SDS address. The address can be a unix socket
+// like 'unix:///tmp/sds.sock' or a TCP address like 'tcp://127.0.0.1:8234', a
+// stale unix socket is removed before listening on it.
+func Listen(addr string) (net.Listener, error) {
+	network, address := "tcp", addr
+	if i := strings.Index(addr, "://"); i >= 0 {
+		network, address = addr[:i], addr[i+3:]
+	}
+	if address == "" {
+		return nil, errors.Errorf("invalid SDS address '%s': address is empty", addr)
+	}
+	switch network {
+	case "unix":
+		if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "error removing %s", address)
+		}
+	case "tcp":
+	default:
+		return nil, errors.Errorf("invalid SDS address '%s': scheme must be unix or tcp", addr)
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listening on %s", addr)
+	}
+	return l, nil
+}
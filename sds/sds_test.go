@@ -0,0 +1,36 @@
+package sds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sds")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	// stale sockets are removed
+	sock := filepath.Join(dir, "sds.sock")
+	assert.FatalError(t, ioutil.WriteFile(sock, nil, 0600))
+	l, err := Listen("unix://" + sock)
+	assert.FatalError(t, err)
+	assert.Equals(t, "unix", l.Addr().Network())
+	l.Close()
+
+	for _, addr := range []string{"tcp://127.0.0.1:0", "127.0.0.1:0"} {
+		l, err := Listen(addr)
+		assert.FatalError(t, err)
+		assert.Equals(t, "tcp", l.Addr().Network())
+		l.Close()
+	}
+
+	for _, addr := range []string{"", "unix://", "http://127.0.0.1:0"} {
+		_, err := Listen(addr)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,260 @@
+// +build sds
+
+package sds
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	secretv3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// secretType is the type URL of the SDS resources.
+const secretType = "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.Secret"
+
+// Server is an SDS server. It implements the SecretDiscoveryService gRPC
+// service, only the state of the world variants are supported.
+type Server struct {
+	secretv3.UnimplementedSecretDiscoveryServiceServer
+	grpc        *grpc.Server
+	bundle      []byte
+	mu          sync.RWMutex
+	version     int
+	nonce       int
+	chain       []byte
+	key         []byte
+	subscribers map[chan struct{}]struct{}
+}
+
+// NewServer returns a new SDS server that will serve the given roots as the
+// trust bundle. The server will not serve any secret until the certificate is
+// set using Update.
+func NewServer(roots []*x509.Certificate) (*Server, error) {
+	if len(roots) == 0 {
+		return nil, errors.New("error creating SDS server: trust bundle is empty")
+	}
+	s := &Server{
+		grpc:        grpc.NewServer(),
+		bundle:      encodeCertificates(roots),
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+	secretv3.RegisterSecretDiscoveryServiceServer(s.grpc, s)
+	return s, nil
+}
+
+// Serve accepts the connections on the given listener. It blocks until the
+// server is stopped.
+func (s *Server) Serve(l net.Listener) error {
+	return s.grpc.Serve(l)
+}
+
+// Stop closes the listeners and the open connections of the server.
+func (s *Server) Stop() {
+	s.grpc.Stop()
+}
+
+// Update sets the certificate chain and private key served, and pushes them
+// to the connected proxies.
+func (s *Server) Update(chain []*x509.Certificate, key crypto.PrivateKey) error {
+	if len(chain) == 0 {
+		return errors.New("error updating SDS server: certificate chain is empty")
+	}
+	block, err := pemutil.Serialize(key)
+	if err != nil {
+		return errors.Wrap(err, "error updating SDS server")
+	}
+
+	s.mu.Lock()
+	s.version++
+	s.chain = encodeCertificates(chain)
+	s.key = pem.EncodeToMemory(block)
+	for ch := range s.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// FetchSecrets implements the SecretDiscoveryService FetchSecrets method.
+func (s *Server) FetchSecrets(ctx context.Context, req *discoveryv3.DiscoveryRequest) (*discoveryv3.DiscoveryResponse, error) {
+	resp, err := s.response(req.ResourceNames)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, status.Error(codes.Unavailable, "certificate is not available")
+	}
+	return resp, nil
+}
+
+// StreamSecrets implements the SecretDiscoveryService StreamSecrets method. A
+// response is sent on the first request, and after each update. Requests
+// acknowledging or rejecting the last response do not trigger a new one.
+func (s *Server) StreamSecrets(stream secretv3.SecretDiscoveryService_StreamSecretsServer) error {
+	ctx := stream.Context()
+	reqs := make(chan *discoveryv3.DiscoveryRequest)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	updates := s.subscribe()
+	defer s.unsubscribe(updates)
+
+	var names []string
+	var nonce string
+	for {
+		select {
+		case req := <-reqs:
+			// Requests for an older response are ignored.
+			if req.ResponseNonce != "" && req.ResponseNonce != nonce {
+				continue
+			}
+			names = req.ResourceNames
+			if req.ErrorDetail != nil || (req.VersionInfo != "" && req.VersionInfo == s.currentVersion()) {
+				continue
+			}
+		case <-updates:
+		case err := <-errc:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+
+		resp, err := s.response(names)
+		if err != nil {
+			return err
+		}
+		if resp == nil {
+			continue
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+		nonce = resp.Nonce
+	}
+}
+
+func (s *Server) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *Server) unsubscribe(ch chan struct{}) {
+	s.mu.Lock()
+	delete(s.subscribers, ch)
+	s.mu.Unlock()
+}
+
+func (s *Server) currentVersion() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return strconv.Itoa(s.version)
+}
+
+// response returns a response with the secrets in names, or all the secrets
+// if names is empty. Unknown names are ignored. It returns nil if the
+// certificate has not been set.
+func (s *Server) response(names []string) (*discoveryv3.DiscoveryResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.version == 0 {
+		return nil, nil
+	}
+	if len(names) == 0 {
+		names = []string{CertificateName, ValidationContextName}
+	}
+
+	var resources []*anypb.Any
+	for _, name := range names {
+		var secret *tlsv3.Secret
+		switch name {
+		case CertificateName:
+			secret = &tlsv3.Secret{
+				Name: name,
+				Type: &tlsv3.Secret_TlsCertificate{
+					TlsCertificate: &tlsv3.TlsCertificate{
+						CertificateChain: inlineBytes(s.chain),
+						PrivateKey:       inlineBytes(s.key),
+					},
+				},
+			}
+		case ValidationContextName:
+			secret = &tlsv3.Secret{
+				Name: name,
+				Type: &tlsv3.Secret_ValidationContext{
+					ValidationContext: &tlsv3.CertificateValidationContext{
+						TrustedCa: inlineBytes(s.bundle),
+					},
+				},
+			}
+		default:
+			continue
+		}
+		res, err := anypb.New(secret)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling secret")
+		}
+		resources = append(resources, res)
+	}
+
+	s.nonce++
+	return &discoveryv3.DiscoveryResponse{
+		VersionInfo: strconv.Itoa(s.version),
+		Resources:   resources,
+		TypeUrl:     secretType,
+		Nonce:       strconv.Itoa(s.nonce),
+	}, nil
+}
+
+func inlineBytes(b []byte) *corev3.DataSource {
+	return &corev3.DataSource{
+		Specifier: &corev3.DataSource_InlineBytes{InlineBytes: b},
+	}
+}
+
+func encodeCertificates(certs []*x509.Certificate) []byte {
+	var b []byte
+	for _, crt := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+	return b
+}
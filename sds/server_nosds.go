@@ -0,0 +1,33 @@
+// +build !sds
+
+package sds
+
+import (
+	"crypto"
+	"crypto/x509"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// Server is an SDS server. The gRPC server is only included with the sds
+// build tag.
+type Server struct{}
+
+// NewServer returns an error, step was compiled without the sds build tag.
+func NewServer(roots []*x509.Certificate) (*Server, error) {
+	return nil, errors.New("the SDS server is not supported: step was compiled without the sds build tag")
+}
+
+// Serve returns an error, step was compiled without the sds build tag.
+func (s *Server) Serve(l net.Listener) error {
+	return errors.New("the SDS server is not supported: step was compiled without the sds build tag")
+}
+
+// Stop does nothing.
+func (s *Server) Stop() {}
+
+// Update returns an error, step was compiled without the sds build tag.
+func (s *Server) Update(chain []*x509.Certificate, key crypto.PrivateKey) error {
+	return errors.New("the SDS server is not supported: step was compiled without the sds build tag")
+}
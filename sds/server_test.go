@@ -0,0 +1,155 @@
+// +build sds
+
+package sds
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	secretv3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/smallstep/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func mustCertificate(t *testing.T, cn string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt, key
+}
+
+func startServer(t *testing.T) (*Server, secretv3.SecretDiscoveryServiceClient, func()) {
+	root, _ := mustCertificate(t, "Root CA")
+	srv, err := NewServer([]*x509.Certificate{root})
+	assert.FatalError(t, err)
+	l, err := Listen("tcp://127.0.0.1:0")
+	assert.FatalError(t, err)
+	go srv.Serve(l)
+
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.FatalError(t, err)
+	return srv, secretv3.NewSecretDiscoveryServiceClient(conn), func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+func secrets(t *testing.T, resp *discoveryv3.DiscoveryResponse) map[string]*tlsv3.Secret {
+	assert.Equals(t, secretType, resp.TypeUrl)
+	m := make(map[string]*tlsv3.Secret)
+	for _, res := range resp.Resources {
+		secret := new(tlsv3.Secret)
+		assert.FatalError(t, res.UnmarshalTo(secret))
+		m[secret.Name] = secret
+	}
+	return m
+}
+
+
+func TestNewServer(t *testing.T) {
+	_, err := NewServer(nil)
+	assert.Error(t, err)
+}
+
+func TestServer_Update(t *testing.T) {
+	root, _ := mustCertificate(t, "Root CA")
+	srv, err := NewServer([]*x509.Certificate{root})
+	assert.FatalError(t, err)
+	crt, key := mustCertificate(t, "leaf")
+	assert.Error(t, srv.Update(nil, key))
+	assert.Error(t, srv.Update([]*x509.Certificate{crt}, "not a key"))
+	assert.FatalError(t, srv.Update([]*x509.Certificate{crt}, key))
+	assert.Equals(t, "1", srv.currentVersion())
+}
+
+func TestServer_FetchSecrets(t *testing.T) {
+	srv, client, stop := startServer(t)
+	defer stop()
+	ctx := context.Background()
+
+	_, err := client.FetchSecrets(ctx, &discoveryv3.DiscoveryRequest{})
+	assert.Equals(t, codes.Unavailable, status.Code(err))
+
+	crt, key := mustCertificate(t, "leaf")
+	assert.FatalError(t, srv.Update([]*x509.Certificate{crt}, key))
+
+	tests := map[string]struct {
+		names []string
+		want  []string
+	}{
+		"all":          {nil, []string{CertificateName, ValidationContextName}},
+		"certificate":  {[]string{CertificateName}, []string{CertificateName}},
+		"trust bundle": {[]string{ValidationContextName}, []string{ValidationContextName}},
+		"unknown":      {[]string{"foo"}, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := client.FetchSecrets(ctx, &discoveryv3.DiscoveryRequest{ResourceNames: tc.names})
+			assert.FatalError(t, err)
+			assert.Equals(t, "1", resp.VersionInfo)
+			m := secrets(t, resp)
+			assert.Equals(t, len(tc.want), len(m))
+			for _, name := range tc.want {
+				assert.NotNil(t, m[name])
+			}
+		})
+	}
+}
+
+func TestServer_StreamSecrets(t *testing.T) {
+	srv, client, stop := startServer(t)
+	defer stop()
+
+	crt, key := mustCertificate(t, "leaf")
+	assert.FatalError(t, srv.Update([]*x509.Certificate{crt}, key))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := client.StreamSecrets(ctx)
+	assert.FatalError(t, err)
+
+	assert.FatalError(t, stream.Send(&discoveryv3.DiscoveryRequest{
+		ResourceNames: []string{CertificateName},
+	}))
+	resp, err := stream.Recv()
+	assert.FatalError(t, err)
+	assert.Equals(t, "1", resp.VersionInfo)
+	m := secrets(t, resp)
+	assert.Equals(t, 1, len(m))
+	assert.NotNil(t, m[CertificateName].GetTlsCertificate())
+
+	// the acknowledgement does not trigger a response, the update does
+	assert.FatalError(t, stream.Send(&discoveryv3.DiscoveryRequest{
+		VersionInfo:   resp.VersionInfo,
+		ResourceNames: []string{CertificateName},
+		ResponseNonce: resp.Nonce,
+	}))
+	crt, key = mustCertificate(t, "renewed")
+	assert.FatalError(t, srv.Update([]*x509.Certificate{crt}, key))
+	resp, err = stream.Recv()
+	assert.FatalError(t, err)
+	assert.Equals(t, "2", resp.VersionInfo)
+	m = secrets(t, resp)
+	assert.Equals(t, encodeCertificates([]*x509.Certificate{crt}), m[CertificateName].GetTlsCertificate().GetCertificateChain().GetInlineBytes())
+}
@@ -2,12 +2,16 @@ package token
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"encoding/base64"
+	"encoding/json"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/crypto/keys"
 	"github.com/smallstep/cli/jose"
+	"golang.org/x/crypto/ed25519"
 )
 
 const (
@@ -23,8 +27,26 @@ const (
 	DefaultValidity = 5 * time.Minute
 	// MaxValidityDelay allowable delay between Now and beginning of token validity period.
 	MaxValidityDelay = 30 * time.Minute
+	// MaxSkew maximum clock skew that can be set with SetSkew.
+	MaxSkew = 30 * time.Minute
 )
 
+// skew is the duration subtracted from the current time in the default 'nbf'
+// and 'iat' claims.
+var skew time.Duration
+
+// SetSkew sets the duration subtracted from the current time in the default
+// 'nbf' (NotBefore) and 'iat' (IssuedAt) claims, so the tokens are accepted by
+// a server with a clock behind the local one. A zero duration disables it.
+func SetSkew(d time.Duration) {
+	skew = d
+}
+
+// Skew returns the duration set with SetSkew.
+func Skew() time.Duration {
+	return skew
+}
+
 // RootSHAClaim is the property name for a JWT claim that stores the SHA256 of a root certificate.
 const RootSHAClaim = "sha"
 
@@ -66,6 +88,18 @@ func (c *Claims) Sign(alg jose.SignatureAlgorithm, key interface{}) (string, err
 		return "", err
 	}
 
+	// Force aud to be a string
+	if len(c.Audience) == 1 {
+		c.Set("aud", c.Audience[0])
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+	case crypto.Signer:
+		// Keys in a KMS cannot be used by the jose signer
+		return c.signWithSigner(alg, kid, k)
+	}
+
 	so := new(jose.SignerOptions)
 	so.WithType("JWT")
 	so.WithHeader("kid", kid)
@@ -83,11 +117,6 @@ func (c *Claims) Sign(alg jose.SignatureAlgorithm, key interface{}) (string, err
 		return "", errors.Wrapf(err, "error creating JWT signer")
 	}
 
-	// Force aud to be a string
-	if len(c.Audience) == 1 {
-		c.Set("aud", c.Audience[0])
-	}
-
 	raw, err := jose.Signed(signer).Claims(c.Claims).Claims(c.ExtraClaims).CompactSerialize()
 	if err != nil {
 		return "", errors.Wrapf(err, "error serializing JWT")
@@ -95,6 +124,37 @@ func (c *Claims) Sign(alg jose.SignatureAlgorithm, key interface{}) (string, err
 	return raw, nil
 }
 
+// signWithSigner creates a JWT with the claims and signs it with the given
+// crypto.Signer.
+func (c *Claims) signWithSigner(alg jose.SignatureAlgorithm, kid string, signer crypto.Signer) (string, error) {
+	header := map[string]interface{}{
+		"typ": "JWT",
+		"kid": kid,
+	}
+	// Used to override the kid too
+	for k, v := range c.ExtraHeaders {
+		header[k] = v
+	}
+
+	b, err := json.Marshal(c.Claims)
+	if err != nil {
+		return "", errors.Wrap(err, "error serializing JWT")
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return "", errors.Wrap(err, "error serializing JWT")
+	}
+	for k, v := range c.ExtraClaims {
+		claims[k] = v
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "error serializing JWT")
+	}
+
+	return jose.SignCompact(alg, signer, header, payload)
+}
+
 // NewClaims returns the default claims with the given options added.
 func NewClaims(opts ...Options) (*Claims, error) {
 	c := DefaultClaims()
@@ -106,7 +166,8 @@ func NewClaims(opts ...Options) (*Claims, error) {
 	return c, nil
 }
 
-// DefaultClaims returns the default claims of any token.
+// DefaultClaims returns the default claims of any token. The 'nbf' and 'iat'
+// claims are set to the current time minus the skew set with SetSkew.
 func DefaultClaims() *Claims {
 	now := time.Now()
 	return &Claims{
@@ -114,8 +175,8 @@ func DefaultClaims() *Claims {
 			Issuer:    DefaultIssuer,
 			Audience:  jose.Audience{DefaultAudience},
 			Expiry:    jose.NewNumericDate(now.Add(DefaultValidity)),
-			NotBefore: jose.NewNumericDate(now),
-			IssuedAt:  jose.NewNumericDate(now),
+			NotBefore: jose.NewNumericDate(now.Add(-skew)),
+			IssuedAt:  jose.NewNumericDate(now.Add(-skew)),
 		},
 		ExtraClaims: make(map[string]interface{}),
 	}
@@ -13,6 +13,14 @@ type options struct {
 	promptTemplates *promptui.PromptTemplates
 	selectTemplates *promptui.SelectTemplates
 	validateFunc    promptui.ValidateFunc
+	flag            string
+	summary         []summaryItem
+}
+
+// summaryItem is a name and value printed before a confirmation prompt.
+type summaryItem struct {
+	Name  string
+	Value string
 }
 
 // apply applies the given options.
@@ -105,6 +113,22 @@ func WithValidateFunc(fn func(string) error) Option {
 	}
 }
 
+// WithFlag sets the name of the flag that can be used instead of the prompt.
+// It's used in the error returned if prompts are not allowed.
+func WithFlag(name string) Option {
+	return func(o *options) {
+		o.flag = name
+	}
+}
+
+// WithSummary adds a name and value to the summary printed by Confirm before
+// the prompt, e.g. the subject or the serial number of a certificate.
+func WithSummary(name, value string) Option {
+	return func(o *options) {
+		o.summary = append(o.summary, summaryItem{Name: name, Value: value})
+	}
+}
+
 // WithValidateNotEmpty adds a custom validation function to a prompt that
 // checks that the propted string is not empty.
 func WithValidateNotEmpty() Option {
@@ -117,6 +141,15 @@ func WithValidateYesNo() Option {
 	return WithValidateFunc(YesNo())
 }
 
+// WithValidateEntropy adds a custom validation function to a password prompt
+// that checks that the new password has the minimum entropy set with
+// SetMinPasswordEntropy.
+func WithValidateEntropy() Option {
+	return WithValidateFunc(func(s string) error {
+		return MinEntropy(minPasswordEntropy)(s)
+	})
+}
+
 // WithRichPrompt add the template option with rich templates.
 func WithRichPrompt() Option {
 	return WithPromptTemplates(PromptTemplates())
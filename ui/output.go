@@ -0,0 +1,181 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Output formats supported by SetFormat.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// output collects the values printed with PrintSelected when a structured
+// format is used.
+var output = &outputFields{format: FormatText}
+
+type outputField struct {
+	name   string
+	values []interface{}
+}
+
+type outputFields struct {
+	sync.Mutex
+	format string
+	fields []*outputField
+}
+
+// SetFormat sets the format used to render the output of the commands. With
+// the text format, the default, the output is printed for humans in the
+// standard error. With the json and yaml formats the values printed with
+// PrintSelected are collected, and written as a single document to the
+// standard output by Flush.
+func SetFormat(format string) error {
+	switch format {
+	case "":
+		format = FormatText
+	case FormatText, FormatJSON, FormatYAML:
+	default:
+		return errors.Errorf("unsupported output format '%s'; options are text, json or yaml", format)
+	}
+	output.Lock()
+	output.format = format
+	output.fields = nil
+	output.Unlock()
+	return nil
+}
+
+// Format returns the format set with SetFormat.
+func Format() string {
+	output.Lock()
+	defer output.Unlock()
+	return output.format
+}
+
+// IsStructured returns true if the output is rendered as a JSON or YAML
+// document.
+func IsStructured() bool {
+	output.Lock()
+	defer output.Unlock()
+	return output.format != FormatText
+}
+
+// Flush writes the collected values to the standard output using the format
+// set with SetFormat. Nothing is written with the text format, or if there
+// are no values.
+func Flush() error {
+	return flush(os.Stdout)
+}
+
+func flush(w io.Writer) error {
+	output.Lock()
+	defer output.Unlock()
+	if output.format == FormatText || len(output.fields) == 0 {
+		return nil
+	}
+
+	var b []byte
+	var err error
+	switch output.format {
+	case FormatJSON:
+		b, err = output.marshalJSON()
+	case FormatYAML:
+		b, err = output.marshalYAML()
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling %s output", output.format)
+	}
+	output.fields = nil
+	_, err = w.Write(b)
+	return err
+}
+
+// add adds the value with the given name. Values with the same name are
+// rendered as a list.
+func (o *outputFields) add(name string, value interface{}) {
+	o.Lock()
+	defer o.Unlock()
+	key := FieldName(name)
+	for _, f := range o.fields {
+		if f.name == key {
+			f.values = append(f.values, value)
+			return
+		}
+	}
+	o.fields = append(o.fields, &outputField{
+		name:   key,
+		values: []interface{}{value},
+	})
+}
+
+func (f *outputField) value() interface{} {
+	if len(f.values) == 1 {
+		return f.values[0]
+	}
+	return f.values
+}
+
+// marshalJSON marshals the fields as a JSON object, keeping the order in which
+// they were added.
+func (o *outputFields) marshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for i, f := range o.fields {
+		k, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.MarshalIndent(f.value(), "  ", "  ")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "  %s: %s", k, v)
+		if i < len(o.fields)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// marshalYAML marshals the fields as a YAML mapping, keeping the order in
+// which they were added.
+func (o *outputFields) marshalYAML() ([]byte, error) {
+	m := make(yaml.MapSlice, len(o.fields))
+	for i, f := range o.fields {
+		m[i] = yaml.MapItem{Key: f.name, Value: f.value()}
+	}
+	return yaml.Marshal(m)
+}
+
+// FieldName returns the name used in the structured output for a value
+// printed with the given name, e.g. 'Private Key' is rendered as
+// 'private_key'.
+func FieldName(name string) string {
+	var sb strings.Builder
+	sep := false
+	for _, r := range strings.TrimSpace(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if sep && sb.Len() > 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+			sep = false
+		} else {
+			sep = true
+		}
+	}
+	return sb.String()
+}
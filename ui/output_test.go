@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestFieldName(t *testing.T) {
+	tests := map[string]string{
+		"Certificate":      "certificate",
+		"Private Key":      "private_key",
+		"CA":               "ca",
+		"Root Certificate": "root_certificate",
+		" Trust  Bundle ":  "trust_bundle",
+		"SSH-Key (public)": "ssh_key_public",
+		"":                 "",
+	}
+	for name, want := range tests {
+		assert.Equals(t, want, FieldName(name))
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	defer SetFormat(FormatText)
+	for _, f := range []string{"", FormatText, FormatJSON, FormatYAML} {
+		assert.NoError(t, SetFormat(f))
+	}
+	assert.Error(t, SetFormat("xml"))
+}
+
+func TestFlush(t *testing.T) {
+	defer SetFormat(FormatText)
+	tests := map[string]string{
+		FormatText: "",
+		FormatJSON: `{
+  "ca": "https://ca.example.com",
+  "certificate": [
+    "internal.crt",
+    "vault:secret/step"
+  ],
+  "private_key": "internal.key",
+  "valid": true
+}
+`,
+		FormatYAML: `ca: https://ca.example.com
+certificate:
+- internal.crt
+- vault:secret/step
+private_key: internal.key
+valid: true
+`,
+	}
+	for format, want := range tests {
+		t.Run(format, func(t *testing.T) {
+			assert.FatalError(t, SetFormat(format))
+			assert.Equals(t, format != FormatText, IsStructured())
+			output.add("CA", "https://ca.example.com")
+			output.add("Certificate", "internal.crt")
+			output.add("Private Key", "internal.key")
+			output.add("Certificate", "vault:secret/step")
+			output.add("Valid", true)
+
+			var buf bytes.Buffer
+			assert.FatalError(t, flush(&buf))
+			assert.Equals(t, want, buf.String())
+
+			// fields are written once
+			buf.Reset()
+			assert.FatalError(t, flush(&buf))
+			assert.Equals(t, "", buf.String())
+		})
+	}
+}
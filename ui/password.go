@@ -0,0 +1,64 @@
+package ui
+
+import (
+	"math"
+	"unicode"
+)
+
+// minPasswordEntropy is the minimum entropy in bits of the new passwords.
+var minPasswordEntropy int
+
+// SetMinPasswordEntropy sets the minimum entropy in bits of the new passwords
+// validated with WithValidateEntropy. A value of 0 disables the validation.
+func SetMinPasswordEntropy(bits int) {
+	minPasswordEntropy = bits
+}
+
+// MinPasswordEntropy returns the minimum entropy in bits of the new passwords.
+func MinPasswordEntropy() int {
+	return minPasswordEntropy
+}
+
+// PasswordEntropy returns an estimation of the entropy in bits of the given
+// password. Each character adds the bits of the character classes used in the
+// password: lower case and upper case letters, digits, ASCII symbols and other
+// characters. Characters equal to the previous one do not add entropy. The
+// estimation is an upper bound, passwords with common words or patterns have
+// less entropy.
+func PasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	var length int
+	var prev rune
+	for i, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+		if i == 0 || r != prev {
+			length++
+		}
+		prev = r
+	}
+
+	var size int
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			size += class.size
+		}
+	}
+	if size == 0 {
+		return 0
+	}
+	return float64(length) * math.Log2(float64(size))
+}
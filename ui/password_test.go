@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"math"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestPasswordEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"a", math.Log2(26)},
+		{"aaaaaaaa", math.Log2(26)},
+		{"password", 7 * math.Log2(26)},
+		{"Password1", 8 * math.Log2(62)},
+		{"Pass word1!", 10 * math.Log2(95)},
+		{"contraseña", 10 * math.Log2(126)},
+	}
+	for _, tt := range tests {
+		assert.Equals(t, tt.want, PasswordEntropy(tt.password), tt.password)
+	}
+}
+
+func TestMinEntropy(t *testing.T) {
+	assert.NoError(t, MinEntropy(0)(""))
+	assert.NoError(t, MinEntropy(0)("password"))
+	assert.NoError(t, MinEntropy(64)("correct-horse-battery-staple"))
+	if err := MinEntropy(64)("password"); assert.Error(t, err) {
+		assert.Equals(t, "password is too weak: it must have at least 64 bits of entropy", err.Error())
+	}
+}
+
+func TestWithValidateEntropy(t *testing.T) {
+	SetMinPasswordEntropy(64)
+	defer SetMinPasswordEntropy(0)
+	assert.Equals(t, 64, MinPasswordEntropy())
+
+	_, err := PromptPassword("Please enter the password", WithValue("password"), WithValidateEntropy())
+	assert.Error(t, err)
+	_, err = PromptPasswordGenerate("Please enter the password", WithValue("password"), WithValidateEntropy())
+	assert.Error(t, err)
+
+	b, err := PromptPassword("Please enter the password", WithValue("correct-horse-battery-staple"), WithValidateEntropy())
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("correct-horse-battery-staple"), b)
+
+	// Existing passwords are not validated.
+	b, err = PromptPassword("Please enter the password", WithValue("password"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("password"), b)
+}
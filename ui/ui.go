@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
 	"text/template"
 
@@ -35,6 +36,49 @@ func init() {
 	readline.Stdout = &stderr{}
 }
 
+// noPrompt disables the prompts if true.
+var noPrompt bool
+
+// SetNoPrompt enables or disables the prompts. With the prompts disabled,
+// Prompt, PromptPassword, PromptPasswordGenerate and Select return an error
+// instead of waiting for the input of the user.
+func SetNoPrompt(b bool) {
+	noPrompt = b
+}
+
+// canPrompt returns an error if the prompts are disabled or there is no
+// terminal to read the input from. The error contains the flag set with
+// WithFlag, if any.
+func canPrompt(label string, o *options) error {
+	var reason string
+	switch {
+	case noPrompt:
+		reason = "prompts are disabled"
+	case !hasTerminal():
+		reason = "there is no terminal available"
+	default:
+		return nil
+	}
+	if o.flag != "" {
+		return errors.Errorf("cannot prompt '%s': %s; use the '--%s' flag", label, reason, o.flag)
+	}
+	return errors.Errorf("cannot prompt '%s': %s", label, reason)
+}
+
+// hasTerminal returns true if the standard input is a terminal or if the
+// controlling terminal of the process can be opened.
+func hasTerminal() bool {
+	if readline.IsTerminal(syscall.Stdin) {
+		return true
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	tty.Close()
+	return true
+}
+
 // Printf uses templates to print the string formated to os.Stderr.
 func Printf(format string, args ...interface{}) error {
 	text := fmt.Sprintf(format, args...)
@@ -62,8 +106,14 @@ func Println(args ...interface{}) error {
 }
 
 // PrintSelected prints the given name and value as if they were selected from a
-// promptui.Select.
+// promptui.Select. With a structured output format the value is collected and
+// written by Flush instead.
 func PrintSelected(name, value string, opts ...Option) error {
+	if IsStructured() {
+		output.add(name, value)
+		return nil
+	}
+
 	o := &options{
 		printTemplate: PrintSelectedTemplate(),
 	}
@@ -85,6 +135,16 @@ func PrintSelected(name, value string, opts ...Option) error {
 	return nil
 }
 
+// PrintSelectedValue is like PrintSelected, but with the structured formats
+// the value keeps its type, e.g. a bool is rendered as true instead of "true".
+func PrintSelectedValue(name string, value interface{}, opts ...Option) error {
+	if IsStructured() {
+		output.add(name, value)
+		return nil
+	}
+	return PrintSelected(name, fmt.Sprint(value), opts...)
+}
+
 // Prompt creates a runs a promptui.Prompt with the given label.
 func Prompt(label string, opts ...Option) (string, error) {
 	o := &options{
@@ -98,6 +158,9 @@ func Prompt(label string, opts ...Option) (string, error) {
 	}
 
 	// Prompt using the terminal
+	if err := canPrompt(label, o); err != nil {
+		return "", err
+	}
 	clean, err := preparePromptTerminal()
 	if err != nil {
 		return "", err
@@ -118,6 +181,42 @@ func Prompt(label string, opts ...Option) (string, error) {
 	return value, nil
 }
 
+// Confirm prints the summary added with WithSummary and runs a yes or no
+// promptui.Prompt with the given label. It returns true if the answer is yes.
+func Confirm(label string, opts ...Option) (bool, error) {
+	label += " [y/n]"
+	o := &options{
+		printTemplate: PrintSelectedTemplate(),
+	}
+	o.apply(opts)
+
+	if o.value == "" {
+		if err := canPrompt(label, o); err != nil {
+			return false, err
+		}
+		t, err := template.New(label).Funcs(promptui.FuncMap).Parse(o.printTemplate)
+		if err != nil {
+			return false, errors.Wrap(err, "error parsing template")
+		}
+		for _, item := range o.summary {
+			if err := t.Execute(os.Stderr, item); err != nil {
+				return false, errors.Wrap(err, "error executing template")
+			}
+		}
+	}
+
+	str, err := Prompt(label, append(opts, WithValidateYesNo())...)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
 // PromptPassword creates a runs a promptui.Prompt with the given label. This
 // prompt will mask the key entries with \r.
 func PromptPassword(label string, opts ...Option) ([]byte, error) {
@@ -134,6 +233,9 @@ func PromptPassword(label string, opts ...Option) ([]byte, error) {
 	}
 
 	// Prompt using the terminal
+	if err := canPrompt(label, o); err != nil {
+		return nil, err
+	}
 	clean, err := preparePromptTerminal()
 	if err != nil {
 		return nil, err
@@ -158,9 +260,16 @@ func PromptPassword(label string, opts ...Option) ([]byte, error) {
 // PromptPasswordGenerate creaes a runs a promptui.Prompt with the given label.
 // This prompt will mask the key entries with \r. If the result password length
 // is 0, it will generate a new prompt with a generated password that can be
-// edited.
+// edited. The validation function in the options is not used with the empty
+// password.
 func PromptPasswordGenerate(label string, opts ...Option) ([]byte, error) {
-	pass, err := PromptPassword(label, opts...)
+	validate := (&options{}).apply(opts).validateFunc
+	pass, err := PromptPassword(label, append(opts, WithValidateFunc(func(s string) error {
+		if s == "" || validate == nil {
+			return nil
+		}
+		return validate(s)
+	}))...)
 	if err != nil || len(pass) > 0 {
 		return pass, err
 	}
@@ -168,7 +277,12 @@ func PromptPasswordGenerate(label string, opts ...Option) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	passString, err = Prompt("Password", WithDefaultValue(passString), WithAllowEdit(true), WithValidateNotEmpty())
+	passString, err = Prompt("Password", WithDefaultValue(passString), WithAllowEdit(true), WithValidateFunc(func(s string) error {
+		if err := NotEmpty()(s); err != nil || validate == nil {
+			return err
+		}
+		return validate(s)
+	}))
 	if err != nil {
 		return nil, err
 	}
@@ -182,6 +296,9 @@ func Select(label string, items interface{}, opts ...Option) (int, string, error
 	}
 	o.apply(opts)
 
+	if err := canPrompt(label, o); err != nil {
+		return 0, "", err
+	}
 	clean, err := prepareSelectTerminal()
 	if err != nil {
 		return 0, "", err
@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestNoPrompt(t *testing.T) {
+	SetNoPrompt(true)
+	defer SetNoPrompt(false)
+
+	_, err := Prompt("What is your name?", WithFlag("name"))
+	if assert.Error(t, err) {
+		assert.Equals(t, "cannot prompt 'What is your name?': prompts are disabled; use the '--name' flag", err.Error())
+	}
+
+	_, err = PromptPassword("Please enter the password")
+	if assert.Error(t, err) {
+		assert.Equals(t, "cannot prompt 'Please enter the password': prompts are disabled", err.Error())
+	}
+
+	_, err = PromptPasswordGenerate("Please enter the password", WithFlag("password-file"))
+	if assert.Error(t, err) {
+		assert.Equals(t, "cannot prompt 'Please enter the password': prompts are disabled; use the '--password-file' flag", err.Error())
+	}
+
+	_, err = Confirm("Would you like to revoke this certificate", WithFlag("force"), WithSummary("Serial Number", "1234"))
+	if assert.Error(t, err) {
+		assert.Equals(t, "cannot prompt 'Would you like to revoke this certificate [y/n]': prompts are disabled; use the '--force' flag", err.Error())
+	}
+
+	_, _, err = Select("What provisioner key do you want to use?", []string{"foo", "bar"}, WithFlag("kid"))
+	if assert.Error(t, err) {
+		assert.Equals(t, "cannot prompt 'What provisioner key do you want to use?': prompts are disabled; use the '--kid' flag", err.Error())
+	}
+
+	// Values given do not prompt
+	s, err := Prompt("What is your name?", WithValue("Smallstep"), WithFlag("name"))
+	assert.FatalError(t, err)
+	assert.Equals(t, "Smallstep", s)
+
+	b, err := PromptPasswordGenerate("Please enter the password", WithValue("password"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("password"), b)
+}
+
+func TestConfirm(t *testing.T) {
+	for _, answer := range []string{"y", "Yes", " YES "} {
+		ok, err := Confirm("Would you like to continue", WithValue(answer))
+		assert.FatalError(t, err)
+		assert.True(t, ok, answer)
+	}
+	for _, answer := range []string{"n", "No"} {
+		ok, err := Confirm("Would you like to continue", WithValue(answer))
+		assert.FatalError(t, err)
+		assert.False(t, ok, answer)
+	}
+	_, err := Confirm("Would you like to continue", WithValue("maybe"))
+	assert.Error(t, err)
+}
@@ -67,3 +67,15 @@ func YesNo() promptui.ValidateFunc {
 		}
 	}
 }
+
+// MinEntropy is a validation function that checks that the estimated entropy
+// of the prompted password is at least the given number of bits. See
+// PasswordEntropy.
+func MinEntropy(bits int) promptui.ValidateFunc {
+	return func(s string) error {
+		if bits > 0 && PasswordEntropy(s) < float64(bits) {
+			return fmt.Errorf("password is too weak: it must have at least %d bits of entropy", bits)
+		}
+		return nil
+	}
+}
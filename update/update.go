@@ -0,0 +1,344 @@
+// Package update implements the installation of the latest release of step
+// published on GitHub.
+//
+// Each release contains a bundle for every platform, named like
+// step_0.13.3_linux_amd64.tar.gz, a file with the SHA256 checksums of all the
+// bundles, named like step_0.13.3_checksums.txt, and the signature of the
+// checksums file with the release signing key, named like
+// step_0.13.3_checksums.txt.sig. A bundle is only installed if the signature
+// of the checksums is valid and its checksum matches.
+//
+// The public key of the release signing key is embedded in the binary at
+// build time, see the RELEASE_PUBLIC_KEY variable in the Makefile. Binaries
+// built without it cannot be updated.
+package update
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultURL is the GitHub API endpoint that returns the latest release.
+const DefaultURL = "https://api.github.com/repos/smallstep/cli/releases/latest"
+
+// maxBinarySize is the maximum size of the binary in a bundle.
+const maxBinarySize = 256 << 20
+
+// releasePublicKey is the base64 encoding of the public key, in DER format,
+// used to verify the signature of the checksums of a release. It's set at
+// build time with the -X flag of -ldflags, see make/common.mk.
+var releasePublicKey string
+
+// Asset is a file published in a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Release is a release published on GitHub.
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// Version returns the version of the release without the 'v' prefix, e.g.
+// 0.13.3.
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.Tag, "v")
+}
+
+// IsNewer returns true if the release is newer than the given version. A
+// version that cannot be parsed, like the ones of development builds, is
+// always older.
+func (r *Release) IsNewer(version string) bool {
+	latest, err := parseVersion(r.Tag)
+	if err != nil {
+		return false
+	}
+	current, err := parseVersion(version)
+	if err != nil {
+		return true
+	}
+	for i := range latest {
+		if latest[i] != current[i] {
+			return latest[i] > current[i]
+		}
+	}
+	return false
+}
+
+// BundleName returns the name of the bundle for the given platform.
+func (r *Release) BundleName(goos, goarch string) string {
+	return fmt.Sprintf("step_%s_%s_%s.tar.gz", r.Version(), goos, goarch)
+}
+
+// ChecksumsName returns the name of the file with the checksums of the
+// bundles.
+func (r *Release) ChecksumsName() string {
+	return fmt.Sprintf("step_%s_checksums.txt", r.Version())
+}
+
+// SignatureName returns the name of the file with the signature of the
+// checksums file.
+func (r *Release) SignatureName() string {
+	return r.ChecksumsName() + ".sig"
+}
+
+// asset returns the asset with the given name.
+func (r *Release) asset(name string) (*Asset, error) {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i], nil
+		}
+	}
+	return nil, errors.Errorf("release %s does not contain %s", r.Tag, name)
+}
+
+// Latest returns the latest release using the given GitHub API endpoint.
+func Latest(client *http.Client, url string) (*Release, error) {
+	b, err := get(client, url)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the latest release")
+	}
+	var r Release
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, errors.Wrap(err, "error parsing the latest release")
+	}
+	if _, err := parseVersion(r.Tag); err != nil {
+		return nil, errors.Wrap(err, "error parsing the latest release")
+	}
+	return &r, nil
+}
+
+// Download downloads the bundle of the release for the given platform, checks
+// the signature of the checksums and the checksum of the bundle, and returns
+// the step binary in it.
+func Download(client *http.Client, r *Release, goos, goarch string) ([]byte, error) {
+	pub, err := parsePublicKey(releasePublicKey)
+	if err != nil {
+		return nil, err
+	}
+	name := r.BundleName(goos, goarch)
+	bundle, err := r.asset(name)
+	if err != nil {
+		return nil, errors.Errorf("release %s is not available for %s/%s", r.Tag, goos, goarch)
+	}
+	checksums, err := r.asset(r.ChecksumsName())
+	if err != nil {
+		return nil, err
+	}
+	signature, err := r.asset(r.SignatureName())
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := get(client, checksums.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", checksums.Name)
+	}
+	sig, err := get(client, signature.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", signature.Name)
+	}
+	if err := verifySignature(pub, b, sig); err != nil {
+		return nil, errors.Wrapf(err, "error verifying %s", checksums.Name)
+	}
+	sum, err := findChecksum(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err = get(client, bundle.URL); err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", bundle.Name)
+	}
+	h := sha256.Sum256(b)
+	if subtle.ConstantTimeCompare(h[:], sum) != 1 {
+		return nil, errors.Errorf("error verifying %s: checksum does not match", name)
+	}
+
+	return extractBinary(b, name)
+}
+
+// Install replaces the binary in the given path with the given one, keeping
+// the mode of the original file. The new binary is written first in the same
+// directory so the replacement is atomic.
+func Install(filename string, binary []byte) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", filename)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return errors.Wrapf(err, "error installing %s", filename)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	_, err = f.Write(binary)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Chmod(tmp, fi.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	return errors.Wrapf(err, "error installing %s", filename)
+}
+
+// get returns the body of the given URL.
+func get(client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json, application/octet-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// parsePublicKey parses the base64 encoding of a public key in DER format.
+func parsePublicKey(s string) (crypto.PublicKey, error) {
+	if s == "" {
+		return nil, errors.New("step was built without the release signing key: download and install the new release manually")
+	}
+	der, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding the release signing key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing the release signing key")
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, errors.Errorf("unsupported release signing key type %T", pub)
+	}
+}
+
+// verifySignature verifies the SHA256 signature of the given data, like the
+// ones created with 'openssl dgst -sha256 -sign'. ECDSA signatures are ASN.1
+// encoded, and RSA signatures use PKCS #1 v1.5.
+func verifySignature(pub crypto.PublicKey, data, sig []byte) error {
+	h := sha256.Sum256(data)
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		var es struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(sig, &es); err != nil || len(rest) != 0 {
+			return errors.New("signature is not valid")
+		}
+		if !ecdsa.Verify(pub, h[:], es.R, es.S) {
+			return errors.New("signature is not valid")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, h[:], sig); err != nil {
+			return errors.New("signature is not valid")
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported release signing key type %T", pub)
+	}
+}
+
+// findChecksum returns the SHA256 checksum of the given file in a checksums
+// file with the format used by sha256sum.
+func findChecksum(checksums []byte, name string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, errors.Errorf("error parsing checksum of %s", name)
+		}
+		return sum, nil
+	}
+	return nil, errors.Errorf("checksum of %s not found", name)
+}
+
+// extractBinary returns the content of bin/step in the given bundle.
+func extractBinary(bundle []byte, name string) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(bundle))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", name)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.Errorf("error reading %s: step binary not found", name)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", name)
+		}
+		if hdr.Typeflag != tar.TypeReg || path.Base(hdr.Name) != "step" || path.Base(path.Dir(hdr.Name)) != "bin" {
+			continue
+		}
+		if hdr.Size > maxBinarySize {
+			return nil, errors.Errorf("error reading %s: step binary is too large", name)
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(tr, maxBinarySize))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", name)
+		}
+		return b, nil
+	}
+}
+
+// parseVersion parses a version like v0.13.3 or 0.13.3. Pre-releases and
+// development builds are not valid versions.
+func parseVersion(s string) ([3]int, error) {
+	var v [3]int
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(parts) != 3 {
+		return v, errors.Errorf("invalid version '%s'", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, errors.Errorf("invalid version '%s'", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
@@ -0,0 +1,266 @@
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func newBundle(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		assert.FatalError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0755,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(content))
+		assert.FatalError(t, err)
+	}
+	assert.FatalError(t, tw.Close())
+	assert.FatalError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// setReleaseKey sets the release public key of the given signer, and returns
+// a function that restores the previous one.
+func setReleaseKey(t *testing.T, signer crypto.Signer) func() {
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	assert.FatalError(t, err)
+	old := releasePublicKey
+	releasePublicKey = base64.StdEncoding.EncodeToString(der)
+	return func() {
+		releasePublicKey = old
+	}
+}
+
+func mustSign(t *testing.T, signer crypto.Signer, data []byte) []byte {
+	h := sha256.Sum256(data)
+	sig, err := signer.Sign(rand.Reader, h[:], crypto.SHA256)
+	assert.FatalError(t, err)
+	return sig
+}
+
+// newServer returns a server with a release v0.14.0 for linux/amd64, with the
+// checksums signed by the given signer. The files map overwrites the content
+// of the assets, a nil value removes it.
+func newServer(t *testing.T, signer crypto.Signer, files map[string][]byte) *httptest.Server {
+	bundle := newBundle(t, map[string]string{
+		"step_0.14.0/README.md": "readme",
+		"step_0.14.0/bin/step":  "new binary",
+	})
+	sum := sha256.Sum256(bundle)
+	checksums := []byte(hex.EncodeToString(sum[:]) + "  step_0.14.0_linux_amd64.tar.gz\n")
+	assets := map[string][]byte{
+		"step_0.14.0_linux_amd64.tar.gz": bundle,
+		"step_0.14.0_checksums.txt":      checksums,
+		"step_0.14.0_checksums.txt.sig":  mustSign(t, signer, checksums),
+	}
+	for k, v := range files {
+		if v == nil {
+			delete(assets, k)
+		} else {
+			assets[k] = v
+		}
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest" {
+			release := Release{Tag: "v0.14.0"}
+			for name := range assets {
+				release.Assets = append(release.Assets, Asset{Name: name, URL: srv.URL + "/download/" + name})
+			}
+			json.NewEncoder(w).Encode(release)
+			return
+		}
+		b, ok := assets[filepath.Base(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	}))
+	return srv
+}
+
+func TestRelease_IsNewer(t *testing.T) {
+	r := &Release{Tag: "v0.14.0"}
+	tests := map[string]bool{
+		"0.13.3":      true,
+		"v0.13.3":     true,
+		"0.9.10":      true,
+		"0.14.0":      false,
+		"0.14.1":      false,
+		"1.0.0":       false,
+		"0000000-dev": true,
+		"0.14.0-rc.1": true,
+	}
+	for version, want := range tests {
+		assert.Equals(t, want, r.IsNewer(version), version)
+	}
+	assert.False(t, (&Release{Tag: "nightly"}).IsNewer("0.13.3"))
+}
+
+func TestLatest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	srv := newServer(t, key, nil)
+	defer srv.Close()
+
+	r, err := Latest(srv.Client(), srv.URL+"/latest")
+	assert.FatalError(t, err)
+	assert.Equals(t, "v0.14.0", r.Tag)
+	assert.Equals(t, "0.14.0", r.Version())
+	assert.Equals(t, "step_0.14.0_linux_amd64.tar.gz", r.BundleName("linux", "amd64"))
+	assert.Equals(t, "step_0.14.0_checksums.txt", r.ChecksumsName())
+	assert.Equals(t, "step_0.14.0_checksums.txt.sig", r.SignatureName())
+
+	_, err = Latest(srv.Client(), srv.URL+"/missing")
+	assert.Error(t, err)
+}
+
+func TestDownload(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	defer setReleaseKey(t, key)()
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	badChecksums := []byte("0000000000000000000000000000000000000000000000000000000000000000  step_0.14.0_linux_amd64.tar.gz\n")
+	missingChecksums := []byte("0000000000000000000000000000000000000000000000000000000000000000  step_0.14.0_darwin_amd64.tar.gz\n")
+
+	tests := []struct {
+		name   string
+		files  map[string][]byte
+		goos   string
+		binary string
+		err    string
+	}{
+		{"ok", nil, "linux", "new binary", ""},
+		{"fail/platform", nil, "windows", "", "release v0.14.0 is not available for windows/amd64"},
+		{"fail/checksum", map[string][]byte{
+			"step_0.14.0_checksums.txt":     badChecksums,
+			"step_0.14.0_checksums.txt.sig": mustSign(t, key, badChecksums),
+		}, "linux", "", "error verifying step_0.14.0_linux_amd64.tar.gz: checksum does not match"},
+		{"fail/no-checksum", map[string][]byte{
+			"step_0.14.0_checksums.txt":     missingChecksums,
+			"step_0.14.0_checksums.txt.sig": mustSign(t, key, missingChecksums),
+		}, "linux", "", "checksum of step_0.14.0_linux_amd64.tar.gz not found"},
+		{"fail/modified-checksums", map[string][]byte{
+			"step_0.14.0_checksums.txt": badChecksums,
+		}, "linux", "", "error verifying step_0.14.0_checksums.txt: signature is not valid"},
+		{"fail/other-key", map[string][]byte{
+			"step_0.14.0_checksums.txt.sig": mustSign(t, otherKey, []byte("")),
+		}, "linux", "", "error verifying step_0.14.0_checksums.txt: signature is not valid"},
+		{"fail/no-signature", map[string][]byte{
+			"step_0.14.0_checksums.txt.sig": nil,
+		}, "linux", "", "release v0.14.0 does not contain step_0.14.0_checksums.txt.sig"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newServer(t, key, tc.files)
+			defer srv.Close()
+
+			r, err := Latest(srv.Client(), srv.URL+"/latest")
+			assert.FatalError(t, err)
+			b, err := Download(srv.Client(), r, tc.goos, "amd64")
+			if tc.err != "" {
+				assert.Error(t, err)
+				assert.Equals(t, tc.err, err.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, tc.binary, string(b))
+		})
+	}
+}
+
+func TestDownload_releaseKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+
+	t.Run("ok/rsa", func(t *testing.T) {
+		defer setReleaseKey(t, rsaKey)()
+		srv := newServer(t, rsaKey, nil)
+		defer srv.Close()
+
+		r, err := Latest(srv.Client(), srv.URL+"/latest")
+		assert.FatalError(t, err)
+		b, err := Download(srv.Client(), r, "linux", "amd64")
+		assert.FatalError(t, err)
+		assert.Equals(t, "new binary", string(b))
+	})
+
+	t.Run("fail/no-key", func(t *testing.T) {
+		old := releasePublicKey
+		releasePublicKey = ""
+		defer func() { releasePublicKey = old }()
+		srv := newServer(t, ecKey, nil)
+		defer srv.Close()
+
+		r, err := Latest(srv.Client(), srv.URL+"/latest")
+		assert.FatalError(t, err)
+		_, err = Download(srv.Client(), r, "linux", "amd64")
+		assert.Equals(t, "step was built without the release signing key: download and install the new release manually", err.Error())
+	})
+
+	t.Run("fail/bad-key", func(t *testing.T) {
+		old := releasePublicKey
+		releasePublicKey = "not-base64"
+		defer func() { releasePublicKey = old }()
+		srv := newServer(t, ecKey, nil)
+		defer srv.Close()
+
+		r, err := Latest(srv.Client(), srv.URL+"/latest")
+		assert.FatalError(t, err)
+		_, err = Download(srv.Client(), r, "linux", "amd64")
+		assert.Error(t, err)
+	})
+}
+
+func TestInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-update")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "step")
+	assert.FatalError(t, ioutil.WriteFile(filename, []byte("old binary"), 0750))
+	assert.NoError(t, Install(filename, []byte("new binary")))
+
+	b, err := ioutil.ReadFile(filename)
+	assert.FatalError(t, err)
+	assert.Equals(t, "new binary", string(b))
+	fi, err := os.Stat(filename)
+	assert.FatalError(t, err)
+	assert.Equals(t, os.FileMode(0750), fi.Mode().Perm())
+
+	infos, err := ioutil.ReadDir(dir)
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, len(infos))
+
+	assert.Error(t, Install(filepath.Join(dir, "missing"), []byte("new binary")))
+}
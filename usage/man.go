@@ -0,0 +1,279 @@
+package usage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/smallstep/cli/errs"
+	md "github.com/smallstep/cli/pkg/blackfriday"
+	"github.com/urfave/cli"
+)
+
+func manHelpAction(ctx *cli.Context) error {
+	dir := path.Clean(ctx.String("man"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errs.FileError(err, dir)
+	}
+
+	// app page
+	if err := writeManPage(ctx.App, dir, ctx.App.HelpName, mdAppHelpTemplate, ctx.App); err != nil {
+		return err
+	}
+
+	// Subcommands
+	for _, cmd := range ctx.App.Commands {
+		if err := manHelpCommand(ctx.App, cmd, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func manHelpCommand(app *cli.App, cmd cli.Command, dir string) error {
+	if len(cmd.Subcommands) == 0 {
+		return writeManPage(app, dir, cmd.HelpName, mdCommandHelpTemplate, cmd)
+	}
+
+	ctx := cli.NewContext(app, nil, nil)
+	ctx.App = createCliApp(ctx, cmd)
+	if err := writeManPage(app, dir, cmd.HelpName, mdSubcommandHelpTemplate, ctx.App); err != nil {
+		return err
+	}
+
+	for _, sub := range cmd.Subcommands {
+		sub.HelpName = fmt.Sprintf("%s %s", cmd.HelpName, sub.Name)
+		if err := manHelpCommand(app, sub, dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeManPage writes the man page of the command with the given help name,
+// e.g. 'step ca certificate' is written in <dir>/step-ca-certificate.1.
+func writeManPage(app *cli.App, dir, helpName, templ string, data interface{}) error {
+	name := strings.Replace(helpName, " ", "-", -1)
+	filename := path.Join(dir, name+".1")
+	w, err := os.Create(filename)
+	if err != nil {
+		return errs.FileError(err, filename)
+	}
+	manHelpPrinter(w, templ, data, &manRenderer{
+		title:   name,
+		date:    app.Compiled,
+		version: app.Version,
+	})
+	return errs.FileError(w.Close(), filename)
+}
+
+func manHelpPrinter(w io.Writer, templ string, data interface{}, r *manRenderer) {
+	b := helpPreprocessor(w, templ, data)
+	// The NAME section must use the format 'name \- description' to be indexed
+	// by whatis and apropos.
+	b = bytes.Replace(b, []byte("** -- "), []byte("** - "), 1)
+	w.Write(md.Run(b, md.WithRenderer(r)))
+}
+
+// manRenderer implements a blackfriday renderer that writes man pages using
+// the roff format.
+type manRenderer struct {
+	title   string
+	date    time.Time
+	version string
+	last    byte
+	lists   []*manList
+	cell    int
+}
+
+type manList struct {
+	flags md.ListType
+	index int
+}
+
+func (r *manRenderer) write(w io.Writer, s string) {
+	if s == "" {
+		return
+	}
+	io.WriteString(w, s)
+	r.last = s[len(s)-1]
+}
+
+// newline starts a new line if the current one is not empty.
+func (r *manRenderer) newline(w io.Writer) {
+	if r.last != 0 && r.last != '\n' {
+		r.write(w, "\n")
+	}
+}
+
+// macro writes a roff request, requests must start at the beginning of a
+// line.
+func (r *manRenderer) macro(w io.Writer, s string) {
+	r.newline(w)
+	r.write(w, s+"\n")
+}
+
+// RenderNode implements blackfriday.Renderer interface.
+func (r *manRenderer) RenderNode(w io.Writer, node *md.Node, entering bool) md.WalkStatus {
+	switch node.Type {
+	case md.Heading:
+		if entering {
+			r.newline(w)
+			if node.Level <= 2 {
+				r.write(w, ".SH ")
+			} else {
+				r.write(w, ".SS ")
+			}
+		} else {
+			r.write(w, "\n")
+		}
+	case md.Paragraph:
+		if entering {
+			switch {
+			case node.Parent.Type == md.Item && node.Prev == nil:
+			case len(r.lists) > 0:
+				r.macro(w, ".IP")
+			default:
+				r.macro(w, ".PP")
+			}
+		}
+	case md.Text:
+		s := manEscape(string(node.Literal))
+		if r.last == '\n' {
+			s = strings.TrimLeft(s, " \t")
+		}
+		r.write(w, s)
+	case md.Softbreak:
+		r.write(w, "\n")
+	case md.Hardbreak:
+		r.macro(w, ".br")
+	case md.Strong:
+		if entering {
+			r.write(w, `\fB`)
+		} else {
+			r.write(w, `\fP`)
+		}
+	case md.Emph:
+		if entering {
+			r.write(w, `\fI`)
+		} else {
+			r.write(w, `\fP`)
+		}
+	case md.Code:
+		r.write(w, `\fI`+manEscape(string(node.Literal))+`\fP`)
+	case md.CodeBlock:
+		r.macro(w, ".sp")
+		r.macro(w, ".RS 4")
+		r.macro(w, ".nf")
+		r.write(w, manEscape(strings.TrimRight(string(node.Literal), "\n"))+"\n")
+		r.macro(w, ".fi")
+		r.macro(w, ".RE")
+	case md.BlockQuote:
+		if entering {
+			r.macro(w, ".RS")
+		} else {
+			r.macro(w, ".RE")
+		}
+	case md.List:
+		if entering {
+			if len(r.lists) > 0 {
+				r.macro(w, ".RS")
+			}
+			r.lists = append(r.lists, &manList{flags: node.ListFlags})
+		} else {
+			r.lists = r.lists[:len(r.lists)-1]
+			if len(r.lists) > 0 {
+				r.macro(w, ".RE")
+			}
+		}
+	case md.Item:
+		if !entering {
+			break
+		}
+		l := r.lists[len(r.lists)-1]
+		switch {
+		case node.ListFlags&md.ListTypeTerm != 0:
+			r.macro(w, ".TP")
+		case node.ListFlags&md.ListTypeDefinition != 0:
+			r.newline(w)
+		case l.flags&md.ListTypeOrdered != 0:
+			l.index++
+			r.macro(w, fmt.Sprintf(`.IP "%d." 4`, l.index))
+		default:
+			r.macro(w, `.IP \(bu 2`)
+		}
+	case md.Table:
+		if entering {
+			r.macro(w, ".PP")
+		}
+	case md.TableHead:
+		// Tables without headers are written with empty headers.
+		if entering && strings.TrimSpace(nodeText(node)) == "" {
+			return md.SkipChildren
+		}
+	case md.TableRow:
+		if entering {
+			r.cell = 0
+		}
+	case md.TableCell:
+		if entering {
+			if r.cell == 0 {
+				r.macro(w, ".TP")
+			} else {
+				r.write(w, "\n")
+			}
+		} else {
+			r.cell++
+		}
+	case md.Image, md.HTMLBlock, md.HTMLSpan:
+		return md.SkipChildren
+	}
+	return md.GoToNext
+}
+
+// RenderHeader implements blackfriday.Renderer interface.
+func (r *manRenderer) RenderHeader(w io.Writer, ast *md.Node) {
+	date := r.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	r.macro(w, fmt.Sprintf(`.TH "%s" "1" "%s" "%s" "step manual"`,
+		strings.ToUpper(r.title), date.Format("January 2006"), r.version))
+}
+
+// RenderFooter implements blackfriday.Renderer interface.
+func (r *manRenderer) RenderFooter(w io.Writer, ast *md.Node) {
+	if r.last != '\n' {
+		r.write(w, "\n")
+	}
+}
+
+// manEscape escapes the roff special characters in the given text.
+func manEscape(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+	// Lines starting with a dot or an apostrophe are requests.
+	s = strings.Replace(s, "\n.", "\n\\&.", -1)
+	s = strings.Replace(s, "\n'", "\n\\&'", -1)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// nodeText returns the text in the given node and its children.
+func nodeText(node *md.Node) string {
+	var buf bytes.Buffer
+	node.Walk(func(n *md.Node, entering bool) md.WalkStatus {
+		if entering {
+			buf.Write(n.Literal)
+		}
+		return md.GoToNext
+	})
+	return buf.String()
+}
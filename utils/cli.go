@@ -2,6 +2,7 @@ package utils
 
 import (
 	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
 	"github.com/urfave/cli"
 )
 
@@ -77,3 +78,24 @@ func GetKeyDetailsFromCLI(ctx *cli.Context, insecure bool, ktyKey, curveKey, siz
 	}
 	return kty, crv, size, nil
 }
+
+// GetNewPasswordFromCLI returns the password of a new key from the CLI
+// context. If the --password-gen flag is set the password is generated and
+// written to the file in the passwordFileKey flag, if it's set. Otherwise the
+// password is read from that file. The passwordFileKey can be empty in
+// commands without a flag for the password of the new key. It returns an
+// empty password if none of the flags is set.
+func GetNewPasswordFromCLI(ctx *cli.Context, passwordFileKey string) (string, error) {
+	var passwordFile string
+	if passwordFileKey != "" {
+		passwordFile = ctx.String(passwordFileKey)
+	}
+	if words := flags.PasswordGenWords(ctx); words > 0 {
+		password, err := GeneratePassword(words, passwordFile)
+		return string(password), err
+	}
+	if passwordFile != "" {
+		return ReadStringPasswordFromFile(passwordFile)
+	}
+	return "", nil
+}
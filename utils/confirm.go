@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/ui"
+)
+
+// ErrNotConfirmed is the error returned if the user does not confirm an
+// action.
+var ErrNotConfirmed = errors.New("operation canceled")
+
+// Confirm asks the user to confirm a destructive action, like the revocation
+// of a certificate or the overwrite of a file. The summary added with
+// ui.WithSummary is printed before the prompt. If the force flag is set,
+// aliased as --yes, the action is confirmed without asking. It returns
+// ErrNotConfirmed if the user does not confirm the action.
+func Confirm(label string, opts ...ui.Option) error {
+	if command.IsForce() {
+		return nil
+	}
+	ok, err := ui.Confirm(label, append(opts, ui.WithFlag("force"))...)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotConfirmed
+	}
+	return nil
+}
+
+// CertificateSummary returns the ui options that add the subject and the
+// serial number of the given certificate to the summary of Confirm.
+func CertificateSummary(cert *x509.Certificate) []ui.Option {
+	subject := cert.Subject.CommonName
+	if subject == "" {
+		subject = cert.Subject.String()
+	}
+	return []ui.Option{
+		ui.WithSummary("Subject", subject),
+		ui.WithSummary("Serial Number", cert.SerialNumber.String()),
+	}
+}
+
+// fileSummary returns the ui options that add a summary of the existing file
+// to the confirmation to overwrite it. If the file starts with a PEM
+// certificate, the summary has its subject and serial number.
+func fileSummary(filename string) []ui.Option {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return CertificateSummary(cert)
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/cli/ui"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirm(t *testing.T) {
+	require.NoError(t, Confirm("Would you like to continue", ui.WithValue("yes")))
+	require.Equal(t, ErrNotConfirmed, Confirm("Would you like to continue", ui.WithValue("no")))
+
+	ui.SetNoPrompt(true)
+	defer ui.SetNoPrompt(false)
+	require.EqualError(t, Confirm("Would you like to continue"), "cannot prompt 'Would you like to continue [y/n]': prompts are disabled; use the '--force' flag")
+}
+
+func TestWriteFile_notConfirmed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utils-confirm-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "file.txt")
+	require.NoError(t, WriteFile(filename, []byte("foo"), 0600))
+
+	ui.SetNoPrompt(true)
+	defer ui.SetNoPrompt(false)
+	require.EqualError(t, WriteFile(filename, []byte("bar"), 0600), "cannot prompt 'Would you like to overwrite "+filename+" [y/n]': prompts are disabled; use the '--force' flag")
+	b, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), b)
+}
+
+func TestFileSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utils-confirm-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "test.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.Len(t, CertificateSummary(cert), 2)
+
+	crtFile := filepath.Join(dir, "test.crt")
+	require.NoError(t, ioutil.WriteFile(crtFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Len(t, fileSummary(crtFile), 2)
+
+	keyFile := filepath.Join(dir, "test.key")
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")}), 0600))
+	require.Len(t, fileSummary(keyFile), 0)
+	require.Len(t, fileSummary(filepath.Join(dir, "missing.crt")), 0)
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/randutil"
+	"github.com/smallstep/cli/ui"
+)
+
+// GeneratePassword returns a new passphrase with the given number of random
+// words separated by dashes. The passphrase is written to filename, a file or
+// a keyring URI, if it's not empty, or it's printed otherwise. It fails if the
+// passphrase has less entropy than the minimum set with
+// ui.SetMinPasswordEntropy.
+func GeneratePassword(words int, filename string) ([]byte, error) {
+	// Each word of the diceware wordlist adds log2(7776) bits of entropy.
+	if min := ui.MinPasswordEntropy(); float64(words)*math.Log2(7776) < float64(min) {
+		return nil, errors.Errorf("error generating password: %d words have less than %d bits of entropy", words, min)
+	}
+	list, err := randutil.Diceware(words)
+	if err != nil {
+		return nil, err
+	}
+	password := []byte(strings.Join(list, "-"))
+
+	if filename != "" {
+		if err := WritePasswordToFile(filename, password); err != nil {
+			return nil, err
+		}
+		ui.Printf("Your password has been saved in %s.\n", filename)
+	} else {
+		ui.PrintSelected("Password", string(password))
+	}
+	return password, nil
+}
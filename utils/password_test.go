@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/cli/keyring"
+	"github.com/smallstep/cli/ui"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utils-password-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Printed
+	b, err := GeneratePassword(6, "")
+	require.NoError(t, err)
+	require.Len(t, strings.Split(string(b), "-"), 6)
+
+	// Written to a file
+	filename := filepath.Join(dir, "password.txt")
+	b, err = GeneratePassword(8, filename)
+	require.NoError(t, err)
+	require.Len(t, strings.Split(string(b), "-"), 8)
+	password, err := ReadPasswordFromFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, b, password)
+
+	// Stored in the keyring
+	keyring.MockInit()
+	b, err = GeneratePassword(6, "keyring:generated")
+	require.NoError(t, err)
+	password, err = ReadPasswordFromFile("keyring:generated")
+	require.NoError(t, err)
+	require.Equal(t, b, password)
+
+	// Minimum entropy
+	ui.SetMinPasswordEntropy(80)
+	defer ui.SetMinPasswordEntropy(0)
+	_, err = GeneratePassword(6, "")
+	require.EqualError(t, err, "error generating password: 6 words have less than 80 bits of entropy")
+	_, err = GeneratePassword(7, "")
+	require.NoError(t, err)
+}
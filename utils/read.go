@@ -10,7 +10,9 @@ import (
 	"unicode"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/cli/debug"
 	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/keyring"
 	"github.com/smallstep/cli/ui"
 )
 
@@ -46,9 +48,25 @@ func ReadString(r io.Reader) (string, error) {
 }
 
 // ReadPasswordFromFile reads and returns the password from the given filename.
-// The contents of the file will be trimmed at the right.
+// The contents of the file will be trimmed at the right. If filename is a
+// keyring URI, like keyring:<name>, the password is read from the keyring of
+// the operating system.
 func ReadPasswordFromFile(filename string) ([]byte, error) {
+	if keyring.IsURI(filename) {
+		name, err := keyring.ParseURI(filename)
+		if err != nil {
+			return nil, err
+		}
+		password, err := keyring.Get(name)
+		debug.Log(debug.LevelVerbose, "keyring read", "name", name, "error", err)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRightFunc(password, unicode.IsSpace), nil
+	}
+
 	password, err := ioutil.ReadFile(filename)
+	debug.Log(debug.LevelVerbose, "file read", "file", filename, "error", err)
 	if err != nil {
 		return nil, errs.FileError(err, filename)
 	}
@@ -92,6 +110,7 @@ func ReadFile(name string) (b []byte, err error) {
 	} else {
 		b, err = ioutil.ReadFile(name)
 	}
+	debug.Log(debug.LevelVerbose, "file read", "file", name, "bytes", len(b), "error", err)
 	if err != nil {
 		return nil, errs.FileError(err, name)
 	}
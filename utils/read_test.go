@@ -7,6 +7,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/smallstep/cli/keyring"
 	"github.com/stretchr/testify/require"
 )
 
@@ -74,6 +75,18 @@ func TestReadPasswordFromFile(t *testing.T) {
 	require.True(t, bytes.Equal([]byte("my-password-on-file"), b), "expected %s to equal %s", b, content)
 }
 
+func TestReadPasswordFromKeyring(t *testing.T) {
+	keyring.MockInit()
+	require.NoError(t, keyring.Set("my-password", []byte("my-password-on-keyring\n")))
+
+	b, err := ReadPasswordFromFile("keyring:my-password")
+	require.NoError(t, err)
+	require.Equal(t, []byte("my-password-on-keyring"), b)
+
+	_, err = ReadPasswordFromFile("keyring:not-found")
+	require.EqualError(t, err, "password 'not-found' not found in the keyring")
+}
+
 func TestStringReadPasswordFromFile(t *testing.T) {
 	content := []byte("my-password-on-file\n")
 	f, cleanup := newFile(t, content)
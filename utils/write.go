@@ -4,11 +4,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
-	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/debug"
+	"github.com/smallstep/cli/keyring"
 )
 
 var (
@@ -22,16 +22,17 @@ var (
 // WriteFile wraps ioutil.WriteFile with a prompt to overwrite a file if
 // the file exists. It returns ErrFileExists if the user picks to not overwrite
 // the file. If force is set to true, the prompt will not be presented and the
-// file if exists will be overwritten.
+// file if exists will be overwritten. If the file has a certificate, its
+// subject and serial number are printed before the prompt.
 func WriteFile(filename string, data []byte, perm os.FileMode) error {
 	if command.IsForce() {
-		return ioutil.WriteFile(filename, data, perm)
+		return writeFile(filename, data, perm)
 	}
 
 	st, err := os.Stat(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return ioutil.WriteFile(filename, data, perm)
+			return writeFile(filename, data, perm)
 		}
 		return errors.Wrapf(err, "error reading information for %s", filename)
 	}
@@ -40,15 +41,36 @@ func WriteFile(filename string, data []byte, perm os.FileMode) error {
 		return ErrIsDir
 	}
 
-	str, err := ui.Prompt(fmt.Sprintf("Would you like to overwrite %s [y/n]", filename), ui.WithValidateYesNo())
-	if err != nil {
+	if err := Confirm(fmt.Sprintf("Would you like to overwrite %s", filename), fileSummary(filename)...); err != nil {
+		if err == ErrNotConfirmed {
+			return ErrFileExists
+		}
 		return err
 	}
-	switch strings.ToLower(strings.TrimSpace(str)) {
-	case "y", "yes":
-	case "n", "no":
-		return ErrFileExists
-	}
 
-	return ioutil.WriteFile(filename, data, perm)
+	return writeFile(filename, data, perm)
+}
+
+// writeFile writes the file and logs the operation if the verbose logs are
+// enabled.
+func writeFile(filename string, data []byte, perm os.FileMode) error {
+	err := ioutil.WriteFile(filename, data, perm)
+	debug.Log(debug.LevelVerbose, "file write", "file", filename, "bytes", len(data), "mode", perm, "error", err)
+	return err
+}
+
+// WritePasswordToFile writes the password to the given filename. If filename
+// is a keyring URI, like keyring:<name>, the password is stored in the keyring
+// of the operating system.
+func WritePasswordToFile(filename string, password []byte) error {
+	if keyring.IsURI(filename) {
+		name, err := keyring.ParseURI(filename)
+		if err != nil {
+			return err
+		}
+		err = keyring.Set(name, password)
+		debug.Log(debug.LevelVerbose, "keyring write", "name", name, "error", err)
+		return err
+	}
+	return WriteFile(filename, []byte(string(password)+"\n"), 0600)
 }
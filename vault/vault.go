@@ -0,0 +1,309 @@
+// Package vault writes certificates and private keys to the key/value secrets
+// engine of HashiCorp Vault. Both versions of the engine are supported. The
+// package uses the HTTP API of Vault directly, without its client library.
+//
+// The address and the token of Vault are read from the standard environment
+// variables, like VAULT_ADDR, VAULT_TOKEN or VAULT_CACERT. Inside Kubernetes
+// the token can be obtained using the Kubernetes auth method with the service
+// account token of the pod.
+package vault
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/x509util"
+)
+
+// DefaultKubernetesMount is the default path where the Kubernetes auth method
+// is enabled.
+const DefaultKubernetesMount = "kubernetes"
+
+// kubernetesTokenFile is the file with the service account token of a pod.
+const kubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// defaultAddress is the address of Vault used if VAULT_ADDR is not set.
+const defaultAddress = "https://127.0.0.1:8200"
+
+type options struct {
+	role      string
+	mount     string
+	tokenFile string
+}
+
+// Option is the type of the options passed to NewClient.
+type Option func(o *options)
+
+// WithKubernetesAuth logs in to Vault using the Kubernetes auth method with
+// the given role. The auth method is expected at the given mount, if empty
+// DefaultKubernetesMount is used.
+func WithKubernetesAuth(role, mount string) Option {
+	return func(o *options) {
+		o.role = role
+		o.mount = mount
+	}
+}
+
+// withKubernetesTokenFile sets the file with the service account token.
+func withKubernetesTokenFile(filename string) Option {
+	return func(o *options) {
+		o.tokenFile = filename
+	}
+}
+
+// Client writes secrets to Vault using its HTTP API.
+type Client struct {
+	addr      *url.URL
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// secret is the response of Vault to the read and login requests.
+type secret struct {
+	Data map[string]interface{} `json:"data"`
+	Auth *struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+}
+
+// NewClient returns a new client configured using the Vault environment
+// variables VAULT_ADDR, VAULT_TOKEN, VAULT_NAMESPACE, VAULT_CACERT,
+// VAULT_CAPATH and VAULT_SKIP_VERIFY. Unless the Kubernetes auth method is
+// used, the token must be set in VAULT_TOKEN.
+func NewClient(opts ...Option) (*Client, error) {
+	o := &options{
+		mount:     DefaultKubernetesMount,
+		tokenFile: kubernetesTokenFile,
+	}
+	for _, fn := range opts {
+		fn(o)
+	}
+	if o.mount == "" {
+		o.mount = DefaultKubernetesMount
+	}
+
+	c, err := newClientFromEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "error configuring Vault client")
+	}
+
+	if o.role != "" {
+		jwt, err := ioutil.ReadFile(o.tokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading Kubernetes service account token")
+		}
+		s, err := c.write(path.Join("auth", o.mount, "login"), map[string]interface{}{
+			"role": o.role,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error logging in to Vault")
+		}
+		if s == nil || s.Auth == nil || s.Auth.ClientToken == "" {
+			return nil, errors.New("error logging in to Vault: response does not contain a token")
+		}
+		c.token = s.Auth.ClientToken
+	} else if c.token == "" {
+		return nil, errors.New("error creating Vault client: VAULT_TOKEN is not set")
+	}
+
+	return c, nil
+}
+
+// newClientFromEnv returns a client without authentication configured using
+// the Vault environment variables.
+func newClientFromEnv() (*Client, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = defaultAddress
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing VAULT_ADDR '%s'", addr)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("error parsing VAULT_ADDR '%s': scheme must be http or https", addr)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if v := os.Getenv("VAULT_SKIP_VERIFY"); v != "" {
+		if tlsConfig.InsecureSkipVerify, err = strconv.ParseBool(v); err != nil {
+			return nil, errors.Wrapf(err, "error parsing VAULT_SKIP_VERIFY '%s'", v)
+		}
+	}
+	if ca := os.Getenv("VAULT_CACERT"); ca != "" {
+		if tlsConfig.RootCAs, err = x509util.ReadCertPool(ca); err != nil {
+			return nil, err
+		}
+	} else if ca := os.Getenv("VAULT_CAPATH"); ca != "" {
+		if tlsConfig.RootCAs, err = x509util.ReadCertPool(ca); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Client{
+		addr:      u,
+		token:     os.Getenv("VAULT_TOKEN"),
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				TLSClientConfig:     tlsConfig,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+		},
+	}, nil
+}
+
+// ParsePath validates and cleans the given secret path, e.g.
+// "secret/step/internal". The path must contain the mount of the secrets
+// engine followed by the path of the secret.
+func ParsePath(p string) (string, error) {
+	clean := strings.Trim(path.Clean("/"+p), "/")
+	if clean == "" || !strings.Contains(clean, "/") {
+		return "", errors.Errorf("invalid Vault path '%s': it must be <mount>/<path>", p)
+	}
+	return clean, nil
+}
+
+// Write writes the given data to the secret in the given path. The data is
+// merged with the current data of the secret, so a renewed certificate can be
+// written without removing the private key.
+func (c *Client) Write(p string, data map[string]string) error {
+	p, err := ParsePath(p)
+	if err != nil {
+		return err
+	}
+	mount, v2, err := c.kvMount(p)
+	if err != nil {
+		return err
+	}
+
+	secretPath := p
+	if v2 {
+		secretPath = path.Join(mount, "data", strings.TrimPrefix(p, mount))
+	}
+
+	merged := make(map[string]interface{})
+	s, err := c.read(secretPath)
+	if err != nil {
+		return errors.Wrapf(err, "error reading Vault secret %s", p)
+	}
+	if s != nil {
+		current := s.Data
+		if v2 {
+			current, _ = s.Data["data"].(map[string]interface{})
+		}
+		for k, v := range current {
+			merged[k] = v
+		}
+	}
+	for k, v := range data {
+		merged[k] = v
+	}
+
+	var body map[string]interface{}
+	if v2 {
+		body = map[string]interface{}{"data": merged}
+	} else {
+		body = merged
+	}
+	if _, err := c.write(secretPath, body); err != nil {
+		return errors.Wrapf(err, "error writing Vault secret %s", p)
+	}
+	return nil
+}
+
+// kvMount returns the mount of the secrets engine of the given path and true
+// if it's a key/value version 2 engine. Vault versions without the
+// internal mounts endpoint only support the version 1.
+func (c *Client) kvMount(p string) (string, bool, error) {
+	s, err := c.read("sys/internal/ui/mounts/" + p)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "error reading Vault mount of %s", p)
+	}
+	if s == nil {
+		return "", false, nil
+	}
+	mount, _ := s.Data["path"].(string)
+	var version string
+	if opts, ok := s.Data["options"].(map[string]interface{}); ok {
+		version, _ = opts["version"].(string)
+	}
+	return strings.TrimSuffix(mount, "/"), version == "2", nil
+}
+
+// read reads the secret in the given path. It returns nil if the secret does
+// not exist.
+func (c *Client) read(p string) (*secret, error) {
+	return c.do(http.MethodGet, p, nil)
+}
+
+// write writes the given data to the given path, and returns the response of
+// Vault if any.
+func (c *Client) write(p string, data map[string]interface{}) (*secret, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling request")
+	}
+	return c.do(http.MethodPut, p, bytes.NewReader(b))
+}
+
+func (c *Client) do(method, p string, body io.Reader) (*secret, error) {
+	u := c.addr.ResolveReference(&url.URL{Path: path.Join("/v1", p)})
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request %s %s", method, u)
+	}
+	if c.token != "" {
+		req.Header.Set("X-Vault-Token", c.token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "client %s %s failed", method, u)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodGet:
+		return nil, nil
+	case resp.StatusCode == http.StatusNoContent:
+		return nil, nil
+	case resp.StatusCode >= 400:
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&e); err == nil && len(e.Errors) > 0 {
+			return nil, errors.Errorf("client %s %s failed: %s: %s", method, u, resp.Status, strings.Join(e.Errors, ", "))
+		}
+		return nil, errors.Errorf("client %s %s failed: %s", method, u, resp.Status)
+	}
+
+	var s secret
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "error decoding response of %s %s", method, u)
+	}
+	return &s, nil
+}
@@ -0,0 +1,217 @@
+package vault
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+// fakeVault is a minimal Vault server with a single key/value engine.
+type fakeVault struct {
+	mount   string
+	v2      bool
+	secrets map[string]map[string]interface{}
+	logins  int
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path[len("/v1/"):]
+	switch {
+	case p == "auth/kubernetes/login":
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["role"] != "step" || body["jwt"] != "the-jwt" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		f.logins++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "k8s-token"},
+		})
+		return
+	case r.Header.Get("X-Vault-Token") != "root-token" && r.Header.Get("X-Vault-Token") != "k8s-token":
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	case p == "sys/internal/ui/mounts/"+f.mount+"/step/internal":
+		if !f.v2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"path":    f.mount + "/",
+				"options": map[string]interface{}{"version": "2"},
+			},
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := f.secrets[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	case http.MethodPut, http.MethodPost:
+		var data map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.secrets[p] = data
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func setEnv(t *testing.T, addr, token string) {
+	assert.FatalError(t, os.Setenv("VAULT_ADDR", addr))
+	assert.FatalError(t, os.Setenv("VAULT_TOKEN", token))
+}
+
+func TestParsePath(t *testing.T) {
+	tests := map[string]string{
+		"secret/step/internal":    "secret/step/internal",
+		"/secret/step/internal/":  "secret/step/internal",
+		"secret//step/./internal": "secret/step/internal",
+		"secret/foo":              "secret/foo",
+		"secret":                  "",
+		"/secret/":                "",
+		"":                        "",
+	}
+	for p, want := range tests {
+		got, err := ParsePath(p)
+		if want == "" {
+			assert.Error(t, err)
+		} else {
+			assert.FatalError(t, err)
+			assert.Equals(t, want, got)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	f := &fakeVault{mount: "secret", secrets: map[string]map[string]interface{}{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	setEnv(t, srv.URL, "")
+	_, err := NewClient()
+	if assert.Error(t, err) {
+		assert.Equals(t, "error creating Vault client: VAULT_TOKEN is not set", err.Error())
+	}
+
+	setEnv(t, srv.URL, "root-token")
+	c, err := NewClient()
+	assert.FatalError(t, err)
+	assert.Equals(t, "root-token", c.token)
+
+	tmp, err := ioutil.TempFile("", "vault-jwt")
+	assert.FatalError(t, err)
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString("the-jwt\n")
+	assert.FatalError(t, err)
+	assert.FatalError(t, tmp.Close())
+
+	setEnv(t, srv.URL, "")
+	c, err = NewClient(WithKubernetesAuth("step", ""), withKubernetesTokenFile(tmp.Name()))
+	assert.FatalError(t, err)
+	assert.Equals(t, "k8s-token", c.token)
+	assert.Equals(t, 1, f.logins)
+
+	_, err = NewClient(WithKubernetesAuth("other", "kubernetes"), withKubernetesTokenFile(tmp.Name()))
+	assert.Error(t, err)
+	_, err = NewClient(WithKubernetesAuth("step", ""), withKubernetesTokenFile(tmp.Name()+".missing"))
+	assert.Error(t, err)
+}
+
+func TestClient_Write(t *testing.T) {
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	tests := map[string]struct {
+		mount      string
+		v2         bool
+		secretPath string
+		current    map[string]interface{}
+		want       map[string]interface{}
+	}{
+		"ok v1": {
+			mount:      "kv",
+			secretPath: "kv/step/internal",
+			want:       map[string]interface{}{"certificate": "crt", "private_key": "key"},
+		},
+		"ok v1 merge": {
+			mount:      "kv",
+			secretPath: "kv/step/internal",
+			current:    map[string]interface{}{"private_key": "old-key", "foo": "bar"},
+			want:       map[string]interface{}{"certificate": "crt", "private_key": "key", "foo": "bar"},
+		},
+		"ok v2": {
+			mount:      "secret",
+			v2:         true,
+			secretPath: "secret/data/step/internal",
+			want:       map[string]interface{}{"data": map[string]interface{}{"certificate": "crt", "private_key": "key"}},
+		},
+		"ok v2 merge": {
+			mount:      "secret",
+			v2:         true,
+			secretPath: "secret/data/step/internal",
+			current:    map[string]interface{}{"data": map[string]interface{}{"private_key": "old-key", "foo": "bar"}},
+			want:       map[string]interface{}{"data": map[string]interface{}{"certificate": "crt", "private_key": "key", "foo": "bar"}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeVault{mount: tc.mount, v2: tc.v2, secrets: map[string]map[string]interface{}{}}
+			if tc.current != nil {
+				f.secrets[tc.secretPath] = tc.current
+			}
+			srv := httptest.NewServer(f)
+			defer srv.Close()
+
+			setEnv(t, srv.URL, "root-token")
+			c, err := NewClient()
+			assert.FatalError(t, err)
+			assert.FatalError(t, c.Write("/"+tc.mount+"/step/internal/", map[string]string{
+				"certificate": "crt",
+				"private_key": "key",
+			}))
+			assert.Equals(t, tc.want, f.secrets[tc.secretPath])
+
+			assert.Error(t, c.Write(tc.mount, map[string]string{"certificate": "crt"}))
+		})
+	}
+}
+
+func TestClient_Write_error(t *testing.T) {
+	f := &fakeVault{mount: "secret", v2: true, secrets: map[string]map[string]interface{}{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	setEnv(t, srv.URL, "bad-token")
+	c, err := NewClient()
+	assert.FatalError(t, err)
+	err = c.Write("secret/step/internal", map[string]string{"certificate": "crt"})
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasSuffix(err.Error(), "403 Forbidden: permission denied"), err.Error())
+	}
+	assert.Len(t, 0, f.secrets)
+
+	setEnv(t, "ftp://"+srv.Listener.Addr().String(), "root-token")
+	_, err = NewClient()
+	assert.Error(t, err)
+}